@@ -8,15 +8,17 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"ai-knowledge-app/internal/api"
+	"ai-knowledge-app/internal/background"
 	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/internal/scheduler"
 	"ai-knowledge-app/internal/service"
+	"ai-knowledge-app/internal/shutdown"
 	"ai-knowledge-app/pkg/database"
 	"ai-knowledge-app/pkg/logger"
 
-	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
 	_ "ai-knowledge-app/docs" // 导入生成的docs包
@@ -67,6 +69,11 @@ func main() {
 		logger.GetLogger().WithField("error", err).Fatal("Failed to migrate database")
 	}
 
+	// 向量列维度与配置的向量模型保持一致
+	if err := models.EnsureVectorDimensions(database.GetDatabase(), cfg.AI.Embedding.Dimensions); err != nil {
+		logger.GetLogger().WithError(err).Error("Vector columns do not match the embedding dimensions, new embeddings cannot be saved")
+	}
+
 	// 初始化MinIO客户端
 	minioClient, err := service.NewMinIOClient(&cfg.S3)
 	if err != nil {
@@ -74,12 +81,22 @@ func main() {
 	}
 	logger.GetLogger().Info("MinIO client initialized successfully")
 
+	// 应用运行时保存的重试配置
+	if retryConfig, err := service.LoadRetryConfigOverride(database.GetDatabase()); err != nil {
+		logger.GetLogger().WithError(err).Warn("Failed to load persisted MinIO retry config, using defaults")
+	} else if retryConfig != nil {
+		minioClient.SetRetryConfig(retryConfig)
+	}
+
 	// 测试MinIO连接
 	if err := minioClient.TestConnection(); err != nil {
 		logger.GetLogger().WithField("error", err).Fatal("MinIO connection test failed")
 	}
 	logger.GetLogger().Info("MinIO connection test passed")
 
+	// 初始化后台任务池
+	background.Init(cfg.Background.Workers, cfg.Background.QueueSize, cfg.Background.TaskTimeout)
+
 	// 创建服务
 	vectorService := service.NewVectorService(&cfg.AI)
 
@@ -87,17 +104,55 @@ func main() {
 	router := api.NewRouter(cfg, vectorService, minioClient)
 	engine := router.SetupRoutes()
 
-	// 创建HTTP服务器
-	server := &http.Server{
-		Addr:    fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
-		Handler: engine,
+	// 启动后台定时任务
+	jobScheduler := scheduler.New()
+	documentService := router.DocumentService()
+	jobScheduler.AddJob("storage_stats_snapshot", cfg.Scheduler.StorageStatsInterval, func(ctx context.Context) error {
+		_, err := documentService.RecordStorageSnapshot(cfg.Scheduler.StorageStatsRetention)
+		return err
+	})
+	jobScheduler.AddJob("upload_session_cleanup", cfg.Scheduler.UploadSessionCleanupInterval, func(ctx context.Context) error {
+		reaped, err := documentService.CleanupExpiredSessions()
+		if err != nil {
+			return err
+		}
+		if reaped > 0 {
+			logger.GetLogger().WithField("sessions", reaped).Info("Cleaned up expired upload sessions")
+		}
+		return nil
+	})
+	jobScheduler.AddJob("processing_auto_retry", cfg.Scheduler.ProcessingRetryInterval, func(ctx context.Context) error {
+		result, err := documentService.RetryFailedProcessing(service.AutoRetryOptions{
+			MaxRetries: cfg.Scheduler.ProcessingRetryMax,
+			MaxAge:     cfg.Scheduler.ProcessingRetryMaxAge,
+			Backoff:    cfg.Scheduler.ProcessingRetryBackoff,
+		}, background.Default())
+		if err != nil {
+			return err
+		}
+		if len(result.Retried) > 0 {
+			logger.GetLogger().WithField("documents", result.Retried).Info("Retried failed document processing")
+		}
+		return nil
+	})
+	jobScheduler.Start()
+
+	// 重新排队上次运行中断（如崩溃）时仍处于排队或处理中的文档
+	// 最近更新时间在任务超时内的文档可能属于仍在运行的其他实例，留待下次启动
+	if requeued, err := documentService.RequeueInterruptedProcessing(cfg.Background.TaskTimeout, background.Default()); err != nil {
+		logger.GetLogger().WithError(err).Error("Failed to requeue interrupted document processing")
+	} else if len(requeued) > 0 {
+		logger.GetLogger().WithField("documents", requeued).Info("Requeued interrupted document processing")
 	}
 
-	// 设置服务器配置
-	if gin.Mode() == gin.ReleaseMode {
-		server.ReadTimeout = 10 * time.Second
-		server.WriteTimeout = 10 * time.Second
-		server.IdleTimeout = 60 * time.Second
+	// 创建HTTP服务器
+	// 超时配置已按运行模式填充默认值
+	server := &http.Server{
+		Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
+		Handler:      engine,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
 
 	// 启动服务器的goroutine
@@ -125,19 +180,22 @@ func main() {
 
 	logger.GetLogger().Info("Shutting down server...")
 
-	// 设置关闭超时
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	// 关闭HTTP服务器
-	if err := server.Shutdown(ctx); err != nil {
-		logger.GetLogger().WithField("error", err).Error("Server forced to shutdown")
-	}
-
-	// 关闭数据库连接
-	if err := database.CloseDatabase(); err != nil {
-		logger.GetLogger().WithField("error", err).Error("Failed to close database")
-	}
+	// 按顺序关闭各子系统，每步使用各自的时间预算，数据库最后关闭
+	// 定时任务（如自动重试）会向后台任务池提交任务，因此先于后台任务池停止
+	shutdownCfg := cfg.Shutdown
+	shutdown.Run(shutdownCfg.Timeout, []shutdown.Step{
+		{Name: "http", Timeout: shutdownCfg.HTTPTimeout, Run: server.Shutdown},
+		{Name: "scheduler", Timeout: shutdownCfg.SchedulerTimeout, Run: func(ctx context.Context) error {
+			jobScheduler.Stop()
+			return nil
+		}},
+		// 超时后取消仍在执行的后台任务
+		{Name: "background", Timeout: shutdownCfg.BackgroundTimeout, Run: background.Shutdown},
+		{Name: "database", Timeout: shutdownCfg.DatabaseTimeout, Run: func(ctx context.Context) error {
+			return database.CloseDatabase()
+		}},
+	})
 
 	logger.GetLogger().Info("Server exited")
-}
\ No newline at end of file
+	logger.Close()
+}
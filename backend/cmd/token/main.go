@@ -0,0 +1,47 @@
+// token 使用配置中的密钥签发JWT，供调用写接口的客户端或运维脚本使用
+//
+//	go run ./cmd/token -user 42
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/middleware"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	userID := flag.String("user", "", "写入令牌sub声明的用户ID")
+	ttl := flag.Duration("ttl", 0, "令牌有效期，默认使用配置中的auth.token_ttl")
+	flag.Parse()
+
+	if *userID == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	godotenv.Load()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Auth.JWTSecret == "" {
+		log.Fatal("auth.jwt_secret is not configured")
+	}
+
+	tokenTTL := cfg.Auth.TokenTTL
+	if *ttl > 0 {
+		tokenTTL = *ttl
+	}
+
+	token, err := middleware.IssueToken([]byte(cfg.Auth.JWTSecret), *userID, tokenTTL)
+	if err != nil {
+		log.Fatalf("Failed to issue token: %v", err)
+	}
+	fmt.Println(token)
+}
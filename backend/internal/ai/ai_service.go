@@ -8,15 +8,17 @@ import (
 	"strings"
 	"time"
 
+	"ai-knowledge-app/internal/background"
 	"ai-knowledge-app/internal/config"
 	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/internal/redact"
 	"ai-knowledge-app/internal/service"
 	"ai-knowledge-app/pkg/database"
 	"ai-knowledge-app/pkg/logger"
+	"ai-knowledge-app/pkg/utils"
 
 	"github.com/pgvector/pgvector-go"
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/openai"
 	"github.com/tmc/langchaingo/prompts"
 	"gorm.io/gorm"
 )
@@ -24,15 +26,29 @@ import (
 // AIService AI服务接口
 type AIService interface {
 	Query(ctx context.Context, req QueryRequest) (*QueryResponse, error)
+	QueryStream(ctx context.Context, req QueryRequest, onChunk func(chunk string) error) (*QueryResponse, error)
+	EstimateTokens(ctx context.Context, req QueryRequest) (*TokenEstimate, error)
+	SummarizeDocument(ctx context.Context, text string) (*DocumentSummary, error)
+	SuggestTags(ctx context.Context, content string, allowed []string) ([]string, error)
+	FindSimilarQueries(ctx context.Context, query string, limit int) ([]SimilarQuery, error)
 	GetModels() []string
 	SetVectorService(vectorService service.VectorService)
+	InvalidateAnswerCache()
+	AnswerCacheStats() CacheStats
 }
 
-// OpenAIService OpenAI兼容的AI服务
+// OpenAIService AI服务，按配置使用OpenAI兼容接口或Claude
 type OpenAIService struct {
 	config        *config.AIConfig
 	llm           llms.Model
 	vectorService service.VectorService
+	answerCache   *AnswerCache     // 未启用时为nil
+	redactor      *redact.Redactor // 未启用脱敏时为nil
+
+	embeddingRepair *embeddingRepairer // 检索时补生成缺失的知识向量
+
+	// submit 提交保存查询历史等后台任务，为nil时使用全局任务池
+	submit func(name string, run background.TaskFunc)
 }
 
 // QueryRequest AI查询请求
@@ -41,39 +57,82 @@ type QueryRequest struct {
 	Model       string   `json:"model"`
 	Temperature float64  `json:"temperature"`
 	MaxTokens   int      `json:"max_tokens"`
-	Context     []string `json:"context,omitempty"`
+	Context     []string `json:"context,omitempty"`   // 之前的对话，按用户问题、AI回答交替排列
+	Sensitive   bool     `json:"sensitive,omitempty"` // 敏感查询不参与相似问题检索
+
+	// ConversationID 会话ID，指定时加载该会话最近的问答作为上下文，本次问答也记入该会话
+	ConversationID string `json:"conversation_id,omitempty"`
+
+	Features FeatureOverrides `json:"features"` // 请求级功能开关，未指定的使用配置默认值
 }
 
 // QueryResponse AI查询响应
 type QueryResponse struct {
 	Response     string        `json:"response"`
 	Model        string        `json:"model"`
-	Tokens       int           `json:"tokens"`
+	Tokens       int           `json:"tokens"` // 生成的token数，同completion_tokens，保留兼容
 	Duration     time.Duration `json:"duration"`
 	KnowledgeIDs []uint        `json:"knowledge_ids,omitempty"`
 	RelevantDocs []string      `json:"relevant_docs,omitempty"`
+	Cached       bool          `json:"cached"`              // 是否来自回答缓存
+	Truncated    bool          `json:"truncated,omitempty"` // 回答超过ai.max_response_chars被截断
+
+	PromptTokens     int  `json:"prompt_tokens"`              // 提示（含之前的对话）的token数
+	CompletionTokens int  `json:"completion_tokens"`          // 生成的token数
+	TokensEstimated  bool `json:"tokens_estimated,omitempty"` // 服务商未返回用量，按分词器计算
+
+	DedupedPassages int           `json:"deduped_passages,omitempty"` // 组装提示前合并的重复段落数
+	Features        QueryFeatures `json:"features"`                   // 实际启用的功能
+	Citations       []Citation    `json:"citations,omitempty"`
+}
+
+// TokenEstimate 查询的预估token用量
+type TokenEstimate struct {
+	Model        string `json:"model"`
+	PromptTokens int    `json:"prompt_tokens"` // 完整提示（系统提示+检索内容+问题）的token数
+	MaxTokens    int    `json:"max_tokens"`    // 允许生成的最大token数
+	TotalTokens  int    `json:"total_tokens"`  // 最坏情况下的总token数
+	KnowledgeIDs []uint `json:"knowledge_ids,omitempty"`
+
+	DedupedPassages int           `json:"deduped_passages,omitempty"` // 组装提示前合并的重复段落数
+	Features        QueryFeatures `json:"features"`
 }
 
 // NewAIService 创建AI服务实例
 func NewAIService(cfg *config.AIConfig) AIService {
-	// 创建LangChain-Go OpenAI LLM实例
-	llm, err := openai.New(
-		openai.WithModel(cfg.OpenAI.Model),
-		openai.WithBaseURL(cfg.OpenAI.BaseURL),
-		openai.WithToken(cfg.OpenAI.APIKey),
-	)
+	var answerCache *AnswerCache
+	if cfg.AnswerCache.Enabled && cfg.AnswerCache.TTL > 0 {
+		answerCache = NewAnswerCache(cfg.AnswerCache.TTL, cfg.AnswerCache.MaxEntries)
+	}
+
+	// 配置加载时已校验脱敏规则
+	redactor, err := cfg.Redaction.Redactor()
+	if err != nil {
+		logger.GetLogger().WithError(err).Error("Invalid redaction configuration, prompts will not be redacted")
+	}
+
+	// 按配置的服务商创建LangChain-Go LLM实例
+	llm, err := newLLM(cfg)
 	if err != nil {
-		logger.GetLogger().WithError(err).Error("Failed to create OpenAI LLM")
+		logger.GetLogger().WithError(err).WithField("provider", cfg.Provider).Error("Failed to create LLM")
 		// 返回一个基本的实例，后续可以重试
 		return &OpenAIService{
-			config: cfg,
-			llm:    nil,
+			config:      cfg,
+			llm:         nil,
+			answerCache: answerCache,
+			redactor:    redactor,
+
+			embeddingRepair: newEmbeddingRepairer(),
 		}
 	}
 
 	return &OpenAIService{
-		config: cfg,
-		llm:    llm,
+		config:      cfg,
+		llm:         llm,
+		answerCache: answerCache,
+		redactor:    redactor,
+
+		embeddingRepair: newEmbeddingRepairer(),
 	}
 }
 
@@ -82,164 +141,431 @@ func (s *OpenAIService) SetVectorService(vectorService service.VectorService) {
 	s.vectorService = vectorService
 }
 
+// InvalidateAnswerCache 知识变更后使已缓存的回答失效
+func (s *OpenAIService) InvalidateAnswerCache() {
+	if s.answerCache != nil {
+		s.answerCache.Invalidate()
+	}
+}
+
+// AnswerCacheStats 返回回答缓存统计
+func (s *OpenAIService) AnswerCacheStats() CacheStats {
+	if s.answerCache == nil {
+		return CacheStats{}
+	}
+	return s.answerCache.Stats()
+}
+
 // Query 执行AI查询
 func (s *OpenAIService) Query(ctx context.Context, req QueryRequest) (*QueryResponse, error) {
-	startTime := time.Now()
+	return s.query(ctx, req, nil)
+}
 
-	// 检查LLM是否已初始化
-	if s.llm == nil {
-		// 尝试重新初始化LLM
-		llm, err := openai.New(
-			openai.WithModel(s.config.OpenAI.Model),
-			openai.WithBaseURL(s.config.OpenAI.BaseURL),
-			openai.WithToken(s.config.OpenAI.APIKey),
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to initialize LLM: %w", err)
+// QueryStream 执行AI查询并在生成过程中通过onChunk推送增量内容
+// onChunk返回错误或ctx取消时中止生成；完整回答生成后照常写入缓存和查询历史
+func (s *OpenAIService) QueryStream(ctx context.Context, req QueryRequest, onChunk func(chunk string) error) (*QueryResponse, error) {
+	return s.query(ctx, req, onChunk)
+}
+
+// query 查询的公共实现，onChunk为nil时不使用流式生成
+func (s *OpenAIService) query(ctx context.Context, req QueryRequest, onChunk func(chunk string) error) (*QueryResponse, error) {
+	startTime := time.Now()
+	model := s.resolveModel(req.Model)
+	features := s.resolveFeatures(req)
+	turns := s.conversationTurns(req)
+
+	// 相同问题（且功能开关、之前的对话相同）命中缓存时直接返回
+	useCache := features.UseCache
+	var cacheKey string
+	var cacheVersion uint64
+	if useCache {
+		keyReq := req
+		keyReq.Context = turns
+		cacheVersion = s.answerCache.Version()
+		cacheKey = answerCacheKey(keyReq, model, features, cacheVersion)
+		if cached, ok := s.answerCache.Get(cacheKey); ok {
+			// 命中缓存时一次性推送完整回答
+			if onChunk != nil {
+				if err := onChunk(cached.Response); err != nil {
+					return nil, err
+				}
+			}
+			cached.Cached = true
+			cached.Duration = time.Since(startTime)
+			s.submitTask("save_query_history", func(ctx context.Context) error {
+				return s.saveQueryHistory(ctx, req, cached)
+			})
+			return cached, nil
 		}
-		s.llm = llm
 	}
 
-	// 获取相关的知识库内容
-	relevantDocs, knowledgeIDs, err := s.searchRelevantKnowledge(ctx, req.Query)
-	if err != nil {
-		logger.GetLogger().WithError(err).Error("Failed to search relevant knowledge")
-		// 继续执行，不要因为向量搜索失败而终止整个查询
+	// 检查LLM是否已初始化
+	if err := s.ensureLLM(); err != nil {
+		return nil, err
 	}
 
-	// 构建系统提示
-	systemPrompt := s.buildSystemPrompt(relevantDocs)
-
-	// 使用LangChain-Go的提示模板
-	promptTemplate := prompts.NewPromptTemplate(
-		systemPrompt,
-		[]string{"query"},
-	)
-
-	// 格式化提示
-	formattedPrompt, err := promptTemplate.Format(map[string]any{
-		"query": req.Query,
-	})
+	// 组装提示（检索相关知识+系统提示+问题）
+	formattedPrompt, retrieval, err := s.preparePrompt(ctx, req.Query, features)
 	if err != nil {
-		return nil, fmt.Errorf("failed to format prompt: %w", err)
+		return nil, err
 	}
 
 	// 使用LangChain-Go生成响应
-	var response string
+	var options []llms.CallOption
 	if req.Temperature > 0 || req.MaxTokens > 0 {
 		// 使用自定义选项
-		options := []llms.CallOption{
-			llms.WithTemperature(req.Temperature),
-		}
+		options = append(options, llms.WithTemperature(req.Temperature))
 		if req.MaxTokens > 0 {
 			options = append(options, llms.WithMaxTokens(req.MaxTokens))
 		}
+	}
+	if onChunk != nil {
+		// 推送的内容与截断后的完整回答一致
+		limiter := &responseLimiter{maxChars: s.config.MaxResponseChars}
+		options = append(options, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			if text := limiter.limit(string(chunk)); text != "" {
+				return onChunk(text)
+			}
+			return nil
+		}))
+	}
 
-		// 使用GenerateFromSinglePrompt支持选项
-		completion, err := llms.GenerateFromSinglePrompt(ctx, s.llm, formattedPrompt, options...)
-		if err != nil {
-			logger.GetLogger().WithError(err).Error("AI query failed")
-			return nil, fmt.Errorf("AI service error: %w", err)
-		}
-		response = completion
-	} else {
-		// 使用默认选项
-		completion, err := llms.GenerateFromSinglePrompt(ctx, s.llm, formattedPrompt)
-		if err != nil {
-			logger.GetLogger().WithError(err).Error("AI query failed")
-			return nil, fmt.Errorf("AI service error: %w", err)
-		}
-		response = completion
+	response, usage, err := s.generateConversation(ctx, turns, formattedPrompt, options...)
+	if err != nil {
+		logger.GetLogger().WithError(err).Error("AI query failed")
+		return nil, fmt.Errorf("AI service error: %w", err)
 	}
 
 	// 计算执行时间
 	duration := time.Since(startTime)
 
-	// 构建响应
-	model := req.Model
-	if model == "" {
-		model = s.config.OpenAI.Model
+	// 构建响应，服务商未返回用量（如部分兼容接口、流式生成）时使用分词器计算
+	tokensEstimated := false
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = CountTokens(model, formattedPrompt)
+		for _, turn := range turns {
+			usage.PromptTokens += CountTokens(model, turn)
+		}
+		tokensEstimated = true
 	}
-	if model == "" {
-		model = "gpt-3.5-turbo"
+	if usage.CompletionTokens == 0 {
+		usage.CompletionTokens = CountTokens(model, response)
+		tokensEstimated = true
+	}
+
+	// 服务商返回异常长的内容时截断，避免占用存储和客户端内存
+	response, truncated := truncateResponse(response, s.config.MaxResponseChars)
+	if truncated {
+		logger.GetLogger().WithFields(map[string]interface{}{
+			"model":     model,
+			"max_chars": s.config.MaxResponseChars,
+		}).Warn("AI response exceeded the maximum length and was truncated")
 	}
 
 	result := &QueryResponse{
-		Response:     response,
-		Model:        model,
-		Tokens:       s.estimateTokens(response), // 简单的token估算
-		Duration:     duration,
-		KnowledgeIDs: knowledgeIDs,
-		RelevantDocs: relevantDocs,
+		Response: response,
+		Model:    model,
+		Tokens:   usage.CompletionTokens,
+		Duration: duration,
+
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TokensEstimated:  tokensEstimated,
+
+		Truncated:       truncated,
+		KnowledgeIDs:    retrieval.KnowledgeIDs,
+		RelevantDocs:    retrieval.Docs,
+		DedupedPassages: retrieval.Deduplicated,
+		Features:        features,
+		Citations:       retrieval.Citations,
+	}
+
+	if useCache {
+		s.answerCache.Set(cacheKey, cacheVersion, result)
 	}
 
 	// 保存查询历史
-	go s.saveQueryHistory(req, result)
+	s.submitTask("save_query_history", func(ctx context.Context) error {
+		return s.saveQueryHistory(ctx, req, result)
+	})
 
 	return result, nil
 }
 
-// searchRelevantKnowledge 搜索相关知识
-func (s *OpenAIService) searchRelevantKnowledge(ctx context.Context, query string) ([]string, []uint, error) {
+// EstimateTokens 在不调用LLM的情况下组装提示并计算token用量
+func (s *OpenAIService) EstimateTokens(ctx context.Context, req QueryRequest) (*TokenEstimate, error) {
+	features := s.resolveFeatures(req)
+	formattedPrompt, retrieval, err := s.preparePrompt(ctx, req.Query, features)
+	if err != nil {
+		return nil, err
+	}
+
+	model := s.resolveModel(req.Model)
+	promptTokens := CountTokens(model, formattedPrompt)
+	for _, turn := range s.conversationTurns(req) {
+		promptTokens += CountTokens(model, turn)
+	}
+	return &TokenEstimate{
+		Model:           model,
+		PromptTokens:    promptTokens,
+		MaxTokens:       req.MaxTokens,
+		TotalTokens:     promptTokens + req.MaxTokens,
+		KnowledgeIDs:    retrieval.KnowledgeIDs,
+		DedupedPassages: retrieval.Deduplicated,
+		Features:        features,
+	}, nil
+}
+
+// ensureLLM 确保LLM已初始化，创建失败时下次调用会重试
+func (s *OpenAIService) ensureLLM() error {
+	if s.llm != nil {
+		return nil
+	}
+
+	llm, err := newLLM(s.config)
+	if err != nil {
+		return fmt.Errorf("failed to initialize LLM: %w", err)
+	}
+	s.llm = llm
+	return nil
+}
+
+// conversationTurns 返回本次查询之前的对话：会话历史在前，请求附带的context在后
+// 加载会话历史失败时只使用请求附带的context
+func (s *OpenAIService) conversationTurns(req QueryRequest) []string {
+	if req.ConversationID == "" {
+		return req.Context
+	}
+	history, err := loadConversation(database.GetDatabase(), req.ConversationID, s.config.MaxConversationTurns)
+	if err != nil {
+		logger.GetLogger().WithError(err).WithField("conversation_id", req.ConversationID).
+			Warn("Failed to load conversation history, continuing without it")
+	}
+	return append(history, req.Context...)
+}
+
+// generate 调用LLM生成回答，返回内容及服务商报告的token用量（未报告的项为0）
+func (s *OpenAIService) generate(ctx context.Context, prompt string, options ...llms.CallOption) (string, TokenUsage, error) {
+	return s.generateConversation(ctx, nil, prompt, options...)
+}
+
+// generateConversation 以之前的对话（问题、回答交替）加本次提示调用LLM，没有之前的对话时只发送本次提示
+func (s *OpenAIService) generateConversation(ctx context.Context, turns []string, prompt string, options ...llms.CallOption) (string, TokenUsage, error) {
+	// 所有发往LLM的内容（问答及之前的对话、摘要、标签）都在此统一脱敏
+	prompt, redactedCounts := s.redactor.Redact(prompt)
+	redacted := make([]string, len(turns))
+	for i, turn := range turns {
+		var counts redact.Counts
+		redacted[i], counts = s.redactor.Redact(turn)
+		for name, n := range counts {
+			if redactedCounts == nil {
+				redactedCounts = redact.Counts{}
+			}
+			redactedCounts[name] += n
+		}
+	}
+	if redactedCounts.Total() > 0 {
+		logger.GetLogger().WithFields(redactedCounts.Fields()).Info("Redacted sensitive data before prompting")
+	}
+
+	resp, err := s.llm.GenerateContent(ctx, conversationMessages(redacted, prompt), options...)
+	if err != nil {
+		return "", TokenUsage{}, err
+	}
+	if len(resp.Choices) < 1 {
+		return "", TokenUsage{}, fmt.Errorf("empty response from model")
+	}
+
+	choice := resp.Choices[0]
+	return choice.Content, usageFromGenerationInfo(choice.GenerationInfo), nil
+}
+
+// preparePrompt 检索相关知识并组装发送给LLM的完整提示
+func (s *OpenAIService) preparePrompt(ctx context.Context, query string, features QueryFeatures) (string, retrievalResult, error) {
+	// 获取相关的知识库内容
+	var passages []retrievedPassage
+	if features.UseRetrieval {
+		var err error
+		passages, err = s.searchRelevantKnowledge(ctx, query, features.TopK, features.MaxDistance)
+		if err != nil {
+			logger.GetLogger().WithError(err).Error("Failed to search relevant knowledge")
+			// 继续执行，不要因为向量搜索失败而终止整个查询
+		}
+	}
+	if features.UseRerank {
+		passages = rerankPassages(query, passages)
+	}
+
+	// 合并重复段落后再组装提示，避免同一内容重复占用上下文
+	passages, deduplicated := dedupePassages(passages)
+	if len(passages) > features.TopK {
+		passages = passages[:features.TopK]
+	}
+	if deduplicated > 0 {
+		logger.GetLogger().WithField("deduplicated", deduplicated).Debug("Collapsed duplicate retrieval passages")
+	}
+
+	retrieval := retrievalResult{Deduplicated: deduplicated}
+	for i, p := range passages {
+		retrieval.Docs = append(retrieval.Docs, p.Formatted)
+		if p.KnowledgeID != 0 {
+			retrieval.KnowledgeIDs = append(retrieval.KnowledgeIDs, p.KnowledgeID)
+		}
+		if features.IncludeCitations {
+			retrieval.Citations = append(retrieval.Citations, Citation{Index: i + 1, KnowledgeID: p.KnowledgeID, Title: p.Title})
+		}
+	}
+
+	// 构建系统提示
+	systemPrompt := s.buildSystemPrompt(retrieval.Docs, features.IncludeCitations, s.answerLanguage(query))
+
+	// 使用LangChain-Go的提示模板（用户问题追加在系统提示之后）
+	promptTemplate := prompts.NewPromptTemplate(
+		systemPrompt+"\n\n用户问题：{{.query}}",
+		[]string{"query"},
+	)
+
+	// 格式化提示
+	formattedPrompt, err := promptTemplate.Format(map[string]any{
+		"query": query,
+	})
+	if err != nil {
+		return "", retrievalResult{}, fmt.Errorf("failed to format prompt: %w", err)
+	}
+
+	return formattedPrompt, retrieval, nil
+}
+
+// resolveModel 返回实际使用的模型名称
+func (s *OpenAIService) resolveModel(model string) string {
+	if model != "" {
+		return model
+	}
+	if isClaude(s.config) {
+		return modelOrDefault(s.config.Claude.Model, defaultClaudeModel)
+	}
+	return modelOrDefault(s.config.OpenAI.Model, defaultOpenAIModel)
+}
+
+// searchRelevantKnowledge 搜索相关知识，结果按相关度从高到低排列
+// 返回最多topK*retrievalCandidateFactor条候选；maxDistance大于0时排除距离更远的知识
+func (s *OpenAIService) searchRelevantKnowledge(ctx context.Context, query string, topK int, maxDistance float64) ([]retrievedPassage, error) {
 	// 检查向量服务是否可用
 	if s.vectorService == nil {
 		logger.GetLogger().Warn("Vector service is not available, skipping knowledge search")
-		return []string{}, []uint{}, nil
+		return nil, nil
 	}
 
 	db := database.GetDatabase()
 	if db == nil {
 		logger.GetLogger().Warn("Database is not available, skipping knowledge search")
-		return []string{}, []uint{}, nil
+		return nil, nil
 	}
 
 	// 1. 生成查询的向量
 	queryEmbedding, err := s.vectorService.GenerateEmbedding(ctx, query)
 	if err != nil {
 		logger.GetLogger().WithError(err).Warn("Failed to generate query embedding, continuing without knowledge search")
-		return []string{}, []uint{}, nil
+		return nil, nil
 	}
 
-	// 2. 在数据库中进行向量相似度搜索
-	var knowledges []models.Knowledge
-	err = db.Model(&models.Knowledge{}).
-		Select("*, (content_vector <-> ?) as distance", pgvector.NewVector(queryEmbedding.Slice())).
-		Where("is_published = ? AND (deleted_at IS NULL)", true).
+	// 2. 在知识原文和译文向量中进行相似度搜索（多取候选，去重后再截断）
+	vector := pgvector.NewVector(queryEmbedding.Slice())
+	search := service.KnowledgeVectorSearch(db, vector)
+	if maxDistance > 0 {
+		search = search.Having("MIN(distance) <= ?", maxDistance)
+	}
+
+	var hits []service.KnowledgeVectorHit
+	err = search.
 		Order("distance").
-		Limit(5).
-		Find(&knowledges).Error
+		Limit(topK * retrievalCandidateFactor).
+		Scan(&hits).Error
 
 	if err != nil {
 		logger.GetLogger().WithError(err).Warn("Failed to search knowledge base, continuing without relevant documents")
-		return []string{}, []uint{}, nil
+		return nil, nil
 	}
 
-	// 提取文档内容和相关知识ID
-	var docs []string
-	var knowledgeIDs []uint
+	knowledges, err := loadKnowledgesInOrder(db, hits)
+	if err != nil {
+		logger.GetLogger().WithError(err).Warn("Failed to load retrieved knowledge, continuing without relevant documents")
+		return nil, nil
+	}
+
+	// 候选中缺少向量的知识在后台补生成，逐步恢复检索覆盖率
+	s.repairMissingEmbeddings(knowledges)
+
+	// 有与查询语言相同的译文时使用译文，便于模型用查询的语言回答
+	if language := utils.DetectLanguage(query); language != "" {
+		if err := service.LocalizeKnowledges(db, knowledges, language); err != nil {
+			logger.GetLogger().WithError(err).Warn("Failed to load knowledge translations, using original content")
+		}
+	}
 
+	// 转换为检索段落
+	passages := make([]retrievedPassage, 0, len(knowledges))
 	for _, k := range knowledges {
 		doc := fmt.Sprintf("标题: %s\n内容: %s", k.Title, k.Content)
 		if k.Summary != "" {
 			doc += fmt.Sprintf("\n摘要: %s", k.Summary)
 		}
-		docs = append(docs, doc)
-		knowledgeIDs = append(knowledgeIDs, k.ID)
+		passages = append(passages, retrievedPassage{
+			Source:      "knowledge",
+			KnowledgeID: k.ID,
+			Title:       k.Title,
+			Text:        k.Content,
+			Formatted:   doc,
+		})
+	}
+
+	return passages, nil
+}
+
+// loadKnowledgesInOrder 按检索结果的顺序加载知识
+func loadKnowledgesInOrder(db *gorm.DB, hits []service.KnowledgeVectorHit) ([]models.Knowledge, error) {
+	if len(hits) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.KnowledgeID
+	}
+	var found []models.Knowledge
+	if err := db.Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, err
 	}
 
-	return docs, knowledgeIDs, nil
+	byID := make(map[uint]models.Knowledge, len(found))
+	for _, k := range found {
+		byID[k.ID] = k
+	}
+	knowledges := make([]models.Knowledge, 0, len(found))
+	for _, id := range ids {
+		if k, ok := byID[id]; ok {
+			knowledges = append(knowledges, k)
+		}
+	}
+	return knowledges, nil
 }
 
-// buildSystemPrompt 构建系统提示
-func (s *OpenAIService) buildSystemPrompt(relevantDocs []string) string {
-	basePrompt := `你是一个专业的知识库助手，专注于根据提供的知识库内容回答用户的问题。
+// buildSystemPrompt 构建系统提示，language为回答应使用的语言
+func (s *OpenAIService) buildSystemPrompt(relevantDocs []string, includeCitations bool, language string) string {
+	name := languageName(language)
+	basePrompt := fmt.Sprintf(`你是一个专业的知识库助手，专注于根据提供的知识库内容回答用户的问题。
 
 回答要求：
 1. 基于提供的知识库内容进行回答
 2. 如果知识库中没有相关信息，诚实地说明而不是编造
 3. 回答要准确、简洁、有条理
-4. 使用中文回答，语气友好专业
-5. 如果信息不完整，可以建议用户查看相关知识条目`
+4. 使用%s回答，语气友好专业
+5. 如果信息不完整，可以建议用户查看相关知识条目`, name)
+
+	// 检索到其他语言的知识时明确要求翻译，避免模型跟随知识的语言回答
+	if hasOtherLanguage(relevantDocs, language) {
+		basePrompt += fmt.Sprintf("\n6. 部分知识库内容使用其他语言，请理解后用%s回答，不要改用知识库内容的语言", name)
+	}
 
 	if len(relevantDocs) > 0 {
 		contextSection := "\n\n相关知识库内容：\n"
@@ -247,30 +573,27 @@ func (s *OpenAIService) buildSystemPrompt(relevantDocs []string) string {
 			contextSection += fmt.Sprintf("\n--- 知识 %d ---\n%s\n", i+1, doc)
 		}
 		basePrompt += contextSection
+
+		if includeCitations {
+			basePrompt += "\n引用知识库内容时，请在相应句子末尾用[编号]标注来源，例如[1]。"
+		}
 	}
 
 	return basePrompt
 }
 
-// estimateTokens 估算token数量（简单实现）
-func (s *OpenAIService) estimateTokens(text string) int {
-	// 简单的token估算：中文字符按1个token计算，英文单词按0.75个token计算
-	chineseCount := 0
-	englishWords := strings.Fields(text)
-
-	// 计算中文字符
-	for _, char := range text {
-		if char >= 0x4e00 && char <= 0x9fff {
-			chineseCount++
-		}
+// submitTask 提交后台任务，未设置submit时使用全局任务池
+func (s *OpenAIService) submitTask(name string, run background.TaskFunc) {
+	if s.submit != nil {
+		s.submit(name, run)
+		return
 	}
-
-	// 估算token数
-	return chineseCount + int(float64(len(englishWords))*0.75)
+	background.Submit(name, run)
 }
 
 // saveQueryHistory 保存查询历史
-func (s *OpenAIService) saveQueryHistory(req QueryRequest, resp *QueryResponse) {
+// 非敏感查询同时保存查询向量，供相似问题检索使用
+func (s *OpenAIService) saveQueryHistory(ctx context.Context, req QueryRequest, resp *QueryResponse) error {
 	db := database.GetDatabase()
 
 	// 提取相关的知识ID
@@ -279,42 +602,77 @@ func (s *OpenAIService) saveQueryHistory(req QueryRequest, resp *QueryResponse)
 		knowledgeID = &resp.KnowledgeIDs[0]
 	}
 
+	// 缓存命中的回答未消耗token
+	tokens, promptTokens, completionTokens := resp.Tokens, resp.PromptTokens, resp.CompletionTokens
+	if resp.Cached {
+		tokens, promptTokens, completionTokens = 0, 0, 0
+	}
+
+	// 保存前再次校验长度，截断后的回答不再重复截断
+	response := resp.Response
+	if !resp.Truncated {
+		response, _ = truncateResponse(response, s.config.MaxResponseChars)
+	}
+
 	// 创建查询历史记录
 	history := models.QueryHistory{
 		Query:       req.Query,
-		Response:    resp.Response,
+		Response:    response,
 		KnowledgeID: knowledgeID,
 		Model:       resp.Model,
-		Tokens:      resp.Tokens,
-		Duration:    int(resp.Duration.Milliseconds()),
-		IsSuccess:   true,
+		Tokens:      tokens,
+
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TokensEstimated:  resp.TokensEstimated && !resp.Cached,
+		Duration:         int(resp.Duration.Milliseconds()),
+		IsSuccess:        true,
+		IsSensitive:      req.Sensitive,
+
+		ConversationID: req.ConversationID,
+		QueryLanguage:  utils.DetectLanguage(req.Query),
+		AnswerLanguage: utils.DetectLanguage(response),
+	}
+
+	if !req.Sensitive && s.vectorService != nil {
+		embedding, err := s.vectorService.GenerateEmbedding(ctx, req.Query)
+		if err != nil {
+			logger.GetLogger().WithError(err).Warn("Failed to generate query embedding, saving history without it")
+		} else {
+			history.QueryVector = &embedding
+		}
 	}
 
 	if err := db.Create(&history).Error; err != nil {
-		logger.WithError(err).Error("Failed to save query history")
+		return fmt.Errorf("failed to save query history: %w", err)
 	}
 
-	// 更新相关知识的使用计数
+	// 更新相关知识的AI引用计数（view_count仅统计人工查看）
 	if len(resp.KnowledgeIDs) > 0 {
-		for _, kid := range resp.KnowledgeIDs {
-			db.Model(&models.Knowledge{}).Where("id = ?", kid).
-				Update("view_count", gorm.Expr("view_count + ?", 1))
+		if err := db.Model(&models.Knowledge{}).Where("id IN ?", resp.KnowledgeIDs).
+			UpdateColumn("ai_reference_count", gorm.Expr("ai_reference_count + ?", 1)).Error; err != nil {
+			return fmt.Errorf("failed to update AI reference count: %w", err)
 		}
 	}
+	return nil
 }
 
 func (s *OpenAIService) GetModels() []string {
 	// 构建API URL
-	url := s.config.OpenAI.BaseURL
-	if !strings.HasSuffix(url, "/") {
-		url += "/"
+	var url string
+	if isClaude(s.config) {
+		url = anthropicBaseURL(modelOrDefault(s.config.Claude.BaseURL, "https://api.anthropic.com")) + "/models"
+	} else {
+		url = s.config.OpenAI.BaseURL
+		if !strings.HasSuffix(url, "/") {
+			url += "/"
+		}
+		url += "v1/models"
 	}
-	url += "v1/models"
 
-	// 创建HTTP请求
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
+	// 使用共用的出站客户端（代理、证书配置），单独设置超时
+	client := *s.config.HTTPClient()
+	client.Timeout = 10 * time.Second
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -323,7 +681,12 @@ func (s *OpenAIService) GetModels() []string {
 	}
 
 	// 添加认证头
-	req.Header.Add("Authorization", "Bearer "+s.config.OpenAI.APIKey)
+	if isClaude(s.config) {
+		req.Header.Add("x-api-key", s.config.Claude.APIKey)
+		req.Header.Add("anthropic-version", anthropicAPIVersion)
+	} else {
+		req.Header.Add("Authorization", "Bearer "+s.config.OpenAI.APIKey)
+	}
 	req.Header.Add("Content-Type", "application/json")
 
 	// 发送请求
@@ -372,6 +735,15 @@ func (s *OpenAIService) GetModels() []string {
 
 // getDefaultModels 返回默认模型列表
 func (s *OpenAIService) getDefaultModels() []string {
+	if isClaude(s.config) {
+		return []string{
+			"claude-3-opus-20240229",
+			"claude-3-sonnet-20240229",
+			"claude-3-haiku-20240307",
+			"claude-3-5-sonnet-20240620",
+		}
+	}
+
 	// 根据配置的base_url返回不同的默认模型
 	if strings.Contains(s.config.OpenAI.BaseURL, "api.chatanywhere.tech") {
 		return []string{
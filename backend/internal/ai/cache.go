@@ -0,0 +1,102 @@
+package ai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-knowledge-app/pkg/utils"
+)
+
+// CacheStats AI回答缓存统计
+type CacheStats struct {
+	Enabled bool    `json:"enabled"`
+	Entries int     `json:"entries"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// AnswerCache 相同问题的AI回答缓存
+// 键包含知识版本，知识变更时版本递增，变更前生成的回答不再命中
+type AnswerCache struct {
+	entries *utils.Cache[string, QueryResponse]
+
+	mu      sync.Mutex
+	version uint64
+}
+
+// NewAnswerCache 创建回答缓存，已满时淘汰最久未使用的回答
+func NewAnswerCache(ttl time.Duration, maxEntries int) *AnswerCache {
+	return &AnswerCache{
+		entries: utils.NewCache(utils.CacheOptions[string, QueryResponse]{TTL: ttl, MaxEntries: maxEntries}),
+	}
+}
+
+// normalizeQuery 规范化问题：忽略大小写和多余空白
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// answerCacheKey 由规范化问题、模型、生成参数、功能开关、附加上下文和知识版本计算缓存键
+// 生成参数（temperature、max_tokens）会改变回答，如较小的max_tokens得到截断的回答
+func answerCacheKey(req QueryRequest, model string, features QueryFeatures, version uint64) string {
+	flags := fmt.Sprintf("%t,%t,%t,%d,%g,%g,%d", features.UseRetrieval, features.UseRerank, features.IncludeCitations, features.TopK, features.MaxDistance,
+		req.Temperature, req.MaxTokens)
+	parts := append([]string{normalizeQuery(req.Query), model, flags, strconv.FormatUint(version, 10)}, req.Context...)
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Version 当前知识版本，查询开始前获取，用于生成缓存键
+func (c *AnswerCache) Version() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// Get 获取未过期的缓存回答，返回副本
+func (c *AnswerCache) Get(key string) (*QueryResponse, bool) {
+	cached, ok := c.entries.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	resp := cached
+	resp.KnowledgeIDs = append([]uint(nil), cached.KnowledgeIDs...)
+	resp.RelevantDocs = append([]string(nil), cached.RelevantDocs...)
+	return &resp, true
+}
+
+// Set 缓存回答；若查询期间知识已变更（版本不一致）则不缓存
+func (c *AnswerCache) Set(key string, version uint64, resp *QueryResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if version != c.version {
+		return
+	}
+
+	entry := *resp
+	entry.KnowledgeIDs = append([]uint(nil), resp.KnowledgeIDs...)
+	entry.RelevantDocs = append([]string(nil), resp.RelevantDocs...)
+	c.entries.Set(key, entry)
+}
+
+// Invalidate 知识变更时清空缓存并递增知识版本
+func (c *AnswerCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	c.entries.Clear()
+}
+
+// Stats 返回缓存统计
+func (c *AnswerCache) Stats() CacheStats {
+	stats := c.entries.Stats()
+	return CacheStats{Enabled: true, Entries: stats.Entries, Hits: stats.Hits, Misses: stats.Misses, HitRate: stats.HitRate}
+}
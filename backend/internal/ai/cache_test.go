@@ -0,0 +1,214 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/background"
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/pkg/database"
+	"ai-knowledge-app/pkg/logger"
+
+	"github.com/tmc/langchaingo/llms"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// countingLLM 返回固定回答并记录调用次数的LLM
+type countingLLM struct {
+	calls      int
+	lastPrompt string
+}
+
+func (m *countingLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.calls++
+	if len(messages) > 0 && len(messages[0].Parts) > 0 {
+		if text, ok := messages[0].Parts[0].(llms.TextContent); ok {
+			m.lastPrompt = text.Text
+		}
+	}
+
+	// 流式调用时分段推送回答
+	opts := llms.CallOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	if opts.StreamingFunc != nil {
+		for _, part := range []string{"cached ", "answer"} {
+			if err := opts.StreamingFunc(ctx, []byte(part)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "cached answer"}}}, nil
+}
+
+func (m *countingLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func TestAnswerCacheKeyNormalization(t *testing.T) {
+	base := answerCacheKey(QueryRequest{Query: "What is  Go?"}, "gpt-4", QueryFeatures{}, 0)
+
+	if got := answerCacheKey(QueryRequest{Query: "  what is go? "}, "gpt-4", QueryFeatures{}, 0); got != base {
+		t.Error("Expected case and whitespace differences to share a cache key")
+	}
+	if answerCacheKey(QueryRequest{Query: "What is Go?"}, "gpt-3.5-turbo", QueryFeatures{}, 0) == base {
+		t.Error("Expected different models to use different keys")
+	}
+	if answerCacheKey(QueryRequest{Query: "What is Go?"}, "gpt-4", QueryFeatures{}, 1) == base {
+		t.Error("Expected different knowledge versions to use different keys")
+	}
+	if answerCacheKey(QueryRequest{Query: "What is Go?", Context: []string{"extra"}}, "gpt-4", QueryFeatures{}, 0) == base {
+		t.Error("Expected additional context to change the key")
+	}
+	if answerCacheKey(QueryRequest{Query: "What is Go?", MaxTokens: 50}, "gpt-4", QueryFeatures{}, 0) ==
+		answerCacheKey(QueryRequest{Query: "What is Go?", MaxTokens: 2000}, "gpt-4", QueryFeatures{}, 0) {
+		t.Error("Expected different max_tokens to use different keys")
+	}
+	if answerCacheKey(QueryRequest{Query: "What is Go?", Temperature: 0.2}, "gpt-4", QueryFeatures{}, 0) == base {
+		t.Error("Expected different temperatures to use different keys")
+	}
+}
+
+func TestAnswerCacheGetSetAndExpiry(t *testing.T) {
+	cache := NewAnswerCache(50*time.Millisecond, 10)
+	key := answerCacheKey(QueryRequest{Query: "q"}, "m", QueryFeatures{}, cache.Version())
+
+	if _, ok := cache.Get(key); ok {
+		t.Fatal("Expected miss on empty cache")
+	}
+
+	cache.Set(key, cache.Version(), &QueryResponse{Response: "a", KnowledgeIDs: []uint{1}})
+	resp, ok := cache.Get(key)
+	if !ok || resp.Response != "a" {
+		t.Fatalf("Expected cached response, got %+v, %v", resp, ok)
+	}
+
+	// 返回的是副本，修改不影响缓存
+	resp.KnowledgeIDs[0] = 99
+	if again, _ := cache.Get(key); again.KnowledgeIDs[0] != 1 {
+		t.Error("Expected cache to return independent copies")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := cache.Get(key); ok {
+		t.Error("Expected entry to expire after TTL")
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 2 || stats.HitRate != 0.5 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestAnswerCacheInvalidate(t *testing.T) {
+	cache := NewAnswerCache(time.Minute, 10)
+	version := cache.Version()
+	key := answerCacheKey(QueryRequest{Query: "q"}, "m", QueryFeatures{}, version)
+	cache.Set(key, version, &QueryResponse{Response: "a"})
+
+	cache.Invalidate()
+	if _, ok := cache.Get(key); ok {
+		t.Error("Expected invalidation to drop cached answers")
+	}
+
+	// 查询期间知识发生变更，旧版本的回答不应写入缓存
+	cache.Set(key, version, &QueryResponse{Response: "stale"})
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Errorf("Expected stale answer not to be cached, got %d entries", stats.Entries)
+	}
+}
+
+func TestAnswerCacheEvictsWhenFull(t *testing.T) {
+	cache := NewAnswerCache(time.Minute, 2)
+	for _, q := range []string{"a", "b", "c"} {
+		cache.Set(answerCacheKey(QueryRequest{Query: q}, "m", QueryFeatures{}, 0), 0, &QueryResponse{Response: q})
+		time.Sleep(time.Millisecond)
+	}
+
+	if stats := cache.Stats(); stats.Entries != 2 {
+		t.Errorf("Expected cache to stay at 2 entries, got %d", stats.Entries)
+	}
+	if _, ok := cache.Get(answerCacheKey(QueryRequest{Query: "a"}, "m", QueryFeatures{}, 0)); ok {
+		t.Error("Expected oldest entry to be evicted")
+	}
+}
+
+// setupTestDB 初始化日志和按测试名隔离的内存数据库，替换全局database.DB并在测试结束后恢复
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Knowledge{}, &models.QueryHistory{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// runInline 直接执行后台任务，测试结束时不会遗留仍在全局任务池中写数据库的任务
+func runInline(name string, run background.TaskFunc) {
+	run(context.Background())
+}
+
+func TestQueryUsesAnswerCache(t *testing.T) {
+	setupTestDB(t)
+
+	llm := &countingLLM{}
+	svc := &OpenAIService{
+		config:      &config.AIConfig{OpenAI: config.OpenAIConfig{Model: "gpt-4"}},
+		llm:         llm,
+		answerCache: NewAnswerCache(time.Minute, 10),
+		submit:      runInline,
+	}
+
+	first, err := svc.Query(context.Background(), QueryRequest{Query: "What is Go?"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if first.Cached {
+		t.Error("Expected first answer not to be cached")
+	}
+
+	second, err := svc.Query(context.Background(), QueryRequest{Query: "what is  go?"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if !second.Cached || second.Response != first.Response || llm.calls != 1 {
+		t.Errorf("Expected cached answer without calling LLM, cached=%v calls=%d", second.Cached, llm.calls)
+	}
+
+	// 敏感查询不使用缓存
+	if resp, _ := svc.Query(context.Background(), QueryRequest{Query: "What is Go?", Sensitive: true}); resp.Cached || llm.calls != 2 {
+		t.Errorf("Expected sensitive query to bypass cache, cached=%v calls=%d", resp.Cached, llm.calls)
+	}
+
+	svc.InvalidateAnswerCache()
+	if resp, _ := svc.Query(context.Background(), QueryRequest{Query: "What is Go?"}); resp.Cached || llm.calls != 3 {
+		t.Errorf("Expected invalidated cache to call LLM again, cached=%v calls=%d", resp.Cached, llm.calls)
+	}
+
+	if stats := svc.AnswerCacheStats(); stats.Hits != 1 || !stats.Enabled {
+		t.Errorf("Unexpected cache stats: %+v", stats)
+	}
+}
@@ -0,0 +1,59 @@
+package ai
+
+import (
+	"fmt"
+
+	"ai-knowledge-app/internal/models"
+
+	"github.com/tmc/langchaingo/llms"
+	"gorm.io/gorm"
+)
+
+// loadConversation 加载会话最近maxTurns轮成功的问答，按时间顺序展开为问题、回答交替的列表
+func loadConversation(db *gorm.DB, conversationID string, maxTurns int) ([]string, error) {
+	if conversationID == "" || maxTurns <= 0 {
+		return nil, nil
+	}
+
+	var histories []models.QueryHistory
+	if err := db.Where("conversation_id = ? AND is_success = ?", conversationID, true).
+		Order("created_at DESC, id DESC").Limit(maxTurns).Find(&histories).Error; err != nil {
+		return nil, fmt.Errorf("failed to load conversation: %w", err)
+	}
+
+	turns := make([]string, 0, len(histories)*2)
+	for i := len(histories) - 1; i >= 0; i-- {
+		turns = append(turns, histories[i].Query, histories[i].Response)
+	}
+	return turns, nil
+}
+
+// conversationMessages 将之前的对话转换为消息列表，最后追加本次的完整提示
+// turns中的内容按用户问题、AI回答交替排列，以用户问题开始；相邻的同角色内容合并为一条消息
+func conversationMessages(turns []string, prompt string) []llms.MessageContent {
+	messages := make([]llms.MessageContent, 0, len(turns)+1)
+	appendText := func(role llms.ChatMessageType, text string) {
+		if n := len(messages); n > 0 && messages[n-1].Role == role {
+			last := messages[n-1].Parts[0].(llms.TextContent)
+			messages[n-1].Parts[0] = llms.TextContent{Text: last.Text + "\n\n" + text}
+			return
+		}
+		messages = append(messages, llms.MessageContent{
+			Role:  role,
+			Parts: []llms.ContentPart{llms.TextContent{Text: text}},
+		})
+	}
+
+	for i, text := range turns {
+		if text == "" {
+			continue
+		}
+		role := llms.ChatMessageTypeHuman
+		if i%2 == 1 {
+			role = llms.ChatMessageTypeAI
+		}
+		appendText(role, text)
+	}
+	appendText(llms.ChatMessageTypeHuman, prompt)
+	return messages
+}
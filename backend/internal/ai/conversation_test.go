@@ -0,0 +1,129 @@
+package ai
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/models"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// recordingLLM 记录最近一次收到的消息并返回固定回答
+type recordingLLM struct {
+	messages []llms.MessageContent
+}
+
+func (m *recordingLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.messages = messages
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "follow-up answer"}}}, nil
+}
+
+func (m *recordingLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+type messageText struct {
+	role llms.ChatMessageType
+	text string
+}
+
+func messageTexts(messages []llms.MessageContent) []messageText {
+	var texts []messageText
+	for _, m := range messages {
+		texts = append(texts, messageText{m.Role, m.Parts[0].(llms.TextContent).Text})
+	}
+	return texts
+}
+
+func TestConversationMessages(t *testing.T) {
+	// 没有之前的对话时只发送本次提示，与单轮查询相同
+	got := messageTexts(conversationMessages(nil, "prompt"))
+	if len(got) != 1 || got[0] != (messageText{llms.ChatMessageTypeHuman, "prompt"}) {
+		t.Errorf("Expected a single human message, got %+v", got)
+	}
+
+	got = messageTexts(conversationMessages([]string{"q1", "a1", "q2", "", "q3"}, "prompt"))
+	want := []messageText{
+		{llms.ChatMessageTypeHuman, "q1"},
+		{llms.ChatMessageTypeAI, "a1"},
+		// 没有回答的问题与相邻的问题合并，保持角色交替
+		{llms.ChatMessageTypeHuman, "q2\n\nq3\n\nprompt"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d messages, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Message %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestQueryLoadsConversation(t *testing.T) {
+	db := setupTestDB(t)
+
+	base := time.Now().Add(-time.Hour)
+	for i, h := range []models.QueryHistory{
+		{Query: "turn 1", Response: "answer 1", IsSuccess: true, ConversationID: "c1"},
+		{Query: "turn 2", Response: "answer 2", IsSuccess: true, ConversationID: "c1"},
+		{Query: "failed", IsSuccess: false, ConversationID: "c1"},
+		{Query: "turn 3", Response: "answer 3", IsSuccess: true, ConversationID: "c1"},
+		{Query: "other", Response: "other answer", IsSuccess: true, ConversationID: "c2"},
+	} {
+		h.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		if err := db.Create(&h).Error; err != nil {
+			t.Fatalf("Failed to create history: %v", err)
+		}
+	}
+	// GORM对零值使用默认值true，单独标记失败记录
+	db.Model(&models.QueryHistory{}).Where("query = ?", "failed").Update("is_success", false)
+
+	llm := &recordingLLM{}
+	svc := &OpenAIService{
+		config: &config.AIConfig{OpenAI: config.OpenAIConfig{Model: "gpt-4"}, MaxConversationTurns: 2},
+		llm:    llm,
+		submit: runInline,
+	}
+
+	// 加载最近两轮成功的问答，之后追加请求中的context
+	resp, err := svc.Query(context.Background(), QueryRequest{
+		Query:          "And then?",
+		ConversationID: "c1",
+		Context:        []string{"extra question", "extra answer"},
+		Features:       FeatureOverrides{UseRetrieval: boolPtr(false)},
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	got := messageTexts(llm.messages)
+	want := []string{"turn 2", "answer 2", "turn 3", "answer 3", "extra question", "extra answer"}
+	if len(got) != len(want)+1 {
+		t.Fatalf("Expected %d messages, got %+v", len(want)+1, got)
+	}
+	for i, text := range want {
+		if got[i].text != text {
+			t.Errorf("Message %d = %q, want %q", i, got[i].text, text)
+		}
+	}
+	if last := got[len(got)-1]; last.role != llms.ChatMessageTypeHuman || last.text == "" {
+		t.Errorf("Expected the prompt as the final human message, got %+v", last)
+	}
+
+	// 本次问答记入同一会话
+	var saved models.QueryHistory
+	db.Where("query = ?", "And then?").First(&saved)
+	if saved.ConversationID != "c1" || saved.Response != resp.Response {
+		t.Errorf("Expected answer to be saved in conversation c1, got %+v", saved)
+	}
+
+	// 不指定会话时不加载历史
+	if _, err := svc.Query(context.Background(), QueryRequest{Query: "Standalone", Features: FeatureOverrides{UseRetrieval: boolPtr(false)}}); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(llm.messages) != 1 {
+		t.Errorf("Expected a single message without a conversation, got %d", len(llm.messages))
+	}
+}
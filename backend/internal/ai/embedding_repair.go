@@ -0,0 +1,100 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ai-knowledge-app/internal/background"
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/pkg/database"
+	"ai-knowledge-app/pkg/logger"
+	"ai-knowledge-app/pkg/utils"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// embeddingRepairCooldown 同一条知识两次补生成向量的最短间隔，避免生成持续失败时反复入队
+	embeddingRepairCooldown = 10 * time.Minute
+	// embeddingRepairPerMinute 每分钟最多入队的补生成任务数，防止检索流量压垮向量接口
+	embeddingRepairPerMinute = 10
+	// embeddingRepairTracked 记录冷却状态的知识数量上限
+	embeddingRepairTracked = 1000
+)
+
+// embeddingRepairer 检索时发现缺少向量的已发布知识，在后台补生成向量
+// 随着真实查询逐步恢复检索覆盖率，作为手动批量重建向量的补充
+type embeddingRepairer struct {
+	recent  *utils.Cache[uint, struct{}] // 冷却期内已入队的知识
+	limiter *rate.Limiter
+	submit  func(name string, run background.TaskFunc)
+}
+
+func newEmbeddingRepairer() *embeddingRepairer {
+	return &embeddingRepairer{
+		recent: utils.NewCache(utils.CacheOptions[uint, struct{}]{
+			MaxEntries: embeddingRepairTracked,
+			TTL:        embeddingRepairCooldown,
+		}),
+		limiter: rate.NewLimiter(rate.Every(time.Minute/embeddingRepairPerMinute), embeddingRepairPerMinute),
+		submit:  background.Submit,
+	}
+}
+
+// missingEmbedding 判断知识是否缺少向量
+func missingEmbedding(k *models.Knowledge) bool {
+	return k.ContentVector == nil || len(k.ContentVector.Slice()) == 0
+}
+
+// repairMissingEmbeddings 为检索候选中缺少向量的已发布知识排队补生成向量
+// 冷却期内的知识和超出速率限制的知识跳过，下次检索遇到时再尝试
+func (s *OpenAIService) repairMissingEmbeddings(knowledges []models.Knowledge) {
+	if s.embeddingRepair == nil || s.vectorService == nil {
+		return
+	}
+
+	for i := range knowledges {
+		k := &knowledges[i]
+		if !k.IsPublished || !missingEmbedding(k) {
+			continue
+		}
+		if _, queued := s.embeddingRepair.recent.Get(k.ID); queued {
+			continue
+		}
+		if !s.embeddingRepair.limiter.Allow() {
+			logger.GetLogger().WithField("knowledge_id", k.ID).Debug("Embedding repair rate limited")
+			return
+		}
+		s.embeddingRepair.recent.Set(k.ID, struct{}{})
+
+		knowledgeID, content := k.ID, k.Content
+		logger.GetLogger().WithField("knowledge_id", knowledgeID).Info("Queued embedding repair for knowledge found without vector during search")
+		s.embeddingRepair.submit("knowledge_embedding_repair", func(ctx context.Context) error {
+			return s.repairEmbedding(ctx, knowledgeID, content)
+		})
+	}
+}
+
+// repairEmbedding 生成并保存向量；期间内容被修改时放弃，由更新流程生成的向量为准
+func (s *OpenAIService) repairEmbedding(ctx context.Context, knowledgeID uint, content string) error {
+	embedding, err := s.vectorService.GenerateEmbedding(ctx, content)
+	if err != nil {
+		logger.GetLogger().WithError(err).WithField("knowledge_id", knowledgeID).Warn("Embedding repair failed")
+		return nil
+	}
+
+	db := database.GetDatabase()
+	result := db.Model(&models.Knowledge{}).
+		Where("id = ? AND content = ?", knowledgeID, content).
+		Update("content_vector", &embedding)
+	if result.Error != nil {
+		return fmt.Errorf("failed to save repaired embedding for knowledge %d: %w", knowledgeID, result.Error)
+	}
+	if result.RowsAffected > 0 {
+		logger.GetLogger().WithField("knowledge_id", knowledgeID).Info("Repaired missing knowledge embedding")
+		// 新向量会改变检索结果
+		s.InvalidateAnswerCache()
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package ai
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/background"
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/pkg/logger"
+
+	"github.com/pgvector/pgvector-go"
+)
+
+func TestRepairMissingEmbeddings(t *testing.T) {
+	db := setupTestDB(t)
+
+	vector := pgvector.NewVector([]float32{1, 2})
+	missing := models.Knowledge{Title: "missing", Content: "a", IsPublished: true}
+	indexed := models.Knowledge{Title: "indexed", Content: "b", IsPublished: true, ContentVector: &vector}
+	draft := models.Knowledge{Title: "draft", Content: "c"}
+	for _, k := range []*models.Knowledge{&missing, &indexed, &draft} {
+		db.Create(k)
+	}
+	db.Model(&draft).Update("is_published", false)
+
+	var queued []background.TaskFunc
+	svc := &OpenAIService{
+		config:          &config.AIConfig{},
+		vectorService:   fixedVectorService{},
+		answerCache:     NewAnswerCache(time.Minute, 10),
+		embeddingRepair: newEmbeddingRepairer(),
+	}
+	svc.embeddingRepair.submit = func(name string, run background.TaskFunc) { queued = append(queued, run) }
+	version := svc.answerCache.Version()
+
+	var candidates []models.Knowledge
+	db.Find(&candidates)
+	svc.repairMissingEmbeddings(candidates)
+	// 冷却期内再次遇到不重复入队
+	svc.repairMissingEmbeddings(candidates)
+	if len(queued) != 1 {
+		t.Fatalf("Expected one repair queued for the published entry without vector, got %d", len(queued))
+	}
+
+	if err := queued[0](context.Background()); err != nil {
+		t.Fatalf("Repair task failed: %v", err)
+	}
+	var repaired models.Knowledge
+	db.First(&repaired, missing.ID)
+	if repaired.ContentVector == nil || len(repaired.ContentVector.Slice()) != 3 {
+		t.Errorf("Expected repaired vector to be saved, got %v", repaired.ContentVector)
+	}
+	if svc.answerCache.Version() == version {
+		t.Error("Expected answer cache to be invalidated after repair")
+	}
+}
+
+func TestRepairMissingEmbeddingsRateLimited(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	queued := 0
+	svc := &OpenAIService{vectorService: fixedVectorService{}, embeddingRepair: newEmbeddingRepairer()}
+	svc.embeddingRepair.submit = func(name string, run background.TaskFunc) { queued++ }
+
+	candidates := make([]models.Knowledge, embeddingRepairPerMinute*2)
+	for i := range candidates {
+		candidates[i] = models.Knowledge{ID: uint(i + 1), IsPublished: true}
+	}
+	svc.repairMissingEmbeddings(candidates)
+	if queued != embeddingRepairPerMinute {
+		t.Errorf("Expected at most %d repairs queued per minute, got %d", embeddingRepairPerMinute, queued)
+	}
+}
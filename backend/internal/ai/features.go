@@ -0,0 +1,146 @@
+package ai
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// FeatureOverrides 请求级的AI功能开关，nil表示使用配置默认值
+type FeatureOverrides struct {
+	UseRetrieval     *bool `json:"use_retrieval,omitempty"`
+	UseRerank        *bool `json:"use_rerank,omitempty"`
+	UseCache         *bool `json:"use_cache,omitempty"`
+	IncludeCitations *bool `json:"include_citations,omitempty"`
+
+	TopK        *int     `json:"top_k,omitempty"`
+	MaxDistance *float64 `json:"max_distance,omitempty"`
+}
+
+// QueryFeatures 单次查询实际启用的AI功能
+type QueryFeatures struct {
+	UseRetrieval     bool `json:"use_retrieval"`
+	UseRerank        bool `json:"use_rerank"`
+	UseCache         bool `json:"use_cache"`
+	IncludeCitations bool `json:"include_citations"`
+
+	TopK        int     `json:"top_k"`        // 写入提示的相关知识数量上限
+	MaxDistance float64 `json:"max_distance"` // 向量距离上限，0表示不限制
+}
+
+// Citation 回答中引用的知识，Index对应提示中的知识编号
+type Citation struct {
+	Index       int    `json:"index"`
+	KnowledgeID uint   `json:"knowledge_id"`
+	Title       string `json:"title"`
+}
+
+// resolveFeatures 合并请求开关与配置默认值
+// 优先级：请求显式指定 > 配置默认值；缓存还要求回答缓存已启用，且敏感查询始终不使用缓存；
+// 不检索时重排序和引用没有意义，一并关闭
+func (s *OpenAIService) resolveFeatures(req QueryRequest) QueryFeatures {
+	defaults := s.config.Features
+	features := QueryFeatures{
+		UseRetrieval:     pick(req.Features.UseRetrieval, defaults.Retrieval),
+		UseRerank:        pick(req.Features.UseRerank, defaults.Rerank),
+		UseCache:         pick(req.Features.UseCache, true),
+		IncludeCitations: pick(req.Features.IncludeCitations, defaults.Citations),
+		TopK:             s.config.Retrieval.TopK,
+		MaxDistance:      s.config.Retrieval.MaxDistance,
+	}
+	if req.Features.TopK != nil {
+		features.TopK = *req.Features.TopK
+	}
+	if req.Features.MaxDistance != nil {
+		features.MaxDistance = *req.Features.MaxDistance
+	}
+	if features.TopK <= 0 {
+		features.TopK = defaultTopK
+	}
+
+	if s.answerCache == nil || req.Sensitive {
+		features.UseCache = false
+	}
+	if !features.UseRetrieval {
+		features.UseRerank = false
+		features.IncludeCitations = false
+	}
+	return features
+}
+
+func pick(override *bool, fallback bool) bool {
+	if override != nil {
+		return *override
+	}
+	return fallback
+}
+
+// rerankPassages 结合向量检索排名与问题关键词覆盖率重新排序
+// 覆盖率相同时保持原有的向量排名
+func rerankPassages(query string, passages []retrievedPassage) []retrievedPassage {
+	terms := queryTerms(query)
+	if len(terms) == 0 || len(passages) < 2 {
+		return passages
+	}
+
+	type scored struct {
+		passage retrievedPassage
+		score   float64
+	}
+	ranked := make([]scored, len(passages))
+	for i, p := range passages {
+		text := strings.ToLower(p.Title + " " + p.Text)
+		matched := 0
+		for term := range terms {
+			if strings.Contains(text, term) {
+				matched++
+			}
+		}
+		coverage := float64(matched) / float64(len(terms))
+		// 向量排名的权重随名次递减，避免关键词覆盖率完全主导
+		ranked[i] = scored{passage: p, score: coverage + 0.5/float64(i+1)}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
+
+	result := make([]retrievedPassage, len(ranked))
+	for i, r := range ranked {
+		result[i] = r.passage
+	}
+	return result
+}
+
+// queryTerms 提取问题关键词：英文按单词（忽略过短的词），中文按相邻两字
+func queryTerms(query string) map[string]struct{} {
+	terms := make(map[string]struct{})
+	var word []rune
+	var prevHan rune
+
+	flushWord := func() {
+		if len(word) > 2 {
+			terms[string(word)] = struct{}{}
+		}
+		word = word[:0]
+	}
+
+	for _, r := range strings.ToLower(query) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			if prevHan != 0 {
+				terms[string([]rune{prevHan, r})] = struct{}{}
+			}
+			prevHan = r
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			prevHan = 0
+			word = append(word, r)
+		default:
+			prevHan = 0
+			flushWord()
+		}
+	}
+	flushWord()
+	return terms
+}
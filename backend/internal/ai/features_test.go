@@ -0,0 +1,146 @@
+package ai
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/pkg/logger"
+)
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func TestResolveFeaturesPrecedence(t *testing.T) {
+	svc := &OpenAIService{
+		config:      &config.AIConfig{Features: config.FeaturesConfig{Retrieval: true, Rerank: true}},
+		answerCache: NewAnswerCache(time.Minute, 10),
+	}
+
+	// 未指定时使用配置默认值
+	got := svc.resolveFeatures(QueryRequest{})
+	want := QueryFeatures{UseRetrieval: true, UseRerank: true, UseCache: true, TopK: defaultTopK}
+	if got != want {
+		t.Errorf("Expected config defaults %+v, got %+v", want, got)
+	}
+
+	// 请求开关优先于配置
+	got = svc.resolveFeatures(QueryRequest{Features: FeatureOverrides{
+		UseRerank:        boolPtr(false),
+		UseCache:         boolPtr(false),
+		IncludeCitations: boolPtr(true),
+	}})
+	want = QueryFeatures{UseRetrieval: true, IncludeCitations: true, TopK: defaultTopK}
+	if got != want {
+		t.Errorf("Expected request overrides %+v, got %+v", want, got)
+	}
+
+	// 关闭检索时重排序和引用一并关闭
+	got = svc.resolveFeatures(QueryRequest{Features: FeatureOverrides{
+		UseRetrieval:     boolPtr(false),
+		IncludeCitations: boolPtr(true),
+	}})
+	if got.UseRerank || got.IncludeCitations {
+		t.Errorf("Expected rerank and citations off without retrieval, got %+v", got)
+	}
+
+	// 敏感查询和未启用缓存时不能强制使用缓存
+	if got := svc.resolveFeatures(QueryRequest{Sensitive: true, Features: FeatureOverrides{UseCache: boolPtr(true)}}); got.UseCache {
+		t.Error("Expected sensitive query to bypass cache")
+	}
+	svc.answerCache = nil
+	if got := svc.resolveFeatures(QueryRequest{Features: FeatureOverrides{UseCache: boolPtr(true)}}); got.UseCache {
+		t.Error("Expected cache off when answer cache is disabled")
+	}
+}
+
+func TestRerankPassages(t *testing.T) {
+	passages := []retrievedPassage{
+		{KnowledgeID: 1, Title: "Cooking", Text: "How to bake bread at home"},
+		{KnowledgeID: 2, Title: "Gardening", Text: "Watering tomatoes in summer"},
+		{KnowledgeID: 3, Title: "Go channels", Text: "Channels synchronize goroutines"},
+	}
+
+	ranked := rerankPassages("Do Go channels synchronize goroutines?", passages)
+	if ranked[0].KnowledgeID != 3 {
+		t.Errorf("Expected keyword match to rank first, got %d", ranked[0].KnowledgeID)
+	}
+	// 关键词覆盖率相同的段落保持原有顺序
+	if ranked[1].KnowledgeID != 1 || ranked[2].KnowledgeID != 2 {
+		t.Errorf("Expected stable order for ties, got %d, %d", ranked[1].KnowledgeID, ranked[2].KnowledgeID)
+	}
+
+	terms := queryTerms("向量检索 in Go")
+	for _, term := range []string{"向量", "量检", "检索"} {
+		if _, ok := terms[term]; !ok {
+			t.Errorf("Expected Han bigram %q in terms %v", term, terms)
+		}
+	}
+	if _, ok := terms["in"]; ok {
+		t.Error("Expected short words to be ignored")
+	}
+}
+
+func TestQueryEchoesFeatures(t *testing.T) {
+	setupTestDB(t)
+
+	llm := &countingLLM{}
+	svc := &OpenAIService{
+		config:      &config.AIConfig{OpenAI: config.OpenAIConfig{Model: "gpt-4"}, Features: config.FeaturesConfig{Retrieval: true}},
+		llm:         llm,
+		answerCache: NewAnswerCache(time.Minute, 10),
+		submit:      runInline,
+	}
+
+	resp, err := svc.Query(context.Background(), QueryRequest{Query: "What is Go?"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if want := (QueryFeatures{UseRetrieval: true, UseCache: true, TopK: defaultTopK}); resp.Features != want {
+		t.Errorf("Expected features %+v, got %+v", want, resp.Features)
+	}
+
+	// use_cache=false 跳过缓存
+	resp, err = svc.Query(context.Background(), QueryRequest{Query: "What is Go?", Features: FeatureOverrides{UseCache: boolPtr(false)}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if resp.Cached || resp.Features.UseCache || llm.calls != 2 {
+		t.Errorf("Expected cache bypass, cached=%v calls=%d", resp.Cached, llm.calls)
+	}
+
+	// 功能开关不同的请求不共用缓存
+	resp, err = svc.Query(context.Background(), QueryRequest{Query: "What is Go?", Features: FeatureOverrides{IncludeCitations: boolPtr(true)}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if resp.Cached || !resp.Features.IncludeCitations || llm.calls != 3 {
+		t.Errorf("Expected separate cache entry per feature set, cached=%v calls=%d", resp.Cached, llm.calls)
+	}
+}
+
+func TestGenerateRedactsPrompt(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	redactor, err := (config.RedactionConfig{Enabled: true, Builtin: []string{"phone"}}).Redactor()
+	if err != nil {
+		t.Fatalf("Failed to create redactor: %v", err)
+	}
+
+	llm := &countingLLM{}
+	svc := &OpenAIService{config: &config.AIConfig{}, llm: llm, redactor: redactor}
+
+	prompt := "请联系13812345678确认"
+	if _, _, err := svc.generate(context.Background(), prompt); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if llm.lastPrompt != "请联系[PHONE]确认" {
+		t.Errorf("Expected redacted prompt, got %q", llm.lastPrompt)
+	}
+	if prompt != "请联系13812345678确认" {
+		t.Error("Original text should not be modified")
+	}
+}
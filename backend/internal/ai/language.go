@@ -0,0 +1,55 @@
+package ai
+
+import (
+	"ai-knowledge-app/pkg/utils"
+)
+
+// defaultAnswerLanguage 未配置回答语言时使用中文
+const defaultAnswerLanguage = "zh"
+
+// languageNames 提示中使用的语言名称
+var languageNames = map[string]string{
+	"zh": "中文",
+	"en": "英文",
+	"ja": "日文",
+	"ko": "韩文",
+	"ru": "俄文",
+	"ar": "阿拉伯文",
+	"fr": "法文",
+	"de": "德文",
+	"es": "西班牙文",
+	"pt": "葡萄牙文",
+}
+
+// answerLanguage 返回回答应使用的语言
+// 启用match_query时使用问题的语言，无法判断时使用配置的回退语言
+func (s *OpenAIService) answerLanguage(query string) string {
+	if s.config.AnswerLanguage.MatchQuery {
+		if language := utils.DetectLanguage(query); language != "" {
+			return language
+		}
+	}
+	if fallback := utils.NormalizeLanguage(s.config.AnswerLanguage.Fallback); fallback != "" {
+		return fallback
+	}
+	return defaultAnswerLanguage
+}
+
+// languageName 返回语言在提示中的名称，未知语言使用语言标签
+func languageName(language string) string {
+	if name, ok := languageNames[utils.BaseLanguage(language)]; ok {
+		return name
+	}
+	return language
+}
+
+// hasOtherLanguage 检索内容中是否有与回答语言不同的段落
+func hasOtherLanguage(docs []string, language string) bool {
+	base := utils.BaseLanguage(language)
+	for _, doc := range docs {
+		if detected := utils.DetectLanguage(doc); detected != "" && detected != base {
+			return true
+		}
+	}
+	return false
+}
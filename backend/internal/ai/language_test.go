@@ -0,0 +1,72 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/models"
+)
+
+func TestBuildSystemPromptMixedLanguageRetrieval(t *testing.T) {
+	svc := &OpenAIService{config: &config.AIConfig{
+		AnswerLanguage: config.AnswerLanguageConfig{MatchQuery: true, Fallback: "zh"},
+	}}
+	docs := []string{
+		"标题: Go并发\n内容: goroutine是Go语言的轻量级线程，通过channel进行通信。",
+		"标题: Channels\n内容: Channels let goroutines communicate safely.",
+	}
+
+	// 英文问题检索到中文知识时，要求用英文回答
+	language := svc.answerLanguage("How do goroutines communicate?")
+	if language != "en" {
+		t.Fatalf("Expected answer language en, got %q", language)
+	}
+	prompt := svc.buildSystemPrompt(docs, false, language)
+	if !strings.Contains(prompt, "使用英文回答") || !strings.Contains(prompt, "不要改用知识库内容的语言") {
+		t.Errorf("Expected English answer instruction for mixed-language retrieval, got:\n%s", prompt)
+	}
+
+	// 中文问题且知识都是中文时不需要额外说明
+	language = svc.answerLanguage("goroutine之间如何通信？")
+	prompt = svc.buildSystemPrompt(docs[:1], false, language)
+	if !strings.Contains(prompt, "使用中文回答") || strings.Contains(prompt, "不要改用知识库内容的语言") {
+		t.Errorf("Expected plain Chinese answer instruction, got:\n%s", prompt)
+	}
+
+	// 无法判断问题语言时使用回退语言
+	if language := svc.answerLanguage("12345?"); language != "zh" {
+		t.Errorf("Expected fallback language zh, got %q", language)
+	}
+
+	// 关闭match_query时始终使用回退语言
+	svc.config.AnswerLanguage = config.AnswerLanguageConfig{Fallback: "EN"}
+	if language := svc.answerLanguage("goroutine之间如何通信？"); language != "en" {
+		t.Errorf("Expected configured fallback en, got %q", language)
+	}
+
+	// 未配置时保持中文回答
+	svc.config.AnswerLanguage = config.AnswerLanguageConfig{}
+	if language := svc.answerLanguage("How?"); language != defaultAnswerLanguage {
+		t.Errorf("Expected default answer language, got %q", language)
+	}
+}
+
+func TestSaveQueryHistoryRecordsLanguages(t *testing.T) {
+	db := setupTestDB(t)
+
+	svc := &OpenAIService{config: &config.AIConfig{}}
+	resp := &QueryResponse{Response: "goroutine之间通过channel通信。", Model: "gpt-4"}
+	if err := svc.saveQueryHistory(context.Background(), QueryRequest{Query: "How do goroutines communicate?"}, resp); err != nil {
+		t.Fatalf("saveQueryHistory failed: %v", err)
+	}
+
+	var history models.QueryHistory
+	if err := db.Where("query = ?", "How do goroutines communicate?").First(&history).Error; err != nil {
+		t.Fatalf("Failed to load history: %v", err)
+	}
+	if history.QueryLanguage != "en" || history.AnswerLanguage != "zh" {
+		t.Errorf("Expected query language en and answer language zh, got %q and %q", history.QueryLanguage, history.AnswerLanguage)
+	}
+}
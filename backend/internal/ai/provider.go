@@ -0,0 +1,77 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+
+	"ai-knowledge-app/internal/config"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// 支持的AI服务商，未知取值按OpenAI处理
+const (
+	ProviderOpenAI = "openai"
+	ProviderClaude = "claude"
+)
+
+const (
+	defaultOpenAIModel = "gpt-3.5-turbo"
+	defaultClaudeModel = "claude-3-sonnet-20240229"
+
+	// anthropicAPIVersion 调用Anthropic REST接口时必须携带的版本头
+	anthropicAPIVersion = "2023-06-01"
+)
+
+// isClaude 判断是否使用Claude服务商
+func isClaude(cfg *config.AIConfig) bool {
+	return strings.EqualFold(strings.TrimSpace(cfg.Provider), ProviderClaude)
+}
+
+// newLLM 按配置的服务商创建LangChain-Go LLM实例
+func newLLM(cfg *config.AIConfig) (llms.Model, error) {
+	if isClaude(cfg) {
+		opts := []anthropic.Option{
+			anthropic.WithModel(modelOrDefault(cfg.Claude.Model, defaultClaudeModel)),
+			anthropic.WithToken(cfg.Claude.APIKey),
+			anthropic.WithHTTPClient(cfg.HTTPClient()),
+		}
+		if cfg.Claude.BaseURL != "" {
+			opts = append(opts, anthropic.WithBaseURL(anthropicBaseURL(cfg.Claude.BaseURL)))
+		}
+		llm, err := anthropic.New(opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Claude LLM: %w", err)
+		}
+		return llm, nil
+	}
+
+	llm, err := openai.New(
+		openai.WithModel(cfg.OpenAI.Model),
+		openai.WithBaseURL(cfg.OpenAI.BaseURL),
+		openai.WithToken(cfg.OpenAI.APIKey),
+		openai.WithHTTPClient(cfg.HTTPClient()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OpenAI LLM: %w", err)
+	}
+	return llm, nil
+}
+
+// anthropicBaseURL 补全API版本路径，配置中通常只写域名（如https://api.anthropic.com）
+func anthropicBaseURL(baseURL string) string {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if !strings.HasSuffix(baseURL, "/v1") {
+		baseURL += "/v1"
+	}
+	return baseURL
+}
+
+func modelOrDefault(model, fallback string) string {
+	if model == "" {
+		return fallback
+	}
+	return model
+}
@@ -0,0 +1,80 @@
+package ai
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ai-knowledge-app/internal/config"
+
+	"github.com/tmc/langchaingo/llms/anthropic"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+func TestNewLLMSelectsProvider(t *testing.T) {
+	claude := &config.AIConfig{Provider: "claude", Claude: config.ClaudeConfig{APIKey: "key", BaseURL: "https://api.anthropic.com"}}
+	llm, err := newLLM(claude)
+	if err != nil {
+		t.Fatalf("Failed to create Claude LLM: %v", err)
+	}
+	if _, ok := llm.(*anthropic.LLM); !ok {
+		t.Errorf("Expected Anthropic LLM for claude provider, got %T", llm)
+	}
+
+	// 未知或未配置的服务商回退到OpenAI
+	for _, provider := range []string{"openai", "", "other"} {
+		llm, err := newLLM(&config.AIConfig{Provider: provider, OpenAI: config.OpenAIConfig{APIKey: "key"}})
+		if err != nil {
+			t.Fatalf("Failed to create OpenAI LLM: %v", err)
+		}
+		if _, ok := llm.(*openai.LLM); !ok {
+			t.Errorf("Provider %q: expected OpenAI LLM, got %T", provider, llm)
+		}
+	}
+}
+
+func TestAnthropicBaseURL(t *testing.T) {
+	for input, want := range map[string]string{
+		"https://api.anthropic.com":     "https://api.anthropic.com/v1",
+		"https://api.anthropic.com/":    "https://api.anthropic.com/v1",
+		"https://proxy.example.com/v1/": "https://proxy.example.com/v1",
+	} {
+		if got := anthropicBaseURL(input); got != want {
+			t.Errorf("anthropicBaseURL(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestClaudeModels(t *testing.T) {
+	var gotKey, gotVersion, gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("x-api-key")
+		gotVersion = r.Header.Get("anthropic-version")
+		gotPath = r.URL.Path
+		w.Write([]byte(`{"data":[{"id":"claude-3-opus-20240229"}]}`))
+	}))
+	defer server.Close()
+
+	svc := &OpenAIService{config: &config.AIConfig{
+		Provider: "claude",
+		Claude:   config.ClaudeConfig{APIKey: "secret", BaseURL: server.URL, Model: "claude-3-haiku-20240307"},
+	}}
+
+	models := svc.GetModels()
+	if len(models) != 1 || models[0] != "claude-3-opus-20240229" {
+		t.Errorf("Unexpected models: %v", models)
+	}
+	if gotPath != "/v1/models" || gotKey != "secret" || gotVersion != anthropicAPIVersion {
+		t.Errorf("Unexpected request: path=%s key=%s version=%s", gotPath, gotKey, gotVersion)
+	}
+
+	if got := svc.resolveModel(""); got != "claude-3-haiku-20240307" {
+		t.Errorf("Expected configured Claude model, got %s", got)
+	}
+	for _, model := range svc.getDefaultModels() {
+		if !strings.HasPrefix(model, "claude-") {
+			t.Errorf("Expected only Claude default models, got %s", model)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package ai
+
+import "unicode/utf8"
+
+// responseTruncatedMarker 回答超过长度上限被截断时追加的提示
+const responseTruncatedMarker = "\n\n[回答过长，已截断]"
+
+// truncateResponse 将回答截断到maxChars个字符并追加截断提示，maxChars为0时不限制
+// 按字符而非字节截断，不会切断多字节字符
+func truncateResponse(response string, maxChars int) (string, bool) {
+	if maxChars <= 0 || utf8.RuneCountInString(response) <= maxChars {
+		return response, false
+	}
+	cut, n := 0, 0
+	for i := range response {
+		if n == maxChars {
+			cut = i
+			break
+		}
+		n++
+	}
+	return response[:cut] + responseTruncatedMarker, true
+}
+
+// responseLimiter 流式生成时只推送长度上限内的内容，超出时推送一次截断提示，之后的内容丢弃
+type responseLimiter struct {
+	maxChars  int
+	sent      int
+	truncated bool
+}
+
+// limit 返回本段中允许推送的内容，没有可推送的内容时返回空字符串
+func (l *responseLimiter) limit(chunk string) string {
+	if l.maxChars <= 0 {
+		return chunk
+	}
+	if l.truncated {
+		return ""
+	}
+	remaining := l.maxChars - l.sent
+	if n := utf8.RuneCountInString(chunk); n <= remaining {
+		l.sent += n
+		return chunk
+	}
+	l.truncated = true
+	l.sent = l.maxChars
+	if remaining <= 0 {
+		return responseTruncatedMarker
+	}
+	head, _ := truncateResponse(chunk, remaining)
+	return head
+}
@@ -0,0 +1,80 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/models"
+)
+
+func TestTruncateResponse(t *testing.T) {
+	tests := []struct {
+		response  string
+		maxChars  int
+		want      string
+		truncated bool
+	}{
+		{"short answer", 0, "short answer", false},
+		{"short answer", 12, "short answer", false},
+		{"short answer", 5, "short" + responseTruncatedMarker, true},
+		// 按字符截断，不切断多字节字符
+		{"知识库回答", 3, "知识库" + responseTruncatedMarker, true},
+	}
+	for _, tt := range tests {
+		got, truncated := truncateResponse(tt.response, tt.maxChars)
+		if got != tt.want || truncated != tt.truncated {
+			t.Errorf("truncateResponse(%q, %d) = %q, %v; want %q, %v", tt.response, tt.maxChars, got, truncated, tt.want, tt.truncated)
+		}
+	}
+}
+
+func TestResponseLimiter(t *testing.T) {
+	limiter := &responseLimiter{maxChars: 8}
+	var streamed strings.Builder
+	for _, chunk := range []string{"cached ", "answer", " more"} {
+		streamed.WriteString(limiter.limit(chunk))
+	}
+	// 推送的内容与截断后的完整回答一致
+	want, _ := truncateResponse("cached answer more", 8)
+	if streamed.String() != want {
+		t.Errorf("Expected streamed %q, got %q", want, streamed.String())
+	}
+
+	// 恰好用完上限后的下一段只推送截断提示
+	limiter = &responseLimiter{maxChars: 7}
+	if got := limiter.limit("cached "); got != "cached " {
+		t.Errorf("Expected chunk within limit to pass through, got %q", got)
+	}
+	if got := limiter.limit("answer"); got != responseTruncatedMarker {
+		t.Errorf("Expected only the marker after the limit, got %q", got)
+	}
+	if got := limiter.limit("more"); got != "" {
+		t.Errorf("Expected nothing after truncation, got %q", got)
+	}
+}
+
+func TestQueryTruncatesLongResponse(t *testing.T) {
+	db := setupTestDB(t)
+
+	svc := &OpenAIService{
+		config: &config.AIConfig{OpenAI: config.OpenAIConfig{Model: "gpt-4"}, MaxResponseChars: 6},
+		llm:    &countingLLM{},
+		submit: runInline,
+	}
+	resp, err := svc.Query(context.Background(), QueryRequest{Query: "Long answer please"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if resp.Response != "cached"+responseTruncatedMarker || !resp.Truncated {
+		t.Errorf("Expected truncated response, got %q (truncated=%v)", resp.Response, resp.Truncated)
+	}
+
+	// 查询历史保存截断后的回答
+	var history models.QueryHistory
+	db.Where("query = ?", "Long answer please").First(&history)
+	if history.Response != resp.Response {
+		t.Errorf("Expected truncated response in history, got %q", history.Response)
+	}
+}
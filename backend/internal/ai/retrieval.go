@@ -0,0 +1,118 @@
+package ai
+
+import (
+	"crypto/sha256"
+	"strings"
+)
+
+const (
+	// defaultTopK 未配置时写入提示的相关知识数量；向量检索多取一倍候选，去重后再截断
+	defaultTopK              = 5
+	retrievalCandidateFactor = 2
+
+	// duplicateSimilarity 两段内容的相似度（字符shingle的Jaccard系数）达到该值视为重复
+	duplicateSimilarity = 0.8
+	shingleSize         = 5
+)
+
+// retrievedPassage 检索得到的一段上下文，按相关度从高到低排列
+type retrievedPassage struct {
+	Source      string // 来源类型，如knowledge
+	KnowledgeID uint   // 来源为知识时的知识ID
+	Title       string // 来源标题，用于引用
+	Text        string // 用于去重比较的正文
+	Formatted   string // 写入提示的内容
+}
+
+// retrievalResult 去重后用于组装提示的检索结果
+type retrievalResult struct {
+	Docs         []string
+	KnowledgeIDs []uint
+	Deduplicated int // 被合并的重复段落数
+	Citations    []Citation
+}
+
+// dedupePassages 合并跨来源的重复或高度相似段落，保留排名最靠前（得分最高）的一条
+// 返回去重后的段落及被合并的数量
+func dedupePassages(passages []retrievedPassage) ([]retrievedPassage, int) {
+	type fingerprint struct {
+		hash     [32]byte
+		shingles map[string]struct{}
+	}
+
+	var kept []retrievedPassage
+	var keptPrints []fingerprint
+	removed := 0
+
+	for _, p := range passages {
+		normalized := normalizePassage(p.Text)
+		fp := fingerprint{hash: sha256.Sum256([]byte(normalized))}
+
+		duplicate := false
+		for i := range keptPrints {
+			if keptPrints[i].hash == fp.hash {
+				duplicate = true
+				break
+			}
+			if fp.shingles == nil {
+				fp.shingles = shingles(normalized)
+			}
+			if keptPrints[i].shingles == nil {
+				keptPrints[i].shingles = shingles(normalizePassage(kept[i].Text))
+			}
+			if jaccard(fp.shingles, keptPrints[i].shingles) >= duplicateSimilarity {
+				duplicate = true
+				break
+			}
+		}
+
+		if duplicate {
+			removed++
+			continue
+		}
+		kept = append(kept, p)
+		keptPrints = append(keptPrints, fp)
+	}
+
+	return kept, removed
+}
+
+// normalizePassage 忽略大小写、空白和标点差异
+func normalizePassage(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if strings.ContainsRune(" \t\r\n.,!?;:-'\"()[]{}，。！？；：“”‘’（）【】、", r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// shingles 以固定长度的字符片段表示文本，中英文通用
+func shingles(text string) map[string]struct{} {
+	runes := []rune(text)
+	set := make(map[string]struct{})
+	if len(runes) <= shingleSize {
+		set[text] = struct{}{}
+		return set
+	}
+	for i := 0; i+shingleSize <= len(runes); i++ {
+		set[string(runes[i:i+shingleSize])] = struct{}{}
+	}
+	return set
+}
+
+// jaccard 两个集合的Jaccard系数
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	intersection := 0
+	for k := range a {
+		if _, ok := b[k]; ok {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
+}
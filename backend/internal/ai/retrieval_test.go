@@ -0,0 +1,149 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/pkg/database"
+	"ai-knowledge-app/pkg/logger"
+
+	"github.com/pgvector/pgvector-go"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestDedupePassages(t *testing.T) {
+	goIntro := "Go is an open source programming language that makes it simple to build secure, scalable systems. " +
+		"It was designed at Google and provides built-in concurrency through goroutines and channels. " +
+		"Programs compile quickly to a single static binary."
+
+	passages := []retrievedPassage{
+		{KnowledgeID: 1, Text: goIntro},
+		{KnowledgeID: 2, Text: "Rust is a systems programming language focused on safety."},
+		// 与第一条仅大小写、空白和标点不同
+		{KnowledgeID: 3, Text: "go is an open-source programming language that makes it simple to build secure,  scalable systems! " +
+			"It was designed at Google and provides built in concurrency through goroutines and channels; " +
+			"programs compile quickly to a single static binary"},
+		// 与第一条高度相似（由文档转换生成的近似副本）
+		{KnowledgeID: 4, Text: goIntro + " It is widely used for cloud services."},
+		{KnowledgeID: 5, Text: "Go语言是一种开源编程语言，它能让构造简单、可靠且高效的软件变得容易。"},
+		{KnowledgeID: 6, Text: "Go语言是一种开源编程语言。它能让构造简单、可靠且高效的软件变得容易"},
+	}
+
+	kept, removed := dedupePassages(passages)
+	if removed != 3 {
+		t.Errorf("Expected 3 duplicates to be collapsed, got %d", removed)
+	}
+
+	var ids []uint
+	for _, p := range kept {
+		ids = append(ids, p.KnowledgeID)
+	}
+	// 保留排名最靠前的一条
+	expected := []uint{1, 2, 5}
+	if len(ids) != len(expected) {
+		t.Fatalf("Expected kept ids %v, got %v", expected, ids)
+	}
+	for i := range expected {
+		if ids[i] != expected[i] {
+			t.Fatalf("Expected kept ids %v, got %v", expected, ids)
+		}
+	}
+}
+
+func TestDedupePassagesKeepsDistinctContent(t *testing.T) {
+	passages := []retrievedPassage{
+		{KnowledgeID: 1, Text: "Install Go from the official website."},
+		{KnowledgeID: 2, Text: "Install Rust with rustup."},
+		{KnowledgeID: 3, Text: ""},
+	}
+
+	kept, removed := dedupePassages(passages)
+	if removed != 0 || len(kept) != 3 {
+		t.Errorf("Expected all distinct passages to be kept, got %d kept, %d removed", len(kept), removed)
+	}
+}
+
+// fixedVectorService 返回固定向量的测试向量服务
+type fixedVectorService struct{}
+
+func (fixedVectorService) GenerateEmbedding(ctx context.Context, text string) (pgvector.Vector, error) {
+	return pgvector.NewVector([]float32{0.1, 0.2, 0.3}), nil
+}
+
+func (fixedVectorService) GenerateEmbeddings(ctx context.Context, texts []string) ([]pgvector.Vector, error) {
+	vectors := make([]pgvector.Vector, len(texts))
+	for i := range texts {
+		vectors[i] = pgvector.NewVector([]float32{0.1, 0.2, 0.3})
+	}
+	return vectors, nil
+}
+
+func TestSearchRelevantKnowledgeAppliesTopKAndMaxDistance(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	// pgvector运算符在SQLite中不可用，只检查生成的SQL
+	var lastSQL string
+	captureSQL := func(tx *gorm.DB) {
+		lastSQL = tx.Statement.SQL.String()
+	}
+	db.Callback().Query().After("gorm:query").Register("capture_sql", captureSQL)
+	// 检索结果通过Scan读取，走Row回调
+	db.Callback().Row().After("gorm:row").Register("capture_row_sql", captureSQL)
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+
+	svc := &OpenAIService{config: &config.AIConfig{}, vectorService: fixedVectorService{}}
+
+	if _, err := svc.searchRelevantKnowledge(context.Background(), "q", 3, 0.4); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if !strings.Contains(lastSQL, "(content_vector <-> ") || !strings.Contains(lastSQL, ") <= ") || !strings.Contains(lastSQL, "LIMIT 6") ||
+		!strings.Contains(lastSQL, "UNION ALL") || !strings.Contains(lastSQL, "knowledge_translations.content_vector <-> ") {
+		t.Errorf("Expected distance cutoff, top_k candidates and translation vectors in SQL, got %s", lastSQL)
+	}
+
+	// max_distance为0时不限制距离
+	if _, err := svc.searchRelevantKnowledge(context.Background(), "q", 5, 0); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if strings.Contains(lastSQL, ") <= ") || !strings.Contains(lastSQL, "LIMIT 10") {
+		t.Errorf("Expected no distance cutoff without max_distance, got %s", lastSQL)
+	}
+}
+
+func TestResolveFeaturesRetrievalOverrides(t *testing.T) {
+	svc := &OpenAIService{config: &config.AIConfig{
+		Features:  config.FeaturesConfig{Retrieval: true},
+		Retrieval: config.RetrievalConfig{TopK: 8, MaxDistance: 0.6},
+	}}
+
+	if got := svc.resolveFeatures(QueryRequest{}); got.TopK != 8 || got.MaxDistance != 0.6 {
+		t.Errorf("Expected config defaults, got top_k=%d max_distance=%g", got.TopK, got.MaxDistance)
+	}
+
+	topK, maxDistance := 2, 0.0
+	got := svc.resolveFeatures(QueryRequest{Features: FeatureOverrides{TopK: &topK, MaxDistance: &maxDistance}})
+	if got.TopK != 2 || got.MaxDistance != 0 {
+		t.Errorf("Expected request overrides, got top_k=%d max_distance=%g", got.TopK, got.MaxDistance)
+	}
+
+	// 不同检索参数的回答不共用缓存
+	req := QueryRequest{Query: "q"}
+	if answerCacheKey(req, "m", QueryFeatures{TopK: 5}, 0) == answerCacheKey(req, "m", QueryFeatures{TopK: 3}, 0) {
+		t.Error("Expected top_k to change the cache key")
+	}
+
+	svc.config.Retrieval = config.RetrievalConfig{}
+	if got := svc.resolveFeatures(QueryRequest{}); got.TopK != defaultTopK {
+		t.Errorf("Expected default top_k %d when unset, got %d", defaultTopK, got.TopK)
+	}
+}
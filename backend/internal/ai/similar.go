@@ -0,0 +1,64 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/internal/service"
+	"ai-knowledge-app/pkg/database"
+
+	"github.com/pgvector/pgvector-go"
+)
+
+// ErrVectorServiceUnavailable 未配置向量服务，无法进行语义检索
+var ErrVectorServiceUnavailable = errors.New("vector service is not available")
+
+// similarQueryMaxDistance 相似问题的最大向量距离（L2），超过视为不相关
+const similarQueryMaxDistance = 0.5
+
+// SimilarQuery 与输入语义相似的历史查询
+type SimilarQuery struct {
+	ID        uint      `json:"id"`
+	Query     string    `json:"query"`
+	Response  string    `json:"response"`
+	Model     string    `json:"model"`
+	Distance  float64   `json:"distance"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FindSimilarQueries 查找与输入语义相似的历史成功查询及其回答
+// 敏感查询和没有查询向量的记录不参与检索
+func (s *OpenAIService) FindSimilarQueries(ctx context.Context, query string, limit int) ([]SimilarQuery, error) {
+	if s.vectorService == nil {
+		return nil, ErrVectorServiceUnavailable
+	}
+
+	embedding, err := s.vectorService.GenerateEmbedding(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+	}
+
+	db := database.GetDatabase()
+	vector := pgvector.NewVector(embedding.Slice())
+
+	search := db.WithContext(ctx).Model(&models.QueryHistory{}).
+		Where("is_success = ? AND is_sensitive = ? AND query_vector IS NOT NULL", true, false)
+	// 跳过更换向量模型前记录的维度不一致的查询向量
+	search = service.MatchVectorDimension(search, models.QueryHistory{}.TableName(), "query_vector", len(embedding.Slice()))
+
+	var results []SimilarQuery
+	err = search.
+		Select("id, query, response, model, created_at, (query_vector <-> ?) as distance", vector).
+		Where("(query_vector <-> ?) <= ?", vector, similarQueryMaxDistance).
+		Order("distance").
+		Limit(limit).
+		Scan(&results).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to search query history: %w", err)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,60 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/models"
+)
+
+func TestQueryStream(t *testing.T) {
+	db := setupTestDB(t)
+
+	llm := &countingLLM{}
+	svc := &OpenAIService{
+		config:      &config.AIConfig{OpenAI: config.OpenAIConfig{Model: "gpt-4"}},
+		llm:         llm,
+		answerCache: NewAnswerCache(time.Minute, 10),
+		submit:      runInline,
+	}
+
+	var chunks []string
+	resp, err := svc.QueryStream(context.Background(), QueryRequest{Query: "What is Go?"}, func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("QueryStream failed: %v", err)
+	}
+	if len(chunks) != 2 || resp.Response != "cached answer" || resp.Model != "gpt-4" {
+		t.Errorf("Unexpected stream result: chunks=%q resp=%+v", chunks, resp)
+	}
+
+	// 历史记录保存完整回答
+	var history models.QueryHistory
+	db.Where("query = ?", "What is Go?").First(&history)
+	if history.Response != "cached answer" {
+		t.Errorf("Expected full response in history, got %q", history.Response)
+	}
+
+	// 命中缓存时一次性推送完整回答
+	chunks = nil
+	resp, err = svc.QueryStream(context.Background(), QueryRequest{Query: "what is go?"}, func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil || !resp.Cached || len(chunks) != 1 || chunks[0] != "cached answer" {
+		t.Errorf("Expected cached answer as single chunk, got %q, %v", chunks, err)
+	}
+
+	// 推送失败（如客户端断开）时中止生成
+	errGone := errors.New("client gone")
+	if _, err := svc.QueryStream(context.Background(), QueryRequest{Query: "another question"}, func(string) error {
+		return errGone
+	}); !errors.Is(err, errGone) {
+		t.Errorf("Expected stream error to abort query, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// maxSummaryInputRunes 发送给LLM做摘要的文档内容上限（按字符截断）
+const maxSummaryInputRunes = 12000
+
+// maxSuggestedTags 建议标签数量上限
+const maxSuggestedTags = 5
+
+// DocumentSummary LLM为文档生成的标题、摘要及建议的标签/分类
+type DocumentSummary struct {
+	Title    string   `json:"title"`
+	Summary  string   `json:"summary"`
+	Tags     []string `json:"tags"`
+	Category string   `json:"category"`
+}
+
+// summarizePrompt 文档摘要提示，要求LLM仅返回JSON
+const summarizePrompt = `你是一个知识库编辑，请阅读下面的文档内容，为其生成一条知识条目。
+
+要求：
+1. title：简洁准确的标题，不超过50个字
+2. summary：200字以内的摘要，概括文档的核心内容
+3. tags：3到5个关键词标签
+4. category：一个最合适的分类名称
+5. 只返回JSON，不要包含任何其他内容，格式如下：
+{"title": "...", "summary": "...", "tags": ["..."], "category": "..."}
+
+文档内容：
+`
+
+// SummarizeDocument 使用LLM为整篇文档生成标题、摘要及建议的标签/分类
+func (s *OpenAIService) SummarizeDocument(ctx context.Context, text string) (*DocumentSummary, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("document text is empty")
+	}
+
+	if err := s.ensureLLM(); err != nil {
+		return nil, err
+	}
+
+	if runes := []rune(text); len(runes) > maxSummaryInputRunes {
+		text = string(runes[:maxSummaryInputRunes])
+	}
+
+	completion, _, err := s.generate(ctx, summarizePrompt+text)
+	if err != nil {
+		return nil, fmt.Errorf("AI service error: %w", err)
+	}
+
+	return parseDocumentSummary(completion)
+}
+
+// parseDocumentSummary 解析LLM返回的JSON（容忍前后的说明文字或代码块标记）
+func parseDocumentSummary(raw string) (*DocumentSummary, error) {
+	start := strings.Index(raw, "{")
+	end := strings.LastIndex(raw, "}")
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("no JSON object in summary response")
+	}
+
+	var summary DocumentSummary
+	if err := json.Unmarshal([]byte(raw[start:end+1]), &summary); err != nil {
+		return nil, fmt.Errorf("failed to parse summary response: %w", err)
+	}
+
+	summary.Title = strings.TrimSpace(summary.Title)
+	summary.Summary = strings.TrimSpace(summary.Summary)
+	summary.Category = strings.TrimSpace(summary.Category)
+	if summary.Title == "" {
+		return nil, fmt.Errorf("summary response has no title")
+	}
+
+	// 去除空标签并限制数量
+	tags := make([]string, 0, len(summary.Tags))
+	for _, tag := range summary.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+		if len(tags) == maxSuggestedTags {
+			break
+		}
+	}
+	summary.Tags = tags
+
+	return &summary, nil
+}
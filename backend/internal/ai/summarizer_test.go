@@ -0,0 +1,66 @@
+package ai
+
+import "testing"
+
+func TestParseDocumentSummary(t *testing.T) {
+	raw := "好的，以下是结果：\n```json\n{\"title\": \" Go并发 \", \"summary\": \"介绍goroutine\", \"tags\": [\"go\", \" \", \"并发\", \"a\", \"b\", \"c\", \"d\"], \"category\": \"编程\"}\n```"
+
+	summary, err := parseDocumentSummary(raw)
+	if err != nil {
+		t.Fatalf("Expected summary to parse, got %v", err)
+	}
+	if summary.Title != "Go并发" {
+		t.Errorf("Expected trimmed title, got %q", summary.Title)
+	}
+	if summary.Category != "编程" {
+		t.Errorf("Expected category 编程, got %q", summary.Category)
+	}
+	if len(summary.Tags) != maxSuggestedTags {
+		t.Errorf("Expected %d tags after filtering, got %v", maxSuggestedTags, summary.Tags)
+	}
+	if summary.Tags[1] != "并发" {
+		t.Errorf("Expected blank tags to be removed, got %v", summary.Tags)
+	}
+}
+
+func TestParseDocumentSummaryInvalid(t *testing.T) {
+	for _, raw := range []string{
+		"no json here",
+		"{not valid json}",
+		`{"title": "", "summary": "missing title"}`,
+	} {
+		if _, err := parseDocumentSummary(raw); err == nil {
+			t.Errorf("Expected error for %q", raw)
+		}
+	}
+}
+
+func TestParseSuggestedTags(t *testing.T) {
+	tags, err := parseSuggestedTags("推荐标签：```json\n[\"Go\", \" \", \"并发\", \"go\", \"a\", \"b\", \"c\", \"d\"]\n```", nil)
+	if err != nil {
+		t.Fatalf("Expected tags to parse, got %v", err)
+	}
+	expected := []string{"Go", "并发", "a", "b", "c"}
+	if len(tags) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, tags)
+	}
+	for i := range expected {
+		if tags[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, tags)
+		}
+	}
+}
+
+func TestParseSuggestedTagsConstrainedToAllowed(t *testing.T) {
+	tags, err := parseSuggestedTags(`["golang", "GO", "新标签", "Concurrency"]`, []string{"Go", "concurrency"})
+	if err != nil {
+		t.Fatalf("Expected tags to parse, got %v", err)
+	}
+	if len(tags) != 2 || tags[0] != "Go" || tags[1] != "concurrency" {
+		t.Errorf("Expected only allowed tags in their original spelling, got %v", tags)
+	}
+
+	if _, err := parseSuggestedTags("no tags", nil); err == nil {
+		t.Error("Expected error for response without JSON array")
+	}
+}
@@ -0,0 +1,93 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// maxTaggingInputRunes 发送给LLM做标签推荐的内容上限（按字符截断）
+const maxTaggingInputRunes = 6000
+
+// suggestTagsPrompt 标签推荐提示，要求LLM仅返回JSON数组
+const suggestTagsPrompt = `你是一个知识库编辑，请为下面的知识内容推荐%d个以内的关键词标签。
+%s
+只返回JSON字符串数组，不要包含任何其他内容，例如：["标签1", "标签2"]
+
+知识内容：
+`
+
+// SuggestTags 使用LLM为知识内容推荐标签
+// allowed不为空时只能从中选择，返回值使用allowed中的原始写法
+func (s *OpenAIService) SuggestTags(ctx context.Context, content string, allowed []string) ([]string, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, fmt.Errorf("knowledge content is empty")
+	}
+
+	if err := s.ensureLLM(); err != nil {
+		return nil, err
+	}
+
+	if runes := []rune(content); len(runes) > maxTaggingInputRunes {
+		content = string(runes[:maxTaggingInputRunes])
+	}
+
+	constraint := ""
+	if len(allowed) > 0 {
+		constraint = "只能从以下已有标签中选择，没有合适的标签时返回空数组：\n" + strings.Join(allowed, "、") + "\n"
+	}
+
+	completion, _, err := s.generate(ctx, fmt.Sprintf(suggestTagsPrompt, maxSuggestedTags, constraint)+content)
+	if err != nil {
+		return nil, fmt.Errorf("AI service error: %w", err)
+	}
+
+	return parseSuggestedTags(completion, allowed)
+}
+
+// parseSuggestedTags 解析LLM返回的标签数组，去除空白和重复项
+// allowed不为空时丢弃不在其中的标签
+func parseSuggestedTags(raw string, allowed []string) ([]string, error) {
+	start := strings.Index(raw, "[")
+	end := strings.LastIndex(raw, "]")
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("no JSON array in tag response")
+	}
+
+	var suggested []string
+	if err := json.Unmarshal([]byte(raw[start:end+1]), &suggested); err != nil {
+		return nil, fmt.Errorf("failed to parse tag response: %w", err)
+	}
+
+	canonical := make(map[string]string, len(allowed))
+	for _, name := range allowed {
+		canonical[strings.ToLower(name)] = name
+	}
+
+	seen := make(map[string]bool)
+	tags := make([]string, 0, len(suggested))
+	for _, tag := range suggested {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if len(allowed) > 0 {
+			name, ok := canonical[strings.ToLower(tag)]
+			if !ok {
+				continue
+			}
+			tag = name
+		}
+		if key := strings.ToLower(tag); !seen[key] {
+			seen[key] = true
+			tags = append(tags, tag)
+		}
+		if len(tags) == maxSuggestedTags {
+			break
+		}
+	}
+
+	return tags, nil
+}
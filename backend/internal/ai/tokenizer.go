@@ -0,0 +1,123 @@
+package ai
+
+import (
+	"strings"
+	"sync"
+
+	"ai-knowledge-app/pkg/logger"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+var (
+	loaderOnce sync.Once
+
+	// encoders 按编码名称（如cl100k_base）缓存的BPE编码器
+	// 模型名来自请求，按编码缓存使缓存大小以已知编码数为上限
+	encoders   = make(map[string]*tiktoken.Tiktoken)
+	encodersMu sync.RWMutex
+)
+
+// encodingForModel 返回模型对应的编码名称，未知模型返回空字符串
+// 前缀匹配取最长前缀，避免gpt-4o-被gpt-4-误匹配
+func encodingForModel(model string) string {
+	if name, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return name
+	}
+	name, matched := "", ""
+	for prefix, encoding := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(matched) {
+			name, matched = encoding, prefix
+		}
+	}
+	return name
+}
+
+// getEncoder 获取模型对应的BPE编码器，模型编码未知时返回nil
+// 使用内置词表避免运行时下载
+func getEncoder(model string) *tiktoken.Tiktoken {
+	loaderOnce.Do(func() {
+		tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	})
+
+	name := encodingForModel(model)
+	if name == "" {
+		logger.GetLogger().WithField("model", model).
+			Debug("Unknown tokenizer encoding for model, falling back to heuristic token estimation")
+		return nil
+	}
+
+	encodersMu.RLock()
+	enc, ok := encoders[name]
+	encodersMu.RUnlock()
+	if ok {
+		return enc
+	}
+
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+
+	if enc, ok := encoders[name]; ok {
+		return enc
+	}
+
+	enc, err := tiktoken.GetEncoding(name)
+	if err != nil {
+		logger.GetLogger().WithError(err).WithField("encoding", name).
+			Warn("Failed to load tokenizer encoding, falling back to heuristic token estimation")
+		enc = nil
+	}
+	encoders[name] = enc
+	return enc
+}
+
+// TokenUsage 一次生成的token用量
+type TokenUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// usageFromGenerationInfo 读取服务商返回的token用量，未返回的项为0
+// OpenAI报告PromptTokens/CompletionTokens，Anthropic报告InputTokens/OutputTokens
+func usageFromGenerationInfo(info map[string]any) TokenUsage {
+	var usage TokenUsage
+	var ok bool
+	if usage.PromptTokens, ok = info["PromptTokens"].(int); !ok {
+		usage.PromptTokens, _ = info["InputTokens"].(int)
+	}
+	if usage.CompletionTokens, ok = info["CompletionTokens"].(int); !ok {
+		usage.CompletionTokens, _ = info["OutputTokens"].(int)
+	}
+	return usage
+}
+
+// CountTokens 使用模型对应的分词器计算文本的token数量
+// 模型编码未知时退化为启发式估算
+func CountTokens(model, text string) int {
+	if text == "" {
+		return 0
+	}
+
+	if enc := getEncoder(model); enc != nil {
+		return len(enc.EncodeOrdinary(text))
+	}
+	return estimateTokens(text)
+}
+
+// estimateTokens 估算token数量（启发式实现，仅作为分词器不可用时的后备）
+func estimateTokens(text string) int {
+	// 简单的token估算：中文字符按1个token计算，英文单词按0.75个token计算
+	chineseCount := 0
+	englishWords := strings.Fields(text)
+
+	// 计算中文字符
+	for _, char := range text {
+		if char >= 0x4e00 && char <= 0x9fff {
+			chineseCount++
+		}
+	}
+
+	// 估算token数
+	return chineseCount + int(float64(len(englishWords))*0.75)
+}
@@ -0,0 +1,141 @@
+package ai
+
+import (
+	"context"
+	"testing"
+
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/pkg/logger"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+func initTokenizerTestLogger(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+}
+
+func TestCountTokens(t *testing.T) {
+	initTokenizerTestLogger(t)
+
+	cases := []struct {
+		model    string
+		text     string
+		expected int
+	}{
+		{"gpt-3.5-turbo", "", 0},
+		{"gpt-3.5-turbo", "hello world", 2},
+		{"gpt-4", "func main() { fmt.Println(\"hi\") }", 10},
+		{"gpt-4o", "hello world", 2},
+	}
+
+	for _, tc := range cases {
+		if got := CountTokens(tc.model, tc.text); got != tc.expected {
+			t.Errorf("CountTokens(%q, %q) = %d, expected %d", tc.model, tc.text, got, tc.expected)
+		}
+	}
+
+	// 中文文本也应得到非零的计数
+	if got := CountTokens("gpt-3.5-turbo", "你好，世界"); got == 0 {
+		t.Error("Expected non-zero token count for Chinese text")
+	}
+}
+
+func TestCountTokensSelectsEncodingByModel(t *testing.T) {
+	initTokenizerTestLogger(t)
+
+	// 不同编码对同一段文本的切分不同
+	text := "    indented code with    many     spaces"
+	if CountTokens("gpt-4", text) == CountTokens("text-davinci-001", text) {
+		t.Error("Expected cl100k_base and r50k_base to tokenize whitespace differently")
+	}
+
+	// 编码器按编码缓存，同一编码的模型共用编码器，任意模型名不会增加缓存项
+	first := getEncoder("gpt-4")
+	if first == nil || getEncoder("gpt-3.5-turbo") != first || getEncoder("gpt-4-0613-custom") != first {
+		t.Error("Expected models sharing cl100k_base to share one cached encoder")
+	}
+	if getEncoder("gpt-4o-mini") == first {
+		t.Error("Expected gpt-4o models to use o200k_base rather than the gpt-4 prefix")
+	}
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	if _, ok := encoders["gpt-4"]; ok {
+		t.Error("Expected encoders to be keyed by encoding name, not model")
+	}
+}
+
+func TestCountTokensFallsBackForUnknownModel(t *testing.T) {
+	initTokenizerTestLogger(t)
+
+	text := "hello brave new world 你好"
+	if got, expected := CountTokens("unknown-model", text), estimateTokens(text); got != expected {
+		t.Errorf("Expected heuristic fallback %d for unknown model, got %d", expected, got)
+	}
+	if getEncoder("unknown-model") != nil {
+		t.Error("Expected unknown model to have no encoder")
+	}
+}
+
+func TestUsageFromGenerationInfo(t *testing.T) {
+	cases := []struct {
+		info map[string]any
+		want TokenUsage
+	}{
+		{map[string]any{"PromptTokens": 12, "CompletionTokens": 34, "TotalTokens": 46}, TokenUsage{12, 34}},
+		{map[string]any{"InputTokens": 5, "OutputTokens": 7}, TokenUsage{5, 7}},
+		{map[string]any{"CompletionTokens": 3}, TokenUsage{0, 3}},
+		{nil, TokenUsage{}},
+	}
+	for _, tc := range cases {
+		if got := usageFromGenerationInfo(tc.info); got != tc.want {
+			t.Errorf("usageFromGenerationInfo(%v) = %+v, want %+v", tc.info, got, tc.want)
+		}
+	}
+}
+
+// usageLLM 返回固定回答和服务商报告的token用量
+type usageLLM struct{}
+
+func (usageLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		Content:        "answer",
+		GenerationInfo: map[string]any{"InputTokens": 321, "OutputTokens": 9},
+	}}}, nil
+}
+
+func (m usageLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func TestQueryReportsTokenUsage(t *testing.T) {
+	db := setupTestDB(t)
+
+	// 使用服务商返回的用量
+	svc := &OpenAIService{config: &config.AIConfig{OpenAI: config.OpenAIConfig{Model: "gpt-4"}}, llm: usageLLM{}, submit: runInline}
+	resp, err := svc.Query(context.Background(), QueryRequest{Query: "Reported usage"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if resp.PromptTokens != 321 || resp.CompletionTokens != 9 || resp.Tokens != 9 || resp.TokensEstimated {
+		t.Errorf("Expected provider usage, got %+v", resp)
+	}
+
+	// 服务商未返回用量时按分词器计算
+	svc.llm = &countingLLM{}
+	estimated, err := svc.Query(context.Background(), QueryRequest{Query: "Estimated usage"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if !estimated.TokensEstimated || estimated.PromptTokens == 0 || estimated.CompletionTokens != CountTokens("gpt-4", "cached answer") {
+		t.Errorf("Expected estimated usage, got %+v", estimated)
+	}
+
+	var history models.QueryHistory
+	db.Where("query = ?", "Reported usage").First(&history)
+	if history.PromptTokens != 321 || history.CompletionTokens != 9 || history.TokensEstimated {
+		t.Errorf("Expected usage to be saved in history, got %+v", history)
+	}
+}
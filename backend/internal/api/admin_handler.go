@@ -0,0 +1,153 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"ai-knowledge-app/internal/service"
+	"ai-knowledge-app/pkg/database"
+	"ai-knowledge-app/pkg/logger"
+	"ai-knowledge-app/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ========== 运维管理处理器 ==========
+
+// RetryConfigurer 可在运行时调整重试配置的存储客户端
+type RetryConfigurer interface {
+	GetRetryConfig() *service.RetryConfig
+	SetRetryConfig(config *service.RetryConfig)
+}
+
+// AdminHandler 运维管理处理器
+type AdminHandler struct {
+	storage RetryConfigurer
+	jobs    *service.JobManager
+}
+
+// NewAdminHandler 创建运维管理处理器
+func NewAdminHandler() *AdminHandler {
+	return &AdminHandler{}
+}
+
+// SetStorageClient 设置存储客户端
+func (h *AdminHandler) SetStorageClient(storage RetryConfigurer) {
+	h.storage = storage
+}
+
+// RetryConfigResponse 存储重试配置（时长使用Go duration格式，如"500ms"、"30s"）
+type RetryConfigResponse struct {
+	MaxRetries      int      `json:"max_retries"`
+	InitialDelay    string   `json:"initial_delay"`
+	MaxDelay        string   `json:"max_delay"`
+	BackoffFactor   float64  `json:"backoff_factor"`
+	RetryableErrors []string `json:"retryable_errors"`
+}
+
+// UpdateRetryConfigRequest 更新存储重试配置请求，未提供的字段保持当前值
+type UpdateRetryConfigRequest struct {
+	MaxRetries      *int     `json:"max_retries"`
+	InitialDelay    *string  `json:"initial_delay"`
+	MaxDelay        *string  `json:"max_delay"`
+	BackoffFactor   *float64 `json:"backoff_factor"`
+	RetryableErrors []string `json:"retryable_errors"`
+}
+
+func newRetryConfigResponse(cfg *service.RetryConfig) RetryConfigResponse {
+	return RetryConfigResponse{
+		MaxRetries:      cfg.MaxRetries,
+		InitialDelay:    cfg.InitialDelay.String(),
+		MaxDelay:        cfg.MaxDelay.String(),
+		BackoffFactor:   cfg.BackoffFactor,
+		RetryableErrors: cfg.RetryableErrors,
+	}
+}
+
+// GetRetryConfig 获取存储重试配置
+// @Summary 获取存储重试配置
+// @Description 返回MinIO操作当前生效的重试配置
+// @Tags admin
+// @Produce json
+// @Success 200 {object} RetryConfigResponse
+// @Failure 503 {object} utils.Response
+// @Router /admin/storage/retry-config [get]
+func (h *AdminHandler) GetRetryConfig(c *gin.Context) {
+	if h.storage == nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Storage client is not configured")
+		return
+	}
+
+	utils.SuccessResponse(c, newRetryConfigResponse(h.storage.GetRetryConfig()))
+}
+
+// UpdateRetryConfig 更新存储重试配置
+// @Summary 更新存储重试配置
+// @Description 校验后立即生效并持久化，重启后仍然保留
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body UpdateRetryConfigRequest true "重试配置"
+// @Success 200 {object} RetryConfigResponse
+// @Failure 422 {object} utils.Response
+// @Failure 503 {object} utils.Response
+// @Router /admin/storage/retry-config [put]
+func (h *AdminHandler) UpdateRetryConfig(c *gin.Context) {
+	if h.storage == nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Storage client is not configured")
+		return
+	}
+
+	var req UpdateRetryConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	cfg := h.storage.GetRetryConfig()
+	if req.MaxRetries != nil {
+		cfg.MaxRetries = *req.MaxRetries
+	}
+	if req.InitialDelay != nil {
+		d, err := time.ParseDuration(*req.InitialDelay)
+		if err != nil {
+			utils.ValidationError(c, "invalid initial_delay: "+err.Error())
+			return
+		}
+		cfg.InitialDelay = d
+	}
+	if req.MaxDelay != nil {
+		d, err := time.ParseDuration(*req.MaxDelay)
+		if err != nil {
+			utils.ValidationError(c, "invalid max_delay: "+err.Error())
+			return
+		}
+		cfg.MaxDelay = d
+	}
+	if req.BackoffFactor != nil {
+		cfg.BackoffFactor = *req.BackoffFactor
+	}
+	if req.RetryableErrors != nil {
+		cfg.RetryableErrors = req.RetryableErrors
+	}
+	if err := cfg.Validate(); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	// 先持久化再生效，避免重启后配置意外回退
+	if err := service.SaveRetryConfigOverride(database.GetDatabase(), cfg); err != nil {
+		logger.GetLogger().WithError(err).Error("Failed to persist retry config")
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to save retry config")
+		return
+	}
+	h.storage.SetRetryConfig(cfg)
+
+	logger.GetLogger().WithFields(logrus.Fields{
+		"client_ip":   c.ClientIP(),
+		"max_retries": cfg.MaxRetries,
+	}).Info("Storage retry config updated")
+
+	utils.SuccessResponse(c, newRetryConfigResponse(cfg))
+}
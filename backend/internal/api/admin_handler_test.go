@@ -0,0 +1,104 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeRetryConfigurer 记录重试配置的测试存储客户端
+type fakeRetryConfigurer struct {
+	config *service.RetryConfig
+}
+
+func (f *fakeRetryConfigurer) GetRetryConfig() *service.RetryConfig {
+	copied := *f.config
+	return &copied
+}
+
+func (f *fakeRetryConfigurer) SetRetryConfig(config *service.RetryConfig) {
+	f.config = config
+}
+
+func performRetryConfigRequest(handler *AdminHandler, method, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/admin/storage/retry-config", handler.GetRetryConfig)
+	r.PUT("/admin/storage/retry-config", handler.UpdateRetryConfig)
+
+	req := httptest.NewRequest(method, "/admin/storage/retry-config", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminHandlerRetryConfig(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	storage := &fakeRetryConfigurer{config: service.DefaultRetryConfig()}
+	handler := NewAdminHandler()
+	handler.SetStorageClient(storage)
+
+	w := performRetryConfigRequest(handler, http.MethodGet, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data RetryConfigResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Data.MaxRetries != 3 || resp.Data.InitialDelay != "1s" {
+		t.Errorf("Unexpected retry config: %+v", resp.Data)
+	}
+
+	// 部分更新：未提供的字段保持不变
+	w = performRetryConfigRequest(handler, http.MethodPut, `{"max_retries":5,"initial_delay":"250ms"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if storage.config.MaxRetries != 5 || storage.config.InitialDelay != 250*time.Millisecond || storage.config.MaxDelay != 30*time.Second {
+		t.Errorf("Expected partial update to be applied, got %+v", storage.config)
+	}
+
+	persisted, err := service.LoadRetryConfigOverride(db)
+	if err != nil || persisted == nil || persisted.MaxRetries != 5 {
+		t.Errorf("Expected update to be persisted, got %+v, %v", persisted, err)
+	}
+}
+
+func TestAdminHandlerRetryConfigValidation(t *testing.T) {
+	setupTestDatabase(t)
+
+	storage := &fakeRetryConfigurer{config: service.DefaultRetryConfig()}
+	handler := NewAdminHandler()
+	handler.SetStorageClient(storage)
+
+	for _, body := range []string{
+		`{"max_retries":-1}`,
+		`{"initial_delay":"soon"}`,
+		`{"initial_delay":"1m","max_delay":"1s"}`,
+		`{"backoff_factor":0.5}`,
+		`not json`,
+	} {
+		if w := performRetryConfigRequest(handler, http.MethodPut, body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Body %q: expected status 422, got %d", body, w.Code)
+		}
+	}
+	if storage.config.MaxRetries != 3 {
+		t.Errorf("Invalid updates should not be applied, got %+v", storage.config)
+	}
+
+	if w := performRetryConfigRequest(NewAdminHandler(), http.MethodGet, ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without storage client, got %d", w.Code)
+	}
+}
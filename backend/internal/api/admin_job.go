@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"ai-knowledge-app/internal/background"
+	"ai-knowledge-app/internal/service"
+	"ai-knowledge-app/pkg/logger"
+	"ai-knowledge-app/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 后台运维任务 ==========
+
+var (
+	defaultJobsOnce sync.Once
+	defaultJobs     *service.JobManager
+)
+
+// jobsOrDefault 返回设置的任务管理器，未设置时使用基于全局后台任务池的共享管理器
+func jobsOrDefault(jobs *service.JobManager) *service.JobManager {
+	if jobs != nil {
+		return jobs
+	}
+	defaultJobsOnce.Do(func() {
+		defaultJobs = service.NewJobManager(background.Default())
+	})
+	return defaultJobs
+}
+
+// defaultQueueRetryAfter 未配置background.retry_after时，队列已满建议客户端的重试等待时间
+const defaultQueueRetryAfter = 5 * time.Second
+
+// respondQueueRejected 处理后台任务池拒绝提交的错误：队列已满返回429并携带Retry-After，
+// 任务池已关闭（服务正在停止）返回503；其他错误返回false由调用方处理
+func respondQueueRejected(c *gin.Context, err error, retryAfter time.Duration) bool {
+	switch {
+	case errors.Is(err, background.ErrQueueFull):
+		if retryAfter <= 0 {
+			retryAfter = defaultQueueRetryAfter
+		}
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(max(seconds, 1)))
+		utils.ErrorResponse(c, http.StatusTooManyRequests, "Task queue is full, please retry later")
+		return true
+	case errors.Is(err, background.ErrPoolClosed):
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Service is shutting down, please retry later")
+		return true
+	}
+	return false
+}
+
+// startJob 提交后台运维任务并返回任务信息，客户端通过/admin/jobs/:id查询进度
+// 同类任务等待或运行中时返回409并给出该任务ID，任务池队列已满时返回429，任务池已关闭时返回503
+func startJob(c *gin.Context, jobs *service.JobManager, retryAfter time.Duration, jobType string, run service.JobFunc) {
+	job, err := jobsOrDefault(jobs).Start(jobType, run)
+	if err != nil {
+		if errors.Is(err, service.ErrJobAlreadyActive) {
+			utils.ErrorResponse(c, http.StatusConflict, fmt.Sprintf("A %s job is already pending or running: %s", jobType, job.ID))
+			return
+		}
+		if respondQueueRejected(c, err, retryAfter) {
+			return
+		}
+		logger.GetLogger().WithError(err).WithField("job_type", jobType).Error("Failed to start job")
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to start job")
+		return
+	}
+
+	logger.GetLogger().WithField("job_id", job.ID).WithField("job_type", jobType).Info("Job started")
+	utils.SuccessResponse(c, job)
+}
+
+// SetJobManager 设置运维任务管理器，未设置时使用全局后台任务池
+func (h *AdminHandler) SetJobManager(jobs *service.JobManager) {
+	h.jobs = jobs
+}
+
+// SetJobManager 设置运维任务管理器，未设置时使用全局后台任务池
+func (h *DocumentHandler) SetJobManager(jobs *service.JobManager) {
+	h.jobs = jobs
+}
+
+// SetJobManager 设置运维任务管理器，未设置时使用全局后台任务池
+func (h *KnowledgeHandler) SetJobManager(jobs *service.JobManager) {
+	h.jobs = jobs
+}
+
+// SetQueueRetryAfter 设置队列已满时通过Retry-After建议的等待时间，<=0时使用默认的5秒
+func (h *DocumentHandler) SetQueueRetryAfter(retryAfter time.Duration) {
+	h.queueRetryAfter = retryAfter
+}
+
+// SetQueueRetryAfter 设置队列已满时通过Retry-After建议的等待时间，<=0时使用默认的5秒
+func (h *KnowledgeHandler) SetQueueRetryAfter(retryAfter time.Duration) {
+	h.queueRetryAfter = retryAfter
+}
+
+// GetJob 查询后台运维任务的状态、进度和结果
+// @Summary 查询运维任务
+// @Description 任务状态保存在启动任务的实例内存中，结束一小时后清除
+// @Tags admin
+// @Produce json
+// @Param id path string true "任务ID"
+// @Success 200 {object} service.Job
+// @Failure 404 {object} utils.Response
+// @Router /admin/jobs/{id} [get]
+func (h *AdminHandler) GetJob(c *gin.Context) {
+	job, err := jobsOrDefault(h.jobs).Get(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Job not found")
+		return
+	}
+	utils.SuccessResponse(c, job)
+}
+
+// CancelJob 取消等待中或运行中的运维任务，运行中的任务处理完当前项后停止
+// @Summary 取消运维任务
+// @Tags admin
+// @Produce json
+// @Param id path string true "任务ID"
+// @Success 200 {object} service.Job
+// @Failure 404 {object} utils.Response
+// @Failure 409 {object} utils.Response
+// @Router /admin/jobs/{id}/cancel [post]
+func (h *AdminHandler) CancelJob(c *gin.Context) {
+	job, err := jobsOrDefault(h.jobs).Cancel(c.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrJobNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, "Job not found")
+		case errors.Is(err, service.ErrJobNotCancellable):
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to cancel job")
+		}
+		return
+	}
+
+	logger.GetLogger().WithFields(map[string]interface{}{
+		"job_id":    job.ID,
+		"job_type":  job.Type,
+		"client_ip": c.ClientIP(),
+	}).Info("Job cancelled")
+	utils.SuccessResponse(c, job)
+}
+
+// ReprocessAllDocuments 以后台任务重新处理所有有存储文件的文档，返回任务信息
+// 处理中的文档会被跳过
+// @Summary 重新处理所有文档
+// @Tags admin
+// @Produce json
+// @Success 200 {object} service.Job
+// @Failure 409 {object} utils.Response
+// @Failure 429 {object} utils.Response
+// @Failure 503 {object} utils.Response
+// @Router /admin/documents/reprocess-all [post]
+func (h *DocumentHandler) ReprocessAllDocuments(c *gin.Context) {
+	startJob(c, h.jobs, h.queueRetryAfter, "reprocess_all", func(ctx context.Context, progress service.JobProgress) (interface{}, error) {
+		return h.service.ReprocessAllDocuments(ctx, progress)
+	})
+}
+
+// ReindexJob 以后台任务为已发布知识及其译文重建向量，返回任务信息
+// 为缺少向量的条目生成向量（可重复执行），查询参数force=true时全部重新生成，任务结果为ReindexResult
+// @Summary 后台批量重建知识向量
+// @Tags admin
+// @Produce json
+// @Param force query bool false "重新生成所有已发布知识的向量"
+// @Success 200 {object} service.Job
+// @Failure 409 {object} utils.Response
+// @Failure 429 {object} utils.Response
+// @Failure 503 {object} utils.Response
+// @Router /admin/knowledge/reindex [post]
+func (h *KnowledgeHandler) ReindexJob(c *gin.Context) {
+	if h.vectorService == nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Vector service is not configured")
+		return
+	}
+
+	force := utils.ContainsString([]string{"true", "1"}, c.Query("force"))
+	startJob(c, h.jobs, h.queueRetryAfter, "reindex", func(ctx context.Context, progress service.JobProgress) (interface{}, error) {
+		return h.reindex(ctx, force, progress)
+	})
+}
@@ -2,11 +2,17 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 	"time"
 
 	"ai-knowledge-app/internal/ai"
+	"ai-knowledge-app/internal/background"
+	"ai-knowledge-app/internal/config"
 	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/internal/service"
 	"ai-knowledge-app/pkg/database"
 	"ai-knowledge-app/pkg/logger"
 	"ai-knowledge-app/pkg/utils"
@@ -19,7 +25,12 @@ import (
 
 // AIHandler AI处理器
 type AIHandler struct {
-	aiService ai.AIService
+	aiService       ai.AIService
+	maxReturnedDocs int // 响应中返回的相关文档/知识数量上限，0表示不限制
+	embedding       config.EmbeddingConfig
+	queryTimeout    time.Duration // 单次查询的默认超时，0表示不限制
+	maxQueryTimeout time.Duration // 请求可指定的超时上限，0表示不限制
+	taskSubmitter   service.TaskSubmitter
 }
 
 // NewAIHandler 创建AI处理器
@@ -36,13 +47,147 @@ func (h *AIHandler) SetAIService(service ai.AIService) {
 	h.aiService = service
 }
 
+// SetTaskSubmitter 设置保存失败查询等后台任务使用的任务池，未设置时使用全局后台任务池
+func (h *AIHandler) SetTaskSubmitter(submitter service.TaskSubmitter) {
+	h.taskSubmitter = submitter
+}
+
+// SetMaxReturnedDocs 设置响应中返回的相关文档/知识数量上限
+func (h *AIHandler) SetMaxReturnedDocs(n int) {
+	h.maxReturnedDocs = n
+}
+
+// SetEmbeddingConfig 设置向量模型配置，用于报告当前使用的模型和维度
+func (h *AIHandler) SetEmbeddingConfig(cfg config.EmbeddingConfig) {
+	h.embedding = cfg
+}
+
+// SetQueryTimeout 设置查询的默认超时及请求可指定的超时上限
+func (h *AIHandler) SetQueryTimeout(timeout, maxTimeout time.Duration) {
+	h.queryTimeout = timeout
+	h.maxQueryTimeout = maxTimeout
+}
+
+// effectiveQueryTimeout 请求的timeout_seconds优先于默认超时，且不超过配置上限；返回0表示不限制
+func (h *AIHandler) effectiveQueryTimeout(requestedSeconds int) time.Duration {
+	timeout := h.queryTimeout
+	if requestedSeconds > 0 {
+		timeout = time.Duration(requestedSeconds) * time.Second
+	}
+	if h.maxQueryTimeout > 0 && (timeout <= 0 || timeout > h.maxQueryTimeout) {
+		timeout = h.maxQueryTimeout
+	}
+	return timeout
+}
+
+// queryContext 基于请求上下文派生模型调用的上下文：客户端断开或超时都会取消进行中的模型调用
+func (h *AIHandler) queryContext(c *gin.Context, req QueryRequest) (context.Context, context.CancelFunc, time.Duration) {
+	timeout := h.effectiveQueryTimeout(req.TimeoutSeconds)
+	// 请求处理超时更早到期时以其为准，超时错误不再标明查询超时时长
+	if deadline, ok := c.Request.Context().Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = 0
+	}
+	if timeout <= 0 {
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		return ctx, cancel, 0
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	return ctx, cancel, timeout
+}
+
+// queryTimeoutError 查询超时的错误，记入失败的查询历史
+func queryTimeoutError(timeout time.Duration) error {
+	if timeout <= 0 {
+		// 未设置查询超时，由请求处理超时取消
+		return errors.New("AI query timed out")
+	}
+	return fmt.Errorf("AI query timed out after %s", timeout)
+}
+
+// returnedDocsLimit 请求的max_docs只能在配置上限内进一步减少，返回0表示不限制
+func (h *AIHandler) returnedDocsLimit(requested int) int {
+	if requested > 0 && (h.maxReturnedDocs <= 0 || requested < h.maxReturnedDocs) {
+		return requested
+	}
+	return h.maxReturnedDocs
+}
+
+// sortByIDOrder 按检索返回的相关度顺序排列知识，截断时保留最相关的部分
+func sortByIDOrder(knowledges []models.Knowledge, ids []uint) {
+	rank := make(map[uint]int, len(ids))
+	for i, id := range ids {
+		rank[id] = i
+	}
+	sort.SliceStable(knowledges, func(i, j int) bool {
+		return rank[knowledges[i].ID] < rank[knowledges[j].ID]
+	})
+}
+
+// capSlice 按上限截断切片，limit为0表示不限制
+func capSlice[T any](items []T, limit int) []T {
+	if limit > 0 && len(items) > limit {
+		return items[:limit]
+	}
+	return items
+}
+
 // QueryRequest AI查询请求
 type QueryRequest struct {
 	Query       string   `json:"query" binding:"required,min=1,max=1000"`
 	Model       string   `json:"model,omitempty"`
 	Temperature float64  `json:"temperature,omitempty"`
 	MaxTokens   int      `json:"max_tokens,omitempty"`
-	Context     []string `json:"context,omitempty"`
+	Context     []string `json:"context,omitempty"` // 之前的对话，按用户问题、AI回答交替排列
+	Sensitive   bool     `json:"sensitive,omitempty"` // 标记为敏感的查询不会出现在相似问题中
+	MaxDocs     int      `json:"max_docs,omitempty" binding:"omitempty,min=1,max=50"` // 返回的相关文档/知识数量，不超过配置上限
+
+	// ConversationID 会话ID，由客户端生成；指定时加载该会话最近的问答作为上下文
+	ConversationID string `json:"conversation_id,omitempty" binding:"omitempty,max=64"`
+
+	// TimeoutSeconds 本次查询的超时秒数，不超过配置的ai.max_query_timeout
+	TimeoutSeconds int `json:"timeout_seconds,omitempty" binding:"omitempty,min=1"`
+
+	// 功能开关，未指定时使用配置中ai.features的默认值
+	UseRetrieval     *bool `json:"use_retrieval,omitempty"`
+	UseRerank        *bool `json:"use_rerank,omitempty"`
+	UseCache         *bool `json:"use_cache,omitempty"`
+	IncludeCitations *bool `json:"include_citations,omitempty"`
+
+	// 检索参数，未指定时使用配置中ai.retrieval的默认值
+	TopK        *int     `json:"top_k,omitempty" binding:"omitempty,min=1,max=50"`
+	MaxDistance *float64 `json:"max_distance,omitempty" binding:"omitempty,min=0"` // 0表示不限制距离
+}
+
+// featureOverrides 转换为AI服务的功能开关
+func (r QueryRequest) featureOverrides() ai.FeatureOverrides {
+	return ai.FeatureOverrides{
+		UseRetrieval:     r.UseRetrieval,
+		UseRerank:        r.UseRerank,
+		UseCache:         r.UseCache,
+		IncludeCitations: r.IncludeCitations,
+		TopK:             r.TopK,
+		MaxDistance:      r.MaxDistance,
+	}
+}
+
+// validateFeatures 检查相互矛盾的功能开关：重排序和引用都依赖检索结果
+func (r QueryRequest) validateFeatures() error {
+	if r.UseRetrieval == nil || *r.UseRetrieval {
+		return nil
+	}
+	if r.UseRerank != nil && *r.UseRerank {
+		return fmt.Errorf("use_rerank requires use_retrieval")
+	}
+	if r.IncludeCitations != nil && *r.IncludeCitations {
+		return fmt.Errorf("include_citations requires use_retrieval")
+	}
+	return nil
+}
+
+// SimilarQueriesRequest 相似问题检索请求
+type SimilarQueriesRequest struct {
+	Q     string `form:"q" binding:"required,min=1,max=1000"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=20"`
 }
 
 // QueryResponse AI查询响应
@@ -50,10 +195,20 @@ type QueryResponse struct {
 	Response      string        `json:"response"`
 	Model         string        `json:"model"`
 	Tokens        int           `json:"tokens"`
+	PromptTokens     int        `json:"prompt_tokens"`
+	CompletionTokens int        `json:"completion_tokens"`
+	TokensEstimated  bool       `json:"tokens_estimated,omitempty"` // 服务商未返回用量，按分词器计算
 	Duration      int           `json:"duration"` // 毫秒
 	KnowledgeIDs  []uint        `json:"knowledge_ids,omitempty"`
 	RelevantDocs  []string      `json:"relevant_docs,omitempty"`
 	RelatedKnowledges []models.Knowledge `json:"related_knowledges,omitempty"`
+	RelevantDocsTotal      int  `json:"relevant_docs_total"`      // 截断前的相关文档总数
+	RelatedKnowledgesTotal int  `json:"related_knowledges_total"` // 截断前的相关知识总数
+	Cached        bool          `json:"cached"` // 是否来自回答缓存
+	Truncated     bool          `json:"truncated,omitempty"` // 回答超过长度上限被截断
+	DedupedPassages int         `json:"deduped_passages,omitempty"`
+	Features      ai.QueryFeatures `json:"features"` // 实际启用的功能开关
+	Citations     []ai.Citation `json:"citations,omitempty"`
 }
 
 // Query AI查询接口
@@ -68,15 +223,176 @@ type QueryResponse struct {
 // @Failure 503 {object} utils.Response
 // @Router /ai/query [post]
 func (h *AIHandler) Query(c *gin.Context) {
-	if h.aiService == nil {
-		utils.ErrorResponse(c, http.StatusServiceUnavailable, "AI service is not configured")
+	req, ok := h.bindQueryRequest(c)
+	if !ok {
+		return
+	}
+
+	// 调用AI服务（使用请求上下文，超时或客户端断开时提前结束）
+	ctx, cancel, timeout := h.queryContext(c, req)
+	defer cancel()
+	aiResp, err := h.aiService.Query(ctx, req.toAIRequest())
+
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		timeoutErr := queryTimeoutError(timeout)
+		logger.GetLogger().WithError(err).Warn("AI query timed out")
+		h.submitFailedQuery(req, timeoutErr)
+		utils.ErrorResponse(c, http.StatusGatewayTimeout, timeoutErr.Error())
+		return
+	}
+	if err != nil {
+		logger.GetLogger().WithError(err).Error("AI query failed")
+
+		// 保存失败的查询记录
+		h.submitFailedQuery(req, err)
+
+		utils.ErrorResponse(c, http.StatusInternalServerError, "AI query failed: "+err.Error())
+		return
+	}
+
+	// 获取相关知识详情
+	var relatedKnowledges []models.Knowledge
+	if len(aiResp.KnowledgeIDs) > 0 {
+		db := database.GetDatabase()
+		db.Preload("Category").Preload("Tags").
+			Where("id IN ? AND is_published = ?", aiResp.KnowledgeIDs, true).
+			Find(&relatedKnowledges)
+		sortByIDOrder(relatedKnowledges, aiResp.KnowledgeIDs)
+	}
+
+	// 构建响应，按上限截断返回给客户端的文档（不影响提示中使用的数量）
+	limit := h.returnedDocsLimit(req.MaxDocs)
+	response := QueryResponse{
+		Response:      aiResp.Response,
+		Model:         aiResp.Model,
+		Tokens:        aiResp.Tokens,
+		PromptTokens:     aiResp.PromptTokens,
+		CompletionTokens: aiResp.CompletionTokens,
+		TokensEstimated:  aiResp.TokensEstimated,
+		Duration:      int(aiResp.Duration.Milliseconds()),
+		KnowledgeIDs:  aiResp.KnowledgeIDs,
+		RelevantDocs:  capSlice(aiResp.RelevantDocs, limit),
+		RelatedKnowledges: capSlice(relatedKnowledges, limit),
+		RelevantDocsTotal:      len(aiResp.RelevantDocs),
+		RelatedKnowledgesTotal: len(relatedKnowledges),
+		Cached:        aiResp.Cached,
+		Truncated:     aiResp.Truncated,
+		DedupedPassages: aiResp.DedupedPassages,
+		Features:      aiResp.Features,
+		Citations:     aiResp.Citations,
+	}
+
+	utils.SuccessResponse(c, response)
+}
+
+// QueryStreamDone 流式查询结束事件的内容
+type QueryStreamDone struct {
+	Model           string           `json:"model"`
+	Tokens          int              `json:"tokens"`
+	PromptTokens     int             `json:"prompt_tokens"`
+	CompletionTokens int             `json:"completion_tokens"`
+	TokensEstimated  bool            `json:"tokens_estimated,omitempty"`
+	Duration        int              `json:"duration"` // 毫秒
+	KnowledgeIDs    []uint           `json:"knowledge_ids,omitempty"`
+	Cached          bool             `json:"cached"`
+	Truncated       bool             `json:"truncated,omitempty"`
+	DedupedPassages int              `json:"deduped_passages,omitempty"`
+	Features        ai.QueryFeatures `json:"features"`
+	Citations       []ai.Citation    `json:"citations,omitempty"`
+}
+
+// QueryStream 流式AI查询接口
+// @Summary 流式AI查询
+// @Description 以Server-Sent Events推送回答：每个增量为一条data事件（{"content": "..."}），
+// @Description 结束时发送done事件（模型、知识ID等元数据），失败时发送error事件
+// @Tags ai
+// @Accept json
+// @Produce text/event-stream
+// @Param request body QueryRequest true "查询请求"
+// @Success 200 {object} QueryStreamDone
+// @Failure 422 {object} utils.Response
+// @Failure 503 {object} utils.Response
+// @Router /ai/query/stream [post]
+func (h *AIHandler) QueryStream(c *gin.Context) {
+	req, ok := h.bindQueryRequest(c)
+	if !ok {
 		return
 	}
 
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 禁止反向代理缓冲
+	c.Status(http.StatusOK)
+
+	// 客户端断开或超时时上下文被取消，推送失败或上下文取消都会中止生成
+	ctx, cancel, timeout := h.queryContext(c, req)
+	defer cancel()
+	aiResp, err := h.aiService.QueryStream(ctx, req.toAIRequest(), func(chunk string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if chunk == "" {
+			return nil
+		}
+		c.SSEvent("", gin.H{"content": chunk})
+		c.Writer.Flush()
+		return nil
+	})
+
+	if err != nil {
+		// 已开始推送，无法再返回504，通过error事件通知客户端
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			timeoutErr := queryTimeoutError(timeout)
+			logger.GetLogger().WithError(err).Warn("AI query stream timed out")
+			h.submitFailedQuery(req, timeoutErr)
+			c.SSEvent("error", gin.H{"message": timeoutErr.Error()})
+			c.Writer.Flush()
+			return
+		}
+		if ctx.Err() != nil {
+			logger.GetLogger().WithError(err).Info("AI query stream cancelled by client")
+			return
+		}
+		logger.GetLogger().WithError(err).Error("AI query stream failed")
+		h.submitFailedQuery(req, err)
+		c.SSEvent("error", gin.H{"message": "AI query failed: " + err.Error()})
+		c.Writer.Flush()
+		return
+	}
+
+	c.SSEvent("done", QueryStreamDone{
+		Model:           aiResp.Model,
+		Tokens:          aiResp.Tokens,
+		PromptTokens:     aiResp.PromptTokens,
+		CompletionTokens: aiResp.CompletionTokens,
+		TokensEstimated:  aiResp.TokensEstimated,
+		Duration:        int(aiResp.Duration.Milliseconds()),
+		KnowledgeIDs:    aiResp.KnowledgeIDs,
+		Cached:          aiResp.Cached,
+		Truncated:       aiResp.Truncated,
+		DedupedPassages: aiResp.DedupedPassages,
+		Features:        aiResp.Features,
+		Citations:       aiResp.Citations,
+	})
+	c.Writer.Flush()
+}
+
+// bindQueryRequest 解析并校验查询请求，填充默认参数；失败时已写入错误响应
+func (h *AIHandler) bindQueryRequest(c *gin.Context) (QueryRequest, bool) {
 	var req QueryRequest
+	if h.aiService == nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "AI service is not configured")
+		return req, false
+	}
+
 	if err := c.ShouldBindJSON(&req); err != nil {
 		utils.ValidationError(c, err.Error())
-		return
+		return req, false
+	}
+	if err := req.validateFeatures(); err != nil {
+		utils.ValidationError(c, err.Error())
+		return req, false
 	}
 
 	// 设置默认参数
@@ -94,47 +410,73 @@ func (h *AIHandler) Query(c *gin.Context) {
 		"temperature": req.Temperature,
 	}).Info("AI query request")
 
-	// 调用AI服务
-	ctx := context.Background()
-	aiResp, err := h.aiService.Query(ctx, ai.QueryRequest{
-		Query:       req.Query,
-		Model:       req.Model,
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		Context:     req.Context,
-	})
+	return req, true
+}
 
-	if err != nil {
-		logger.GetLogger().WithError(err).Error("AI query failed")
+// toAIRequest 转换为AI服务的查询请求
+func (r QueryRequest) toAIRequest() ai.QueryRequest {
+	return ai.QueryRequest{
+		Query:       r.Query,
+		Model:       r.Model,
+		Temperature: r.Temperature,
+		MaxTokens:   r.MaxTokens,
+		Context:     r.Context,
+		Sensitive:   r.Sensitive,
+		Features:    r.featureOverrides(),
+
+		ConversationID: r.ConversationID,
+	}
+}
 
-		// 保存失败的查询记录
-		go h.saveFailedQuery(req, err)
+// EstimateTokens 预估AI查询的token用量
+// @Summary 预估查询token用量
+// @Description 组装完整提示（检索内容+系统提示+问题）并返回token数，不调用LLM
+// @Tags ai
+// @Accept json
+// @Produce json
+// @Param request body QueryRequest true "查询请求"
+// @Success 200 {object} ai.TokenEstimate
+// @Failure 422 {object} utils.Response
+// @Failure 503 {object} utils.Response
+// @Router /ai/tokens/estimate [post]
+func (h *AIHandler) EstimateTokens(c *gin.Context) {
+	if h.aiService == nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "AI service is not configured")
+		return
+	}
 
-		utils.ErrorResponse(c, http.StatusInternalServerError, "AI query failed: "+err.Error())
+	var req QueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+	if err := req.validateFeatures(); err != nil {
+		utils.ValidationError(c, err.Error())
 		return
 	}
 
-	// 获取相关知识详情
-	var relatedKnowledges []models.Knowledge
-	if len(aiResp.KnowledgeIDs) > 0 {
-		db := database.GetDatabase()
-		db.Preload("Category").Preload("Tags").
-			Where("id IN ? AND is_published = ?", aiResp.KnowledgeIDs, true).
-			Find(&relatedKnowledges)
+	// 与查询接口保持一致的默认参数
+	if req.MaxTokens == 0 {
+		req.MaxTokens = 2000
 	}
 
-	// 构建响应
-	response := QueryResponse{
-		Response:      aiResp.Response,
-		Model:         aiResp.Model,
-		Tokens:        aiResp.Tokens,
-		Duration:      int(aiResp.Duration.Milliseconds()),
-		KnowledgeIDs:  aiResp.KnowledgeIDs,
-		RelevantDocs:  aiResp.RelevantDocs,
-		RelatedKnowledges: relatedKnowledges,
+	estimate, err := h.aiService.EstimateTokens(c.Request.Context(), ai.QueryRequest{
+		Query:     req.Query,
+		Model:     req.Model,
+		MaxTokens: req.MaxTokens,
+		Context:   req.Context,
+		Sensitive: req.Sensitive,
+		Features:  req.featureOverrides(),
+
+		ConversationID: req.ConversationID,
+	})
+	if err != nil {
+		logger.GetLogger().WithError(err).Error("Token estimation failed")
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Token estimation failed: "+err.Error())
+		return
 	}
 
-	utils.SuccessResponse(c, response)
+	utils.SuccessResponse(c, estimate)
 }
 
 // GetQueryHistory 获取查询历史
@@ -164,6 +506,11 @@ func (h *AIHandler) GetQueryHistory(c *gin.Context) {
 		query = query.Where("model = ?", model)
 	}
 
+	// 会话筛选
+	if conversationID := c.Query("conversation_id"); conversationID != "" {
+		query = query.Where("conversation_id = ?", conversationID)
+	}
+
 	// 获取总数
 	var total int64
 	if err := query.Count(&total).Error; err != nil {
@@ -193,6 +540,49 @@ func (h *AIHandler) GetQueryHistory(c *gin.Context) {
 	utils.SuccessResponse(c, response)
 }
 
+// GetSimilarQueries 查找语义相似的历史问题
+// @Summary 相似问题
+// @Description 基于查询向量检索语义相似的历史成功查询及其回答，敏感查询不参与检索
+// @Tags ai
+// @Produce json
+// @Param q query string true "问题"
+// @Param limit query int false "返回数量（1-20，默认5）"
+// @Success 200 {array} ai.SimilarQuery
+// @Failure 422 {object} utils.Response
+// @Failure 503 {object} utils.Response
+// @Router /ai/history/similar [get]
+func (h *AIHandler) GetSimilarQueries(c *gin.Context) {
+	if h.aiService == nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "AI service is not configured")
+		return
+	}
+
+	var req SimilarQueriesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 5
+	}
+
+	results, err := h.aiService.FindSimilarQueries(c.Request.Context(), req.Q, req.Limit)
+	if err != nil {
+		if errors.Is(err, ai.ErrVectorServiceUnavailable) {
+			utils.ErrorResponse(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		logger.GetLogger().WithError(err).Error("Similar query search failed")
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to search similar queries")
+		return
+	}
+	if results == nil {
+		results = []ai.SimilarQuery{}
+	}
+
+	utils.SuccessResponse(c, results)
+}
+
 // DeleteQueryHistory 删除查询历史
 func (h *AIHandler) DeleteQueryHistory(c *gin.Context) {
 	db := database.GetDatabase()
@@ -244,14 +634,28 @@ func (h *AIHandler) GetQueryStats(c *gin.Context) {
 		successRate = float64(successCount) / float64(totalCount) * 100
 	}
 
+	// token用量（缓存命中的回答记为0）
+	var tokenUsage struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+		EstimatedCount   int64 `json:"estimated_count"` // 用量由分词器估算的查询数
+	}
+	db.Model(&models.QueryHistory{}).
+		Select("COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, COALESCE(SUM(completion_tokens), 0) AS completion_tokens, "+
+			"COALESCE(SUM(CASE WHEN tokens_estimated THEN 1 ELSE 0 END), 0) AS estimated_count").
+		Where("is_success = ?", true).
+		Scan(&tokenUsage)
+
 	// 按模型统计
 	var modelStats []struct {
-		Model string `json:"model"`
-		Count int64  `json:"count"`
+		Model            string `json:"model"`
+		Count            int64  `json:"count"`
+		PromptTokens     int64  `json:"prompt_tokens"`
+		CompletionTokens int64  `json:"completion_tokens"`
 	}
 
 	db.Model(&models.QueryHistory{}).
-		Select("model, count(*) as count").
+		Select("model, count(*) as count, COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, COALESCE(SUM(completion_tokens), 0) AS completion_tokens").
 		Where("is_success = ?", true).
 		Group("model").
 		Order("count desc").
@@ -285,6 +689,7 @@ func (h *AIHandler) GetQueryStats(c *gin.Context) {
 		"success_count":   successCount,
 		"success_rate":    successRate,
 		"avg_duration":    avgDuration,
+		"token_usage":     tokenUsage,
 		"by_models":       modelStats,
 		"popular_queries": popularQueries,
 	}
@@ -308,16 +713,102 @@ func (h *AIHandler) SubmitFeedback(c *gin.Context) {
 		return
 	}
 
-	// 这里可以保存反馈信息到数据库
-	// 暂时只记录日志
+	db := database.GetDatabase()
+	if err := db.Select("id").First(&models.QueryHistory{}, req.QueryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, "Query not found")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch query")
+		return
+	}
+
+	feedback := models.QueryFeedback{
+		QueryID:   req.QueryID,
+		Rating:    req.Rating,
+		Comment:   req.Comment,
+		IsHelpful: req.IsHelpful,
+	}
+	// 开启认证时同一用户对同一查询只能反馈一次，唯一索引兜底并发提交
+	if userID := currentUserID(c); userID != nil {
+		feedback.UserID = userID
+		var count int64
+		if err := db.Model(&models.QueryFeedback{}).Where("query_id = ? AND user_id = ?", req.QueryID, *userID).
+			Count(&count).Error; err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check existing feedback")
+			return
+		}
+		if count > 0 {
+			utils.ErrorResponse(c, http.StatusConflict, "Feedback already submitted for this query")
+			return
+		}
+	}
+
+	if err := db.Create(&feedback).Error; err != nil {
+		logger.GetLogger().WithError(err).WithField("query_id", req.QueryID).Error("Failed to save feedback")
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to save feedback")
+		return
+	}
+
 	logger.GetLogger().WithFields(map[string]interface{}{
 		"query_id":   req.QueryID,
 		"rating":     req.Rating,
-		"comment":    req.Comment,
 		"is_helpful": req.IsHelpful,
 	}).Info("AI query feedback submitted")
 
-	utils.SuccessResponse(c, gin.H{"message": "Feedback submitted successfully"})
+	utils.SuccessResponse(c, feedback)
+}
+
+// FeedbackModelStats 单个模型的反馈统计
+type FeedbackModelStats struct {
+	Model         string  `json:"model"`
+	Count         int64   `json:"count"`
+	AverageRating float64 `json:"average_rating"`
+}
+
+// FeedbackStats 反馈统计
+type FeedbackStats struct {
+	Total             int64                `json:"total"`
+	AverageRating     float64              `json:"average_rating"`
+	HelpfulCount      int64                `json:"helpful_count"`
+	HelpfulPercentage float64              `json:"helpful_percentage"` // 认为回答有帮助的反馈占比（0-100）
+	ByModels          []FeedbackModelStats `json:"by_models"`
+}
+
+// GetFeedbackStats 获取反馈统计：总体评分、有帮助占比及各模型的平均评分
+func (h *AIHandler) GetFeedbackStats(c *gin.Context) {
+	db := database.GetDatabase()
+	stats := FeedbackStats{ByModels: []FeedbackModelStats{}}
+
+	var overall struct {
+		Total         int64
+		AverageRating float64
+		HelpfulCount  int64
+	}
+	if err := db.Model(&models.QueryFeedback{}).
+		Select("count(*) AS total, COALESCE(AVG(rating), 0) AS average_rating, " +
+			"COALESCE(SUM(CASE WHEN is_helpful THEN 1 ELSE 0 END), 0) AS helpful_count").
+		Scan(&overall).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch feedback stats")
+		return
+	}
+	stats.Total, stats.AverageRating, stats.HelpfulCount = overall.Total, overall.AverageRating, overall.HelpfulCount
+	if stats.Total > 0 {
+		stats.HelpfulPercentage = float64(stats.HelpfulCount) / float64(stats.Total) * 100
+	}
+
+	// 已删除的查询历史不计入按模型统计
+	if err := db.Model(&models.QueryFeedback{}).
+		Select("query_histories.model AS model, count(*) AS count, AVG(query_feedbacks.rating) AS average_rating").
+		Joins("JOIN query_histories ON query_histories.id = query_feedbacks.query_id AND query_histories.deleted_at IS NULL").
+		Group("query_histories.model").
+		Order("count DESC").
+		Scan(&stats.ByModels).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch feedback stats")
+		return
+	}
+
+	utils.SuccessResponse(c, stats)
 }
 
 // GetModels 获取支持的AI模型
@@ -331,8 +822,68 @@ func (h *AIHandler) GetModels(c *gin.Context) {
 	utils.SuccessResponse(c, gin.H{"models": models})
 }
 
+// EmbeddingInfo 当前使用的向量模型和维度
+type EmbeddingInfo struct {
+	Model             string                    `json:"model"`
+	Dimensions        int                       `json:"dimensions"`
+	RequestDimensions bool                      `json:"request_dimensions"`
+	Normalize         bool                      `json:"normalize"`
+	Columns           []models.VectorColumnInfo `json:"columns,omitempty"`        // 数据库向量列的实际维度，仅PostgreSQL
+	ColumnsMatch      *bool                     `json:"columns_match,omitempty"` // 向量列维度是否都与配置一致
+}
+
+// GetEmbeddingInfo 获取当前使用的向量模型和维度
+// @Summary 获取向量模型信息
+// @Tags AI
+// @Produce json
+// @Success 200 {object} utils.Response{data=EmbeddingInfo}
+// @Router /ai/embedding-info [get]
+func (h *AIHandler) GetEmbeddingInfo(c *gin.Context) {
+	info := EmbeddingInfo{
+		Model:             h.embedding.Model,
+		Dimensions:        h.embedding.Dimensions,
+		RequestDimensions: h.embedding.RequestDimensions,
+		Normalize:         h.embedding.Normalize,
+	}
+
+	columns, err := models.VectorColumnDimensions(database.GetDatabase())
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to read vector column dimensions")
+		return
+	}
+	if len(columns) > 0 {
+		match := true
+		for _, col := range columns {
+			if col.Dimensions != info.Dimensions {
+				match = false
+			}
+		}
+		info.Columns = columns
+		info.ColumnsMatch = &match
+	}
+
+	utils.SuccessResponse(c, info)
+}
+
+// submitFailedQuery 提交后台任务保存失败的查询，任务池拒绝时只记录日志
+func (h *AIHandler) submitFailedQuery(req QueryRequest, queryErr error) {
+	if err := h.tasks().Submit("save_failed_query", func(ctx context.Context) error {
+		return h.saveFailedQuery(req, queryErr)
+	}); err != nil {
+		logger.GetLogger().WithError(err).WithField("task", "save_failed_query").Warn("Background task dropped")
+	}
+}
+
+// tasks 返回设置的任务池，未设置时使用全局后台任务池
+func (h *AIHandler) tasks() service.TaskSubmitter {
+	if h.taskSubmitter != nil {
+		return h.taskSubmitter
+	}
+	return background.Default()
+}
+
 // saveFailedQuery 保存失败的查询
-func (h *AIHandler) saveFailedQuery(req QueryRequest, err error) {
+func (h *AIHandler) saveFailedQuery(req QueryRequest, err error) error {
 	db := database.GetDatabase()
 
 	history := models.QueryHistory{
@@ -343,9 +894,18 @@ func (h *AIHandler) saveFailedQuery(req QueryRequest, err error) {
 		Duration:     0,
 		IsSuccess:    false,
 		ErrorMessage: err.Error(),
+		IsSensitive:  req.Sensitive,
+
+		ConversationID: req.ConversationID,
+		QueryLanguage:  utils.DetectLanguage(req.Query),
 	}
 
 	if err := db.Create(&history).Error; err != nil {
-		logger.GetLogger().WithError(err).Error("Failed to save failed query")
+		return fmt.Errorf("failed to save failed query: %w", err)
+	}
+	// is_success的默认值为true，创建时会忽略零值false，需要单独更新
+	if err := db.Model(&history).Update("is_success", false).Error; err != nil {
+		return fmt.Errorf("failed to mark query as failed: %w", err)
 	}
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,803 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/ai"
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/middleware"
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/internal/service"
+	"ai-knowledge-app/pkg/database"
+	"ai-knowledge-app/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// mockAIService AIService的测试实现，记录收到的请求并返回预设结果
+type mockAIService struct {
+	response  *ai.QueryResponse
+	summary   *ai.DocumentSummary
+	similar   []ai.SimilarQuery
+	tags      []string
+	chunks    []string // QueryStream依次推送的增量内容
+	err       error
+	block     bool // 阻塞直到上下文被取消，模拟无响应的模型服务
+	calls     int
+	lastReq   ai.QueryRequest
+	lastLimit int
+
+	invalidations int
+	lastAllowed   []string
+}
+
+var _ ai.AIService = (*mockAIService)(nil)
+
+func (m *mockAIService) Query(ctx context.Context, req ai.QueryRequest) (*ai.QueryResponse, error) {
+	m.calls++
+	m.lastReq = req
+	if m.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.response, nil
+}
+
+func (m *mockAIService) QueryStream(ctx context.Context, req ai.QueryRequest, onChunk func(chunk string) error) (*ai.QueryResponse, error) {
+	m.calls++
+	m.lastReq = req
+	if m.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, chunk := range m.chunks {
+		if err := onChunk(chunk); err != nil {
+			return nil, err
+		}
+	}
+	return m.response, nil
+}
+
+func (m *mockAIService) EstimateTokens(ctx context.Context, req ai.QueryRequest) (*ai.TokenEstimate, error) {
+	m.calls++
+	m.lastReq = req
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &ai.TokenEstimate{
+		Model:        req.Model,
+		PromptTokens: ai.CountTokens(req.Model, req.Query),
+		MaxTokens:    req.MaxTokens,
+		TotalTokens:  ai.CountTokens(req.Model, req.Query) + req.MaxTokens,
+	}, nil
+}
+
+func (m *mockAIService) SummarizeDocument(ctx context.Context, text string) (*ai.DocumentSummary, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.summary, nil
+}
+
+func (m *mockAIService) SuggestTags(ctx context.Context, content string, allowed []string) ([]string, error) {
+	m.calls++
+	m.lastAllowed = allowed
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.tags, nil
+}
+
+func (m *mockAIService) FindSimilarQueries(ctx context.Context, query string, limit int) ([]ai.SimilarQuery, error) {
+	m.calls++
+	m.lastReq = ai.QueryRequest{Query: query}
+	m.lastLimit = limit
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.similar, nil
+}
+
+func (m *mockAIService) InvalidateAnswerCache() {
+	m.invalidations++
+}
+
+func (m *mockAIService) AnswerCacheStats() ai.CacheStats {
+	return ai.CacheStats{}
+}
+
+func (m *mockAIService) GetModels() []string {
+	return []string{"mock-model"}
+}
+
+func (m *mockAIService) SetVectorService(vectorService service.VectorService) {}
+
+// setupTestDatabase 初始化内存数据库并替换全局数据库实例
+func setupTestDatabase(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Category{}, &models.Tag{}, &models.Knowledge{}, &models.KnowledgeTag{}, &models.KnowledgeAttachment{}, &models.KnowledgeTranslation{}, &models.QueryHistory{}, &models.QueryFeedback{}, &models.Document{}, &models.SystemSetting{}, &models.ProcessingTask{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	database.DB = db
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func performQuery(handler *AIHandler, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/ai/query", handler.Query)
+
+	req := httptest.NewRequest(http.MethodPost, "/ai/query", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAIHandlerQuerySuccess(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	published := models.Knowledge{Title: "Go", Content: "Go is a language", IsPublished: true}
+	db.Create(&published)
+
+	mock := &mockAIService{response: &ai.QueryResponse{
+		Response:     "answer",
+		Model:        "mock-model",
+		Tokens:       42,
+		Duration:     150 * time.Millisecond,
+		KnowledgeIDs: []uint{published.ID},
+
+		PromptTokens:     120,
+		CompletionTokens: 42,
+	}}
+	handler := NewAIHandler()
+	handler.SetAIService(mock)
+
+	w := performQuery(handler, `{"query":"what is go?"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 未指定参数时应使用默认值
+	if mock.lastReq.Temperature != 0.7 {
+		t.Errorf("Expected default temperature 0.7, got %v", mock.lastReq.Temperature)
+	}
+	if mock.lastReq.MaxTokens != 2000 {
+		t.Errorf("Expected default max tokens 2000, got %d", mock.lastReq.MaxTokens)
+	}
+
+	var resp struct {
+		Data QueryResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Data.Response != "answer" || resp.Data.Tokens != 42 || resp.Data.PromptTokens != 120 || resp.Data.CompletionTokens != 42 {
+		t.Errorf("Unexpected response payload: %+v", resp.Data)
+	}
+	if resp.Data.Duration != 150 {
+		t.Errorf("Expected duration 150ms, got %d", resp.Data.Duration)
+	}
+	if len(resp.Data.RelatedKnowledges) != 1 || resp.Data.RelatedKnowledges[0].ID != published.ID {
+		t.Errorf("Expected related knowledge %d, got %+v", published.ID, resp.Data.RelatedKnowledges)
+	}
+}
+
+func TestAIHandlerQueryKeepsExplicitParameters(t *testing.T) {
+	setupTestDatabase(t)
+
+	mock := &mockAIService{response: &ai.QueryResponse{Response: "ok"}}
+	handler := NewAIHandler()
+	handler.SetAIService(mock)
+
+	w := performQuery(handler, `{"query":"hi","temperature":0.2,"max_tokens":100,"model":"gpt-4"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if mock.lastReq.Temperature != 0.2 || mock.lastReq.MaxTokens != 100 || mock.lastReq.Model != "gpt-4" {
+		t.Errorf("Explicit parameters should be passed through, got %+v", mock.lastReq)
+	}
+}
+
+func TestAIHandlerQueryValidationFailure(t *testing.T) {
+	setupTestDatabase(t)
+
+	mock := &mockAIService{}
+	handler := NewAIHandler()
+	handler.SetAIService(mock)
+
+	for _, body := range []string{`{}`, `{"query":""}`, `not json`} {
+		w := performQuery(handler, body)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Body %q: expected status 422, got %d", body, w.Code)
+		}
+	}
+	if mock.calls != 0 {
+		t.Errorf("AI service should not be called on invalid input, got %d calls", mock.calls)
+	}
+}
+
+func TestAIHandlerQueryFeatureFlags(t *testing.T) {
+	setupTestDatabase(t)
+
+	mock := &mockAIService{response: &ai.QueryResponse{
+		Response:  "ok",
+		Features:  ai.QueryFeatures{UseRetrieval: true, IncludeCitations: true},
+		Citations: []ai.Citation{{Index: 1, KnowledgeID: 7, Title: "Go"}},
+	}}
+	handler := NewAIHandler()
+	handler.SetAIService(mock)
+
+	w := performQuery(handler, `{"query":"hi","use_cache":false,"include_citations":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	overrides := mock.lastReq.Features
+	if overrides.UseRetrieval != nil || overrides.UseRerank != nil {
+		t.Errorf("Unset flags should fall back to config defaults, got %+v", overrides)
+	}
+	if overrides.UseCache == nil || *overrides.UseCache || overrides.IncludeCitations == nil || !*overrides.IncludeCitations {
+		t.Errorf("Explicit flags should be passed through, got %+v", overrides)
+	}
+
+	var resp struct {
+		Data QueryResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !resp.Data.Features.IncludeCitations || len(resp.Data.Citations) != 1 {
+		t.Errorf("Expected features and citations to be echoed, got %+v", resp.Data)
+	}
+
+	// 重排序和引用依赖检索
+	for _, body := range []string{
+		`{"query":"hi","use_retrieval":false,"use_rerank":true}`,
+		`{"query":"hi","use_retrieval":false,"include_citations":true}`,
+	} {
+		if w := performQuery(handler, body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Body %q: expected status 422, got %d", body, w.Code)
+		}
+	}
+	if mock.calls != 1 {
+		t.Errorf("AI service should not be called for conflicting flags, got %d calls", mock.calls)
+	}
+}
+
+func TestAIHandlerQueryStream(t *testing.T) {
+	setupTestDatabase(t)
+
+	mock := &mockAIService{
+		chunks: []string{"Go is ", "a language"},
+		response: &ai.QueryResponse{
+			Response:     "Go is a language",
+			Model:        "mock-model",
+			KnowledgeIDs: []uint{3},
+		},
+	}
+	handler := NewAIHandler()
+	handler.SetAIService(mock)
+	handler.SetTaskSubmitter(inlineJobs{})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/ai/query/stream", handler.QueryStream)
+	stream := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/ai/query/stream", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := stream(`{"query":"what is go?"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("Expected event stream content type, got %s", ct)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"data:{\"content\":\"Go is \"}\n\n",
+		"data:{\"content\":\"a language\"}\n\n",
+		"event:done\n",
+		"\"knowledge_ids\":[3]",
+		"\"model\":\"mock-model\"",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected stream to contain %q, got:\n%s", want, body)
+		}
+	}
+	if mock.lastReq.Temperature != 0.7 {
+		t.Errorf("Expected default temperature for stream, got %v", mock.lastReq.Temperature)
+	}
+
+	if w := stream(`{}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for invalid request, got %d", w.Code)
+	}
+
+	mock.err = errors.New("provider down")
+	if body := stream(`{"query":"hi"}`).Body.String(); !strings.Contains(body, "event:error\n") {
+		t.Errorf("Expected error event, got:\n%s", body)
+	}
+}
+
+func TestAIHandlerQueryCapsReturnedDocs(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	var ids []uint
+	for _, title := range []string{"A", "B", "C", "D"} {
+		k := models.Knowledge{Title: title, Content: title, IsPublished: true}
+		db.Create(&k)
+		ids = append(ids, k.ID)
+	}
+	// 检索顺序与主键顺序不同，截断时应保留最相关的知识
+	ids[0], ids[3] = ids[3], ids[0]
+
+	mock := &mockAIService{response: &ai.QueryResponse{
+		Response:     "ok",
+		KnowledgeIDs: ids,
+		RelevantDocs: []string{"d1", "d2", "d3", "d4"},
+	}}
+	handler := NewAIHandler()
+	handler.SetAIService(mock)
+	handler.SetMaxReturnedDocs(3)
+
+	decode := func(w *httptest.ResponseRecorder) QueryResponse {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data QueryResponse `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp.Data
+	}
+
+	resp := decode(performQuery(handler, `{"query":"hi"}`))
+	if len(resp.RelevantDocs) != 3 || len(resp.RelatedKnowledges) != 3 {
+		t.Errorf("Expected config cap of 3, got %d docs and %d knowledges", len(resp.RelevantDocs), len(resp.RelatedKnowledges))
+	}
+	if resp.RelevantDocsTotal != 4 || resp.RelatedKnowledgesTotal != 4 {
+		t.Errorf("Expected totals of 4, got %d and %d", resp.RelevantDocsTotal, resp.RelatedKnowledgesTotal)
+	}
+	if resp.RelatedKnowledges[0].ID != ids[0] {
+		t.Errorf("Expected most relevant knowledge %d first, got %d", ids[0], resp.RelatedKnowledges[0].ID)
+	}
+	if len(resp.KnowledgeIDs) != 4 {
+		t.Errorf("Knowledge IDs should not be truncated, got %v", resp.KnowledgeIDs)
+	}
+
+	// 请求只能在配置上限内进一步减少
+	if resp := decode(performQuery(handler, `{"query":"hi","max_docs":1}`)); len(resp.RelevantDocs) != 1 || len(resp.RelatedKnowledges) != 1 {
+		t.Errorf("Expected request cap of 1, got %d docs", len(resp.RelevantDocs))
+	}
+	if resp := decode(performQuery(handler, `{"query":"hi","max_docs":10}`)); len(resp.RelevantDocs) != 3 {
+		t.Errorf("Expected request not to exceed config cap, got %d docs", len(resp.RelevantDocs))
+	}
+	if w := performQuery(handler, `{"query":"hi","max_docs":0.5}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for invalid max_docs, got %d", w.Code)
+	}
+
+	handler.SetMaxReturnedDocs(0)
+	if resp := decode(performQuery(handler, `{"query":"hi"}`)); len(resp.RelevantDocs) != 4 {
+		t.Errorf("Expected no cap when disabled, got %d docs", len(resp.RelevantDocs))
+	}
+}
+
+func TestAIHandlerQueryRetrievalOverrides(t *testing.T) {
+	setupTestDatabase(t)
+
+	mock := &mockAIService{response: &ai.QueryResponse{Response: "ok"}}
+	handler := NewAIHandler()
+	handler.SetAIService(mock)
+
+	if w := performQuery(handler, `{"query":"hi","top_k":3,"max_distance":0.35}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	overrides := mock.lastReq.Features
+	if overrides.TopK == nil || *overrides.TopK != 3 || overrides.MaxDistance == nil || *overrides.MaxDistance != 0.35 {
+		t.Errorf("Expected retrieval overrides to be passed through, got %+v", overrides)
+	}
+
+	if performQuery(handler, `{"query":"hi"}`); mock.lastReq.Features.TopK != nil || mock.lastReq.Features.MaxDistance != nil {
+		t.Errorf("Unset retrieval parameters should fall back to config, got %+v", mock.lastReq.Features)
+	}
+
+	for _, body := range []string{`{"query":"hi","top_k":0}`, `{"query":"hi","top_k":51}`, `{"query":"hi","max_distance":-1}`} {
+		if w := performQuery(handler, body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Body %q: expected status 422, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestAIHandlerQueryWithoutService(t *testing.T) {
+	setupTestDatabase(t)
+
+	w := performQuery(NewAIHandler(), `{"query":"hello"}`)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+}
+
+func TestAIHandlerQueryServiceError(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	mock := &mockAIService{err: errors.New("llm unavailable")}
+	handler := NewAIHandler()
+	handler.SetAIService(mock)
+	handler.SetTaskSubmitter(inlineJobs{})
+
+	w := performQuery(handler, `{"query":"hello"}`)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500, got %d", w.Code)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("llm unavailable")) {
+		t.Errorf("Expected error message in response, got %s", w.Body.String())
+	}
+
+	// 失败的查询通过后台任务记录
+	var count int64
+	db.Model(&models.QueryHistory{}).Where("error_message = ?", "llm unavailable").Count(&count)
+	if count != 1 {
+		t.Errorf("Expected failed query to be recorded, got %d", count)
+	}
+}
+
+func TestAIHandlerQueryTimeout(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	mock := &mockAIService{block: true}
+	handler := NewAIHandler()
+	handler.SetAIService(mock)
+	handler.SetQueryTimeout(20*time.Millisecond, time.Minute)
+	handler.SetTaskSubmitter(inlineJobs{})
+
+	w := performQuery(handler, `{"query":"hung upstream"}`)
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("Expected status 504, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 流式查询已开始推送，通过error事件报告超时
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/ai/query/stream", handler.QueryStream)
+	req := httptest.NewRequest(http.MethodPost, "/ai/query/stream", bytes.NewBufferString(`{"query":"hung stream"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if !bytes.Contains(w.Body.Bytes(), []byte("event:error")) || !bytes.Contains(w.Body.Bytes(), []byte("timed out")) {
+		t.Errorf("Expected a timeout error event, got %s", w.Body.String())
+	}
+
+	// 超时的查询记为失败
+	var count int64
+	db.Model(&models.QueryHistory{}).Where("is_success = ? AND error_message = ?", false, "AI query timed out after 20ms").Count(&count)
+	if count != 2 {
+		t.Errorf("Expected timed out queries to be recorded as failed, got %d", count)
+	}
+}
+
+func TestAIHandlerEffectiveQueryTimeout(t *testing.T) {
+	handler := NewAIHandler()
+	handler.SetQueryTimeout(time.Minute, 5*time.Minute)
+
+	cases := []struct {
+		requested int
+		want      time.Duration
+	}{
+		{0, time.Minute},
+		{10, 10 * time.Second},
+		{600, 5 * time.Minute}, // 不超过上限
+	}
+	for _, tc := range cases {
+		if got := handler.effectiveQueryTimeout(tc.requested); got != tc.want {
+			t.Errorf("effectiveQueryTimeout(%d) = %s, want %s", tc.requested, got, tc.want)
+		}
+	}
+
+	// 未配置任何超时时不限制
+	handler.SetQueryTimeout(0, 0)
+	if got := handler.effectiveQueryTimeout(0); got != 0 {
+		t.Errorf("Expected no timeout, got %s", got)
+	}
+}
+
+func TestAIHandlerEstimateTokens(t *testing.T) {
+	setupTestDatabase(t)
+
+	mock := &mockAIService{}
+	handler := NewAIHandler()
+	handler.SetAIService(mock)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/ai/tokens/estimate", handler.EstimateTokens)
+
+	req := httptest.NewRequest(http.MethodPost, "/ai/tokens/estimate", bytes.NewBufferString(`{"query":"hello world"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data ai.TokenEstimate `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Data.PromptTokens == 0 {
+		t.Error("Expected prompt tokens to be counted")
+	}
+	if resp.Data.MaxTokens != 2000 || resp.Data.TotalTokens != resp.Data.PromptTokens+2000 {
+		t.Errorf("Expected default max tokens to be applied, got %+v", resp.Data)
+	}
+}
+
+func performSimilar(handler *AIHandler, rawQuery string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ai/history/similar", handler.GetSimilarQueries)
+
+	req := httptest.NewRequest(http.MethodGet, "/ai/history/similar?"+rawQuery, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAIHandlerGetSimilarQueries(t *testing.T) {
+	mock := &mockAIService{similar: []ai.SimilarQuery{
+		{ID: 1, Query: "what is go?", Response: "a language", Distance: 0.1},
+	}}
+	handler := NewAIHandler()
+	handler.SetAIService(mock)
+
+	w := performSimilar(handler, "q=what+is+golang")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if mock.lastReq.Query != "what is golang" || mock.lastLimit != 5 {
+		t.Errorf("Expected query with default limit 5, got %q limit %d", mock.lastReq.Query, mock.lastLimit)
+	}
+
+	var resp struct {
+		Data []ai.SimilarQuery `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].Response != "a language" {
+		t.Errorf("Unexpected similar queries: %+v", resp.Data)
+	}
+}
+
+func TestAIHandlerGetSimilarQueriesErrors(t *testing.T) {
+	handler := NewAIHandler()
+	if w := performSimilar(handler, "q=go"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without AI service, got %d", w.Code)
+	}
+
+	mock := &mockAIService{}
+	handler.SetAIService(mock)
+	for _, rawQuery := range []string{"", "q=go&limit=50"} {
+		if w := performSimilar(handler, rawQuery); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %q, got %d", rawQuery, w.Code)
+		}
+	}
+	if mock.calls != 0 {
+		t.Errorf("Expected invalid requests not to reach the service, got %d calls", mock.calls)
+	}
+
+	mock.err = ai.ErrVectorServiceUnavailable
+	if w := performSimilar(handler, "q=go"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without vector service, got %d", w.Code)
+	}
+
+	mock.err = errors.New("search failed")
+	if w := performSimilar(handler, "q=go"); w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 on search failure, got %d", w.Code)
+	}
+}
+
+func TestAIHandlerGetEmbeddingInfo(t *testing.T) {
+	setupTestDatabase(t)
+	gin.SetMode(gin.TestMode)
+
+	handler := NewAIHandler()
+	handler.SetEmbeddingConfig(config.EmbeddingConfig{
+		Model:             "text-embedding-3-small",
+		Dimensions:        512,
+		RequestDimensions: true,
+	})
+	r := gin.New()
+	r.GET("/ai/embedding-info", handler.GetEmbeddingInfo)
+
+	req := httptest.NewRequest(http.MethodGet, "/ai/embedding-info", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Data["model"] != "text-embedding-3-small" || resp.Data["dimensions"] != float64(512) || resp.Data["request_dimensions"] != true {
+		t.Errorf("Unexpected embedding info: %v", resp.Data)
+	}
+	// SQLite没有向量列维度信息
+	if _, ok := resp.Data["columns"]; ok {
+		t.Errorf("Expected no column info on SQLite, got %v", resp.Data["columns"])
+	}
+}
+
+func TestAIHandlerSubmitFeedback(t *testing.T) {
+	db := setupTestDatabase(t)
+	gpt := models.QueryHistory{Query: "What is Go?", Response: "A language", Model: "gpt-4", IsSuccess: true}
+	claude := models.QueryHistory{Query: "What is Rust?", Response: "A language", Model: "claude-3", IsSuccess: true}
+	db.Create(&gpt)
+	db.Create(&claude)
+
+	handler := NewAIHandler()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if user := c.GetHeader("X-Test-User"); user != "" {
+			c.Set(middleware.ContextUserIDKey, user)
+		}
+	})
+	r.POST("/ai/feedback", handler.SubmitFeedback)
+	r.GET("/ai/feedback/stats", handler.GetFeedbackStats)
+	submit := func(body, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/ai/feedback", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if user != "" {
+			req.Header.Set("X-Test-User", user)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := submit(fmt.Sprintf(`{"query_id":%d,"rating":5,"comment":"great","is_helpful":true}`, gpt.ID), "7"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var saved models.QueryFeedback
+	if err := db.Where("query_id = ?", gpt.ID).First(&saved).Error; err != nil {
+		t.Fatalf("Expected feedback to be saved: %v", err)
+	}
+	if saved.Rating != 5 || saved.Comment != "great" || !saved.IsHelpful || saved.UserID == nil || *saved.UserID != 7 {
+		t.Errorf("Unexpected saved feedback: %+v", saved)
+	}
+
+	// 同一用户重复反馈返回409，其他用户和匿名反馈不受影响
+	if w := submit(fmt.Sprintf(`{"query_id":%d,"rating":1}`, gpt.ID), "7"); w.Code != http.StatusConflict {
+		t.Errorf("Expected duplicate feedback to be rejected with 409, got %d", w.Code)
+	}
+	if w := submit(fmt.Sprintf(`{"query_id":%d,"rating":3}`, gpt.ID), "8"); w.Code != http.StatusOK {
+		t.Errorf("Expected feedback from another user to succeed, got %d", w.Code)
+	}
+	for i := 0; i < 2; i++ {
+		if w := submit(fmt.Sprintf(`{"query_id":%d,"rating":2}`, claude.ID), ""); w.Code != http.StatusOK {
+			t.Errorf("Expected anonymous feedback to succeed, got %d", w.Code)
+		}
+	}
+
+	if w := submit(`{"query_id":999,"rating":4}`, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected feedback for missing query to return 404, got %d", w.Code)
+	}
+	if w := submit(fmt.Sprintf(`{"query_id":%d,"rating":6}`, gpt.ID), ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected invalid rating to return 422, got %d", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ai/feedback/stats", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data FeedbackStats `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	stats := resp.Data
+	if stats.Total != 4 || stats.AverageRating != 3 || stats.HelpfulCount != 1 || stats.HelpfulPercentage != 25 {
+		t.Errorf("Unexpected overall stats: %+v", stats)
+	}
+	byModel := map[string]FeedbackModelStats{}
+	for _, m := range stats.ByModels {
+		byModel[m.Model] = m
+	}
+	if byModel["gpt-4"].Count != 2 || byModel["gpt-4"].AverageRating != 4 || byModel["claude-3"].AverageRating != 2 {
+		t.Errorf("Unexpected per-model stats: %+v", stats.ByModels)
+	}
+}
+
+func TestAIHandlerGetQueryStatsTokenUsage(t *testing.T) {
+	db := setupTestDatabase(t)
+	db.Create(&models.QueryHistory{Query: "a", Model: "gpt-4", IsSuccess: true, PromptTokens: 100, CompletionTokens: 20})
+	db.Create(&models.QueryHistory{Query: "b", Model: "gpt-4", IsSuccess: true, PromptTokens: 50, CompletionTokens: 10, TokensEstimated: true})
+	db.Create(&models.QueryHistory{Query: "c", Model: "claude-3", IsSuccess: true, PromptTokens: 30, CompletionTokens: 5})
+
+	handler := NewAIHandler()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ai/history/stats", handler.GetQueryStats)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ai/history/stats", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			TokenUsage struct {
+				PromptTokens     int64 `json:"prompt_tokens"`
+				CompletionTokens int64 `json:"completion_tokens"`
+				EstimatedCount   int64 `json:"estimated_count"`
+			} `json:"token_usage"`
+			ByModels []struct {
+				Model            string `json:"model"`
+				PromptTokens     int64  `json:"prompt_tokens"`
+				CompletionTokens int64  `json:"completion_tokens"`
+			} `json:"by_models"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	usage := resp.Data.TokenUsage
+	if usage.PromptTokens != 180 || usage.CompletionTokens != 35 || usage.EstimatedCount != 1 {
+		t.Errorf("Unexpected token usage: %+v", usage)
+	}
+	for _, m := range resp.Data.ByModels {
+		if m.Model == "gpt-4" && (m.PromptTokens != 150 || m.CompletionTokens != 30) {
+			t.Errorf("Unexpected gpt-4 token usage: %+v", m)
+		}
+	}
+}
@@ -60,9 +60,55 @@ func (h *CategoryHandler) GetCategories(c *gin.Context) {
 		return
 	}
 
+	if err := fillCategoryKnowledgeCounts(db, categories); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to count category knowledges")
+		return
+	}
+
 	utils.SuccessResponse(c, categories)
 }
 
+// fillCategoryKnowledgeCounts 使用一次聚合查询填充分类（含预加载的子分类）下已发布知识的数量
+func fillCategoryKnowledgeCounts(db *gorm.DB, categories []models.Category) error {
+	if len(categories) == 0 {
+		return nil
+	}
+
+	var categoryIDs []uint
+	for _, category := range categories {
+		categoryIDs = append(categoryIDs, category.ID)
+		for _, child := range category.Children {
+			categoryIDs = append(categoryIDs, child.ID)
+		}
+	}
+
+	var counts []struct {
+		CategoryID uint
+		Count      int64
+	}
+
+	if err := db.Model(&models.Knowledge{}).
+		Select("category_id, COUNT(*) as count").
+		Where("category_id IN ? AND is_published = ?", categoryIDs, true).
+		Group("category_id").
+		Scan(&counts).Error; err != nil {
+		return err
+	}
+
+	countMap := make(map[uint]int64, len(counts))
+	for _, c := range counts {
+		countMap[c.CategoryID] = c.Count
+	}
+	for i := range categories {
+		categories[i].KnowledgeCount = countMap[categories[i].ID]
+		for j := range categories[i].Children {
+			categories[i].Children[j].KnowledgeCount = countMap[categories[i].Children[j].ID]
+		}
+	}
+
+	return nil
+}
+
 // GetCategory 获取单个分类
 func (h *CategoryHandler) GetCategory(c *gin.Context) {
 	db := database.GetDatabase()
@@ -235,6 +281,50 @@ func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
 	utils.SuccessResponse(c, gin.H{"message": "Category deleted successfully"})
 }
 
+// GetUnusedCategories 获取未被使用的分类（没有知识且没有子分类），用于清理
+func (h *CategoryHandler) GetUnusedCategories(c *gin.Context) {
+	db := database.GetDatabase()
+
+	var pagination utils.PaginationRequest
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	// 与删除分类的检查一致，已删除的知识和子分类不算作使用
+	query := db.Model(&models.Category{}).
+		Joins("LEFT JOIN knowledges ON knowledges.category_id = categories.id AND knowledges.deleted_at IS NULL").
+		Joins("LEFT JOIN categories AS children ON children.parent_id = categories.id AND children.deleted_at IS NULL").
+		Where("knowledges.id IS NULL AND children.id IS NULL")
+
+	if pagination.Search != "" {
+		query = query.Where("categories.name LIKE ?", "%"+pagination.Search+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to count unused categories")
+		return
+	}
+
+	var categories []models.Category
+	if err := query.Order("categories.sort_order ASC, categories.name ASC").
+		Offset(utils.GetOffset(pagination.Page, pagination.PageSize)).
+		Limit(pagination.PageSize).
+		Find(&categories).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch unused categories")
+		return
+	}
+
+	utils.SuccessResponse(c, utils.PaginationResponse{
+		Items:      categories,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: utils.CalculateTotalPages(total, pagination.PageSize),
+	})
+}
+
 // GetCategoryKnowledges 获取分类下的知识
 func (h *CategoryHandler) GetCategoryKnowledges(c *gin.Context) {
 	db := database.GetDatabase()
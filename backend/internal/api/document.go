@@ -1,20 +1,86 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 	"github.com/gin-gonic/gin"
+	"ai-knowledge-app/internal/background"
+	"ai-knowledge-app/internal/models"
 	"ai-knowledge-app/internal/service"
+	"ai-knowledge-app/pkg/logger"
 	"ai-knowledge-app/pkg/utils"
+	"gorm.io/gorm"
 )
 
 type DocumentHandler struct {
-	service *service.DocumentService
+	service       *service.DocumentService
+	taskSubmitter service.TaskSubmitter
+	jobs          *service.JobManager // 完整性校验等长时间运维任务
+	// queueRetryAfter 队列已满返回429时通过Retry-After建议的等待时间
+	queueRetryAfter time.Duration
+
+	progressPollInterval time.Duration // 推送处理进度时轮询数据库和发送心跳的间隔
 }
 
 func NewDocumentHandler(service *service.DocumentService) *DocumentHandler {
-	return &DocumentHandler{service: service}
+	return &DocumentHandler{service: service, progressPollInterval: defaultProgressPollInterval}
+}
+
+// SetTaskSubmitter 设置处理任务使用的任务池，未设置时使用全局后台任务池
+func (h *DocumentHandler) SetTaskSubmitter(submitter service.TaskSubmitter) {
+	h.taskSubmitter = submitter
+}
+
+// expandProcessing ?expand=processing 附加处理状态与分块统计
+const expandProcessing = "processing"
+
+// DocumentResponse 文档响应，按需附加展开的字段
+type DocumentResponse struct {
+	models.Document
+	Processing *service.DocumentProcessingInfo `json:"processing,omitempty"`
+}
+
+// parseExpand 解析逗号分隔的expand参数，返回是否展开处理信息
+func parseExpand(c *gin.Context) (bool, error) {
+	processing := false
+	for _, field := range strings.Split(c.Query("expand"), ",") {
+		switch strings.TrimSpace(field) {
+		case "":
+		case expandProcessing:
+			processing = true
+		default:
+			return false, fmt.Errorf("unsupported expand field: %s", field)
+		}
+	}
+	return processing, nil
+}
+
+// buildDocumentResponses 包装文档，需要时一次性聚合所有文档的分块统计
+func (h *DocumentHandler) buildDocumentResponses(docs []models.Document, withProcessing bool) ([]DocumentResponse, error) {
+	var info map[uint]service.DocumentProcessingInfo
+	if withProcessing {
+		var err error
+		if info, err = h.service.GetProcessingInfo(docs); err != nil {
+			return nil, err
+		}
+	}
+
+	responses := make([]DocumentResponse, len(docs))
+	for i, doc := range docs {
+		responses[i] = DocumentResponse{Document: doc}
+		if withProcessing {
+			processing := info[doc.ID]
+			responses[i].Processing = &processing
+		}
+	}
+	return responses, nil
 }
 
 func (h *DocumentHandler) Upload(c *gin.Context) {
@@ -26,6 +92,10 @@ func (h *DocumentHandler) Upload(c *gin.Context) {
 
 	doc, err := h.service.Upload(file)
 	if err != nil {
+		if errors.Is(err, service.ErrFileTooLarge) {
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to upload document")
 		return
 	}
@@ -33,14 +103,57 @@ func (h *DocumentHandler) Upload(c *gin.Context) {
 	utils.SuccessResponse(c, doc)
 }
 
+// DocumentListRequest 文档列表查询参数
+type DocumentListRequest struct {
+	utils.PaginationRequest
+	Status    string `form:"status"`
+	Extension string `form:"extension"`
+	MinSize   int64  `form:"min_size" binding:"omitempty,min=0"`
+	MaxSize   int64  `form:"max_size" binding:"omitempty,min=0"`
+}
+
+// List 分页获取文档列表，支持按状态、扩展名、大小和文件名过滤
 func (h *DocumentHandler) List(c *gin.Context) {
-	docs, err := h.service.List()
+	withProcessing, err := parseExpand(c)
+	if err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	var req DocumentListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+	if req.MaxSize > 0 && req.MinSize > req.MaxSize {
+		utils.ValidationError(c, "min_size must not exceed max_size")
+		return
+	}
+
+	page, err := h.service.ListPaginated(req.PaginationRequest, service.DocumentFilter{
+		Status:    req.Status,
+		Extension: req.Extension,
+		MinSize:   req.MinSize,
+		MaxSize:   req.MaxSize,
+		Search:    req.Search,
+	})
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidSort) {
+			utils.ValidationError(c, err.Error())
+			return
+		}
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch documents")
 		return
 	}
 
-	utils.SuccessResponse(c, docs)
+	responses, err := h.buildDocumentResponses(page.Items.([]models.Document), withProcessing)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch document processing info")
+		return
+	}
+	page.Items = responses
+
+	utils.SuccessResponse(c, page)
 }
 
 func (h *DocumentHandler) Get(c *gin.Context) {
@@ -49,6 +162,12 @@ func (h *DocumentHandler) Get(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
 		return
 	}
+
+	withProcessing, err := parseExpand(c)
+	if err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
 	
 	doc, err := h.service.GetByID(uint(id))
 	if err != nil {
@@ -56,7 +175,13 @@ func (h *DocumentHandler) Get(c *gin.Context) {
 		return
 	}
 
-	utils.SuccessResponse(c, doc)
+	responses, err := h.buildDocumentResponses([]models.Document{*doc}, withProcessing)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch document processing info")
+		return
+	}
+
+	utils.SuccessResponse(c, responses[0])
 }
 
 func (h *DocumentHandler) Delete(c *gin.Context) {
@@ -127,6 +252,34 @@ func (h *DocumentHandler) Download(c *gin.Context) {
 	c.DataFromReader(http.StatusOK, doc.FileSize, doc.MimeType, reader, nil)
 }
 
+// PresignedURL 获取文档的预签名下载链接，客户端可直接从对象存储下载而不经过后端
+// 本地存储不支持预签名链接，返回501，客户端应改用/download
+func (h *DocumentHandler) PresignedURL(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	doc, err := h.service.GetByID(uint(id))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Document not found")
+		return
+	}
+
+	presigned, err := h.service.PresignDownload(doc)
+	if err != nil {
+		if errors.Is(err, service.ErrPresignNotSupported) {
+			utils.ErrorResponse(c, http.StatusNotImplemented, "Presigned URLs are not available for local storage, use the download endpoint")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to generate presigned URL")
+		return
+	}
+
+	utils.SuccessResponse(c, presigned)
+}
+
 // CheckFile 检查文件是否存在（秒传）
 func (h *DocumentHandler) CheckFile(c *gin.Context) {
 	hash := c.Query("hash")
@@ -156,6 +309,39 @@ func (h *DocumentHandler) CheckFile(c *gin.Context) {
 	utils.SuccessResponse(c, response)
 }
 
+// CheckFilesRequest 批量检查文件是否存在请求
+type CheckFilesRequest struct {
+	Files []CheckFileItem `json:"files" binding:"required,min=1,max=500,dive"`
+}
+
+// CheckFileItem 待检查文件的哈希和大小
+type CheckFileItem struct {
+	Hash string `json:"hash" binding:"required"`
+	Size int64  `json:"size" binding:"min=0"`
+}
+
+// CheckFiles 批量检查文件是否存在（秒传），一次查询返回所有文件的结果，顺序与请求一致
+func (h *DocumentHandler) CheckFiles(c *gin.Context) {
+	var req CheckFilesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	files := make([]service.FileFingerprint, len(req.Files))
+	for i, file := range req.Files {
+		files[i] = service.FileFingerprint{Hash: file.Hash, Size: file.Size}
+	}
+
+	results, err := h.service.CheckFiles(files)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check files")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"results": results})
+}
+
 // InitUpload 初始化分块上传
 func (h *DocumentHandler) InitUpload(c *gin.Context) {
 	var req struct {
@@ -169,13 +355,18 @@ func (h *DocumentHandler) InitUpload(c *gin.Context) {
 		return
 	}
 	
-	session, err := h.service.InitUpload(req.FileName, req.FileSize, req.FileHash)
+	result, err := h.service.InitUpload(req.FileName, req.FileSize, req.FileHash)
 	if err != nil {
+		if errors.Is(err, service.ErrFileTooLarge) {
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to initialize upload")
 		return
 	}
 	
-	utils.SuccessResponse(c, session)
+	// 秒传时status为duplicate并返回新建的文档，否则返回上传会话
+	utils.SuccessResponse(c, result)
 }
 
 // UploadChunk 上传分块
@@ -196,8 +387,18 @@ func (h *DocumentHandler) UploadChunk(c *gin.Context) {
 		return
 	}
 	
-	if err := h.service.UploadChunk(sessionID, chunkIndex, data); err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to upload chunk")
+	// X-Chunk-Hash 为分片的SHA-256（十六进制），不一致时拒绝保存
+	if err := h.service.UploadChunkWithHash(sessionID, chunkIndex, data, c.GetHeader("X-Chunk-Hash")); err != nil {
+		switch {
+		case errors.Is(err, service.ErrChunkHashMismatch):
+			utils.ErrorResponse(c, http.StatusUnprocessableEntity, "Chunk hash mismatch")
+		case errors.Is(err, service.ErrChunkOutOfRange):
+			utils.ErrorResponse(c, http.StatusUnprocessableEntity, err.Error())
+		case errors.Is(err, service.ErrFileTooLarge):
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to upload chunk")
+		}
 		return
 	}
 	
@@ -210,6 +411,10 @@ func (h *DocumentHandler) CompleteUpload(c *gin.Context) {
 	
 	doc, err := h.service.CompleteUpload(sessionID)
 	if err != nil {
+		if errors.Is(err, service.ErrFileTooLarge) {
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to complete upload")
 		return
 	}
@@ -221,11 +426,544 @@ func (h *DocumentHandler) CompleteUpload(c *gin.Context) {
 func (h *DocumentHandler) GetUploadProgress(c *gin.Context) {
 	sessionID := c.Param("sessionId")
 	
-	session, err := h.service.GetUploadProgress(sessionID)
+	progress, err := h.service.GetUploadProgress(sessionID)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusNotFound, "Upload session not found")
 		return
 	}
 	
-	utils.SuccessResponse(c, session)
+	utils.SuccessResponse(c, progress)
+}
+
+// GetMissingChunks 获取尚未上传的分片序号，断线后客户端只需补传这些分片；会话过期返回410
+func (h *DocumentHandler) GetMissingChunks(c *gin.Context) {
+	missing, err := h.service.GetMissingChunks(c.Param("sessionId"))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, "Upload session not found")
+		case errors.Is(err, service.ErrUploadSessionExpired):
+			utils.ErrorResponse(c, http.StatusGone, "Upload session expired")
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check uploaded chunks")
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, missing)
+}
+
+// GetStatsHistory 获取存储用量与去重节省空间的历史趋势
+func (h *DocumentHandler) GetStatsHistory(c *gin.Context) {
+	days := 30
+	if daysStr := c.Query("days"); daysStr != "" {
+		d, err := strconv.Atoi(daysStr)
+		if err != nil || d <= 0 || d > 365 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid days parameter (1-365)")
+			return
+		}
+		days = d
+	}
+
+	history, err := h.service.GetStorageStatsHistory(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch storage stats history")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"days":  days,
+		"items": history,
+	})
+}
+
+// GetDeduplicationStats 获取去重统计（文档数、唯一文件数及节省的空间）
+func (h *DocumentHandler) GetDeduplicationStats(c *gin.Context) {
+	stats, err := h.service.GetDeduplicationStats()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch deduplication stats")
+		return
+	}
+
+	utils.SuccessResponse(c, stats)
+}
+
+// CleanupOrphanedObjects 清理对象存储中没有文档引用的对象
+// 默认只列出不删除，需显式传入dry_run=false才会删除
+func (h *DocumentHandler) CleanupOrphanedObjects(c *gin.Context) {
+	dryRun := true
+	if value := c.Query("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			utils.ValidationError(c, "dry_run must be true or false")
+			return
+		}
+		dryRun = parsed
+	}
+
+	result, err := h.service.CleanupOrphanedObjects(c.Request.Context(), dryRun)
+	if err != nil {
+		if errors.Is(err, service.ErrObjectStorageNotConfigured) {
+			utils.ErrorResponse(c, http.StatusNotImplemented, "Orphan cleanup requires S3-compatible storage")
+			return
+		}
+		logger.GetLogger().WithError(err).Error("Failed to clean up orphaned objects")
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to clean up orphaned objects")
+		return
+	}
+
+	utils.SuccessResponse(c, result)
+}
+
+// defaultIntegrityChecksPerSecond 完整性校验默认每秒最多读取的文件数，避免占满存储带宽
+const defaultIntegrityChecksPerSecond = 10
+
+// VerifyStorageIntegrity 以后台任务校验所有文档的存储文件是否存在且哈希一致，返回任务信息，
+// 校验报告通过/admin/jobs/:id获取
+// 查询参数：mark_corrupted=true时将文件缺失或不一致的文档标记为corrupted；
+// batch_size为每批加载的文档数（1-1000，默认100）；max_per_second为每秒最多读取的文件数（默认10，0表示不限制）
+func (h *DocumentHandler) VerifyStorageIntegrity(c *gin.Context) {
+	opts := service.IntegrityCheckOptions{
+		BatchSize:     service.DefaultIntegrityBatchSize,
+		MaxPerSecond:  defaultIntegrityChecksPerSecond,
+		MarkCorrupted: utils.ContainsString([]string{"true", "1"}, c.Query("mark_corrupted")),
+	}
+	if value := c.Query("batch_size"); value != "" {
+		batchSize, err := strconv.Atoi(value)
+		if err != nil || batchSize < 1 || batchSize > 1000 {
+			utils.ValidationError(c, "batch_size must be between 1 and 1000")
+			return
+		}
+		opts.BatchSize = batchSize
+	}
+	if value := c.Query("max_per_second"); value != "" {
+		perSecond, err := strconv.ParseFloat(value, 64)
+		if err != nil || perSecond < 0 {
+			utils.ValidationError(c, "max_per_second must be a non-negative number")
+			return
+		}
+		opts.MaxPerSecond = perSecond
+	}
+
+	startJob(c, h.jobs, h.queueRetryAfter, "verify_integrity", func(ctx context.Context, progress service.JobProgress) (interface{}, error) {
+		opts.Progress = progress
+		report, err := h.service.VerifyStorageIntegrity(ctx, opts)
+		if err != nil {
+			return report, err
+		}
+		logger.GetLogger().WithFields(map[string]interface{}{
+			"checked":    report.Checked,
+			"missing":    len(report.Missing),
+			"mismatched": len(report.Mismatched),
+			"failed":     len(report.Failed),
+			"marked":     report.Marked,
+			"aborted":    report.Aborted,
+		}).Info("Storage integrity verified")
+		return report, nil
+	})
+}
+
+// StorageHealth 存储健康状态
+type StorageHealth struct {
+	Backend string `json:"backend"` // s3或local
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// GetStorageHealth 检查对象存储是否可用，不可用时返回503
+func (h *DocumentHandler) GetStorageHealth(c *gin.Context) {
+	err := h.service.CheckMinIOHealth()
+	if errors.Is(err, service.ErrObjectStorageNotConfigured) {
+		utils.SuccessResponse(c, StorageHealth{Backend: "local", Healthy: true})
+		return
+	}
+	if err != nil {
+		utils.JSON(c, http.StatusServiceUnavailable, utils.Response{
+			Code:    http.StatusServiceUnavailable,
+			Message: "Object storage is not healthy",
+			Data:    StorageHealth{Backend: "s3", Healthy: false, Error: err.Error()},
+		})
+		return
+	}
+
+	utils.SuccessResponse(c, StorageHealth{Backend: "s3", Healthy: true})
+}
+
+// BatchStatusRequest 批量查询文档处理状态请求
+type BatchStatusRequest struct {
+	DocumentIDs []uint `json:"document_ids" binding:"required,min=1,max=100,dive,min=1"`
+}
+
+// BatchProcessingStatus 批量查询文档处理状态，一次查询返回所有文档的状态
+// 未处理过的文档返回not_started，不存在的文档返回not_found
+func (h *DocumentHandler) BatchProcessingStatus(c *gin.Context) {
+	var req BatchStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	statuses, err := h.service.GetProcessingStatuses(req.DocumentIDs)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch processing statuses")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"statuses": statuses})
+}
+
+// BatchProcessRequest 批量处理文档请求
+type BatchProcessRequest struct {
+	DocumentIDs []uint `json:"document_ids" binding:"required,min=1,max=100,dive,min=1"`
+}
+
+// BatchProcessDocuments 为每个文档提交一个后台处理任务，可通过/processing/status/batch查询进度
+// 队列已满导致没有任何文档入队时返回429并携带Retry-After，服务正在停止时返回503
+func (h *DocumentHandler) BatchProcessDocuments(c *gin.Context) {
+	var req BatchProcessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	result, err := h.service.BatchProcessDocuments(req.DocumentIDs, h.tasks())
+	if err != nil {
+		if respondQueueRejected(c, err, h.queueRetryAfter) {
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to queue documents for processing")
+		return
+	}
+
+	utils.SuccessResponse(c, result)
+}
+
+// DocumentTextRequest 分页读取文档正文，offset与limit按字符计算
+type DocumentTextRequest struct {
+	Offset int `form:"offset" binding:"omitempty,min=0"`
+	Limit  int `form:"limit" binding:"omitempty,min=1,max=100000"`
+}
+
+// defaultDocumentTextLimit 未指定limit时每页返回的字符数
+const defaultDocumentTextLimit = 10000
+
+// GetText 返回处理后的文档正文（清洗后的文本），用于应用内阅读
+// 文档不存在返回404，尚未处理完成返回409
+func (h *DocumentHandler) GetText(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	var req DocumentTextRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultDocumentTextLimit
+	}
+
+	text, err := h.service.GetDocumentText(uint(id), req.Offset, req.Limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, "Document not found")
+		case errors.Is(err, service.ErrDocumentNotProcessed):
+			utils.ErrorResponse(c, http.StatusConflict, fmt.Sprintf("Document has not been processed (status: %s)", text.Status))
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch document text")
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, text)
+}
+
+// GetMarkdown 以Markdown文件返回处理后的文档，Markdown在处理完成时生成并保存
+// 文档尚未处理完成时返回409
+func (h *DocumentHandler) GetMarkdown(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	markdown, err := h.service.GetDocumentMarkdown(uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, "Document not found")
+		case errors.Is(err, service.ErrDocumentNotProcessed):
+			utils.ErrorResponse(c, http.StatusConflict, fmt.Sprintf("Document has not been processed (status: %s)", markdown.Status))
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch document markdown")
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": markdown.Name + ".md"}))
+	c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(markdown.Markdown))
+}
+
+// GetChunk 返回单个分块及其所属文档，用于从AI回答的引用查看原文段落
+// 分块不存在或所属文档已删除时返回404
+func (h *DocumentHandler) GetChunk(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid chunk ID")
+		return
+	}
+
+	chunk, err := h.service.GetChunk(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, "Chunk not found")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch chunk")
+		return
+	}
+
+	utils.SuccessResponse(c, chunk)
+}
+
+// UpdateChunkRequest 手动修正分块内容的请求
+type UpdateChunkRequest struct {
+	Content     string `json:"content" binding:"required"`
+	StartOffset *int   `json:"start_offset,omitempty"` // 修正后的内容在清洗后文本中的位置，须与end_offset同时指定
+	EndOffset   *int   `json:"end_offset,omitempty"`
+	// Metadata 替换分块的元数据，不指定时保留原元数据；配置了元数据结构时按结构校验
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// UpdateChunk 手动修正分块内容（如OCR识别错误），分块标记为手动编辑
+// 分块不存在返回404，位置超出清洗后文本范围或元数据不符合结构（reject模式）返回422
+func (h *DocumentHandler) UpdateChunk(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid chunk ID")
+		return
+	}
+
+	var req UpdateChunkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	chunk, err := h.service.UpdateChunk(uint(id), service.ChunkUpdate{
+		Content:     req.Content,
+		StartOffset: req.StartOffset,
+		EndOffset:   req.EndOffset,
+		Metadata:    req.Metadata,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, "Chunk not found")
+		case errors.Is(err, service.ErrInvalidChunkOffsets), errors.Is(err, service.ErrInvalidChunkMetadata):
+			utils.ValidationError(c, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update chunk")
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, chunk)
+}
+
+// defaultProgressPollInterval 文档不在本实例处理时轮询数据库状态的间隔，也是心跳间隔
+const defaultProgressPollInterval = 2 * time.Second
+
+// StreamProcessingProgress 通过SSE推送文档处理进度（progress事件），处理完成、失败或取消后关闭连接
+// 文档由本实例处理时随流水线推进实时推送，否则按间隔轮询数据库中的状态；客户端断开时停止推送
+func (h *DocumentHandler) StreamProcessingProgress(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	progress, changed, err := h.service.GetProcessingProgress(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, "Document not found")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch processing progress")
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 禁止反向代理缓冲
+
+	ticker := time.NewTicker(h.progressPollInterval)
+	defer ticker.Stop()
+
+	ctx := c.Request.Context()
+	var sent service.ProcessingProgress
+	for first := true; ; first = false {
+		if first || sent != progress {
+			c.SSEvent("progress", progress)
+			sent = progress
+		} else {
+			// 没有变化时发送注释行作为心跳，避免代理关闭空闲连接
+			c.Writer.WriteString(": keepalive\n\n")
+		}
+		c.Writer.Flush()
+		if progress.Done {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		case <-ticker.C:
+		}
+
+		next, nextChanged, err := h.service.GetProcessingProgress(uint(id))
+		if err != nil {
+			c.SSEvent("error", gin.H{"message": "Failed to fetch processing progress"})
+			c.Writer.Flush()
+			return
+		}
+		progress, changed = next, nextChanged
+	}
+}
+
+// GetQueueStats 查询处理队列的实时统计，队列未运行时status为"queue not running"且不返回metrics
+func (h *DocumentHandler) GetQueueStats(c *gin.Context) {
+	utils.SuccessResponse(c, h.service.GetQueueStats())
+}
+
+// PauseQueue 暂停处理队列：运行中的任务继续执行完，worker不再开始队列中的任务，
+// 队列中的任务保留并可继续提交；已暂停时保持不变，队列未运行时返回503
+func (h *DocumentHandler) PauseQueue(c *gin.Context) {
+	h.changeQueueState(c, "paused", h.service.PauseQueue)
+}
+
+// ResumeQueue 恢复已暂停的处理队列，按顺序执行队列中的任务；队列未运行时返回503
+func (h *DocumentHandler) ResumeQueue(c *gin.Context) {
+	h.changeQueueState(c, "resumed", h.service.ResumeQueue)
+}
+
+// changeQueueState 执行暂停或恢复并返回最新的队列统计
+func (h *DocumentHandler) changeQueueState(c *gin.Context, action string, change func() (service.QueueStatsResponse, error)) {
+	stats, err := change()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Processing queue is not running")
+		return
+	}
+
+	logger.GetLogger().WithFields(map[string]interface{}{
+		"client_ip": c.ClientIP(),
+		"paused":    stats.Paused,
+	}).Info("Processing queue " + action)
+	utils.SuccessResponse(c, stats)
+}
+
+// GetTaskStatus 查询处理任务状态
+func (h *DocumentHandler) GetTaskStatus(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid task ID")
+		return
+	}
+
+	task, err := h.service.GetTask(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, "Task not found")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch task")
+		return
+	}
+
+	utils.SuccessResponse(c, task)
+}
+
+// GetTaskByDocumentID 查询文档最近一次的处理任务
+func (h *DocumentHandler) GetTaskByDocumentID(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	task, err := h.service.GetLatestTask(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, "No processing task found for document")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch task")
+		return
+	}
+
+	utils.SuccessResponse(c, task)
+}
+
+// CancelTask 取消处理任务：等待中的任务立即取消，本实例上运行中的任务在当前阶段结束后停止并保留原有分块，其他情况返回409
+func (h *DocumentHandler) CancelTask(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid task ID")
+		return
+	}
+
+	task, err := h.service.CancelTask(uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTaskNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, "Task not found")
+		case errors.Is(err, service.ErrTaskNotCancellable):
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to cancel task")
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, task)
+}
+
+// ReprocessDocument 立即重新解析、清洗和分块文档，替换原有分块并返回新的分块数
+// 解析和分块在事务外完成，只有替换分块和更新状态在一个事务中，失败时保留原有分块和状态；
+// 文档不存在返回404，正在处理返回409
+func (h *DocumentHandler) ReprocessDocument(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	chunkCount, err := h.service.ReprocessDocument(uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, "Document not found")
+		case errors.Is(err, service.ErrDocumentProcessing):
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		default:
+			logger.GetLogger().WithError(err).WithField("document_id", id).Error("Failed to reprocess document")
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to reprocess document")
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"document_id": id, "chunk_count": chunkCount})
+}
+
+// tasks 返回提交处理任务使用的任务池
+func (h *DocumentHandler) tasks() service.TaskSubmitter {
+	if h.taskSubmitter != nil {
+		return h.taskSubmitter
+	}
+	return background.Default()
 }
@@ -0,0 +1,911 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/background"
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func performDocumentRequest(handler *DocumentHandler, path string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/documents", handler.List)
+	r.GET("/documents/:id", handler.Get)
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestDocumentHandlerExpandProcessing(t *testing.T) {
+	db := setupTestDatabase(t)
+	if err := db.AutoMigrate(&models.DocumentChunk{}); err != nil {
+		t.Fatalf("Failed to migrate chunks: %v", err)
+	}
+
+	processed := models.Document{Name: "a.md", Status: "completed"}
+	failed := models.Document{Name: "b.pdf", Status: "failed", Error: "unsupported file type: pdf"}
+	db.Create(&processed)
+	db.Create(&failed)
+	db.Create(&[]models.DocumentChunk{
+		{DocumentID: processed.ID, ChunkIndex: 0, Content: strings.Repeat("a", 30)},
+		{DocumentID: processed.ID, ChunkIndex: 1, Content: strings.Repeat("b", 10)},
+	})
+
+	handler := NewDocumentHandler(service.NewDocumentService(db))
+
+	// 默认不附加处理信息
+	w := performDocumentRequest(handler, "/documents")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), `"processing"`) {
+		t.Errorf("Expected no processing info without expand, got %s", w.Body.String())
+	}
+
+	w = performDocumentRequest(handler, "/documents?expand=processing")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var list struct {
+		Data struct {
+			Items []DocumentResponse `json:"items"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(list.Data.Items) != 2 {
+		t.Fatalf("Expected 2 documents, got %d", len(list.Data.Items))
+	}
+	for _, doc := range list.Data.Items {
+		if doc.Processing == nil {
+			t.Fatalf("Expected processing info for document %d", doc.ID)
+		}
+		switch doc.ID {
+		case processed.ID:
+			p := doc.Processing
+			if p.Status != "completed" || p.ChunkCount != 2 || p.TotalChunkChars != 40 || p.AvgChunkChars != 20 {
+				t.Errorf("Unexpected processing info: %+v", p)
+			}
+		case failed.ID:
+			if p := doc.Processing; p.Status != "failed" || p.Error == "" || p.ChunkCount != 0 {
+				t.Errorf("Unexpected processing info: %+v", p)
+			}
+		}
+	}
+
+	w = performDocumentRequest(handler, "/documents/1?expand=processing")
+	var single struct {
+		Data DocumentResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &single); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if single.Data.Name != "a.md" || single.Data.Processing == nil || single.Data.Processing.ChunkCount != 2 {
+		t.Errorf("Unexpected document response: %+v", single.Data)
+	}
+
+	if w := performDocumentRequest(handler, "/documents?expand=owner"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for unknown expand field, got %d", w.Code)
+	}
+}
+
+func TestDocumentHandlerBatchProcessingStatus(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	processed := models.Document{Name: "a.md", Status: "completed", ChunkCount: 3}
+	uploaded := models.Document{Name: "b.txt", Status: "completed"}
+	chunking := models.Document{Name: "c.txt", Status: "chunking"}
+	db.Create(&processed)
+	db.Create(&uploaded)
+	db.Create(&chunking)
+
+	handler := NewDocumentHandler(service.NewDocumentService(db))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/processing/status/batch", handler.BatchProcessingStatus)
+	batch := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/processing/status/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	body := fmt.Sprintf(`{"document_ids":[%d,%d,%d,999,%d]}`, chunking.ID, processed.ID, uploaded.ID, processed.ID)
+	w := batch(body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			Statuses []service.DocumentStatusEntry `json:"statuses"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	want := []struct {
+		id     uint
+		status string
+	}{
+		{chunking.ID, "chunking"},
+		{processed.ID, "completed"},
+		{uploaded.ID, "not_started"},
+		{999, "not_found"},
+	}
+	if len(resp.Data.Statuses) != len(want) {
+		t.Fatalf("Expected %d statuses (duplicates collapsed), got %+v", len(want), resp.Data.Statuses)
+	}
+	for i, w := range want {
+		got := resp.Data.Statuses[i]
+		if got.DocumentID != w.id || got.Status != w.status {
+			t.Errorf("Entry %d: expected %d/%s, got %d/%s", i, w.id, w.status, got.DocumentID, got.Status)
+		}
+	}
+
+	for _, body := range []string{`{}`, `{"document_ids":[]}`, `{"document_ids":[0]}`} {
+		if w := batch(body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Body %q: expected status 422, got %d", body, w.Code)
+		}
+	}
+}
+
+// rejectingQueue 始终以err拒绝任务的任务池
+type rejectingQueue struct{ err error }
+
+func (q rejectingQueue) Submit(name string, run background.TaskFunc) error {
+	return q.err
+}
+
+func (q rejectingQueue) SubmitLongRunning(name string, run background.TaskFunc) error {
+	return q.err
+}
+
+func TestDocumentHandlerBatchProcessDocuments(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	doc := models.Document{Name: "a.txt", Extension: ".txt", Status: "completed"}
+	db.Create(&doc)
+
+	handler := NewDocumentHandler(service.NewDocumentService(db))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/processing/batch", handler.BatchProcessDocuments)
+	batch := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/processing/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := batch(`{"document_ids":[]}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for empty batch, got %d", w.Code)
+	}
+
+	// 队列已满返回429并建议重试时间，任务池已关闭返回503
+	cases := []struct {
+		err        error
+		retryAfter time.Duration
+		code       int
+		header     string
+	}{
+		{background.ErrQueueFull, 0, http.StatusTooManyRequests, "5"},
+		{background.ErrQueueFull, 2500 * time.Millisecond, http.StatusTooManyRequests, "3"},
+		{background.ErrPoolClosed, 0, http.StatusServiceUnavailable, ""},
+	}
+	for _, tc := range cases {
+		handler.SetTaskSubmitter(rejectingQueue{tc.err})
+		handler.SetQueueRetryAfter(tc.retryAfter)
+		w := batch(fmt.Sprintf(`{"document_ids":[%d]}`, doc.ID))
+		if w.Code != tc.code || w.Header().Get("Retry-After") != tc.header {
+			t.Errorf("%v: expected status %d with Retry-After %q, got %d with %q: %s",
+				tc.err, tc.code, tc.header, w.Code, w.Header().Get("Retry-After"), w.Body.String())
+		}
+	}
+}
+
+func TestStartJobQueueRejected(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	handler := NewDocumentHandler(service.NewDocumentService(db))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/admin/documents/reprocess-all", handler.ReprocessAllDocuments)
+
+	cases := []struct {
+		err    error
+		code   int
+		header string
+	}{
+		{background.ErrQueueFull, http.StatusTooManyRequests, "5"},
+		{background.ErrPoolClosed, http.StatusServiceUnavailable, ""},
+		{errors.New("unexpected"), http.StatusInternalServerError, ""},
+	}
+	for _, tc := range cases {
+		handler.SetJobManager(service.NewJobManager(rejectingQueue{tc.err}))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/documents/reprocess-all", nil))
+		if w.Code != tc.code || w.Header().Get("Retry-After") != tc.header {
+			t.Errorf("%v: expected status %d with Retry-After %q, got %d with %q",
+				tc.err, tc.code, tc.header, w.Code, w.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestStartJobAlreadyActive(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	handler := NewDocumentHandler(service.NewDocumentService(db))
+	handler.SetJobManager(service.NewJobManager(&captureQueue{}))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/admin/documents/reprocess-all", handler.ReprocessAllDocuments)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/documents/reprocess-all", nil))
+	var resp struct {
+		Data service.Job `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK || resp.Data.ID == "" {
+		t.Fatalf("Expected started job, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 同类任务未结束时返回409并给出其ID
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/documents/reprocess-all", nil))
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), resp.Data.ID) {
+		t.Errorf("Expected status 409 naming job %s, got %d: %s", resp.Data.ID, w.Code, w.Body.String())
+	}
+}
+
+func TestDocumentHandlerProcessingTasks(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	doc := models.Document{Name: "a.txt", Status: "queued"}
+	db.Create(&doc)
+	pending := models.ProcessingTask{DocumentID: doc.ID, Status: models.TaskPending}
+	db.Create(&pending)
+	started := time.Now()
+	running := models.ProcessingTask{DocumentID: doc.ID, Status: models.TaskProcessing, StartedAt: &started}
+	db.Create(&running)
+
+	handler := NewDocumentHandler(service.NewDocumentService(db))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/processing/tasks/:id", handler.GetTaskStatus)
+	r.POST("/processing/tasks/:id/cancel", handler.CancelTask)
+	r.GET("/documents/:id/processing-task", handler.GetTaskByDocumentID)
+	perform := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	decodeTask := func(w *httptest.ResponseRecorder) models.ProcessingTask {
+		var resp struct {
+			Data models.ProcessingTask `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp.Data
+	}
+
+	w := perform(http.MethodGet, fmt.Sprintf("/processing/tasks/%d", running.ID))
+	if task := decodeTask(w); w.Code != http.StatusOK || task.Status != models.TaskProcessing || task.StartedAt == nil {
+		t.Errorf("Expected running task, got %d: %s", w.Code, w.Body.String())
+	}
+	w = perform(http.MethodGet, fmt.Sprintf("/documents/%d/processing-task", doc.ID))
+	if task := decodeTask(w); w.Code != http.StatusOK || task.ID != running.ID {
+		t.Errorf("Expected latest task %d, got %d: %s", running.ID, w.Code, w.Body.String())
+	}
+
+	codes := []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodGet, "/processing/tasks/999", http.StatusNotFound},
+		{http.MethodGet, "/processing/tasks/abc", http.StatusBadRequest},
+		{http.MethodGet, "/documents/999/processing-task", http.StatusNotFound},
+		{http.MethodPost, fmt.Sprintf("/processing/tasks/%d/cancel", running.ID), http.StatusConflict},
+		{http.MethodPost, fmt.Sprintf("/processing/tasks/%d/cancel", pending.ID), http.StatusOK},
+		{http.MethodPost, "/processing/tasks/999/cancel", http.StatusNotFound},
+	}
+	for _, tc := range codes {
+		if w := perform(tc.method, tc.path); w.Code != tc.code {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.path, tc.code, w.Code)
+		}
+	}
+}
+
+func TestDocumentHandlerReprocessDocument(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	missing := models.Document{Name: "a.txt", Extension: ".txt", FilePath: "/secret/storage/a.txt", Status: "completed"}
+	busy := models.Document{Name: "b.txt", Status: "parsing"}
+	db.Create(&missing)
+	db.Create(&busy)
+
+	handler := NewDocumentHandler(service.NewDocumentService(db))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/processing/documents/:id/reprocess", handler.ReprocessDocument)
+	perform := func(id uint) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/processing/documents/%d/reprocess", id), nil))
+		return w
+	}
+
+	// 内部错误不返回给客户端
+	w := perform(missing.ID)
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "/secret/storage") {
+		t.Errorf("Expected generic 500 response, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := perform(busy.ID); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a document in flight, got %d", w.Code)
+	}
+	if w := perform(999); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing document, got %d", w.Code)
+	}
+}
+
+func TestDocumentHandlerPauseResumeQueue(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	docService := service.NewDocumentService(db)
+	handler := NewDocumentHandler(docService)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/admin/processing/queue/pause", handler.PauseQueue)
+	r.POST("/admin/processing/queue/resume", handler.ResumeQueue)
+	perform := func(path string) (int, service.QueueStatsResponse) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		var resp struct {
+			Data service.QueueStatsResponse `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Data
+	}
+
+	// 队列未运行时返回503
+	if code, _ := perform("/admin/processing/queue/pause"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without a queue, got %d", code)
+	}
+
+	pool := background.NewPool(1, 4, 0)
+	defer pool.Shutdown(context.Background())
+	docService.SetProcessingQueue(pool)
+	if code, stats := perform("/admin/processing/queue/pause"); code != http.StatusOK || !stats.Paused || !pool.Stats().Paused {
+		t.Errorf("Expected paused queue, got %d: %+v", code, stats)
+	}
+	if code, stats := perform("/admin/processing/queue/resume"); code != http.StatusOK || stats.Paused || pool.Stats().Paused {
+		t.Errorf("Expected resumed queue, got %d: %+v", code, stats)
+	}
+}
+
+func TestDocumentHandlerGetText(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	processed := models.Document{Name: "a.md", Status: "completed", ChunkCount: 1, CleanedText: "知识库 text"}
+	uploaded := models.Document{Name: "b.md", Status: "completed"}
+	failed := models.Document{Name: "c.pdf", Status: "failed"}
+	db.Create(&processed)
+	db.Create(&uploaded)
+	db.Create(&failed)
+
+	handler := NewDocumentHandler(service.NewDocumentService(db))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/documents/:id/text", handler.GetText)
+	perform := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := perform(fmt.Sprintf("/documents/%d/text?offset=2&limit=3", processed.ID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data service.DocumentText `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Data.Text != "库 t" || resp.Data.TotalChars != 8 || !resp.Data.HasMore {
+		t.Errorf("Unexpected text page: %+v", resp.Data)
+	}
+
+	codes := []struct {
+		path string
+		code int
+	}{
+		{fmt.Sprintf("/documents/%d/text", uploaded.ID), http.StatusConflict},
+		{fmt.Sprintf("/documents/%d/text", failed.ID), http.StatusConflict},
+		{"/documents/999/text", http.StatusNotFound},
+		{"/documents/abc/text", http.StatusBadRequest},
+		{fmt.Sprintf("/documents/%d/text?limit=0&offset=-1", processed.ID), http.StatusUnprocessableEntity},
+	}
+	for _, tc := range codes {
+		if w := perform(tc.path); w.Code != tc.code {
+			t.Errorf("%s: expected status %d, got %d", tc.path, tc.code, w.Code)
+		}
+	}
+}
+
+func TestDocumentHandlerGetMarkdown(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	// 在保存Markdown之前处理的文档，首次请求时生成
+	processed := models.Document{Name: "notes", Extension: ".txt", Status: "completed", ChunkCount: 1, CleanedText: "First.\n\nSecond."}
+	uploaded := models.Document{Name: "draft", Extension: ".md", Status: "completed"}
+	db.Create(&processed)
+	db.Create(&uploaded)
+
+	handler := NewDocumentHandler(service.NewDocumentService(db))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/documents/:id/markdown", handler.GetMarkdown)
+	perform := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := perform(fmt.Sprintf("/documents/%d/markdown", processed.ID))
+	if w.Code != http.StatusOK || w.Body.String() != "# notes\n\nFirst.\n\nSecond.\n" {
+		t.Fatalf("Unexpected markdown response %d: %q", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+		t.Errorf("Expected text/markdown content type, got %q", ct)
+	}
+	var stored models.Document
+	db.First(&stored, processed.ID)
+	if stored.Markdown != w.Body.String() {
+		t.Errorf("Expected rendered markdown to be stored, got %q", stored.Markdown)
+	}
+
+	if w := perform(fmt.Sprintf("/documents/%d/markdown", uploaded.ID)); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for unprocessed document, got %d", w.Code)
+	}
+	if w := perform("/documents/999/markdown"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for missing document, got %d", w.Code)
+	}
+}
+
+func TestDocumentHandlerGetChunk(t *testing.T) {
+	db := setupTestDatabase(t)
+	if err := db.AutoMigrate(&models.DocumentChunk{}); err != nil {
+		t.Fatalf("Failed to migrate chunks: %v", err)
+	}
+
+	doc := models.Document{Name: "guide.md", Status: "completed", ChunkCount: 2}
+	deleted := models.Document{Name: "old.md", Status: "completed", ChunkCount: 1}
+	db.Create(&doc)
+	db.Create(&deleted)
+	start, end := 10, 20
+	chunk := models.DocumentChunk{DocumentID: doc.ID, ChunkIndex: 1, Content: "second chunk", Strategy: "recursive", StartOffset: &start, EndOffset: &end}
+	orphan := models.DocumentChunk{DocumentID: deleted.ID, Content: "orphaned"}
+	db.Create(&chunk)
+	db.Create(&orphan)
+	db.Delete(&deleted)
+
+	handler := NewDocumentHandler(service.NewDocumentService(db))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/processing/chunks/:id", handler.GetChunk)
+	perform := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := perform(fmt.Sprintf("/processing/chunks/%d", chunk.ID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data service.ChunkDetail `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	got := resp.Data
+	if got.DocumentID != doc.ID || got.DocumentName != "guide.md" || got.ChunkIndex != 1 || got.ChunkCount != 2 ||
+		got.Content != "second chunk" || got.Strategy != "recursive" || got.StartOffset == nil || *got.StartOffset != 10 {
+		t.Errorf("Unexpected chunk: %+v", got)
+	}
+
+	codes := []struct {
+		path string
+		code int
+	}{
+		{fmt.Sprintf("/processing/chunks/%d", orphan.ID), http.StatusNotFound},
+		{"/processing/chunks/999", http.StatusNotFound},
+		{"/processing/chunks/abc", http.StatusBadRequest},
+	}
+	for _, tc := range codes {
+		if w := perform(tc.path); w.Code != tc.code {
+			t.Errorf("%s: expected status %d, got %d", tc.path, tc.code, w.Code)
+		}
+	}
+}
+
+func TestDocumentHandlerUpdateChunk(t *testing.T) {
+	db := setupTestDatabase(t)
+	if err := db.AutoMigrate(&models.DocumentChunk{}); err != nil {
+		t.Fatalf("Failed to migrate chunks: %v", err)
+	}
+
+	doc := models.Document{Name: "scan.pdf", Status: "completed", ChunkCount: 1, CleanedText: "Hel1o world. Second line."}
+	db.Create(&doc)
+	start, end := 0, 12
+	chunk := models.DocumentChunk{DocumentID: doc.ID, Content: "Hel1o world.", StartOffset: &start, EndOffset: &end}
+	db.Create(&chunk)
+
+	documentService := service.NewDocumentService(db)
+	documentService.SetChunkMetadataSchema(service.ChunkMetadataSchema{
+		Mode:   service.MetadataSchemaReject,
+		Fields: []service.MetadataField{{Key: "page", Type: service.MetadataNumber, Required: true}},
+	})
+	handler := NewDocumentHandler(documentService)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.PUT("/processing/chunks/:id", handler.UpdateChunk)
+	perform := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	path := fmt.Sprintf("/processing/chunks/%d", chunk.ID)
+
+	// 修正后的内容不再与清洗后文本一致，原有位置被清除
+	w := perform(path, `{"content":"Hello world."}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data service.ChunkDetail `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Data.Content != "Hello world." || !resp.Data.ManuallyEdited || resp.Data.EditedAt == nil || resp.Data.StartOffset != nil {
+		t.Errorf("Unexpected updated chunk: %+v", resp.Data)
+	}
+	var stored models.DocumentChunk
+	db.First(&stored, chunk.ID)
+	if stored.Content != "Hello world." || !stored.ManuallyEdited || stored.StartOffset != nil || stored.EndOffset != nil {
+		t.Errorf("Expected edit to be saved, got %+v", stored)
+	}
+
+	// 指定位置时按清洗后文本范围校验
+	if w := perform(path, `{"content":"Second line.","start_offset":13,"end_offset":25}`); w.Code != http.StatusOK {
+		t.Errorf("Expected valid offsets to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+	db.First(&stored, chunk.ID)
+	if stored.StartOffset == nil || *stored.StartOffset != 13 || *stored.EndOffset != 25 {
+		t.Errorf("Expected offsets to be saved, got %+v", stored)
+	}
+
+	// 元数据按配置的结构校验
+	if w := perform(path, `{"content":"Second line.","metadata":{"page":2}}`); w.Code != http.StatusOK {
+		t.Errorf("Expected conforming metadata to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+	db.First(&stored, chunk.ID)
+	if stored.Metadata["page"] != float64(2) {
+		t.Errorf("Expected metadata to be saved, got %+v", stored.Metadata)
+	}
+
+	codes := []struct {
+		path string
+		body string
+		code int
+	}{
+		{path, `{"content":"x","metadata":{"page":"two"}}`, http.StatusUnprocessableEntity},
+		{path, `{"content":"x","metadata":{}}`, http.StatusUnprocessableEntity},
+		{path, `{"content":"x","start_offset":5,"end_offset":100}`, http.StatusUnprocessableEntity},
+		{path, `{"content":"x","start_offset":10,"end_offset":5}`, http.StatusUnprocessableEntity},
+		{path, `{"content":"x","start_offset":5}`, http.StatusUnprocessableEntity},
+		{path, `{"content":""}`, http.StatusUnprocessableEntity},
+		{"/processing/chunks/999", `{"content":"x"}`, http.StatusNotFound},
+		{"/processing/chunks/abc", `{"content":"x"}`, http.StatusBadRequest},
+	}
+	for _, tc := range codes {
+		if w := perform(tc.path, tc.body); w.Code != tc.code {
+			t.Errorf("%s %s: expected status %d, got %d", tc.path, tc.body, tc.code, w.Code)
+		}
+	}
+}
+
+func TestGetMissingChunksStatusCodes(t *testing.T) {
+	db := setupTestDatabase(t)
+	if err := db.AutoMigrate(&models.UploadSession{}); err != nil {
+		t.Fatalf("Failed to migrate upload sessions: %v", err)
+	}
+	db.Create(&models.UploadSession{ID: "active", TotalChunks: 2, TempDir: t.TempDir(), ExpiresAt: time.Now().Add(time.Hour)})
+	db.Create(&models.UploadSession{ID: "expired", TotalChunks: 2, TempDir: t.TempDir(), ExpiresAt: time.Now().Add(-time.Hour)})
+
+	handler := NewDocumentHandler(service.NewDocumentService(db))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/documents/upload/:sessionId/missing-chunks", handler.GetMissingChunks)
+
+	for session, want := range map[string]int{"active": http.StatusOK, "expired": http.StatusGone, "unknown": http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/documents/upload/"+session+"/missing-chunks", nil))
+		if w.Code != want {
+			t.Errorf("%s: expected status %d, got %d: %s", session, want, w.Code, w.Body.String())
+		}
+		if session == "active" && !strings.Contains(w.Body.String(), `"missing_chunks":[0,1]`) {
+			t.Errorf("Expected all chunks missing, got %s", w.Body.String())
+		}
+	}
+}
+
+func TestPresignedURLLocalStorage(t *testing.T) {
+	db := setupTestDatabase(t)
+	doc := models.Document{Name: "a", OriginalName: "a.pdf", FilePath: "uploads/a.pdf"}
+	db.Create(&doc)
+
+	handler := NewDocumentHandler(service.NewDocumentService(db))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/documents/:id/presigned-url", handler.PresignedURL)
+
+	for path, want := range map[string]int{
+		fmt.Sprintf("/documents/%d/presigned-url", doc.ID): http.StatusNotImplemented,
+		"/documents/999/presigned-url":                     http.StatusNotFound,
+		"/documents/abc/presigned-url":                     http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Errorf("%s: expected status %d, got %d: %s", path, want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDocumentMaintenanceEndpointsLocalStorage(t *testing.T) {
+	db := setupTestDatabase(t)
+	db.Create(&models.Document{Name: "a", FileHash: "h1", FileSize: 100, Status: "completed"})
+	db.Create(&models.Document{Name: "b", FileHash: "h1", FileSize: 100, Status: "completed"})
+
+	handler := NewDocumentHandler(service.NewDocumentService(db))
+	adminHandler := NewAdminHandler()
+	jobs := service.NewJobManager(inlineJobs{})
+	handler.SetJobManager(jobs)
+	adminHandler.SetJobManager(jobs)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/documents/dedup-stats", handler.GetDeduplicationStats)
+	r.POST("/admin/documents/cleanup-orphans", handler.CleanupOrphanedObjects)
+	r.GET("/documents/storage-health", handler.GetStorageHealth)
+	r.POST("/admin/documents/verify-integrity", handler.VerifyStorageIntegrity)
+	r.GET("/admin/jobs/:id", adminHandler.GetJob)
+	r.POST("/admin/jobs/:id/cancel", adminHandler.CancelJob)
+
+	perform := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := perform(http.MethodGet, "/documents/dedup-stats")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"space_saved_bytes":100`) {
+		t.Errorf("Unexpected dedup stats response %d: %s", w.Code, w.Body.String())
+	}
+
+	// 本地存储不支持孤儿对象清理
+	if w := perform(http.MethodPost, "/admin/documents/cleanup-orphans"); w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status 501 for local storage cleanup, got %d", w.Code)
+	}
+	if w := perform(http.MethodPost, "/admin/documents/cleanup-orphans?dry_run=maybe"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for invalid dry_run, got %d", w.Code)
+	}
+
+	w = perform(http.MethodGet, "/documents/storage-health")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"backend":"local","healthy":true`) {
+		t.Errorf("Unexpected storage health response %d: %s", w.Code, w.Body.String())
+	}
+
+	// 校验以后台任务运行，文档没有存储文件时不参与校验
+	w = perform(http.MethodPost, "/admin/documents/verify-integrity?mark_corrupted=true")
+	var started struct {
+		Data service.Job `json:"data"`
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &started) != nil || started.Data.Type != "verify_integrity" {
+		t.Fatalf("Unexpected verify-integrity response %d: %s", w.Code, w.Body.String())
+	}
+	w = perform(http.MethodGet, "/admin/jobs/"+started.Data.ID)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"completed"`) || !strings.Contains(w.Body.String(), `"checked":0`) {
+		t.Errorf("Unexpected integrity job %d: %s", w.Code, w.Body.String())
+	}
+	if w := perform(http.MethodPost, "/admin/jobs/"+started.Data.ID+"/cancel"); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for cancelling a finished job, got %d", w.Code)
+	}
+	if w := perform(http.MethodGet, "/admin/jobs/missing"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown job, got %d", w.Code)
+	}
+	if w := perform(http.MethodPost, "/admin/documents/verify-integrity?batch_size=0"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for invalid batch_size, got %d", w.Code)
+	}
+}
+
+// inlineJobs 在提交时直接执行任务，测试结束时不会遗留仍在全局任务池中运行的任务
+type inlineJobs struct{}
+
+func (inlineJobs) Submit(name string, run background.TaskFunc) error {
+	run(context.Background())
+	return nil
+}
+
+func (q inlineJobs) SubmitLongRunning(name string, run background.TaskFunc) error {
+	return q.Submit(name, run)
+}
+
+// captureQueue 保存提交的任务，由测试控制执行时机
+type captureQueue struct {
+	tasks []background.TaskFunc
+}
+
+func (q *captureQueue) Submit(name string, run background.TaskFunc) error {
+	q.tasks = append(q.tasks, run)
+	return nil
+}
+
+func (q *captureQueue) SubmitLongRunning(name string, run background.TaskFunc) error {
+	return q.Submit(name, run)
+}
+
+// readProgressEvents 读取SSE流中的progress事件直到连接关闭
+func readProgressEvents(t *testing.T, body io.Reader) []service.ProcessingProgress {
+	t.Helper()
+	var events []service.ProcessingProgress
+	scanner := bufio.NewScanner(body)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:") && event == "progress":
+			var progress service.ProcessingProgress
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &progress); err != nil {
+				t.Fatalf("Failed to decode progress event %q: %v", line, err)
+			}
+			events = append(events, progress)
+		}
+	}
+	return events
+}
+
+func TestDocumentHandlerStreamProcessingProgress(t *testing.T) {
+	db := setupTestDatabase(t)
+	db.AutoMigrate(&models.DocumentChunk{})
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("First paragraph.\n\nSecond paragraph."), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	doc := models.Document{Name: "notes", Extension: ".txt", FilePath: path, Status: "completed"}
+	failed := models.Document{Name: "broken", Extension: ".txt", Status: "failed", Error: "unsupported file"}
+	stale := models.Document{Name: "stale", Extension: ".txt", Status: "parsing"}
+	db.Create(&doc)
+	db.Create(&failed)
+	db.Create(&stale)
+
+	docService := service.NewDocumentService(db)
+	queue := &captureQueue{}
+	if _, err := docService.BatchProcessDocuments([]uint{doc.ID}, queue); err != nil || len(queue.tasks) != 1 {
+		t.Fatalf("Failed to queue document: %v", err)
+	}
+
+	handler := NewDocumentHandler(docService)
+	handler.progressPollInterval = 10 * time.Millisecond
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/processing/documents/:id/progress/stream", handler.StreamProcessingProgress)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	stream := func(id uint) *http.Response {
+		resp, err := http.Get(fmt.Sprintf("%s/processing/documents/%d/progress/stream", server.URL, id))
+		if err != nil {
+			t.Fatalf("Failed to open stream: %v", err)
+		}
+		return resp
+	}
+
+	// 本实例处理的文档随流水线推进推送进度，完成后关闭连接
+	resp := stream(doc.ID)
+	go queue.tasks[0](context.Background())
+	events := readProgressEvents(t, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("Expected event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if len(events) < 2 || events[0].Status != string(models.StatusQueued) {
+		t.Fatalf("Expected queued progress followed by updates, got %+v", events)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Percent < events[i-1].Percent {
+			t.Errorf("Expected progress to advance, got %+v", events)
+		}
+	}
+	last := events[len(events)-1]
+	if !last.Done || last.Status != string(models.StatusCompleted) || last.Percent != 100 || last.ChunkCount == 0 {
+		t.Errorf("Expected completed final event, got %+v", last)
+	}
+
+	// 已结束的文档只推送一次状态
+	resp = stream(failed.ID)
+	events = readProgressEvents(t, resp.Body)
+	resp.Body.Close()
+	if len(events) != 1 || !events[0].Done || events[0].Error != "unsupported file" {
+		t.Errorf("Expected a single failed event, got %+v", events)
+	}
+
+	// 不在本实例处理的文档轮询数据库状态
+	resp = stream(stale.ID)
+	db.Model(&stale).Updates(map[string]interface{}{"status": "completed", "chunk_count": 3})
+	events = readProgressEvents(t, resp.Body)
+	resp.Body.Close()
+	if last := events[len(events)-1]; !last.Done || last.ChunkCount != 3 {
+		t.Errorf("Expected polled completion, got %+v", events)
+	}
+
+	if resp := stream(999); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404 for missing document, got %d", resp.StatusCode)
+	}
+}
+
+func TestDocumentHandlerStreamProcessingProgressClientDisconnect(t *testing.T) {
+	db := setupTestDatabase(t)
+	doc := models.Document{Name: "stale", Extension: ".txt", Status: "parsing"}
+	db.Create(&doc)
+
+	handler := NewDocumentHandler(service.NewDocumentService(db))
+	handler.progressPollInterval = 10 * time.Millisecond
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/processing/documents/:id/progress/stream", handler.StreamProcessingProgress)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/processing/documents/%d/progress/stream", doc.ID), nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected stream to stop after the client disconnected")
+	}
+}
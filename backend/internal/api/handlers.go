@@ -2,19 +2,31 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"ai-knowledge-app/internal/ai"
+	"ai-knowledge-app/internal/background"
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/middleware"
 	"ai-knowledge-app/internal/models"
 	"ai-knowledge-app/internal/service"
 	"ai-knowledge-app/pkg/database"
+	"ai-knowledge-app/pkg/logger"
 	"ai-knowledge-app/pkg/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/pgvector/pgvector-go"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Validate 验证器实例
@@ -25,29 +37,226 @@ var Validate = validator.New()
 // KnowledgeHandler 知识库处理器
 type KnowledgeHandler struct {
 	vectorService service.VectorService
+	aiService     ai.AIService
+	defaultSort   string
+	defaultOrder  string
+	autoTag       config.AutoTagConfig
+	// regenerateSlug 标题修改时按新标题重新生成slug，默认保留原slug
+	regenerateSlug bool
+	// snippetLength 列表中摘要片段的字符数，0表示返回完整内容
+	snippetLength int
+	// searchMaxResults 列表和搜索单页最多返回的条数
+	searchMaxResults int
+	// relatedLimit、relatedMaxLimit 相关知识默认返回条数及limit参数上限
+	relatedLimit    int
+	relatedMaxLimit int
+	// minEmbeddingLength 内容少于该字符数时不生成向量，0表示不限制
+	minEmbeddingLength int
+	// reindexBatchSize 重建向量时每批读取的知识数，与向量批大小一致，每批通过一次批量请求生成向量
+	reindexBatchSize int
+	// jobs 后台重建向量等运维任务
+	jobs *service.JobManager
+	// queueRetryAfter 队列已满返回429时通过Retry-After建议的等待时间
+	queueRetryAfter time.Duration
 }
 
 // NewKnowledgeHandler 创建知识库处理器
 func NewKnowledgeHandler(vectorService service.VectorService) *KnowledgeHandler {
 	return &KnowledgeHandler{
-		vectorService: vectorService,
+		vectorService:    vectorService,
+		defaultSort:      "created_at",
+		defaultOrder:     "desc",
+		snippetLength:    200,
+		searchMaxResults: 100,
+		relatedLimit:     5,
+		relatedMaxLimit:  20,
+		reindexBatchSize: defaultReindexBatchSize,
 	}
 }
 
+// knowledgeSortFields 知识列表允许的排序字段及对应的列
+// 列名带表名前缀，避免按标签过滤时与关联表的同名列冲突
+var knowledgeSortFields = map[string]string{
+	"created_at":         "knowledges.created_at",
+	"updated_at":         "knowledges.updated_at",
+	"title":              "knowledges.title",
+	"view_count":         "knowledges.view_count",
+	"ai_reference_count": "knowledges.ai_reference_count",
+}
+
+// trendingSort 按热度排序，热度为随发布时间衰减的浏览量
+const trendingSort = "trending"
+
+// trendingScoreExpr 热度得分的SQL表达式：(浏览量+1) / (发布天数+2)^2
+// 不同数据库的日期运算不同，按方言生成
+func trendingScoreExpr(dialect string) string {
+	age := "(julianday('now') - julianday(knowledges.created_at))"
+	if dialect == "postgres" {
+		age = "(EXTRACT(EPOCH FROM (NOW() - knowledges.created_at)) / 86400.0)"
+	}
+	return fmt.Sprintf("((knowledges.view_count + 1.0) / ((%s + 2) * (%s + 2)))", age, age)
+}
+
+// buildKnowledgeOrder 校验排序字段和方向，生成带id次级排序的ORDER BY子句
+// 排序值相同的记录按id排序，保证分页结果稳定
+func buildKnowledgeOrder(sort, order, dialect string) (string, error) {
+	column, ok := knowledgeSortFields[sort]
+	if sort == trendingSort {
+		column, ok = trendingScoreExpr(dialect), true
+	}
+	if !ok {
+		return "", fmt.Errorf("invalid sort field: %s", sort)
+	}
+
+	order = strings.ToUpper(order)
+	if order != "ASC" && order != "DESC" {
+		return "", fmt.Errorf("invalid sort order: %s", order)
+	}
+
+	return fmt.Sprintf("%s %s, knowledges.id %s", column, order, order), nil
+}
+
+// SetDefaultOrder 设置知识列表的默认排序
+func (h *KnowledgeHandler) SetDefaultOrder(sort, order string) error {
+	if _, err := buildKnowledgeOrder(sort, order, ""); err != nil {
+		return err
+	}
+	h.defaultSort = sort
+	h.defaultOrder = order
+	return nil
+}
+
+// SetAIService 设置AI服务（用于文档自动摘要）
+func (h *KnowledgeHandler) SetAIService(service ai.AIService) {
+	h.aiService = service
+}
+
+// SetMinEmbeddingLength 设置生成向量的最小内容长度（字符数），0表示不限制
+func (h *KnowledgeHandler) SetMinEmbeddingLength(length int) {
+	if length >= 0 {
+		h.minEmbeddingLength = length
+	}
+}
+
+// SetEmbeddingBatchSize 设置重建向量时每批读取的知识数，通常为ai.embedding.batch_size
+func (h *KnowledgeHandler) SetEmbeddingBatchSize(size int) {
+	if size > 0 {
+		h.reindexBatchSize = size
+	}
+}
+
+// embeddingSkipReason 返回内容不生成向量的原因，为空表示应生成向量
+func (h *KnowledgeHandler) embeddingSkipReason(content string) string {
+	if h.minEmbeddingLength > 0 && utf8.RuneCountInString(strings.TrimSpace(content)) < h.minEmbeddingLength {
+		return models.EmbeddingSkipContentTooShort
+	}
+	return ""
+}
+
+// skipEmbedding 记录不生成向量的原因，并清除按旧内容生成的向量
+func skipEmbedding(db *gorm.DB, knowledgeID uint, reason string) error {
+	return db.Model(&models.Knowledge{}).Where("id = ?", knowledgeID).
+		Updates(map[string]interface{}{"content_vector": nil, "embedding_skip_reason": reason}).Error
+}
+
+// saveEmbedding 保存知识的向量并清除之前记录的跳过原因
+func saveEmbedding(db *gorm.DB, knowledgeID uint, embedding *pgvector.Vector) error {
+	return db.Model(&models.Knowledge{}).Where("id = ?", knowledgeID).
+		Updates(map[string]interface{}{"content_vector": embedding, "embedding_skip_reason": ""}).Error
+}
+
+// SetRegenerateSlugOnTitleChange 设置标题修改时是否重新生成slug
+func (h *KnowledgeHandler) SetRegenerateSlugOnTitleChange(regenerate bool) {
+	h.regenerateSlug = regenerate
+}
+
+// SetSearchOptions 设置列表和搜索的单页最大条数及摘要长度
+func (h *KnowledgeHandler) SetSearchOptions(maxResults, snippetLength int) {
+	if maxResults > 0 {
+		h.searchMaxResults = maxResults
+	}
+	if snippetLength >= 0 {
+		h.snippetLength = snippetLength
+	}
+}
+
+// SetRelatedLimits 设置相关知识的默认返回条数及limit参数上限
+func (h *KnowledgeHandler) SetRelatedLimits(defaultLimit, maxLimit int) error {
+	if maxLimit < 1 || defaultLimit < 1 || defaultLimit > maxLimit {
+		return fmt.Errorf("invalid related knowledge limits: default %d, max %d", defaultLimit, maxLimit)
+	}
+	h.relatedLimit = defaultLimit
+	h.relatedMaxLimit = maxLimit
+	return nil
+}
+
+// parseRelatedLimit 解析相关知识的limit参数，未指定时使用默认值
+func (h *KnowledgeHandler) parseRelatedLimit(c *gin.Context) (int, error) {
+	limitStr := c.Query("limit")
+	if limitStr == "" {
+		return h.relatedLimit, nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 || limit > h.relatedMaxLimit {
+		return 0, fmt.Errorf("limit must be an integer between 1 and %d", h.relatedMaxLimit)
+	}
+	return limit, nil
+}
+
+// KnowledgeListItem 列表和搜索结果中的知识条目
+// 用高亮摘要代替完整内容以减小响应体积，完整内容通过详情接口获取
+type KnowledgeListItem struct {
+	models.Knowledge
+	Content string `json:"content,omitempty"`
+	Snippet string `json:"snippet"`
+}
+
+// limitPageSize 将单页条数限制在searchMaxResults以内
+func (h *KnowledgeHandler) limitPageSize(pagination *utils.PaginationRequest) {
+	if h.searchMaxResults > 0 && pagination.PageSize > h.searchMaxResults {
+		pagination.PageSize = h.searchMaxResults
+	}
+}
+
+// listItems 将知识转换为列表条目，term非空时高亮匹配的关键词
+// snippetLength为0时原样返回完整内容
+func (h *KnowledgeHandler) listItems(knowledges []models.Knowledge, term string) interface{} {
+	if h.snippetLength == 0 {
+		return knowledges
+	}
+	items := make([]KnowledgeListItem, len(knowledges))
+	for i, knowledge := range knowledges {
+		items[i] = KnowledgeListItem{
+			Knowledge: knowledge,
+			Snippet:   utils.Snippet(knowledge.Content, term, h.snippetLength),
+		}
+	}
+	return items
+}
+
+// SetAutoTagConfig 设置自动打标签配置
+func (h *KnowledgeHandler) SetAutoTagConfig(cfg config.AutoTagConfig) {
+	h.autoTag = cfg
+}
+
 // CreateKnowledgeRequest 创建知识请求
 type CreateKnowledgeRequest struct {
 	Title       string          `json:"title" binding:"required,min=1,max=255"`
+	Slug        string          `json:"slug" binding:"omitempty,max=255"` // 留空时由标题生成
 	Content     string          `json:"content" binding:"required"`
 	Summary     string          `json:"summary"`
 	CategoryID  uint            `json:"category_id"`
 	Tags        []string        `json:"tags"`
 	Metadata    models.Metadata `json:"metadata"`
 	IsPublished bool            `json:"is_published"`
+	// SyncEmbedding 为true时在返回前生成并保存向量，生成失败时不创建知识；默认异步生成
+	SyncEmbedding bool `json:"sync_embedding"`
 }
 
 // UpdateKnowledgeRequest 更新知识请求
 type UpdateKnowledgeRequest struct {
 	Title       string          `json:"title" binding:"omitempty,min=1,max=255"`
+	Slug        string          `json:"slug" binding:"omitempty,max=255"`
 	Content     string          `json:"content"`
 	Summary     string          `json:"summary"`
 	CategoryID  uint            `json:"category_id"`
@@ -76,6 +285,8 @@ func (h *KnowledgeHandler) GetKnowledges(c *gin.Context) {
 		return
 	}
 
+	h.limitPageSize(&pagination)
+
 	// 构建查询
 	query := db.Model(&models.Knowledge{}).Preload("Category").Preload("Tags")
 
@@ -98,6 +309,21 @@ func (h *KnowledgeHandler) GetKnowledges(c *gin.Context) {
 		}
 	}
 
+	// 只看自己创建的条目
+	if utils.ContainsString([]string{"true", "1"}, c.Query("mine")) {
+		userID, ok := middleware.GetNumericUserID(c)
+		if !ok {
+			utils.ErrorResponse(c, http.StatusUnauthorized, "Authentication required to filter by owner")
+			return
+		}
+		query = query.Where("knowledges.created_by = ?", userID)
+	}
+
+	// 只看因内容过短等原因未生成向量的条目
+	if utils.ContainsString([]string{"true", "1"}, c.Query("embedding_skipped")) {
+		query = query.Where("knowledges.embedding_skip_reason <> ''")
+	}
+
 	// 标签过滤
 	if tagIDStr := c.Query("tag_id"); tagIDStr != "" {
 		if tagID, err := strconv.ParseUint(tagIDStr, 10, 32); err == nil {
@@ -117,10 +343,18 @@ func (h *KnowledgeHandler) GetKnowledges(c *gin.Context) {
 	offset := utils.GetOffset(pagination.Page, pagination.PageSize)
 	var knowledges []models.Knowledge
 
-	// 排序
-	orderClause := "created_at DESC"
+	// 排序（未指定时使用默认排序）
+	sort, order := h.defaultSort, h.defaultOrder
 	if pagination.Sort != "" {
-		orderClause = fmt.Sprintf("%s %s", pagination.Sort, strings.ToUpper(pagination.Order))
+		sort = pagination.Sort
+	}
+	if c.Query("order") != "" {
+		order = pagination.Order
+	}
+	orderClause, err := buildKnowledgeOrder(sort, order, db.Dialector.Name())
+	if err != nil {
+		utils.ValidationError(c, err.Error())
+		return
 	}
 	query = query.Order(orderClause)
 
@@ -131,7 +365,7 @@ func (h *KnowledgeHandler) GetKnowledges(c *gin.Context) {
 
 	// 构建分页响应
 	response := utils.PaginationResponse{
-		Items:      knowledges,
+		Items:      h.listItems(knowledges, pagination.Search),
 		Total:      total,
 		Page:       pagination.Page,
 		PageSize:   pagination.PageSize,
@@ -168,6 +402,31 @@ func (h *KnowledgeHandler) GetKnowledge(c *gin.Context) {
 	utils.SuccessResponse(c, knowledge)
 }
 
+// GetKnowledgeBySlug 按slug获取知识
+// @Summary 按slug获取知识条目
+// @Description 根据slug获取知识条目详情，用于可读链接
+// @Tags knowledge
+// @Produce json
+// @Param slug path string true "知识slug"
+// @Success 200 {object} utils.Response
+// @Failure 404 {object} utils.Response
+// @Router /knowledge/slug/{slug} [get]
+func (h *KnowledgeHandler) GetKnowledgeBySlug(c *gin.Context) {
+	db := database.GetDatabase()
+
+	var knowledge models.Knowledge
+	if err := db.Preload("Category").Preload("Tags").Where("slug = ?", c.Param("slug")).First(&knowledge).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Knowledge not found")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch knowledge")
+		return
+	}
+
+	utils.SuccessResponse(c, knowledge)
+}
+
 // CreateKnowledge 创建知识
 // @Summary 创建新的知识条目
 // @Description 创建新的知识条目，支持分类和标签
@@ -196,15 +455,21 @@ func (h *KnowledgeHandler) CreateKnowledge(c *gin.Context) {
 		}
 	}
 
-	// 创建知识
+	if req.Slug != "" && !checkRequestedSlug(c, db, req.Slug, 0) {
+		return
+	}
+
+	// 创建知识，未指定slug时由BeforeCreate按标题生成
 	knowledge := models.Knowledge{
 		Title:         utils.CleanText(req.Title),
+		Slug:          req.Slug,
 		Content:       utils.CleanText(req.Content),
-		ContentVector: nil, // 初始为空，后续异步生成
+		ContentVector: nil, // 初始为空，默认在创建后异步生成
 		Summary:       utils.CleanText(req.Summary),
 		CategoryID:    req.CategoryID,
 		Metadata:      req.Metadata,
 		IsPublished:   req.IsPublished,
+		CreatedBy:     currentUserID(c),
 	}
 
 	// 如果没有提供摘要，自动生成
@@ -212,24 +477,34 @@ func (h *KnowledgeHandler) CreateKnowledge(c *gin.Context) {
 		knowledge.Summary = utils.TruncateText(knowledge.Content, 200)
 	}
 
+	// 同步生成向量，保证返回后即可被语义检索；内容过短时与异步模式一样只记录跳过原因
+	syncEmbedding := req.SyncEmbedding && h.embeddingSkipReason(knowledge.Content) == ""
+	if syncEmbedding {
+		if h.vectorService == nil {
+			utils.ErrorResponse(c, http.StatusServiceUnavailable, "Vector service is not configured")
+			return
+		}
+		embedding, err := h.vectorService.GenerateEmbedding(c.Request.Context(), knowledge.Content)
+		if err != nil {
+			logger.GetLogger().WithError(err).WithField("title", knowledge.Title).Warn("Failed to generate embedding for new knowledge")
+			utils.ErrorResponse(c, http.StatusBadGateway, fmt.Sprintf("Failed to generate embedding: %v", err))
+			return
+		}
+		knowledge.ContentVector = &embedding
+	}
+
 	// 保存知识
 	if err := db.Create(&knowledge).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("Failed to create knowledge: %v", err))
 		return
 	}
 
+	h.invalidateAnswerCache()
+
 	// 异步生成和保存向量（不阻塞主流程）
-	go func(knowledgeID uint) {
-		embedding, err := h.vectorService.GenerateEmbedding(context.Background(), knowledge.Content)
-		if err != nil {
-			// 向量生成失败，不影响知识保存，只记录日志
-			// logger.GetLogger().WithError(err).Warn("Failed to generate embedding for knowledge ID: ", knowledgeID)
-			return
-		}
-		if err := db.Model(&models.Knowledge{}).Where("id = ?", knowledgeID).Update("content_vector", &embedding).Error; err != nil {
-			// logger.GetLogger().WithError(err).Warn("Failed to save embedding for knowledge ID: ", knowledgeID)
-		}
-	}(knowledge.ID)
+	if !syncEmbedding {
+		h.queueEmbedding(knowledge.ID, knowledge.Content)
+	}
 
 	// 处理标签
 	if len(req.Tags) > 0 {
@@ -238,6 +513,9 @@ func (h *KnowledgeHandler) CreateKnowledge(c *gin.Context) {
 			return
 		}
 	}
+	if h.autoTag.Enabled {
+		h.queueAutoTag(knowledge.ID)
+	}
 
 	// 重新加载完整的知识对象
 	db.Preload("Category").Preload("Tags").First(&knowledge, knowledge.ID)
@@ -255,6 +533,7 @@ func (h *KnowledgeHandler) CreateKnowledge(c *gin.Context) {
 // @Param request body UpdateKnowledgeRequest true "更新知识请求"
 // @Success 200 {object} utils.Response
 // @Failure 400 {object} utils.Response
+// @Failure 403 {object} utils.Response
 // @Failure 404 {object} utils.Response
 // @Router /knowledge/{id} [put]
 func (h *KnowledgeHandler) UpdateKnowledge(c *gin.Context) {
@@ -270,6 +549,10 @@ func (h *KnowledgeHandler) UpdateKnowledge(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch knowledge")
 		return
 	}
+	if !canModifyKnowledge(c, &knowledge) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Only the author can modify this knowledge")
+		return
+	}
 
 	var req UpdateKnowledgeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -288,8 +571,26 @@ func (h *KnowledgeHandler) UpdateKnowledge(c *gin.Context) {
 	}
 
 	// 更新字段
+	titleChanged := false
 	if req.Title != "" {
-		knowledge.Title = utils.CleanText(req.Title)
+		title := utils.CleanText(req.Title)
+		titleChanged = title != knowledge.Title
+		knowledge.Title = title
+	}
+
+	switch {
+	case req.Slug != "" && req.Slug != knowledge.Slug:
+		if !checkRequestedSlug(c, db, req.Slug, knowledge.ID) {
+			return
+		}
+		knowledge.Slug = req.Slug
+	case req.Slug == "" && titleChanged && (h.regenerateSlug || knowledge.Slug == ""):
+		slug, err := models.UniqueKnowledgeSlug(db, utils.Slugify(knowledge.Title), knowledge.ID)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to generate slug")
+			return
+		}
+		knowledge.Slug = slug
 	}
 
 	contentChanged := false
@@ -330,30 +631,48 @@ func (h *KnowledgeHandler) UpdateKnowledge(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update knowledge")
 		return
 	}
+	h.invalidateAnswerCache()
 
-	// 如果内容有变化且不为空，更新向量
-	if contentChanged && knowledge.Content != "" {
+	// 如果内容有变化且不为空，更新向量；内容过短时不生成向量并清除旧向量
+	if reason := h.embeddingSkipReason(knowledge.Content); contentChanged && knowledge.Content != "" && reason != "" {
+		if err := skipEmbedding(db, knowledge.ID, reason); err != nil {
+			logger.GetLogger().WithError(err).WithField("knowledge_id", knowledge.ID).Warn("Failed to record skipped embedding")
+		} else {
+			knowledge.EmbeddingSkipReason = reason
+			h.invalidateAnswerCache()
+		}
+	} else if contentChanged && knowledge.Content != "" {
 		embedding, err := h.vectorService.GenerateEmbedding(context.Background(), knowledge.Content)
 		if err != nil {
 			// 即使生成向量失败，也应保存知识的其他更新
 			// 但记录一个错误日志
-			// logger.GetLogger().WithError(err).Warn("Failed to update embedding for knowledge ID: ", knowledge.ID)
+			logEmbeddingError(knowledge.ID, err)
 		} else {
-			if err := db.Model(&knowledge).Update("content_vector", embedding).Error; err != nil {
-				// logger.GetLogger().WithError(err).Warn("Failed to save embedding for knowledge ID: ", knowledge.ID)
+			if err := saveEmbedding(db, knowledge.ID, &embedding); err != nil {
+				logger.GetLogger().WithError(err).WithField("knowledge_id", knowledge.ID).Warn("Failed to save embedding")
+			} else {
+				h.invalidateAnswerCache()
 			}
 		}
 	}
 
 	// 处理标签
 	if len(req.Tags) > 0 {
-		// 清除现有标签关联
+		// 清除现有标签关联（被移除的标签需要重新计算使用次数）
+		var oldTags []models.Tag
+		db.Model(&knowledge).Association("Tags").Find(&oldTags)
 		db.Model(&knowledge).Association("Tags").Clear()
 		// 添加新标签
 		if err := h.attachTags(&knowledge, req.Tags); err != nil {
 			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to attach tags")
 			return
 		}
+		if err := syncTagUsage(db, tagIDs(oldTags)); err != nil {
+			logger.GetLogger().WithError(err).Warn("Failed to update tag usage count")
+		}
+	}
+	if contentChanged && h.autoTag.Enabled {
+		h.queueAutoTag(knowledge.ID)
 	}
 
 	// 重新加载完整的知识对象
@@ -370,6 +689,7 @@ func (h *KnowledgeHandler) UpdateKnowledge(c *gin.Context) {
 // @Produce json
 // @Param id path int true "知识ID"
 // @Success 200 {object} utils.Response
+// @Failure 403 {object} utils.Response
 // @Failure 404 {object} utils.Response
 // @Router /knowledge/{id} [delete]
 func (h *KnowledgeHandler) DeleteKnowledge(c *gin.Context) {
@@ -385,125 +705,968 @@ func (h *KnowledgeHandler) DeleteKnowledge(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch knowledge")
 		return
 	}
+	if !canModifyKnowledge(c, &knowledge) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Only the author can modify this knowledge")
+		return
+	}
+
+	var tags []models.Tag
+	db.Model(&knowledge).Association("Tags").Find(&tags)
 
 	// 软删除
 	if err := db.Delete(&knowledge).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete knowledge")
 		return
 	}
+	h.invalidateAnswerCache()
+	if err := syncTagUsage(db, tagIDs(tags)); err != nil {
+		logger.GetLogger().WithError(err).Warn("Failed to update tag usage count")
+	}
 
 	utils.SuccessResponse(c, gin.H{"message": "Knowledge deleted successfully"})
 }
 
-// SearchKnowledges 搜索知识
-func (h *KnowledgeHandler) SearchKnowledges(c *gin.Context) {
+// defaultReindexBatchSize 未设置向量批大小时重建向量每批读取的知识数，与ai.embedding.batch_size的默认值一致
+const defaultReindexBatchSize = 100
+
+// ReindexResult 批量重建向量的结果
+type ReindexResult struct {
+	Candidates int    `json:"candidates"`            // 需要生成向量的知识数
+	Reindexed  int    `json:"reindexed"`             // 成功生成并保存的数量
+	Failed     int    `json:"failed"`                // 失败的数量
+	FailedIDs  []uint `json:"failed_ids,omitempty"`  // 失败的知识ID
+	Skipped    int    `json:"skipped"`               // 内容过短而不生成向量的数量
+	SkippedIDs []uint `json:"skipped_ids,omitempty"` // 不生成向量的知识ID
+	Aborted    bool   `json:"aborted,omitempty"`     // 请求被取消，剩余的知识未处理
+
+	// 已发布知识的译文向量
+	TranslationCandidates int    `json:"translation_candidates"`
+	TranslationsReindexed int    `json:"translations_reindexed"`
+	TranslationsFailed    int    `json:"translations_failed"`
+	FailedTranslationIDs  []uint `json:"failed_translation_ids,omitempty"`
+}
+
+// missingVectorCondition 向量列为空的条件，不同数据库判断零维向量的方式不同
+func missingVectorCondition(dialect, column string) string {
+	if dialect == "postgres" {
+		return fmt.Sprintf("(%[1]s IS NULL OR vector_dims(%[1]s) = 0)", column)
+	}
+	return fmt.Sprintf("(%[1]s IS NULL OR %[1]s = '' OR %[1]s = '[]')", column)
+}
+
+// reindex 为已发布知识及其译文生成向量，ctx取消时返回已处理部分的结果（Aborted为true）
+// progress不为nil时先统计待处理的知识和译文总数，每批处理后报告进度
+func (h *KnowledgeHandler) reindex(ctx context.Context, force bool, progress service.JobProgress) (ReindexResult, error) {
 	db := database.GetDatabase()
+	query := db.Model(&models.Knowledge{}).Select("id, content").Where("is_published = ?", true)
+	if !force {
+		query = query.Where(missingVectorCondition(db.Dialector.Name(), "content_vector"))
+	}
+	translations := h.translationReindexQuery(db, force)
 
-	query := c.Query("q")
-	if query == "" {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Search query is required")
-		return
+	total := 0
+	if progress != nil {
+		var knowledgeCount, translationCount int64
+		if err := query.Session(&gorm.Session{}).Count(&knowledgeCount).Error; err != nil {
+			return ReindexResult{}, fmt.Errorf("failed to count knowledges: %w", err)
+		}
+		if err := translations.Session(&gorm.Session{}).Count(&translationCount).Error; err != nil {
+			return ReindexResult{}, fmt.Errorf("failed to count knowledge translations: %w", err)
+		}
+		total = int(knowledgeCount + translationCount)
+		progress(0, total)
+	}
+	report := func(result *ReindexResult) {
+		if progress != nil {
+			progress(result.Candidates+result.TranslationCandidates, total)
+		}
 	}
 
-	// 解析分页参数
+	result := ReindexResult{}
+	var batch []models.Knowledge
+	err := query.FindInBatches(&batch, h.reindexBatchSize, func(tx *gorm.DB, _ int) error {
+		if ctx.Err() != nil {
+			result.Aborted = true
+			return ctx.Err()
+		}
+		result.Candidates += len(batch)
+
+		ids := make([]uint, 0, len(batch))
+		contents := make([]string, 0, len(batch))
+		for _, knowledge := range batch {
+			if reason := h.embeddingSkipReason(knowledge.Content); reason != "" {
+				if err := skipEmbedding(db, knowledge.ID, reason); err != nil {
+					logger.GetLogger().WithError(err).WithField("knowledge_id", knowledge.ID).Warn("Failed to record skipped embedding")
+					result.Failed++
+					result.FailedIDs = append(result.FailedIDs, knowledge.ID)
+					continue
+				}
+				result.Skipped++
+				result.SkippedIDs = append(result.SkippedIDs, knowledge.ID)
+				continue
+			}
+			ids = append(ids, knowledge.ID)
+			contents = append(contents, knowledge.Content)
+		}
+		errs := h.generateAndSaveEmbeddings(ctx, contents, func(i int, embedding *pgvector.Vector) error {
+			return saveEmbedding(db, ids[i], embedding)
+		})
+		for i, err := range errs {
+			if err != nil {
+				logEmbeddingError(ids[i], err)
+				result.Failed++
+				result.FailedIDs = append(result.FailedIDs, ids[i])
+				continue
+			}
+			result.Reindexed++
+		}
+		report(&result)
+		return nil
+	}).Error
+	if err != nil && !result.Aborted {
+		return result, fmt.Errorf("failed to fetch knowledges: %w", err)
+	}
+
+	if !result.Aborted {
+		if err := h.reindexTranslations(ctx, db, translations, &result, report); err != nil && !result.Aborted {
+			return result, fmt.Errorf("failed to fetch knowledge translations: %w", err)
+		}
+	}
+
+	if result.Reindexed > 0 || result.TranslationsReindexed > 0 {
+		h.invalidateAnswerCache()
+	}
+	return result, nil
+}
+
+// translationReindexQuery 查询已发布知识的译文，force为false时只查询缺少向量的译文
+func (h *KnowledgeHandler) translationReindexQuery(db *gorm.DB, force bool) *gorm.DB {
+	query := db.Model(&models.KnowledgeTranslation{}).
+		Select("knowledge_translations.id, knowledge_translations.content").
+		Joins("JOIN knowledges ON knowledges.id = knowledge_translations.knowledge_id").
+		Where("knowledges.is_published = ? AND knowledges.deleted_at IS NULL", true)
+	if !force {
+		query = query.Where(missingVectorCondition(db.Dialector.Name(), "knowledge_translations.content_vector"))
+	}
+	return query
+}
+
+// reindexTranslations 为query查询到的译文生成向量，每批处理后调用report
+func (h *KnowledgeHandler) reindexTranslations(ctx context.Context, db *gorm.DB, query *gorm.DB, result *ReindexResult, report func(*ReindexResult)) error {
+	var batch []models.KnowledgeTranslation
+	return query.FindInBatches(&batch, h.reindexBatchSize, func(tx *gorm.DB, _ int) error {
+		if ctx.Err() != nil {
+			result.Aborted = true
+			return ctx.Err()
+		}
+		result.TranslationCandidates += len(batch)
+
+		ids := make([]uint, len(batch))
+		contents := make([]string, len(batch))
+		for i, translation := range batch {
+			ids[i], contents[i] = translation.ID, translation.Content
+		}
+		errs := h.generateAndSaveEmbeddings(ctx, contents, func(i int, embedding *pgvector.Vector) error {
+			return db.Model(&models.KnowledgeTranslation{}).Where("id = ?", ids[i]).Update("content_vector", embedding).Error
+		})
+		for i, err := range errs {
+			if err != nil {
+				logger.GetLogger().WithError(err).WithField("translation_id", ids[i]).Warn("Failed to generate translation embedding")
+				result.TranslationsFailed++
+				result.FailedTranslationIDs = append(result.FailedTranslationIDs, ids[i])
+				continue
+			}
+			result.TranslationsReindexed++
+		}
+		report(result)
+		return nil
+	}).Error
+}
+
+// generateAndSaveEmbeddings 通过批量请求为contents生成向量并逐条保存，返回与contents对应的错误（成功为nil）
+// 批量请求失败时，未得到向量的内容逐条重试，避免单条内容（如超出模型长度限制）导致整批失败
+func (h *KnowledgeHandler) generateAndSaveEmbeddings(ctx context.Context, contents []string, save func(i int, embedding *pgvector.Vector) error) []error {
+	errs := make([]error, len(contents))
+
+	// 空内容无法生成向量，不参与批量请求
+	var indexes []int
+	var texts []string
+	for i, content := range contents {
+		if content == "" {
+			errs[i] = errors.New("input text cannot be empty")
+			continue
+		}
+		indexes = append(indexes, i)
+		texts = append(texts, content)
+	}
+	if len(texts) == 0 {
+		return errs
+	}
+
+	embeddings, err := h.vectorService.GenerateEmbeddings(ctx, texts)
+	retryIndividually := err != nil && service.IsEmbeddingBatchRecoverable(err)
+	if retryIndividually {
+		logger.GetLogger().WithError(err).WithField("texts", len(texts)).Warn("Batch embedding failed, retrying remaining texts individually")
+	} else if err != nil {
+		logger.GetLogger().WithError(err).WithField("texts", len(texts)).Error("Batch embedding failed")
+	}
+	for j, i := range indexes {
+		if j < len(embeddings) {
+			errs[i] = save(i, &embeddings[j])
+			continue
+		}
+		// 逐条重试也会失败的错误直接记入剩余文本
+		if err != nil && !retryIndividually {
+			errs[i] = err
+			continue
+		}
+		if ctx.Err() != nil {
+			errs[i] = ctx.Err()
+			continue
+		}
+		embedding, err := h.vectorService.GenerateEmbedding(ctx, texts[j])
+		if err == nil {
+			err = save(i, &embedding)
+		}
+		errs[i] = err
+	}
+	return errs
+}
+
+// TrashedKnowledge 回收站中的知识条目
+type TrashedKnowledge struct {
+	models.Knowledge
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// GetTrashedKnowledges 获取回收站（所有用户已软删除的知识），仅管理员可用
+// @Summary 获取回收站中的知识条目
+// @Description 分页获取已软删除的知识条目，按删除时间倒序
+// @Tags admin
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(10)
+// @Success 200 {object} utils.PaginationResponse
+// @Router /admin/knowledge/trash [get]
+func (h *KnowledgeHandler) GetTrashedKnowledges(c *gin.Context) {
+	db := database.GetDatabase()
+
 	var pagination utils.PaginationRequest
 	if err := c.ShouldBindQuery(&pagination); err != nil {
 		utils.ValidationError(c, err.Error())
 		return
 	}
 
-	// 构建搜索查询
-	searchTerm := "%" + strings.ToLower(query) + "%"
-	dbQuery := db.Model(&models.Knowledge{}).
-		Preload("Category").
-		Preload("Tags").
-		Where("(LOWER(title) LIKE ? OR LOWER(content) LIKE ? OR LOWER(summary) LIKE ? OR LOWER(metadata.keywords) LIKE ?) AND is_published = ?",
-			searchTerm, searchTerm, searchTerm, searchTerm, true)
+	query := db.Unscoped().Model(&models.Knowledge{}).Where("deleted_at IS NOT NULL")
 
-	// 获取总数
 	var total int64
-	if err := dbQuery.Count(&total).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to count search results")
+	if err := query.Count(&total).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to count trashed knowledges")
 		return
 	}
 
-	// 分页查询
-	offset := utils.GetOffset(pagination.Page, pagination.PageSize)
 	var knowledges []models.Knowledge
-
-	if err := dbQuery.Order("created_at DESC").Offset(offset).Limit(pagination.PageSize).Find(&knowledges).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to search knowledges")
+	if err := query.Preload("Category").Preload("Tags").
+		Order("deleted_at DESC, id DESC").
+		Offset(utils.GetOffset(pagination.Page, pagination.PageSize)).
+		Limit(pagination.PageSize).
+		Find(&knowledges).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch trashed knowledges")
 		return
 	}
 
-	// 构建响应
-	response := utils.PaginationResponse{
-		Items:      knowledges,
+	items := make([]TrashedKnowledge, len(knowledges))
+	for i, knowledge := range knowledges {
+		items[i] = TrashedKnowledge{Knowledge: knowledge, DeletedAt: knowledge.DeletedAt.Time}
+	}
+
+	utils.SuccessResponse(c, utils.PaginationResponse{
+		Items:      items,
 		Total:      total,
 		Page:       pagination.Page,
 		PageSize:   pagination.PageSize,
 		TotalPages: utils.CalculateTotalPages(total, pagination.PageSize),
-	}
-
-	utils.SuccessResponse(c, response)
+	})
 }
 
-// GetRelatedKnowledges 获取相关知识
-func (h *KnowledgeHandler) GetRelatedKnowledges(c *gin.Context) {
+// RestoreKnowledge 从回收站恢复知识
+// @Summary 恢复已删除的知识条目
+// @Description 撤销软删除，恢复后重新计算标签使用次数
+// @Tags knowledge
+// @Produce json
+// @Param id path int true "知识ID"
+// @Success 200 {object} utils.Response
+// @Failure 403 {object} utils.Response
+// @Failure 404 {object} utils.Response
+// @Router /knowledge/{id}/restore [post]
+func (h *KnowledgeHandler) RestoreKnowledge(c *gin.Context) {
 	db := database.GetDatabase()
 	id := c.Param("id")
 
 	var knowledge models.Knowledge
-	if err := db.First(&knowledge, id).Error; err != nil {
+	if err := db.Unscoped().Where("deleted_at IS NOT NULL").First(&knowledge, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			utils.ErrorResponse(c, http.StatusNotFound, "Knowledge not found")
+			utils.ErrorResponse(c, http.StatusNotFound, "Deleted knowledge not found")
 			return
 		}
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch knowledge")
 		return
 	}
+	if !canModifyKnowledge(c, &knowledge) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Only the author can modify this knowledge")
+		return
+	}
 
-	// 获取limit参数
-	limitStr := c.DefaultQuery("limit", "5")
-	limit, _ := strconv.Atoi(limitStr)
-	if limit <= 0 || limit > 20 {
-		limit = 5
+	if err := db.Unscoped().Model(&knowledge).Update("deleted_at", nil).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to restore knowledge")
+		return
 	}
+	h.invalidateAnswerCache()
 
-	// 基于分类和标签查找相关知识
-	var relatedKnowledges []models.Knowledge
+	var tags []models.Tag
+	db.Model(&knowledge).Association("Tags").Find(&tags)
+	if err := syncTagUsage(db, tagIDs(tags)); err != nil {
+		logger.GetLogger().WithError(err).Warn("Failed to update tag usage count")
+	}
 
-	// 同分类的知识
-	db.Preload("Category").Preload("Tags").
-		Where("category_id = ? AND id != ? AND is_published = ?",
-			knowledge.CategoryID, knowledge.ID, true).
-		Order("created_at DESC").
-		Limit(limit).
-		Find(&relatedKnowledges)
+	db.Preload("Category").Preload("Tags").First(&knowledge, knowledge.ID)
+	utils.SuccessResponse(c, knowledge)
+}
 
-	// 如果同分类的知识不够，添加同标签的知识
-	if len(relatedKnowledges) < limit {
-		var tagIDs []uint
-		for _, tag := range knowledge.Tags {
-			tagIDs = append(tagIDs, tag.ID)
-		}
+// KnowledgeAttachmentRequest 添加附件请求
+type KnowledgeAttachmentRequest struct {
+	DocumentID uint `json:"document_id" binding:"required"`
+}
 
-		if len(tagIDs) > 0 {
-			var tagKnowledges []models.Knowledge
-			db.Table("knowledges").
-				Select("knowledges.*").
-				Joins("INNER JOIN knowledge_tags ON knowledges.id = knowledge_tags.knowledge_id").
-				Where("knowledge_tags.tag_id IN ? AND knowledges.id != ? AND knowledges.id NOT IN (?) AND knowledges.is_published = ?",
-					tagIDs, knowledge.ID,
-					func() []uint {
-						existingIDs := []uint{knowledge.ID}
-						for _, k := range relatedKnowledges {
-							existingIDs = append(existingIDs, k.ID)
-						}
-						return existingIDs
-					}(), true).
-				Order("created_at DESC").
-				Limit(limit - len(relatedKnowledges)).
+// KnowledgeAttachment 知识的附件文档，附带关联时间和下载链接
+type KnowledgeAttachment struct {
+	models.Document
+	AttachedAt  time.Time `json:"attached_at"`
+	DownloadURL string    `json:"download_url"`
+}
+
+// documentDownloadURL 文档下载接口的路径
+func documentDownloadURL(documentID uint) string {
+	return fmt.Sprintf("/api/v1/documents/%d/download", documentID)
+}
+
+// GetKnowledgeAttachments 获取知识的附件
+// @Summary 获取知识的附件文档
+// @Description 按关联时间返回作为附件的源文档及其下载链接，已删除的文档不会返回
+// @Tags knowledge
+// @Produce json
+// @Param id path int true "知识ID"
+// @Success 200 {object} utils.Response{data=[]KnowledgeAttachment}
+// @Failure 404 {object} utils.Response
+// @Router /knowledge/{id}/attachments [get]
+func (h *KnowledgeHandler) GetKnowledgeAttachments(c *gin.Context) {
+	db := database.GetDatabase()
+
+	var knowledge models.Knowledge
+	if err := db.First(&knowledge, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Knowledge not found")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch knowledge")
+		return
+	}
+
+	attachments := []KnowledgeAttachment{}
+	if err := db.Model(&models.Document{}).
+		Select("documents.*, knowledge_attachments.created_at AS attached_at").
+		Joins("JOIN knowledge_attachments ON knowledge_attachments.document_id = documents.id").
+		Where("knowledge_attachments.knowledge_id = ?", knowledge.ID).
+		Order("knowledge_attachments.created_at, documents.id").
+		Scan(&attachments).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch attachments")
+		return
+	}
+	for i := range attachments {
+		attachments[i].DownloadURL = documentDownloadURL(attachments[i].ID)
+	}
+
+	utils.SuccessResponse(c, attachments)
+}
+
+// AttachDocument 为知识添加附件
+// @Summary 关联源文档到知识
+// @Description 将已上传的文档作为附件关联到知识条目，重复关联不会报错
+// @Tags knowledge
+// @Accept json
+// @Produce json
+// @Param id path int true "知识ID"
+// @Param request body KnowledgeAttachmentRequest true "附件文档"
+// @Success 200 {object} utils.Response{data=KnowledgeAttachment}
+// @Failure 403 {object} utils.Response
+// @Failure 404 {object} utils.Response
+// @Router /knowledge/{id}/attachments [post]
+func (h *KnowledgeHandler) AttachDocument(c *gin.Context) {
+	db := database.GetDatabase()
+
+	var req KnowledgeAttachmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	knowledge, ok := h.findModifiableKnowledge(c, db)
+	if !ok {
+		return
+	}
+
+	var document models.Document
+	if err := db.First(&document, req.DocumentID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Document not found")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch document")
+		return
+	}
+
+	attachment := models.KnowledgeAttachment{KnowledgeID: knowledge.ID, DocumentID: document.ID}
+	if err := db.Where(attachment).FirstOrCreate(&attachment).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to attach document")
+		return
+	}
+
+	utils.SuccessResponse(c, KnowledgeAttachment{
+		Document:    document,
+		AttachedAt:  attachment.CreatedAt,
+		DownloadURL: documentDownloadURL(document.ID),
+	})
+}
+
+// DetachDocument 移除知识的附件
+// @Summary 取消源文档与知识的关联
+// @Description 只移除关联，文档本身不会被删除
+// @Tags knowledge
+// @Produce json
+// @Param id path int true "知识ID"
+// @Param document_id path int true "文档ID"
+// @Success 200 {object} utils.Response
+// @Failure 403 {object} utils.Response
+// @Failure 404 {object} utils.Response
+// @Router /knowledge/{id}/attachments/{document_id} [delete]
+func (h *KnowledgeHandler) DetachDocument(c *gin.Context) {
+	db := database.GetDatabase()
+
+	documentID, err := strconv.ParseUint(c.Param("document_id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	knowledge, ok := h.findModifiableKnowledge(c, db)
+	if !ok {
+		return
+	}
+
+	result := db.Where("knowledge_id = ? AND document_id = ?", knowledge.ID, documentID).Delete(&models.KnowledgeAttachment{})
+	if result.Error != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to detach document")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.ErrorResponse(c, http.StatusNotFound, "Attachment not found")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "Document detached successfully"})
+}
+
+// KnowledgeTranslationRequest 保存知识译文请求
+type KnowledgeTranslationRequest struct {
+	Title   string `json:"title" binding:"required,min=1,max=255"`
+	Content string `json:"content" binding:"required"`
+	Summary string `json:"summary"`
+}
+
+// translationLanguage 解析路径中的语言标签，格式无效时写入422响应并返回false
+func translationLanguage(c *gin.Context) (string, bool) {
+	language := utils.NormalizeLanguage(c.Param("language"))
+	if !utils.IsValidLanguage(language) || len(language) > 10 {
+		utils.ValidationError(c, "Invalid language")
+		return "", false
+	}
+	return language, true
+}
+
+// GetKnowledgeTranslations 获取知识的所有译文
+// @Summary 获取知识的译文列表
+// @Description 按语言返回知识的所有译文
+// @Tags knowledge
+// @Produce json
+// @Param id path int true "知识ID"
+// @Success 200 {object} utils.Response{data=[]models.KnowledgeTranslation}
+// @Failure 404 {object} utils.Response
+// @Router /knowledge/{id}/translations [get]
+func (h *KnowledgeHandler) GetKnowledgeTranslations(c *gin.Context) {
+	db := database.GetDatabase()
+
+	var knowledge models.Knowledge
+	if err := db.First(&knowledge, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Knowledge not found")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch knowledge")
+		return
+	}
+
+	translations := []models.KnowledgeTranslation{}
+	if err := db.Where("knowledge_id = ?", knowledge.ID).Order("language").Find(&translations).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch translations")
+		return
+	}
+
+	utils.SuccessResponse(c, translations)
+}
+
+// GetKnowledgeTranslation 获取知识指定语言的译文
+// @Summary 获取知识的译文
+// @Tags knowledge
+// @Produce json
+// @Param id path int true "知识ID"
+// @Param language path string true "语言标签，如 en、zh-cn"
+// @Success 200 {object} utils.Response{data=models.KnowledgeTranslation}
+// @Failure 404 {object} utils.Response
+// @Failure 422 {object} utils.Response
+// @Router /knowledge/{id}/translations/{language} [get]
+func (h *KnowledgeHandler) GetKnowledgeTranslation(c *gin.Context) {
+	language, ok := translationLanguage(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDatabase()
+	var knowledge models.Knowledge
+	if err := db.First(&knowledge, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Knowledge not found")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch knowledge")
+		return
+	}
+
+	var translation models.KnowledgeTranslation
+	if err := db.Where("knowledge_id = ? AND language = ?", knowledge.ID, language).First(&translation).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Translation not found")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch translation")
+		return
+	}
+
+	utils.SuccessResponse(c, translation)
+}
+
+// SaveKnowledgeTranslation 添加或更新知识指定语言的译文
+// @Summary 保存知识的译文
+// @Description 同一语言已有译文时覆盖，保存后异步为译文生成向量用于跨语言检索
+// @Tags knowledge
+// @Accept json
+// @Produce json
+// @Param id path int true "知识ID"
+// @Param language path string true "语言标签，如 en、zh-cn"
+// @Param request body KnowledgeTranslationRequest true "译文"
+// @Success 200 {object} utils.Response{data=models.KnowledgeTranslation}
+// @Failure 403 {object} utils.Response
+// @Failure 404 {object} utils.Response
+// @Failure 422 {object} utils.Response
+// @Router /knowledge/{id}/translations/{language} [put]
+func (h *KnowledgeHandler) SaveKnowledgeTranslation(c *gin.Context) {
+	language, ok := translationLanguage(c)
+	if !ok {
+		return
+	}
+
+	var req KnowledgeTranslationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	db := database.GetDatabase()
+	knowledge, ok := h.findModifiableKnowledge(c, db)
+	if !ok {
+		return
+	}
+	if utils.BaseLanguage(knowledge.Metadata.Language) == utils.BaseLanguage(language) {
+		utils.ValidationError(c, "Translation language must differ from the original language")
+		return
+	}
+
+	var translation models.KnowledgeTranslation
+	err := db.Where("knowledge_id = ? AND language = ?", knowledge.ID, language).First(&translation).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch translation")
+		return
+	}
+
+	translation.KnowledgeID = knowledge.ID
+	translation.Language = language
+	translation.Title = utils.CleanText(req.Title)
+	translation.Content = req.Content
+	translation.Summary = req.Summary
+	// 内容变化后旧向量失效，等待重新生成
+	translation.ContentVector = nil
+	if err := db.Save(&translation).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to save translation")
+		return
+	}
+
+	h.queueTranslationEmbedding(translation.ID, translation.Content)
+	h.invalidateAnswerCache()
+	utils.SuccessResponse(c, translation)
+}
+
+// DeleteKnowledgeTranslation 删除知识指定语言的译文
+// @Summary 删除知识的译文
+// @Tags knowledge
+// @Produce json
+// @Param id path int true "知识ID"
+// @Param language path string true "语言标签，如 en、zh-cn"
+// @Success 200 {object} utils.Response
+// @Failure 403 {object} utils.Response
+// @Failure 404 {object} utils.Response
+// @Router /knowledge/{id}/translations/{language} [delete]
+func (h *KnowledgeHandler) DeleteKnowledgeTranslation(c *gin.Context) {
+	language, ok := translationLanguage(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDatabase()
+	knowledge, ok := h.findModifiableKnowledge(c, db)
+	if !ok {
+		return
+	}
+
+	result := db.Where("knowledge_id = ? AND language = ?", knowledge.ID, language).Delete(&models.KnowledgeTranslation{})
+	if result.Error != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete translation")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.ErrorResponse(c, http.StatusNotFound, "Translation not found")
+		return
+	}
+
+	h.invalidateAnswerCache()
+	utils.SuccessResponse(c, gin.H{"message": "Translation deleted successfully"})
+}
+
+// findModifiableKnowledge 查找路径中的知识并检查修改权限，失败时写入错误响应并返回false
+func (h *KnowledgeHandler) findModifiableKnowledge(c *gin.Context, db *gorm.DB) (*models.Knowledge, bool) {
+	var knowledge models.Knowledge
+	if err := db.First(&knowledge, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Knowledge not found")
+			return nil, false
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch knowledge")
+		return nil, false
+	}
+	if !canModifyKnowledge(c, &knowledge) {
+		utils.ErrorResponse(c, http.StatusForbidden, "Only the author can modify this knowledge")
+		return nil, false
+	}
+	return &knowledge, true
+}
+
+// checkRequestedSlug 校验请求指定的slug格式与唯一性，失败时写入错误响应并返回false
+func checkRequestedSlug(c *gin.Context, db *gorm.DB, slug string, excludeID uint) bool {
+	if utils.Slugify(slug) != slug {
+		utils.ValidationError(c, "slug may only contain lowercase letters, digits and single hyphens")
+		return false
+	}
+	var count int64
+	query := db.Unscoped().Model(&models.Knowledge{}).Where("slug = ?", slug)
+	if excludeID != 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check slug")
+		return false
+	}
+	if count > 0 {
+		utils.ErrorResponse(c, http.StatusConflict, "Slug is already in use")
+		return false
+	}
+	return true
+}
+
+// currentUserID 返回当前认证用户的ID，未启用认证时为nil
+func currentUserID(c *gin.Context) *uint {
+	if userID, ok := middleware.GetNumericUserID(c); ok {
+		return &userID
+	}
+	return nil
+}
+
+// canModifyKnowledge 判断当前用户能否修改知识条目
+// 没有创建者的旧条目和未启用认证时不做限制
+func canModifyKnowledge(c *gin.Context, knowledge *models.Knowledge) bool {
+	if knowledge.CreatedBy == nil {
+		return true
+	}
+	if _, authenticated := middleware.GetUserID(c); !authenticated {
+		return true
+	}
+	userID, ok := middleware.GetNumericUserID(c)
+	return ok && userID == *knowledge.CreatedBy
+}
+
+// 关键词搜索模式
+const (
+	searchModeLike     = "like"     // LIKE子串匹配，按创建时间排序
+	searchModeFullText = "fulltext" // PostgreSQL全文检索，按相关度排序
+)
+
+// fullTextMatchExpr 全文检索匹配条件，plainto_tsquery将用户输入按普通文本处理，不解析查询语法
+var fullTextMatchExpr = fmt.Sprintf("knowledges.%s @@ plainto_tsquery('%s', ?)",
+	models.KnowledgeSearchVectorColumn, models.KnowledgeSearchConfig)
+
+// fullTextRankExpr 全文检索相关度排序
+var fullTextRankExpr = fmt.Sprintf("ts_rank(knowledges.%s, plainto_tsquery('%s', ?)) DESC, knowledges.created_at DESC",
+	models.KnowledgeSearchVectorColumn, models.KnowledgeSearchConfig)
+
+// SearchKnowledges 搜索知识
+// mode=fulltext时使用全文检索并按相关度排序，数据库不支持时回退到LIKE匹配
+func (h *KnowledgeHandler) SearchKnowledges(c *gin.Context) {
+	db := database.GetDatabase()
+
+	query := c.Query("q")
+	if query == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Search query is required")
+		return
+	}
+
+	mode := c.DefaultQuery("mode", searchModeLike)
+	if mode != searchModeLike && mode != searchModeFullText {
+		utils.ValidationError(c, "mode must be like or fulltext")
+		return
+	}
+	if mode == searchModeFullText && !models.SupportsKnowledgeFullTextSearch(db) {
+		mode = searchModeLike
+	}
+
+	// 解析分页参数
+	var pagination utils.PaginationRequest
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	h.limitPageSize(&pagination)
+
+	// 构建搜索查询
+	dbQuery := db.Model(&models.Knowledge{}).
+		Preload("Category").
+		Preload("Tags").
+		Where("is_published = ?", true)
+	order := clause.OrderBy{Columns: []clause.OrderByColumn{{Column: clause.Column{Name: "created_at"}, Desc: true}}}
+	if mode == searchModeFullText {
+		dbQuery = dbQuery.Where(fullTextMatchExpr, query)
+		order = clause.OrderBy{Expression: clause.Expr{SQL: fullTextRankExpr, Vars: []interface{}{query}, WithoutParentheses: true}}
+	} else {
+		searchTerm := "%" + strings.ToLower(query) + "%"
+		dbQuery = dbQuery.Where("LOWER(title) LIKE ? OR LOWER(content) LIKE ? OR LOWER(summary) LIKE ? OR LOWER(keywords) LIKE ?",
+			searchTerm, searchTerm, searchTerm, searchTerm)
+	}
+
+	// 获取总数
+	var total int64
+	if err := dbQuery.Count(&total).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to count search results")
+		return
+	}
+
+	// 分页查询
+	offset := utils.GetOffset(pagination.Page, pagination.PageSize)
+	var knowledges []models.Knowledge
+
+	if err := dbQuery.Clauses(order).Offset(offset).Limit(pagination.PageSize).Find(&knowledges).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to search knowledges")
+		return
+	}
+
+	// 构建响应
+	response := utils.PaginationResponse{
+		Items:      h.listItems(knowledges, query),
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: utils.CalculateTotalPages(total, pagination.PageSize),
+	}
+
+	utils.SuccessResponse(c, response)
+}
+
+// SemanticSearchRequest 语义搜索请求参数
+type SemanticSearchRequest struct {
+	utils.PaginationRequest
+	Q    string `form:"q" binding:"required,max=1000"`
+	Lang string `form:"lang"` // 结果优先使用的译文语言，默认按查询内容判断
+}
+
+// SemanticSearchResult 语义搜索结果，distance为向量L2距离，越小越相关
+type SemanticSearchResult struct {
+	models.Knowledge
+	Distance float64 `json:"distance"`
+}
+
+// SemanticSearchKnowledges 按语义相似度搜索已发布的知识，不调用LLM
+func (h *KnowledgeHandler) SemanticSearchKnowledges(c *gin.Context) {
+	var req SemanticSearchRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+	req.Q = strings.TrimSpace(req.Q)
+	if req.Q == "" {
+		utils.ValidationError(c, "Search query is required")
+		return
+	}
+
+	if h.vectorService == nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Semantic search is not available")
+		return
+	}
+
+	embedding, err := h.vectorService.GenerateEmbedding(c.Request.Context(), req.Q)
+	if err != nil {
+		logger.GetLogger().WithError(err).Error("Failed to generate query embedding for semantic search")
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to generate query embedding")
+		return
+	}
+
+	language := utils.NormalizeLanguage(req.Lang)
+	if language == "" {
+		language = utils.DetectLanguage(req.Q)
+	} else if !utils.IsValidLanguage(language) {
+		utils.ValidationError(c, "Invalid language")
+		return
+	}
+
+	db := database.GetDatabase()
+	// 在已生成向量的已发布知识的原文和译文中搜索，跳过更换向量模型前生成的维度不一致的向量
+	search := service.KnowledgeVectorSearch(db, embedding).
+		Having("MIN(distance) IS NOT NULL").
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := db.Table("(?) AS matched", search).Count(&total).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to count search results")
+		return
+	}
+
+	// 先按距离取出当前页的知识ID，再加载关联数据
+	var hits []service.KnowledgeVectorHit
+	offset := utils.GetOffset(req.Page, req.PageSize)
+	if err := search.Order("distance").
+		Offset(offset).
+		Limit(req.PageSize).
+		Scan(&hits).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to search knowledges")
+		return
+	}
+
+	results := make([]SemanticSearchResult, 0, len(hits))
+	if len(hits) > 0 {
+		ids := make([]uint, len(hits))
+		for i, hit := range hits {
+			ids[i] = hit.KnowledgeID
+		}
+		var knowledges []models.Knowledge
+		if err := db.Preload("Category").Preload("Tags").Where("id IN ?", ids).Find(&knowledges).Error; err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch knowledges")
+			return
+		}
+		// 有与查询语言相同的译文时返回译文
+		if err := service.LocalizeKnowledges(db, knowledges, language); err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch knowledge translations")
+			return
+		}
+		byID := make(map[uint]models.Knowledge, len(knowledges))
+		for _, k := range knowledges {
+			byID[k.ID] = k
+		}
+		for _, hit := range hits {
+			if k, ok := byID[hit.KnowledgeID]; ok && hit.Distance != nil {
+				results = append(results, SemanticSearchResult{Knowledge: k, Distance: *hit.Distance})
+			}
+		}
+	}
+
+	utils.SuccessResponse(c, utils.PaginationResponse{
+		Items:      results,
+		Total:      total,
+		Page:       req.Page,
+		PageSize:   req.PageSize,
+		TotalPages: utils.CalculateTotalPages(total, req.PageSize),
+	})
+}
+
+// GetRelatedKnowledges 获取相关知识
+func (h *KnowledgeHandler) GetRelatedKnowledges(c *gin.Context) {
+	db := database.GetDatabase()
+	id := c.Param("id")
+
+	limit, err := h.parseRelatedLimit(c)
+	if err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	var knowledge models.Knowledge
+	if err := db.First(&knowledge, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Knowledge not found")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch knowledge")
+		return
+	}
+
+	// 基于分类和标签查找相关知识
+	var relatedKnowledges []models.Knowledge
+
+	// 同分类的知识
+	db.Preload("Category").Preload("Tags").
+		Where("category_id = ? AND id != ? AND is_published = ?",
+			knowledge.CategoryID, knowledge.ID, true).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&relatedKnowledges)
+
+	// 如果同分类的知识不够，添加同标签的知识
+	if len(relatedKnowledges) < limit {
+		var tagIDs []uint
+		for _, tag := range knowledge.Tags {
+			tagIDs = append(tagIDs, tag.ID)
+		}
+
+		if len(tagIDs) > 0 {
+			var tagKnowledges []models.Knowledge
+			db.Table("knowledges").
+				Select("knowledges.*").
+				Joins("INNER JOIN knowledge_tags ON knowledges.id = knowledge_tags.knowledge_id").
+				Where("knowledge_tags.tag_id IN ? AND knowledges.id != ? AND knowledges.id NOT IN (?) AND knowledges.is_published = ?",
+					tagIDs, knowledge.ID,
+					func() []uint {
+						existingIDs := []uint{knowledge.ID}
+						for _, k := range relatedKnowledges {
+							existingIDs = append(existingIDs, k.ID)
+						}
+						return existingIDs
+					}(), true).
+				Order("created_at DESC").
+				Limit(limit - len(relatedKnowledges)).
 				Scan(&tagKnowledges)
 
 			relatedKnowledges = append(relatedKnowledges, tagKnowledges...)
@@ -537,6 +1700,142 @@ func (h *KnowledgeHandler) IncrementViewCount(c *gin.Context) {
 	utils.SuccessResponse(c, gin.H{"view_count": knowledge.ViewCount + 1})
 }
 
+// SummarizeDocumentRequest 文档生成知识请求
+type SummarizeDocumentRequest struct {
+	IsPublished bool `json:"is_published"`
+}
+
+// CreateFromDocument 使用LLM为已处理的文档生成一条知识条目
+// @Summary 文档自动生成知识
+// @Description 为已解析的文档生成标题、摘要及建议的标签/分类，创建一条知识条目并异步生成向量
+// @Tags knowledge
+// @Accept json
+// @Produce json
+// @Param id path int true "文档ID"
+// @Param request body SummarizeDocumentRequest false "生成选项"
+// @Success 200 {object} models.Knowledge
+// @Failure 404 {object} utils.Response
+// @Failure 409 {object} utils.Response
+// @Failure 422 {object} utils.Response
+// @Failure 503 {object} utils.Response
+// @Router /documents/{id}/summarize [post]
+func (h *KnowledgeHandler) CreateFromDocument(c *gin.Context) {
+	if h.aiService == nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "AI service is not configured")
+		return
+	}
+
+	db := database.GetDatabase()
+
+	var req SummarizeDocumentRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ValidationError(c, err.Error())
+			return
+		}
+	}
+
+	var doc models.Document
+	if err := db.First(&doc, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Document not found")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch document")
+		return
+	}
+
+	// 每个文档只生成一条知识
+	if doc.KnowledgeID != nil {
+		utils.ErrorResponse(c, http.StatusConflict, fmt.Sprintf("Document already converted to knowledge %d", *doc.KnowledgeID))
+		return
+	}
+
+	text := doc.CleanedText
+	if text == "" {
+		text = doc.RawText
+	}
+	if strings.TrimSpace(text) == "" {
+		utils.ErrorResponse(c, http.StatusUnprocessableEntity, "Document has not been processed yet")
+		return
+	}
+
+	summary, err := h.aiService.SummarizeDocument(c.Request.Context(), text)
+	if err != nil {
+		logger.GetLogger().WithError(err).WithField("document_id", doc.ID).Error("Document summarization failed")
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Document summarization failed: "+err.Error())
+		return
+	}
+
+	// 建议的分类仅在已存在同名分类时使用
+	var categoryID uint
+	if summary.Category != "" {
+		var category models.Category
+		if err := db.Where("LOWER(name) = LOWER(?)", summary.Category).First(&category).Error; err == nil {
+			categoryID = category.ID
+		}
+	}
+
+	knowledge := models.Knowledge{
+		Title:       utils.TruncateText(utils.CleanText(summary.Title), 252),
+		Content:     utils.CleanText(text),
+		Summary:     utils.CleanText(summary.Summary),
+		CategoryID:  categoryID,
+		IsPublished: req.IsPublished,
+		Metadata: models.Metadata{
+			Source:   doc.OriginalName,
+			Keywords: strings.Join(summary.Tags, ","),
+		},
+		CreatedBy: currentUserID(c),
+	}
+	if knowledge.Summary == "" {
+		knowledge.Summary = utils.TruncateText(knowledge.Content, 200)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&knowledge).Error; err != nil {
+			return err
+		}
+		// 条件更新避免并发请求重复生成
+		result := tx.Model(&models.Document{}).
+			Where("id = ? AND knowledge_id IS NULL", doc.ID).
+			Update("knowledge_id", knowledge.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errDocumentAlreadyConverted
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errDocumentAlreadyConverted) {
+			utils.ErrorResponse(c, http.StatusConflict, "Document already converted to knowledge")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("Failed to create knowledge: %v", err))
+		return
+	}
+
+	if len(summary.Tags) > 0 {
+		if err := h.attachTags(&knowledge, summary.Tags); err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("Failed to attach tags: %v", err))
+			return
+		}
+	}
+
+	h.invalidateAnswerCache()
+
+	// 异步生成向量
+	h.queueEmbedding(knowledge.ID, knowledge.Content)
+
+	db.Preload("Category").Preload("Tags").First(&knowledge, knowledge.ID)
+	utils.SuccessResponse(c, knowledge)
+}
+
+// errDocumentAlreadyConverted 文档已生成过知识
+var errDocumentAlreadyConverted = errors.New("document already converted to knowledge")
+
 // attachTags 为知识附加标签
 func (h *KnowledgeHandler) attachTags(knowledge *models.Knowledge, tagNames []string) error {
 	db := database.GetDatabase()
@@ -569,15 +1868,281 @@ func (h *KnowledgeHandler) attachTags(knowledge *models.Knowledge, tagNames []st
 	}
 
 	// 关联标签
-	return db.Model(knowledge).Association("Tags").Append(&tags)
+	if err := db.Model(knowledge).Association("Tags").Append(&tags); err != nil {
+		return err
+	}
+	return syncTagUsage(db, tagIDs(tags))
 }
 
-// generateRandomColor 生成随机颜色
+// tagIDs 提取标签ID
+func tagIDs(tags []models.Tag) []uint {
+	ids := make([]uint, 0, len(tags))
+	for _, tag := range tags {
+		ids = append(ids, tag.ID)
+	}
+	return ids
+}
+
+// syncTagUsage 按关联的未删除知识数重新计算标签的使用次数
+func syncTagUsage(db *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Model(&models.Tag{}).Where("id IN ?", ids).
+		UpdateColumn("usage_count", gorm.Expr(`(SELECT COUNT(*) FROM knowledge_tags
+			JOIN knowledges ON knowledges.id = knowledge_tags.knowledge_id
+			WHERE knowledge_tags.tag_id = tags.id AND knowledges.deleted_at IS NULL)`)).Error
+}
+
+// tagColors 未指定颜色时为标签分配的调色板
+var tagColors = []string{
+	"#ff6b6b", "#4ecdc4", "#45b7d1", "#f9ca24", "#6c5ce7",
+	"#a29bfe", "#fd79a8", "#fdcb6e", "#e17055", "#00b894",
+	"#00cec9", "#0984e3", "#74b9ff", "#dfe6e9",
+}
+
+// generateRandomColor 从调色板中随机选取颜色
 func generateRandomColor() string {
-	colors := []string{
-		"#ff6b6b", "#4ecdc4", "#45b7d1", "#f9ca24", "#6c5ce7",
-		"#a29bfe", "#fd79a8", "#fdcb6e", "#e17055", "#00b894",
-		"#00cec9", "#0984e3", "#74b9ff", "#a29bfe", "#dfe6e9",
+	return tagColors[rand.Intn(len(tagColors))]
+}
+
+// queueEmbedding 异步生成并保存知识的向量，失败不影响知识本身
+// 任务只引用传入的ID和内容，调用方之后修改knowledge对象不会影响生成的向量
+func (h *KnowledgeHandler) queueEmbedding(knowledgeID uint, content string) {
+	if h.vectorService == nil {
+		return
+	}
+
+	if reason := h.embeddingSkipReason(content); reason != "" {
+		if err := skipEmbedding(database.GetDatabase(), knowledgeID, reason); err != nil {
+			logger.GetLogger().WithError(err).WithField("knowledge_id", knowledgeID).Warn("Failed to record skipped embedding")
+		}
+		return
+	}
+
+	background.Submit("knowledge_embedding", func(ctx context.Context) error {
+		embedding, err := h.vectorService.GenerateEmbedding(ctx, content)
+		if err != nil {
+			// 向量生成失败，不影响知识保存，只记录日志
+			logEmbeddingError(knowledgeID, err)
+			return nil
+		}
+		db := database.GetDatabase()
+		if err := saveEmbedding(db, knowledgeID, &embedding); err != nil {
+			return fmt.Errorf("failed to save embedding for knowledge %d: %w", knowledgeID, err)
+		}
+		// 新向量会改变检索结果
+		h.invalidateAnswerCache()
+		return nil
+	})
+}
+
+// queueTranslationEmbedding 异步生成并保存译文的向量，失败时可通过批量重建向量补生成
+func (h *KnowledgeHandler) queueTranslationEmbedding(translationID uint, content string) {
+	if h.vectorService == nil {
+		return
+	}
+
+	background.Submit("knowledge_translation_embedding", func(ctx context.Context) error {
+		embedding, err := h.vectorService.GenerateEmbedding(ctx, content)
+		if err != nil {
+			logger.GetLogger().WithError(err).WithField("translation_id", translationID).Warn("Failed to generate translation embedding")
+			return nil
+		}
+		db := database.GetDatabase()
+		if err := db.Model(&models.KnowledgeTranslation{}).Where("id = ?", translationID).Update("content_vector", &embedding).Error; err != nil {
+			return fmt.Errorf("failed to save embedding for translation %d: %w", translationID, err)
+		}
+		h.invalidateAnswerCache()
+		return nil
+	})
+}
+
+// invalidateAnswerCache 知识变更后使AI回答缓存失效
+func (h *KnowledgeHandler) invalidateAnswerCache() {
+	if h.aiService != nil {
+		h.aiService.InvalidateAnswerCache()
+	}
+}
+
+// logEmbeddingError 记录向量生成失败，包含重试次数等上下文
+func logEmbeddingError(knowledgeID uint, err error) {
+	fields := logrus.Fields{"knowledge_id": knowledgeID}
+
+	var embeddingErr *service.EmbeddingError
+	if errors.As(err, &embeddingErr) {
+		fields["attempts"] = embeddingErr.Attempts
+		fields["empty_result"] = errors.Is(err, service.ErrEmptyEmbedding)
+	}
+
+	logger.GetLogger().WithError(err).WithFields(fields).Warn("Failed to generate embedding")
+}
+
+// maxAutoTagCandidates 限定已有标签时，提供给LLM的候选标签数量上限（按使用次数排序）
+const maxAutoTagCandidates = 200
+
+// BulkAutoTagRequest 批量自动打标签请求
+type BulkAutoTagRequest struct {
+	IDs []uint `json:"ids" binding:"required,min=1,max=100,dive,min=1"`
+}
+
+// AutoTagKnowledge 为知识重新自动打标签
+// @Summary 自动打标签
+// @Description 使用LLM根据内容推荐标签并附加到知识，保留已有标签
+// @Tags knowledge
+// @Produce json
+// @Param id path int true "知识ID"
+// @Success 200 {object} utils.Response
+// @Failure 403 {object} utils.Response
+// @Failure 404 {object} utils.Response
+// @Failure 503 {object} utils.Response
+// @Router /knowledge/{id}/auto-tag [post]
+func (h *KnowledgeHandler) AutoTagKnowledge(c *gin.Context) {
+	if h.aiService == nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "AI service is not configured")
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid knowledge ID")
+		return
+	}
+	if _, ok := h.findModifiableKnowledge(c, database.GetDatabase()); !ok {
+		return
+	}
+
+	added, err := h.autoTagKnowledge(c.Request.Context(), uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Knowledge not found")
+			return
+		}
+		// 上游模型的错误信息只记录日志，不返回给客户端
+		logger.GetLogger().WithError(err).WithField("knowledge_id", id).Error("Auto-tagging failed")
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Auto-tagging failed")
+		return
+	}
+
+	var knowledge models.Knowledge
+	database.GetDatabase().Preload("Category").Preload("Tags").First(&knowledge, id)
+
+	utils.SuccessResponse(c, gin.H{
+		"knowledge":  knowledge,
+		"added_tags": added,
+	})
+}
+
+// BulkAutoTagKnowledges 批量重新自动打标签
+// @Summary 批量自动打标签
+// @Description 为指定的知识排队执行自动打标签（异步）
+// @Tags knowledge
+// @Accept json
+// @Produce json
+// @Param request body BulkAutoTagRequest true "知识ID列表"
+// @Success 200 {object} utils.Response
+// @Failure 422 {object} utils.Response
+// @Failure 503 {object} utils.Response
+// @Router /knowledge/auto-tag [post]
+func (h *KnowledgeHandler) BulkAutoTagKnowledges(c *gin.Context) {
+	if h.aiService == nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "AI service is not configured")
+		return
+	}
+
+	var req BulkAutoTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	for _, id := range req.IDs {
+		h.queueAutoTag(id)
+	}
+
+	utils.SuccessResponse(c, gin.H{"queued": len(req.IDs)})
+}
+
+// queueAutoTag 异步为知识自动打标签，失败只记录日志
+func (h *KnowledgeHandler) queueAutoTag(knowledgeID uint) {
+	if h.aiService == nil {
+		return
+	}
+
+	background.Submit("knowledge_auto_tag", func(ctx context.Context) error {
+		if _, err := h.autoTagKnowledge(ctx, knowledgeID); err != nil {
+			return fmt.Errorf("failed to auto-tag knowledge %d: %w", knowledgeID, err)
+		}
+		return nil
+	})
+}
+
+// autoTagKnowledge 使用LLM推荐标签并附加到知识（保留已有标签），返回新附加的标签名
+func (h *KnowledgeHandler) autoTagKnowledge(ctx context.Context, knowledgeID uint) ([]string, error) {
+	db := database.GetDatabase()
+
+	var knowledge models.Knowledge
+	if err := db.Preload("Tags").First(&knowledge, knowledgeID).Error; err != nil {
+		return nil, err
+	}
+
+	// 限定已有标签时只把已有标签作为候选
+	var allowed []string
+	if h.autoTag.ExistingOnly {
+		if err := db.Model(&models.Tag{}).Order("usage_count DESC, name ASC").
+			Limit(maxAutoTagCandidates).Pluck("name", &allowed).Error; err != nil {
+			return nil, err
+		}
+		if len(allowed) == 0 {
+			return nil, nil
+		}
+	}
+
+	suggested, err := h.aiService.SuggestTags(ctx, knowledge.Content, allowed)
+	if err != nil {
+		return nil, err
+	}
+	if len(suggested) == 0 {
+		return nil, nil
+	}
+
+	// 与已有标签大小写不同的建议沿用已有标签的写法，避免产生重复标签
+	lowered := make([]string, 0, len(suggested))
+	for _, name := range suggested {
+		lowered = append(lowered, strings.ToLower(name))
+	}
+	var existingNames []string
+	if err := db.Model(&models.Tag{}).Where("LOWER(name) IN ?", lowered).Pluck("name", &existingNames).Error; err != nil {
+		return nil, err
+	}
+	canonical := make(map[string]string, len(existingNames))
+	for _, name := range existingNames {
+		canonical[strings.ToLower(name)] = name
+	}
+
+	attached := make(map[string]bool, len(knowledge.Tags))
+	for _, tag := range knowledge.Tags {
+		attached[strings.ToLower(tag.Name)] = true
+	}
+
+	var added []string
+	for _, name := range suggested {
+		key := strings.ToLower(name)
+		if attached[key] {
+			continue
+		}
+		if existing, ok := canonical[key]; ok {
+			name = existing
+		}
+		attached[key] = true
+		added = append(added, name)
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	if err := h.attachTags(&knowledge, added); err != nil {
+		return nil, err
 	}
-	return colors[len(colors)%len(colors)]
+	return added, nil
 }
@@ -0,0 +1,1423 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/ai"
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/middleware"
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pgvector/pgvector-go"
+)
+
+func performSummarize(handler *KnowledgeHandler, docID uint) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/documents/:id/summarize", handler.CreateFromDocument)
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/documents/%d/summarize", docID), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCreateFromDocument(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	category := models.Category{Name: "Programming"}
+	db.Create(&category)
+
+	doc := models.Document{Name: "guide", OriginalName: "guide.txt", CleanedText: "Go is an open source programming language."}
+	db.Create(&doc)
+
+	mock := &mockAIService{summary: &ai.DocumentSummary{
+		Title:    "Go语言简介",
+		Summary:  "介绍Go语言",
+		Tags:     []string{"go", "language"},
+		Category: "programming",
+	}}
+	handler := NewKnowledgeHandler(nil)
+	handler.SetAIService(mock)
+
+	w := performSummarize(handler, doc.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data models.Knowledge `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	knowledge := resp.Data
+	if knowledge.Title != "Go语言简介" || knowledge.Summary != "介绍Go语言" {
+		t.Errorf("Unexpected knowledge title/summary: %q / %q", knowledge.Title, knowledge.Summary)
+	}
+	if knowledge.Content != doc.CleanedText {
+		t.Errorf("Expected document text as content, got %q", knowledge.Content)
+	}
+	if knowledge.CategoryID != category.ID {
+		t.Errorf("Expected suggested category to match existing category %d, got %d", category.ID, knowledge.CategoryID)
+	}
+	if len(knowledge.Tags) != 2 {
+		t.Errorf("Expected 2 tags, got %d", len(knowledge.Tags))
+	}
+	if knowledge.Metadata.Source != "guide.txt" {
+		t.Errorf("Expected source to be the document name, got %q", knowledge.Metadata.Source)
+	}
+
+	var updated models.Document
+	db.First(&updated, doc.ID)
+	if updated.KnowledgeID == nil || *updated.KnowledgeID != knowledge.ID {
+		t.Errorf("Expected document to reference knowledge %d, got %v", knowledge.ID, updated.KnowledgeID)
+	}
+
+	// 同一文档不能重复生成
+	if w := performSummarize(handler, doc.ID); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 on second conversion, got %d", w.Code)
+	}
+}
+
+func TestCreateFromDocumentUnknownCategory(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	doc := models.Document{Name: "notes", RawText: "some raw notes"}
+	db.Create(&doc)
+
+	handler := NewKnowledgeHandler(nil)
+	handler.SetAIService(&mockAIService{summary: &ai.DocumentSummary{Title: "Notes", Category: "Nonexistent"}})
+
+	w := performSummarize(handler, doc.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var knowledge models.Knowledge
+	db.First(&knowledge)
+	if knowledge.CategoryID != 0 {
+		t.Errorf("Expected no category for unknown suggestion, got %d", knowledge.CategoryID)
+	}
+	if knowledge.Summary == "" {
+		t.Error("Expected summary to fall back to truncated content")
+	}
+}
+
+func TestCreateFromDocumentErrors(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	unprocessed := models.Document{Name: "empty"}
+	db.Create(&unprocessed)
+
+	mock := &mockAIService{summary: &ai.DocumentSummary{Title: "x"}}
+	handler := NewKnowledgeHandler(nil)
+	handler.SetAIService(mock)
+
+	if w := performSummarize(handler, unprocessed.ID); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for unprocessed document, got %d", w.Code)
+	}
+	if w := performSummarize(handler, 9999); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for missing document, got %d", w.Code)
+	}
+	if mock.calls != 0 {
+		t.Errorf("AI service should not be called for invalid documents, got %d calls", mock.calls)
+	}
+
+	if w := performSummarize(NewKnowledgeHandler(nil), unprocessed.ID); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without AI service, got %d", w.Code)
+	}
+}
+
+func TestGetKnowledgesStablePagination(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	// 所有记录的排序字段取值相同，分页依赖id次级排序保持稳定
+	for i := 0; i < 25; i++ {
+		db.Create(&models.Knowledge{Title: fmt.Sprintf("knowledge-%d", i), Content: "content", ViewCount: 7})
+	}
+
+	handler := NewKnowledgeHandler(nil)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/knowledge", handler.GetKnowledges)
+
+	seen := make(map[uint]bool)
+	var lastID uint
+	for page := 1; page <= 3; page++ {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/knowledge?sort=view_count&order=asc&page=%d&page_size=10", page), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp struct {
+			Data struct {
+				Items []models.Knowledge `json:"items"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+
+		for _, k := range resp.Data.Items {
+			if seen[k.ID] {
+				t.Errorf("Knowledge %d returned on more than one page", k.ID)
+			}
+			if k.ID < lastID {
+				t.Errorf("Expected ids in ascending order, got %d after %d", k.ID, lastID)
+			}
+			seen[k.ID] = true
+			lastID = k.ID
+		}
+	}
+
+	if len(seen) != 25 {
+		t.Errorf("Expected 25 distinct knowledges across pages, got %d", len(seen))
+	}
+}
+
+func TestGetKnowledgesRejectsUnknownSort(t *testing.T) {
+	setupTestDatabase(t)
+
+	handler := NewKnowledgeHandler(nil)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/knowledge", handler.GetKnowledges)
+
+	req := httptest.NewRequest(http.MethodGet, "/knowledge?sort=content", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", w.Code)
+	}
+}
+
+func TestSetDefaultOrder(t *testing.T) {
+	handler := NewKnowledgeHandler(nil)
+	if err := handler.SetDefaultOrder("title", "asc"); err != nil {
+		t.Errorf("Expected valid default order, got %v", err)
+	}
+	if err := handler.SetDefaultOrder("password", "asc"); err == nil {
+		t.Error("Expected error for sort field outside the allowlist")
+	}
+	if err := handler.SetDefaultOrder("title", "sideways"); err == nil {
+		t.Error("Expected error for invalid sort order")
+	}
+	if handler.defaultSort != "title" || handler.defaultOrder != "asc" {
+		t.Errorf("Expected rejected values to keep previous default, got %s %s", handler.defaultSort, handler.defaultOrder)
+	}
+}
+
+func TestGetKnowledgesSnippets(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	content := strings.Repeat("前言 ", 50) + "关于<Go>并发的说明 " + strings.Repeat("结尾 ", 50)
+	for i := 0; i < 3; i++ {
+		db.Create(&models.Knowledge{Title: fmt.Sprintf("knowledge-%d", i), Content: content})
+	}
+
+	gin.SetMode(gin.TestMode)
+	list := func(handler *KnowledgeHandler, query string) []map[string]interface{} {
+		r := gin.New()
+		r.GET("/knowledge", handler.GetKnowledges)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/knowledge?"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data struct {
+				Items    []map[string]interface{} `json:"items"`
+				PageSize int                      `json:"page_size"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp.Data.Items
+	}
+
+	handler := NewKnowledgeHandler(nil)
+	handler.SetSearchOptions(2, 20)
+	items := list(handler, "search=Go&page_size=10")
+	if len(items) != 2 {
+		t.Fatalf("Expected page size capped at 2, got %d items", len(items))
+	}
+	if _, ok := items[0]["content"]; ok {
+		t.Error("Expected full content to be omitted from list items")
+	}
+	snippet, _ := items[0]["snippet"].(string)
+	if !strings.Contains(snippet, "&lt;<mark>Go</mark>&gt;") {
+		t.Errorf("Expected escaped snippet with highlighted term, got %q", snippet)
+	}
+
+	// 摘要长度为0时返回完整内容
+	handler.SetSearchOptions(100, 0)
+	items = list(handler, "")
+	if len(items) != 3 || items[0]["content"] != content {
+		t.Errorf("Expected full content when snippets are disabled, got %v", items)
+	}
+}
+
+func TestGetRelatedKnowledgesLimit(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	category := models.Category{Name: "Go"}
+	db.Create(&category)
+	var source models.Knowledge
+	for i := 0; i < 6; i++ {
+		k := models.Knowledge{Title: fmt.Sprintf("knowledge-%d", i), Content: "content", CategoryID: category.ID}
+		db.Create(&k)
+		if i == 0 {
+			source = k
+		}
+	}
+
+	handler := NewKnowledgeHandler(nil)
+	if err := handler.SetRelatedLimits(2, 4); err != nil {
+		t.Fatalf("SetRelatedLimits failed: %v", err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/knowledge/:id/related", handler.GetRelatedKnowledges)
+
+	related := func(query string) (int, int) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/knowledge/%d/related%s", source.ID, query), nil))
+		var resp struct {
+			Data []models.Knowledge `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, len(resp.Data)
+	}
+
+	if code, n := related(""); code != http.StatusOK || n != 2 {
+		t.Errorf("Expected default limit of 2, got status %d with %d items", code, n)
+	}
+	if code, n := related("?limit=4"); code != http.StatusOK || n != 4 {
+		t.Errorf("Expected 4 items, got status %d with %d items", code, n)
+	}
+	// 超出上限或非法的limit返回错误，而不是回退到默认值
+	for _, query := range []string{"?limit=5", "?limit=0", "?limit=abc"} {
+		if code, _ := related(query); code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", query, code)
+		}
+	}
+
+	if err := handler.SetRelatedLimits(5, 4); err == nil {
+		t.Error("Expected error when default exceeds max")
+	}
+}
+
+func TestDeleteKnowledgeInvalidatesAnswerCache(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	knowledge := models.Knowledge{Title: "Go", Content: "Go is a language"}
+	db.Create(&knowledge)
+
+	mock := &mockAIService{}
+	handler := NewKnowledgeHandler(nil)
+	handler.SetAIService(mock)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.DELETE("/knowledge/:id", handler.DeleteKnowledge)
+
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/knowledge/%d", knowledge.ID), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if mock.invalidations != 1 {
+		t.Errorf("Expected answer cache to be invalidated once, got %d", mock.invalidations)
+	}
+}
+
+func TestGetKnowledgesTrendingSort(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	now := time.Now()
+	old := models.Knowledge{Title: "old classic", Content: "c", ViewCount: 100, CreatedAt: now.AddDate(0, 0, -30)}
+	fresh := models.Knowledge{Title: "fresh hit", Content: "c", ViewCount: 20, CreatedAt: now.Add(-2 * time.Hour)}
+	quiet := models.Knowledge{Title: "fresh quiet", Content: "c", ViewCount: 0, CreatedAt: now.Add(-1 * time.Hour)}
+	db.Create(&old)
+	db.Create(&fresh)
+	db.Create(&quiet)
+
+	handler := NewKnowledgeHandler(nil)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/knowledge", handler.GetKnowledges)
+
+	req := httptest.NewRequest(http.MethodGet, "/knowledge?sort=trending", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Items []models.Knowledge `json:"items"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	var titles []string
+	for _, k := range resp.Data.Items {
+		titles = append(titles, k.Title)
+	}
+	// 新近且热门的排在最前，旧的高浏览量条目因时间衰减排在后面
+	expected := []string{"fresh hit", "fresh quiet", "old classic"}
+	if fmt.Sprint(titles) != fmt.Sprint(expected) {
+		t.Errorf("Expected trending order %v, got %v", expected, titles)
+	}
+}
+
+func performAutoTag(handler *KnowledgeHandler, id uint) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/knowledge/:id/auto-tag", handler.AutoTagKnowledge)
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/knowledge/%d/auto-tag", id), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAutoTagKnowledge(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	existing := models.Tag{Name: "Go"}
+	db.Create(&existing)
+	knowledge := models.Knowledge{Title: "goroutines", Content: "Go concurrency with goroutines"}
+	db.Create(&knowledge)
+
+	mock := &mockAIService{tags: []string{"go", "Concurrency"}}
+	handler := NewKnowledgeHandler(nil)
+	handler.SetAIService(mock)
+	if err := handler.attachTags(&knowledge, []string{"Go"}); err != nil {
+		t.Fatalf("Failed to attach tag: %v", err)
+	}
+
+	w := performAutoTag(handler, knowledge.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Knowledge models.Knowledge `json:"knowledge"`
+			AddedTags []string         `json:"added_tags"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	// "go"与已附加的"Go"相同，不重复添加
+	if len(resp.Data.AddedTags) != 1 || resp.Data.AddedTags[0] != "Concurrency" {
+		t.Errorf("Expected only Concurrency to be added, got %v", resp.Data.AddedTags)
+	}
+	if len(resp.Data.Knowledge.Tags) != 2 {
+		t.Errorf("Expected knowledge to keep existing tag and gain the new one, got %v", resp.Data.Knowledge.Tags)
+	}
+
+	var tags []models.Tag
+	db.Order("name").Find(&tags)
+	if len(tags) != 2 {
+		t.Fatalf("Expected 2 tags without case duplicates, got %d", len(tags))
+	}
+	for _, tag := range tags {
+		if tag.UsageCount != 1 {
+			t.Errorf("Expected tag %s usage_count 1, got %d", tag.Name, tag.UsageCount)
+		}
+	}
+}
+
+func TestAutoTagKnowledgeExistingOnly(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	db.Create(&models.Tag{Name: "Go"})
+	db.Create(&models.Tag{Name: "Web"})
+	knowledge := models.Knowledge{Title: "http", Content: "net/http server"}
+	db.Create(&knowledge)
+
+	mock := &mockAIService{tags: []string{"Web"}}
+	handler := NewKnowledgeHandler(nil)
+	handler.SetAIService(mock)
+	handler.SetAutoTagConfig(config.AutoTagConfig{ExistingOnly: true})
+
+	if w := performAutoTag(handler, knowledge.ID); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(mock.lastAllowed) != 2 {
+		t.Errorf("Expected existing tags as candidates, got %v", mock.lastAllowed)
+	}
+}
+
+func TestAutoTagKnowledgeErrors(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	handler := NewKnowledgeHandler(nil)
+	if w := performAutoTag(handler, 1); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without AI service, got %d", w.Code)
+	}
+
+	handler.SetAIService(&mockAIService{})
+	if w := performAutoTag(handler, 9999); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for missing knowledge, got %d", w.Code)
+	}
+
+	// 模型服务的错误信息不返回给客户端
+	knowledge := models.Knowledge{Title: "t", Content: "c"}
+	db.Create(&knowledge)
+	handler.SetAIService(&mockAIService{err: errors.New("upstream: invalid api key sk-123")})
+	w := performAutoTag(handler, knowledge.ID)
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "sk-123") {
+		t.Errorf("Expected status 500 without upstream error text, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTagUsageCountFollowsKnowledgeDeletion(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	handler := NewKnowledgeHandler(nil)
+	first := models.Knowledge{Title: "a", Content: "a"}
+	second := models.Knowledge{Title: "b", Content: "b"}
+	db.Create(&first)
+	db.Create(&second)
+	handler.attachTags(&first, []string{"shared"})
+	handler.attachTags(&second, []string{"shared"})
+
+	var tag models.Tag
+	db.Where("name = ?", "shared").First(&tag)
+	if tag.UsageCount != 2 {
+		t.Fatalf("Expected usage_count 2, got %d", tag.UsageCount)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.DELETE("/knowledge/:id", handler.DeleteKnowledge)
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/knowledge/%d", first.ID), nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	db.First(&tag, tag.ID)
+	if tag.UsageCount != 1 {
+		t.Errorf("Expected usage_count 1 after deleting a knowledge, got %d", tag.UsageCount)
+	}
+}
+
+func TestSearchKnowledgesModes(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	db.Create(&models.Knowledge{Title: "Go并发", Content: "goroutine与channel"})
+	db.Create(&models.Knowledge{Title: "其他", Content: "无关内容", Metadata: models.Metadata{Keywords: "Goroutine"}})
+	db.Create(&models.Knowledge{Title: "数据库", Content: "索引"})
+
+	handler := NewKnowledgeHandler(nil)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/knowledge/search", handler.SearchKnowledges)
+
+	search := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/knowledge/search?"+query, nil))
+		return w
+	}
+
+	// SQLite不支持全文检索，fulltext回退到LIKE匹配，结果与like一致
+	for _, mode := range []string{"", "&mode=like", "&mode=fulltext"} {
+		w := search("q=GOROUTINE" + mode)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %q, got %d: %s", mode, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data struct {
+				Total int64 `json:"total"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if resp.Data.Total != 2 {
+			t.Errorf("Expected 2 matches for %q, got %d", mode, resp.Data.Total)
+		}
+	}
+
+	if w := search("q=go&mode=regex"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for unknown mode, got %d", w.Code)
+	}
+	if models.SupportsKnowledgeFullTextSearch(db) {
+		t.Error("Expected full-text search to be unsupported on SQLite")
+	}
+	if err := models.EnsureKnowledgeSearchIndex(db); err != nil {
+		t.Errorf("Expected index creation to be skipped on SQLite, got %v", err)
+	}
+}
+
+func TestBatchCreateTags(t *testing.T) {
+	db := setupTestDatabase(t)
+	existing := models.Tag{Name: "Go", Color: "#000000"}
+	db.Create(&existing)
+
+	handler := NewTagHandler()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/tags/batch", handler.BatchCreateTags)
+
+	perform := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/tags/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := perform(`{"tags":[{"name":"Go"},{"name":"Rust"},{"name":"Python","color":"#123456"},{"name":"Rust"},{"name":"Java"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data BatchCreateTagsResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	created := map[string]string{}
+	for _, tag := range resp.Data.Created {
+		if tag.ID == 0 {
+			t.Errorf("Expected created tag %q to have an ID", tag.Name)
+		}
+		created[tag.Name] = tag.Color
+	}
+	if len(created) != 3 || created["Python"] != "#123456" {
+		t.Errorf("Unexpected created tags: %+v", resp.Data.Created)
+	}
+	// 自动分配的颜色在同一批中各不相同
+	if created["Rust"] == "" || created["Rust"] == created["Java"] {
+		t.Errorf("Expected distinct auto-assigned colors, got %v", created)
+	}
+
+	skipped := resp.Data.Skipped
+	if len(skipped) != 2 || skipped[0].Name != "Go" || skipped[0].Reason != "exists" || skipped[0].TagID != existing.ID ||
+		skipped[1].Name != "Rust" || skipped[1].Reason != "duplicate" {
+		t.Errorf("Unexpected skipped tags: %+v", skipped)
+	}
+
+	var count int64
+	db.Model(&models.Tag{}).Count(&count)
+	if count != 4 {
+		t.Errorf("Expected 4 tags in total, got %d", count)
+	}
+
+	for _, body := range []string{`{"tags":[]}`, `{"tags":[{"name":""}]}`, `{"tags":[{"name":"x","color":"red"}]}`} {
+		if w := perform(body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestGetUnusedTagsAndCategories(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	// 标签：被知识引用、仅有使用次数、完全未使用
+	knowledgeHandler := NewKnowledgeHandler(nil)
+	knowledge := models.Knowledge{Title: "a", Content: "a"}
+	db.Create(&knowledge)
+	knowledgeHandler.attachTags(&knowledge, []string{"used"})
+	counted := models.Tag{Name: "counted"}
+	db.Create(&counted)
+	db.Model(&counted).Update("usage_count", 1)
+	db.Create(&models.Tag{Name: "unused-b"})
+	db.Create(&models.Tag{Name: "unused-a"})
+
+	// 分类：有知识、有子分类、子分类本身、只有已删除的知识
+	withKnowledge := models.Category{Name: "with-knowledge"}
+	parent := models.Category{Name: "parent"}
+	deletedOnly := models.Category{Name: "deleted-only"}
+	db.Create(&withKnowledge)
+	db.Create(&parent)
+	db.Create(&deletedOnly)
+	db.Create(&models.Category{Name: "child", ParentID: &parent.ID})
+	db.Create(&models.Knowledge{Title: "b", Content: "b", CategoryID: withKnowledge.ID})
+	removed := models.Knowledge{Title: "c", Content: "c", CategoryID: deletedOnly.ID}
+	db.Create(&removed)
+	db.Delete(&removed)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/tags/unused", NewTagHandler().GetUnusedTags)
+	r.GET("/categories/unused", NewCategoryHandler().GetUnusedCategories)
+
+	names := func(url string) ([]string, int64) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d: %s", url, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data struct {
+				Items []struct {
+					Name string `json:"name"`
+				} `json:"items"`
+				Total int64 `json:"total"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		var result []string
+		for _, item := range resp.Data.Items {
+			result = append(result, item.Name)
+		}
+		return result, resp.Data.Total
+	}
+
+	if got, total := names("/tags/unused"); strings.Join(got, ",") != "unused-a,unused-b" || total != 2 {
+		t.Errorf("Unexpected unused tags: %v (total %d)", got, total)
+	}
+	if got, total := names("/tags/unused?page=2&page_size=1"); strings.Join(got, ",") != "unused-b" || total != 2 {
+		t.Errorf("Unexpected second page of unused tags: %v (total %d)", got, total)
+	}
+	if got, total := names("/categories/unused"); strings.Join(got, ",") != "child,deleted-only" || total != 2 {
+		t.Errorf("Unexpected unused categories: %v (total %d)", got, total)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tags/unused?page_size=1000", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for oversized page, got %d", w.Code)
+	}
+}
+
+func TestKnowledgeTranslations(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	original := models.Knowledge{Title: "并发", Content: "goroutine与channel", Summary: "摘要", IsPublished: true}
+	db.Create(&original)
+	db.First(&original, original.ID)
+
+	handler := NewKnowledgeHandler(nil)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/knowledge/:id/translations", handler.GetKnowledgeTranslations)
+	r.GET("/knowledge/:id/translations/:language", handler.GetKnowledgeTranslation)
+	r.PUT("/knowledge/:id/translations/:language", handler.SaveKnowledgeTranslation)
+	r.DELETE("/knowledge/:id/translations/:language", handler.DeleteKnowledgeTranslation)
+
+	perform := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	base := fmt.Sprintf("/knowledge/%d/translations", original.ID)
+
+	if w := perform(http.MethodPut, base+"/EN", `{"title":"Concurrency","content":"goroutines and channels"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	// 同一语言再次保存时覆盖
+	w := perform(http.MethodPut, base+"/en", `{"title":"Concurrency in Go","content":"goroutines and channels","summary":"summary"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var count int64
+	db.Model(&models.KnowledgeTranslation{}).Where("knowledge_id = ?", original.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected a single translation per language, got %d", count)
+	}
+
+	for path, body := range map[string]string{
+		base + "/zh-CN":   `{"title":"x","content":"y"}`, // 与原文语言相同
+		base + "/english": `{"title":"x","content":"y"}`,
+		base + "/fr":      `{"title":"","content":"y"}`,
+	} {
+		if w := perform(http.MethodPut, path, body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", path, w.Code)
+		}
+	}
+	if w := perform(http.MethodPut, "/knowledge/999/translations/en", `{"title":"x","content":"y"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for missing knowledge, got %d", w.Code)
+	}
+
+	var list struct {
+		Data []models.KnowledgeTranslation `json:"data"`
+	}
+	json.Unmarshal(perform(http.MethodGet, base, "").Body.Bytes(), &list)
+	if len(list.Data) != 1 || list.Data[0].Language != "en" || list.Data[0].Title != "Concurrency in Go" {
+		t.Errorf("Unexpected translations: %+v", list.Data)
+	}
+	if w := perform(http.MethodGet, base+"/en", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if w := perform(http.MethodGet, base+"/fr", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for missing translation, got %d", w.Code)
+	}
+
+	// 检索结果按查询语言替换为译文，按主语言匹配
+	knowledges := []models.Knowledge{original}
+	if err := service.LocalizeKnowledges(db, knowledges, "en-US"); err != nil {
+		t.Fatalf("LocalizeKnowledges failed: %v", err)
+	}
+	if knowledges[0].Title != "Concurrency in Go" || knowledges[0].Summary != "summary" || knowledges[0].DisplayLanguage != "en" {
+		t.Errorf("Expected English translation, got %+v", knowledges[0])
+	}
+	knowledges = []models.Knowledge{original}
+	service.LocalizeKnowledges(db, knowledges, "zh")
+	if knowledges[0].Title != "并发" || knowledges[0].DisplayLanguage != "" {
+		t.Errorf("Expected original content for the original language, got %+v", knowledges[0])
+	}
+
+	if w := perform(http.MethodDelete, base+"/en", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if w := perform(http.MethodDelete, base+"/en", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 after deletion, got %d", w.Code)
+	}
+}
+
+func TestSemanticSearchKnowledgesErrors(t *testing.T) {
+	setupTestDatabase(t)
+
+	handler := NewKnowledgeHandler(nil)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/knowledge/semantic-search", handler.SemanticSearchKnowledges)
+
+	cases := []struct {
+		url  string
+		code int
+	}{
+		{"/knowledge/semantic-search", http.StatusUnprocessableEntity},
+		{"/knowledge/semantic-search?q=%20%20", http.StatusUnprocessableEntity},
+		{"/knowledge/semantic-search?q=go&page_size=500", http.StatusUnprocessableEntity},
+		// 未配置向量服务
+		{"/knowledge/semantic-search?q=go", http.StatusServiceUnavailable},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("%s: expected status %d, got %d", tc.url, tc.code, w.Code)
+		}
+	}
+}
+
+func TestKnowledgeOwnership(t *testing.T) {
+	db := setupTestDatabase(t)
+	secret := []byte("test-secret-that-is-at-least-32-bytes")
+
+	handler := NewKnowledgeHandler(nil)
+	handler.SetAIService(&mockAIService{tags: []string{"go"}})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.WriteMethodsOnly(middleware.AuthMiddleware(secret)))
+	r.GET("/knowledge", handler.GetKnowledges)
+	r.POST("/knowledge", handler.CreateKnowledge)
+	r.PUT("/knowledge/:id", handler.UpdateKnowledge)
+	r.DELETE("/knowledge/:id", handler.DeleteKnowledge)
+	r.POST("/knowledge/:id/auto-tag", handler.AutoTagKnowledge)
+
+	alice, _ := middleware.IssueToken(secret, "1", time.Hour)
+	bob, _ := middleware.IssueToken(secret, "2", time.Hour)
+	perform := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := perform(http.MethodPost, "/knowledge", alice, `{"title":"mine","content":"content","is_published":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var created models.Knowledge
+	db.Where("title = ?", "mine").First(&created)
+	if created.CreatedBy == nil || *created.CreatedBy != 1 {
+		t.Fatalf("Expected knowledge created by user 1, got %v", created.CreatedBy)
+	}
+	legacy := models.Knowledge{Title: "legacy", Content: "content", IsPublished: true}
+	db.Create(&legacy)
+
+	countMine := func(token string) int {
+		w := perform(http.MethodGet, "/knowledge?mine=true", token, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data struct {
+				Items []models.Knowledge `json:"items"`
+			} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return len(resp.Data.Items)
+	}
+	if n := countMine(alice); n != 1 {
+		t.Errorf("Expected 1 knowledge for user 1, got %d", n)
+	}
+	if n := countMine(bob); n != 0 {
+		t.Errorf("Expected 0 knowledges for user 2, got %d", n)
+	}
+
+	codes := []struct {
+		method, path, token string
+		code                int
+	}{
+		{http.MethodGet, "/knowledge?mine=true", "", http.StatusUnauthorized},
+		{http.MethodGet, "/knowledge", "", http.StatusOK},
+		{http.MethodPut, fmt.Sprintf("/knowledge/%d", created.ID), bob, http.StatusForbidden},
+		{http.MethodDelete, fmt.Sprintf("/knowledge/%d", created.ID), bob, http.StatusForbidden},
+		{http.MethodPost, fmt.Sprintf("/knowledge/%d/auto-tag", created.ID), bob, http.StatusForbidden},
+		{http.MethodPost, fmt.Sprintf("/knowledge/%d/auto-tag", created.ID), alice, http.StatusOK},
+		{http.MethodDelete, fmt.Sprintf("/knowledge/%d", legacy.ID), bob, http.StatusOK},
+		{http.MethodDelete, fmt.Sprintf("/knowledge/%d", created.ID), alice, http.StatusOK},
+	}
+	for _, tc := range codes {
+		if w := perform(tc.method, tc.path, tc.token, `{"title":"changed"}`); w.Code != tc.code {
+			t.Errorf("%s %s: expected status %d, got %d: %s", tc.method, tc.path, tc.code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestKnowledgeTrashAndRestore(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	handler := NewKnowledgeHandler(nil)
+	live := models.Knowledge{Title: "live", Content: "a", IsPublished: true}
+	trashed := models.Knowledge{Title: "trashed", Content: "b", IsPublished: true}
+	db.Create(&live)
+	db.Create(&trashed)
+	handler.attachTags(&trashed, []string{"recycled"})
+	db.Delete(&trashed)
+	syncTagUsage(db, tagIDs(trashed.Tags))
+	var tag models.Tag
+	db.Where("name = ?", "recycled").First(&tag)
+	if tag.UsageCount != 0 {
+		t.Fatalf("Expected usage_count 0 while trashed, got %d", tag.UsageCount)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/admin/knowledge/trash", handler.GetTrashedKnowledges)
+	r.POST("/knowledge/:id/restore", handler.RestoreKnowledge)
+	perform := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := perform(http.MethodGet, "/admin/knowledge/trash")
+	var resp struct {
+		Data struct {
+			Items []TrashedKnowledge `json:"items"`
+			Total int64              `json:"total"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || resp.Data.Total != 1 || resp.Data.Items[0].ID != trashed.ID || resp.Data.Items[0].DeletedAt.IsZero() {
+		t.Fatalf("Expected only the trashed knowledge with its deletion time, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 未删除或不存在的条目不能恢复
+	for _, id := range []uint{live.ID, 999} {
+		if w := perform(http.MethodPost, fmt.Sprintf("/knowledge/%d/restore", id)); w.Code != http.StatusNotFound {
+			t.Errorf("Restore %d: expected status 404, got %d", id, w.Code)
+		}
+	}
+
+	if w := perform(http.MethodPost, fmt.Sprintf("/knowledge/%d/restore", trashed.ID)); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var restored models.Knowledge
+	if err := db.First(&restored, trashed.ID).Error; err != nil {
+		t.Errorf("Expected restored knowledge to be visible again: %v", err)
+	}
+	db.First(&tag, tag.ID)
+	if tag.UsageCount != 1 {
+		t.Errorf("Expected tag usage restored to 1, got %d", tag.UsageCount)
+	}
+	if w := perform(http.MethodGet, "/admin/knowledge/trash"); !strings.Contains(w.Body.String(), `"total":0`) {
+		t.Errorf("Expected empty trash after restore, got %s", w.Body.String())
+	}
+}
+
+// stubVectorService 返回固定向量，内容为"fail"时返回服务端错误，为"denied"时返回认证错误
+type stubVectorService struct {
+	calls      int   // 向量接口请求次数
+	batchSizes []int // 每次批量请求的文本数
+}
+
+// stubEmbeddingError 返回文本对应的错误，正常文本返回nil
+func stubEmbeddingError(text string) error {
+	switch text {
+	case "fail":
+		return errors.New("API returned unexpected status code: 503: embedding API unavailable")
+	case "denied":
+		return errors.New("API returned unexpected status code: 401: invalid api key")
+	}
+	return nil
+}
+
+func (s *stubVectorService) GenerateEmbedding(ctx context.Context, text string) (pgvector.Vector, error) {
+	s.calls++
+	if err := stubEmbeddingError(text); err != nil {
+		return pgvector.Vector{}, err
+	}
+	return pgvector.NewVector([]float32{1, 2, 3}), nil
+}
+
+// GenerateEmbeddings 遇到出错的文本时返回之前的向量和错误
+func (s *stubVectorService) GenerateEmbeddings(ctx context.Context, texts []string) ([]pgvector.Vector, error) {
+	s.calls++
+	s.batchSizes = append(s.batchSizes, len(texts))
+	var vectors []pgvector.Vector
+	for i, text := range texts {
+		if err := stubEmbeddingError(text); err != nil {
+			return vectors, &service.EmbeddingBatchError{Start: i, End: len(texts), Total: len(texts), Err: err}
+		}
+		vectors = append(vectors, pgvector.NewVector([]float32{1, 2, 3}))
+	}
+	return vectors, nil
+}
+
+func TestGenerateAndSaveEmbeddingsFallback(t *testing.T) {
+	setupTestDatabase(t)
+	save := func(i int, embedding *pgvector.Vector) error { return nil }
+
+	// 服务端错误时剩余文本逐条重试
+	vectors := &stubVectorService{}
+	errs := NewKnowledgeHandler(vectors).generateAndSaveEmbeddings(context.Background(), []string{"a", "fail", "b"}, save)
+	if errs[0] != nil || errs[1] == nil || errs[2] != nil || vectors.calls != 3 {
+		t.Errorf("Expected remaining texts to be retried individually, got %v (%d calls)", errs, vectors.calls)
+	}
+
+	// 认证错误逐条重试也会失败，剩余文本直接记为失败
+	vectors = &stubVectorService{}
+	errs = NewKnowledgeHandler(vectors).generateAndSaveEmbeddings(context.Background(), []string{"a", "denied", "b", "c"}, save)
+	if errs[0] != nil || errs[1] == nil || errs[2] == nil || errs[3] == nil || vectors.calls != 1 {
+		t.Errorf("Expected no individual retries after a non-retryable error, got %v (%d calls)", errs, vectors.calls)
+	}
+}
+
+func TestReindexKnowledges(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	vectorized := pgvector.NewVector([]float32{9})
+	missing := models.Knowledge{Title: "missing", Content: "a", IsPublished: true}
+	failing := models.Knowledge{Title: "failing", Content: "fail", IsPublished: true}
+	done := models.Knowledge{Title: "done", Content: "b", IsPublished: true, ContentVector: &vectorized}
+	draft := models.Knowledge{Title: "draft", Content: "c"}
+	for _, k := range []*models.Knowledge{&missing, &failing, &done, &draft} {
+		db.Create(k)
+	}
+	db.Model(&draft).Update("is_published", false)
+	translated := models.KnowledgeTranslation{KnowledgeID: done.ID, Language: "en", Title: "done", Content: "d"}
+	db.Create(&translated)
+	db.Create(&models.KnowledgeTranslation{KnowledgeID: draft.ID, Language: "en", Title: "draft", Content: "e"})
+
+	vectors := &stubVectorService{}
+	handler := NewKnowledgeHandler(vectors)
+	// 任务在提交时直接执行，返回的任务信息即包含结果
+	handler.SetJobManager(service.NewJobManager(inlineJobs{}))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/admin/knowledge/reindex", handler.ReindexJob)
+	reindex := func(path string) ReindexResult {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data struct {
+				Result ReindexResult `json:"result"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp.Data.Result
+	}
+
+	result := reindex("/admin/knowledge/reindex")
+	if result.Candidates != 2 || result.Reindexed != 1 || result.Failed != 1 || len(result.FailedIDs) != 1 || result.FailedIDs[0] != failing.ID {
+		t.Fatalf("Unexpected reindex result: %+v", result)
+	}
+	// 已发布知识的译文一并生成向量
+	if result.TranslationCandidates != 1 || result.TranslationsReindexed != 1 || result.TranslationsFailed != 0 {
+		t.Errorf("Expected the published translation to be reindexed, got %+v", result)
+	}
+	var updatedTranslation models.KnowledgeTranslation
+	db.First(&updatedTranslation, translated.ID)
+	if updatedTranslation.ContentVector == nil || len(updatedTranslation.ContentVector.Slice()) != 3 {
+		t.Errorf("Expected translation vector to be saved, got %v", updatedTranslation.ContentVector)
+	}
+	var updated models.Knowledge
+	db.First(&updated, missing.ID)
+	if updated.ContentVector == nil || len(updated.ContentVector.Slice()) != 3 {
+		t.Errorf("Expected vector to be saved, got %v", updated.ContentVector)
+	}
+
+	// 再次执行只重试失败的条目
+	if result := reindex("/admin/knowledge/reindex"); result.Candidates != 1 || result.Failed != 1 || result.TranslationCandidates != 0 {
+		t.Errorf("Expected only the failed entry to be retried, got %+v", result)
+	}
+
+	// force重新生成所有已发布知识，草稿不处理
+	// 知识和译文各一次批量请求，批量失败后未生成的两条知识逐条重试
+	vectors.calls = 0
+	vectors.batchSizes = nil
+	if result := reindex("/admin/knowledge/reindex?force=true"); result.Candidates != 3 || result.Reindexed != 2 || result.TranslationsReindexed != 1 || vectors.calls != 4 {
+		t.Errorf("Expected force to reindex all published entries, got %+v (%d calls)", result, vectors.calls)
+	}
+	if len(vectors.batchSizes) != 2 || vectors.batchSizes[0] != 3 || vectors.batchSizes[1] != 1 {
+		t.Errorf("Expected one batch request for knowledges and one for translations, got %v", vectors.batchSizes)
+	}
+	db.First(&updated, done.ID)
+	if len(updated.ContentVector.Slice()) != 3 {
+		t.Errorf("Expected force to replace existing vector, got %v", updated.ContentVector)
+	}
+
+	// 每批读取的知识数与配置的向量批大小一致
+	vectors.batchSizes = nil
+	handler.SetEmbeddingBatchSize(2)
+	reindex("/admin/knowledge/reindex?force=true")
+	if len(vectors.batchSizes) != 3 || vectors.batchSizes[0] != 2 || vectors.batchSizes[1] != 1 {
+		t.Errorf("Expected knowledges to be read in batches of 2, got %v", vectors.batchSizes)
+	}
+
+	unconfigured := gin.New()
+	unconfigured.POST("/admin/knowledge/reindex", NewKnowledgeHandler(nil).ReindexJob)
+	w := httptest.NewRecorder()
+	unconfigured.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/knowledge/reindex", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without vector service, got %d", w.Code)
+	}
+}
+
+func TestMinEmbeddingLength(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	vectorized := pgvector.NewVector([]float32{9})
+	short := models.Knowledge{Title: "short", Content: "  tiny  ", IsPublished: true}
+	long := models.Knowledge{Title: "long", Content: "long enough content", IsPublished: true, ContentVector: &vectorized}
+	for _, k := range []*models.Knowledge{&short, &long} {
+		db.Create(k)
+	}
+
+	vectors := &stubVectorService{}
+	handler := NewKnowledgeHandler(vectors)
+	handler.SetMinEmbeddingLength(10)
+	handler.SetJobManager(service.NewJobManager(inlineJobs{}))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/knowledge", handler.GetKnowledges)
+	r.PUT("/knowledge/:id", handler.UpdateKnowledge)
+	r.POST("/admin/knowledge/reindex", handler.ReindexJob)
+	perform := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s %s, got %d: %s", method, path, w.Code, w.Body.String())
+		}
+		return w
+	}
+
+	// 过短的内容（去除首尾空白后计算长度）不请求向量，记录跳过原因
+	var reindexResp struct {
+		Data struct {
+			Result ReindexResult `json:"result"`
+		} `json:"data"`
+	}
+	json.Unmarshal(perform(http.MethodPost, "/admin/knowledge/reindex?force=true", "").Body.Bytes(), &reindexResp)
+	if result := reindexResp.Data.Result; result.Reindexed != 1 || result.Skipped != 1 || len(result.SkippedIDs) != 1 || result.SkippedIDs[0] != short.ID {
+		t.Fatalf("Expected the short entry to be skipped, got %+v", result)
+	}
+	if len(vectors.batchSizes) != 1 || vectors.batchSizes[0] != 1 {
+		t.Errorf("Expected only the long entry to be embedded, got %v", vectors.batchSizes)
+	}
+	var skipped models.Knowledge
+	db.First(&skipped, short.ID)
+	if skipped.EmbeddingSkipReason != models.EmbeddingSkipContentTooShort || skipped.ContentVector != nil {
+		t.Errorf("Expected skip reason without vector, got %q %v", skipped.EmbeddingSkipReason, skipped.ContentVector)
+	}
+
+	// 内容改短后清除旧向量
+	perform(http.MethodPut, fmt.Sprintf("/knowledge/%d", long.ID), `{"content": "short now"}`)
+	var shortened models.Knowledge
+	db.First(&shortened, long.ID)
+	if shortened.EmbeddingSkipReason != models.EmbeddingSkipContentTooShort || shortened.ContentVector != nil {
+		t.Errorf("Expected shortened entry to drop its vector, got %q %v", shortened.EmbeddingSkipReason, shortened.ContentVector)
+	}
+
+	// 内容足够长时重新生成向量并清除跳过原因
+	perform(http.MethodPut, fmt.Sprintf("/knowledge/%d", short.ID), `{"content": "now this entry is long enough"}`)
+	db.First(&skipped, short.ID)
+	if skipped.EmbeddingSkipReason != "" || skipped.ContentVector == nil {
+		t.Errorf("Expected lengthened entry to be embedded, got %q %v", skipped.EmbeddingSkipReason, skipped.ContentVector)
+	}
+
+	// 列表可筛选未生成向量的条目
+	var listResp struct {
+		Data struct {
+			Items []models.Knowledge `json:"items"`
+		} `json:"data"`
+	}
+	json.Unmarshal(perform(http.MethodGet, "/knowledge?embedding_skipped=true", "").Body.Bytes(), &listResp)
+	if len(listResp.Data.Items) != 1 || listResp.Data.Items[0].ID != long.ID || listResp.Data.Items[0].EmbeddingSkipReason != models.EmbeddingSkipContentTooShort {
+		t.Errorf("Expected only the shortened entry to be listed, got %+v", listResp.Data.Items)
+	}
+}
+
+func TestCreateKnowledgeSyncEmbedding(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	vectors := &stubVectorService{}
+	handler := NewKnowledgeHandler(vectors)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/knowledge", handler.CreateKnowledge)
+	perform := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/knowledge", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 同步模式下返回时向量已保存
+	w := perform(`{"title": "sync", "content": "embedded before response", "sync_embedding": true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var created models.Knowledge
+	db.Where("title = ?", "sync").First(&created)
+	if created.ContentVector == nil || len(created.ContentVector.Slice()) != 3 || vectors.calls != 1 {
+		t.Errorf("Expected vector to be saved before responding, got %v (%d calls)", created.ContentVector, vectors.calls)
+	}
+
+	// 生成失败时返回错误且不创建知识
+	if w := perform(`{"title": "broken", "content": "fail", "sync_embedding": true}`); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502 when embedding fails, got %d", w.Code)
+	}
+	var count int64
+	db.Model(&models.Knowledge{}).Where("title = ?", "broken").Count(&count)
+	if count != 0 {
+		t.Errorf("Expected no knowledge to be created when embedding fails, got %d", count)
+	}
+
+	// 未配置向量服务时无法同步生成
+	unconfigured := gin.New()
+	unconfigured.POST("/knowledge", NewKnowledgeHandler(nil).CreateKnowledge)
+	req := httptest.NewRequest(http.MethodPost, "/knowledge", strings.NewReader(`{"title": "none", "content": "x", "sync_embedding": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	unconfigured.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without vector service, got %d", w.Code)
+	}
+}
+
+func TestKnowledgeSlugs(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	handler := NewKnowledgeHandler(nil)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/knowledge/slug/:slug", handler.GetKnowledgeBySlug)
+	r.POST("/knowledge", handler.CreateKnowledge)
+	r.PUT("/knowledge/:id", handler.UpdateKnowledge)
+	perform := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 同名标题生成带序号的slug，已删除条目的slug同样被占用
+	first := models.Knowledge{Title: "Getting Started", Content: "a"}
+	deleted := models.Knowledge{Title: "Getting Started", Content: "b"}
+	db.Create(&first)
+	db.Create(&deleted)
+	db.Delete(&deleted)
+	third := models.Knowledge{Title: "Getting Started!", Content: "c"}
+	db.Create(&third)
+	if first.Slug != "getting-started" || deleted.Slug != "getting-started-2" || third.Slug != "getting-started-3" {
+		t.Fatalf("Unexpected slugs: %q, %q, %q", first.Slug, deleted.Slug, third.Slug)
+	}
+
+	w := perform(http.MethodGet, "/knowledge/slug/getting-started-3", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), fmt.Sprintf(`"id":%d`, third.ID)) {
+		t.Errorf("Expected lookup by slug to return knowledge %d, got %d: %s", third.ID, w.Code, w.Body.String())
+	}
+	if w := perform(http.MethodGet, "/knowledge/slug/getting-started-2", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected deleted knowledge not to be found by slug, got %d", w.Code)
+	}
+
+	codes := []struct {
+		method, path, body string
+		code               int
+	}{
+		{http.MethodPost, "/knowledge", `{"title":"x","content":"x","slug":"getting-started"}`, http.StatusConflict},
+		{http.MethodPost, "/knowledge", `{"title":"x","content":"x","slug":"Not A Slug"}`, http.StatusUnprocessableEntity},
+		{http.MethodPost, "/knowledge", `{"title":"x","content":"x","slug":"custom-slug"}`, http.StatusOK},
+		{http.MethodPut, fmt.Sprintf("/knowledge/%d", third.ID), `{"slug":"custom-slug"}`, http.StatusConflict},
+	}
+	for _, tc := range codes {
+		if w := perform(tc.method, tc.path, tc.body); w.Code != tc.code {
+			t.Errorf("%s %s %s: expected status %d, got %d: %s", tc.method, tc.path, tc.body, tc.code, w.Code, w.Body.String())
+		}
+	}
+
+	// 默认保留slug，开启regenerate后按新标题生成
+	perform(http.MethodPut, fmt.Sprintf("/knowledge/%d", first.ID), `{"title":"Renamed Once"}`)
+	db.First(&first, first.ID)
+	if first.Slug != "getting-started" {
+		t.Errorf("Expected slug to be preserved on title change, got %q", first.Slug)
+	}
+	handler.SetRegenerateSlugOnTitleChange(true)
+	perform(http.MethodPut, fmt.Sprintf("/knowledge/%d", first.ID), `{"title":"Renamed Twice"}`)
+	db.First(&first, first.ID)
+	if first.Slug != "renamed-twice" {
+		t.Errorf("Expected slug regenerated from new title, got %q", first.Slug)
+	}
+}
+
+func TestBackfillKnowledgeSlugs(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	existing := models.Knowledge{Title: "Legacy", Content: "a"}
+	db.Create(&existing)
+	legacy := []models.Knowledge{{Title: "Legacy", Content: "b"}, {Title: "Other", Content: "c"}}
+	for i := range legacy {
+		db.Create(&legacy[i])
+	}
+	db.Model(&models.Knowledge{}).Where("id <> ?", existing.ID).UpdateColumn("slug", "")
+
+	if err := models.BackfillKnowledgeSlugs(db); err != nil {
+		t.Fatalf("BackfillKnowledgeSlugs failed: %v", err)
+	}
+	want := map[uint]string{existing.ID: "legacy", legacy[0].ID: "legacy-2", legacy[1].ID: "other"}
+	for id, slug := range want {
+		var k models.Knowledge
+		db.First(&k, id)
+		if k.Slug != slug {
+			t.Errorf("Knowledge %d: expected slug %q, got %q", id, slug, k.Slug)
+		}
+	}
+}
+
+func TestKnowledgeAttachments(t *testing.T) {
+	db := setupTestDatabase(t)
+
+	knowledge := models.Knowledge{Title: "with sources", Content: "a", IsPublished: true}
+	other := models.Knowledge{Title: "other", Content: "b", IsPublished: true}
+	db.Create(&knowledge)
+	db.Create(&other)
+	shared := models.Document{Name: "shared.pdf", OriginalName: "shared.pdf"}
+	single := models.Document{Name: "single.md", OriginalName: "single.md"}
+	db.Create(&shared)
+	db.Create(&single)
+
+	handler := NewKnowledgeHandler(nil)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/knowledge/:id/attachments", handler.GetKnowledgeAttachments)
+	r.POST("/knowledge/:id/attachments", handler.AttachDocument)
+	r.DELETE("/knowledge/:id/attachments/:document_id", handler.DetachDocument)
+	perform := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+	attach := func(knowledgeID, documentID uint) *httptest.ResponseRecorder {
+		return perform(http.MethodPost, fmt.Sprintf("/knowledge/%d/attachments", knowledgeID), fmt.Sprintf(`{"document_id":%d}`, documentID))
+	}
+	list := func(knowledgeID uint) []KnowledgeAttachment {
+		w := perform(http.MethodGet, fmt.Sprintf("/knowledge/%d/attachments", knowledgeID), "")
+		var resp struct {
+			Data []KnowledgeAttachment `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("Failed to list attachments (%d): %s", w.Code, w.Body.String())
+		}
+		return resp.Data
+	}
+
+	for _, pair := range [][2]uint{{knowledge.ID, shared.ID}, {knowledge.ID, single.ID}, {other.ID, shared.ID}, {knowledge.ID, shared.ID}} {
+		if w := attach(pair[0], pair[1]); w.Code != http.StatusOK {
+			t.Fatalf("Attach %v: expected status 200, got %d: %s", pair, w.Code, w.Body.String())
+		}
+	}
+	attachments := list(knowledge.ID)
+	if len(attachments) != 2 || attachments[0].ID != shared.ID || attachments[1].ID != single.ID {
+		t.Fatalf("Expected both documents attached once in order, got %+v", attachments)
+	}
+	if attachments[0].DownloadURL != fmt.Sprintf("/api/v1/documents/%d/download", shared.ID) || attachments[0].AttachedAt.IsZero() {
+		t.Errorf("Expected download link and attach time, got %+v", attachments[0])
+	}
+
+	// 不存在的知识或文档
+	if w := attach(999, shared.ID); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown knowledge, got %d", w.Code)
+	}
+	if w := attach(knowledge.ID, 999); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown document, got %d", w.Code)
+	}
+
+	// 取消关联不删除文档，也不影响其他知识
+	if w := perform(http.MethodDelete, fmt.Sprintf("/knowledge/%d/attachments/%d", knowledge.ID, shared.ID), ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := perform(http.MethodDelete, fmt.Sprintf("/knowledge/%d/attachments/%d", knowledge.ID, shared.ID), ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 when detaching twice, got %d", w.Code)
+	}
+	if err := db.First(&models.Document{}, shared.ID).Error; err != nil {
+		t.Errorf("Expected detached document to be kept: %v", err)
+	}
+	if attachments := list(other.ID); len(attachments) != 1 || attachments[0].ID != shared.ID {
+		t.Errorf("Expected other knowledge to keep its attachment, got %+v", attachments)
+	}
+
+	// 删除文档时解除其所有关联
+	if err := service.NewDocumentService(db).Delete(shared.ID); err != nil {
+		t.Fatalf("Failed to delete document: %v", err)
+	}
+	if attachments := list(other.ID); len(attachments) != 0 {
+		t.Errorf("Expected deleted document to be detached, got %+v", attachments)
+	}
+	var count int64
+	db.Model(&models.KnowledgeAttachment{}).Where("document_id = ?", shared.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected attachment rows of deleted document to be removed, got %d", count)
+	}
+}
@@ -2,17 +2,21 @@ package api
 
 import (
 	"net/http"
+	"runtime"
 	"time"
 
 	"ai-knowledge-app/internal/ai"
+	"ai-knowledge-app/internal/background"
 	"ai-knowledge-app/internal/config"
 	"ai-knowledge-app/internal/middleware"
 	"ai-knowledge-app/internal/models"
 	"ai-knowledge-app/internal/service"
 	"ai-knowledge-app/pkg/database"
+	"ai-knowledge-app/pkg/logger"
 	"ai-knowledge-app/pkg/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
@@ -25,9 +29,17 @@ type Router struct {
 	categoryHandler  *CategoryHandler
 	tagHandler       *TagHandler
 	documentHandler  *DocumentHandler
+	adminHandler     *AdminHandler
+	documentService  *service.DocumentService
 	vectorService    service.VectorService
+	aiService        ai.AIService
+	aiLimiter        *middleware.ConcurrencyLimiter
+	startTime        time.Time
 }
 
+// aiQueryRetryAfter AI查询并发已满时建议客户端的重试等待时间
+const aiQueryRetryAfter = 2 * time.Second
+
 // NewRouter 创建新的路由器
 func NewRouter(config *config.Config, vectorService service.VectorService, minioClient *service.MinIOClient) *Router {
 	// 创建AI服务
@@ -36,49 +48,166 @@ func NewRouter(config *config.Config, vectorService service.VectorService, minio
 
 	// 创建文档服务
 	documentService := service.NewDocumentService(database.GetDatabase())
+	documentService.SetMaxFileSize(config.Upload.MaxFileSize)
+	documentService.SetStrictDeduplication(config.Upload.StrictDeduplication)
+	documentService.SetProcessingQueue(background.Default())
+	if err := documentService.SetNearDuplicateMaxDistance(config.Upload.NearDuplicateMaxDistance); err != nil {
+		logger.GetLogger().WithError(err).Warn("Invalid near duplicate max distance, near-duplicate detection disabled")
+	}
+	if err := documentService.SetProcessingOptions(service.ChunkingOptions{
+		Strategy:  service.ChunkingStrategy(config.Processing.ChunkStrategy),
+		ChunkSize: config.Processing.ChunkSize,
+		Overlap:   config.Processing.ChunkOverlap,
+
+		Separators:   config.Processing.ChunkSeparators,
+		MinChunkSize: config.Processing.MinChunkSize,
+	}, config.Processing.MaxParseSize); err != nil {
+		logger.GetLogger().WithError(err).Warn("Invalid document processing config, using default chunking")
+	}
+	documentService.SetChunkSaveBatchSize(config.Processing.ChunkSaveBatchSize)
+	// 配置加载时已校验元数据结构，无效时服务不会启动
+	documentService.SetChunkMetadataSchema(service.NewChunkMetadataSchema(config.Processing.ChunkMetadataSchema))
 	if minioClient != nil {
 		documentService.SetMinIOClient(minioClient)
+		documentService.SetPresignExpiry(config.S3.PresignExpiry)
 	}
 
-	// 创建处理器
+	// 创建处理器，长时间运维任务共用一个任务管理器
+	jobs := service.NewJobManager(background.Default())
+	adminHandler := NewAdminHandler()
+	adminHandler.SetJobManager(jobs)
+	if minioClient != nil {
+		adminHandler.SetStorageClient(minioClient)
+	}
 	aiHandler := NewAIHandler()
 	aiHandler.SetAIService(aiService)
+	aiHandler.SetMaxReturnedDocs(config.AI.MaxReturnedDocs)
+	aiHandler.SetEmbeddingConfig(config.AI.Embedding)
+	aiHandler.SetQueryTimeout(config.AI.QueryTimeout, config.AI.MaxQueryTimeout)
+	aiHandler.SetTaskSubmitter(background.Default())
+	knowledgeHandler := NewKnowledgeHandler(vectorService)
+	knowledgeHandler.SetAIService(aiService)
+	knowledgeHandler.SetJobManager(jobs)
+	knowledgeHandler.SetQueueRetryAfter(config.Background.RetryAfter)
+	knowledgeHandler.SetAutoTagConfig(config.AI.AutoTag)
+	knowledgeHandler.SetRegenerateSlugOnTitleChange(config.Knowledge.RegenerateSlug())
+	knowledgeHandler.SetSearchOptions(config.Knowledge.SearchMaxResults, config.Knowledge.SnippetLength)
+	knowledgeHandler.SetMinEmbeddingLength(config.AI.Embedding.MinContentLength)
+	knowledgeHandler.SetEmbeddingBatchSize(config.AI.Embedding.BatchSize)
+	if err := knowledgeHandler.SetDefaultOrder(config.Knowledge.DefaultSort, config.Knowledge.DefaultOrder); err != nil {
+		logger.GetLogger().WithError(err).Warn("Invalid knowledge default ordering, using created_at desc")
+	}
+	if err := knowledgeHandler.SetRelatedLimits(config.Knowledge.RelatedLimit, config.Knowledge.RelatedMaxLimit); err != nil {
+		logger.GetLogger().WithError(err).Warn("Invalid related knowledge limits, using 5 and 20")
+	}
+	documentHandler := NewDocumentHandler(documentService)
+	documentHandler.SetJobManager(jobs)
+	documentHandler.SetQueueRetryAfter(config.Background.RetryAfter)
 
 	return &Router{
 		config:           config,
-		knowledgeHandler: NewKnowledgeHandler(vectorService),
+		knowledgeHandler: knowledgeHandler,
 		aiHandler:        aiHandler,
 		categoryHandler:  NewCategoryHandler(),
 		tagHandler:       NewTagHandler(),
-		documentHandler:  NewDocumentHandler(documentService),
+		documentHandler:  documentHandler,
+		adminHandler:     adminHandler,
+		documentService:  documentService,
 		vectorService:    vectorService,
+		aiService:        aiService,
+		aiLimiter:        middleware.NewConcurrencyLimiter(config.AI.MaxConcurrentQueries, aiQueryRetryAfter),
+		startTime:        time.Now(),
 	}
 }
 
+// DocumentService 返回路由器使用的文档服务（供后台任务复用）
+func (r *Router) DocumentService() *service.DocumentService {
+	return r.documentService
+}
+
+// longRunningRoutes 不受全局请求超时（server.request_timeout）和写超时限制的路由：
+// AI查询的时长由ai.query_timeout控制，SSE推送持续到处理或生成结束，
+// 同步重新处理文档的耗时随文档大小增长
+var longRunningRoutes = []string{
+	"/api/v1/ai/query",
+	"/api/v1/ai/query/stream",
+	"/api/v1/processing/documents/:id/progress/stream",
+	"/api/v1/processing/documents/:id/reprocess",
+}
+
 // SetupRoutes 设置路由
 func (r *Router) SetupRoutes() *gin.Engine {
 	// 设置Gin模式
 	gin.SetMode(r.config.Server.Mode)
+	utils.SetResponseTimeFormat(r.config.Server.TimeFormat)
 
 	// 创建路由引擎
 	router := gin.New()
+	// 只信任配置的反向代理转发的客户端IP，避免伪造X-Forwarded-For绕过按IP限流
+	if err := router.SetTrustedProxies(r.config.Server.TrustedProxies); err != nil {
+		logger.GetLogger().WithError(err).Error("Failed to apply trusted proxies, client IPs are taken from the connection")
+	}
 
 	// 添加全局中间件
 	router.Use(middleware.RequestID())
-	router.Use(middleware.Logger())
+	router.Use(middleware.Logger(middleware.AccessLogSkip{
+		Paths:      r.config.Log.AccessSkipPaths,
+		Prefixes:   r.config.Log.AccessSkipPrefixes,
+		KeepErrors: r.config.Log.AccessKeepErrors,
+	}))
 	router.Use(middleware.Recovery())
 	router.Use(middleware.SecurityHeaders())
 	router.Use(middleware.ValidateRequest())
+	router.Use(middleware.BodySizeLimit(r.config.Server.MaxBodySize))
+	router.Use(middleware.Timeout(r.config.Server.RequestTimeout, longRunningRoutes...))
+
+	// CORS配置（未配置任何来源时不启用跨域）
+	if len(r.config.CORS.AllowedOrigins) > 0 {
+		router.Use(middleware.CORS(
+			r.config.CORS.AllowedOrigins,
+			r.config.CORS.AllowedMethods,
+			r.config.CORS.AllowedHeaders,
+		))
+	}
+
+	// 按客户端IP限流，白名单内的IP不受限制；配置Redis时各副本共享计数
+	if r.config.RateLimit.Enabled {
+		rateLimiter := middleware.NewRateLimiter(r.config.RateLimit.RequestsPerSecond, r.config.RateLimit.Burst)
+		if err := rateLimiter.SetAllowlist(r.config.RateLimit.Allowlist); err != nil {
+			logger.GetLogger().WithError(err).Warn("Failed to apply rate limit allowlist, no IPs bypass rate limiting")
+		}
+		var limiter middleware.IPRateLimiter = rateLimiter
+		if r.config.RateLimit.RedisAddr != "" {
+			redisLimiter := middleware.NewRedisRateLimiter(middleware.RedisRateLimiterOptions{
+				Addr:              r.config.RateLimit.RedisAddr,
+				Password:          r.config.RateLimit.RedisPassword,
+				DB:                r.config.RateLimit.RedisDB,
+				KeyPrefix:         r.config.RateLimit.RedisKeyPrefix,
+				Timeout:           r.config.RateLimit.RedisTimeout,
+				RequestsPerSecond: r.config.RateLimit.RequestsPerSecond,
+				Burst:             r.config.RateLimit.Burst,
+			}, rateLimiter)
+			if err := redisLimiter.Ping(); err != nil {
+				logger.GetLogger().WithError(err).Warn("Redis rate limiter unreachable, using in-memory rate limiting until it recovers")
+			}
+			limiter = redisLimiter
+		}
+		router.Use(middleware.RateLimitMiddleware(limiter))
+	}
 
-	// CORS配置
-	router.Use(middleware.CORS(
-		r.config.CORS.AllowedOrigins,
-		r.config.CORS.AllowedMethods,
-		r.config.CORS.AllowedHeaders,
-	))
+	logger.GetLogger().WithFields(logrus.Fields{
+		"mode":            r.config.Server.Mode,
+		"cors_origins":    r.config.CORS.AllowedOrigins,
+		"max_body_size":   r.config.Server.MaxBodySize,
+		"request_timeout": r.config.Server.RequestTimeout.String(),
+		"read_timeout":    r.config.Server.ReadTimeout.String(),
+		"write_timeout":   r.config.Server.WriteTimeout.String(),
+		"idle_timeout":    r.config.Server.IdleTimeout.String(),
+	}).Info("Effective middleware settings")
 
 	// 健康检查端点
 	router.GET("/health", r.healthCheck)
+	router.GET("/metrics", r.getMetrics)
 	router.GET("/debug/config", r.debugConfig)
 
 	// Swagger文档路由
@@ -86,24 +215,43 @@ func (r *Router) SetupRoutes() *gin.Engine {
 
 	// API版本分组
 	v1 := router.Group("/api/v1")
+	// 开启认证时写请求需要有效的JWT，读请求保持公开
+	if r.config.Auth.Enabled {
+		v1.Use(middleware.WriteMethodsOnly(middleware.AuthMiddleware([]byte(r.config.Auth.JWTSecret))))
+	} else if r.config.Server.Mode == gin.ReleaseMode {
+		logger.GetLogger().Warn("Authentication is disabled; write endpoints are open to anyone")
+	}
 	{
 		// 知识库相关路由
 		knowledge := v1.Group("/knowledge")
 		{
 			knowledge.GET("", r.knowledgeHandler.GetKnowledges)
 			knowledge.GET("/:id", r.knowledgeHandler.GetKnowledge)
+			knowledge.GET("/slug/:slug", r.knowledgeHandler.GetKnowledgeBySlug)
 			knowledge.POST("", r.knowledgeHandler.CreateKnowledge)
 			knowledge.PUT("/:id", r.knowledgeHandler.UpdateKnowledge)
 			knowledge.DELETE("/:id", r.knowledgeHandler.DeleteKnowledge)
 			knowledge.GET("/search", r.knowledgeHandler.SearchKnowledges)
+			knowledge.GET("/semantic-search", r.knowledgeHandler.SemanticSearchKnowledges)
+			knowledge.POST("/:id/restore", r.knowledgeHandler.RestoreKnowledge)
 			knowledge.GET("/:id/related", r.knowledgeHandler.GetRelatedKnowledges)
+			knowledge.GET("/:id/attachments", r.knowledgeHandler.GetKnowledgeAttachments)
+			knowledge.POST("/:id/attachments", r.knowledgeHandler.AttachDocument)
+			knowledge.DELETE("/:id/attachments/:document_id", r.knowledgeHandler.DetachDocument)
+			knowledge.GET("/:id/translations", r.knowledgeHandler.GetKnowledgeTranslations)
+			knowledge.GET("/:id/translations/:language", r.knowledgeHandler.GetKnowledgeTranslation)
+			knowledge.PUT("/:id/translations/:language", r.knowledgeHandler.SaveKnowledgeTranslation)
+			knowledge.DELETE("/:id/translations/:language", r.knowledgeHandler.DeleteKnowledgeTranslation)
 			knowledge.POST("/:id/view", r.knowledgeHandler.IncrementViewCount)
+			knowledge.POST("/auto-tag", r.knowledgeHandler.BulkAutoTagKnowledges)
+			knowledge.POST("/:id/auto-tag", r.knowledgeHandler.AutoTagKnowledge)
 		}
 
 		// 分类相关路由
 		categories := v1.Group("/categories")
 		{
 			categories.GET("", r.categoryHandler.GetCategories)
+			categories.GET("/unused", r.categoryHandler.GetUnusedCategories)
 			categories.GET("/:id", r.categoryHandler.GetCategory)
 			categories.POST("", r.categoryHandler.CreateCategory)
 			categories.PUT("/:id", r.categoryHandler.UpdateCategory)
@@ -117,21 +265,28 @@ func (r *Router) SetupRoutes() *gin.Engine {
 			tags.GET("", r.tagHandler.GetTags)
 			tags.GET("/:id", r.tagHandler.GetTag)
 			tags.POST("", r.tagHandler.CreateTag)
+			tags.POST("/batch", r.tagHandler.BatchCreateTags)
 			tags.PUT("/:id", r.tagHandler.UpdateTag)
 			tags.DELETE("/:id", r.tagHandler.DeleteTag)
 			tags.GET("/:id/knowledges", r.tagHandler.GetTagKnowledges)
 			tags.GET("/popular", r.tagHandler.GetPopularTags)
+			tags.GET("/unused", r.tagHandler.GetUnusedTags)
 		}
 
 		// AI查询相关路由
 		ai := v1.Group("/ai")
 		{
-			ai.POST("/query", r.aiHandler.Query)
+			ai.POST("/query", middleware.ConcurrencyLimitMiddleware(r.aiLimiter), r.aiHandler.Query)
+			ai.POST("/query/stream", middleware.ConcurrencyLimitMiddleware(r.aiLimiter), r.aiHandler.QueryStream)
+			ai.POST("/tokens/estimate", r.aiHandler.EstimateTokens)
 			ai.GET("/history", r.aiHandler.GetQueryHistory)
+			ai.GET("/history/similar", r.aiHandler.GetSimilarQueries)
 			ai.DELETE("/history/:id", r.aiHandler.DeleteQueryHistory)
 			ai.GET("/history/stats", r.aiHandler.GetQueryStats)
 			ai.POST("/feedback", r.aiHandler.SubmitFeedback)
+			ai.GET("/feedback/stats", r.aiHandler.GetFeedbackStats)
 			ai.GET("/models", r.aiHandler.GetModels)
+			ai.GET("/embedding-info", r.aiHandler.GetEmbeddingInfo)
 		}
 
 		// 统计相关路由
@@ -146,11 +301,33 @@ func (r *Router) SetupRoutes() *gin.Engine {
 		documents := v1.Group("/documents")
 		{
 			documents.POST("/upload", r.documentHandler.Upload)
+			documents.POST("/check-batch", r.documentHandler.CheckFiles)
+			documents.GET("/upload/:sessionId/missing-chunks", r.documentHandler.GetMissingChunks)
 			documents.GET("", r.documentHandler.List)
+			documents.GET("/stats/history", r.documentHandler.GetStatsHistory)
 			documents.GET("/:id", r.documentHandler.Get)
 			documents.DELETE("/:id", r.documentHandler.Delete)
 			documents.PUT("/:id/description", r.documentHandler.UpdateDescription)
 			documents.GET("/:id/download", r.documentHandler.Download)
+			documents.GET("/:id/presigned-url", r.documentHandler.PresignedURL)
+			documents.GET("/:id/text", r.documentHandler.GetText)
+			documents.GET("/:id/processing-task", r.documentHandler.GetTaskByDocumentID)
+			documents.POST("/:id/summarize", r.knowledgeHandler.CreateFromDocument)
+		}
+
+		// 文档处理路由
+		processing := v1.Group("/processing")
+		{
+			processing.POST("/batch", r.documentHandler.BatchProcessDocuments)
+			processing.POST("/status/batch", r.documentHandler.BatchProcessingStatus)
+			processing.GET("/queue/stats", r.documentHandler.GetQueueStats)
+			processing.GET("/tasks/:id", r.documentHandler.GetTaskStatus)
+			processing.POST("/tasks/:id/cancel", r.documentHandler.CancelTask)
+			processing.GET("/documents/:id/progress/stream", r.documentHandler.StreamProcessingProgress)
+			processing.POST("/documents/:id/reprocess", r.documentHandler.ReprocessDocument)
+			processing.GET("/documents/:id/markdown", r.documentHandler.GetMarkdown)
+			processing.GET("/chunks/:id", r.documentHandler.GetChunk)
+			processing.PUT("/chunks/:id", r.documentHandler.UpdateChunk)
 		}
 
 		// 文件上传路由
@@ -158,6 +335,25 @@ func (r *Router) SetupRoutes() *gin.Engine {
 		{
 			files.POST("/upload", r.uploadFile)
 		}
+
+		// 运维管理路由，需要开启认证并携带JWT
+		admin := v1.Group("/admin")
+		admin.Use(middleware.AdminAuth(r.config.Auth.Enabled, []byte(r.config.Auth.JWTSecret), r.config.Auth.AdminUsers))
+		{
+			admin.GET("/storage/retry-config", r.adminHandler.GetRetryConfig)
+			admin.PUT("/storage/retry-config", r.adminHandler.UpdateRetryConfig)
+			admin.GET("/documents/dedup-stats", r.documentHandler.GetDeduplicationStats)
+			admin.GET("/documents/storage-health", r.documentHandler.GetStorageHealth)
+			admin.POST("/documents/cleanup-orphans", r.documentHandler.CleanupOrphanedObjects)
+			admin.POST("/documents/verify-integrity", r.documentHandler.VerifyStorageIntegrity)
+			admin.POST("/documents/reprocess-all", r.documentHandler.ReprocessAllDocuments)
+			admin.POST("/knowledge/reindex", r.knowledgeHandler.ReindexJob)
+			admin.GET("/knowledge/trash", r.knowledgeHandler.GetTrashedKnowledges)
+			admin.POST("/processing/queue/pause", r.documentHandler.PauseQueue)
+			admin.POST("/processing/queue/resume", r.documentHandler.ResumeQueue)
+			admin.GET("/jobs/:id", r.adminHandler.GetJob)
+			admin.POST("/jobs/:id/cancel", r.adminHandler.CancelJob)
+		}
 	}
 
 	// 404处理
@@ -205,6 +401,45 @@ func (r *Router) healthCheck(c *gin.Context) {
 	})
 }
 
+// getMetrics 运行时指标
+// @Summary 运行时指标
+// @Description 返回进程、AI查询并发及后台任务等运行时指标
+// @Tags system
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /metrics [get]
+func (r *Router) getMetrics(c *gin.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	c.JSON(http.StatusOK, gin.H{
+		"uptime_seconds": int64(time.Since(r.startTime).Seconds()),
+		"goroutines":     runtime.NumGoroutine(),
+		"memory": gin.H{
+			"alloc_bytes":      mem.Alloc,
+			"heap_inuse_bytes": mem.HeapInuse,
+			"sys_bytes":        mem.Sys,
+		},
+		"ai": gin.H{
+			"in_flight_queries":      r.aiLimiter.InFlight(),
+			"max_concurrent_queries": r.aiLimiter.Limit(),
+			"answer_cache":           r.aiService.AnswerCacheStats(),
+			"embedding_cache":        r.embeddingCacheStats(),
+		},
+		"background": background.GetStats(),
+	})
+}
+
+// embeddingCacheStats 返回向量缓存统计，向量服务不支持缓存时为nil
+func (r *Router) embeddingCacheStats() *utils.CacheStats {
+	cached, ok := r.vectorService.(interface{ EmbeddingCacheStats() utils.CacheStats })
+	if !ok {
+		return nil
+	}
+	stats := cached.EmbeddingCacheStats()
+	return &stats
+}
+
 // debugConfig 调试配置信息
 func (r *Router) debugConfig(c *gin.Context) {
 	// 只返回安全的配置信息（不包含敏感信息）
@@ -255,11 +490,22 @@ func (r *Router) getOverviewStats(c *gin.Context) {
 	// 统计查询数量
 	db.Model(&models.QueryHistory{}).Count(&queryCount)
 
+	// 统计人工查看次数与AI引用次数
+	var usage struct {
+		ViewCount        int64
+		AIReferenceCount int64
+	}
+	db.Model(&models.Knowledge{}).
+		Select("COALESCE(SUM(view_count), 0) as view_count, COALESCE(SUM(ai_reference_count), 0) as ai_reference_count").
+		Scan(&usage)
+
 	stats := gin.H{
-		"knowledge_count": knowledgeCount,
-		"category_count":  categoryCount,
-		"tag_count":       tagCount,
-		"query_count":     queryCount,
+		"knowledge_count":    knowledgeCount,
+		"category_count":     categoryCount,
+		"tag_count":          tagCount,
+		"query_count":        queryCount,
+		"view_count":         usage.ViewCount,
+		"ai_reference_count": usage.AIReferenceCount,
 	}
 
 	utils.SuccessResponse(c, stats)
@@ -297,9 +543,39 @@ func (r *Router) getKnowledgeStats(c *gin.Context) {
 		Limit(10).
 		Scan(&tagStats)
 
+	// 人工查看最多的知识
+	var mostViewed []struct {
+		ID        uint   `json:"id"`
+		Title     string `json:"title"`
+		ViewCount int    `json:"view_count"`
+	}
+
+	db.Model(&models.Knowledge{}).
+		Select("id, title, view_count").
+		Where("view_count > 0").
+		Order("view_count desc").
+		Limit(10).
+		Scan(&mostViewed)
+
+	// 被AI回答引用最多的知识
+	var mostReferenced []struct {
+		ID               uint   `json:"id"`
+		Title            string `json:"title"`
+		AIReferenceCount int    `json:"ai_reference_count"`
+	}
+
+	db.Model(&models.Knowledge{}).
+		Select("id, title, ai_reference_count").
+		Where("ai_reference_count > 0").
+		Order("ai_reference_count desc").
+		Limit(10).
+		Scan(&mostReferenced)
+
 	stats := gin.H{
-		"by_category": categoryStats,
-		"by_tags":     tagStats,
+		"by_category":     categoryStats,
+		"by_tags":         tagStats,
+		"most_viewed":     mostViewed,
+		"most_referenced": mostReferenced,
 	}
 
 	utils.SuccessResponse(c, stats)
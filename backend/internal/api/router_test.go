@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ai-knowledge-app/internal/config"
+)
+
+// newTestRouter 使用测试数据库和最小配置创建路由
+func newTestRouter(t *testing.T, configure func(cfg *config.Config)) *Router {
+	t.Helper()
+	setupTestDatabase(t)
+
+	cfg := &config.Config{}
+	cfg.Server.Mode = "test"
+	cfg.Processing.ChunkStrategy = "paragraph"
+	cfg.Processing.ChunkSize = 1000
+	if configure != nil {
+		configure(cfg)
+	}
+	cfg.ApplyModeDefaults()
+	return NewRouter(cfg, nil, nil)
+}
+
+func TestLongRunningRoutesAreRegistered(t *testing.T) {
+	engine := newTestRouter(t, nil).SetupRoutes()
+
+	registered := make(map[string]bool)
+	for _, route := range engine.Routes() {
+		registered[route.Path] = true
+	}
+	for _, path := range longRunningRoutes {
+		if !registered[path] {
+			t.Errorf("Expected long-running route %s to be registered", path)
+		}
+	}
+}
+
+func TestRateLimitKeysOnTrustedClientIP(t *testing.T) {
+	// httptest请求的对端地址为192.0.2.1
+	request := func(engine http.Handler, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+	limit := func(cfg *config.Config) {
+		cfg.RateLimit.Enabled = true
+		cfg.RateLimit.RequestsPerSecond = 0.001
+		cfg.RateLimit.Burst = 1
+	}
+
+	// 未配置信任的代理时，伪造X-Forwarded-For不能绕过限流
+	engine := newTestRouter(t, limit).SetupRoutes()
+	if code := request(engine, "203.0.113.1"); code == http.StatusTooManyRequests {
+		t.Fatal("Expected first request to be allowed")
+	}
+	if code := request(engine, "203.0.113.2"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected spoofed X-Forwarded-For to share the peer's limit, got %d", code)
+	}
+
+	// 来自信任代理的请求按转发的客户端IP分别限流
+	engine = newTestRouter(t, func(cfg *config.Config) {
+		limit(cfg)
+		cfg.Server.TrustedProxies = []string{"192.0.2.0/24"}
+	}).SetupRoutes()
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2"} {
+		if code := request(engine, ip); code == http.StatusTooManyRequests {
+			t.Errorf("Expected client %s behind a trusted proxy to have its own limit", ip)
+		}
+	}
+	if code := request(engine, "203.0.113.1"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected repeated client behind a trusted proxy to be limited, got %d", code)
+	}
+}
+
+func TestOperationsRoutesRequireAdmin(t *testing.T) {
+	// 未开启认证时/admin下的接口一律返回403
+	engine := newTestRouter(t, nil).SetupRoutes()
+	for _, path := range []string{
+		"/api/v1/admin/documents/dedup-stats",
+		"/api/v1/admin/documents/storage-health",
+		"/api/v1/admin/knowledge/trash",
+	} {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected %s to require admin authentication, got %d", path, w.Code)
+		}
+	}
+
+	// 重建向量只能通过运维后台任务执行
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/knowledge/reindex", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected the synchronous reindex route to be removed, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/admin/knowledge/reindex", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected the reindex job to require admin authentication, got %d", w.Code)
+	}
+}
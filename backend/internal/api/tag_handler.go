@@ -57,9 +57,50 @@ func (h *TagHandler) GetTags(c *gin.Context) {
 		return
 	}
 
+	if err := fillTagKnowledgeCounts(db, tags); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to count tag knowledges")
+		return
+	}
+
 	utils.SuccessResponse(c, tags)
 }
 
+// fillTagKnowledgeCounts 使用一次聚合查询填充标签下已发布知识的数量
+func fillTagKnowledgeCounts(db *gorm.DB, tags []models.Tag) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	tagIDs := make([]uint, 0, len(tags))
+	for _, tag := range tags {
+		tagIDs = append(tagIDs, tag.ID)
+	}
+
+	var counts []struct {
+		TagID uint
+		Count int64
+	}
+
+	if err := db.Table("knowledge_tags").
+		Select("knowledge_tags.tag_id, COUNT(*) as count").
+		Joins("INNER JOIN knowledges ON knowledges.id = knowledge_tags.knowledge_id").
+		Where("knowledge_tags.tag_id IN ? AND knowledges.is_published = ? AND knowledges.deleted_at IS NULL", tagIDs, true).
+		Group("knowledge_tags.tag_id").
+		Scan(&counts).Error; err != nil {
+		return err
+	}
+
+	countMap := make(map[uint]int64, len(counts))
+	for _, c := range counts {
+		countMap[c.TagID] = c.Count
+	}
+	for i := range tags {
+		tags[i].KnowledgeCount = countMap[tags[i].ID]
+	}
+
+	return nil
+}
+
 // GetTag 获取单个标签
 func (h *TagHandler) GetTag(c *gin.Context) {
 	db := database.GetDatabase()
@@ -114,6 +155,84 @@ func (h *TagHandler) CreateTag(c *gin.Context) {
 	utils.SuccessResponse(c, tag)
 }
 
+// BatchCreateTagsRequest 批量创建标签请求
+type BatchCreateTagsRequest struct {
+	Tags []CreateTagRequest `json:"tags" binding:"required,min=1,max=100,dive"`
+}
+
+// SkippedTag 批量创建时跳过的标签
+type SkippedTag struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`           // exists：已存在同名标签；duplicate：请求中重复
+	TagID  uint   `json:"tag_id,omitempty"` // 已存在的标签ID
+}
+
+// BatchCreateTagsResponse 批量创建标签结果
+type BatchCreateTagsResponse struct {
+	Created []models.Tag `json:"created"`
+	Skipped []SkippedTag `json:"skipped"`
+}
+
+// BatchCreateTags 批量创建标签，已存在或重复的名称跳过，全部在一个事务中创建
+// 未指定颜色的标签依次从调色板取色，使同一批标签颜色各不相同
+func (h *TagHandler) BatchCreateTags(c *gin.Context) {
+	db := database.GetDatabase()
+
+	var req BatchCreateTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	resp := BatchCreateTagsResponse{Created: []models.Tag{}, Skipped: []SkippedTag{}}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		names := make([]string, len(req.Tags))
+		for i, item := range req.Tags {
+			names[i] = utils.CleanText(item.Name)
+		}
+
+		var existing []models.Tag
+		if err := tx.Where("name IN ?", names).Find(&existing).Error; err != nil {
+			return err
+		}
+		existingIDs := make(map[string]uint, len(existing))
+		for _, tag := range existing {
+			existingIDs[tag.Name] = tag.ID
+		}
+
+		seen := make(map[string]bool, len(names))
+		for i, item := range req.Tags {
+			name := names[i]
+			if id, ok := existingIDs[name]; ok {
+				resp.Skipped = append(resp.Skipped, SkippedTag{Name: name, Reason: "exists", TagID: id})
+				continue
+			}
+			if seen[name] {
+				resp.Skipped = append(resp.Skipped, SkippedTag{Name: name, Reason: "duplicate"})
+				continue
+			}
+			seen[name] = true
+
+			tag := models.Tag{Name: name, Color: item.Color}
+			if tag.Color == "" {
+				tag.Color = tagColors[len(resp.Created)%len(tagColors)]
+			}
+			resp.Created = append(resp.Created, tag)
+		}
+
+		if len(resp.Created) == 0 {
+			return nil
+		}
+		return tx.Create(&resp.Created).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create tags")
+		return
+	}
+
+	utils.SuccessResponse(c, resp)
+}
+
 // UpdateTag 更新标签
 func (h *TagHandler) UpdateTag(c *gin.Context) {
 	db := database.GetDatabase()
@@ -264,6 +383,48 @@ func (h *TagHandler) GetTagKnowledges(c *gin.Context) {
 	utils.SuccessResponse(c, responseData)
 }
 
+// GetUnusedTags 获取未被使用的标签（使用次数为0且没有任何知识关联），用于清理
+func (h *TagHandler) GetUnusedTags(c *gin.Context) {
+	db := database.GetDatabase()
+
+	var pagination utils.PaginationRequest
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	query := db.Model(&models.Tag{}).
+		Joins("LEFT JOIN knowledge_tags ON knowledge_tags.tag_id = tags.id").
+		Where("tags.usage_count = 0 AND knowledge_tags.tag_id IS NULL")
+
+	if pagination.Search != "" {
+		query = query.Where("tags.name LIKE ?", "%"+pagination.Search+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to count unused tags")
+		return
+	}
+
+	var tags []models.Tag
+	if err := query.Order("tags.name ASC").
+		Offset(utils.GetOffset(pagination.Page, pagination.PageSize)).
+		Limit(pagination.PageSize).
+		Find(&tags).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch unused tags")
+		return
+	}
+
+	utils.SuccessResponse(c, utils.PaginationResponse{
+		Items:      tags,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: utils.CalculateTotalPages(total, pagination.PageSize),
+	})
+}
+
 // GetPopularTags 获取热门标签
 func (h *TagHandler) GetPopularTags(c *gin.Context) {
 	db := database.GetDatabase()
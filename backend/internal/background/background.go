@@ -0,0 +1,346 @@
+package background
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ai-knowledge-app/pkg/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrPoolClosed 任务池已关闭，不再接受新任务
+var ErrPoolClosed = errors.New("background pool is closed")
+
+// ErrQueueFull 任务队列已满
+var ErrQueueFull = errors.New("background task queue is full")
+
+// 默认参数（未调用Init时使用）
+const (
+	defaultWorkers     = 8
+	defaultQueueSize   = 256
+	defaultTaskTimeout = 2 * time.Minute
+)
+
+// TaskFunc 后台任务函数，ctx在任务超时或关闭超时时被取消
+type TaskFunc func(ctx context.Context) error
+
+type task struct {
+	name string
+	run  TaskFunc
+	// longRunning 不受taskTimeout限制，只在关闭超时时被取消
+	longRunning bool
+}
+
+// Stats 后台任务统计
+type Stats struct {
+	Workers   int   `json:"workers"`
+	Active    int64 `json:"active"`
+	Queued    int   `json:"queued"`
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+	Rejected  int64 `json:"rejected"`
+	// AvgTaskMillis 已结束任务的平均执行时间（毫秒）
+	AvgTaskMillis float64 `json:"avg_task_ms"`
+	// ThroughputPerMinute 自任务池创建以来平均每分钟结束的任务数
+	ThroughputPerMinute float64 `json:"throughput_per_minute"`
+	// Closed 任务池已关闭，不再接受新任务
+	Closed bool `json:"closed"`
+	// Paused 任务池已暂停，worker不再取出新任务，队列中的任务保留
+	Paused bool `json:"paused"`
+}
+
+// Pool 有界的后台任务池
+// 固定数量的worker从队列中取任务执行，替代无管理的fire-and-forget goroutine
+type Pool struct {
+	queue       chan task
+	workers     int
+	taskTimeout time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+
+	// pauseMu 保护暂停状态；暂停时关闭pauseCh通知等待任务的worker，恢复时关闭resumeCh
+	pauseMu  sync.Mutex
+	paused   bool
+	pauseCh  chan struct{}
+	resumeCh chan struct{}
+	// held 暂停时已被worker取出、等待恢复后执行的任务数
+	held int64
+
+	active    int64
+	completed int64
+	failed    int64
+	rejected  int64
+	// busyNanos 已结束任务的执行时间之和
+	busyNanos int64
+	startedAt time.Time
+}
+
+// NewPool 创建并启动任务池，taskTimeout<=0表示任务不设超时
+func NewPool(workers, queueSize int, taskTimeout time.Duration) *Pool {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		queue:       make(chan task, queueSize),
+		workers:     workers,
+		taskTimeout: taskTimeout,
+		ctx:         ctx,
+		cancel:      cancel,
+		pauseCh:     make(chan struct{}),
+		startedAt:   time.Now(),
+	}
+
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+
+	return p
+}
+
+// Submit 提交任务，不阻塞调用方；队列已满或已关闭时返回错误
+func (p *Pool) Submit(name string, run TaskFunc) error {
+	return p.submit(task{name: name, run: run})
+}
+
+// SubmitLongRunning 提交不受任务超时限制的长任务（如全量校验、重建），由任务自行响应ctx取消
+// 长任务会长时间占用一个worker
+func (p *Pool) SubmitLongRunning(name string, run TaskFunc) error {
+	return p.submit(task{name: name, run: run, longRunning: true})
+}
+
+func (p *Pool) submit(t task) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		atomic.AddInt64(&p.rejected, 1)
+		return ErrPoolClosed
+	}
+
+	select {
+	case p.queue <- t:
+		return nil
+	default:
+		atomic.AddInt64(&p.rejected, 1)
+		return ErrQueueFull
+	}
+}
+
+// Pause 暂停任务池：worker执行完当前任务后不再从队列取出新任务，
+// 队列中的任务保留，仍可提交新任务直到队列满；已暂停或已关闭时返回false
+func (p *Pool) Pause() bool {
+	// 持有读锁，避免在Shutdown恢复任务池之后再次暂停
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+
+	p.pauseMu.Lock()
+	defer p.pauseMu.Unlock()
+	if p.paused {
+		return false
+	}
+	p.paused = true
+	p.resumeCh = make(chan struct{})
+	close(p.pauseCh)
+	return true
+}
+
+// Resume 恢复已暂停的任务池，worker继续按顺序执行队列中的任务；未暂停时返回false
+func (p *Pool) Resume() bool {
+	p.pauseMu.Lock()
+	defer p.pauseMu.Unlock()
+	if !p.paused {
+		return false
+	}
+	p.paused = false
+	p.pauseCh = make(chan struct{})
+	close(p.resumeCh)
+	return true
+}
+
+// pauseState 返回是否暂停及对应的通知channel：暂停时为恢复通知，否则为暂停通知
+func (p *Pool) pauseState() (bool, chan struct{}) {
+	p.pauseMu.Lock()
+	defer p.pauseMu.Unlock()
+	if p.paused {
+		return true, p.resumeCh
+	}
+	return false, p.pauseCh
+}
+
+// Shutdown 停止接受新任务并等待队列中的任务执行完毕，已暂停的任务池先恢复以执行完队列
+// ctx到期时取消仍在执行的任务并返回ctx.Err()
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+	p.Resume()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Stats 返回当前统计
+func (p *Pool) Stats() Stats {
+	p.mu.RLock()
+	closed := p.closed
+	p.mu.RUnlock()
+
+	paused, _ := p.pauseState()
+
+	stats := Stats{
+		Workers:   p.workers,
+		Active:    atomic.LoadInt64(&p.active),
+		Queued:    len(p.queue) + int(atomic.LoadInt64(&p.held)),
+		Completed: atomic.LoadInt64(&p.completed),
+		Failed:    atomic.LoadInt64(&p.failed),
+		Rejected:  atomic.LoadInt64(&p.rejected),
+		Closed:    closed,
+		Paused:    paused,
+	}
+	if finished := stats.Completed + stats.Failed; finished > 0 {
+		stats.AvgTaskMillis = float64(atomic.LoadInt64(&p.busyNanos)) / float64(finished) / float64(time.Millisecond)
+		if elapsed := time.Since(p.startedAt); elapsed > 0 {
+			stats.ThroughputPerMinute = float64(finished) / elapsed.Minutes()
+		}
+	}
+	return stats
+}
+
+// worker 持续执行队列中的任务直到队列关闭，暂停期间等待恢复
+func (p *Pool) worker() {
+	defer p.wg.Done()
+
+	for {
+		paused, notify := p.pauseState()
+		if paused {
+			<-notify
+			continue
+		}
+
+		select {
+		case t, ok := <-p.queue:
+			if !ok {
+				return
+			}
+			p.waitResumed()
+			p.runTask(t)
+		case <-notify:
+		}
+	}
+}
+
+// waitResumed 任务与暂停同时发生时，取出的任务等到恢复后再执行
+func (p *Pool) waitResumed() {
+	for {
+		paused, resumed := p.pauseState()
+		if !paused {
+			return
+		}
+		atomic.AddInt64(&p.held, 1)
+		<-resumed
+		atomic.AddInt64(&p.held, -1)
+	}
+}
+
+// runTask 执行单个任务，捕获panic避免worker退出
+func (p *Pool) runTask(t task) {
+	atomic.AddInt64(&p.active, 1)
+	defer atomic.AddInt64(&p.active, -1)
+	started := time.Now()
+	defer func() { atomic.AddInt64(&p.busyNanos, int64(time.Since(started))) }()
+
+	ctx := p.ctx
+	if p.taskTimeout > 0 && !t.longRunning {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.taskTimeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddInt64(&p.failed, 1)
+			logger.GetLogger().WithFields(logrus.Fields{
+				"task":  t.name,
+				"panic": r,
+			}).Error("Background task panicked")
+		}
+	}()
+
+	if err := t.run(ctx); err != nil {
+		atomic.AddInt64(&p.failed, 1)
+		logger.GetLogger().WithError(err).WithField("task", t.name).Warn("Background task failed")
+		return
+	}
+	atomic.AddInt64(&p.completed, 1)
+}
+
+var (
+	defaultPool *Pool
+	defaultOnce sync.Once
+)
+
+// Init 使用指定参数初始化全局任务池，需在提交任何任务之前调用
+func Init(workers, queueSize int, taskTimeout time.Duration) {
+	defaultOnce.Do(func() {
+		defaultPool = NewPool(workers, queueSize, taskTimeout)
+	})
+}
+
+// Default 返回全局任务池，未初始化时使用默认参数创建
+func Default() *Pool {
+	defaultOnce.Do(func() {
+		defaultPool = NewPool(defaultWorkers, defaultQueueSize, defaultTaskTimeout)
+	})
+	return defaultPool
+}
+
+// Submit 向全局任务池提交任务，提交失败时记录日志
+func Submit(name string, run TaskFunc) {
+	if err := Default().Submit(name, run); err != nil {
+		logger.GetLogger().WithError(err).WithField("task", name).Warn("Background task dropped")
+	}
+}
+
+// Shutdown 关闭全局任务池
+func Shutdown(ctx context.Context) error {
+	return Default().Shutdown(ctx)
+}
+
+// GetStats 返回全局任务池统计
+func GetStats() Stats {
+	return Default().Stats()
+}
@@ -0,0 +1,241 @@
+package background
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/pkg/logger"
+)
+
+func initTestLogger(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+}
+
+func TestPoolRunsTasksWithBoundedConcurrency(t *testing.T) {
+	initTestLogger(t)
+
+	p := NewPool(2, 10, 0)
+
+	var running, maxRunning int32
+	release := make(chan struct{})
+	for i := 0; i < 6; i++ {
+		if err := p.Submit("task", func(ctx context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			<-release
+			atomic.AddInt32(&running, -1)
+			return nil
+		}); err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for p.Stats().Active != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 2 active tasks, stats: %+v", p.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if stats := p.Stats(); stats.Queued != 4 {
+		t.Errorf("Expected 4 queued tasks, got %d", stats.Queued)
+	}
+
+	close(release)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	if maxRunning > 2 {
+		t.Errorf("Expected at most 2 concurrent tasks, got %d", maxRunning)
+	}
+	stats := p.Stats()
+	if stats.Completed != 6 || stats.Active != 0 {
+		t.Errorf("Expected 6 completed and 0 active, got %+v", stats)
+	}
+	if stats.AvgTaskMillis <= 0 || stats.ThroughputPerMinute <= 0 || !stats.Closed {
+		t.Errorf("Expected timing figures and closed pool after shutdown, got %+v", stats)
+	}
+}
+
+func TestPoolRejectsWhenFullOrClosed(t *testing.T) {
+	initTestLogger(t)
+
+	p := NewPool(1, 1, 0)
+	release := make(chan struct{})
+	block := func(ctx context.Context) error {
+		<-release
+		return nil
+	}
+
+	p.Submit("running", block)
+	deadline := time.Now().Add(time.Second)
+	for p.Stats().Active != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("First task never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := p.Submit("queued", block); err != nil {
+		t.Fatalf("Expected task to be queued, got %v", err)
+	}
+	if err := p.Submit("overflow", block); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+
+	close(release)
+	p.Shutdown(context.Background())
+
+	if err := p.Submit("late", block); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Expected ErrPoolClosed after shutdown, got %v", err)
+	}
+	if stats := p.Stats(); stats.Rejected != 2 {
+		t.Errorf("Expected 2 rejected tasks, got %d", stats.Rejected)
+	}
+}
+
+func TestPoolShutdownCancelsHungTasks(t *testing.T) {
+	initTestLogger(t)
+
+	p := NewPool(1, 2, 0)
+	p.Submit("hung", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	p.Submit("panics", func(ctx context.Context) error {
+		panic("boom")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected shutdown to time out, got %v", err)
+	}
+	if stats := p.Stats(); stats.Failed != 2 || stats.Active != 0 {
+		t.Errorf("Expected 2 failed and no active tasks, got %+v", stats)
+	}
+}
+
+func TestPoolTaskTimeout(t *testing.T) {
+	initTestLogger(t)
+
+	p := NewPool(1, 1, 10*time.Millisecond)
+	done := make(chan error, 1)
+	p.Submit("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		done <- ctx.Err()
+		return ctx.Err()
+	})
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected task deadline to be exceeded, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Task timeout was not applied")
+	}
+
+	// 长任务不受超时限制，关闭时才被取消
+	p.SubmitLongRunning("long", func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			done <- ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+			done <- nil
+		}
+		return nil
+	})
+	if err := <-done; err != nil {
+		t.Errorf("Expected long-running task to outlive the task timeout, got %v", err)
+	}
+	p.Shutdown(context.Background())
+}
+
+func TestPoolPauseAndResume(t *testing.T) {
+	initTestLogger(t)
+
+	p := NewPool(2, 10, 0)
+	release := make(chan struct{})
+	var ran int32
+	p.Submit("running", func(ctx context.Context) error {
+		<-release
+		atomic.AddInt32(&ran, 1)
+		return nil
+	})
+	deadline := time.Now().Add(time.Second)
+	for p.Stats().Active != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("First task never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 暂停不中断运行中的任务，新任务留在队列中
+	if !p.Pause() || p.Pause() {
+		t.Fatal("Expected only the first Pause to change state")
+	}
+	for i := 0; i < 3; i++ {
+		if err := p.Submit("queued", func(ctx context.Context) error {
+			atomic.AddInt32(&ran, 1)
+			return nil
+		}); err != nil {
+			t.Fatalf("Expected paused pool to accept tasks, got %v", err)
+		}
+	}
+	close(release)
+	deadline = time.Now().Add(time.Second)
+	for p.Stats().Active != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Running task never finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if stats := p.Stats(); !stats.Paused || stats.Queued != 3 || atomic.LoadInt32(&ran) != 1 {
+		t.Fatalf("Expected 3 tasks kept while paused, got %+v (ran %d)", stats, ran)
+	}
+
+	// 恢复后执行队列中的任务
+	if !p.Resume() || p.Resume() {
+		t.Fatal("Expected only the first Resume to change state")
+	}
+	deadline = time.Now().Add(time.Second)
+	for atomic.LoadInt32(&ran) != 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected queued tasks to run after resume, stats: %+v", p.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if p.Stats().Paused {
+		t.Error("Expected resumed pool not to be paused")
+	}
+
+	// 关闭已暂停的任务池时先执行完队列
+	p.Pause()
+	p.Submit("drained", func(ctx context.Context) error {
+		atomic.AddInt32(&ran, 1)
+		return nil
+	})
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if atomic.LoadInt32(&ran) != 5 {
+		t.Errorf("Expected shutdown to drain the paused queue, ran %d", ran)
+	}
+	if p.Pause() {
+		t.Error("Expected a closed pool not to pause")
+	}
+}
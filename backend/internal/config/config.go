@@ -1,19 +1,38 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"ai-knowledge-app/internal/redact"
+	"ai-knowledge-app/pkg/utils"
 
 	"github.com/spf13/viper"
 )
 
 // Config 应用配置结构
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	AI       AIConfig       `mapstructure:"ai"`
-	Log      LogConfig      `mapstructure:"log"`
-	CORS     CORSConfig     `mapstructure:"cors"`
-	S3       S3Config       `mapstructure:"s3"`
+	Server     ServerConfig     `mapstructure:"server"`
+	Auth       AuthConfig       `mapstructure:"auth"`
+	Database   DatabaseConfig   `mapstructure:"database"`
+	AI         AIConfig         `mapstructure:"ai"`
+	Log        LogConfig        `mapstructure:"log"`
+	CORS       CORSConfig       `mapstructure:"cors"`
+	RateLimit  RateLimitConfig  `mapstructure:"rate_limit"`
+	S3         S3Config         `mapstructure:"s3"`
+	Upload     UploadConfig     `mapstructure:"upload"`
+	Processing ProcessingConfig `mapstructure:"processing"`
+	Scheduler  SchedulerConfig  `mapstructure:"scheduler"`
+	Background BackgroundConfig `mapstructure:"background"`
+	Knowledge  KnowledgeConfig  `mapstructure:"knowledge"`
+	Shutdown   ShutdownConfig   `mapstructure:"shutdown"`
 }
 
 // ServerConfig 服务器配置
@@ -21,6 +40,77 @@ type ServerConfig struct {
 	Host string `mapstructure:"host"`
 	Port int    `mapstructure:"port"`
 	Mode string `mapstructure:"mode"`
+
+	// 以下配置为0时使用运行模式对应的默认值（见modeDefaults）
+	MaxBodySize    int64         `mapstructure:"max_body_size"`   // 非文件上传请求体的最大字节数
+	RequestTimeout time.Duration `mapstructure:"request_timeout"` // 单个请求的处理超时
+	ReadTimeout    time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout   time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout    time.Duration `mapstructure:"idle_timeout"`
+
+	TimeFormat string `mapstructure:"time_format"` // API响应中时间字段的格式（Go时间布局），默认RFC3339
+
+	// 信任的反向代理IP或CIDR，只有来自这些地址的请求才按X-Forwarded-For/X-Real-IP识别客户端IP，
+	// 为空时直接使用连接的对端地址
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+// serverModeDefaults 按运行模式区分的服务器/中间件默认值
+type serverModeDefaults struct {
+	AllowedOrigins []string
+	MaxBodySize    int64
+	RequestTimeout time.Duration
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	IdleTimeout    time.Duration
+}
+
+// modeDefaults 返回运行模式对应的默认值
+// release模式更严格：不默认放行任何跨域来源，请求体和超时限制更小；其他模式便于本地开发
+func modeDefaults(mode string) serverModeDefaults {
+	if mode == "release" {
+		return serverModeDefaults{
+			AllowedOrigins: nil,
+			MaxBodySize:    1 << 20, // 1MB
+			RequestTimeout: 30 * time.Second,
+			ReadTimeout:    10 * time.Second,
+			WriteTimeout:   60 * time.Second,
+			IdleTimeout:    60 * time.Second,
+		}
+	}
+
+	return serverModeDefaults{
+		AllowedOrigins: []string{"http://localhost:3000", "http://localhost:5173"},
+		MaxBodySize:    10 << 20, // 10MB
+		RequestTimeout: 2 * time.Minute,
+		ReadTimeout:    0,
+		WriteTimeout:   0,
+		IdleTimeout:    0,
+	}
+}
+
+// ApplyModeDefaults 为未显式配置的项填充运行模式对应的默认值
+func (c *Config) ApplyModeDefaults() {
+	defaults := modeDefaults(c.Server.Mode)
+
+	if len(c.CORS.AllowedOrigins) == 0 {
+		c.CORS.AllowedOrigins = defaults.AllowedOrigins
+	}
+	if c.Server.MaxBodySize == 0 {
+		c.Server.MaxBodySize = defaults.MaxBodySize
+	}
+	if c.Server.RequestTimeout == 0 {
+		c.Server.RequestTimeout = defaults.RequestTimeout
+	}
+	if c.Server.ReadTimeout == 0 {
+		c.Server.ReadTimeout = defaults.ReadTimeout
+	}
+	if c.Server.WriteTimeout == 0 {
+		c.Server.WriteTimeout = defaults.WriteTimeout
+	}
+	if c.Server.IdleTimeout == 0 {
+		c.Server.IdleTimeout = defaults.IdleTimeout
+	}
 }
 
 // DatabaseConfig 数据库配置
@@ -36,9 +126,162 @@ type DatabaseConfig struct {
 
 // AIConfig AI服务配置
 type AIConfig struct {
-	Provider string       `mapstructure:"provider"`
-	OpenAI   OpenAIConfig `mapstructure:"openai"`
-	Claude   ClaudeConfig `mapstructure:"claude"`
+	Provider    string            `mapstructure:"provider"`
+	OpenAI      OpenAIConfig      `mapstructure:"openai"`
+	Claude      ClaudeConfig      `mapstructure:"claude"`
+	Embedding   EmbeddingConfig   `mapstructure:"embedding"`
+	AnswerCache AnswerCacheConfig `mapstructure:"answer_cache"`
+	AutoTag     AutoTagConfig     `mapstructure:"auto_tag"`
+	Features    FeaturesConfig    `mapstructure:"features"`
+	Redaction   RedactionConfig   `mapstructure:"redaction"`
+	Retrieval   RetrievalConfig   `mapstructure:"retrieval"`
+	HTTP        HTTPClientConfig  `mapstructure:"http"`
+
+	AnswerLanguage AnswerLanguageConfig `mapstructure:"answer_language"`
+
+	MaxConcurrentQueries int `mapstructure:"max_concurrent_queries"` // 同时进行中的AI查询上限，0表示不限制
+	MaxReturnedDocs      int `mapstructure:"max_returned_docs"`      // 查询响应中返回的相关文档/知识数量上限，0表示不限制
+	MaxConversationTurns int `mapstructure:"max_conversation_turns"` // 指定conversation_id时加载的最近问答轮数，0表示不加载会话历史
+	MaxResponseChars     int `mapstructure:"max_response_chars"`     // AI回答的最大字符数，超出部分截断并追加提示，0表示不限制
+
+	QueryTimeout    time.Duration `mapstructure:"query_timeout"`     // 单次AI查询（包括流式查询）的超时，超时后取消模型调用，0表示不限制
+	MaxQueryTimeout time.Duration `mapstructure:"max_query_timeout"` // 请求中timeout_seconds允许指定的超时上限，0表示不限制
+
+	httpClient *http.Client // 按HTTP配置创建，LoadConfig时初始化
+}
+
+// HTTPClient 返回调用外部AI/向量服务共用的HTTP客户端
+// 未通过LoadConfig加载的配置（如测试中直接构造）返回默认客户端
+func (c *AIConfig) HTTPClient() *http.Client {
+	if c.httpClient == nil {
+		return http.DefaultClient
+	}
+	return c.httpClient
+}
+
+// HTTPClientConfig 调用外部AI/向量服务的出站HTTP配置
+type HTTPClientConfig struct {
+	ProxyURL           string `mapstructure:"proxy_url"`            // 出站代理（http、https、socks5），留空时使用HTTP_PROXY/HTTPS_PROXY环境变量
+	CACertFile         string `mapstructure:"ca_cert_file"`         // 额外信任的CA证书（PEM），用于代理或内网网关的自签名证书
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // 跳过TLS证书校验，仅用于调试
+}
+
+// NewClient 按配置创建HTTP客户端，不设置整体超时（流式回答可能持续较久）
+func (h HTTPClientConfig) NewClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if h.ProxyURL != "" {
+		proxy, err := url.Parse(h.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy_url: %w", err)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("proxy_url scheme must be http, https or socks5, got %q", proxy.Scheme)
+		}
+		if proxy.Host == "" {
+			return nil, fmt.Errorf("proxy_url must include a host")
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if h.CACertFile != "" || h.InsecureSkipVerify {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: h.InsecureSkipVerify}
+		if h.CACertFile != "" {
+			pem, err := os.ReadFile(h.CACertFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read ca_cert_file: %w", err)
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("ca_cert_file %s contains no PEM certificates", h.CACertFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// EmbeddingConfig 向量生成配置
+// 更换模型或维度后需要调整数据库中向量列的维度并重建向量，见README
+type EmbeddingConfig struct {
+	Model             string        `mapstructure:"model"`              // 向量模型，如 text-embedding-ada-002、text-embedding-3-large
+	Dimensions        int           `mapstructure:"dimensions"`         // 模型输出的向量维度，与数据库向量列的维度一致
+	RequestDimensions bool          `mapstructure:"request_dimensions"` // 请求时指定维度，由模型缩短向量（仅text-embedding-3系列支持）
+	BatchSize         int           `mapstructure:"batch_size"`         // 批量生成向量时单次请求的最大文本数，超过时拆分为多次请求
+	MaxRetries        int           `mapstructure:"max_retries"`        // 返回空结果、限流（429）或服务端错误（5xx）时的最大重试次数，0表示不重试
+	RetryBackoff      time.Duration `mapstructure:"retry_backoff"`      // 首次重试等待时间，之后按backoff_factor递增
+	MaxRetryDelay     time.Duration `mapstructure:"max_retry_delay"`    // 单次重试等待时间上限，0表示不限制
+	BackoffFactor     float64       `mapstructure:"backoff_factor"`     // 每次重试等待时间的增长倍数
+	Normalize         bool          `mapstructure:"normalize"`          // 将知识和查询向量L2归一化为单位长度，使用内积距离时应开启
+	CacheSize         int           `mapstructure:"cache_size"`         // 单条文本向量的内存LRU缓存条目数，相同文本不再重复请求，0表示不缓存
+	MinContentLength  int           `mapstructure:"min_content_length"` // 知识内容（去除首尾空白后）少于该字符数时不生成向量，只能通过关键词搜索，0表示不限制
+}
+
+// AnswerCacheConfig AI回答缓存配置
+type AnswerCacheConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	TTL        time.Duration `mapstructure:"ttl"`         // 缓存有效期，知识变更时提前失效
+	MaxEntries int           `mapstructure:"max_entries"` // 最大缓存条目数
+}
+
+// FeaturesConfig AI查询功能的默认开关，可被请求中的同名开关覆盖
+// 缓存的默认开关由answer_cache.enabled决定
+type FeaturesConfig struct {
+	Retrieval bool `mapstructure:"retrieval"` // 检索相关知识作为上下文
+	Rerank    bool `mapstructure:"rerank"`    // 按问题关键词对检索结果重排序
+	Citations bool `mapstructure:"citations"` // 要求回答标注引用的知识并返回引用列表
+}
+
+// RetrievalConfig 知识向量检索配置，可被请求中的top_k、max_distance覆盖
+type RetrievalConfig struct {
+	TopK        int     `mapstructure:"top_k"`        // 写入提示的相关知识数量上限
+	MaxDistance float64 `mapstructure:"max_distance"` // 向量L2距离上限，超过视为不相关；0表示不限制
+}
+
+// AnswerLanguageConfig 回答语言配置
+// 检索到的知识与问题语言不同时，模型容易跟随知识的语言回答
+type AnswerLanguageConfig struct {
+	MatchQuery bool   `mapstructure:"match_query"` // 使用问题的语言回答，不受检索到的知识语言影响
+	Fallback   string `mapstructure:"fallback"`    // 无法判断问题语言或未启用match_query时的回答语言，如zh、en
+}
+
+// RedactionConfig 发送给外部向量/LLM服务前的敏感信息脱敏配置，数据库中保存的原文不受影响
+type RedactionConfig struct {
+	Enabled  bool                     `mapstructure:"enabled"`
+	Builtin  []string                 `mapstructure:"builtin"`  // 启用的内置规则：email, phone, id_card
+	Patterns []RedactionPatternConfig `mapstructure:"patterns"` // 自定义正则规则，在内置规则之后应用
+}
+
+// RedactionPatternConfig 自定义脱敏规则
+type RedactionPatternConfig struct {
+	Name        string `mapstructure:"name"`
+	Regex       string `mapstructure:"regex"`
+	Replacement string `mapstructure:"replacement"` // 为空时替换为"[名称大写]"
+}
+
+// Redactor 按配置创建脱敏器，未启用时返回nil
+func (r RedactionConfig) Redactor() (*redact.Redactor, error) {
+	if !r.Enabled {
+		return nil, nil
+	}
+	patterns := make([]redact.Pattern, len(r.Patterns))
+	for i, p := range r.Patterns {
+		patterns[i] = redact.Pattern{Name: p.Name, Regex: p.Regex, Replacement: p.Replacement}
+	}
+	return redact.New(r.Builtin, patterns)
+}
+
+// AutoTagConfig 知识自动打标签配置
+type AutoTagConfig struct {
+	Enabled      bool `mapstructure:"enabled"`       // 创建/更新知识时自动推荐并附加标签
+	ExistingOnly bool `mapstructure:"existing_only"` // 只从已有标签中选择，不创建新标签
 }
 
 // OpenAIConfig OpenAI配置
@@ -59,6 +302,11 @@ type ClaudeConfig struct {
 type LogConfig struct {
 	Level  string `mapstructure:"level"`
 	Format string `mapstructure:"format"`
+
+	// 访问日志排除的路由，用于减少健康检查、指标采集等高频请求的日志量
+	AccessSkipPaths    []string `mapstructure:"access_skip_paths"`    // 精确匹配的路径
+	AccessSkipPrefixes []string `mapstructure:"access_skip_prefixes"` // 路径前缀
+	AccessKeepErrors   bool     `mapstructure:"access_keep_errors"`   // 排除的路由上出错的请求仍然记录
 }
 
 // CORSConfig CORS配置
@@ -68,6 +316,46 @@ type CORSConfig struct {
 	AllowedHeaders []string `mapstructure:"allowed_headers"`
 }
 
+// RateLimitConfig 按客户端IP的速率限制配置
+type RateLimitConfig struct {
+	Enabled           bool     `mapstructure:"enabled"`
+	RequestsPerSecond float64  `mapstructure:"requests_per_second"` // 每个IP每秒补充的请求数
+	Burst             int      `mapstructure:"burst"`               // 每个IP允许的突发请求数
+	Allowlist         []string `mapstructure:"allowlist"`           // 不受限制的IP或CIDR，如内部服务
+	// 多副本部署时配置Redis共享计数，为空时使用各实例独立的内存限流器
+	RedisAddr      string        `mapstructure:"redis_addr"`
+	RedisPassword  string        `mapstructure:"redis_password"`
+	RedisDB        int           `mapstructure:"redis_db"`
+	RedisKeyPrefix string        `mapstructure:"redis_key_prefix"`
+	RedisTimeout   time.Duration `mapstructure:"redis_timeout"` // 单次Redis操作超时，超时后退回内存限流器
+}
+
+// validate 校验速率限制配置，白名单中的每一项必须是IP或CIDR
+func (c RateLimitConfig) validate() error {
+	if c.Enabled && (c.RequestsPerSecond <= 0 || c.Burst < 1) {
+		return fmt.Errorf("rate_limit requests_per_second and burst must be positive")
+	}
+	if c.RedisDB < 0 || c.RedisTimeout < 0 {
+		return fmt.Errorf("rate_limit redis_db and redis_timeout must not be negative")
+	}
+	for _, entry := range c.Allowlist {
+		if strings.TrimSpace(entry) != "" && !isIPOrCIDR(entry) {
+			return fmt.Errorf("rate_limit allowlist entry %q is not an IP or CIDR", entry)
+		}
+	}
+	return nil
+}
+
+// isIPOrCIDR 判断是否为单个IP或CIDR网段
+func isIPOrCIDR(entry string) bool {
+	entry = strings.TrimSpace(entry)
+	if net.ParseIP(entry) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(entry)
+	return err == nil
+}
+
 // S3Config S3兼容对象存储配置
 type S3Config struct {
 	Endpoint        string `mapstructure:"endpoint"`
@@ -76,6 +364,190 @@ type S3Config struct {
 	UseSSL          bool   `mapstructure:"use_ssl"`
 	Bucket          string `mapstructure:"bucket"`
 	Region          string `mapstructure:"region"`
+
+	PresignExpiry time.Duration `mapstructure:"presign_expiry"` // 预签名下载链接有效期（1秒~7天）
+}
+
+// maxPresignExpiry S3签名V4允许的最长有效期
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// AuthConfig 认证配置
+type AuthConfig struct {
+	// Enabled 开启后POST/PUT/PATCH/DELETE请求需要携带有效的Bearer JWT，GET请求保持公开
+	Enabled   bool          `mapstructure:"enabled"`
+	JWTSecret string        `mapstructure:"jwt_secret"` // HS256签名密钥，至少32字节
+	TokenTTL  time.Duration `mapstructure:"token_ttl"`  // 签发令牌的有效期
+	// AdminUsers 允许访问/admin运维接口的用户ID（JWT的sub），为空时运维接口对所有用户返回403
+	AdminUsers []string `mapstructure:"admin_users"`
+}
+
+// minJWTSecretLength HS256密钥的最小长度
+const minJWTSecretLength = 32
+
+// validate 开启认证时检查密钥与有效期
+func (a AuthConfig) validate() error {
+	if !a.Enabled {
+		return nil
+	}
+	if len(a.JWTSecret) < minJWTSecretLength {
+		return fmt.Errorf("auth jwt_secret must be at least %d bytes when auth is enabled", minJWTSecretLength)
+	}
+	if a.TokenTTL <= 0 {
+		return fmt.Errorf("auth token_ttl must be positive")
+	}
+	return nil
+}
+
+// UploadConfig 文件上传配置
+type UploadConfig struct {
+	// MaxFileSize 单个文件允许上传的最大字节数，0表示不限制
+	MaxFileSize int64 `mapstructure:"max_file_size"`
+	// StrictDeduplication 秒传前逐字节比较上传内容与已存储的文件，而不是只比较哈希和大小；
+	// 分片上传初始化时只有客户端提供的哈希，开启后不再秒传
+	StrictDeduplication bool `mapstructure:"strict_deduplication"`
+	// NearDuplicateMaxDistance 文档处理时按正文SimHash指纹查找汉明距离不超过该位数（1-3）的已有文档，
+	// 记录为文档的near_duplicate_id作为建议，不会自动引用已有文件；0表示不检测
+	NearDuplicateMaxDistance int `mapstructure:"near_duplicate_max_distance"`
+}
+
+// ProcessingConfig 文档处理（解析、清洗、分块）配置
+type ProcessingConfig struct {
+	ChunkStrategy   string   `mapstructure:"chunk_strategy"`   // 分块策略：fixed, sentence, paragraph, markdown, recursive
+	ChunkSize       int      `mapstructure:"chunk_size"`       // 分块大小（字符数）
+	ChunkOverlap    int      `mapstructure:"chunk_overlap"`    // 相邻分块重叠的字符数，仅fixed、recursive策略使用，须小于chunk_size
+	ChunkSeparators []string `mapstructure:"chunk_separators"` // recursive策略按优先级使用的分隔符，留空使用内置列表
+	MinChunkSize    int      `mapstructure:"min_chunk_size"`   // recursive策略丢弃小于此字符数的分块，0表示不丢弃
+	MaxParseSize    int64    `mapstructure:"max_parse_size"`   // 解析文件的最大字节数，0表示不限制
+
+	// ChunkSaveBatchSize 保存分块时每条INSERT语句插入的分块数，0使用默认值100，超过数据库驱动参数上限时自动减小
+	ChunkSaveBatchSize int `mapstructure:"chunk_save_batch_size"`
+
+	// ChunkMetadataSchema 分块元数据须满足的结构，fields为空时不校验
+	ChunkMetadataSchema ChunkMetadataSchemaConfig `mapstructure:"chunk_metadata_schema"`
+}
+
+// ChunkMetadataSchemaConfig 分块元数据结构：必需的键及各键的值类型，未列出的键不受限制
+type ChunkMetadataSchemaConfig struct {
+	Mode   string                     `mapstructure:"mode"` // warn：记录警告后照常保存；reject：处理失败，手动修改返回422
+	Fields []ChunkMetadataFieldConfig `mapstructure:"fields"`
+}
+
+// ChunkMetadataFieldConfig 分块元数据中一个键的约束
+type ChunkMetadataFieldConfig struct {
+	Key      string `mapstructure:"key"`
+	Type     string `mapstructure:"type"` // string, number, boolean, array, object
+	Required bool   `mapstructure:"required"`
+}
+
+// validate 检查模式和字段定义
+func (m ChunkMetadataSchemaConfig) validate() error {
+	switch m.Mode {
+	case "", "warn", "reject":
+	default:
+		return fmt.Errorf("processing chunk_metadata_schema mode must be warn or reject")
+	}
+	seen := make(map[string]bool, len(m.Fields))
+	for _, field := range m.Fields {
+		if field.Key == "" || seen[field.Key] {
+			return fmt.Errorf("processing chunk_metadata_schema field keys must be non-empty and unique")
+		}
+		seen[field.Key] = true
+		switch field.Type {
+		case "string", "number", "boolean", "array", "object":
+		default:
+			return fmt.Errorf("processing chunk_metadata_schema field %q type must be one of string, number, boolean, array, object", field.Key)
+		}
+	}
+	return nil
+}
+
+// validate 检查分块参数
+func (p ProcessingConfig) validate() error {
+	switch p.ChunkStrategy {
+	case "fixed", "sentence", "paragraph", "markdown", "recursive":
+	default:
+		return fmt.Errorf("processing chunk_strategy must be one of fixed, sentence, paragraph, markdown, recursive")
+	}
+	if p.ChunkSize <= 0 {
+		return fmt.Errorf("processing chunk_size must be positive")
+	}
+	if p.ChunkOverlap < 0 || p.ChunkOverlap >= p.ChunkSize {
+		return fmt.Errorf("processing chunk_overlap must be between 0 and chunk_size")
+	}
+	if p.MinChunkSize < 0 || p.MinChunkSize > p.ChunkSize {
+		return fmt.Errorf("processing min_chunk_size must be between 0 and chunk_size")
+	}
+	for _, sep := range p.ChunkSeparators {
+		if sep == "" {
+			return fmt.Errorf("processing chunk_separators must not contain empty strings")
+		}
+	}
+	if p.MaxParseSize < 0 {
+		return fmt.Errorf("processing max_parse_size must not be negative")
+	}
+	if p.ChunkSaveBatchSize < 0 || p.ChunkSaveBatchSize > 10000 {
+		return fmt.Errorf("processing chunk_save_batch_size must be between 0 and 10000")
+	}
+	return p.ChunkMetadataSchema.validate()
+}
+
+// SchedulerConfig 后台定时任务配置
+type SchedulerConfig struct {
+	// StorageStatsInterval 存储统计采样间隔，0表示禁用
+	StorageStatsInterval time.Duration `mapstructure:"storage_stats_interval"`
+	// StorageStatsRetention 存储统计采样保留时长，0表示永久保留
+	StorageStatsRetention time.Duration `mapstructure:"storage_stats_retention"`
+	// UploadSessionCleanupInterval 过期上传会话（含未完成的S3分片上传）清理间隔，0表示禁用
+	UploadSessionCleanupInterval time.Duration `mapstructure:"upload_session_cleanup_interval"`
+	// ProcessingRetryInterval 检查并自动重试处理失败文档的间隔，0表示禁用
+	ProcessingRetryInterval time.Duration `mapstructure:"processing_retry_interval"`
+	// ProcessingRetryMax 每个文档最多自动重试的次数，用完后保持failed等待手动处理
+	ProcessingRetryMax int `mapstructure:"processing_retry_max"`
+	// ProcessingRetryMaxAge 只自动重试在该时长内失败的文档，0表示不限制
+	ProcessingRetryMaxAge time.Duration `mapstructure:"processing_retry_max_age"`
+	// ProcessingRetryBackoff 失败后首次重试前的等待时间，之后每次重试翻倍
+	ProcessingRetryBackoff time.Duration `mapstructure:"processing_retry_backoff"`
+}
+
+// 标题修改时slug的处理方式
+const (
+	SlugPreserve   = "preserve"   // 保留原slug，已分享的链接继续有效
+	SlugRegenerate = "regenerate" // 按新标题重新生成
+)
+
+// KnowledgeConfig 知识库配置
+type KnowledgeConfig struct {
+	DefaultSort       string `mapstructure:"default_sort"`         // 列表默认排序字段
+	DefaultOrder      string `mapstructure:"default_order"`        // 列表默认排序方向：asc、desc
+	SlugOnTitleChange string `mapstructure:"slug_on_title_change"` // 标题修改时slug的处理方式：preserve、regenerate
+	SnippetLength     int    `mapstructure:"snippet_length"`       // 列表和搜索结果中摘要片段的字符数，0表示返回完整内容
+	SearchMaxResults  int    `mapstructure:"search_max_results"`   // 列表和搜索单页返回的最大条数
+	RelatedLimit      int    `mapstructure:"related_limit"`        // 相关知识默认返回条数
+	RelatedMaxLimit   int    `mapstructure:"related_max_limit"`    // 相关知识请求limit参数的上限
+}
+
+// RegenerateSlug 标题修改时是否重新生成slug
+func (k KnowledgeConfig) RegenerateSlug() bool {
+	return k.SlugOnTitleChange == SlugRegenerate
+}
+
+// BackgroundConfig 后台异步任务配置
+type BackgroundConfig struct {
+	Workers     int           `mapstructure:"workers"`      // 并发执行的worker数量
+	QueueSize   int           `mapstructure:"queue_size"`   // 等待执行的任务队列长度，满时新任务被丢弃
+	TaskTimeout time.Duration `mapstructure:"task_timeout"` // 单个任务超时，0表示不限制
+	RetryAfter  time.Duration `mapstructure:"retry_after"`  // 队列已满返回429时通过Retry-After建议的等待时间
+}
+
+// ShutdownConfig 优雅关闭配置
+// 各子系统按HTTP、定时任务、后台任务、数据库的顺序关闭，预算之和不能超过总时长
+// 定时任务会向后台任务池提交任务，因此先于后台任务池停止
+type ShutdownConfig struct {
+	Timeout           time.Duration `mapstructure:"timeout"`            // 关闭流程的总时长上限
+	HTTPTimeout       time.Duration `mapstructure:"http_timeout"`       // 等待进行中的HTTP请求完成
+	SchedulerTimeout  time.Duration `mapstructure:"scheduler_timeout"`  // 等待正在执行的定时任务结束
+	BackgroundTimeout time.Duration `mapstructure:"background_timeout"` // 等待后台任务队列执行完毕
+	DatabaseTimeout   time.Duration `mapstructure:"database_timeout"`   // 关闭数据库连接
 }
 
 // Validate 验证配置
@@ -84,6 +556,141 @@ func (c *Config) Validate() error {
 	if err := c.S3.Validate(); err != nil {
 		return fmt.Errorf("S3 configuration error: %w", err)
 	}
+	// 时间格式至少要包含一个时间布局元素，否则所有时间都输出为同一个字符串
+	if c.Server.TimeFormat == "" || time.Unix(0, 0).UTC().Format(c.Server.TimeFormat) == c.Server.TimeFormat {
+		return fmt.Errorf("server time_format must be a Go time layout such as %q", time.RFC3339)
+	}
+	if c.Server.MaxBodySize < 0 {
+		return fmt.Errorf("server max_body_size must not be negative")
+	}
+	if c.Server.RequestTimeout < 0 || c.Server.ReadTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.IdleTimeout < 0 {
+		return fmt.Errorf("server timeouts must not be negative")
+	}
+	if c.Knowledge.DefaultOrder != "asc" && c.Knowledge.DefaultOrder != "desc" {
+		return fmt.Errorf("knowledge default_order must be asc or desc")
+	}
+	if c.Knowledge.SlugOnTitleChange != SlugPreserve && c.Knowledge.SlugOnTitleChange != SlugRegenerate {
+		return fmt.Errorf("knowledge slug_on_title_change must be preserve or regenerate")
+	}
+	if c.Knowledge.SnippetLength < 0 {
+		return fmt.Errorf("knowledge snippet_length must not be negative")
+	}
+	if c.Knowledge.SearchMaxResults < 1 || c.Knowledge.SearchMaxResults > 100 {
+		return fmt.Errorf("knowledge search_max_results must be between 1 and 100")
+	}
+	if c.Knowledge.RelatedMaxLimit < 1 {
+		return fmt.Errorf("knowledge related_max_limit must be positive")
+	}
+	if c.Knowledge.RelatedLimit < 1 || c.Knowledge.RelatedLimit > c.Knowledge.RelatedMaxLimit {
+		return fmt.Errorf("knowledge related_limit must be between 1 and related_max_limit")
+	}
+	for _, entry := range c.Server.TrustedProxies {
+		if !isIPOrCIDR(entry) {
+			return fmt.Errorf("server trusted_proxies entry %q is not an IP or CIDR", entry)
+		}
+	}
+	if err := c.RateLimit.validate(); err != nil {
+		return err
+	}
+	if c.Background.Workers < 0 || c.Background.QueueSize < 0 || c.Background.TaskTimeout < 0 || c.Background.RetryAfter < 0 {
+		return fmt.Errorf("background workers, queue_size, task_timeout and retry_after must not be negative")
+	}
+	if err := c.Shutdown.validate(); err != nil {
+		return err
+	}
+	if err := c.Auth.validate(); err != nil {
+		return err
+	}
+	if c.Upload.MaxFileSize < 0 {
+		return fmt.Errorf("upload max_file_size must not be negative")
+	}
+	if c.Upload.NearDuplicateMaxDistance < 0 || c.Upload.NearDuplicateMaxDistance > 3 {
+		return fmt.Errorf("upload near_duplicate_max_distance must be between 0 and 3")
+	}
+	if c.Scheduler.ProcessingRetryMax < 0 || c.Scheduler.ProcessingRetryMaxAge < 0 || c.Scheduler.ProcessingRetryBackoff < 0 {
+		return fmt.Errorf("scheduler processing_retry_max, processing_retry_max_age and processing_retry_backoff must not be negative")
+	}
+	if err := c.Processing.validate(); err != nil {
+		return err
+	}
+	if c.AI.MaxConcurrentQueries < 0 {
+		return fmt.Errorf("ai max_concurrent_queries must not be negative")
+	}
+	if c.AI.Retrieval.TopK < 1 || c.AI.Retrieval.TopK > 50 {
+		return fmt.Errorf("ai retrieval top_k must be between 1 and 50")
+	}
+	if c.AI.Retrieval.MaxDistance < 0 {
+		return fmt.Errorf("ai retrieval max_distance must not be negative")
+	}
+	if !utils.IsValidLanguage(utils.NormalizeLanguage(c.AI.AnswerLanguage.Fallback)) {
+		return fmt.Errorf("invalid ai answer_language fallback: %q", c.AI.AnswerLanguage.Fallback)
+	}
+	if c.AI.MaxReturnedDocs < 0 {
+		return fmt.Errorf("ai max_returned_docs must not be negative")
+	}
+	if c.AI.MaxConversationTurns < 0 || c.AI.MaxConversationTurns > 50 {
+		return fmt.Errorf("ai max_conversation_turns must be between 0 and 50")
+	}
+	if c.AI.MaxResponseChars < 0 {
+		return fmt.Errorf("ai max_response_chars must not be negative")
+	}
+	if c.AI.QueryTimeout < 0 || c.AI.MaxQueryTimeout < 0 {
+		return fmt.Errorf("ai query_timeout and max_query_timeout must not be negative")
+	}
+	if c.AI.MaxQueryTimeout > 0 && (c.AI.QueryTimeout == 0 || c.AI.QueryTimeout > c.AI.MaxQueryTimeout) {
+		return fmt.Errorf("ai query_timeout must be set and not exceed max_query_timeout")
+	}
+	if c.AI.Embedding.MaxRetries < 0 {
+		return fmt.Errorf("ai embedding max_retries must not be negative")
+	}
+	if c.AI.Embedding.RetryBackoff < 0 || c.AI.Embedding.MaxRetryDelay < 0 {
+		return fmt.Errorf("ai embedding retry_backoff and max_retry_delay must not be negative")
+	}
+	if c.AI.Embedding.BackoffFactor < 1 || c.AI.Embedding.BackoffFactor > 10 {
+		return fmt.Errorf("ai embedding backoff_factor must be between 1 and 10")
+	}
+	if c.AI.Embedding.CacheSize < 0 {
+		return fmt.Errorf("ai embedding cache_size must not be negative")
+	}
+	if c.AI.Embedding.MinContentLength < 0 {
+		return fmt.Errorf("ai embedding min_content_length must not be negative")
+	}
+	// OpenAI单次请求最多2048条输入
+	if c.AI.Embedding.BatchSize < 1 || c.AI.Embedding.BatchSize > 2048 {
+		return fmt.Errorf("ai embedding batch_size must be between 1 and 2048")
+	}
+	if c.AI.Embedding.Model == "" {
+		return fmt.Errorf("ai embedding model is required")
+	}
+	// pgvector的vector类型最多支持16000维
+	if c.AI.Embedding.Dimensions < 1 || c.AI.Embedding.Dimensions > 16000 {
+		return fmt.Errorf("ai embedding dimensions must be between 1 and 16000")
+	}
+	if c.AI.AnswerCache.TTL < 0 || c.AI.AnswerCache.MaxEntries < 0 {
+		return fmt.Errorf("ai answer_cache ttl and max_entries must not be negative")
+	}
+	if _, err := c.AI.Redaction.Redactor(); err != nil {
+		return fmt.Errorf("ai redaction configuration error: %w", err)
+	}
+	if _, err := c.AI.HTTP.NewClient(); err != nil {
+		return fmt.Errorf("ai http configuration error: %w", err)
+	}
+	return nil
+}
+
+// validate 检查各子系统的关闭预算
+func (c ShutdownConfig) validate() error {
+	budgets := []time.Duration{c.HTTPTimeout, c.BackgroundTimeout, c.SchedulerTimeout, c.DatabaseTimeout}
+	var sum time.Duration
+	for _, b := range budgets {
+		if b <= 0 {
+			return fmt.Errorf("shutdown timeouts must be positive")
+		}
+		sum += b
+	}
+	if sum > c.Timeout {
+		return fmt.Errorf("shutdown sub-timeouts (%s) exceed overall shutdown timeout (%s)", sum, c.Timeout)
+	}
 	return nil
 }
 
@@ -104,6 +711,9 @@ func (s *S3Config) Validate() error {
 	if s.Region == "" {
 		return fmt.Errorf("S3 region is required")
 	}
+	if s.PresignExpiry < time.Second || s.PresignExpiry > maxPresignExpiry {
+		return fmt.Errorf("S3 presign_expiry must be between 1s and %s", maxPresignExpiry)
+	}
 	return nil
 }
 
@@ -115,6 +725,9 @@ func LoadConfig() (*Config, error) {
 	viper.AddConfigPath(".")
 	viper.AddConfigPath("..")
 
+	// 设置默认值
+	setDefaults()
+
 	// 绑定环境变量
 	bindEnvVars()
 
@@ -145,20 +758,115 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	// 填充运行模式对应的默认值
+	config.ApplyModeDefaults()
+
 	// 验证配置
 	if err := config.Validate(); err != nil {
 		return nil, err
 	}
 
+	// AI、向量服务和模型列表共用同一个出站HTTP客户端
+	httpClient, err := config.AI.HTTP.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	config.AI.httpClient = httpClient
+
 	return &config, nil
 }
 
+// setDefaults 设置配置默认值
+func setDefaults() {
+	viper.SetDefault("s3.presign_expiry", "15m")
+	viper.SetDefault("server.time_format", time.RFC3339)
+	viper.SetDefault("log.access_skip_paths", []string{"/health", "/metrics"})
+	viper.SetDefault("log.access_skip_prefixes", []string{"/swagger/"})
+	viper.SetDefault("log.access_keep_errors", true)
+	viper.SetDefault("rate_limit.enabled", true)
+	viper.SetDefault("rate_limit.requests_per_second", 10)
+	viper.SetDefault("rate_limit.burst", 20)
+	viper.SetDefault("rate_limit.allowlist", []string{})
+	viper.SetDefault("rate_limit.redis_key_prefix", "ratelimit:")
+	viper.SetDefault("rate_limit.redis_timeout", "200ms")
+	viper.SetDefault("ai.max_concurrent_queries", 10)
+	viper.SetDefault("ai.max_returned_docs", 5)
+	viper.SetDefault("ai.max_conversation_turns", 5)
+	viper.SetDefault("ai.max_response_chars", 50000)
+	viper.SetDefault("ai.query_timeout", "60s")
+	viper.SetDefault("ai.max_query_timeout", "5m")
+	viper.SetDefault("ai.embedding.model", "text-embedding-ada-002")
+	viper.SetDefault("ai.embedding.dimensions", 1536)
+	viper.SetDefault("ai.embedding.request_dimensions", false)
+	viper.SetDefault("ai.embedding.batch_size", 100)
+	viper.SetDefault("ai.embedding.max_retries", 2)
+	viper.SetDefault("ai.embedding.retry_backoff", "500ms")
+	viper.SetDefault("ai.embedding.max_retry_delay", "10s")
+	viper.SetDefault("ai.embedding.backoff_factor", 2.0)
+	viper.SetDefault("ai.embedding.normalize", false)
+	viper.SetDefault("ai.embedding.cache_size", 1000)
+	viper.SetDefault("ai.embedding.min_content_length", 0)
+	viper.SetDefault("ai.features.retrieval", true)
+	viper.SetDefault("ai.features.rerank", false)
+	viper.SetDefault("ai.features.citations", false)
+	viper.SetDefault("ai.retrieval.top_k", 5)
+	viper.SetDefault("ai.retrieval.max_distance", 0)
+	viper.SetDefault("ai.answer_language.match_query", true)
+	viper.SetDefault("ai.answer_language.fallback", "zh")
+	viper.SetDefault("ai.redaction.enabled", false)
+	viper.SetDefault("ai.redaction.builtin", redact.BuiltinNames())
+	viper.SetDefault("ai.auto_tag.enabled", false)
+	viper.SetDefault("ai.auto_tag.existing_only", false)
+	viper.SetDefault("ai.answer_cache.enabled", true)
+	viper.SetDefault("ai.answer_cache.ttl", "10m")
+	viper.SetDefault("ai.answer_cache.max_entries", 1000)
+	viper.SetDefault("ai.http.insecure_skip_verify", false)
+	viper.SetDefault("knowledge.default_sort", "created_at")
+	viper.SetDefault("knowledge.default_order", "desc")
+	viper.SetDefault("knowledge.slug_on_title_change", SlugPreserve)
+	viper.SetDefault("knowledge.snippet_length", 200)
+	viper.SetDefault("knowledge.search_max_results", 100)
+	viper.SetDefault("knowledge.related_limit", 5)
+	viper.SetDefault("knowledge.related_max_limit", 20)
+	viper.SetDefault("background.workers", 8)
+	viper.SetDefault("background.queue_size", 256)
+	viper.SetDefault("background.task_timeout", "2m")
+	viper.SetDefault("background.retry_after", "5s")
+	viper.SetDefault("shutdown.timeout", "30s")
+	viper.SetDefault("shutdown.http_timeout", "15s")
+	viper.SetDefault("shutdown.background_timeout", "10s")
+	viper.SetDefault("shutdown.scheduler_timeout", "3s")
+	viper.SetDefault("shutdown.database_timeout", "2s")
+	viper.SetDefault("auth.enabled", false)
+	viper.SetDefault("auth.token_ttl", "24h")
+	viper.SetDefault("processing.chunk_strategy", "fixed")
+	viper.SetDefault("processing.chunk_size", 500)
+	viper.SetDefault("processing.chunk_overlap", 50)
+	viper.SetDefault("processing.max_parse_size", 52428800)
+	viper.SetDefault("processing.chunk_save_batch_size", 100)
+	viper.SetDefault("processing.chunk_metadata_schema.mode", "warn")
+	viper.SetDefault("scheduler.storage_stats_interval", "1h")
+	viper.SetDefault("scheduler.storage_stats_retention", "2160h")
+	viper.SetDefault("scheduler.upload_session_cleanup_interval", "1h")
+	viper.SetDefault("scheduler.processing_retry_interval", "5m")
+	viper.SetDefault("scheduler.processing_retry_max", 3)
+	viper.SetDefault("scheduler.processing_retry_max_age", "24h")
+	viper.SetDefault("scheduler.processing_retry_backoff", "1m")
+}
+
 // bindEnvVars 绑定环境变量到配置键
 func bindEnvVars() {
 	// Server environment variable bindings
 	viper.BindEnv("server.host", "SERVER_HOST")
 	viper.BindEnv("server.port", "SERVER_PORT")
 	viper.BindEnv("server.mode", "GIN_MODE")
+	viper.BindEnv("server.max_body_size", "SERVER_MAX_BODY_SIZE")
+	viper.BindEnv("server.request_timeout", "SERVER_REQUEST_TIMEOUT")
+	viper.BindEnv("server.read_timeout", "SERVER_READ_TIMEOUT")
+	viper.BindEnv("server.write_timeout", "SERVER_WRITE_TIMEOUT")
+	viper.BindEnv("server.idle_timeout", "SERVER_IDLE_TIMEOUT")
+	viper.BindEnv("server.time_format", "SERVER_TIME_FORMAT")
+	viper.BindEnv("server.trusted_proxies", "SERVER_TRUSTED_PROXIES")
 
 	// Database environment variable bindings
 	viper.BindEnv("database.type", "DB_TYPE")
@@ -177,16 +885,86 @@ func bindEnvVars() {
 	viper.BindEnv("ai.claude.api_key", "CLAUDE_API_KEY")
 	viper.BindEnv("ai.claude.base_url", "CLAUDE_BASE_URL")
 	viper.BindEnv("ai.claude.model", "CLAUDE_MODEL")
+	viper.BindEnv("ai.max_concurrent_queries", "AI_MAX_CONCURRENT_QUERIES")
+	viper.BindEnv("ai.max_returned_docs", "AI_MAX_RETURNED_DOCS")
+	viper.BindEnv("ai.max_conversation_turns", "AI_MAX_CONVERSATION_TURNS")
+	viper.BindEnv("ai.max_response_chars", "AI_MAX_RESPONSE_CHARS")
+	viper.BindEnv("ai.query_timeout", "AI_QUERY_TIMEOUT")
+	viper.BindEnv("ai.max_query_timeout", "AI_MAX_QUERY_TIMEOUT")
+	viper.BindEnv("ai.embedding.model", "AI_EMBEDDING_MODEL")
+	viper.BindEnv("ai.embedding.dimensions", "AI_EMBEDDING_DIMENSIONS")
+	viper.BindEnv("ai.embedding.request_dimensions", "AI_EMBEDDING_REQUEST_DIMENSIONS")
+	viper.BindEnv("ai.embedding.batch_size", "AI_EMBEDDING_BATCH_SIZE")
+	viper.BindEnv("ai.embedding.max_retries", "AI_EMBEDDING_MAX_RETRIES")
+	viper.BindEnv("ai.embedding.retry_backoff", "AI_EMBEDDING_RETRY_BACKOFF")
+	viper.BindEnv("ai.embedding.max_retry_delay", "AI_EMBEDDING_MAX_RETRY_DELAY")
+	viper.BindEnv("ai.embedding.backoff_factor", "AI_EMBEDDING_BACKOFF_FACTOR")
+	viper.BindEnv("ai.embedding.normalize", "AI_EMBEDDING_NORMALIZE")
+	viper.BindEnv("ai.embedding.cache_size", "AI_EMBEDDING_CACHE_SIZE")
+	viper.BindEnv("ai.embedding.min_content_length", "AI_EMBEDDING_MIN_CONTENT_LENGTH")
+	viper.BindEnv("ai.features.retrieval", "AI_FEATURES_RETRIEVAL")
+	viper.BindEnv("ai.features.rerank", "AI_FEATURES_RERANK")
+	viper.BindEnv("ai.features.citations", "AI_FEATURES_CITATIONS")
+	viper.BindEnv("ai.retrieval.top_k", "AI_RETRIEVAL_TOP_K")
+	viper.BindEnv("ai.retrieval.max_distance", "AI_RETRIEVAL_MAX_DISTANCE")
+	viper.BindEnv("ai.answer_language.match_query", "AI_ANSWER_LANGUAGE_MATCH_QUERY")
+	viper.BindEnv("ai.answer_language.fallback", "AI_ANSWER_LANGUAGE_FALLBACK")
+	viper.BindEnv("ai.redaction.enabled", "AI_REDACTION_ENABLED")
+	viper.BindEnv("ai.redaction.builtin", "AI_REDACTION_BUILTIN")
+	viper.BindEnv("ai.auto_tag.enabled", "AI_AUTO_TAG_ENABLED")
+	viper.BindEnv("ai.auto_tag.existing_only", "AI_AUTO_TAG_EXISTING_ONLY")
+	viper.BindEnv("ai.answer_cache.enabled", "AI_ANSWER_CACHE_ENABLED")
+	viper.BindEnv("ai.answer_cache.ttl", "AI_ANSWER_CACHE_TTL")
+	viper.BindEnv("ai.answer_cache.max_entries", "AI_ANSWER_CACHE_MAX_ENTRIES")
+	viper.BindEnv("ai.http.proxy_url", "AI_HTTP_PROXY_URL")
+	viper.BindEnv("ai.http.ca_cert_file", "AI_HTTP_CA_CERT_FILE")
+	viper.BindEnv("ai.http.insecure_skip_verify", "AI_HTTP_INSECURE_SKIP_VERIFY")
+
+	// Knowledge environment variable bindings
+	viper.BindEnv("knowledge.default_sort", "KNOWLEDGE_DEFAULT_SORT")
+	viper.BindEnv("knowledge.slug_on_title_change", "KNOWLEDGE_SLUG_ON_TITLE_CHANGE")
+	viper.BindEnv("knowledge.default_order", "KNOWLEDGE_DEFAULT_ORDER")
+	viper.BindEnv("knowledge.snippet_length", "KNOWLEDGE_SNIPPET_LENGTH")
+	viper.BindEnv("knowledge.search_max_results", "KNOWLEDGE_SEARCH_MAX_RESULTS")
+	viper.BindEnv("knowledge.related_limit", "KNOWLEDGE_RELATED_LIMIT")
+	viper.BindEnv("knowledge.related_max_limit", "KNOWLEDGE_RELATED_MAX_LIMIT")
+
+	// Background environment variable bindings
+	viper.BindEnv("background.workers", "BACKGROUND_WORKERS")
+	viper.BindEnv("background.queue_size", "BACKGROUND_QUEUE_SIZE")
+	viper.BindEnv("background.task_timeout", "BACKGROUND_TASK_TIMEOUT")
+	viper.BindEnv("background.retry_after", "BACKGROUND_RETRY_AFTER")
+
+	// Shutdown environment variable bindings
+	viper.BindEnv("shutdown.timeout", "SHUTDOWN_TIMEOUT")
+	viper.BindEnv("shutdown.http_timeout", "SHUTDOWN_HTTP_TIMEOUT")
+	viper.BindEnv("shutdown.background_timeout", "SHUTDOWN_BACKGROUND_TIMEOUT")
+	viper.BindEnv("shutdown.scheduler_timeout", "SHUTDOWN_SCHEDULER_TIMEOUT")
+	viper.BindEnv("shutdown.database_timeout", "SHUTDOWN_DATABASE_TIMEOUT")
 
 	// Log environment variable bindings
 	viper.BindEnv("log.level", "LOG_LEVEL")
 	viper.BindEnv("log.format", "LOG_FORMAT")
+	viper.BindEnv("log.access_skip_paths", "LOG_ACCESS_SKIP_PATHS")
+	viper.BindEnv("log.access_skip_prefixes", "LOG_ACCESS_SKIP_PREFIXES")
+	viper.BindEnv("log.access_keep_errors", "LOG_ACCESS_KEEP_ERRORS")
 
 	// CORS environment variable bindings
 	viper.BindEnv("cors.allowed_origins", "CORS_ALLOWED_ORIGINS")
 	viper.BindEnv("cors.allowed_methods", "CORS_ALLOWED_METHODS")
 	viper.BindEnv("cors.allowed_headers", "CORS_ALLOWED_HEADERS")
 
+	// Rate limit environment variable bindings
+	viper.BindEnv("rate_limit.enabled", "RATE_LIMIT_ENABLED")
+	viper.BindEnv("rate_limit.requests_per_second", "RATE_LIMIT_REQUESTS_PER_SECOND")
+	viper.BindEnv("rate_limit.burst", "RATE_LIMIT_BURST")
+	viper.BindEnv("rate_limit.allowlist", "RATE_LIMIT_ALLOWLIST")
+	viper.BindEnv("rate_limit.redis_addr", "RATE_LIMIT_REDIS_ADDR")
+	viper.BindEnv("rate_limit.redis_password", "RATE_LIMIT_REDIS_PASSWORD")
+	viper.BindEnv("rate_limit.redis_db", "RATE_LIMIT_REDIS_DB")
+	viper.BindEnv("rate_limit.redis_key_prefix", "RATE_LIMIT_REDIS_KEY_PREFIX")
+	viper.BindEnv("rate_limit.redis_timeout", "RATE_LIMIT_REDIS_TIMEOUT")
+
 	// S3 environment variable bindings
 	viper.BindEnv("s3.endpoint", "S3_ENDPOINT")
 	viper.BindEnv("s3.access_key_id", "S3_ACCESS_KEY_ID")
@@ -194,4 +972,34 @@ func bindEnvVars() {
 	viper.BindEnv("s3.use_ssl", "S3_USE_SSL")
 	viper.BindEnv("s3.bucket", "S3_BUCKET")
 	viper.BindEnv("s3.region", "S3_REGION")
+	viper.BindEnv("s3.presign_expiry", "S3_PRESIGN_EXPIRY")
+
+	// Auth environment variable bindings
+	viper.BindEnv("auth.enabled", "AUTH_ENABLED")
+	viper.BindEnv("auth.jwt_secret", "AUTH_JWT_SECRET")
+	viper.BindEnv("auth.token_ttl", "AUTH_TOKEN_TTL")
+	viper.BindEnv("auth.admin_users", "AUTH_ADMIN_USERS")
+
+	// Upload environment variable bindings
+	viper.BindEnv("upload.max_file_size", "UPLOAD_MAX_FILE_SIZE")
+	viper.BindEnv("upload.strict_deduplication", "UPLOAD_STRICT_DEDUPLICATION")
+	viper.BindEnv("upload.near_duplicate_max_distance", "UPLOAD_NEAR_DUPLICATE_MAX_DISTANCE")
+
+	// Processing environment variable bindings
+	viper.BindEnv("processing.chunk_strategy", "PROCESSING_CHUNK_STRATEGY")
+	viper.BindEnv("processing.chunk_size", "PROCESSING_CHUNK_SIZE")
+	viper.BindEnv("processing.chunk_overlap", "PROCESSING_CHUNK_OVERLAP")
+	viper.BindEnv("processing.min_chunk_size", "PROCESSING_MIN_CHUNK_SIZE")
+	viper.BindEnv("processing.max_parse_size", "PROCESSING_MAX_PARSE_SIZE")
+	viper.BindEnv("processing.chunk_save_batch_size", "PROCESSING_CHUNK_SAVE_BATCH_SIZE")
+	viper.BindEnv("processing.chunk_metadata_schema.mode", "PROCESSING_CHUNK_METADATA_SCHEMA_MODE")
+
+	// Scheduler environment variable bindings
+	viper.BindEnv("scheduler.storage_stats_interval", "SCHEDULER_STORAGE_STATS_INTERVAL")
+	viper.BindEnv("scheduler.storage_stats_retention", "SCHEDULER_STORAGE_STATS_RETENTION")
+	viper.BindEnv("scheduler.upload_session_cleanup_interval", "SCHEDULER_UPLOAD_SESSION_CLEANUP_INTERVAL")
+	viper.BindEnv("scheduler.processing_retry_interval", "SCHEDULER_PROCESSING_RETRY_INTERVAL")
+	viper.BindEnv("scheduler.processing_retry_max", "SCHEDULER_PROCESSING_RETRY_MAX")
+	viper.BindEnv("scheduler.processing_retry_max_age", "SCHEDULER_PROCESSING_RETRY_MAX_AGE")
+	viper.BindEnv("scheduler.processing_retry_backoff", "SCHEDULER_PROCESSING_RETRY_BACKOFF")
 }
@@ -0,0 +1,256 @@
+package config
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyModeDefaultsRelease(t *testing.T) {
+	cfg := &Config{Server: ServerConfig{Mode: "release"}}
+	cfg.ApplyModeDefaults()
+
+	if len(cfg.CORS.AllowedOrigins) != 0 {
+		t.Errorf("Expected no default CORS origins in release mode, got %v", cfg.CORS.AllowedOrigins)
+	}
+	if cfg.Server.MaxBodySize != 1<<20 {
+		t.Errorf("Expected 1MB body limit in release mode, got %d", cfg.Server.MaxBodySize)
+	}
+	if cfg.Server.RequestTimeout != 30*time.Second {
+		t.Errorf("Expected 30s request timeout in release mode, got %s", cfg.Server.RequestTimeout)
+	}
+	if cfg.Server.ReadTimeout == 0 || cfg.Server.WriteTimeout == 0 || cfg.Server.IdleTimeout == 0 {
+		t.Error("Expected server timeouts to be set in release mode")
+	}
+}
+
+func TestApplyModeDefaultsDebug(t *testing.T) {
+	cfg := &Config{Server: ServerConfig{Mode: "debug"}}
+	cfg.ApplyModeDefaults()
+
+	if len(cfg.CORS.AllowedOrigins) == 0 {
+		t.Error("Expected local development CORS origins in debug mode")
+	}
+	if cfg.Server.MaxBodySize <= 1<<20 {
+		t.Errorf("Expected a more permissive body limit in debug mode, got %d", cfg.Server.MaxBodySize)
+	}
+	if cfg.Server.WriteTimeout != 0 {
+		t.Errorf("Expected no write timeout in debug mode, got %s", cfg.Server.WriteTimeout)
+	}
+}
+
+func TestApplyModeDefaultsKeepsOverrides(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{
+			Mode:           "release",
+			MaxBodySize:    4096,
+			RequestTimeout: 5 * time.Second,
+		},
+		CORS: CORSConfig{AllowedOrigins: []string{"https://example.com"}},
+	}
+	cfg.ApplyModeDefaults()
+
+	if cfg.Server.MaxBodySize != 4096 {
+		t.Errorf("Expected explicit body limit to be kept, got %d", cfg.Server.MaxBodySize)
+	}
+	if cfg.Server.RequestTimeout != 5*time.Second {
+		t.Errorf("Expected explicit request timeout to be kept, got %s", cfg.Server.RequestTimeout)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 1 || cfg.CORS.AllowedOrigins[0] != "https://example.com" {
+		t.Errorf("Expected explicit CORS origins to be kept, got %v", cfg.CORS.AllowedOrigins)
+	}
+}
+
+func TestShutdownConfigValidate(t *testing.T) {
+	cfg := ShutdownConfig{
+		Timeout:           30 * time.Second,
+		HTTPTimeout:       15 * time.Second,
+		BackgroundTimeout: 10 * time.Second,
+		SchedulerTimeout:  3 * time.Second,
+		DatabaseTimeout:   2 * time.Second,
+	}
+	if err := cfg.validate(); err != nil {
+		t.Errorf("Expected default budgets to be valid, got %v", err)
+	}
+
+	over := cfg
+	over.HTTPTimeout = 20 * time.Second
+	if err := over.validate(); err == nil {
+		t.Error("Expected sub-timeouts exceeding the overall timeout to be rejected")
+	}
+
+	missing := cfg
+	missing.DatabaseTimeout = 0
+	if err := missing.validate(); err == nil {
+		t.Error("Expected zero database timeout to be rejected")
+	}
+}
+
+func TestAuthConfigValidate(t *testing.T) {
+	if err := (AuthConfig{}).validate(); err != nil {
+		t.Errorf("Expected disabled auth to need no secret, got %v", err)
+	}
+
+	valid := AuthConfig{Enabled: true, JWTSecret: strings.Repeat("s", 32), TokenTTL: time.Hour}
+	if err := valid.validate(); err != nil {
+		t.Errorf("Expected valid auth config, got %v", err)
+	}
+
+	shortSecret := valid
+	shortSecret.JWTSecret = "short"
+	noTTL := valid
+	noTTL.TokenTTL = 0
+	for _, cfg := range []AuthConfig{shortSecret, noTTL} {
+		if err := cfg.validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestProcessingConfigValidate(t *testing.T) {
+	valid := ProcessingConfig{ChunkStrategy: "fixed", ChunkSize: 500, ChunkOverlap: 50}
+	if err := valid.validate(); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+
+	invalid := []ProcessingConfig{
+		{ChunkStrategy: "semantic", ChunkSize: 500},
+		{ChunkStrategy: "fixed", ChunkSize: 0},
+		{ChunkStrategy: "fixed", ChunkSize: 100, ChunkOverlap: 100},
+		{ChunkStrategy: "fixed", ChunkSize: 100, ChunkOverlap: -1},
+		{ChunkStrategy: "paragraph", ChunkSize: 100, MaxParseSize: -1},
+		{ChunkStrategy: "recursive", ChunkSize: 100, MinChunkSize: 101},
+		{ChunkStrategy: "recursive", ChunkSize: 100, ChunkSeparators: []string{"\n", ""}},
+		{ChunkStrategy: "fixed", ChunkSize: 100, ChunkSaveBatchSize: -1},
+		{ChunkStrategy: "fixed", ChunkSize: 100, ChunkSaveBatchSize: 10001},
+		{ChunkStrategy: "fixed", ChunkSize: 100, ChunkMetadataSchema: ChunkMetadataSchemaConfig{Mode: "drop"}},
+		{ChunkStrategy: "fixed", ChunkSize: 100, ChunkMetadataSchema: ChunkMetadataSchemaConfig{Fields: []ChunkMetadataFieldConfig{{Key: "", Type: "string"}}}},
+		{ChunkStrategy: "fixed", ChunkSize: 100, ChunkMetadataSchema: ChunkMetadataSchemaConfig{Fields: []ChunkMetadataFieldConfig{{Key: "author", Type: "date"}}}},
+		{ChunkStrategy: "fixed", ChunkSize: 100, ChunkMetadataSchema: ChunkMetadataSchemaConfig{Fields: []ChunkMetadataFieldConfig{{Key: "a", Type: "string"}, {Key: "a", Type: "number"}}}},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestRateLimitConfigValidate(t *testing.T) {
+	valid := RateLimitConfig{Enabled: true, RequestsPerSecond: 10, Burst: 20, Allowlist: []string{"10.0.0.0/8", " 127.0.0.1 ", "::1", ""}}
+	if err := valid.validate(); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+
+	invalid := []RateLimitConfig{
+		{Enabled: true, RequestsPerSecond: 0, Burst: 20},
+		{RedisDB: -1},
+		{Allowlist: []string{"not-an-ip"}},
+		{Allowlist: []string{"10.0.0.0/33"}},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestRedactionConfigRedactor(t *testing.T) {
+	if r, err := (RedactionConfig{Builtin: []string{"unknown"}}).Redactor(); r != nil || err != nil {
+		t.Errorf("Expected disabled redaction to return nil, got %v, %v", r, err)
+	}
+
+	cfg := RedactionConfig{
+		Enabled:  true,
+		Builtin:  []string{"email"},
+		Patterns: []RedactionPatternConfig{{Name: "ticket", Regex: `TCK-\d+`}},
+	}
+	r, err := cfg.Redactor()
+	if err != nil {
+		t.Fatalf("Failed to create redactor: %v", err)
+	}
+	if text, _ := r.Redact("TCK-42 from a@b.io"); text != "[TICKET] from [EMAIL]" {
+		t.Errorf("Unexpected redaction: %s", text)
+	}
+
+	cfg.Patterns = append(cfg.Patterns, RedactionPatternConfig{Name: "bad", Regex: "("})
+	if _, err := cfg.Redactor(); err == nil {
+		t.Error("Expected invalid pattern to be rejected")
+	}
+}
+
+func TestHTTPClientConfigRejectsInvalidSettings(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.txt")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0o600)
+
+	for _, cfg := range []HTTPClientConfig{
+		{ProxyURL: "ftp://proxy:21"},
+		{ProxyURL: "http://"},
+		{ProxyURL: "://bad"},
+		{CACertFile: filepath.Join(dir, "missing.pem")},
+		{CACertFile: notPEM},
+	} {
+		if _, err := cfg.NewClient(); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestHTTPClientConfigUsesProxy(t *testing.T) {
+	var requested string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	client, err := HTTPClientConfig{ProxyURL: proxy.URL}.NewClient()
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	resp, err := client.Get("http://api.example.invalid/v1/models")
+	if err != nil {
+		t.Fatalf("Expected request to go through the proxy, got %v", err)
+	}
+	resp.Body.Close()
+	if requested != "http://api.example.invalid/v1/models" {
+		t.Errorf("Expected proxy to receive the absolute URL, got %q", requested)
+	}
+}
+
+func TestHTTPClientConfigTrustsCACertFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+
+	// 默认客户端不信任自签名证书
+	plain, _ := HTTPClientConfig{}.NewClient()
+	if _, err := plain.Get(server.URL); err == nil {
+		t.Fatal("Expected self-signed certificate to be rejected without ca_cert_file")
+	}
+
+	client, err := HTTPClientConfig{CACertFile: caFile}.NewClient()
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected certificate from ca_cert_file to be trusted, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestAIConfigHTTPClientDefault(t *testing.T) {
+	if (&AIConfig{}).HTTPClient() != http.DefaultClient {
+		t.Error("Expected default client when config was not loaded")
+	}
+}
@@ -2,10 +2,15 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"ai-knowledge-app/pkg/logger"
@@ -32,8 +37,31 @@ func RequestID() gin.HandlerFunc {
 	})
 }
 
+// AccessLogSkip 不记录访问日志的路由
+type AccessLogSkip struct {
+	Paths    []string // 精确匹配的路径
+	Prefixes []string // 路径前缀
+	// KeepErrors 跳过的路由上状态码>=400或有错误的请求仍然记录
+	KeepErrors bool
+}
+
+// skips 判断请求是否跳过访问日志
+func (s AccessLogSkip) skips(c *gin.Context, path string) bool {
+	matched := utils.ContainsString(s.Paths, path)
+	for _, prefix := range s.Prefixes {
+		if matched {
+			break
+		}
+		matched = strings.HasPrefix(path, prefix)
+	}
+	if !matched {
+		return false
+	}
+	return !s.KeepErrors || (c.Writer.Status() < http.StatusBadRequest && len(c.Errors) == 0)
+}
+
 // Logger 日志中间件
-func Logger() gin.HandlerFunc {
+func Logger(skip AccessLogSkip) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		startTime := time.Now()
 		path := c.Request.URL.Path
@@ -42,14 +70,14 @@ func Logger() gin.HandlerFunc {
 		// 处理请求
 		c.Next()
 
-		// 跳过健康检查日志
-		if path == "/health" {
+		// 跳过健康检查、指标采集等高频路由的日志
+		if skip.skips(c, path) {
 			return
 		}
 
 		// 计算延迟
 		latency := time.Since(startTime)
-		clientIP := utils.GetClientIP(c)
+		clientIP := c.ClientIP()
 		method := c.Request.Method
 		statusCode := c.Writer.Status()
 		userAgent := c.Request.UserAgent()
@@ -112,7 +140,7 @@ func Recovery() gin.HandlerFunc {
 			if err := recover(); err != nil {
 				// 获取请求信息
 				requestID, _ := c.Get("request_id")
-				clientIP := utils.GetClientIP(c)
+				clientIP := c.ClientIP()
 				method := c.Request.Method
 				path := c.Request.URL.Path
 
@@ -135,13 +163,22 @@ func Recovery() gin.HandlerFunc {
 	}
 }
 
+// IPRateLimiter 按客户端IP限流的限流器，单实例使用内存实现，多副本部署使用Redis实现
+type IPRateLimiter interface {
+	// AllowIP 检查IP是否允许访问
+	AllowIP(ip string) bool
+	// ReserveIP 检查IP是否允许访问，拒绝时返回需要等待的时间
+	ReserveIP(ip string) (bool, time.Duration)
+}
+
 // RateLimiter 简单的速率限制中间件
 // 注意：这是一个基本实现，生产环境建议使用Redis等分布式存储
 type RateLimiter struct {
-	visitors map[string]*visitor
-	mu       *sync.RWMutex
-	rate     rate.Limit
-	burst    int
+	visitors  map[string]*visitor
+	mu        *sync.RWMutex
+	rate      rate.Limit
+	burst     int
+	allowlist []*net.IPNet
 }
 
 type visitor struct {
@@ -164,20 +201,89 @@ func NewRateLimiter(requestsPerSecond float64, burst int) *RateLimiter {
 	return rl
 }
 
+// SetAllowlist 设置不受速率限制的IP或CIDR（如内部服务），单个IP按/32或/128处理
+func (rl *RateLimiter) SetAllowlist(entries []string) error {
+	allowlist := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return fmt.Errorf("invalid rate limit allowlist entry: %s", entry)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			entry = fmt.Sprintf("%s/%d", entry, bits)
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return fmt.Errorf("invalid rate limit allowlist entry: %s", entry)
+		}
+		allowlist = append(allowlist, network)
+	}
+
+	rl.mu.Lock()
+	rl.allowlist = allowlist
+	rl.mu.Unlock()
+	return nil
+}
+
+// IsAllowlisted 检查IP是否在白名单中
+func (rl *RateLimiter) IsAllowlisted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	for _, network := range rl.allowlist {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
 // AllowIP 检查IP是否允许访问
 func (rl *RateLimiter) AllowIP(ip string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+	allowed, _ := rl.ReserveIP(ip)
+	return allowed
+}
 
+// ReserveIP 检查IP是否允许访问，拒绝时返回需要等待的时间
+func (rl *RateLimiter) ReserveIP(ip string) (bool, time.Duration) {
+	if rl.IsAllowlisted(ip) {
+		return true, 0
+	}
+
+	rl.mu.Lock()
 	v, exists := rl.visitors[ip]
 	if !exists {
-		limiter := rate.NewLimiter(rl.rate, rl.burst)
-		rl.visitors[ip] = &visitor{limiter, time.Now()}
-		return limiter.Allow()
+		v = &visitor{limiter: rate.NewLimiter(rl.rate, rl.burst)}
+		rl.visitors[ip] = v
 	}
-
 	v.lastSeen = time.Now()
-	return v.limiter.Allow()
+	rl.mu.Unlock()
+
+	now := time.Now()
+	r := v.limiter.ReserveN(now, 1)
+	if !r.OK() {
+		// burst为0时永远无法获得令牌
+		return false, time.Second
+	}
+	delay := r.DelayFrom(now)
+	if delay > 0 {
+		// 本次请求被拒绝，归还预占的令牌
+		r.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
 }
 
 // cleanupVisitors 清理过期访问者
@@ -195,11 +301,16 @@ func (rl *RateLimiter) cleanupVisitors() {
 	}
 }
 
-// RateLimitMiddleware 速率限制中间件
-func RateLimitMiddleware(rl *RateLimiter) gin.HandlerFunc {
+// RateLimitMiddleware 速率限制中间件，超出限制时返回429并携带Retry-After
+func RateLimitMiddleware(rl IPRateLimiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ip := utils.GetClientIP(c)
-		if !rl.AllowIP(ip) {
+		allowed, retryAfter := rl.ReserveIP(c.ClientIP())
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(seconds))
 			utils.ErrorResponse(c, http.StatusTooManyRequests, "Rate limit exceeded")
 			c.Abort()
 			return
@@ -209,6 +320,73 @@ func RateLimitMiddleware(rl *RateLimiter) gin.HandlerFunc {
 	}
 }
 
+// ConcurrencyLimiter 全局并发限制器
+// 基于信号量限制同时进行中的请求数量，与按IP的速率限制相互独立
+type ConcurrencyLimiter struct {
+	sem        chan struct{}
+	inFlight   int64
+	retryAfter time.Duration
+}
+
+// NewConcurrencyLimiter 创建并发限制器，maxConcurrent<=0表示不限制
+func NewConcurrencyLimiter(maxConcurrent int, retryAfter time.Duration) *ConcurrencyLimiter {
+	cl := &ConcurrencyLimiter{retryAfter: retryAfter}
+	if maxConcurrent > 0 {
+		cl.sem = make(chan struct{}, maxConcurrent)
+	}
+	return cl
+}
+
+// TryAcquire 尝试占用一个并发名额，已满时立即返回false
+func (cl *ConcurrencyLimiter) TryAcquire() bool {
+	if cl.sem != nil {
+		select {
+		case cl.sem <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	atomic.AddInt64(&cl.inFlight, 1)
+	return true
+}
+
+// Release 释放一个并发名额
+func (cl *ConcurrencyLimiter) Release() {
+	atomic.AddInt64(&cl.inFlight, -1)
+	if cl.sem != nil {
+		<-cl.sem
+	}
+}
+
+// InFlight 返回当前进行中的请求数量
+func (cl *ConcurrencyLimiter) InFlight() int64 {
+	return atomic.LoadInt64(&cl.inFlight)
+}
+
+// Limit 返回最大并发数，0表示不限制
+func (cl *ConcurrencyLimiter) Limit() int {
+	return cap(cl.sem)
+}
+
+// ConcurrencyLimitMiddleware 并发限制中间件，超出限制时返回429并携带Retry-After
+func ConcurrencyLimitMiddleware(cl *ConcurrencyLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !cl.TryAcquire() {
+			retryAfter := int(cl.retryAfter.Seconds())
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			utils.ErrorResponse(c, http.StatusTooManyRequests, "Too many concurrent requests")
+			c.Abort()
+			return
+		}
+		defer cl.Release()
+
+		c.Next()
+	}
+}
+
 // ValidateRequest 请求验证中间件
 func ValidateRequest() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -247,30 +425,173 @@ func SecurityHeaders() gin.HandlerFunc {
 }
 
 // Timeout 超时中间件
-func Timeout(timeout time.Duration) gin.HandlerFunc {
+// 为请求上下文设置截止时间，数据库、LLM等下游调用据此提前结束；
+// 处理器超时且尚未写出响应时返回408。
+// exempt中的路由（完整路由路径，如/api/v1/ai/query/stream）不设截止时间，并清除服务器WriteTimeout
+// 对该连接的限制，用于SSE推送和自行控制时长的长耗时请求
+func Timeout(timeout time.Duration, exempt ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		skip[path] = true
+	}
+
 	return func(c *gin.Context) {
+		if skip[c.FullPath()] {
+			clearWriteDeadline(c)
+			c.Next()
+			return
+		}
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
 		// 设置超时上下文
 		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
 		defer cancel()
 
 		c.Request = c.Request.WithContext(ctx)
+		c.Next()
 
-		done := make(chan struct{})
-		go func() {
-			defer close(done)
-			c.Next()
-		}()
-
-		select {
-		case <-done:
-			// 正常完成
-			return
-		case <-ctx.Done():
-			// 超时
+		if ctx.Err() == context.DeadlineExceeded && !c.Writer.Written() {
 			c.AbortWithStatusJSON(http.StatusRequestTimeout, gin.H{
 				"code":    http.StatusRequestTimeout,
 				"message": "Request timeout",
 			})
 		}
 	}
-}
\ No newline at end of file
+}
+
+// clearWriteDeadline 取消当前连接的写超时，不支持设置写超时的连接保持不变
+func clearWriteDeadline(c *gin.Context) {
+	err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		logger.GetLogger().WithError(err).WithField("path", c.FullPath()).Warn("Failed to clear write deadline")
+	}
+}
+
+// BodySizeLimit 请求体大小限制中间件
+// 文件上传（multipart）请求由上传配置单独限制，不受此处约束
+func BodySizeLimit(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxBytes <= 0 || strings.Contains(c.GetHeader("Content-Type"), "multipart/form-data") {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > maxBytes {
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "Request body too large")
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
+
+// ContextUserIDKey 认证通过后用户ID在gin上下文中的键
+const ContextUserIDKey = "user_id"
+
+// AuthMiddleware 校验Authorization: Bearer <JWT>（HS256），通过后将用户ID写入上下文
+// 缺少、过期或无效的令牌返回401
+func AuthMiddleware(secret []byte) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authenticate(c, secret) {
+			c.Next()
+		}
+	}
+}
+
+// authenticate 校验Bearer令牌并将用户ID写入上下文，失败时返回401并中止请求
+func authenticate(c *gin.Context, secret []byte) bool {
+	header := c.GetHeader("Authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || strings.TrimSpace(token) == "" {
+		c.Header("WWW-Authenticate", `Bearer realm="api"`)
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Missing bearer token")
+		c.Abort()
+		return false
+	}
+
+	claims, err := ParseToken(secret, strings.TrimSpace(token))
+	if err != nil {
+		message := "Invalid token"
+		if errors.Is(err, ErrTokenExpired) {
+			message = "Token expired"
+		}
+		c.Header("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+		utils.ErrorResponse(c, http.StatusUnauthorized, message)
+		c.Abort()
+		return false
+	}
+
+	c.Set(ContextUserIDKey, claims.Subject)
+	return true
+}
+
+// AdminAuth 运维接口的认证与授权：读写请求都需要有效的JWT，且用户ID（sub）在admins中，
+// 其他已认证用户返回403；未开启认证时拒绝所有请求（403），避免默认配置下运维接口对任何人开放
+func AdminAuth(enabled bool, secret []byte, admins []string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(admins))
+	for _, admin := range admins {
+		allowed[admin] = true
+	}
+	return func(c *gin.Context) {
+		if !enabled {
+			utils.ErrorResponse(c, http.StatusForbidden, "Admin endpoints require authentication to be enabled")
+			c.Abort()
+			return
+		}
+		// 写请求已由全局认证中间件校验
+		userID, ok := GetUserID(c)
+		if !ok {
+			if !authenticate(c, secret) {
+				return
+			}
+			userID, _ = GetUserID(c)
+		}
+		if !allowed[userID] {
+			utils.ErrorResponse(c, http.StatusForbidden, "Admin privileges required")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// WriteMethodsOnly 对写请求（POST、PUT、PATCH、DELETE）执行handler；读请求无需认证，
+// 但携带Authorization时同样校验，以便读接口识别当前用户（如?mine=true）
+func WriteMethodsOnly(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			handler(c)
+		default:
+			if c.GetHeader("Authorization") != "" {
+				handler(c)
+				return
+			}
+			c.Next()
+		}
+	}
+}
+
+// GetUserID 返回认证中间件写入的用户ID
+func GetUserID(c *gin.Context) (string, bool) {
+	userID := c.GetString(ContextUserIDKey)
+	return userID, userID != ""
+}
+
+// GetNumericUserID 返回数字形式的用户ID，用于记录数据归属；未认证或sub不是数字时返回false
+func GetNumericUserID(c *gin.Context) (uint, bool) {
+	userID, ok := GetUserID(c)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(userID, 10, 32)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
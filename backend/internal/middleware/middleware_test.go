@@ -0,0 +1,461 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestConcurrencyLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter := NewConcurrencyLimiter(1, 3*time.Second)
+	release := make(chan struct{})
+
+	r := gin.New()
+	r.POST("/query", ConcurrencyLimitMiddleware(limiter), func(c *gin.Context) {
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	// 第一个请求占用唯一的名额
+	firstDone := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/query", nil))
+		firstDone <- w.Code
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for limiter.InFlight() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("First request never became in-flight")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 超出限制的请求立即返回429
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/query", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "3" {
+		t.Errorf("Expected Retry-After 3, got %q", got)
+	}
+
+	close(release)
+	if code := <-firstDone; code != http.StatusOK {
+		t.Errorf("Expected first request to succeed, got %d", code)
+	}
+	if limiter.InFlight() != 0 {
+		t.Errorf("Expected no in-flight requests, got %d", limiter.InFlight())
+	}
+
+	// 名额释放后可以再次处理
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/query", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 after release, got %d", w.Code)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// 每2秒补充一个令牌，突发2个
+	limiter := NewRateLimiter(0.5, 2)
+	if err := limiter.SetAllowlist([]string{"10.0.0.0/8", "192.168.1.5"}); err != nil {
+		t.Fatalf("SetAllowlist failed: %v", err)
+	}
+
+	r := gin.New()
+	r.Use(RateLimitMiddleware(limiter))
+	r.GET("/ping", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	request := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set("X-Real-IP", ip)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := request("203.0.113.1"); w.Code != http.StatusOK {
+			t.Fatalf("Expected request %d within burst to succeed, got %d", i, w.Code)
+		}
+	}
+
+	// 突发用尽后返回429，并提示下一个令牌的等待时间
+	w := request("203.0.113.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Expected Retry-After 2, got %q", got)
+	}
+
+	// 被拒绝的请求不消耗令牌，其他IP不受影响
+	if w := request("203.0.113.2"); w.Code != http.StatusOK {
+		t.Errorf("Expected other IP to succeed, got %d", w.Code)
+	}
+
+	// 白名单内的IP不受限制
+	for _, ip := range []string{"10.1.2.3", "192.168.1.5"} {
+		for i := 0; i < 5; i++ {
+			if w := request(ip); w.Code != http.StatusOK {
+				t.Fatalf("Expected allowlisted IP %s to bypass rate limiting, got %d", ip, w.Code)
+			}
+		}
+	}
+	if w := request("192.168.1.6"); w.Code != http.StatusOK {
+		t.Errorf("Expected first request from 192.168.1.6 to succeed, got %d", w.Code)
+	}
+}
+
+func TestRateLimiterSetAllowlistInvalid(t *testing.T) {
+	limiter := NewRateLimiter(1, 1)
+	for _, entry := range []string{"not-an-ip", "10.0.0.0/33"} {
+		if err := limiter.SetAllowlist([]string{entry}); err == nil {
+			t.Errorf("Expected error for allowlist entry %q", entry)
+		}
+	}
+	if err := limiter.SetAllowlist([]string{"::1", " 127.0.0.1 "}); err != nil {
+		t.Errorf("Expected IPv4 and IPv6 addresses to be accepted, got %v", err)
+	}
+	if !limiter.IsAllowlisted("::1") || !limiter.IsAllowlisted("127.0.0.1") {
+		t.Error("Expected single addresses to be allowlisted")
+	}
+}
+
+func TestConcurrencyLimiterUnlimited(t *testing.T) {
+	limiter := NewConcurrencyLimiter(0, time.Second)
+
+	for i := 0; i < 100; i++ {
+		if !limiter.TryAcquire() {
+			t.Fatalf("Unlimited limiter rejected request %d", i)
+		}
+	}
+	if limiter.InFlight() != 100 {
+		t.Errorf("Expected 100 in-flight, got %d", limiter.InFlight())
+	}
+	if limiter.Limit() != 0 {
+		t.Errorf("Expected limit 0, got %d", limiter.Limit())
+	}
+}
+
+func TestBodySizeLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.POST("/echo", BodySizeLimit(8), func(c *gin.Context) {
+		if _, err := c.GetRawData(); err != nil {
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	send := func(body, contentType string) int {
+		req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send(`{"a":1}`, "application/json"); code != http.StatusOK {
+		t.Errorf("Expected small body to pass, got %d", code)
+	}
+	if code := send(`{"a":"too large"}`, "application/json"); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for large body, got %d", code)
+	}
+	// 文件上传不受请求体限制约束
+	if code := send("0123456789abcdef", "multipart/form-data; boundary=x"); code != http.StatusOK {
+		t.Errorf("Expected multipart body to bypass limit, got %d", code)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/slow", Timeout(20*time.Millisecond), func(c *gin.Context) {
+		<-c.Request.Context().Done()
+	})
+	r.GET("/fast", Timeout(time.Second), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusRequestTimeout {
+		t.Errorf("Expected 408 for slow handler, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for fast handler, got %d", w.Code)
+	}
+}
+
+func TestTimeoutExemptRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(Timeout(20*time.Millisecond, "/stream/:id"))
+	r.GET("/stream/:id", func(c *gin.Context) {
+		if _, ok := c.Request.Context().Deadline(); ok {
+			t.Error("Expected exempt route to have no deadline")
+		}
+		// 超过服务器WriteTimeout后才写出响应
+		time.Sleep(100 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+
+	server := httptest.NewUnstartedServer(r)
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stream/1")
+	if err != nil {
+		t.Fatalf("Expected exempt route to outlive the write timeout, got %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "done" {
+		t.Errorf("Expected 200 done, got %d %q", resp.StatusCode, body)
+	}
+}
+
+var testJWTSecret = []byte("test-secret-that-is-at-least-32-bytes")
+
+// signedToken 使用任意header和payload签发令牌
+func signedToken(secret []byte, header, payload string) string {
+	input := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return input + "." + signJWT(secret, input)
+}
+
+func TestParseToken(t *testing.T) {
+	token, err := IssueToken(testJWTSecret, "42", time.Hour)
+	if err != nil {
+		t.Fatalf("IssueToken failed: %v", err)
+	}
+	claims, err := ParseToken(testJWTSecret, token)
+	if err != nil || claims.Subject != "42" {
+		t.Fatalf("Expected subject 42, got %+v, %v", claims, err)
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	numericSub := signedToken(testJWTSecret, `{"alg":"HS256"}`, fmt.Sprintf(`{"sub":7,"exp":%d}`, exp))
+	if claims, err := ParseToken(testJWTSecret, numericSub); err != nil || claims.Subject != "7" {
+		t.Errorf("Expected numeric subject to be accepted, got %+v, %v", claims, err)
+	}
+
+	expired, _ := IssueToken(testJWTSecret, "42", -time.Hour)
+	otherSecret, _ := IssueToken([]byte("another-secret-that-is-32-bytes-long"), "42", time.Hour)
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"admin","exp":%d}`, exp))) + "." + parts[2]
+	cases := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"expired", expired, ErrTokenExpired},
+		{"wrong secret", otherSecret, ErrTokenSignature},
+		{"tampered payload", tampered, ErrTokenSignature},
+		{"alg none", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"1","exp":%d}`, exp))) + ".", ErrTokenMalformed},
+		{"missing exp", signedToken(testJWTSecret, `{"alg":"HS256"}`, `{"sub":"1"}`), ErrTokenExpired},
+		{"missing sub", signedToken(testJWTSecret, `{"alg":"HS256"}`, fmt.Sprintf(`{"exp":%d}`, exp)), ErrTokenNoSubject},
+		{"not yet valid", signedToken(testJWTSecret, `{"alg":"HS256"}`, fmt.Sprintf(`{"sub":"1","exp":%d,"nbf":%d}`, exp, exp)), ErrTokenNotYet},
+		{"malformed", "abc.def", ErrTokenMalformed},
+	}
+	for _, tc := range cases {
+		if _, err := ParseToken(testJWTSecret, tc.token); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestAuthMiddlewareProtectsWrites(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(WriteMethodsOnly(AuthMiddleware(testJWTSecret)))
+	handler := func(c *gin.Context) {
+		userID, _ := GetUserID(c)
+		c.String(http.StatusOK, userID)
+	}
+	r.GET("/items", handler)
+	r.POST("/items", handler)
+	r.DELETE("/items", handler)
+
+	valid, _ := IssueToken(testJWTSecret, "alice", time.Hour)
+	expired, _ := IssueToken(testJWTSecret, "alice", -time.Hour)
+	cases := []struct {
+		method, auth string
+		code         int
+		body         string
+	}{
+		{http.MethodGet, "", http.StatusOK, ""},
+		{http.MethodGet, "Bearer " + valid, http.StatusOK, "alice"},
+		{http.MethodGet, "Bearer not-a-token", http.StatusUnauthorized, ""},
+		{http.MethodPost, "", http.StatusUnauthorized, ""},
+		{http.MethodPost, "Basic abc", http.StatusUnauthorized, ""},
+		{http.MethodDelete, "Bearer " + expired, http.StatusUnauthorized, ""},
+		{http.MethodPost, "Bearer not-a-token", http.StatusUnauthorized, ""},
+		{http.MethodPost, "Bearer " + valid, http.StatusOK, "alice"},
+		{http.MethodDelete, "Bearer " + valid, http.StatusOK, "alice"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, "/items", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("%s with %q: expected status %d, got %d", tc.method, tc.auth, tc.code, w.Code)
+		}
+		if tc.code == http.StatusOK && w.Body.String() != tc.body {
+			t.Errorf("%s: expected user %q in context, got %q", tc.method, tc.body, w.Body.String())
+		}
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	valid, _ := IssueToken(testJWTSecret, "alice", time.Hour)
+	// 非管理员的有效令牌同样返回403
+	nonAdmin, _ := IssueToken(testJWTSecret, "bob", time.Hour)
+	cases := []struct {
+		enabled      bool
+		method, auth string
+		code         int
+	}{
+		{false, http.MethodGet, "", http.StatusForbidden},
+		{false, http.MethodPost, "Bearer " + valid, http.StatusForbidden},
+		{true, http.MethodGet, "", http.StatusUnauthorized},
+		{true, http.MethodGet, "Bearer not-a-token", http.StatusUnauthorized},
+		{true, http.MethodPost, "", http.StatusUnauthorized},
+		{true, http.MethodGet, "Bearer " + valid, http.StatusOK},
+		{true, http.MethodPost, "Bearer " + valid, http.StatusOK},
+		{true, http.MethodGet, "Bearer " + nonAdmin, http.StatusForbidden},
+		{true, http.MethodPost, "Bearer " + nonAdmin, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		r := gin.New()
+		r.Use(WriteMethodsOnly(AuthMiddleware(testJWTSecret)))
+		r.Use(AdminAuth(tc.enabled, testJWTSecret, []string{"alice"}))
+		handler := func(c *gin.Context) {
+			userID, _ := GetUserID(c)
+			c.String(http.StatusOK, userID)
+		}
+		r.GET("/admin", handler)
+		r.POST("/admin", handler)
+
+		req := httptest.NewRequest(tc.method, "/admin", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("enabled=%v %s with %q: expected status %d, got %d", tc.enabled, tc.method, tc.auth, tc.code, w.Code)
+		}
+		if tc.code == http.StatusOK && w.Body.String() != "alice" {
+			t.Errorf("expected user alice in context, got %q", w.Body.String())
+		}
+	}
+}
+
+func TestGetNumericUserID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		subject string
+		want    uint
+		ok      bool
+	}{
+		{"42", 42, true},
+		{"alice", 0, false},
+		{"0", 0, false},
+		{"", 0, false},
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		if tc.subject != "" {
+			c.Set(ContextUserIDKey, tc.subject)
+		}
+		if got, ok := GetNumericUserID(c); got != tc.want || ok != tc.ok {
+			t.Errorf("GetNumericUserID(%q) = %d, %v; want %d, %v", tc.subject, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestLoggerSkipsConfiguredRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	original := logger.Logger
+	logger.Logger = logrus.New()
+	logger.Logger.SetOutput(&buf)
+	logger.Logger.SetFormatter(&logrus.JSONFormatter{})
+	defer func() { logger.Logger = original }()
+
+	newRouter := func(keepErrors bool) *gin.Engine {
+		r := gin.New()
+		r.Use(Logger(AccessLogSkip{
+			Paths:      []string{"/health"},
+			Prefixes:   []string{"/swagger/"},
+			KeepErrors: keepErrors,
+		}))
+		ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+		r.GET("/health", func(c *gin.Context) {
+			if c.Query("down") != "" {
+				c.Status(http.StatusServiceUnavailable)
+				return
+			}
+			c.Status(http.StatusOK)
+		})
+		r.GET("/swagger/*any", ok)
+		r.GET("/healthz", ok)
+		return r
+	}
+
+	logged := func(r *gin.Engine, target string) bool {
+		buf.Reset()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+		return buf.Len() > 0
+	}
+
+	r := newRouter(true)
+	for target, want := range map[string]bool{
+		"/health":             false,
+		"/swagger/index.html": false,
+		"/healthz":            true, // 精确匹配，不按前缀跳过
+		"/health?down=1":      true, // 出错的请求仍然记录
+	} {
+		if got := logged(r, target); got != want {
+			t.Errorf("Expected logged=%v for %s, got %v", want, target, got)
+		}
+	}
+
+	if logged(newRouter(false), "/health?down=1") {
+		t.Error("Expected errors on skipped routes to be dropped when KeepErrors is false")
+	}
+}
@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ai-knowledge-app/pkg/logger"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisRetryInterval Redis不可用后重新尝试连接的间隔，期间直接使用内存限流器
+const redisRetryInterval = 5 * time.Second
+
+// tokenBucketScript 令牌桶限流脚本，使用Redis服务器时间避免各副本时钟不一致
+// KEYS[1] 限流键；ARGV[1] 每秒补充的令牌数；ARGV[2] 桶容量
+// 返回 {是否允许, 需要等待的微秒数}
+const tokenBucketScript = `
+if redis.replicate_commands then redis.replicate_commands() end
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+  tokens = burst
+  ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000000)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) * 1000000 / rate)
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, wait}
+`
+
+// tokenBucket 令牌桶脚本，按SHA1缓存在Redis中
+var tokenBucket = redis.NewScript(tokenBucketScript)
+
+// redisLogger 将go-redis的内部日志降为debug级别，Redis不可用时的告警由限流器控制频率
+type redisLogger struct{}
+
+func (redisLogger) Printf(_ context.Context, format string, v ...interface{}) {
+	logger.GetLogger().Debugf(format, v...)
+}
+
+var setRedisLoggerOnce sync.Once
+
+// RedisRateLimiterOptions Redis限流器配置
+type RedisRateLimiterOptions struct {
+	Addr              string
+	Password          string
+	DB                int
+	KeyPrefix         string
+	Timeout           time.Duration
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// RedisRateLimiter 基于Redis的分布式速率限制器，多个副本共享同一份计数
+// Redis不可用时退回到内存限流器，白名单同样由内存限流器维护
+type RedisRateLimiter struct {
+	client    *redis.Client
+	timeout   time.Duration
+	keyPrefix string
+	rate      string
+	burst     string
+	fallback  *RateLimiter
+	// retryAt Redis失败后下次尝试的时间（UnixNano），之前的请求直接使用内存限流器
+	retryAt atomic.Int64
+}
+
+// NewRedisRateLimiter 创建Redis速率限制器，fallback在Redis不可用时使用
+func NewRedisRateLimiter(opts RedisRateLimiterOptions, fallback *RateLimiter) *RedisRateLimiter {
+	if opts.KeyPrefix == "" {
+		opts.KeyPrefix = "ratelimit:"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 200 * time.Millisecond
+	}
+	setRedisLoggerOnce.Do(func() { redis.SetLogger(redisLogger{}) })
+	return &RedisRateLimiter{
+		client: redis.NewClient(&redis.Options{
+			Addr:         opts.Addr,
+			Password:     opts.Password,
+			DB:           opts.DB,
+			DialTimeout:  opts.Timeout,
+			ReadTimeout:  opts.Timeout,
+			WriteTimeout: opts.Timeout,
+			// 限流检查在请求路径上，失败时直接退回内存限流器而不是重试
+			MaxRetries:    -1,
+			DialerRetries: 1,
+		}),
+		timeout:   opts.Timeout,
+		keyPrefix: opts.KeyPrefix,
+		rate:      strconv.FormatFloat(opts.RequestsPerSecond, 'f', -1, 64),
+		burst:     strconv.Itoa(opts.Burst),
+		fallback:  fallback,
+	}
+}
+
+// Ping 检查Redis是否可用
+func (rl *RedisRateLimiter) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), rl.timeout)
+	defer cancel()
+	return rl.client.Ping(ctx).Err()
+}
+
+// AllowIP 检查IP是否允许访问
+func (rl *RedisRateLimiter) AllowIP(ip string) bool {
+	allowed, _ := rl.ReserveIP(ip)
+	return allowed
+}
+
+// ReserveIP 检查IP是否允许访问，拒绝时返回需要等待的时间
+func (rl *RedisRateLimiter) ReserveIP(ip string) (bool, time.Duration) {
+	if rl.fallback.IsAllowlisted(ip) {
+		return true, 0
+	}
+	if time.Now().UnixNano() < rl.retryAt.Load() {
+		return rl.fallback.ReserveIP(ip)
+	}
+
+	allowed, wait, err := rl.reserve(ip)
+	if err != nil {
+		// 仅在首次失败时记录，避免Redis宕机期间每个请求都写日志
+		if rl.retryAt.Swap(time.Now().Add(redisRetryInterval).UnixNano()) == 0 {
+			logger.GetLogger().WithError(err).Warn("Redis rate limiter unavailable, falling back to in-memory rate limiting")
+		}
+		return rl.fallback.ReserveIP(ip)
+	}
+	if rl.retryAt.Swap(0) != 0 {
+		logger.GetLogger().Info("Redis rate limiter recovered")
+	}
+	return allowed, wait
+}
+
+// reserve 执行令牌桶脚本，优先使用EVALSHA，脚本未缓存时自动改用EVAL
+func (rl *RedisRateLimiter) reserve(ip string) (bool, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rl.timeout)
+	defer cancel()
+
+	values, err := tokenBucket.Run(ctx, rl.client, []string{rl.keyPrefix + ip}, rl.rate, rl.burst).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	if len(values) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit script reply: %v", values)
+	}
+	return values[0] == 1, time.Duration(values[1]) * time.Microsecond, nil
+}
+
+var (
+	_ IPRateLimiter = (*RateLimiter)(nil)
+	_ IPRateLimiter = (*RedisRateLimiter)(nil)
+)
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/pkg/logger"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRedisRateLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+
+	fallback := NewRateLimiter(100, 100)
+	if err := fallback.SetAllowlist([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatalf("SetAllowlist failed: %v", err)
+	}
+	limiter := NewRedisRateLimiter(RedisRateLimiterOptions{
+		Addr:              server.Addr(),
+		Password:          "secret",
+		DB:                2,
+		RequestsPerSecond: 0.5,
+		Burst:             2,
+	}, fallback)
+	if err := limiter.Ping(); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+
+	r := gin.New()
+	r.Use(RateLimitMiddleware(limiter))
+	r.GET("/ping", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	request := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set("X-Real-IP", ip)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 突发用尽后按脚本返回的等待时间设置Retry-After，计数保存在选择的数据库中
+	for i := 0; i < 2; i++ {
+		if w := request("203.0.113.1"); w.Code != http.StatusOK {
+			t.Fatalf("Expected request %d within burst to succeed, got %d", i, w.Code)
+		}
+	}
+	w := request("203.0.113.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Expected Retry-After 2, got %q", got)
+	}
+	server.Select(2)
+	if !server.Exists("ratelimit:203.0.113.1") {
+		t.Errorf("Expected bucket in database 2, keys: %v", server.Keys())
+	}
+
+	// 脚本被清除后自动重新加载
+	server.FlushAll()
+	if err := limiter.client.ScriptFlush(context.Background()).Err(); err != nil {
+		t.Fatalf("SCRIPT FLUSH failed: %v", err)
+	}
+	if w := request("203.0.113.1"); w.Code != http.StatusOK {
+		t.Errorf("Expected request to succeed after the script cache was flushed, got %d", w.Code)
+	}
+
+	// 白名单IP不访问Redis
+	server.Select(2)
+	if w := request("10.1.2.3"); w.Code != http.StatusOK {
+		t.Errorf("Expected allowlisted IP to succeed, got %d", w.Code)
+	}
+	if server.Exists("ratelimit:10.1.2.3") {
+		t.Error("Expected no bucket for allowlisted IP")
+	}
+}
+
+func TestRedisRateLimiterFallback(t *testing.T) {
+	var buf strings.Builder
+	originalLogger := logger.Logger
+	logger.Logger = logrus.New()
+	logger.Logger.SetOutput(&buf)
+	defer func() { logger.Logger = originalLogger }()
+
+	// 获取一个随即关闭的地址，保证连接被拒绝
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	limiter := NewRedisRateLimiter(RedisRateLimiterOptions{
+		Addr:              addr,
+		Timeout:           100 * time.Millisecond,
+		RequestsPerSecond: 1,
+		Burst:             2,
+	}, NewRateLimiter(1, 2))
+	if err := limiter.Ping(); err == nil {
+		t.Fatal("Expected Ping to fail for unreachable Redis")
+	}
+
+	// Redis不可用时使用内存限流器
+	for i := 0; i < 2; i++ {
+		if !limiter.AllowIP("203.0.113.1") {
+			t.Fatalf("Expected request %d within burst to be allowed", i)
+		}
+	}
+	allowed, retryAfter := limiter.ReserveIP("203.0.113.1")
+	if allowed || retryAfter <= 0 {
+		t.Errorf("Expected in-memory fallback to reject with a delay, got %v %v", allowed, retryAfter)
+	}
+
+	// 不可用期间只记录一次警告
+	if n := strings.Count(buf.String(), "falling back to in-memory rate limiting"); n != 1 {
+		t.Errorf("Expected a single fallback warning, got %d:\n%s", n, buf.String())
+	}
+}
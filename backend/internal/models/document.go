@@ -1,17 +1,30 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type ProcessingStatus string
 
 const (
+	StatusQueued    ProcessingStatus = "queued"
 	StatusParsing   ProcessingStatus = "parsing"
 	StatusCleaning  ProcessingStatus = "cleaning"
 	StatusChunking  ProcessingStatus = "chunking"
 	StatusCompleted ProcessingStatus = "completed"
 	StatusFailed    ProcessingStatus = "failed"
+	StatusCancelled ProcessingStatus = "cancelled"
+
+	// StatusNotStarted is reported for uploaded documents that were never chunked;
+	// uploads store "completed" in Document.Status before any processing runs
+	StatusNotStarted ProcessingStatus = "not_started"
 )
 
+// DocumentStatusCorrupted marks documents whose stored file is missing or no longer matches its hash
+const DocumentStatusCorrupted = "corrupted"
+
 type Document struct {
 	ID           uint             `json:"id" gorm:"primaryKey"`
 	Name         string           `json:"name"`
@@ -27,17 +40,35 @@ type Document struct {
 	Status       string           `json:"status" gorm:"default:'completed'"`
 	RawText      string           `json:"raw_text" gorm:"type:text"`
 	CleanedText  string           `json:"cleaned_text" gorm:"type:text"`
+	// Markdown rendering of the processed document, kept so exports are not
+	// rebuilt on every request; refreshed whenever processing completes
+	Markdown     string           `json:"-" gorm:"type:text"`
 	ChunkCount   int              `json:"chunk_count"`
 	Error        string           `json:"error,omitempty"`
 	
 	// Reference counting for deduplication
 	RefCount     int              `json:"ref_count" gorm:"default:1"`
+
+	// SimHash of the cleaned text, hex encoded, and its four 16-bit bands;
+	// recorded by processing when near-duplicate detection is enabled. The
+	// bands are indexed so close fingerprints are looked up, not scanned.
+	ContentFingerprint string     `json:"-" gorm:"size:16"`
+	FingerprintBand0   int        `json:"-" gorm:"index"`
+	FingerprintBand1   int        `json:"-" gorm:"index"`
+	FingerprintBand2   int        `json:"-" gorm:"index"`
+	FingerprintBand3   int        `json:"-" gorm:"index"`
+	// Existing document whose text nearly matches this one, found by processing
+	NearDuplicateID    *uint      `json:"near_duplicate_id,omitempty" gorm:"index"`
+
+	// Knowledge entry generated from this document by the summarization pipeline
+	KnowledgeID  *uint            `json:"knowledge_id,omitempty" gorm:"index"`
 	
 	// Relationships
 	Chunks       []DocumentChunk  `json:"chunks,omitempty" gorm:"foreignKey:DocumentID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 	
 	CreatedAt    time.Time        `json:"created_at"`
 	UpdatedAt    time.Time        `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt   `json:"-" gorm:"index"`
 }
 
 type DocumentChunk struct {
@@ -46,6 +77,21 @@ type DocumentChunk struct {
 	Document   Document `json:"document" gorm:"foreignKey:DocumentID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 	ChunkIndex int      `json:"chunk_index"`
 	Content    string   `json:"content" gorm:"type:text"`
+	Strategy   string   `json:"strategy" gorm:"size:20"` // chunking strategy that produced this chunk
+
+	// Byte offsets of the chunk in the chunked text, recorded by strategies whose
+	// chunks are exact substrings of it
+	StartOffset *int `json:"start_offset,omitempty"`
+	EndOffset   *int `json:"end_offset,omitempty"`
+
+	// Descriptive fields such as the source document name; their shape can be
+	// constrained with a chunk metadata schema in the processing config
+	Metadata map[string]interface{} `json:"metadata,omitempty" gorm:"serializer:json;type:text"`
+
+	// Set when an editor corrected the content by hand; reprocessing the
+	// document replaces manually edited chunks as well
+	ManuallyEdited bool       `json:"manually_edited" gorm:"default:false"`
+	EditedAt       *time.Time `json:"edited_at,omitempty"`
 }
 
 type UploadSession struct {
@@ -65,3 +111,24 @@ type UploadSession struct {
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
+
+// UploadChunkHash records the SHA-256 of each received chunk so the assembled
+// file can be re-verified chunk by chunk when the upload completes
+type UploadChunkHash struct {
+	SessionID  string    `json:"session_id" gorm:"primaryKey;size:64"`
+	ChunkIndex int       `json:"chunk_index" gorm:"primaryKey"`
+	Hash       string    `json:"hash" gorm:"size:64"`
+	Size       int64     `json:"size"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// StorageStatsSnapshot periodic sample of storage usage and deduplication savings
+type StorageStatsSnapshot struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	TotalDocuments int64     `json:"total_documents"`
+	UniqueFiles    int64     `json:"unique_files"`
+	TotalSize      int64     `json:"total_size_bytes"`
+	UniqueSize     int64     `json:"unique_size_bytes"`
+	SpaceSaved     int64     `json:"space_saved_bytes"`
+	CreatedAt      time.Time `json:"created_at" gorm:"index"`
+}
@@ -1,7 +1,11 @@
 package models
 
 import (
+	"fmt"
 	"time"
+
+	"ai-knowledge-app/pkg/utils"
+
 	"gorm.io/gorm"
 	"github.com/pgvector/pgvector-go"
 )
@@ -10,14 +14,19 @@ import (
 type Knowledge struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
 	Title       string         `json:"title" gorm:"not null;size:255;index"`
+	Slug        string         `json:"slug" gorm:"size:255;index:idx_knowledges_slug,unique,where:slug <> ''"` // 由标题生成的唯一标识，用于可读链接
 	Content     string         `json:"content" gorm:"type:text"`
 	ContentVector *pgvector.Vector `json:"-" gorm:"type:vector(1536);null"`
+	EmbeddingSkipReason string `json:"embedding_skip_reason,omitempty" gorm:"size:64"` // 未生成向量的原因（如内容过短），为空表示正常生成向量
 	Summary     string         `json:"summary" gorm:"type:text"`
 	CategoryID  uint           `json:"category_id" gorm:"index"`
 	Tags        []Tag          `json:"tags" gorm:"many2many:knowledge_tags;"`
+	Attachments []Document     `json:"attachments,omitempty" gorm:"many2many:knowledge_attachments;"` // 作为附件关联的源文档
 	Metadata    Metadata       `json:"metadata" gorm:"embedded"`
 	IsPublished bool           `json:"is_published" gorm:"default:true"`
 	ViewCount   int            `json:"view_count" gorm:"default:0"`
+	AIReferenceCount int       `json:"ai_reference_count" gorm:"default:0"` // 被AI回答引用的次数
+	CreatedBy   *uint          `json:"created_by,omitempty" gorm:"index"`   // 创建者用户ID，启用认证前创建的条目为空
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
@@ -25,8 +34,15 @@ type Knowledge struct {
 	// 关联
 	Category    *Category `json:"category,omitempty" gorm:"foreignKey:CategoryID"`
 	QueryHistory []QueryHistory `json:"query_history,omitempty" gorm:"foreignKey:KnowledgeID"`
+	Translations []KnowledgeTranslation `json:"translations,omitempty" gorm:"foreignKey:KnowledgeID"`
+
+	// 按查询语言替换为译文时的语言，未替换时为空（检索接口计算得出，不入库）
+	DisplayLanguage string `json:"display_language,omitempty" gorm:"-"`
 }
 
+// EmbeddingSkipContentTooShort 内容短于配置的最小长度，不生成向量，只能通过关键词搜索
+const EmbeddingSkipContentTooShort = "content_too_short"
+
 // Category 知识分类模型
 type Category struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
@@ -41,6 +57,9 @@ type Category struct {
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 
+	// 已发布知识数量（列表接口计算得出，不入库）
+	KnowledgeCount int64 `json:"knowledge_count" gorm:"-"`
+
 	// 关联
 	Parent   *Category  `json:"parent,omitempty" gorm:"foreignKey:ParentID"`
 	Children []Category `json:"children,omitempty" gorm:"foreignKey:ParentID"`
@@ -57,6 +76,9 @@ type Tag struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
+	// 已发布知识数量（列表接口计算得出，不入库）
+	KnowledgeCount int64 `json:"knowledge_count" gorm:"-"`
+
 	// 关联
 	Knowledges []Knowledge `json:"knowledges,omitempty" gorm:"many2many:knowledge_tags;"`
 }
@@ -78,10 +100,18 @@ type QueryHistory struct {
 	Response    string         `json:"response" gorm:"type:text"`
 	KnowledgeID *uint          `json:"knowledge_id" gorm:"index"`
 	Model       string         `json:"model" gorm:"size:50"`
-	Tokens      int            `json:"tokens" gorm:"default:0"`
+	Tokens      int            `json:"tokens" gorm:"default:0"` // 生成的token数，同completion_tokens，保留兼容
+	PromptTokens     int       `json:"prompt_tokens" gorm:"default:0"`
+	CompletionTokens int       `json:"completion_tokens" gorm:"default:0"`
+	TokensEstimated  bool      `json:"tokens_estimated" gorm:"default:false"` // 服务商未返回用量，token数由分词器计算
 	Duration    int            `json:"duration" gorm:"default:0"` // 毫秒
 	IsSuccess   bool           `json:"is_success" gorm:"default:true"`
 	ErrorMessage string        `json:"error_message" gorm:"type:text"`
+	QueryVector *pgvector.Vector `json:"-" gorm:"type:vector(1536);null"`
+	IsSensitive bool           `json:"is_sensitive" gorm:"default:false;index"` // 敏感查询不生成向量，也不出现在相似问题中
+	ConversationID string      `json:"conversation_id,omitempty" gorm:"size:64;index"` // 多轮对话的会话ID，后续提问时加载最近的问答作为上下文
+	QueryLanguage  string      `json:"query_language" gorm:"size:16"`  // 按文字判断的问题语言
+	AnswerLanguage string      `json:"answer_language" gorm:"size:16"` // 按文字判断的回答语言，可用于发现未按问题语言回答的记录
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
@@ -90,13 +120,52 @@ type QueryHistory struct {
 	Knowledge *Knowledge `json:"knowledge,omitempty" gorm:"foreignKey:KnowledgeID"`
 }
 
+// QueryFeedback 用户对AI回答的反馈
+// 开启认证时记录提交用户，同一用户对同一查询只能反馈一次；匿名反馈的UserID为空，不受限制
+type QueryFeedback struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	QueryID   uint      `json:"query_id" gorm:"not null;uniqueIndex:idx_query_feedback_user"`
+	UserID    *uint     `json:"user_id,omitempty" gorm:"uniqueIndex:idx_query_feedback_user"`
+	Rating    int       `json:"rating" gorm:"not null"` // 1-5
+	Comment   string    `json:"comment" gorm:"type:text"`
+	IsHelpful bool      `json:"is_helpful" gorm:"default:false"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// 关联
+	Query *QueryHistory `json:"-" gorm:"foreignKey:QueryID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
 // KnowledgeTag 知识标签关联表
 type KnowledgeTag struct {
 	KnowledgeID uint `json:"knowledge_id" gorm:"primaryKey"`
-	TagID       uint `json:"tag_id" gorm:"primaryKey"`
+	TagID       uint `json:"tag_id" gorm:"primaryKey;index"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// KnowledgeAttachment 知识与源文档的附件关联表
+// 删除知识（软删除）时保留关联以便恢复；删除文档时只移除关联，不影响其他知识引用的文档
+type KnowledgeAttachment struct {
+	KnowledgeID uint      `json:"knowledge_id" gorm:"primaryKey"`
+	DocumentID  uint      `json:"document_id" gorm:"primaryKey;index"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// KnowledgeTranslation 知识的其他语言版本，每个知识每种语言最多一条
+// 译文单独生成向量，跨语言的查询也能检索到原文为其他语言的知识
+type KnowledgeTranslation struct {
+	ID            uint             `json:"id" gorm:"primaryKey"`
+	KnowledgeID   uint             `json:"knowledge_id" gorm:"not null;uniqueIndex:idx_knowledge_translations_language"`
+	Language      string           `json:"language" gorm:"not null;size:10;uniqueIndex:idx_knowledge_translations_language"` // 规范化的语言标签，如 en、zh-cn
+	Title         string           `json:"title" gorm:"not null;size:255"`
+	Content       string           `json:"content" gorm:"type:text"`
+	Summary       string           `json:"summary" gorm:"type:text"`
+	ContentVector *pgvector.Vector `json:"-" gorm:"type:vector(1536);null"`
+	EmbeddingSkipReason string `json:"embedding_skip_reason,omitempty" gorm:"size:64"` // 未生成向量的原因（如内容过短），为空表示正常生成向量
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+}
+
 // TableName 设置表名
 func (Knowledge) TableName() string {
 	return "knowledges"
@@ -118,15 +187,107 @@ func (KnowledgeTag) TableName() string {
 	return "knowledge_tags"
 }
 
+func (KnowledgeAttachment) TableName() string {
+	return "knowledge_attachments"
+}
+
+func (KnowledgeTranslation) TableName() string {
+	return "knowledge_translations"
+}
+
 // BeforeCreate GORM钩子：创建前
 func (k *Knowledge) BeforeCreate(tx *gorm.DB) error {
 	if k.Metadata.WordCount == 0 && k.Content != "" {
 		// 简单的字数统计（可以根据需要优化）
 		k.Metadata.WordCount = len([]rune(k.Content))
 	}
+	if k.Slug == "" && k.Title != "" {
+		slug, err := UniqueKnowledgeSlug(tx, utils.Slugify(k.Title), 0)
+		if err != nil {
+			return err
+		}
+		k.Slug = slug
+	}
 	return nil
 }
 
+// UniqueKnowledgeSlug 返回未被其他知识（包括已软删除的）占用的slug，冲突时追加-2、-3等后缀
+func UniqueKnowledgeSlug(tx *gorm.DB, base string, excludeID uint) (string, error) {
+	var taken []string
+	query := tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&Knowledge{}).
+		Where("slug = ? OR slug LIKE ?", base, base+"-%")
+	if excludeID != 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+	if err := query.Pluck("slug", &taken).Error; err != nil {
+		return "", fmt.Errorf("failed to check slug uniqueness: %w", err)
+	}
+
+	used := make(map[string]bool, len(taken))
+	for _, slug := range taken {
+		used[slug] = true
+	}
+	slug := base
+	for n := 2; used[slug]; n++ {
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+	return slug, nil
+}
+
+// BackfillKnowledgeSlugs 为添加slug字段之前创建的知识生成slug
+func BackfillKnowledgeSlugs(db *gorm.DB) error {
+	var knowledges []Knowledge
+	if err := db.Unscoped().Select("id, title").Where("slug = '' OR slug IS NULL").Find(&knowledges).Error; err != nil {
+		return err
+	}
+	for _, k := range knowledges {
+		slug, err := UniqueKnowledgeSlug(db, utils.Slugify(k.Title), k.ID)
+		if err != nil {
+			return err
+		}
+		if err := db.Unscoped().Model(&Knowledge{}).Where("id = ?", k.ID).UpdateColumn("slug", slug).Error; err != nil {
+			return fmt.Errorf("failed to backfill slug for knowledge %d: %w", k.ID, err)
+		}
+	}
+	return nil
+}
+
+// KnowledgeSearchVectorColumn 知识全文检索使用的tsvector列
+// 仅在PostgreSQL中由EnsureKnowledgeSearchIndex创建，不在模型中声明以免其他数据库迁移出无用的列
+const KnowledgeSearchVectorColumn = "search_vector"
+
+// KnowledgeSearchConfig 全文检索使用的文本搜索配置
+// simple不做词干提取，中英文混合内容下比english更可靠
+const KnowledgeSearchConfig = "simple"
+
+// EnsureKnowledgeSearchIndex 为PostgreSQL创建全文检索列及GIN索引
+// 检索列为由标题、摘要、正文生成的计算列，权重依次降低，写入时由数据库自动维护
+// 其他数据库直接返回，搜索回退到LIKE匹配
+func EnsureKnowledgeSearchIndex(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	statements := []string{
+		fmt.Sprintf(`ALTER TABLE knowledges ADD COLUMN IF NOT EXISTS %[1]s tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('%[2]s', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('%[2]s', coalesce(summary, '')), 'B') ||
+			setweight(to_tsvector('%[2]s', coalesce(content, '')), 'C')
+		) STORED`, KnowledgeSearchVectorColumn, KnowledgeSearchConfig),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_knowledges_%[1]s ON knowledges USING GIN (%[1]s)", KnowledgeSearchVectorColumn),
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to create knowledge search index: %w", err)
+		}
+	}
+	return nil
+}
+
+// SupportsKnowledgeFullTextSearch 数据库是否支持知识全文检索
+func SupportsKnowledgeFullTextSearch(db *gorm.DB) bool {
+	return db.Dialector.Name() == "postgres" && db.Migrator().HasColumn(&Knowledge{}, KnowledgeSearchVectorColumn)
+}
+
 // BeforeUpdate GORM钩子：更新前
 func (k *Knowledge) BeforeUpdate(tx *gorm.DB) error {
 	if k.Content != "" {
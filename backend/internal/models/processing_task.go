@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type TaskStatus string
+
+const (
+	TaskPending    TaskStatus = "pending"
+	TaskProcessing TaskStatus = "processing"
+	TaskCompleted  TaskStatus = "completed"
+	TaskFailed     TaskStatus = "failed"
+	TaskCancelled  TaskStatus = "cancelled"
+)
+
+// ProcessingTask records one queued run of the document processing pipeline
+type ProcessingTask struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	DocumentID  uint       `json:"document_id" gorm:"not null;index"`
+	Status      TaskStatus `json:"status" gorm:"size:20;index"`
+	Error       string     `json:"error,omitempty" gorm:"type:text"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	// RetryCount counts the automatic retries of failed processing that led to
+	// this task; 0 for tasks queued by a user
+	RetryCount int `json:"retry_count" gorm:"default:0"`
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// SystemSetting 运行时修改且需要在重启后保留的配置，按键值存储
+type SystemSetting struct {
+	Key       string    `json:"key" gorm:"primaryKey;size:100"`
+	Value     string    `json:"value" gorm:"type:text"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
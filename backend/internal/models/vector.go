@@ -0,0 +1,92 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// VectorColumn 保存向量的数据库列
+type VectorColumn struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+}
+
+// VectorColumns 所有保存向量的列，维度需与配置的向量模型一致
+var VectorColumns = []VectorColumn{
+	{Table: "knowledges", Column: "content_vector"},
+	{Table: "knowledge_translations", Column: "content_vector"},
+	{Table: "query_histories", Column: "query_vector"},
+}
+
+// VectorColumnInfo 向量列的实际维度
+type VectorColumnInfo struct {
+	VectorColumn
+	Dimensions int   `json:"dimensions"` // 0表示未限定维度
+	Vectors    int64 `json:"vectors"`    // 已保存的向量数量
+}
+
+// VectorColumnDimensions 读取各向量列的实际维度和已保存的向量数量，仅支持PostgreSQL
+func VectorColumnDimensions(db *gorm.DB) ([]VectorColumnInfo, error) {
+	if db.Dialector.Name() != "postgres" {
+		return nil, nil
+	}
+
+	var infos []VectorColumnInfo
+	for _, col := range VectorColumns {
+		// vector(n)的atttypmod即为n，未限定维度时为-1
+		var typmods []int
+		if err := db.Raw("SELECT atttypmod FROM pg_attribute WHERE attrelid = to_regclass(?) AND attname = ? AND NOT attisdropped",
+			col.Table, col.Column).Scan(&typmods).Error; err != nil {
+			return nil, fmt.Errorf("failed to read dimensions of %s.%s: %w", col.Table, col.Column, err)
+		}
+		if len(typmods) == 0 {
+			continue
+		}
+
+		info := VectorColumnInfo{VectorColumn: col}
+		if typmods[0] > 0 {
+			info.Dimensions = typmods[0]
+		}
+		if err := db.Table(col.Table).Where(col.Column + " IS NOT NULL").Count(&info.Vectors).Error; err != nil {
+			return nil, fmt.Errorf("failed to count vectors in %s.%s: %w", col.Table, col.Column, err)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// EnsureVectorDimensions 将向量列调整为指定维度，仅支持PostgreSQL
+// 空列直接修改类型；已保存向量的列无法转换，返回包含迁移步骤的错误
+func EnsureVectorDimensions(db *gorm.DB, dims int) error {
+	if dims <= 0 {
+		return nil
+	}
+	infos, err := VectorColumnDimensions(db)
+	if err != nil {
+		return err
+	}
+
+	var mismatched []string
+	for _, info := range infos {
+		if info.Dimensions == dims {
+			continue
+		}
+		if info.Vectors > 0 {
+			mismatched = append(mismatched, fmt.Sprintf("%s.%s (vector(%d), %d vectors)", info.Table, info.Column, info.Dimensions, info.Vectors))
+			continue
+		}
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE vector(%d)", info.Table, info.Column, dims)).Error; err != nil {
+			return fmt.Errorf("failed to resize %s.%s to %d dimensions: %w", info.Table, info.Column, dims, err)
+		}
+	}
+
+	if len(mismatched) > 0 {
+		return fmt.Errorf("vector columns %s do not match the configured embedding dimensions %d; "+
+			"clear the stored vectors (UPDATE <table> SET <column> = NULL), restart to resize the columns, "+
+			"then rebuild them with POST /api/v1/admin/knowledge/reindex?force=true",
+			strings.Join(mismatched, ", "), dims)
+	}
+	return nil
+}
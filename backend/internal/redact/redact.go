@@ -0,0 +1,125 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Pattern 自定义脱敏规则，Replacement为空时使用"[名称大写]"
+type Pattern struct {
+	Name        string
+	Regex       string
+	Replacement string
+}
+
+type rule struct {
+	name        string
+	re          *regexp.Regexp
+	replacement string
+}
+
+// builtinPatterns 内置规则；身份证号需先于手机号匹配
+var builtinPatterns = map[string]string{
+	"email":   `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	"id_card": `\b\d{17}[\dXx]\b`,
+	"phone":   `(?:\+?86[- ]?)?\b1[3-9]\d{9}\b|\+\d{1,3}[- ]\d{2,4}[- ]\d{3,4}[- ]\d{3,4}\b`,
+}
+
+// builtinOrder 内置规则的应用顺序
+var builtinOrder = []string{"email", "id_card", "phone"}
+
+// BuiltinNames 返回内置规则名称
+func BuiltinNames() []string {
+	return append([]string(nil), builtinOrder...)
+}
+
+// Redactor 按规则替换文本中的敏感信息，nil表示不脱敏
+type Redactor struct {
+	rules []rule
+}
+
+// New 创建脱敏器，先应用选中的内置规则，再按顺序应用自定义规则
+func New(builtins []string, patterns []Pattern) (*Redactor, error) {
+	selected := make(map[string]bool, len(builtins))
+	for _, name := range builtins {
+		if _, ok := builtinPatterns[name]; !ok {
+			return nil, fmt.Errorf("unknown builtin redaction pattern %q (available: %s)", name, strings.Join(builtinOrder, ", "))
+		}
+		selected[name] = true
+	}
+
+	r := &Redactor{}
+	for _, name := range builtinOrder {
+		if selected[name] {
+			r.rules = append(r.rules, newRule(name, regexp.MustCompile(builtinPatterns[name]), ""))
+		}
+	}
+	for _, p := range patterns {
+		if p.Name == "" {
+			return nil, fmt.Errorf("redaction pattern name is required")
+		}
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p.Name, err)
+		}
+		r.rules = append(r.rules, newRule(p.Name, re, p.Replacement))
+	}
+	return r, nil
+}
+
+func newRule(name string, re *regexp.Regexp, replacement string) rule {
+	if replacement == "" {
+		replacement = "[" + strings.ToUpper(name) + "]"
+	}
+	return rule{name: name, re: re, replacement: replacement}
+}
+
+// Counts 每条规则的替换次数
+type Counts map[string]int
+
+// Total 返回替换总数
+func (c Counts) Total() int {
+	total := 0
+	for _, n := range c {
+		total += n
+	}
+	return total
+}
+
+// Fields 转换为日志字段，键为"redacted_<规则名>"
+func (c Counts) Fields() map[string]interface{} {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make(map[string]interface{}, len(c))
+	for _, name := range names {
+		fields["redacted_"+name] = c[name]
+	}
+	return fields
+}
+
+// Redact 返回脱敏后的文本及各规则的替换次数，原文不受影响
+func (r *Redactor) Redact(text string) (string, Counts) {
+	if r == nil || text == "" {
+		return text, nil
+	}
+
+	var counts Counts
+	for _, rl := range r.rules {
+		matches := rl.re.FindAllStringIndex(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		if counts == nil {
+			counts = make(Counts)
+		}
+		counts[rl.name] += len(matches)
+		text = rl.re.ReplaceAllLiteralString(text, rl.replacement)
+	}
+	return text, counts
+}
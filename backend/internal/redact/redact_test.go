@@ -0,0 +1,66 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactBuiltins(t *testing.T) {
+	r, err := New(BuiltinNames(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create redactor: %v", err)
+	}
+
+	text := "联系张三：zhang.san@example.com，电话13812345678或+86 13987654321，身份证11010519491231002X，国际号码+1 415 555 0100。订单号2024"
+	redacted, counts := r.Redact(text)
+
+	for _, leaked := range []string{"zhang.san@example.com", "13812345678", "13987654321", "11010519491231002X", "415 555 0100"} {
+		if strings.Contains(redacted, leaked) {
+			t.Errorf("Expected %q to be redacted: %s", leaked, redacted)
+		}
+	}
+	if !strings.Contains(redacted, "订单号2024") {
+		t.Errorf("Expected unrelated numbers to be kept: %s", redacted)
+	}
+	if counts["email"] != 1 || counts["phone"] != 3 || counts["id_card"] != 1 || counts.Total() != 5 {
+		t.Errorf("Unexpected counts: %v", counts)
+	}
+	if !strings.Contains(redacted, "[EMAIL]") || !strings.Contains(redacted, "[ID_CARD]") {
+		t.Errorf("Expected default replacements: %s", redacted)
+	}
+}
+
+func TestRedactCustomPatterns(t *testing.T) {
+	r, err := New([]string{"email"}, []Pattern{{Name: "employee_id", Regex: `EMP-\d{6}`, Replacement: "EMP-******"}})
+	if err != nil {
+		t.Fatalf("Failed to create redactor: %v", err)
+	}
+
+	redacted, counts := r.Redact("EMP-123456 a@b.io 13812345678")
+	if redacted != "EMP-****** [EMAIL] 13812345678" {
+		t.Errorf("Unexpected redaction: %s", redacted)
+	}
+	if counts["employee_id"] != 1 || counts["phone"] != 0 {
+		t.Errorf("Unexpected counts: %v", counts)
+	}
+	if fields := counts.Fields(); fields["redacted_employee_id"] != 1 {
+		t.Errorf("Unexpected log fields: %v", fields)
+	}
+}
+
+func TestNewRejectsInvalidRules(t *testing.T) {
+	if _, err := New([]string{"passport"}, nil); err == nil {
+		t.Error("Expected error for unknown builtin")
+	}
+	if _, err := New(nil, []Pattern{{Name: "bad", Regex: "("}}); err == nil {
+		t.Error("Expected error for invalid regex")
+	}
+	if _, err := New(nil, []Pattern{{Regex: "x"}}); err == nil {
+		t.Error("Expected error for unnamed pattern")
+	}
+
+	var r *Redactor
+	if text, counts := r.Redact("a@b.io"); text != "a@b.io" || counts.Total() != 0 {
+		t.Error("Expected nil redactor to leave text unchanged")
+	}
+}
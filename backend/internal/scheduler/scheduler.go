@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ai-knowledge-app/pkg/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// JobFunc 定时任务执行函数
+type JobFunc func(ctx context.Context) error
+
+// job 定时任务
+type job struct {
+	name     string
+	interval time.Duration
+	run      JobFunc
+}
+
+// Scheduler 简单的后台定时任务调度器
+// 每个任务在独立的goroutine中按固定间隔执行，Stop时等待正在执行的任务结束
+type Scheduler struct {
+	jobs    []job
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	cancel  context.CancelFunc
+	started bool
+}
+
+// New 创建调度器
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// AddJob 注册定时任务，interval<=0的任务会被忽略
+// 必须在Start之前调用
+func (s *Scheduler) AddJob(name string, interval time.Duration, run JobFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if interval <= 0 {
+		logger.GetLogger().WithField("job", name).Info("Scheduled job disabled (interval <= 0)")
+		return
+	}
+
+	s.jobs = append(s.jobs, job{name: name, interval: interval, run: run})
+}
+
+// Start 启动所有已注册的任务
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return
+	}
+	s.started = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, j)
+
+		logger.GetLogger().WithFields(logrus.Fields{
+			"job":      j.name,
+			"interval": j.interval.String(),
+		}).Info("Scheduled job started")
+	}
+}
+
+// Stop 停止所有任务并等待正在执行的任务结束
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = false
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	cancel()
+	s.wg.Wait()
+}
+
+// loop 按固定间隔执行任务直到上下文被取消
+func (s *Scheduler) loop(ctx context.Context, j job) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runJob(ctx, j)
+		}
+	}
+}
+
+// runJob 执行单次任务，捕获panic避免影响其他任务
+func (s *Scheduler) runJob(ctx context.Context, j job) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.GetLogger().WithFields(logrus.Fields{
+				"job":   j.name,
+				"panic": r,
+			}).Error("Scheduled job panicked")
+		}
+	}()
+
+	startTime := time.Now()
+	if err := j.run(ctx); err != nil {
+		logger.GetLogger().WithError(err).WithField("job", j.name).Error("Scheduled job failed")
+		return
+	}
+
+	logger.GetLogger().WithFields(logrus.Fields{
+		"job":      j.name,
+		"duration": time.Since(startTime).String(),
+	}).Debug("Scheduled job completed")
+}
@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/pkg/logger"
+)
+
+func initTestLogger(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+}
+
+func TestSchedulerRunsJobs(t *testing.T) {
+	initTestLogger(t)
+
+	var runs int32
+	s := New()
+	s.AddJob("counter", 10*time.Millisecond, func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+	// 失败的任务不应影响其他任务
+	s.AddJob("failing", 10*time.Millisecond, func(ctx context.Context) error {
+		return errors.New("boom")
+	})
+
+	s.Start()
+	time.Sleep(80 * time.Millisecond)
+	s.Stop()
+
+	if atomic.LoadInt32(&runs) < 2 {
+		t.Errorf("Expected job to run at least twice, got %d", runs)
+	}
+
+	// Stop之后不再执行
+	after := atomic.LoadInt32(&runs)
+	time.Sleep(30 * time.Millisecond)
+	if atomic.LoadInt32(&runs) != after {
+		t.Error("Expected no job runs after Stop")
+	}
+}
+
+func TestSchedulerIgnoresDisabledJobs(t *testing.T) {
+	initTestLogger(t)
+
+	s := New()
+	s.AddJob("disabled", 0, func(ctx context.Context) error {
+		t.Error("Disabled job should never run")
+		return nil
+	})
+
+	if len(s.jobs) != 0 {
+		t.Errorf("Expected disabled job to be ignored, got %d jobs", len(s.jobs))
+	}
+
+	// Stop在未启动时调用应是安全的
+	s.Stop()
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"ai-knowledge-app/internal/background"
+	"ai-knowledge-app/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrJobNotFound is returned for unknown job IDs, including finished jobs past their retention
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobNotCancellable is returned when cancelling a job that already finished
+var ErrJobNotCancellable = errors.New("only pending or running jobs can be cancelled")
+
+// ErrJobAlreadyActive is returned when starting a job while another job of the
+// same type is still pending or running
+var ErrJobAlreadyActive = errors.New("a job of this type is already pending or running")
+
+// jobRetention is how long a finished job stays available for polling
+const jobRetention = time.Hour
+
+// Job is a long-running maintenance operation that clients poll by ID instead
+// of waiting on the request that started it
+type Job struct {
+	ID     string            `json:"id"`
+	Type   string            `json:"type"`
+	Status models.TaskStatus `json:"status"`
+	// Processed and Total count the items handled so far; Total is 0 until known
+	Processed int `json:"processed"`
+	Total     int `json:"total"`
+	// Result is the operation's report, partial when the job was cancelled
+	Result          interface{} `json:"result,omitempty"`
+	Error           string      `json:"error,omitempty"`
+	CancelRequested bool        `json:"cancel_requested,omitempty"`
+	CreatedAt       time.Time   `json:"created_at"`
+	StartedAt       *time.Time  `json:"started_at,omitempty"`
+	CompletedAt     *time.Time  `json:"completed_at,omitempty"`
+}
+
+// JobProgress records how many of total items a job has handled
+type JobProgress func(processed, total int)
+
+// JobFunc runs a job's operation. It must return promptly once ctx is
+// cancelled, together with whatever partial result it has.
+type JobFunc func(ctx context.Context, progress JobProgress) (interface{}, error)
+
+// LongTaskSubmitter queues work that may run past the background task timeout;
+// background.Pool implements it
+type LongTaskSubmitter interface {
+	SubmitLongRunning(name string, run background.TaskFunc) error
+}
+
+// JobManager runs jobs on the background pool and keeps their state in memory,
+// so a job can only be polled and cancelled through the instance that started it
+type JobManager struct {
+	submitter LongTaskSubmitter
+
+	mu   sync.Mutex
+	jobs map[string]*jobEntry
+}
+
+type jobEntry struct {
+	job    Job
+	cancel context.CancelFunc
+}
+
+func NewJobManager(submitter LongTaskSubmitter) *JobManager {
+	return &JobManager{submitter: submitter, jobs: make(map[string]*jobEntry)}
+}
+
+// Start queues a job and returns it in pending state. Only one job of each type
+// may be pending or running at a time, as every job type walks the whole data
+// set; while one is, Start returns that job with ErrJobAlreadyActive. When the
+// pool rejects the job the error wraps background.ErrQueueFull or
+// background.ErrPoolClosed.
+func (m *JobManager) Start(jobType string, run JobFunc) (Job, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	entry := &jobEntry{
+		job:    Job{ID: uuid.New().String(), Type: jobType, Status: models.TaskPending, CreatedAt: time.Now()},
+		cancel: cancel,
+	}
+	m.mu.Lock()
+	for _, active := range m.jobs {
+		if active.job.Type == jobType && (active.job.Status == models.TaskPending || active.job.Status == models.TaskProcessing) {
+			m.mu.Unlock()
+			cancel()
+			return active.job, ErrJobAlreadyActive
+		}
+	}
+	m.jobs[entry.job.ID] = entry
+	m.mu.Unlock()
+
+	err := m.submitter.SubmitLongRunning("admin_job_"+jobType, func(poolCtx context.Context) error {
+		// Pool shutdown cancels the job as well
+		stop := context.AfterFunc(poolCtx, cancel)
+		defer stop()
+		return m.run(ctx, entry, run)
+	})
+	if err != nil {
+		cancel()
+		m.mu.Lock()
+		delete(m.jobs, entry.job.ID)
+		m.mu.Unlock()
+		return Job{}, fmt.Errorf("failed to queue %s job: %w", jobType, err)
+	}
+	return m.snapshot(entry), nil
+}
+
+// run executes a queued job unless it was cancelled while pending
+func (m *JobManager) run(ctx context.Context, entry *jobEntry, run JobFunc) error {
+	defer entry.cancel()
+
+	m.mu.Lock()
+	if entry.job.Status != models.TaskPending {
+		m.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	entry.job.Status = models.TaskProcessing
+	entry.job.StartedAt = &now
+	m.mu.Unlock()
+
+	result, err := run(ctx, func(processed, total int) {
+		m.mu.Lock()
+		entry.job.Processed, entry.job.Total = processed, total
+		m.mu.Unlock()
+	})
+
+	m.mu.Lock()
+	finished := time.Now()
+	entry.job.Result = result
+	entry.job.CompletedAt = &finished
+	switch {
+	case ctx.Err() != nil:
+		entry.job.Status = models.TaskCancelled
+	case err != nil:
+		entry.job.Status = models.TaskFailed
+		entry.job.Error = err.Error()
+	default:
+		entry.job.Status = models.TaskCompleted
+	}
+	m.mu.Unlock()
+	m.expire(entry)
+	return err
+}
+
+// Get returns a job's current state
+func (m *JobManager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	entry, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return m.snapshot(entry), nil
+}
+
+// Cancel stops a job. A pending job is cancelled right away; a running job is
+// flagged with CancelRequested and turns cancelled once its operation returns.
+func (m *JobManager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	entry, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return Job{}, ErrJobNotFound
+	}
+	switch entry.job.Status {
+	case models.TaskPending:
+		now := time.Now()
+		entry.job.Status = models.TaskCancelled
+		entry.job.CompletedAt = &now
+		m.mu.Unlock()
+		m.expire(entry)
+	case models.TaskProcessing:
+		entry.job.CancelRequested = true
+		m.mu.Unlock()
+	default:
+		m.mu.Unlock()
+		return Job{}, ErrJobNotCancellable
+	}
+	entry.cancel()
+	return m.snapshot(entry), nil
+}
+
+func (m *JobManager) snapshot(entry *jobEntry) Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return entry.job
+}
+
+// expire drops a finished job after jobRetention
+func (m *JobManager) expire(entry *jobEntry) {
+	time.AfterFunc(jobRetention, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.jobs, entry.job.ID)
+	})
+}
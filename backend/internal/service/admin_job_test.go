@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/background"
+	"ai-knowledge-app/internal/models"
+)
+
+// jobQueue 保存提交的长任务，由测试控制执行时机；full为true时拒绝提交
+type jobQueue struct {
+	tasks []background.TaskFunc
+	full  bool
+}
+
+func (q *jobQueue) SubmitLongRunning(name string, run background.TaskFunc) error {
+	if q.full {
+		return background.ErrQueueFull
+	}
+	q.tasks = append(q.tasks, run)
+	return nil
+}
+
+func TestJobManagerLifecycle(t *testing.T) {
+	queue := &jobQueue{}
+	jobs := NewJobManager(queue)
+
+	job, err := jobs.Start("count", func(ctx context.Context, progress JobProgress) (interface{}, error) {
+		progress(1, 2)
+		progress(2, 2)
+		return map[string]int{"checked": 2}, nil
+	})
+	if err != nil || job.Status != models.TaskPending || job.Type != "count" {
+		t.Fatalf("Expected pending job, got %+v (%v)", job, err)
+	}
+
+	queue.tasks[0](context.Background())
+	job, err = jobs.Get(job.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if job.Status != models.TaskCompleted || job.Processed != 2 || job.Total != 2 || job.CompletedAt == nil {
+		t.Errorf("Expected completed job with progress 2/2, got %+v", job)
+	}
+	if _, err := jobs.Cancel(job.ID); !errors.Is(err, ErrJobNotCancellable) {
+		t.Errorf("Expected ErrJobNotCancellable for finished job, got %v", err)
+	}
+
+	failing, _ := jobs.Start("fail", func(ctx context.Context, progress JobProgress) (interface{}, error) {
+		return nil, errors.New("storage unavailable")
+	})
+	queue.tasks[1](context.Background())
+	if failing, _ = jobs.Get(failing.ID); failing.Status != models.TaskFailed || failing.Error != "storage unavailable" {
+		t.Errorf("Expected failed job with error, got %+v", failing)
+	}
+
+	if _, err := jobs.Get("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+	if _, err := NewJobManager(&jobQueue{full: true}).Start("count", nil); !errors.Is(err, background.ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestJobManagerOneActiveJobPerType(t *testing.T) {
+	queue := &jobQueue{}
+	jobs := NewJobManager(queue)
+	noop := func(ctx context.Context, progress JobProgress) (interface{}, error) { return nil, nil }
+
+	first, err := jobs.Start("reindex", noop)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	// 同类任务等待中时拒绝并返回已有任务，其他类型不受影响
+	active, err := jobs.Start("reindex", noop)
+	if !errors.Is(err, ErrJobAlreadyActive) || active.ID != first.ID {
+		t.Fatalf("Expected ErrJobAlreadyActive with job %s, got %+v (%v)", first.ID, active, err)
+	}
+	if _, err := jobs.Start("verify_integrity", noop); err != nil {
+		t.Errorf("Expected other job types to start, got %v", err)
+	}
+	if len(queue.tasks) != 2 {
+		t.Errorf("Expected two submitted jobs, got %d", len(queue.tasks))
+	}
+
+	// 已有任务结束后可以再次启动
+	queue.tasks[0](context.Background())
+	if _, err := jobs.Start("reindex", noop); err != nil {
+		t.Errorf("Expected job to start after the previous one finished, got %v", err)
+	}
+}
+
+func TestJobManagerCancel(t *testing.T) {
+	queue := &jobQueue{}
+	jobs := NewJobManager(queue)
+
+	// 等待中的任务立即取消，之后不再执行
+	ran := false
+	pending, _ := jobs.Start("pending", func(ctx context.Context, progress JobProgress) (interface{}, error) {
+		ran = true
+		return nil, nil
+	})
+	if job, err := jobs.Cancel(pending.ID); err != nil || job.Status != models.TaskCancelled {
+		t.Fatalf("Expected pending job to be cancelled, got %+v (%v)", job, err)
+	}
+	queue.tasks[0](context.Background())
+	if ran {
+		t.Error("Expected cancelled pending job not to run")
+	}
+
+	// 运行中的任务在操作返回后变为cancelled，保留部分结果
+	started := make(chan struct{})
+	running, _ := jobs.Start("running", func(ctx context.Context, progress JobProgress) (interface{}, error) {
+		progress(1, 10)
+		close(started)
+		<-ctx.Done()
+		return "partial", ctx.Err()
+	})
+	done := make(chan struct{})
+	go func() {
+		queue.tasks[1](context.Background())
+		close(done)
+	}()
+	<-started
+
+	job, err := jobs.Cancel(running.ID)
+	if err != nil || job.Status != models.TaskProcessing || !job.CancelRequested {
+		t.Fatalf("Expected running job with cancel requested, got %+v (%v)", job, err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected running job to stop after cancel")
+	}
+	job, _ = jobs.Get(running.ID)
+	if job.Status != models.TaskCancelled || job.Result != "partial" || job.Processed != 1 {
+		t.Errorf("Expected cancelled job with partial result, got %+v", job)
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ai-knowledge-app/internal/config"
+)
+
+// ErrInvalidChunkMetadata is returned when chunk metadata does not conform to
+// the schema and the schema rejects non-conforming metadata
+var ErrInvalidChunkMetadata = errors.New("invalid chunk metadata")
+
+// MetadataFieldType is the JSON type a chunk metadata value must have
+type MetadataFieldType string
+
+const (
+	MetadataString  MetadataFieldType = "string"
+	MetadataNumber  MetadataFieldType = "number"
+	MetadataBoolean MetadataFieldType = "boolean"
+	MetadataArray   MetadataFieldType = "array"
+	MetadataObject  MetadataFieldType = "object"
+)
+
+// MetadataSchemaMode decides what happens to chunks whose metadata does not conform
+type MetadataSchemaMode string
+
+const (
+	// MetadataSchemaWarn logs non-conforming metadata and saves the chunk anyway
+	MetadataSchemaWarn MetadataSchemaMode = "warn"
+	// MetadataSchemaReject fails processing, or the chunk edit, instead
+	MetadataSchemaReject MetadataSchemaMode = "reject"
+)
+
+// MetadataField constrains one metadata key. Keys not listed in the schema are
+// allowed with any value.
+type MetadataField struct {
+	Key      string            `json:"key"`
+	Type     MetadataFieldType `json:"type"`
+	Required bool              `json:"required"`
+}
+
+// ChunkMetadataSchema describes the metadata every chunk must carry. A schema
+// without fields accepts any metadata. Schemas come from the configuration,
+// which config.Validate checks at startup.
+type ChunkMetadataSchema struct {
+	Mode   MetadataSchemaMode `json:"mode"` // MetadataSchemaWarn when empty
+	Fields []MetadataField    `json:"fields"`
+}
+
+// NewChunkMetadataSchema converts the configured schema
+func NewChunkMetadataSchema(cfg config.ChunkMetadataSchemaConfig) ChunkMetadataSchema {
+	schema := ChunkMetadataSchema{Mode: MetadataSchemaMode(cfg.Mode)}
+	for _, field := range cfg.Fields {
+		schema.Fields = append(schema.Fields, MetadataField{
+			Key:      field.Key,
+			Type:     MetadataFieldType(field.Type),
+			Required: field.Required,
+		})
+	}
+	return schema
+}
+
+// Rejects reports whether non-conforming metadata should be refused rather than logged
+func (s ChunkMetadataSchema) Rejects() bool {
+	return s.Mode == MetadataSchemaReject
+}
+
+// Check returns an error wrapping ErrInvalidChunkMetadata that lists every
+// missing required key and every value of the wrong type, or nil when the
+// metadata conforms
+func (s ChunkMetadataSchema) Check(metadata map[string]interface{}) error {
+	var problems []string
+	for _, field := range s.Fields {
+		value, ok := metadata[field.Key]
+		if !ok || value == nil {
+			if field.Required {
+				problems = append(problems, fmt.Sprintf("missing required key %q", field.Key))
+			}
+			continue
+		}
+		if actual := metadataValueType(value); actual != field.Type {
+			problems = append(problems, fmt.Sprintf("key %q must be %s, got %s", field.Key, field.Type, actual))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("%w: %s", ErrInvalidChunkMetadata, strings.Join(problems, "; "))
+}
+
+// metadataValueType maps a Go value, as built by the processor or decoded from
+// JSON, to its JSON type
+func metadataValueType(value interface{}) MetadataFieldType {
+	switch value.(type) {
+	case string:
+		return MetadataString
+	case bool:
+		return MetadataBoolean
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return MetadataNumber
+	case []interface{}, []string:
+		return MetadataArray
+	case map[string]interface{}:
+		return MetadataObject
+	}
+	return MetadataFieldType(fmt.Sprintf("%T", value))
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/pkg/logger"
+)
+
+func TestChunkMetadataSchemaCheck(t *testing.T) {
+	schema := ChunkMetadataSchema{Fields: []MetadataField{
+		{Key: "document_name", Type: MetadataString, Required: true},
+		{Key: "char_count", Type: MetadataNumber},
+		{Key: "tags", Type: MetadataArray},
+	}}
+
+	// 未列出的键不受限制，JSON解码的数字为float64
+	valid := map[string]interface{}{"document_name": "guide", "char_count": float64(12), "extra": true}
+	if err := schema.Check(valid); err != nil {
+		t.Errorf("Expected conforming metadata, got %v", err)
+	}
+
+	err := schema.Check(map[string]interface{}{"char_count": "12", "tags": []interface{}{"a"}})
+	if !errors.Is(err, ErrInvalidChunkMetadata) {
+		t.Fatalf("Expected ErrInvalidChunkMetadata, got %v", err)
+	}
+	for _, want := range []string{`missing required key "document_name"`, `key "char_count" must be number, got string`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got %v", want, err)
+		}
+	}
+}
+
+func TestNewChunkMetadataSchema(t *testing.T) {
+	schema := NewChunkMetadataSchema(config.ChunkMetadataSchemaConfig{
+		Mode:   "reject",
+		Fields: []config.ChunkMetadataFieldConfig{{Key: "page", Type: "number", Required: true}},
+	})
+	if !schema.Rejects() || len(schema.Fields) != 1 || schema.Fields[0] != (MetadataField{Key: "page", Type: MetadataNumber, Required: true}) {
+		t.Errorf("Unexpected schema %+v", schema)
+	}
+}
+
+func TestProcessDocumentChunkMetadataSchema(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	db := setupTestDB()
+	db.AutoMigrate(&models.DocumentChunk{})
+
+	processor := NewDocumentProcessor(db)
+	processor.SetObjectReader(memoryObjects{"documents/notes.txt": "First paragraph.\n\nSecond paragraph."})
+	doc := models.Document{Name: "notes", Extension: ".txt", FilePath: "documents/notes.txt"}
+	db.Create(&doc)
+
+	// 处理生成的分块记录来源文档等元数据
+	if err := processor.ProcessDocument(doc.ID); err != nil {
+		t.Fatalf("ProcessDocument failed: %v", err)
+	}
+	chunks, _ := processor.GetDocumentChunks(doc.ID)
+	if len(chunks) == 0 || chunks[0].Metadata["document_name"] != "notes" || chunks[0].Metadata["file_type"] != "txt" {
+		t.Fatalf("Expected chunk metadata to describe the document, got %+v", chunks)
+	}
+
+	// warn模式下不符合结构的分块照常保存
+	required := []MetadataField{{Key: "author", Type: MetadataString, Required: true}}
+	processor.SetChunkMetadataSchema(ChunkMetadataSchema{Mode: MetadataSchemaWarn, Fields: required})
+	if err := processor.ProcessDocument(doc.ID); err != nil {
+		t.Fatalf("Expected warn mode to save chunks, got %v", err)
+	}
+
+	// reject模式下处理失败，保留之前的分块
+	processor.SetChunkMetadataSchema(ChunkMetadataSchema{Mode: MetadataSchemaReject, Fields: required})
+	if err := processor.ProcessDocument(doc.ID); !errors.Is(err, ErrInvalidChunkMetadata) {
+		t.Fatalf("Expected ErrInvalidChunkMetadata, got %v", err)
+	}
+	stored, _ := processor.GetDocument(doc.ID)
+	if stored.Status != "failed" || !strings.Contains(stored.Error, `missing required key "author"`) {
+		t.Errorf("Expected failed status with schema error, got %q (%q)", stored.Status, stored.Error)
+	}
+	if kept, _ := processor.GetDocumentChunks(doc.ID); len(kept) != len(chunks) {
+		t.Errorf("Expected previous chunks to be kept, got %d", len(kept))
+	}
+}
@@ -0,0 +1,406 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ChunkingStrategy identifies how document text is split into chunks
+type ChunkingStrategy string
+
+const (
+	ChunkingFixed     ChunkingStrategy = "fixed"     // fixed-size rune windows with overlap
+	ChunkingSentence  ChunkingStrategy = "sentence"  // sentences packed up to the chunk size
+	ChunkingParagraph ChunkingStrategy = "paragraph" // paragraphs packed up to the chunk size
+	ChunkingMarkdown  ChunkingStrategy = "markdown"  // one section per markdown heading
+	ChunkingRecursive ChunkingStrategy = "recursive" // split on separators by priority, merged up to the chunk size
+)
+
+// ChunkingOptions controls how a document is chunked. Sizes are in runes.
+type ChunkingOptions struct {
+	Strategy  ChunkingStrategy `json:"strategy"`
+	ChunkSize int              `json:"chunk_size"`
+	Overlap   int              `json:"overlap"` // only used by the fixed and recursive strategies
+
+	// Recursive strategy only: separators in priority order (DefaultSeparators
+	// when empty), and the size below which chunks are dropped
+	Separators   []string `json:"separators,omitempty"`
+	MinChunkSize int      `json:"min_chunk_size,omitempty"`
+}
+
+// DefaultSeparators are tried in order by the recursive strategy: paragraphs,
+// lines, sentences, clauses, then words
+var DefaultSeparators = []string{"\n\n", "\n", "。", "！", "？", ". ", "! ", "? ", "；", "; ", "，", ", ", " "}
+
+// DefaultChunkingOptions returns the options used when none are given
+func DefaultChunkingOptions() ChunkingOptions {
+	return ChunkingOptions{Strategy: ChunkingFixed, ChunkSize: 500, Overlap: 50}
+}
+
+// withDefaults fills zero-valued fields from DefaultChunkingOptions
+func (o ChunkingOptions) withDefaults() ChunkingOptions {
+	defaults := DefaultChunkingOptions()
+	if o.Strategy == "" {
+		o.Strategy = defaults.Strategy
+	}
+	if o.ChunkSize == 0 {
+		o.ChunkSize = defaults.ChunkSize
+		if o.Overlap == 0 {
+			o.Overlap = defaults.Overlap
+		}
+	}
+	return o
+}
+
+// Validate checks the strategy name and sizes
+func (o ChunkingOptions) Validate() error {
+	switch o.Strategy {
+	case ChunkingFixed, ChunkingSentence, ChunkingParagraph, ChunkingMarkdown, ChunkingRecursive:
+	default:
+		return fmt.Errorf("unknown chunking strategy %q (supported: fixed, sentence, paragraph, markdown, recursive)", o.Strategy)
+	}
+	if o.ChunkSize <= 0 {
+		return fmt.Errorf("chunk size must be positive")
+	}
+	if o.Overlap < 0 || o.Overlap >= o.ChunkSize {
+		return fmt.Errorf("overlap must be between 0 and chunk size")
+	}
+	if o.MinChunkSize < 0 || o.MinChunkSize > o.ChunkSize {
+		return fmt.Errorf("min chunk size must be between 0 and chunk size")
+	}
+	for _, sep := range o.Separators {
+		if sep == "" {
+			return fmt.Errorf("separators must not be empty")
+		}
+	}
+	return nil
+}
+
+// TextChunker splits text into chunks
+type TextChunker interface {
+	Strategy() ChunkingStrategy
+	Chunk(text string) []string
+}
+
+// ChunkSpan is a chunk with its byte offsets in the chunked text
+type ChunkSpan struct {
+	Text        string
+	StartOffset int
+	EndOffset   int
+}
+
+// SpanChunker is implemented by chunkers whose chunks are exact substrings of
+// the input and can report where each one came from
+type SpanChunker interface {
+	ChunkSpans(text string) []ChunkSpan
+}
+
+// NewTextChunker creates the chunker for the given options, filling in defaults for zero values
+func NewTextChunker(opts ChunkingOptions) (TextChunker, error) {
+	opts = opts.withDefaults()
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch opts.Strategy {
+	case ChunkingSentence:
+		return &sentenceChunker{size: opts.ChunkSize}, nil
+	case ChunkingParagraph:
+		return &paragraphChunker{size: opts.ChunkSize}, nil
+	case ChunkingMarkdown:
+		return &markdownChunker{size: opts.ChunkSize}, nil
+	case ChunkingRecursive:
+		separators := opts.Separators
+		if len(separators) == 0 {
+			separators = DefaultSeparators
+		}
+		return &recursiveChunker{size: opts.ChunkSize, overlap: opts.Overlap, minSize: opts.MinChunkSize, separators: separators}, nil
+	default:
+		return &fixedChunker{size: opts.ChunkSize, overlap: opts.Overlap}, nil
+	}
+}
+
+type fixedChunker struct {
+	size    int
+	overlap int
+}
+
+func (c *fixedChunker) Strategy() ChunkingStrategy { return ChunkingFixed }
+
+func (c *fixedChunker) Chunk(text string) []string {
+	return splitRunes(strings.TrimSpace(text), c.size, c.overlap)
+}
+
+type sentenceChunker struct {
+	size int
+}
+
+func (c *sentenceChunker) Strategy() ChunkingStrategy { return ChunkingSentence }
+
+func (c *sentenceChunker) Chunk(text string) []string {
+	return packUnits(splitSentences(text), c.size, " ", func(s string) []string {
+		return splitRunes(s, c.size, 0)
+	})
+}
+
+type paragraphChunker struct {
+	size int
+}
+
+func (c *paragraphChunker) Strategy() ChunkingStrategy { return ChunkingParagraph }
+
+func (c *paragraphChunker) Chunk(text string) []string {
+	sentences := &sentenceChunker{size: c.size}
+	return packUnits(splitParagraphs(text), c.size, "\n\n", sentences.Chunk)
+}
+
+type markdownChunker struct {
+	size int
+}
+
+func (c *markdownChunker) Strategy() ChunkingStrategy { return ChunkingMarkdown }
+
+// Chunk emits one chunk per heading section. Oversized sections are split by
+// paragraph and every piece keeps the section heading for context.
+func (c *markdownChunker) Chunk(text string) []string {
+	var chunks []string
+	for _, section := range splitMarkdownSections(text) {
+		if utf8.RuneCountInString(section.body()) <= c.size {
+			chunks = append(chunks, section.body())
+			continue
+		}
+
+		bodySize := c.size - utf8.RuneCountInString(section.heading) - 1
+		if section.heading == "" || bodySize < c.size/2 {
+			// Heading too long to repeat; split the section as plain text
+			chunks = append(chunks, (&paragraphChunker{size: c.size}).Chunk(section.body())...)
+			continue
+		}
+		for _, piece := range (&paragraphChunker{size: bodySize}).Chunk(section.content) {
+			chunks = append(chunks, section.heading+"\n"+piece)
+		}
+	}
+	return chunks
+}
+
+const markdownFence = "```"
+
+var (
+	sentenceEnd     = regexp.MustCompile(`[.!?;]+\s+|[。！？；]+`)
+	paragraphBreak  = regexp.MustCompile(`\n\s*\n`)
+	markdownHeading = regexp.MustCompile(`^#{1,6}\s+\S`)
+)
+
+// splitRunes splits text into windows of at most size runes with about overlap
+// runes repeated between windows. Windows end at a sentence or word boundary in
+// their second half when there is one, so words are only cut when a single word
+// is longer than the window.
+func splitRunes(text string, size, overlap int) []string {
+	runes := []rune(text)
+	var chunks []string
+	for i := 0; i < len(runes); {
+		end := i + size
+		if end >= len(runes) {
+			end = len(runes)
+		} else {
+			// Keep windows reasonably full and always advance past the overlap
+			lo := i + size/2
+			if lo < i+overlap+1 {
+				lo = i + overlap + 1
+			}
+			end = chunkEnd(runes, lo, end)
+		}
+		if piece := strings.TrimSpace(string(runes[i:end])); piece != "" {
+			chunks = append(chunks, piece)
+		}
+		if end == len(runes) {
+			break
+		}
+
+		next := end - overlap
+		if overlap > 0 {
+			// Start the overlap at a word rather than mid-word
+			for k := next; k < end; k++ {
+				if isWordBoundary(runes, k) {
+					next = k
+					break
+				}
+			}
+		}
+		i = next
+	}
+	return chunks
+}
+
+// chunkEnd picks where a window ending at or before end should stop, preferring
+// a sentence boundary, then a clause boundary, then a word boundary, no earlier than lo
+func chunkEnd(runes []rune, lo, end int) int {
+	for _, boundary := range []func([]rune, int) bool{isSentenceBoundary, isClauseBoundary, isWordBoundary} {
+		for k := end; k >= lo; k-- {
+			if boundary(runes, k) {
+				return k
+			}
+		}
+	}
+	return end
+}
+
+// isSentenceBoundary reports whether position k directly follows sentence-ending punctuation
+func isSentenceBoundary(runes []rune, k int) bool {
+	if k <= 0 || k >= len(runes) {
+		return true
+	}
+	if !strings.ContainsRune(".!?;。！？；", runes[k-1]) {
+		return false
+	}
+	// "3.14" or "e.g.x" are not sentence ends; CJK punctuation needs no space
+	return unicode.IsSpace(runes[k]) || runes[k-1] > unicode.MaxASCII
+}
+
+// isClauseBoundary reports whether position k directly follows punctuation such as a comma
+func isClauseBoundary(runes []rune, k int) bool {
+	if k <= 0 || k >= len(runes) {
+		return true
+	}
+	prev, next := runes[k-1], runes[k]
+	if !unicode.IsPunct(prev) || unicode.IsPunct(next) {
+		return false
+	}
+	// ASCII punctuation ends a clause only before whitespace ("3.14", "a,b" do not)
+	return prev > unicode.MaxASCII || unicode.IsSpace(next)
+}
+
+// isWordBoundary reports whether text can be cut before position k without
+// splitting a word. Scripts written without spaces (Han, kana) break between
+// any two characters.
+func isWordBoundary(runes []rune, k int) bool {
+	if k <= 0 || k >= len(runes) {
+		return true
+	}
+	prev, next := runes[k-1], runes[k]
+	if unicode.IsSpace(prev) || unicode.IsSpace(next) {
+		return true
+	}
+	// Never leave punctuation dangling at the start of the next chunk
+	if unicode.IsPunct(next) {
+		return false
+	}
+	return isUnspacedScript(prev) || isUnspacedScript(next)
+}
+
+func isUnspacedScript(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// splitSentences splits text after sentence-ending punctuation, keeping the punctuation
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for _, loc := range sentenceEnd.FindAllStringIndex(text, -1) {
+		if s := strings.TrimSpace(text[start:loc[1]]); s != "" {
+			sentences = append(sentences, s)
+		}
+		start = loc[1]
+	}
+	if s := strings.TrimSpace(text[start:]); s != "" {
+		sentences = append(sentences, s)
+	}
+	return sentences
+}
+
+// splitParagraphs splits text on blank lines
+func splitParagraphs(text string) []string {
+	var paragraphs []string
+	for _, p := range paragraphBreak.Split(text, -1) {
+		if p = strings.TrimSpace(p); p != "" {
+			paragraphs = append(paragraphs, p)
+		}
+	}
+	return paragraphs
+}
+
+// packUnits greedily joins consecutive units into chunks of at most size runes.
+// Units larger than size are split with oversized.
+func packUnits(units []string, size int, sep string, oversized func(string) []string) []string {
+	var chunks []string
+	var current strings.Builder
+	currentLen := 0
+	sepLen := utf8.RuneCountInString(sep)
+
+	flush := func() {
+		if currentLen > 0 {
+			chunks = append(chunks, current.String())
+			current.Reset()
+			currentLen = 0
+		}
+	}
+
+	for _, unit := range units {
+		unitLen := utf8.RuneCountInString(unit)
+		if unitLen > size {
+			flush()
+			chunks = append(chunks, oversized(unit)...)
+			continue
+		}
+		if currentLen > 0 && currentLen+sepLen+unitLen > size {
+			flush()
+		}
+		if currentLen > 0 {
+			current.WriteString(sep)
+			currentLen += sepLen
+		}
+		current.WriteString(unit)
+		currentLen += unitLen
+	}
+	flush()
+	return chunks
+}
+
+type markdownSection struct {
+	heading string
+	content string
+}
+
+func (s markdownSection) body() string {
+	if s.heading == "" {
+		return s.content
+	}
+	if s.content == "" {
+		return s.heading
+	}
+	return s.heading + "\n" + s.content
+}
+
+// splitMarkdownSections splits markdown at heading lines, ignoring headings inside code fences
+func splitMarkdownSections(text string) []markdownSection {
+	var sections []markdownSection
+	current := markdownSection{}
+	var lines []string
+	inFence := false
+
+	flush := func() {
+		current.content = strings.TrimSpace(strings.Join(lines, "\n"))
+		if current.heading != "" || current.content != "" {
+			sections = append(sections, current)
+		}
+		lines = nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, markdownFence) {
+			inFence = !inFence
+		}
+		if !inFence && markdownHeading.MatchString(trimmed) {
+			flush()
+			current = markdownSection{heading: trimmed}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	return sections
+}
@@ -0,0 +1,459 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"ai-knowledge-app/internal/models"
+)
+
+func TestChunkingOptionsValidate(t *testing.T) {
+	valid := []ChunkingOptions{
+		DefaultChunkingOptions(),
+		{Strategy: ChunkingSentence, ChunkSize: 100},
+		{Strategy: ChunkingMarkdown, ChunkSize: 100, Overlap: 10},
+	}
+	for _, opts := range valid {
+		if err := opts.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", opts, err)
+		}
+	}
+
+	invalid := []ChunkingOptions{
+		{Strategy: "semantic", ChunkSize: 100},
+		{Strategy: ChunkingFixed, ChunkSize: 0},
+		{Strategy: ChunkingFixed, ChunkSize: 100, Overlap: 100},
+		{Strategy: ChunkingFixed, ChunkSize: 100, Overlap: -1},
+	}
+	for _, opts := range invalid {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", opts)
+		}
+	}
+
+	if _, err := NewTextChunker(ChunkingOptions{Strategy: "semantic"}); err == nil {
+		t.Error("Expected NewTextChunker to reject unknown strategy")
+	}
+	chunker, err := NewTextChunker(ChunkingOptions{})
+	if err != nil || chunker.Strategy() != ChunkingFixed {
+		t.Errorf("Expected empty options to default to fixed strategy, got %v, %v", chunker, err)
+	}
+}
+
+func TestFixedChunkerSplitsByRunes(t *testing.T) {
+	chunker, _ := NewTextChunker(ChunkingOptions{Strategy: ChunkingFixed, ChunkSize: 4, Overlap: 1})
+	chunks := chunker.Chunk("你好世界欢迎光临")
+
+	expected := []string{"你好世界", "界欢迎光", "光临"}
+	if strings.Join(chunks, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %v, got %v", expected, chunks)
+	}
+	for _, c := range chunks {
+		if !utf8.ValidString(c) {
+			t.Errorf("Chunk %q is not valid UTF-8", c)
+		}
+	}
+}
+
+func TestFixedChunkerBreaksOnWordBoundaries(t *testing.T) {
+	chunker, _ := NewTextChunker(ChunkingOptions{Strategy: ChunkingFixed, ChunkSize: 20, Overlap: 6})
+	text := "The quick brown fox jumps over the lazy dog near the riverbank"
+	chunks := chunker.Chunk(text)
+
+	words := map[string]bool{}
+	for _, w := range strings.Fields(text) {
+		words[w] = true
+	}
+	for _, c := range chunks {
+		if utf8.RuneCountInString(c) > 20 {
+			t.Errorf("Chunk %q exceeds chunk size", c)
+		}
+		for _, w := range strings.Fields(c) {
+			if !words[w] {
+				t.Errorf("Chunk %q splits a word: %q", c, w)
+			}
+		}
+	}
+	if !strings.HasSuffix(chunks[len(chunks)-1], "riverbank") {
+		t.Errorf("Expected final chunk to end the text, got %q", chunks)
+	}
+	// 重叠部分从完整的单词开始
+	if chunks[1] != "fox jumps over the" {
+		t.Errorf("Expected overlap to start at a word, got %q", chunks)
+	}
+}
+
+func TestFixedChunkerPrefersSentenceBoundaries(t *testing.T) {
+	chunker, _ := NewTextChunker(ChunkingOptions{Strategy: ChunkingFixed, ChunkSize: 12, Overlap: 0})
+	chunks := chunker.Chunk("今天天气很好。我们去公园散步吧，好不好？")
+
+	expected := []string{"今天天气很好。", "我们去公园散步吧，", "好不好？"}
+	if strings.Join(chunks, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %v, got %v", expected, chunks)
+	}
+
+	// 比窗口还长的单词只能硬切，但不会破坏UTF-8
+	chunks = (&fixedChunker{size: 5}).Chunk("Übergrößenträger ok")
+	for _, c := range chunks {
+		if !utf8.ValidString(c) || utf8.RuneCountInString(c) > 5 {
+			t.Errorf("Unexpected chunk %q", c)
+		}
+	}
+}
+
+func TestFixedChunkerMixedScriptsKeepValidRunes(t *testing.T) {
+	text := strings.Repeat("Go语言的并发模型 goroutine 非常轻量。Channels make it safe! ", 20)
+	for _, size := range []int{7, 16, 50, 128} {
+		chunker, _ := NewTextChunker(ChunkingOptions{Strategy: ChunkingFixed, ChunkSize: size, Overlap: size / 5})
+		chunks := chunker.Chunk(text)
+		if len(chunks) == 0 {
+			t.Fatalf("size %d: expected chunks", size)
+		}
+		for _, c := range chunks {
+			if !utf8.ValidString(c) || strings.ContainsRune(c, utf8.RuneError) {
+				t.Errorf("size %d: chunk %q contains broken runes", size, c)
+			}
+			if utf8.RuneCountInString(c) > size {
+				t.Errorf("size %d: chunk %q exceeds chunk size", size, c)
+			}
+		}
+	}
+}
+
+func recursiveSpans(t *testing.T, opts ChunkingOptions, text string) []ChunkSpan {
+	t.Helper()
+	opts.Strategy = ChunkingRecursive
+	chunker, err := NewTextChunker(opts)
+	if err != nil {
+		t.Fatalf("NewTextChunker failed: %v", err)
+	}
+	return chunker.(SpanChunker).ChunkSpans(text)
+}
+
+func TestRecursiveChunkerSplitsBySeparatorPriority(t *testing.T) {
+	text := "First paragraph here.\n\nSecond paragraph, with a clause. And a sentence.\n\n第三段。很短。"
+	spans := recursiveSpans(t, ChunkingOptions{ChunkSize: 30}, text)
+
+	// 超长段落依次按句子、逗号切分，再与相邻片段合并
+	expected := []string{"First paragraph here.", "Second paragraph,", "with a clause.", "And a sentence.\n\n第三段。很短。"}
+	var got []string
+	for _, span := range spans {
+		got = append(got, span.Text)
+		if text[span.StartOffset:span.EndOffset] != span.Text {
+			t.Errorf("Offsets [%d,%d) do not match chunk %q", span.StartOffset, span.EndOffset, span.Text)
+		}
+	}
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestRecursiveChunkerOverlap(t *testing.T) {
+	text := strings.Repeat("Overlap must repeat the tail of the previous chunk. 重叠部分来自上一个分块的结尾。", 8)
+	spans := recursiveSpans(t, ChunkingOptions{ChunkSize: 60, Overlap: 15}, text)
+	if len(spans) < 3 {
+		t.Fatalf("Expected several chunks, got %d", len(spans))
+	}
+
+	covered := 0
+	for i, span := range spans {
+		if !utf8.ValidString(span.Text) || utf8.RuneCountInString(span.Text) > 60 {
+			t.Errorf("Chunk %d is invalid or too long: %q", i, span.Text)
+		}
+		if text[span.StartOffset:span.EndOffset] != span.Text {
+			t.Errorf("Chunk %d offsets do not match its text", i)
+		}
+		if span.StartOffset > covered {
+			t.Errorf("Chunk %d leaves a gap at [%d,%d)", i, covered, span.StartOffset)
+		}
+		if i > 0 {
+			prev := spans[i-1]
+			if span.StartOffset >= prev.EndOffset {
+				t.Errorf("Chunk %d does not overlap the previous chunk", i)
+				continue
+			}
+			shared := text[span.StartOffset:prev.EndOffset]
+			if !strings.HasSuffix(prev.Text, shared) || !strings.HasPrefix(span.Text, shared) || utf8.RuneCountInString(shared) > 15 {
+				t.Errorf("Chunk %d overlap %q is not a tail of at most 15 runes of the previous chunk", i, shared)
+			}
+		}
+		covered = span.EndOffset
+	}
+	if covered != len(strings.TrimSpace(text)) {
+		t.Errorf("Expected chunks to cover the text, ended at %d of %d", covered, len(text))
+	}
+}
+
+func TestRecursiveChunkerMinChunkSize(t *testing.T) {
+	// 比最小分块还短的文档作为唯一分块保留
+	spans := recursiveSpans(t, ChunkingOptions{ChunkSize: 100, MinChunkSize: 20}, "  Short note.  ")
+	if len(spans) != 1 || spans[0].Text != "Short note." || spans[0].StartOffset != 2 || spans[0].EndOffset != 13 {
+		t.Errorf("Expected the short document as a single trimmed chunk, got %+v", spans)
+	}
+
+	text := "A paragraph that is long enough to keep.\n\nAnother paragraph that is long enough.\n\nTiny."
+	spans = recursiveSpans(t, ChunkingOptions{ChunkSize: 42, MinChunkSize: 10, Separators: []string{"\n\n"}}, text)
+	if len(spans) != 2 || spans[0].Text != "A paragraph that is long enough to keep." || spans[1].Text != "Another paragraph that is long enough." {
+		t.Errorf("Expected the tiny chunk to be dropped, got %+v", spans)
+	}
+
+	if _, err := NewTextChunker(ChunkingOptions{Strategy: ChunkingRecursive, ChunkSize: 10, MinChunkSize: 11}); err == nil {
+		t.Error("Expected min chunk size above chunk size to be rejected")
+	}
+	if _, err := NewTextChunker(ChunkingOptions{Strategy: ChunkingRecursive, ChunkSize: 10, Separators: []string{""}}); err == nil {
+		t.Error("Expected empty separator to be rejected")
+	}
+}
+
+func TestSentenceChunkerPacksSentences(t *testing.T) {
+	chunker, _ := NewTextChunker(ChunkingOptions{Strategy: ChunkingSentence, ChunkSize: 30})
+	chunks := chunker.Chunk("Go is fast. Go is simple. 它很流行。Is it fun? Yes!")
+
+	expected := []string{"Go is fast. Go is simple.", "它很流行。 Is it fun? Yes!"}
+	if strings.Join(chunks, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %v, got %v", expected, chunks)
+	}
+}
+
+func TestParagraphChunkerKeepsParagraphsTogether(t *testing.T) {
+	chunker, _ := NewTextChunker(ChunkingOptions{Strategy: ChunkingParagraph, ChunkSize: 40})
+	text := "First paragraph.\n\nSecond one.\n\n\nA third paragraph that is rather long. It has two sentences."
+	chunks := chunker.Chunk(text)
+
+	expected := []string{
+		"First paragraph.\n\nSecond one.",
+		"A third paragraph that is rather long.",
+		"It has two sentences.",
+	}
+	if strings.Join(chunks, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, chunks)
+	}
+}
+
+func TestMarkdownChunkerSplitsOnHeadings(t *testing.T) {
+	chunker, _ := NewTextChunker(ChunkingOptions{Strategy: ChunkingMarkdown, ChunkSize: 60})
+	text := "Intro text.\n\n# Install\nRun go get.\n\n```\n# not a heading\n```\n## Usage\nFirst usage paragraph here.\n\nSecond usage paragraph here."
+	chunks := chunker.Chunk(text)
+
+	expected := []string{
+		"Intro text.",
+		"# Install\nRun go get.\n\n```\n# not a heading\n```",
+		"## Usage\nFirst usage paragraph here.",
+		"## Usage\nSecond usage paragraph here.",
+	}
+	if strings.Join(chunks, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, chunks)
+	}
+}
+
+func TestProcessDocumentRecordsChunkingStrategy(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&models.DocumentChunk{})
+
+	path := filepath.Join(t.TempDir(), "guide.md")
+	content := "# Guide\nFirst section.\n\n# Next\nSecond section."
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	doc := models.Document{Name: "guide", FileType: "md", FilePath: path}
+	db.Create(&doc)
+
+	processor := NewDocumentProcessor(db)
+	if err := processor.ProcessDocumentWithOptions(doc.ID, ChunkingOptions{Strategy: "semantic"}); err == nil {
+		t.Fatal("Expected invalid strategy to be rejected")
+	}
+
+	if err := processor.ProcessDocumentWithOptions(doc.ID, ChunkingOptions{Strategy: ChunkingMarkdown}); err != nil {
+		t.Fatalf("ProcessDocumentWithOptions failed: %v", err)
+	}
+	chunks, _ := processor.GetDocumentChunks(doc.ID)
+	if len(chunks) != 2 || chunks[0].Content != "# Guide\nFirst section." || chunks[0].Strategy != "markdown" {
+		t.Fatalf("Unexpected markdown chunks: %+v", chunks)
+	}
+
+	// 重新分块会替换旧的分块
+	if err := processor.ProcessDocumentWithOptions(doc.ID, ChunkingOptions{Strategy: ChunkingParagraph}); err != nil {
+		t.Fatalf("ProcessDocumentWithOptions failed: %v", err)
+	}
+	chunks, _ = processor.GetDocumentChunks(doc.ID)
+	if len(chunks) != 1 || chunks[0].Strategy != "paragraph" {
+		t.Errorf("Expected chunks to be replaced by a single paragraph chunk, got %+v", chunks)
+	}
+
+	// recursive策略记录分块在清洗后文本中的位置
+	if err := processor.ProcessDocumentWithOptions(doc.ID, ChunkingOptions{Strategy: ChunkingRecursive, ChunkSize: 20}); err != nil {
+		t.Fatalf("ProcessDocumentWithOptions failed: %v", err)
+	}
+	chunks, _ = processor.GetDocumentChunks(doc.ID)
+	stored, _ := processor.GetDocument(doc.ID)
+	for _, c := range chunks {
+		if c.StartOffset == nil || c.EndOffset == nil || stored.CleanedText[*c.StartOffset:*c.EndOffset] != c.Content {
+			t.Errorf("Expected chunk offsets to locate %q in the cleaned text", c.Content)
+		}
+	}
+}
+
+func TestCleanDocumentTextKeepsAllScripts(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"latin", "Hello, world!", "Hello, world!"},
+		{"cjk", "你好，世界。", "你好，世界。"},
+		{"cyrillic", "Привет, мир!", "Привет, мир!"},
+		{"arabic", "مرحبا بالعالم، كيف حالك؟", "مرحبا بالعالم، كيف حالك؟"},
+		{"greek and accents", "Καλημέρα — café naïve", "Καλημέρα — café naïve"},
+		{"hindi marks", "नमस्ते दुनिया", "नमस्ते दुनिया"},
+		{"mixed", "Go 语言 и Русский 123", "Go 语言 и Русский 123"},
+		{"symbols dropped", "price ★ 5 ✓", "price 5"},
+		{"html and page markers", "<p>Страница</p> Page 3", "Страница"},
+	}
+	for _, tc := range cases {
+		if got := cleanDocumentText(tc.in); got != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestProcessDocumentUsesConfiguredChunking(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&models.DocumentChunk{})
+
+	text := strings.Repeat("Chunk sizes should follow the processor configuration. ", 20)
+	processor := NewDocumentProcessor(db)
+	processor.SetObjectReader(memoryObjects{"documents/a.txt": text})
+	doc := models.Document{Name: "a", Extension: ".txt", FilePath: "documents/a.txt"}
+	db.Create(&doc)
+
+	if err := processor.SetChunkingOptions(ChunkingOptions{Strategy: ChunkingFixed, ChunkSize: 100, Overlap: 100}); err == nil {
+		t.Error("Expected overlap equal to chunk size to be rejected")
+	}
+
+	counts := map[int]int{}
+	for _, size := range []int{100, 300, 2000} {
+		if err := processor.SetChunkingOptions(ChunkingOptions{Strategy: ChunkingFixed, ChunkSize: size, Overlap: size / 10}); err != nil {
+			t.Fatalf("SetChunkingOptions failed: %v", err)
+		}
+		if err := processor.ProcessDocument(doc.ID); err != nil {
+			t.Fatalf("ProcessDocument failed: %v", err)
+		}
+		chunks, _ := processor.GetDocumentChunks(doc.ID)
+		for _, c := range chunks {
+			if utf8.RuneCountInString(c.Content) > size {
+				t.Errorf("size %d: chunk of %d runes exceeds chunk size", size, utf8.RuneCountInString(c.Content))
+			}
+		}
+		counts[size] = len(chunks)
+	}
+	if !(counts[100] > counts[300] && counts[300] > counts[2000] && counts[2000] == 1) {
+		t.Errorf("Expected fewer chunks for larger sizes, got %v", counts)
+	}
+}
+
+// memoryObjects 内存中的对象存储
+type memoryObjects map[string]string
+
+func (m memoryObjects) GetObject(filePath string) (io.ReadCloser, error) {
+	content, ok := m[filePath]
+	if !ok {
+		return nil, fmt.Errorf("object %s not found", filePath)
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func TestProcessDocumentReadsThroughObjectReader(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&models.DocumentChunk{})
+
+	processor := NewDocumentProcessor(db)
+	processor.SetObjectReader(memoryObjects{"documents/notes.txt": "First paragraph.\n\nSecond paragraph."})
+
+	// 上传的文档只记录扩展名，文件位于对象存储而非本地
+	doc := models.Document{Name: "notes", Extension: ".TXT", FilePath: "documents/notes.txt"}
+	db.Create(&doc)
+
+	if err := processor.ProcessDocument(doc.ID); err != nil {
+		t.Fatalf("ProcessDocument failed: %v", err)
+	}
+	chunks, _ := processor.GetDocumentChunks(doc.ID)
+	if len(chunks) == 0 || chunks[0].DocumentID != doc.ID || !strings.Contains(chunks[0].Content, "First paragraph.") {
+		t.Fatalf("Expected chunks from stored content, got %+v", chunks)
+	}
+}
+
+func TestProcessDocumentFailures(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&models.DocumentChunk{})
+
+	processor := NewDocumentProcessor(db)
+	processor.SetObjectReader(memoryObjects{"documents/report.doc": "\xd0\xcf\x11\xe0"})
+
+	cases := []struct {
+		doc  models.Document
+		want string
+	}{
+		{models.Document{Name: "report", Extension: ".doc", FilePath: "documents/report.doc"}, `unsupported file type "doc"`},
+		{models.Document{Name: "missing", Extension: ".md", FilePath: "documents/missing.md"}, "failed to read document content"},
+	}
+	for _, tc := range cases {
+		doc := tc.doc
+		db.Create(&doc)
+
+		if err := processor.ProcessDocument(doc.ID); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected error containing %q, got %v", doc.Name, tc.want, err)
+		}
+		stored, _ := processor.GetDocument(doc.ID)
+		if stored.Status != "failed" || !strings.Contains(stored.Error, tc.want) {
+			t.Errorf("%s: expected failed status with error, got %q (%q)", doc.Name, stored.Status, stored.Error)
+		}
+	}
+}
+
+func TestProcessDocumentSavesManyChunks(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&models.DocumentChunk{})
+
+	paragraphs := make([]string, 6000)
+	for i := range paragraphs {
+		paragraphs[i] = fmt.Sprintf("Paragraph %d.", i)
+	}
+	path := filepath.Join(t.TempDir(), "large.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(paragraphs, "\n\n")), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	doc := models.Document{Name: "large", FileType: "txt", FilePath: path}
+	db.Create(&doc)
+
+	// 批量大小超过SQLite参数上限时按上限拆分，避免too many SQL variables
+	processor := NewDocumentProcessor(db)
+	processor.SetChunkSaveBatchSize(5000)
+	limit := maxInsertBatchSize(db, &models.DocumentChunk{})
+	if limit <= 0 || limit*7 > maxBindParameters["sqlite"] {
+		t.Fatalf("Expected sqlite batch size limit for 7 columns, got %d", limit)
+	}
+	batches := 0
+	processor.SetProgressFunc(func(status models.ProcessingStatus, stagePercent, chunkCount int) {
+		if status == models.StatusChunking {
+			batches++
+		}
+	})
+
+	if err := processor.ProcessDocumentWithOptions(doc.ID, ChunkingOptions{Strategy: ChunkingParagraph, ChunkSize: 20}); err != nil {
+		t.Fatalf("ProcessDocumentWithOptions failed: %v", err)
+	}
+	var count int64
+	db.Model(&models.DocumentChunk{}).Where("document_id = ?", doc.ID).Count(&count)
+	if count != 6000 {
+		t.Fatalf("Expected 6000 chunks, got %d", count)
+	}
+	if want := (6000 + limit - 1) / limit; batches < want {
+		t.Errorf("Expected at least %d insert batches, got %d", want, batches)
+	}
+}
@@ -4,15 +4,23 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"mime"
 	"mime/multipart"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/pkg/logger"
+	"ai-knowledge-app/pkg/utils"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -20,13 +28,64 @@ import (
 	"github.com/google/uuid"
 	"github.com/minio/minio-go/v7"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrFileTooLarge is returned when an upload exceeds the configured maximum file size
+var ErrFileTooLarge = errors.New("file exceeds maximum allowed size")
+
+// ErrChunkHashMismatch is returned when chunk data does not match its SHA-256
+var ErrChunkHashMismatch = errors.New("chunk hash mismatch")
+
+// ErrChunkOutOfRange is returned for chunk indexes outside an upload session's chunk count
+var ErrChunkOutOfRange = errors.New("chunk index out of range")
+
+// ErrUploadSessionExpired is returned for upload sessions past their expiry time
+var ErrUploadSessionExpired = errors.New("upload session expired")
+
+// ErrPresignNotSupported is returned for presigned URLs when files are kept on local storage
+var ErrPresignNotSupported = errors.New("presigned URLs require S3-compatible storage")
+
+// ErrObjectStorageNotConfigured is returned by object storage operations when files are kept on local storage
+var ErrObjectStorageNotConfigured = errors.New("MinIO client not configured")
+
+// ErrObjectHashMismatch is returned when a stored file no longer matches its recorded SHA-256
+var ErrObjectHashMismatch = errors.New("hash mismatch")
+
+// ErrInvalidSort is returned when a list is requested with an unknown sort field or order
+var ErrInvalidSort = errors.New("invalid sort")
+
+// DefaultPresignExpiry is how long presigned download URLs stay valid unless configured
+const DefaultPresignExpiry = 15 * time.Minute
+
 type DocumentService struct {
 	db          *gorm.DB
 	uploadDir   string
 	tempDir     string
 	minioClient *MinIOClient
+	maxFileSize int64
+	// strictDedup compares content byte for byte before an upload references an
+	// existing file instead of trusting a hash and size match
+	strictDedup bool
+	// nearDupMaxDistance is the most fingerprint bits in which a processed
+	// document may differ from an existing one to be reported as its near
+	// duplicate; 0 disables it
+	nearDupMaxDistance int
+	tasks       *TaskRepository
+	progress    *ProgressTracker
+	queue       ProcessingQueue // reported by GetQueueStats
+
+	// running holds the cancel funcs of processing tasks executing on this instance
+	runningMu sync.Mutex
+	running   map[uint]context.CancelFunc
+
+	presignExpiry time.Duration
+
+	// Settings for processors created by batch processing
+	chunking      ChunkingOptions
+	maxParseBytes int64
+	saveBatchSize int
+	metadata      ChunkMetadataSchema // also checked when a chunk is edited
 }
 
 func NewDocumentService(db *gorm.DB) *DocumentService {
@@ -38,6 +97,14 @@ func NewDocumentService(db *gorm.DB) *DocumentService {
 		db:        db,
 		uploadDir: uploadDir,
 		tempDir:   tempDir,
+		tasks:     NewTaskRepository(db),
+		progress:  NewProgressTracker(),
+		running:   make(map[uint]context.CancelFunc),
+
+		presignExpiry: DefaultPresignExpiry,
+		chunking:      DefaultChunkingOptions(),
+		maxParseBytes: DefaultMaxParseBytes,
+		saveBatchSize: DefaultChunkSaveBatchSize,
 	}
 }
 
@@ -46,6 +113,55 @@ func (s *DocumentService) SetMinIOClient(client *MinIOClient) {
 	s.minioClient = client
 }
 
+// SetPresignExpiry sets how long presigned download URLs stay valid
+func (s *DocumentService) SetPresignExpiry(expiry time.Duration) {
+	s.presignExpiry = expiry
+}
+
+// SetMaxFileSize sets the maximum accepted upload size in bytes (0 disables the limit)
+func (s *DocumentService) SetMaxFileSize(size int64) {
+	s.maxFileSize = size
+}
+
+// SetStrictDeduplication enables byte-for-byte comparison before instant
+// upload. Multipart uploads are compared with the matching stored file; InitUpload
+// only has the client's hash to go on, so it always asks for the chunks.
+func (s *DocumentService) SetStrictDeduplication(strict bool) {
+	s.strictDedup = strict
+}
+
+// SetProcessingOptions sets the chunking options and parse size limit (0 disables
+// the limit) used when processing documents
+func (s *DocumentService) SetProcessingOptions(chunking ChunkingOptions, maxParseBytes int64) error {
+	chunking = chunking.withDefaults()
+	if err := chunking.Validate(); err != nil {
+		return err
+	}
+	s.chunking = chunking
+	s.maxParseBytes = maxParseBytes
+	return nil
+}
+
+// SetChunkSaveBatchSize sets how many chunks processing inserts per statement;
+// it is capped to the database driver's bind parameter limit
+func (s *DocumentService) SetChunkSaveBatchSize(size int) {
+	s.saveBatchSize = size
+}
+
+// SetChunkMetadataSchema sets the schema chunk metadata must conform to when
+// documents are processed and when chunks are edited
+func (s *DocumentService) SetChunkMetadataSchema(schema ChunkMetadataSchema) {
+	s.metadata = schema
+}
+
+// checkFileSize rejects files larger than the configured maximum
+func (s *DocumentService) checkFileSize(size int64) error {
+	if s.maxFileSize > 0 && size > s.maxFileSize {
+		return fmt.Errorf("%w: %d bytes (max %d)", ErrFileTooLarge, size, s.maxFileSize)
+	}
+	return nil
+}
+
 // IsMinIOAvailable checks if MinIO service is available
 func (s *DocumentService) IsMinIOAvailable() bool {
 	if s.minioClient == nil {
@@ -57,7 +173,7 @@ func (s *DocumentService) IsMinIOAvailable() bool {
 // CheckMinIOHealth performs a health check on MinIO service
 func (s *DocumentService) CheckMinIOHealth() error {
 	if s.minioClient == nil {
-		return fmt.Errorf("MinIO client not configured")
+		return ErrObjectStorageNotConfigured
 	}
 	return s.minioClient.IsHealthy()
 }
@@ -72,11 +188,70 @@ func (s *DocumentService) CheckFile(hash string, size int64) (*models.Document,
 	return nil, false
 }
 
+// FileFingerprint identifies file content by SHA-256 hash and size
+type FileFingerprint struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// FileCheckResult reports whether a fingerprint matches an existing document
+type FileCheckResult struct {
+	FileFingerprint
+	Exists     bool  `json:"exists"`
+	DocumentID *uint `json:"document_id,omitempty"`
+}
+
+// CheckFiles is the batch form of CheckFile. All fingerprints are matched in a
+// single query; results follow the request order and, like CheckFile, point at
+// the oldest completed document with that content.
+func (s *DocumentService) CheckFiles(files []FileFingerprint) ([]FileCheckResult, error) {
+	results := make([]FileCheckResult, len(files))
+	if len(files) == 0 {
+		return results, nil
+	}
+
+	seen := make(map[FileFingerprint]bool, len(files))
+	tuples := make([][]interface{}, 0, len(files))
+	for _, file := range files {
+		if !seen[file] {
+			seen[file] = true
+			tuples = append(tuples, []interface{}{file.Hash, file.Size})
+		}
+	}
+
+	var docs []models.Document
+	if err := s.db.Select("id, file_hash, file_size").
+		Where("(file_hash, file_size) IN ? AND status = ?", tuples, "completed").
+		Order("id").Find(&docs).Error; err != nil {
+		return nil, fmt.Errorf("failed to check files: %w", err)
+	}
+
+	existing := make(map[FileFingerprint]uint, len(docs))
+	for _, doc := range docs {
+		key := FileFingerprint{Hash: doc.FileHash, Size: doc.FileSize}
+		if _, ok := existing[key]; !ok {
+			existing[key] = doc.ID
+		}
+	}
+
+	for i, file := range files {
+		results[i].FileFingerprint = file
+		if id, ok := existing[file]; ok {
+			results[i].Exists = true
+			results[i].DocumentID = &id
+		}
+	}
+	return results, nil
+}
+
 // VerifyObjectIntegrity verifies that an object exists in storage and matches the expected hash
 func (s *DocumentService) VerifyObjectIntegrity(filePath, expectedHash string) error {
+	return s.verifyObjectIntegrity(context.Background(), filePath, expectedHash)
+}
+
+func (s *DocumentService) verifyObjectIntegrity(ctx context.Context, filePath, expectedHash string) error {
 	if s.minioClient != nil {
 		// For MinIO, check if object exists and get its metadata
-		ctx := context.Background()
 		_, err := s.minioClient.StatObjectWithRetry(ctx, filePath, minio.StatObjectOptions{})
 		if err != nil {
 			return fmt.Errorf("object does not exist in MinIO: %w", err)
@@ -97,7 +272,7 @@ func (s *DocumentService) VerifyObjectIntegrity(filePath, expectedHash string) e
 		
 		calculatedHash := fmt.Sprintf("%x", hash.Sum(nil))
 		if calculatedHash != expectedHash {
-			return fmt.Errorf("object hash mismatch: expected %s, got %s", expectedHash, calculatedHash)
+			return fmt.Errorf("object %w: expected %s, got %s", ErrObjectHashMismatch, expectedHash, calculatedHash)
 		}
 
 		return nil
@@ -116,7 +291,7 @@ func (s *DocumentService) VerifyObjectIntegrity(filePath, expectedHash string) e
 
 		calculatedHash := fmt.Sprintf("%x", hash.Sum(nil))
 		if calculatedHash != expectedHash {
-			return fmt.Errorf("file hash mismatch: expected %s, got %s", expectedHash, calculatedHash)
+			return fmt.Errorf("file %w: expected %s, got %s", ErrObjectHashMismatch, expectedHash, calculatedHash)
 		}
 
 		return nil
@@ -158,16 +333,38 @@ func (s *DocumentService) CreateDuplicateReference(originalDoc *models.Document,
 	return newDoc, nil
 }
 
-// InitUpload 初始化上传会话
-func (s *DocumentService) InitUpload(fileName string, fileSize int64, fileHash string) (*models.UploadSession, error) {
-	// 检查是否可以秒传
-	if doc, exists := s.CheckFile(fileHash, fileSize); exists {
-		// Create a duplicate reference instead of returning an error
+// InitUploadStatus tells the client whether it still has to upload the file's chunks
+type InitUploadStatus string
+
+const (
+	// InitUploadRequired means a session was created and chunks must be uploaded
+	InitUploadRequired InitUploadStatus = "upload_required"
+	// InitUploadDuplicate means identical content already exists and a document
+	// referencing it was created; no chunks need to be uploaded
+	InitUploadDuplicate InitUploadStatus = "duplicate"
+)
+
+// InitUploadResult is the outcome of InitUpload. Session is set for
+// InitUploadRequired, Document for InitUploadDuplicate.
+type InitUploadResult struct {
+	Status   InitUploadStatus      `json:"status"`
+	Session  *models.UploadSession `json:"session,omitempty"`
+	Document *models.Document      `json:"document,omitempty"`
+}
+
+// InitUpload 初始化上传会话，内容已存在时直接创建重复引用（秒传）
+func (s *DocumentService) InitUpload(fileName string, fileSize int64, fileHash string) (*InitUploadResult, error) {
+	if err := s.checkFileSize(fileSize); err != nil {
+		return nil, err
+	}
+
+	// 检查是否可以秒传，严格模式下无法比较内容，需要上传分片
+	if doc, exists := s.CheckFile(fileHash, fileSize); exists && !s.strictDedup {
 		duplicateDoc, err := s.CreateDuplicateReference(doc, fileName, fileName)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create duplicate reference: %w", err)
 		}
-		return nil, fmt.Errorf("file already exists, created duplicate reference: %d", duplicateDoc.ID)
+		return &InitUploadResult{Status: InitUploadDuplicate, Document: duplicateDoc}, nil
 	}
 
 	chunkSize := int64(1048576) // 1MB
@@ -211,11 +408,21 @@ func (s *DocumentService) InitUpload(fileName string, fileSize int64, fileHash s
 		ExpiresAt:   time.Now().Add(24 * time.Hour),
 	}
 
-	return session, s.db.Create(session).Error
+	if err := s.db.Create(session).Error; err != nil {
+		return nil, err
+	}
+	return &InitUploadResult{Status: InitUploadRequired, Session: session}, nil
 }
 
 // UploadChunk 上传分片
 func (s *DocumentService) UploadChunk(sessionID string, chunkIndex int, data []byte) error {
+	return s.UploadChunkWithHash(sessionID, chunkIndex, data, "")
+}
+
+// UploadChunkWithHash stores a chunk after checking it against the SHA-256 hex
+// digest sent by the client; an empty expectedHash skips the check. The digest
+// of every stored chunk is recorded for verification in CompleteUpload.
+func (s *DocumentService) UploadChunkWithHash(sessionID string, chunkIndex int, data []byte, expectedHash string) error {
 	var session models.UploadSession
 	if err := s.db.First(&session, "id = ?", sessionID).Error; err != nil {
 		return err
@@ -232,8 +439,24 @@ func (s *DocumentService) UploadChunk(sessionID string, chunkIndex int, data []b
 			}
 			s.minioClient.AbortMultipartUploadWithRetry(ctx, input)
 		}
-		s.db.Delete(&session)
-		return fmt.Errorf("upload session expired")
+		s.deleteUploadSession(&session)
+		return ErrUploadSessionExpired
+	}
+
+	// The declared file size bounds every chunk, so a client cannot store more
+	// than it declared (and than the size limit allows) through extra or
+	// oversized chunks
+	if chunkIndex < 0 || chunkIndex >= session.TotalChunks {
+		return fmt.Errorf("%w: chunk %d of %d", ErrChunkOutOfRange, chunkIndex, session.TotalChunks)
+	}
+	if limit := min(session.ChunkSize, session.FileSize-int64(chunkIndex)*session.ChunkSize); int64(len(data)) > limit {
+		return fmt.Errorf("%w: chunk %d is %d bytes (max %d)", ErrFileTooLarge, chunkIndex, len(data), limit)
+	}
+
+	sum := sha256.Sum256(data)
+	chunkHash := hex.EncodeToString(sum[:])
+	if expectedHash != "" && !strings.EqualFold(expectedHash, chunkHash) {
+		return fmt.Errorf("%w: chunk %d", ErrChunkHashMismatch, chunkIndex)
 	}
 
 	if s.minioClient != nil {
@@ -263,10 +486,82 @@ func (s *DocumentService) UploadChunk(sessionID string, chunkIndex int, data []b
 			return err
 		}
 	}
+
+	// A resent chunk replaces the hash recorded for the previous attempt
+	record := models.UploadChunkHash{SessionID: session.ID, ChunkIndex: chunkIndex, Hash: chunkHash, Size: int64(len(data))}
+	if err := s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&record).Error; err != nil {
+		return fmt.Errorf("failed to record chunk hash: %w", err)
+	}
 	
 	return nil
 }
 
+// deleteUploadSession removes an upload session together with its chunk hashes
+func (s *DocumentService) deleteUploadSession(session *models.UploadSession) error {
+	if err := s.db.Where("session_id = ?", session.ID).Delete(&models.UploadChunkHash{}).Error; err != nil {
+		return err
+	}
+	return s.db.Delete(session).Error
+}
+
+// verifyAssembledFile hashes an assembled upload, checking each chunk-sized
+// slice against the digests recorded by UploadChunkWithHash. It returns the
+// SHA-256 and size of the whole file.
+func verifyAssembledFile(r io.Reader, chunkSize int64, chunkHashes map[int]string) (string, int64, error) {
+	fileHash := sha256.New()
+	var size int64
+	for index := 0; ; index++ {
+		chunkHash := sha256.New()
+		n, err := io.Copy(io.MultiWriter(fileHash, chunkHash), io.LimitReader(r, chunkSize))
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to read assembled file: %w", err)
+		}
+		size += n
+		if n == 0 {
+			break
+		}
+		if expected, ok := chunkHashes[index]; ok && expected != hex.EncodeToString(chunkHash.Sum(nil)) {
+			return "", 0, fmt.Errorf("%w: chunk %d of assembled file", ErrChunkHashMismatch, index)
+		}
+		if n < chunkSize {
+			break
+		}
+	}
+	return hex.EncodeToString(fileHash.Sum(nil)), size, nil
+}
+
+// checkAssembledFile verifies an assembled upload against its session: the
+// actual size must match the declared one and stay within the size limit, and
+// the hash must match the declared file hash
+func (s *DocumentService) checkAssembledFile(session *models.UploadSession, hash string, size int64) error {
+	if err := s.checkFileSize(size); err != nil {
+		return err
+	}
+	if size > session.FileSize {
+		return fmt.Errorf("%w: assembled file is %d bytes, declared %d", ErrFileTooLarge, size, session.FileSize)
+	}
+	if size != session.FileSize {
+		return fmt.Errorf("file size mismatch: assembled file is %d bytes, declared %d", size, session.FileSize)
+	}
+	if hash != session.FileHash {
+		return fmt.Errorf("file hash mismatch")
+	}
+	return nil
+}
+
+// chunkHashes loads the recorded chunk digests of an upload session by index
+func (s *DocumentService) chunkHashes(sessionID string) (map[int]string, error) {
+	var records []models.UploadChunkHash
+	if err := s.db.Where("session_id = ?", sessionID).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to load chunk hashes: %w", err)
+	}
+	hashes := make(map[int]string, len(records))
+	for _, record := range records {
+		hashes[record.ChunkIndex] = record.Hash
+	}
+	return hashes, nil
+}
+
 // CompleteUpload 完成上传
 func (s *DocumentService) CompleteUpload(sessionID string) (*models.Document, error) {
 	var session models.UploadSession
@@ -274,6 +569,11 @@ func (s *DocumentService) CompleteUpload(sessionID string) (*models.Document, er
 		return nil, err
 	}
 
+	chunkHashes, err := s.chunkHashes(session.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	ext := filepath.Ext(session.FileName)
 	var finalPath string
 	var calculatedHash string
@@ -302,9 +602,13 @@ func (s *DocumentService) CompleteUpload(sessionID string) (*models.Document, er
 			return nil, fmt.Errorf("failed to list parts for S3 multipart upload: %w", err)
 		}
 		
-		// Build the list of completed parts with ETags
+		// Build the list of completed parts with ETags; only the session's own
+		// part numbers are assembled
 		var completedParts []types.CompletedPart
 		for _, part := range listResult.Parts {
+			if part.PartNumber == nil || *part.PartNumber < 1 || int(*part.PartNumber) > session.TotalChunks {
+				continue
+			}
 			completedParts = append(completedParts, types.CompletedPart{
 				PartNumber: part.PartNumber,
 				ETag:       part.ETag,
@@ -333,8 +637,22 @@ func (s *DocumentService) CompleteUpload(sessionID string) (*models.Document, er
 			return nil, fmt.Errorf("failed to complete S3 multipart upload: %w", err)
 		}
 		
-		// For MinIO, we trust the hash provided during initialization
-		calculatedHash = session.FileHash
+		// Read the assembled object back to re-verify the recorded chunk hashes
+		// and the file hash provided during initialization
+		reader, err := s.GetObject(finalPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read assembled object: %w", err)
+		}
+		var size int64
+		calculatedHash, size, err = verifyAssembledFile(reader, session.ChunkSize, chunkHashes)
+		reader.Close()
+		if err == nil {
+			err = s.checkAssembledFile(&session, calculatedHash, size)
+		}
+		if err != nil {
+			s.minioClient.RemoveObjectWithRetry(ctx, finalPath, minio.RemoveObjectOptions{})
+			return nil, err
+		}
 	} else {
 		// Local storage: merge chunks and verify hash
 		filename := fmt.Sprintf("%d_%s", time.Now().Unix(), session.FileName)
@@ -356,15 +674,16 @@ func (s *DocumentService) CompleteUpload(sessionID string) (*models.Document, er
 			finalFile.Write(chunkData)
 		}
 
-		// 验证文件哈希
+		// 验证分片哈希和文件哈希
 		finalFile.Seek(0, 0)
-		hash := sha256.New()
-		io.Copy(hash, finalFile)
-		calculatedHash = fmt.Sprintf("%x", hash.Sum(nil))
-
-		if calculatedHash != session.FileHash {
+		var size int64
+		calculatedHash, size, err = verifyAssembledFile(finalFile, session.ChunkSize, chunkHashes)
+		if err == nil {
+			err = s.checkAssembledFile(&session, calculatedHash, size)
+		}
+		if err != nil {
 			os.Remove(finalPath)
-			return nil, fmt.Errorf("file hash mismatch")
+			return nil, err
 		}
 	}
 
@@ -394,19 +713,32 @@ func (s *DocumentService) CompleteUpload(sessionID string) (*models.Document, er
 	if s.minioClient == nil {
 		os.RemoveAll(session.TempDir)
 	}
-	s.db.Delete(&session)
+	s.deleteUploadSession(&session)
 
 	return doc, nil
 }
 
+// UploadProgress is an upload session with progress figures derived from the
+// chunks received so far. The session fields are kept at the top level so
+// existing clients reading uploaded_size keep working.
+type UploadProgress struct {
+	models.UploadSession
+	UploadedChunks int     `json:"uploaded_chunks"`
+	Percentage     float64 `json:"percentage"`
+	// EstimatedSecondsRemaining extrapolates the average rate since the session
+	// was created; nil until any bytes have been received
+	EstimatedSecondsRemaining *float64 `json:"estimated_seconds_remaining"`
+}
+
 // GetUploadProgress 获取上传进度
-func (s *DocumentService) GetUploadProgress(sessionID string) (*models.UploadSession, error) {
+func (s *DocumentService) GetUploadProgress(sessionID string) (*UploadProgress, error) {
 	var session models.UploadSession
 	if err := s.db.First(&session, "id = ?", sessionID).Error; err != nil {
 		return nil, err
 	}
 
 	uploadedSize := int64(0)
+	uploadedChunks := 0
 	
 	if s.minioClient != nil {
 		// For MinIO multipart upload, list uploaded parts using S3 API
@@ -431,6 +763,7 @@ func (s *DocumentService) GetUploadProgress(sessionID string) (*models.UploadSes
 						uploadedSize += *part.Size
 					}
 				}
+				uploadedChunks = len(result.Parts)
 			}
 		}
 	} else {
@@ -439,6 +772,7 @@ func (s *DocumentService) GetUploadProgress(sessionID string) (*models.UploadSes
 			chunkPath := filepath.Join(session.TempDir, fmt.Sprintf("chunk_%d", i))
 			if info, err := os.Stat(chunkPath); err == nil {
 				uploadedSize += info.Size()
+				uploadedChunks++
 			}
 		}
 	}
@@ -446,7 +780,86 @@ func (s *DocumentService) GetUploadProgress(sessionID string) (*models.UploadSes
 	session.UploadedSize = uploadedSize
 	s.db.Save(&session)
 
-	return &session, nil
+	return newUploadProgress(session, uploadedChunks, time.Now()), nil
+}
+
+// newUploadProgress derives percentage and remaining time from the bytes received so far
+func newUploadProgress(session models.UploadSession, uploadedChunks int, now time.Time) *UploadProgress {
+	progress := &UploadProgress{UploadSession: session, UploadedChunks: uploadedChunks}
+	if session.FileSize > 0 {
+		progress.Percentage = math.Min(100, math.Round(float64(session.UploadedSize)/float64(session.FileSize)*10000)/100)
+	}
+
+	elapsed := now.Sub(session.CreatedAt).Seconds()
+	if session.UploadedSize > 0 && elapsed > 0 {
+		rate := float64(session.UploadedSize) / elapsed
+		remaining := math.Ceil(math.Max(0, float64(session.FileSize-session.UploadedSize)) / rate)
+		progress.EstimatedSecondsRemaining = &remaining
+	}
+	return progress
+}
+
+// MissingChunks lists the chunk indices of an upload session that have not
+// been received yet, so an interrupted client can resend only the gaps
+type MissingChunks struct {
+	SessionID     string `json:"session_id"`
+	TotalChunks   int    `json:"total_chunks"`
+	MissingChunks []int  `json:"missing_chunks"`
+}
+
+// GetMissingChunks reports which chunks of an upload session are still missing.
+// Expired sessions return ErrUploadSessionExpired instead of an empty list.
+func (s *DocumentService) GetMissingChunks(sessionID string) (*MissingChunks, error) {
+	var session models.UploadSession
+	if err := s.db.First(&session, "id = ?", sessionID).Error; err != nil {
+		return nil, err
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrUploadSessionExpired
+	}
+
+	received := make(map[int]bool)
+	if s.minioClient != nil {
+		if session.UploadID != "" {
+			ctx := context.Background()
+			input := &s3.ListPartsInput{
+				Bucket:   aws.String(s.minioClient.GetBucketName()),
+				Key:      aws.String(session.TempDir),
+				UploadId: aws.String(session.UploadID),
+			}
+			// Follow pagination so uploads with more parts than one listing returns are covered
+			for {
+				result, err := s.minioClient.ListPartsWithRetry(ctx, input)
+				if err != nil {
+					return nil, fmt.Errorf("failed to list uploaded parts: %w", err)
+				}
+				for _, part := range result.Parts {
+					if part.PartNumber != nil {
+						// Part numbers in S3 start from 1
+						received[int(*part.PartNumber)-1] = true
+					}
+				}
+				if result.IsTruncated == nil || !*result.IsTruncated {
+					break
+				}
+				input.PartNumberMarker = result.NextPartNumberMarker
+			}
+		}
+	} else {
+		for i := 0; i < session.TotalChunks; i++ {
+			if _, err := os.Stat(filepath.Join(session.TempDir, fmt.Sprintf("chunk_%d", i))); err == nil {
+				received[i] = true
+			}
+		}
+	}
+
+	missing := []int{}
+	for i := 0; i < session.TotalChunks; i++ {
+		if !received[i] {
+			missing = append(missing, i)
+		}
+	}
+	return &MissingChunks{SessionID: session.ID, TotalChunks: session.TotalChunks, MissingChunks: missing}, nil
 }
 
 // AbortUpload 中止上传会话并清理资源
@@ -479,18 +892,23 @@ func (s *DocumentService) AbortUpload(sessionID string) error {
 		}
 	}
 
-	// Remove session from database
-	return s.db.Delete(&session).Error
+	// Remove session and its chunk hashes from database
+	return s.deleteUploadSession(&session)
 }
 
-// CleanupExpiredSessions 清理过期的上传会话
-func (s *DocumentService) CleanupExpiredSessions() error {
+// CleanupExpiredSessions 清理过期的上传会话，返回清理的会话数
+func (s *DocumentService) CleanupExpiredSessions() (int, error) {
 	var expiredSessions []models.UploadSession
 	if err := s.db.Where("expires_at < ?", time.Now()).Find(&expiredSessions).Error; err != nil {
-		return err
+		return 0, err
+	}
+	if len(expiredSessions) == 0 {
+		return 0, nil
 	}
 
+	sessionIDs := make([]string, 0, len(expiredSessions))
 	for _, session := range expiredSessions {
+		sessionIDs = append(sessionIDs, session.ID)
 		if s.minioClient != nil {
 			// Abort S3 multipart upload
 			if session.UploadID != "" {
@@ -515,12 +933,23 @@ func (s *DocumentService) CleanupExpiredSessions() error {
 		}
 	}
 
-	// Remove expired sessions from database
-	return s.db.Where("expires_at < ?", time.Now()).Delete(&models.UploadSession{}).Error
+	// Remove the cleaned-up sessions and their chunk hashes from database;
+	// deleting by ID leaves sessions that expired meanwhile for the next run
+	if err := s.db.Where("session_id IN ?", sessionIDs).Delete(&models.UploadChunkHash{}).Error; err != nil {
+		return 0, err
+	}
+	if err := s.db.Where("id IN ?", sessionIDs).Delete(&models.UploadSession{}).Error; err != nil {
+		return 0, err
+	}
+	return len(sessionIDs), nil
 }
 
 // Upload 传统上传方法（保持兼容性）
 func (s *DocumentService) Upload(file *multipart.FileHeader) (*models.Document, error) {
+	if err := s.checkFileSize(file.Size); err != nil {
+		return nil, err
+	}
+
 	src, err := file.Open()
 	if err != nil {
 		return nil, err
@@ -535,8 +964,19 @@ func (s *DocumentService) Upload(file *multipart.FileHeader) (*models.Document,
 
 	// 检查是否可以秒传
 	if doc, exists := s.CheckFile(fileHash, file.Size); exists {
-		// Create a duplicate reference instead of returning the original
-		return s.CreateDuplicateReference(doc, file.Filename, file.Filename)
+		same := true
+		if s.strictDedup {
+			src.Seek(0, 0)
+			if same, err = s.sameContent(src, doc.FilePath); err != nil {
+				return nil, fmt.Errorf("failed to compare with existing file: %w", err)
+			}
+		}
+		if same {
+			// Create a duplicate reference instead of returning the original
+			return s.CreateDuplicateReference(doc, file.Filename, file.Filename)
+		}
+		logger.GetLogger().WithField("document_id", doc.ID).
+			Warn("Upload matches an existing file's hash and size but not its content, storing it separately")
 	}
 
 	src.Seek(0, 0)
@@ -599,10 +1039,86 @@ func (s *DocumentService) Upload(file *multipart.FileHeader) (*models.Document,
 	return doc, nil
 }
 
-func (s *DocumentService) List() ([]models.Document, error) {
+// DocumentFilter narrows the document list; zero values are ignored
+type DocumentFilter struct {
+	Status    string
+	Extension string // with or without the leading dot, case-insensitive
+	MinSize   int64
+	MaxSize   int64
+	Search    string // matched against the original and stored file names
+}
+
+// documentSortFields maps the sort values accepted by ListPaginated to columns
+var documentSortFields = map[string]string{
+	"created_at":    "created_at",
+	"updated_at":    "updated_at",
+	"original_name": "original_name",
+	"file_size":     "file_size",
+}
+
+// ListPaginated returns one page of documents matching the filter. Documents are
+// ordered by created_at desc unless pagination.Sort and pagination.Order say
+// otherwise; an unknown sort field returns ErrInvalidSort.
+func (s *DocumentService) ListPaginated(pagination utils.PaginationRequest, filter DocumentFilter) (*utils.PaginationResponse, error) {
+	sort := pagination.Sort
+	if sort == "" {
+		sort = "created_at"
+	}
+	column, ok := documentSortFields[sort]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSort, sort)
+	}
+	order := strings.ToUpper(pagination.Order)
+	if order == "" {
+		order = "DESC"
+	}
+	if order != "ASC" && order != "DESC" {
+		return nil, fmt.Errorf("%w: order %s", ErrInvalidSort, pagination.Order)
+	}
+
+	query := s.db.Model(&models.Document{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Extension != "" {
+		ext := strings.ToLower(filter.Extension)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		query = query.Where("LOWER(extension) = ?", ext)
+	}
+	if filter.MinSize > 0 {
+		query = query.Where("file_size >= ?", filter.MinSize)
+	}
+	if filter.MaxSize > 0 {
+		query = query.Where("file_size <= ?", filter.MaxSize)
+	}
+	if filter.Search != "" {
+		term := "%" + strings.ToLower(filter.Search) + "%"
+		query = query.Where("LOWER(original_name) LIKE ? OR LOWER(file_name) LIKE ?", term, term)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count documents: %w", err)
+	}
+
 	var docs []models.Document
-	err := s.db.Find(&docs).Error
-	return docs, err
+	err := query.Order(fmt.Sprintf("%s %s, id %s", column, order, order)).
+		Offset(utils.GetOffset(pagination.Page, pagination.PageSize)).
+		Limit(pagination.PageSize).
+		Find(&docs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+
+	return &utils.PaginationResponse{
+		Items:      docs,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: utils.CalculateTotalPages(total, pagination.PageSize),
+	}, nil
 }
 
 func (s *DocumentService) GetByID(id uint) (*models.Document, error) {
@@ -611,6 +1127,34 @@ func (s *DocumentService) GetByID(id uint) (*models.Document, error) {
 	return &doc, err
 }
 
+// PresignedURL is a time-limited link for downloading a document directly from storage
+type PresignedURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PresignDownload returns a presigned URL that downloads the document straight
+// from S3-compatible storage under its original file name. Local storage has no
+// such URLs and returns ErrPresignNotSupported.
+func (s *DocumentService) PresignDownload(doc *models.Document) (*PresignedURL, error) {
+	if s.minioClient == nil {
+		return nil, ErrPresignNotSupported
+	}
+
+	params := url.Values{}
+	params.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": doc.OriginalName}))
+	if doc.MimeType != "" {
+		params.Set("response-content-type", doc.MimeType)
+	}
+
+	expiresAt := time.Now().Add(s.presignExpiry)
+	presigned, err := s.minioClient.PresignedGetObjectWithRetry(context.Background(), doc.FilePath, s.presignExpiry, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign download: %w", err)
+	}
+	return &PresignedURL{URL: presigned.String(), ExpiresAt: expiresAt}, nil
+}
+
 // GetObject retrieves a file from storage (MinIO or local)
 func (s *DocumentService) GetObject(filePath string) (io.ReadCloser, error) {
 	if s.minioClient != nil {
@@ -631,9 +1175,57 @@ func (s *DocumentService) GetObject(filePath string) (io.ReadCloser, error) {
 	}
 }
 
+// sameContent reports whether r yields exactly the bytes of the stored file
+func (s *DocumentService) sameContent(r io.Reader, filePath string) (bool, error) {
+	stored, err := s.GetObject(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer stored.Close()
+
+	const bufSize = 32 * 1024
+	a, b := make([]byte, bufSize), make([]byte, bufSize)
+	for {
+		n, errA := io.ReadFull(r, a)
+		m, errB := io.ReadFull(stored, b)
+		if !bytes.Equal(a[:n], b[:m]) {
+			return false, nil
+		}
+		doneA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		doneB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		if errA != nil && !doneA {
+			return false, errA
+		}
+		if errB != nil && !doneB {
+			return false, errB
+		}
+		if doneA || doneB {
+			return doneA && doneB, nil
+		}
+	}
+}
+
+// Delete soft-deletes a document. The physical file is removed once no live
+// document references it anymore.
 func (s *DocumentService) Delete(id uint) error {
+	return s.deleteDocument(id, false)
+}
+
+// Purge permanently removes a document record, including one that was
+// previously soft-deleted. The physical file is removed under the same
+// reference rules as Delete.
+func (s *DocumentService) Purge(id uint) error {
+	return s.deleteDocument(id, true)
+}
+
+func (s *DocumentService) deleteDocument(id uint, permanent bool) error {
+	query := s.db
+	if permanent {
+		query = query.Unscoped()
+	}
+
 	var doc models.Document
-	if err := s.db.First(&doc, id).Error; err != nil {
+	if err := query.First(&doc, id).Error; err != nil {
 		return err
 	}
 
@@ -646,15 +1238,29 @@ func (s *DocumentService) Delete(id uint) error {
 	}()
 
 	// Delete the document record
-	if err := tx.Delete(&doc).Error; err != nil {
+	deleteTx := tx
+	if permanent {
+		deleteTx = tx.Unscoped()
+	}
+	if err := deleteTx.Delete(&doc).Error; err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	// Check if there are other documents referencing the same file
+	// Detach the document from knowledge entries; the knowledge itself is kept
+	if err := tx.Where("document_id = ?", doc.ID).Delete(&models.KnowledgeAttachment{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to remove knowledge attachments: %w", err)
+	}
+
+	// Check if there are other live documents referencing the same file.
+	// The deleted_at condition is explicit (and the query unscoped) so the
+	// count stays correct regardless of which delete mode removed the rows.
 	var remainingRefs int64
-	if err := tx.Model(&models.Document{}).Where("file_hash = ? AND file_size = ? AND status = ?", 
-		doc.FileHash, doc.FileSize, "completed").Count(&remainingRefs).Error; err != nil {
+	if err := tx.Unscoped().Model(&models.Document{}).
+		Where("file_hash = ? AND file_size = ? AND deleted_at IS NULL AND id <> ?",
+			doc.FileHash, doc.FileSize, doc.ID).
+		Count(&remainingRefs).Error; err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed to count remaining references: %w", err)
 	}
@@ -685,47 +1291,60 @@ func (s *DocumentService) UpdateDescription(id uint, description string) error {
 	return s.db.Model(&models.Document{}).Where("id = ?", id).Update("description", description).Error
 }
 
-// CleanupOrphanedObjects removes objects from storage that have no database references
-func (s *DocumentService) CleanupOrphanedObjects() error {
+// OrphanCleanupResult reports the objects found without a referencing document
+type OrphanCleanupResult struct {
+	DryRun   bool     `json:"dry_run"`
+	Scanned  int      `json:"scanned"`  // objects listed under documents/
+	Orphaned []string `json:"orphaned"` // keys with no referencing document
+	Removed  int      `json:"removed"`  // always 0 for a dry run
+}
+
+// CleanupOrphanedObjects removes objects from storage that have no database references.
+// With dryRun the orphans are only reported. Local storage is not supported and
+// returns ErrObjectStorageNotConfigured.
+func (s *DocumentService) CleanupOrphanedObjects(ctx context.Context, dryRun bool) (*OrphanCleanupResult, error) {
 	if s.minioClient == nil {
-		// For local storage, this is more complex and not implemented in this basic version
-		return nil
+		return nil, ErrObjectStorageNotConfigured
 	}
 
-	ctx := context.Background()
-	
+	result := &OrphanCleanupResult{DryRun: dryRun, Orphaned: []string{}}
+
 	// List all objects in the bucket
 	objectCh := s.minioClient.ListObjectsWithRetry(ctx, minio.ListObjectsOptions{
 		Prefix:    "documents/",
 		Recursive: true,
 	})
 
-	var orphanedObjects []string
-	
 	for object := range objectCh {
 		if object.Err != nil {
-			return fmt.Errorf("error listing objects: %w", object.Err)
+			return nil, fmt.Errorf("error listing objects: %w", object.Err)
 		}
+		result.Scanned++
 
 		// Check if any document references this object
 		var count int64
-		if err := s.db.Model(&models.Document{}).Where("file_path = ? AND status = ?", object.Key, "completed").Count(&count).Error; err != nil {
-			return fmt.Errorf("error checking object references: %w", err)
+		if err := s.db.Unscoped().Model(&models.Document{}).Where("file_path = ? AND deleted_at IS NULL", object.Key).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("error checking object references: %w", err)
 		}
 
 		if count == 0 {
-			orphanedObjects = append(orphanedObjects, object.Key)
+			result.Orphaned = append(result.Orphaned, object.Key)
 		}
 	}
 
+	if dryRun {
+		return result, nil
+	}
+
 	// Remove orphaned objects
-	for _, objectKey := range orphanedObjects {
+	for _, objectKey := range result.Orphaned {
 		if err := s.minioClient.RemoveObjectWithRetry(ctx, objectKey, minio.RemoveObjectOptions{}); err != nil {
-			return fmt.Errorf("failed to remove orphaned object %s: %w", objectKey, err)
+			return result, fmt.Errorf("failed to remove orphaned object %s: %w", objectKey, err)
 		}
+		result.Removed++
 	}
 
-	return nil
+	return result, nil
 }
 
 // GetDeduplicationStats returns statistics about file deduplication
@@ -750,20 +1369,20 @@ func (s *DocumentService) GetDeduplicationStats() (map[string]interface{}, error
 
 	// Calculate total size
 	if err := s.db.Model(&models.Document{}).
-		Select("SUM(file_size)").
+		Select("COALESCE(SUM(file_size), 0)").
 		Where("status = ?", "completed").
 		Scan(&totalSize).Error; err != nil {
 		return nil, fmt.Errorf("failed to calculate total size: %w", err)
 	}
 
-	// Calculate unique size (sum of distinct file sizes by hash)
-	if err := s.db.Raw(`
-		SELECT SUM(file_size) FROM (
-			SELECT DISTINCT file_hash, file_size 
-			FROM documents 
-			WHERE status = ?
-		) AS unique_files
-	`, "completed").Scan(&uniqueSize).Error; err != nil {
+	// Calculate unique size (sum of distinct file sizes by hash); built on the
+	// model so soft-deleted documents are excluded like in the counts above
+	uniqueFilesQuery := s.db.Model(&models.Document{}).
+		Distinct("file_hash", "file_size").
+		Where("status = ?", "completed")
+	if err := s.db.Table("(?) AS unique_files", uniqueFilesQuery).
+		Select("COALESCE(SUM(file_size), 0)").
+		Scan(&uniqueSize).Error; err != nil {
 		return nil, fmt.Errorf("failed to calculate unique size: %w", err)
 	}
 
@@ -782,3 +1401,176 @@ func (s *DocumentService) GetDeduplicationStats() (map[string]interface{}, error
 		"deduplication_ratio":  deduplicationRatio,
 	}, nil
 }
+
+// RecordStorageSnapshot samples the current deduplication stats into the timeseries table
+// and prunes samples older than the retention window (0 keeps everything)
+func (s *DocumentService) RecordStorageSnapshot(retention time.Duration) (*models.StorageStatsSnapshot, error) {
+	stats, err := s.GetDeduplicationStats()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &models.StorageStatsSnapshot{
+		TotalDocuments: stats["total_documents"].(int64),
+		UniqueFiles:    stats["unique_files"].(int64),
+		TotalSize:      stats["total_size_bytes"].(int64),
+		UniqueSize:     stats["unique_size_bytes"].(int64),
+		SpaceSaved:     stats["space_saved_bytes"].(int64),
+	}
+
+	if err := s.db.Create(snapshot).Error; err != nil {
+		return nil, fmt.Errorf("failed to save storage snapshot: %w", err)
+	}
+
+	if retention > 0 {
+		if err := s.db.Where("created_at < ?", time.Now().Add(-retention)).
+			Delete(&models.StorageStatsSnapshot{}).Error; err != nil {
+			return snapshot, fmt.Errorf("failed to prune storage snapshots: %w", err)
+		}
+	}
+
+	return snapshot, nil
+}
+
+// GetStorageStatsHistory returns storage snapshots recorded since the given time, oldest first
+func (s *DocumentService) GetStorageStatsHistory(since time.Time) ([]models.StorageStatsSnapshot, error) {
+	var snapshots []models.StorageStatsSnapshot
+	err := s.db.Where("created_at >= ?", since).Order("created_at ASC").Find(&snapshots).Error
+	return snapshots, err
+}
+
+// StatusNotFound is reported in batch status lookups for unknown document IDs
+const StatusNotFound = "not_found"
+
+// processingStatus derives a document's processing status. Uploads are stored as
+// "completed" before processing runs, so a completed document without chunks has not been processed.
+func processingStatus(status string, chunkCount int) string {
+	if status == string(models.StatusCompleted) && chunkCount == 0 {
+		return string(models.StatusNotStarted)
+	}
+	return status
+}
+
+// DocumentStatusEntry is the processing status of one document in a batch lookup.
+// TotalSize is the document's file size; ProcessedSize is the share of it the
+// pipeline has got through, derived from the overall progress percent.
+type DocumentStatusEntry struct {
+	DocumentID    uint   `json:"document_id"`
+	Status        string `json:"status"`
+	ChunkCount    int    `json:"chunk_count"`
+	Error         string `json:"error,omitempty"`
+	TotalSize     int64  `json:"total_size"`
+	ProcessedSize int64  `json:"processed_size"`
+}
+
+// GetProcessingStatuses returns processing statuses for the given IDs in request order,
+// fetched with a single IN query; duplicate IDs are reported once
+func (s *DocumentService) GetProcessingStatuses(ids []uint) ([]DocumentStatusEntry, error) {
+	var rows []struct {
+		ID         uint
+		Status     string
+		ChunkCount int
+		Error      string
+		FileSize   int64
+	}
+	if err := s.db.Model(&models.Document{}).
+		Select("id, status, chunk_count, error, file_size").
+		Where("id IN ?", ids).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch document statuses: %w", err)
+	}
+
+	byID := make(map[uint]DocumentStatusEntry, len(rows))
+	for _, row := range rows {
+		status := processingStatus(row.Status, row.ChunkCount)
+		byID[row.ID] = DocumentStatusEntry{
+			DocumentID:    row.ID,
+			Status:        status,
+			ChunkCount:    row.ChunkCount,
+			Error:         row.Error,
+			TotalSize:     row.FileSize,
+			ProcessedSize: row.FileSize * int64(s.processingPercent(row.ID, status)) / 100,
+		}
+	}
+
+	entries := make([]DocumentStatusEntry, 0, len(ids))
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		entry, ok := byID[id]
+		if !ok {
+			entry = DocumentStatusEntry{DocumentID: id, Status: StatusNotFound}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// processingPercent returns a document's overall progress: the live percent
+// while this instance processes it, otherwise 100 once processing completed
+func (s *DocumentService) processingPercent(documentID uint, status string) int {
+	if progress, _, ok := s.progress.Get(documentID); ok && !progress.Done {
+		return progress.Percent
+	}
+	if status == string(models.StatusCompleted) {
+		return 100
+	}
+	return 0
+}
+
+// DocumentProcessingInfo summarizes a document's processing state and the chunks it produced
+type DocumentProcessingInfo struct {
+	Status          string `json:"status"`
+	Error           string `json:"error,omitempty"`
+	ChunkCount      int64  `json:"chunk_count"`
+	TotalChunkChars int64  `json:"total_chunk_chars"`
+	AvgChunkChars   int64  `json:"avg_chunk_chars"`
+}
+
+// GetProcessingInfo aggregates chunk counts and sizes for the given documents in a single query
+func (s *DocumentService) GetProcessingInfo(docs []models.Document) (map[uint]DocumentProcessingInfo, error) {
+	info := make(map[uint]DocumentProcessingInfo, len(docs))
+	if len(docs) == 0 {
+		return info, nil
+	}
+
+	ids := make([]uint, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+
+	var rows []struct {
+		DocumentID uint
+		ChunkCount int64
+		TotalChars int64
+	}
+	err := s.db.Model(&models.DocumentChunk{}).
+		Select("document_id, COUNT(*) AS chunk_count, COALESCE(SUM(LENGTH(content)), 0) AS total_chars").
+		Where("document_id IN ?", ids).
+		Group("document_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate document chunks: %w", err)
+	}
+
+	for _, doc := range docs {
+		info[doc.ID] = DocumentProcessingInfo{Status: doc.Status, Error: doc.Error}
+	}
+	for _, row := range rows {
+		entry := info[row.DocumentID]
+		entry.ChunkCount = row.ChunkCount
+		entry.TotalChunkChars = row.TotalChars
+		if row.ChunkCount > 0 {
+			entry.AvgChunkChars = row.TotalChars / row.ChunkCount
+		}
+		info[row.DocumentID] = entry
+	}
+	for id, entry := range info {
+		entry.Status = processingStatus(entry.Status, int(entry.ChunkCount))
+		info[id] = entry
+	}
+	return info, nil
+}
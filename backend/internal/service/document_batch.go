@@ -0,0 +1,415 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"ai-knowledge-app/internal/background"
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/pkg/logger"
+
+	"gorm.io/gorm"
+)
+
+// TaskSubmitter queues background work without blocking; background.Pool implements it
+type TaskSubmitter interface {
+	Submit(name string, run background.TaskFunc) error
+}
+
+// BatchProcessResult reports which documents of a batch were queued for processing.
+// Queued documents can be polled through GetProcessingStatuses or by task ID.
+type BatchProcessResult struct {
+	Tasks     []models.ProcessingTask `json:"tasks"`
+	QueuedIDs []uint                  `json:"queued_ids"`
+	FailedIDs []uint                  `json:"failed_ids"`
+	Errors    map[uint]string         `json:"errors,omitempty"`
+}
+
+func (r *BatchProcessResult) fail(id uint, reason string) {
+	r.FailedIDs = append(r.FailedIDs, id)
+	r.Errors[id] = reason
+}
+
+// BatchProcessDocuments queues one processing task per document, in request order.
+// Missing documents and documents already being processed are reported as failed.
+// Once the submitter rejects a task because the queue is full or the pool is
+// closed the remaining documents fail too; if nothing could be queued for that
+// reason the returned error wraps background.ErrQueueFull or background.ErrPoolClosed.
+func (s *DocumentService) BatchProcessDocuments(ids []uint, submitter TaskSubmitter) (*BatchProcessResult, error) {
+	var docs []models.Document
+	if err := s.db.Select("id, status").Where("id IN ?", ids).Find(&docs).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch documents: %w", err)
+	}
+	statuses := make(map[uint]string, len(docs))
+	for _, doc := range docs {
+		statuses[doc.ID] = doc.Status
+	}
+
+	result := &BatchProcessResult{Tasks: []models.ProcessingTask{}, QueuedIDs: []uint{}, FailedIDs: []uint{}, Errors: map[uint]string{}}
+	seen := make(map[uint]bool, len(ids))
+	var rejected error // the submitter's refusal, after which nothing else is submitted
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		status, ok := statuses[id]
+		switch {
+		case !ok:
+			result.fail(id, "document not found")
+			continue
+		case isProcessingInFlight(status):
+			result.fail(id, fmt.Sprintf("document is already %s", status))
+			continue
+		case rejected != nil:
+			result.fail(id, rejected.Error())
+			continue
+		}
+
+		task := models.ProcessingTask{DocumentID: id, Status: models.TaskPending}
+		if err := s.queueTask(&task, status, submitter); err != nil {
+			if errors.Is(err, background.ErrQueueFull) || errors.Is(err, background.ErrPoolClosed) {
+				rejected = err
+			}
+			result.fail(id, err.Error())
+			continue
+		}
+		result.Tasks = append(result.Tasks, task)
+		result.QueuedIDs = append(result.QueuedIDs, id)
+	}
+
+	if rejected != nil && len(result.QueuedIDs) == 0 {
+		return result, fmt.Errorf("no documents queued: %w", rejected)
+	}
+	return result, nil
+}
+
+// queueTask claims the document by marking it queued, records a pending task
+// and submits it. A document that is already in flight is left alone and
+// ErrDocumentProcessing returned. When submitting fails the document goes back
+// to prevStatus and the returned error is the submitter's, e.g.
+// background.ErrQueueFull.
+func (s *DocumentService) queueTask(task *models.ProcessingTask, prevStatus string, submitter TaskSubmitter) error {
+	// Claimed before submitting so a fast worker's status update is not
+	// overwritten, and conditionally so concurrent requests queue it only once
+	claim := s.db.Model(&models.Document{}).
+		Where("id = ? AND status NOT IN ?", task.DocumentID, inFlightStatuses).
+		Update("status", string(models.StatusQueued))
+	if claim.Error != nil {
+		return fmt.Errorf("failed to update document status: %w", claim.Error)
+	}
+	if claim.RowsAffected == 0 {
+		return ErrDocumentProcessing
+	}
+
+	if err := s.tasks.Create(task); err != nil {
+		s.releaseClaim(task.DocumentID, prevStatus)
+		return fmt.Errorf("failed to create processing task: %w", err)
+	}
+	if err := submitter.Submit("document_processing", s.processTask(task.ID, task.DocumentID)); err != nil {
+		s.releaseClaim(task.DocumentID, prevStatus)
+		if markErr := s.tasks.MarkFinished(task.ID, err); markErr != nil {
+			logger.GetLogger().WithError(markErr).WithField("task_id", task.ID).Error("Failed to record rejected processing task")
+		}
+		return err
+	}
+	s.progress.Update(newProcessingProgress(task.DocumentID, task.ID, string(models.StatusQueued), 0))
+	return nil
+}
+
+// errTaskCancelled is the context cause set by CancelTask, telling a user's
+// cancellation apart from the pool's task timeout or shutdown
+var errTaskCancelled = errors.New("processing task cancelled")
+
+// processTask runs the processing pipeline for a queued task, recording its
+// status transitions; cancelled tasks are skipped, and CancelTask stops the
+// task while it runs
+func (s *DocumentService) processTask(taskID, documentID uint) background.TaskFunc {
+	return func(ctx context.Context) error {
+		// Registered before the task starts so CancelTask cannot miss it
+		ctx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+		s.trackRunning(taskID, func() { cancel(errTaskCancelled) })
+		defer s.untrackRunning(taskID)
+
+		started, err := s.tasks.MarkStarted(taskID)
+		if err != nil {
+			return fmt.Errorf("failed to start processing task %d: %w", taskID, err)
+		}
+		if !started {
+			return nil
+		}
+
+		chunkCount := 0
+		processor := NewDocumentProcessor(s.db)
+		processor.SetObjectReader(s)
+		processor.SetMaxParseBytes(s.maxParseBytes)
+		processor.SetChunkSaveBatchSize(s.saveBatchSize)
+		processor.SetChunkMetadataSchema(s.metadata)
+		processor.SetContentFingerprinting(s.nearDupMaxDistance > 0)
+		processor.SetProgressFunc(func(status models.ProcessingStatus, stagePercent, chunks int) {
+			chunkCount = chunks
+			progress := newProcessingProgress(documentID, taskID, string(status), stagePercent)
+			progress.ChunkCount = chunks
+			s.progress.Update(progress)
+		})
+		processErr := processor.ProcessDocumentContext(ctx, documentID, s.chunking)
+		if processErr == nil {
+			s.recordNearDuplicate(documentID)
+		}
+		if err := s.tasks.MarkFinished(taskID, processErr); err != nil {
+			return fmt.Errorf("failed to record processing task %d: %w", taskID, err)
+		}
+
+		// Reported after the task is recorded so a finished stream matches the stored status
+		final := newProcessingProgress(documentID, taskID, string(models.StatusCompleted), 100)
+		switch {
+		case errors.Is(processErr, errTaskCancelled):
+			final = newProcessingProgress(documentID, taskID, string(models.StatusCancelled), 0)
+			processErr = nil
+		case processErr != nil:
+			final = newProcessingProgress(documentID, taskID, string(models.StatusFailed), 0)
+			final.Error = processErr.Error()
+		}
+		final.ChunkCount = chunkCount
+		s.progress.Update(final)
+		return processErr
+	}
+}
+
+func (s *DocumentService) trackRunning(taskID uint, cancel context.CancelFunc) {
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	s.running[taskID] = cancel
+}
+
+func (s *DocumentService) untrackRunning(taskID uint) {
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	delete(s.running, taskID)
+}
+
+// ErrDocumentProcessing is returned when a document is reprocessed while it is
+// already queued or mid-pipeline
+var ErrDocumentProcessing = errors.New("document is already being processed")
+
+// ReprocessDocument re-runs the processing pipeline for a document right away
+// and returns its new chunk count. The document is claimed by marking it queued
+// and parsed and chunked outside any transaction; only the swap of old chunks
+// for new ones and the final status update share a transaction, so a failure
+// leaves the previous chunks and status untouched.
+func (s *DocumentService) ReprocessDocument(documentID uint) (int, error) {
+	var doc models.Document
+	if err := s.db.First(&doc, documentID).Error; err != nil {
+		return 0, err
+	}
+	if isProcessingInFlight(doc.Status) {
+		return 0, fmt.Errorf("%w: document is %s", ErrDocumentProcessing, doc.Status)
+	}
+	prevStatus := doc.Status
+
+	// Claimed with a conditional update so a concurrent reprocess or queued task loses the race
+	claim := s.db.Model(&models.Document{}).
+		Where("id = ? AND status NOT IN ?", documentID, inFlightStatuses).
+		Update("status", string(models.StatusQueued))
+	if claim.Error != nil {
+		return 0, fmt.Errorf("failed to claim document: %w", claim.Error)
+	}
+	if claim.RowsAffected == 0 {
+		return 0, ErrDocumentProcessing
+	}
+
+	processor := NewDocumentProcessor(s.db)
+	processor.SetObjectReader(s)
+	processor.SetMaxParseBytes(s.maxParseBytes)
+	processor.SetChunkSaveBatchSize(s.saveBatchSize)
+	processor.SetChunkMetadataSchema(s.metadata)
+	processor.SetContentFingerprinting(s.nearDupMaxDistance > 0)
+	processor.SetProgressFunc(func(status models.ProcessingStatus, stagePercent, chunks int) {
+		progress := newProcessingProgress(documentID, 0, string(status), stagePercent)
+		progress.ChunkCount = chunks
+		s.progress.Update(progress)
+	})
+
+	chunks, err := processor.prepareChunks(&doc, s.chunking)
+	if err == nil {
+		err = s.db.Transaction(func(tx *gorm.DB) error {
+			if err := processor.saveChunks(tx, documentID, chunks); err != nil {
+				return fmt.Errorf("failed to replace chunks: %w", err)
+			}
+			return tx.Model(&models.Document{}).Where("id = ?", documentID).Updates(map[string]interface{}{
+				"status":              string(models.StatusCompleted),
+				"error":               "",
+				"raw_text":            doc.RawText,
+				"cleaned_text":        doc.CleanedText,
+				"markdown":            doc.Markdown,
+				"chunk_count":         doc.ChunkCount,
+				"content_fingerprint": doc.ContentFingerprint,
+				"fingerprint_band0":   doc.FingerprintBand0,
+				"fingerprint_band1":   doc.FingerprintBand1,
+				"fingerprint_band2":   doc.FingerprintBand2,
+				"fingerprint_band3":   doc.FingerprintBand3,
+			}).Error
+		})
+	}
+
+	if err != nil {
+		// The previous chunks were never touched
+		s.releaseClaim(documentID, prevStatus)
+		final := newProcessingProgress(documentID, 0, string(models.StatusFailed), 0)
+		final.Error = err.Error()
+		s.progress.Update(final)
+		return 0, err
+	}
+
+	s.recordNearDuplicate(documentID)
+	final := newProcessingProgress(documentID, 0, string(models.StatusCompleted), 100)
+	final.ChunkCount = doc.ChunkCount
+	s.progress.Update(final)
+	return doc.ChunkCount, nil
+}
+
+// ReprocessAllResult summarizes reprocessing every document
+type ReprocessAllResult struct {
+	Reprocessed int             `json:"reprocessed"`
+	ChunkCount  int             `json:"chunk_count"` // chunks produced across all reprocessed documents
+	Skipped     int             `json:"skipped"`     // documents already being processed
+	SkippedIDs  []uint          `json:"skipped_ids,omitempty"`
+	FailedIDs   []uint          `json:"failed_ids,omitempty"`
+	Errors      map[uint]string `json:"errors,omitempty"`
+	Aborted     bool            `json:"aborted,omitempty"`
+}
+
+// ReprocessAllDocuments reprocesses every stored document one at a time with
+// ReprocessDocument. A failed document keeps its previous chunks and does not
+// stop the run; cancelling ctx stops before the next document.
+func (s *DocumentService) ReprocessAllDocuments(ctx context.Context, progress JobProgress) (*ReprocessAllResult, error) {
+	result := &ReprocessAllResult{Errors: map[uint]string{}}
+	query := s.db.Model(&models.Document{}).Where("file_path <> ''")
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return result, err
+	}
+
+	processed := 0
+	var batch []models.Document
+	err := query.Select("id").FindInBatches(&batch, DefaultIntegrityBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, doc := range batch {
+			if ctx.Err() != nil {
+				result.Aborted = true
+				return ctx.Err()
+			}
+			chunks, err := s.ReprocessDocument(doc.ID)
+			switch {
+			case errors.Is(err, ErrDocumentProcessing):
+				result.Skipped++
+				result.SkippedIDs = append(result.SkippedIDs, doc.ID)
+			case err != nil:
+				result.FailedIDs = append(result.FailedIDs, doc.ID)
+				result.Errors[doc.ID] = err.Error()
+			default:
+				result.Reprocessed++
+				result.ChunkCount += chunks
+			}
+			processed++
+			if progress != nil {
+				progress(processed, int(total))
+			}
+		}
+		return nil
+	}).Error
+	if err != nil && !result.Aborted {
+		return result, err
+	}
+	return result, nil
+}
+
+// GetTask returns a processing task by ID
+func (s *DocumentService) GetTask(id uint) (*models.ProcessingTask, error) {
+	return s.tasks.GetByID(id)
+}
+
+// GetLatestTask returns the most recent processing task of a document
+func (s *DocumentService) GetLatestTask(documentID uint) (*models.ProcessingTask, error) {
+	return s.tasks.GetLatestByDocumentID(documentID)
+}
+
+// CancelTask cancels a processing task. A pending task and its document are
+// marked cancelled right away and the worker skips it. A task running on this
+// instance stops at the next stage of the pipeline, keeping the document's
+// previous chunks; the returned task may still show processing until then.
+// Unknown IDs return ErrTaskNotFound.
+func (s *DocumentService) CancelTask(id uint) (*models.ProcessingTask, error) {
+	task, err := s.tasks.Cancel(id)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, ErrTaskNotFound
+	case errors.Is(err, ErrTaskNotCancellable):
+		s.runningMu.Lock()
+		cancel, running := s.running[id]
+		s.runningMu.Unlock()
+		if !running {
+			return nil, err
+		}
+		cancel()
+		return s.tasks.GetByID(id)
+	case err != nil:
+		return nil, err
+	}
+	if err := s.setDocumentStatus(task.DocumentID, string(models.StatusCancelled)); err != nil {
+		return nil, fmt.Errorf("failed to update document status: %w", err)
+	}
+	s.progress.Update(newProcessingProgress(task.DocumentID, task.ID, string(models.StatusCancelled), 0))
+	return task, nil
+}
+
+// GetProcessingProgress returns a document's live progress when it is being
+// processed by this instance, otherwise a snapshot derived from the stored status
+func (s *DocumentService) GetProcessingProgress(documentID uint) (ProcessingProgress, <-chan struct{}, error) {
+	if progress, changed, ok := s.progress.Get(documentID); ok {
+		return progress, changed, nil
+	}
+
+	var doc models.Document
+	if err := s.db.Select("id, status, chunk_count, error").First(&doc, documentID).Error; err != nil {
+		return ProcessingProgress{}, nil, err
+	}
+	status := processingStatus(doc.Status, doc.ChunkCount)
+	progress := newProcessingProgress(documentID, 0, status, 0)
+	progress.ChunkCount = doc.ChunkCount
+	progress.Error = doc.Error
+	// Unprocessed documents have nothing to stream
+	if status == string(models.StatusNotStarted) {
+		progress.Done = true
+	}
+	return progress, nil, nil
+}
+
+// inFlightStatuses are the document statuses of a queued or mid-pipeline document
+var inFlightStatuses = []string{
+	string(models.StatusQueued), string(models.StatusParsing), string(models.StatusCleaning), string(models.StatusChunking),
+}
+
+// isProcessingInFlight reports whether a document is queued or mid-pipeline
+func isProcessingInFlight(status string) bool {
+	return slices.Contains(inFlightStatuses, status)
+}
+
+// releaseClaim puts a document claimed as queued back to prevStatus after the
+// work it was claimed for could not start. A failure is logged: the document
+// stays queued until the startup sweep (RequeueInterruptedProcessing) finds it.
+func (s *DocumentService) releaseClaim(id uint, prevStatus string) {
+	err := s.db.Model(&models.Document{}).
+		Where("id = ? AND status = ?", id, string(models.StatusQueued)).
+		Update("status", prevStatus).Error
+	if err != nil {
+		logger.GetLogger().WithError(err).WithField("document_id", id).Error("Failed to restore document status")
+	}
+}
+
+func (s *DocumentService) setDocumentStatus(id uint, status string) error {
+	return s.db.Model(&models.Document{}).Where("id = ?", id).Update("status", status).Error
+}
@@ -0,0 +1,441 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/background"
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/pkg/logger"
+
+	"gorm.io/gorm"
+)
+
+// limitedSubmitter 只接受前limit个任务，之后返回队列已满
+type limitedSubmitter struct {
+	limit int
+	tasks []background.TaskFunc
+}
+
+func (s *limitedSubmitter) Submit(name string, run background.TaskFunc) error {
+	if len(s.tasks) >= s.limit {
+		return background.ErrQueueFull
+	}
+	s.tasks = append(s.tasks, run)
+	return nil
+}
+
+func TestBatchProcessDocumentsRunsProcessor(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	db := setupTestDB()
+	db.AutoMigrate(&models.DocumentChunk{})
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("First paragraph.\n\nSecond paragraph."), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	doc := models.Document{Name: "notes", Extension: ".txt", FilePath: path, Status: "completed", FileSize: 36}
+	busy := models.Document{Name: "busy", Extension: ".txt", FilePath: path, Status: "chunking", FileSize: 200}
+	db.Create(&doc)
+	db.Create(&busy)
+
+	service := NewDocumentService(db)
+	pool := background.NewPool(1, 10, 0)
+	result, err := service.BatchProcessDocuments([]uint{doc.ID, busy.ID, 999, doc.ID}, pool)
+	if err != nil {
+		t.Fatalf("BatchProcessDocuments failed: %v", err)
+	}
+	if len(result.QueuedIDs) != 1 || result.QueuedIDs[0] != doc.ID {
+		t.Errorf("Expected only %d to be queued, got %v", doc.ID, result.QueuedIDs)
+	}
+	if len(result.FailedIDs) != 2 || result.FailedIDs[0] != busy.ID || result.FailedIDs[1] != 999 {
+		t.Errorf("Expected busy and missing documents to fail, got %v (%v)", result.FailedIDs, result.Errors)
+	}
+
+	// 等待任务执行完毕
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	statuses, _ := service.GetProcessingStatuses([]uint{doc.ID})
+	if statuses[0].Status != "completed" || statuses[0].ChunkCount == 0 {
+		t.Errorf("Expected document to be processed, got %+v", statuses[0])
+	}
+	if statuses[0].TotalSize != 36 || statuses[0].ProcessedSize != 36 {
+		t.Errorf("Expected the whole file to be reported processed, got %+v", statuses[0])
+	}
+
+	// 处理中的文档按整体进度折算已处理的大小
+	service.progress.Update(newProcessingProgress(busy.ID, 0, string(models.StatusChunking), 50))
+	statuses, _ = service.GetProcessingStatuses([]uint{busy.ID})
+	if statuses[0].TotalSize != 200 || statuses[0].ProcessedSize != 140 {
+		t.Errorf("Expected 70%% of the file to be reported processed, got %+v", statuses[0])
+	}
+
+	// 任务记录了状态流转和时间
+	if len(result.Tasks) != 1 || result.Tasks[0].Status != models.TaskPending {
+		t.Fatalf("Expected one pending task in result, got %+v", result.Tasks)
+	}
+	task, err := service.GetTask(result.Tasks[0].ID)
+	if err != nil {
+		t.Fatalf("GetTask failed: %v", err)
+	}
+	if task.Status != models.TaskCompleted || task.StartedAt == nil || task.CompletedAt == nil || task.CompletedAt.Before(*task.StartedAt) {
+		t.Errorf("Expected completed task with timestamps, got %+v", task)
+	}
+	latest, err := service.GetLatestTask(doc.ID)
+	if err != nil || latest.ID != task.ID {
+		t.Errorf("Expected latest task %d for document, got %+v, %v", task.ID, latest, err)
+	}
+}
+
+func TestCancelProcessingTask(t *testing.T) {
+	db := setupTestDB()
+	doc := models.Document{Name: "a", Extension: ".txt", Status: "completed"}
+	db.Create(&doc)
+	service := NewDocumentService(db)
+
+	submitter := &limitedSubmitter{limit: 1}
+	result, err := service.BatchProcessDocuments([]uint{doc.ID}, submitter)
+	if err != nil || len(result.Tasks) != 1 {
+		t.Fatalf("Expected one queued task, got %+v, %v", result, err)
+	}
+	taskID := result.Tasks[0].ID
+
+	cancelled, err := service.CancelTask(taskID)
+	if err != nil || cancelled.Status != models.TaskCancelled || cancelled.CompletedAt == nil {
+		t.Fatalf("Expected task to be cancelled, got %+v, %v", cancelled, err)
+	}
+	if _, err := service.CancelTask(taskID); !errors.Is(err, ErrTaskNotCancellable) {
+		t.Errorf("Expected ErrTaskNotCancellable for finished task, got %v", err)
+	}
+
+	// worker取到已取消的任务时直接跳过
+	if err := submitter.tasks[0](context.Background()); err != nil {
+		t.Fatalf("Cancelled task returned error: %v", err)
+	}
+	task, _ := service.GetTask(taskID)
+	if task.Status != models.TaskCancelled || task.StartedAt != nil {
+		t.Errorf("Expected cancelled task to stay unstarted, got %+v", task)
+	}
+	statuses, _ := service.GetProcessingStatuses([]uint{doc.ID})
+	if statuses[0].Status != "cancelled" {
+		t.Errorf("Expected document to be cancelled, got %+v", statuses[0])
+	}
+}
+
+func TestCancelRunningProcessingTask(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	db := setupTestDB()
+	db.AutoMigrate(&models.DocumentChunk{})
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("First paragraph.\n\nSecond paragraph."), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	doc := models.Document{Name: "notes", Extension: ".txt", FilePath: path, Status: "completed", FileSize: 36}
+	db.Create(&doc)
+	db.Create(&models.DocumentChunk{DocumentID: doc.ID, Content: "previous chunk"})
+	service := NewDocumentService(db)
+
+	submitter := &limitedSubmitter{limit: 1}
+	result, err := service.BatchProcessDocuments([]uint{doc.ID}, submitter)
+	if err != nil || len(result.Tasks) != 1 {
+		t.Fatalf("Expected one queued task, got %+v, %v", result, err)
+	}
+	taskID := result.Tasks[0].ID
+
+	// 运行中的任务通过取消其context停止
+	ctx, cancel := context.WithCancelCause(context.Background())
+	service.trackRunning(taskID, func() { cancel(errTaskCancelled) })
+	db.Model(&models.ProcessingTask{}).Where("id = ?", taskID).Update("status", models.TaskProcessing)
+	task, err := service.CancelTask(taskID)
+	if err != nil || task.Status != models.TaskProcessing || ctx.Err() == nil {
+		t.Fatalf("Expected running task to be signalled, got %+v, %v", task, err)
+	}
+	service.untrackRunning(taskID)
+	if _, err := service.CancelTask(taskID); !errors.Is(err, ErrTaskNotCancellable) {
+		t.Errorf("Expected ErrTaskNotCancellable for task running elsewhere, got %v", err)
+	}
+	if _, err := service.CancelTask(999); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("Expected ErrTaskNotFound, got %v", err)
+	}
+
+	// 被取消的处理不报错，任务和文档变为cancelled，保留原有分块
+	db.Model(&models.ProcessingTask{}).Where("id = ?", taskID).Update("status", models.TaskPending)
+	if err := submitter.tasks[0](ctx); err != nil {
+		t.Fatalf("Cancelled task returned error: %v", err)
+	}
+	task, _ = service.GetTask(taskID)
+	if task.Status != models.TaskCancelled || task.CompletedAt == nil {
+		t.Errorf("Expected task to be cancelled, got %+v", task)
+	}
+	statuses, _ := service.GetProcessingStatuses([]uint{doc.ID})
+	if statuses[0].Status != "cancelled" {
+		t.Errorf("Expected document to be cancelled, got %+v", statuses[0])
+	}
+	var chunks int64
+	db.Model(&models.DocumentChunk{}).Where("document_id = ?", doc.ID).Count(&chunks)
+	if chunks != 1 {
+		t.Errorf("Expected cancelled document to keep its previous chunk, got %d", chunks)
+	}
+}
+
+func TestProcessingTaskTimeoutFails(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	db := setupTestDB()
+	db.AutoMigrate(&models.DocumentChunk{})
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("First paragraph."), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	doc := models.Document{Name: "notes", Extension: ".txt", FilePath: path, Status: "completed", FileSize: 16}
+	db.Create(&doc)
+	service := NewDocumentService(db)
+
+	submitter := &limitedSubmitter{limit: 1}
+	result, err := service.BatchProcessDocuments([]uint{doc.ID}, submitter)
+	if err != nil || len(result.Tasks) != 1 {
+		t.Fatalf("Expected one queued task, got %+v, %v", result, err)
+	}
+	taskID := result.Tasks[0].ID
+
+	// 后台任务超时或关闭不是用户取消，任务和文档记为failed以便自动重试
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if err := submitter.tasks[0](ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected timed-out task to return DeadlineExceeded, got %v", err)
+	}
+	task, _ := service.GetTask(taskID)
+	if task.Status != models.TaskFailed || task.Error == "" {
+		t.Errorf("Expected timed-out task to fail, got %+v", task)
+	}
+	statuses, _ := service.GetProcessingStatuses([]uint{doc.ID})
+	if statuses[0].Status != "failed" {
+		t.Errorf("Expected timed-out document to fail, got %+v", statuses[0])
+	}
+}
+
+func TestBatchProcessDocumentsQueueFull(t *testing.T) {
+	db := setupTestDB()
+	docs := []models.Document{
+		{Name: "a", Extension: ".txt", Status: "completed"},
+		{Name: "b", Extension: ".txt", Status: "completed"},
+		{Name: "c", Extension: ".txt", Status: "failed"},
+	}
+	for i := range docs {
+		db.Create(&docs[i])
+	}
+	ids := []uint{docs[0].ID, docs[1].ID, docs[2].ID}
+	service := NewDocumentService(db)
+
+	submitter := &limitedSubmitter{limit: 1}
+	result, err := service.BatchProcessDocuments(ids, submitter)
+	if err != nil {
+		t.Fatalf("Expected partial success, got %v", err)
+	}
+	if len(result.QueuedIDs) != 1 || len(result.FailedIDs) != 2 || len(submitter.tasks) != 1 {
+		t.Errorf("Expected one queued and two failed documents, got %+v", result)
+	}
+	statuses, _ := service.GetProcessingStatuses(ids)
+	if statuses[0].Status != "queued" || statuses[1].Status != "not_started" || statuses[2].Status != "failed" {
+		t.Errorf("Expected rejected documents to keep their status, got %+v", statuses)
+	}
+
+	// 没有任何文档入队时返回ErrQueueFull
+	if _, err := service.BatchProcessDocuments(ids[1:], &limitedSubmitter{}); err == nil || !errors.Is(err, background.ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+
+	// 任务池已关闭时同样返回其错误
+	pool := background.NewPool(1, 1, 0)
+	pool.Shutdown(context.Background())
+	if _, err := service.BatchProcessDocuments(ids[1:], pool); !errors.Is(err, background.ErrPoolClosed) {
+		t.Errorf("Expected ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestQueueTaskClaimsDocumentOnce(t *testing.T) {
+	db := setupTestDB()
+	doc := models.Document{Name: "a", Extension: ".txt", Status: "completed"}
+	db.Create(&doc)
+	service := NewDocumentService(db)
+
+	submitter := &limitedSubmitter{limit: 2}
+	first := models.ProcessingTask{DocumentID: doc.ID, Status: models.TaskPending}
+	if err := service.queueTask(&first, doc.Status, submitter); err != nil {
+		t.Fatalf("queueTask failed: %v", err)
+	}
+	// 文档已被认领，第二次入队不创建任务也不提交
+	second := models.ProcessingTask{DocumentID: doc.ID, Status: models.TaskPending}
+	if err := service.queueTask(&second, doc.Status, submitter); !errors.Is(err, ErrDocumentProcessing) {
+		t.Fatalf("Expected ErrDocumentProcessing, got %v", err)
+	}
+	var count int64
+	db.Model(&models.ProcessingTask{}).Where("document_id = ?", doc.ID).Count(&count)
+	if count != 1 || len(submitter.tasks) != 1 {
+		t.Errorf("Expected one task, got %d recorded and %d submitted", count, len(submitter.tasks))
+	}
+}
+
+func TestBatchProcessDocumentsUsesProcessingOptions(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&models.DocumentChunk{})
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("One.\n\nTwo.\n\nThree."), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	doc := models.Document{Name: "notes", Extension: ".txt", FilePath: path}
+	db.Create(&doc)
+
+	service := NewDocumentService(db)
+	if err := service.SetProcessingOptions(ChunkingOptions{Strategy: ChunkingFixed, ChunkSize: 10, Overlap: 10}, 0); err == nil {
+		t.Error("Expected invalid overlap to be rejected")
+	}
+	if err := service.SetProcessingOptions(ChunkingOptions{Strategy: ChunkingParagraph, ChunkSize: 6}, 0); err != nil {
+		t.Fatalf("SetProcessingOptions failed: %v", err)
+	}
+
+	submitter := &limitedSubmitter{limit: 1}
+	if _, err := service.BatchProcessDocuments([]uint{doc.ID}, submitter); err != nil {
+		t.Fatalf("BatchProcessDocuments failed: %v", err)
+	}
+	if err := submitter.tasks[0](context.Background()); err != nil {
+		t.Fatalf("Processing task failed: %v", err)
+	}
+
+	var chunks []models.DocumentChunk
+	db.Where("document_id = ?", doc.ID).Order("chunk_index").Find(&chunks)
+	if len(chunks) != 3 || chunks[0].Strategy != "paragraph" {
+		t.Errorf("Expected three paragraph chunks, got %+v", chunks)
+	}
+}
+
+func TestReprocessDocument(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	db := setupTestDB()
+	db.AutoMigrate(&models.DocumentChunk{})
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("First paragraph.\n\nSecond paragraph."), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	doc := models.Document{Name: "notes", Extension: ".txt", FilePath: path, Status: "completed"}
+	db.Create(&doc)
+	service := NewDocumentService(db)
+
+	first, err := service.ReprocessDocument(doc.ID)
+	if err != nil || first == 0 {
+		t.Fatalf("Expected document to be chunked, got %d, %v", first, err)
+	}
+
+	// 再次处理替换原有分块而不是追加
+	count, err := service.ReprocessDocument(doc.ID)
+	if err != nil || count != first {
+		t.Fatalf("Expected %d chunks after reprocessing, got %d, %v", first, count, err)
+	}
+	var stored int64
+	db.Model(&models.DocumentChunk{}).Where("document_id = ?", doc.ID).Count(&stored)
+	if stored != int64(first) {
+		t.Errorf("Expected old chunks to be replaced, found %d", stored)
+	}
+	var processed models.Document
+	db.First(&processed, doc.ID)
+	if processed.Status != "completed" || processed.ChunkCount != first || processed.CleanedText == "" || processed.Markdown == "" {
+		t.Errorf("Expected processed text and status to be saved, got %+v", processed)
+	}
+
+	// 替换分块的事务失败时回滚，保留原有状态
+	db.Exec("ALTER TABLE document_chunks RENAME TO document_chunks_saved")
+	if _, err := service.ReprocessDocument(doc.ID); err == nil {
+		t.Fatal("Expected reprocessing to fail without the chunks table")
+	}
+	db.Exec("ALTER TABLE document_chunks_saved RENAME TO document_chunks")
+	db.First(&processed, doc.ID)
+	if processed.Status != "completed" || processed.ChunkCount != first {
+		t.Errorf("Expected the claim to be released after a failed swap, got %+v", processed)
+	}
+
+	// 解析失败时保留原有分块和状态
+	os.Remove(path)
+	if _, err := service.ReprocessDocument(doc.ID); err == nil {
+		t.Fatal("Expected reprocessing a missing file to fail")
+	}
+	db.Model(&models.DocumentChunk{}).Where("document_id = ?", doc.ID).Count(&stored)
+	var unchanged models.Document
+	db.First(&unchanged, doc.ID)
+	if stored != int64(first) || unchanged.Status != "completed" || unchanged.ChunkCount != first || unchanged.Error != "" {
+		t.Errorf("Expected the failed run to be rolled back, got %d chunks and %+v", stored, unchanged)
+	}
+
+	db.Model(&unchanged).Update("status", "chunking")
+	if _, err := service.ReprocessDocument(doc.ID); !errors.Is(err, ErrDocumentProcessing) {
+		t.Errorf("Expected ErrDocumentProcessing for a document in flight, got %v", err)
+	}
+	if _, err := service.ReprocessDocument(999); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected ErrRecordNotFound for a missing document, got %v", err)
+	}
+}
+
+func TestGetQueueStats(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	service := NewDocumentService(setupTestDB())
+
+	// 未关联队列时明确标记，而不是返回全零统计
+	if stats := service.GetQueueStats(); stats.Status != QueueNotRunning || stats.Metrics != nil {
+		t.Errorf("Expected queue not running without metrics, got %+v", stats)
+	}
+
+	pool := background.NewPool(2, 4, 0)
+	service.SetProcessingQueue(pool)
+	pool.Submit("ok", func(ctx context.Context) error { return nil })
+	pool.Submit("fail", func(ctx context.Context) error { return errors.New("parse failed") })
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		if stats := pool.Stats(); stats.Completed+stats.Failed == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected tasks to finish, stats: %+v", pool.Stats())
+		}
+	}
+
+	stats := service.GetQueueStats()
+	if stats.Status != QueueRunning || stats.Metrics == nil {
+		t.Fatalf("Expected running queue with metrics, got %+v", stats)
+	}
+	if m := stats.Metrics; m.Workers != 2 || m.Completed != 1 || m.Failed != 1 || m.Pending != 0 || m.ThroughputPerMinute <= 0 {
+		t.Errorf("Unexpected queue metrics %+v", m)
+	}
+
+	// 暂停和恢复在统计中体现，重复操作不报错
+	for i := 0; i < 2; i++ {
+		if stats, err := service.PauseQueue(); err != nil || !stats.Paused {
+			t.Errorf("Expected paused queue, got %+v, %v", stats, err)
+		}
+	}
+	if stats, err := service.ResumeQueue(); err != nil || stats.Paused {
+		t.Errorf("Expected resumed queue, got %+v, %v", stats, err)
+	}
+
+	pool.Shutdown(context.Background())
+	if stats := service.GetQueueStats(); stats.Status != QueueNotRunning || stats.Metrics != nil {
+		t.Errorf("Expected closed queue to be reported as not running, got %+v", stats)
+	}
+	if _, err := service.PauseQueue(); !errors.Is(err, ErrQueueNotRunning) {
+		t.Errorf("Expected ErrQueueNotRunning for a closed queue, got %v", err)
+	}
+}
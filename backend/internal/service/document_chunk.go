@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/pkg/logger"
+)
+
+// ErrInvalidChunkOffsets is returned when edited chunk offsets do not describe a
+// range of the document's cleaned text
+var ErrInvalidChunkOffsets = errors.New("invalid chunk offsets")
+
+// ChunkDetail is a single chunk with the document it belongs to, used to drill
+// down from a citation to its source passage
+type ChunkDetail struct {
+	ID           uint   `json:"id"`
+	DocumentID   uint   `json:"document_id"`
+	DocumentName string `json:"document_name"`
+	ChunkIndex   int    `json:"chunk_index"`
+	ChunkCount   int    `json:"chunk_count"` // total chunks of the document
+	Content      string `json:"content"`
+	Strategy     string `json:"strategy"`
+	StartOffset  *int   `json:"start_offset,omitempty"`
+	EndOffset    *int   `json:"end_offset,omitempty"`
+
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+
+	ManuallyEdited bool       `json:"manually_edited"`
+	EditedAt       *time.Time `json:"edited_at,omitempty"`
+}
+
+// ChunkUpdate is a manual correction of a chunk's content. Offsets are optional
+// but must be given together; they locate the corrected passage in the
+// document's cleaned text. Metadata, when set, replaces the chunk's metadata.
+type ChunkUpdate struct {
+	Content     string
+	StartOffset *int
+	EndOffset   *int
+	Metadata    map[string]interface{}
+}
+
+// GetChunk returns a chunk by ID. Chunks of deleted documents return
+// gorm.ErrRecordNotFound like missing ones.
+func (s *DocumentService) GetChunk(id uint) (*ChunkDetail, error) {
+	var chunk models.DocumentChunk
+	if err := s.db.First(&chunk, id).Error; err != nil {
+		return nil, err
+	}
+	var doc models.Document
+	if err := s.db.Select("id", "name", "chunk_count").First(&doc, chunk.DocumentID).Error; err != nil {
+		return nil, err
+	}
+	return newChunkDetail(chunk, doc), nil
+}
+
+// UpdateChunk replaces a chunk's content and marks it manually edited. Offsets
+// outside the cleaned text, or given without their counterpart, return
+// ErrInvalidChunkOffsets. Without new offsets the old ones are kept only while
+// they still locate the content exactly, and are cleared otherwise. New
+// metadata that does not conform to a rejecting schema returns
+// ErrInvalidChunkMetadata.
+func (s *DocumentService) UpdateChunk(id uint, update ChunkUpdate) (*ChunkDetail, error) {
+	if update.Metadata != nil {
+		if err := s.metadata.Check(update.Metadata); err != nil {
+			if s.metadata.Rejects() {
+				return nil, err
+			}
+			logger.GetLogger().WithError(err).WithField("chunk_id", id).Warn("Chunk metadata does not conform to schema")
+		}
+	}
+
+	var chunk models.DocumentChunk
+	if err := s.db.First(&chunk, id).Error; err != nil {
+		return nil, err
+	}
+	var doc models.Document
+	if err := s.db.Select("id", "name", "chunk_count", "cleaned_text").First(&doc, chunk.DocumentID).Error; err != nil {
+		return nil, err
+	}
+
+	start, end := update.StartOffset, update.EndOffset
+	switch {
+	case (start == nil) != (end == nil):
+		return nil, fmt.Errorf("%w: start_offset and end_offset must be set together", ErrInvalidChunkOffsets)
+	case start != nil:
+		if *start < 0 || *start > *end || *end > len(doc.CleanedText) {
+			return nil, fmt.Errorf("%w: range [%d, %d) is outside the cleaned text (%d bytes)",
+				ErrInvalidChunkOffsets, *start, *end, len(doc.CleanedText))
+		}
+	case chunk.StartOffset != nil && chunk.EndOffset != nil:
+		start, end = chunk.StartOffset, chunk.EndOffset
+		if *end > len(doc.CleanedText) || *start > *end || doc.CleanedText[*start:*end] != update.Content {
+			start, end = nil, nil
+		}
+	}
+
+	now := time.Now()
+	chunk.Content = update.Content
+	chunk.StartOffset, chunk.EndOffset = start, end
+	chunk.ManuallyEdited = true
+	chunk.EditedAt = &now
+	if update.Metadata != nil {
+		chunk.Metadata = update.Metadata
+	}
+	if err := s.db.Model(&chunk).Select("content", "start_offset", "end_offset", "metadata", "manually_edited", "edited_at").
+		Updates(&chunk).Error; err != nil {
+		return nil, fmt.Errorf("failed to update chunk: %w", err)
+	}
+	return newChunkDetail(chunk, doc), nil
+}
+
+// newChunkDetail combines a chunk with the document fields shown alongside it
+func newChunkDetail(chunk models.DocumentChunk, doc models.Document) *ChunkDetail {
+	return &ChunkDetail{
+		ID:           chunk.ID,
+		DocumentID:   chunk.DocumentID,
+		DocumentName: doc.Name,
+		ChunkIndex:   chunk.ChunkIndex,
+		ChunkCount:   doc.ChunkCount,
+		Content:      chunk.Content,
+		Strategy:     chunk.Strategy,
+		StartOffset:  chunk.StartOffset,
+		EndOffset:    chunk.EndOffset,
+
+		Metadata: chunk.Metadata,
+
+		ManuallyEdited: chunk.ManuallyEdited,
+		EditedAt:       chunk.EditedAt,
+	}
+}
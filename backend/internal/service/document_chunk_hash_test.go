@@ -0,0 +1,146 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ai-knowledge-app/internal/models"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUploadChunkWithHash(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+
+	content := append(bytes.Repeat([]byte("a"), 1048576), []byte("tail")...)
+	result, err := service.InitUpload("verified.txt", int64(len(content)), sha256Hex(content))
+	if err != nil {
+		t.Fatalf("InitUpload failed: %v", err)
+	}
+	session := result.Session
+	defer os.RemoveAll(session.TempDir)
+	first, second := content[:1048576], content[1048576:]
+
+	// 哈希不一致时拒绝保存
+	if err := service.UploadChunkWithHash(session.ID, 0, first, sha256Hex([]byte("other"))); !errors.Is(err, ErrChunkHashMismatch) {
+		t.Fatalf("Expected ErrChunkHashMismatch, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(session.TempDir, "chunk_0")); !os.IsNotExist(err) {
+		t.Error("Expected rejected chunk not to be written")
+	}
+
+	if err := service.UploadChunkWithHash(session.ID, 0, first, strings.ToUpper(sha256Hex(first))); err != nil {
+		t.Fatalf("Expected matching hash to be accepted case-insensitively: %v", err)
+	}
+	if err := service.UploadChunk(session.ID, 1, second); err != nil {
+		t.Fatalf("Expected chunk without hash to be accepted: %v", err)
+	}
+	var records []models.UploadChunkHash
+	db.Where("session_id = ?", session.ID).Order("chunk_index").Find(&records)
+	if len(records) != 2 || records[0].Hash != sha256Hex(first) || records[1].Hash != sha256Hex(second) || records[1].Size != 4 {
+		t.Fatalf("Expected hashes recorded for both chunks, got %+v", records)
+	}
+
+	doc, err := service.CompleteUpload(session.ID)
+	if err != nil {
+		t.Fatalf("CompleteUpload failed: %v", err)
+	}
+	defer os.Remove(doc.FilePath)
+	var remaining int64
+	db.Model(&models.UploadChunkHash{}).Where("session_id = ?", session.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("Expected chunk hashes removed with the session, got %d", remaining)
+	}
+}
+
+func TestCompleteUploadDetectsCorruptedChunk(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+
+	content := []byte("chunk content that gets corrupted on disk")
+	result, err := service.InitUpload("corrupt.txt", int64(len(content)), sha256Hex(content))
+	if err != nil {
+		t.Fatalf("InitUpload failed: %v", err)
+	}
+	session := result.Session
+	defer os.RemoveAll(session.TempDir)
+
+	if err := service.UploadChunkWithHash(session.ID, 0, content, sha256Hex(content)); err != nil {
+		t.Fatalf("UploadChunkWithHash failed: %v", err)
+	}
+	os.WriteFile(filepath.Join(session.TempDir, "chunk_0"), bytes.ToUpper(content), 0644)
+
+	if _, err := service.CompleteUpload(session.ID); !errors.Is(err, ErrChunkHashMismatch) {
+		t.Errorf("Expected ErrChunkHashMismatch for corrupted chunk, got %v", err)
+	}
+}
+
+func TestUploadChunkEnforcesDeclaredSize(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+	service.SetMaxFileSize(2048)
+
+	// 声明1KB却发送更大的分片
+	declared := bytes.Repeat([]byte("a"), 1024)
+	result, err := service.InitUpload("small.txt", int64(len(declared)), sha256Hex(declared))
+	if err != nil {
+		t.Fatalf("InitUpload failed: %v", err)
+	}
+	session := result.Session
+	defer os.RemoveAll(session.TempDir)
+
+	large := bytes.Repeat([]byte("a"), 1024*1024)
+	if err := service.UploadChunk(session.ID, 0, large); !errors.Is(err, ErrFileTooLarge) {
+		t.Fatalf("Expected ErrFileTooLarge for oversized chunk, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(session.TempDir, "chunk_0")); !os.IsNotExist(err) {
+		t.Error("Expected oversized chunk not to be written")
+	}
+	// 超出声明分片数的序号同样拒绝
+	for _, index := range []int{-1, session.TotalChunks} {
+		if err := service.UploadChunk(session.ID, index, declared); !errors.Is(err, ErrChunkOutOfRange) {
+			t.Errorf("Expected ErrChunkOutOfRange for chunk %d, got %v", index, err)
+		}
+	}
+
+	// 绕过分片检查写入磁盘的多余内容在合并后按实际大小拒绝
+	if err := service.UploadChunk(session.ID, 0, declared); err != nil {
+		t.Fatalf("UploadChunk failed: %v", err)
+	}
+	os.WriteFile(filepath.Join(session.TempDir, "chunk_0"), large, 0644)
+	db.Where("session_id = ?", session.ID).Delete(&models.UploadChunkHash{})
+	if _, err := service.CompleteUpload(session.ID); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Expected ErrFileTooLarge for oversized assembled file, got %v", err)
+	}
+	var count int64
+	db.Model(&models.Document{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected no document for rejected upload, got %d", count)
+	}
+}
+
+func TestVerifyAssembledFile(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	hashes := map[int]string{0: sha256Hex(data[:8]), 1: sha256Hex(data[8:16]), 2: sha256Hex(data[16:])}
+
+	fileHash, size, err := verifyAssembledFile(bytes.NewReader(data), 8, hashes)
+	if err != nil || fileHash != sha256Hex(data) || size != int64(len(data)) {
+		t.Errorf("Expected whole-file hash %s and size %d, got %s and %d (%v)", sha256Hex(data), len(data), fileHash, size, err)
+	}
+
+	hashes[1] = sha256Hex([]byte("tampered"))
+	if _, _, err := verifyAssembledFile(bytes.NewReader(data), 8, hashes); !errors.Is(err, ErrChunkHashMismatch) || !strings.Contains(err.Error(), fmt.Sprintf("chunk %d", 1)) {
+		t.Errorf("Expected mismatch reported for chunk 1, got %v", err)
+	}
+}
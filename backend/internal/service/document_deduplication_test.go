@@ -5,9 +5,15 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"ai-knowledge-app/internal/config"
 	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/pkg/logger"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -19,7 +25,7 @@ func setupTestDB() *gorm.DB {
 	}
 
 	// Auto migrate the schema
-	db.AutoMigrate(&models.Document{}, &models.UploadSession{})
+	db.AutoMigrate(&models.Document{}, &models.UploadSession{}, &models.UploadChunkHash{}, &models.ProcessingTask{}, &models.KnowledgeAttachment{})
 	return db
 }
 
@@ -107,6 +113,29 @@ func TestFileDeduplication(t *testing.T) {
 	}
 }
 
+func TestDeduplicationStatsExcludeSoftDeleted(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+
+	shared := models.Document{Name: "a", FileHash: "shared", FileSize: 100, Status: "completed"}
+	copied := models.Document{Name: "b", FileHash: "shared", FileSize: 100, Status: "completed"}
+	deleted := models.Document{Name: "c", FileHash: "deleted", FileSize: 500, Status: "completed"}
+	for _, doc := range []*models.Document{&shared, &copied, &deleted} {
+		db.Create(doc)
+	}
+	db.Delete(&deleted)
+
+	// 已软删除的文档不计入任何统计，节省空间不会变为负数
+	stats, err := service.GetDeduplicationStats()
+	if err != nil {
+		t.Fatalf("Failed to get deduplication stats: %v", err)
+	}
+	if stats["total_documents"].(int64) != 2 || stats["unique_files"].(int64) != 1 ||
+		stats["total_size_bytes"].(int64) != 200 || stats["unique_size_bytes"].(int64) != 100 || stats["space_saved_bytes"].(int64) != 100 {
+		t.Errorf("Expected soft-deleted document to be excluded, got %+v", stats)
+	}
+}
+
 func TestReferenceCountedDeletion(t *testing.T) {
 	db := setupTestDB()
 	service := NewDocumentService(db)
@@ -205,4 +234,359 @@ func TestCheckFileDeduplication(t *testing.T) {
 	if doc.ID != createdDoc.ID {
 		t.Errorf("Expected document ID %d, got %d", createdDoc.ID, doc.ID)
 	}
-}
\ No newline at end of file
+}
+func TestInitUploadDeduplication(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+
+	content := "This is test content for init upload"
+	hash := sha256.New()
+	hash.Write([]byte(content))
+	expectedHash := fmt.Sprintf("%x", hash.Sum(nil))
+	size := int64(len(content))
+
+	// Unknown content requires a chunked upload
+	result, err := service.InitUpload("new.txt", size, expectedHash)
+	if err != nil {
+		t.Fatalf("Failed to init upload: %v", err)
+	}
+	if result.Status != InitUploadRequired || result.Session == nil || result.Document != nil {
+		t.Fatalf("Expected upload_required with a session, got %+v", result)
+	}
+	os.RemoveAll(result.Session.TempDir)
+
+	original, err := service.Upload(createTestFileHeader("original.txt", content))
+	if err != nil {
+		t.Fatalf("Failed to upload file: %v", err)
+	}
+
+	// Known content creates a duplicate reference instead of a session
+	result, err = service.InitUpload("copy.txt", size, expectedHash)
+	if err != nil {
+		t.Fatalf("Expected duplicate init upload to succeed, got %v", err)
+	}
+	if result.Status != InitUploadDuplicate || result.Session != nil || result.Document == nil {
+		t.Fatalf("Expected duplicate with a document, got %+v", result)
+	}
+	if result.Document.ID == original.ID || result.Document.FilePath != original.FilePath || result.Document.OriginalName != "copy.txt" {
+		t.Errorf("Expected a new document referencing the original file, got %+v", result.Document)
+	}
+
+	var sessions int64
+	db.Model(&models.UploadSession{}).Where("file_hash = ?", expectedHash).Count(&sessions)
+	if sessions != 1 {
+		t.Errorf("Expected no session for the duplicate init, got %d sessions", sessions)
+	}
+	var updated models.Document
+	db.First(&updated, original.ID)
+	if updated.RefCount != 2 {
+		t.Errorf("Expected original ref_count 2, got %d", updated.RefCount)
+	}
+}
+
+func TestStorageStatsSnapshots(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&models.StorageStatsSnapshot{})
+	service := NewDocumentService(db)
+
+	// Snapshot on an empty store
+	empty, err := service.RecordStorageSnapshot(0)
+	if err != nil {
+		t.Fatalf("Failed to record empty snapshot: %v", err)
+	}
+	if empty.TotalDocuments != 0 || empty.TotalSize != 0 {
+		t.Errorf("Expected empty snapshot, got %+v", empty)
+	}
+
+	content := "This is test content for storage snapshots"
+	if _, err := service.Upload(createTestFileHeader("snap1.txt", content)); err != nil {
+		t.Fatalf("Failed to upload first file: %v", err)
+	}
+	if _, err := service.Upload(createTestFileHeader("snap2.txt", content)); err != nil {
+		t.Fatalf("Failed to upload second file: %v", err)
+	}
+
+	snapshot, err := service.RecordStorageSnapshot(0)
+	if err != nil {
+		t.Fatalf("Failed to record snapshot: %v", err)
+	}
+	if snapshot.TotalDocuments != 2 || snapshot.UniqueFiles != 1 {
+		t.Errorf("Expected 2 documents and 1 unique file, got %+v", snapshot)
+	}
+	if snapshot.SpaceSaved != int64(len(content)) {
+		t.Errorf("Expected %d bytes saved, got %d", len(content), snapshot.SpaceSaved)
+	}
+
+	// Old samples are pruned by the retention window
+	db.Model(&models.StorageStatsSnapshot{}).Where("id = ?", empty.ID).
+		Update("created_at", time.Now().Add(-48*time.Hour))
+	if _, err := service.RecordStorageSnapshot(24 * time.Hour); err != nil {
+		t.Fatalf("Failed to record snapshot with retention: %v", err)
+	}
+
+	history, err := service.GetStorageStatsHistory(time.Now().Add(-7 * 24 * time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 snapshots after pruning, got %d", len(history))
+	}
+	if history[0].CreatedAt.After(history[1].CreatedAt) {
+		t.Error("Expected history ordered oldest first")
+	}
+}
+
+func TestReferenceCountingWithSoftAndHardDeletes(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+
+	content := "This is test content for mixed soft and hard deletion"
+
+	var docs []*models.Document
+	for _, name := range []string{"mixed1.txt", "mixed2.txt", "mixed3.txt"} {
+		doc, err := service.Upload(createTestFileHeader(name, content))
+		if err != nil {
+			t.Fatalf("Failed to upload %s: %v", name, err)
+		}
+		docs = append(docs, doc)
+	}
+	filePath := docs[0].FilePath
+
+	// Soft delete the first reference; the file is still used by the others
+	if err := service.Delete(docs[0].ID); err != nil {
+		t.Fatalf("Failed to soft delete document: %v", err)
+	}
+	if _, err := os.Stat(filePath); err != nil {
+		t.Fatalf("File should remain after soft delete with live references: %v", err)
+	}
+
+	var softDeleted models.Document
+	if err := db.Unscoped().First(&softDeleted, docs[0].ID).Error; err != nil {
+		t.Fatalf("Soft-deleted record should still exist: %v", err)
+	}
+	if !softDeleted.DeletedAt.Valid {
+		t.Error("Expected deleted_at to be set after soft delete")
+	}
+
+	// Hard delete the second reference; the third one keeps the file alive
+	if err := service.Purge(docs[1].ID); err != nil {
+		t.Fatalf("Failed to purge document: %v", err)
+	}
+	if _, err := os.Stat(filePath); err != nil {
+		t.Fatalf("File should remain while a live reference exists: %v", err)
+	}
+	var count int64
+	db.Unscoped().Model(&models.Document{}).Where("id = ?", docs[1].ID).Count(&count)
+	if count != 0 {
+		t.Error("Purged record should be removed permanently")
+	}
+
+	// The soft-deleted row must not count as a live reference
+	if err := service.Delete(docs[2].ID); err != nil {
+		t.Fatalf("Failed to delete last live document: %v", err)
+	}
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Errorf("File should be removed once no live references remain, stat err: %v", err)
+	}
+
+	// Purging a previously soft-deleted record still works
+	if err := service.Purge(docs[0].ID); err != nil {
+		t.Fatalf("Failed to purge soft-deleted document: %v", err)
+	}
+}
+
+func TestReferenceCountingIgnoresHashCollisionWithDifferentSize(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+
+	doc, err := service.Upload(createTestFileHeader("collision.txt", "content with a colliding hash"))
+	if err != nil {
+		t.Fatalf("Failed to upload file: %v", err)
+	}
+
+	// A record with the same hash but a different size is a different file
+	other := &models.Document{
+		Name:     "other",
+		FilePath: "uploads/other.bin",
+		FileHash: doc.FileHash,
+		FileSize: doc.FileSize + 1,
+		Status:   "completed",
+	}
+	if err := db.Create(other).Error; err != nil {
+		t.Fatalf("Failed to create colliding record: %v", err)
+	}
+
+	if err := service.Delete(doc.ID); err != nil {
+		t.Fatalf("Failed to delete document: %v", err)
+	}
+	if _, err := os.Stat(doc.FilePath); !os.IsNotExist(err) {
+		t.Errorf("File should be removed when only a size-mismatched record shares the hash, stat err: %v", err)
+	}
+}
+
+func TestStrictDeduplication(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	db := setupTestDB()
+	service := NewDocumentService(db)
+	service.SetStrictDeduplication(true)
+
+	content := "strictly deduplicated content"
+	original, err := service.Upload(createTestFileHeader("original.txt", content))
+	if err != nil {
+		t.Fatalf("Failed to upload file: %v", err)
+	}
+	defer os.Remove(original.FilePath)
+
+	// 内容相同时仍然秒传
+	copyDoc, err := service.Upload(createTestFileHeader("copy.txt", content))
+	if err != nil {
+		t.Fatalf("Failed to upload duplicate: %v", err)
+	}
+	if copyDoc.FilePath != original.FilePath {
+		t.Errorf("Expected identical content to reference the original file, got %s", copyDoc.FilePath)
+	}
+
+	// 模拟哈希碰撞：已有文档记录的哈希和大小与上传内容相同，但文件内容不同
+	incoming := "strictly deduplicated CONTENT"
+	collisionPath := filepath.Join(t.TempDir(), "collision.txt")
+	if err := os.WriteFile(collisionPath, []byte("STRICTLY deduplicated content"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	db.Create(&models.Document{Name: "collision", FilePath: collisionPath, FileHash: fmt.Sprintf("%x", sha256.Sum256([]byte(incoming))), FileSize: int64(len(incoming)), Status: "completed"})
+
+	stored, err := service.Upload(createTestFileHeader("new.txt", incoming))
+	if err != nil {
+		t.Fatalf("Expected differing content to be stored separately, got %v", err)
+	}
+	defer os.Remove(stored.FilePath)
+	if stored.FilePath == collisionPath {
+		t.Errorf("Expected a new file instead of a reference, got %+v", stored)
+	}
+
+	// 分片上传只有客户端提供的哈希，严格模式下需要上传分片
+	result, err := service.InitUpload("init.txt", original.FileSize, original.FileHash)
+	if err != nil {
+		t.Fatalf("Failed to init upload: %v", err)
+	}
+	if result.Status != InitUploadRequired {
+		t.Errorf("Expected strict mode to require an upload, got %s", result.Status)
+	}
+	os.RemoveAll(result.Session.TempDir)
+}
+
+func TestCheckFiles(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+
+	older := models.Document{Name: "a", FileHash: "hash-a", FileSize: 10, Status: "completed"}
+	newer := models.Document{Name: "a copy", FileHash: "hash-a", FileSize: 10, Status: "completed"}
+	failed := models.Document{Name: "b", FileHash: "hash-b", FileSize: 20, Status: "failed"}
+	db.Create(&older)
+	db.Create(&newer)
+	db.Create(&failed)
+
+	files := []FileFingerprint{
+		{Hash: "hash-b", Size: 20},
+		{Hash: "hash-a", Size: 10},
+		{Hash: "hash-a", Size: 11},
+		{Hash: "hash-a", Size: 10},
+	}
+	results, err := service.CheckFiles(files)
+	if err != nil {
+		t.Fatalf("CheckFiles failed: %v", err)
+	}
+	if len(results) != len(files) {
+		t.Fatalf("Expected %d results, got %d", len(files), len(results))
+	}
+	for i, want := range []bool{false, true, false, true} {
+		if results[i].FileFingerprint != files[i] || results[i].Exists != want {
+			t.Errorf("Result %d: expected %+v exists=%v, got %+v", i, files[i], want, results[i])
+		}
+	}
+	if *results[1].DocumentID != older.ID || *results[3].DocumentID != older.ID {
+		t.Errorf("Expected the oldest matching document %d, got %d", older.ID, *results[1].DocumentID)
+	}
+}
+
+func TestNearDuplicateDetection(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	db := setupTestDB()
+	db.AutoMigrate(&models.DocumentChunk{})
+	service := NewDocumentService(db)
+	if err := service.SetNearDuplicateMaxDistance(MaxNearDuplicateDistance + 1); err == nil {
+		t.Error("Expected distance above MaxNearDuplicateDistance to be rejected")
+	}
+	if err := service.SetNearDuplicateMaxDistance(3); err != nil {
+		t.Fatalf("SetNearDuplicateMaxDistance failed: %v", err)
+	}
+
+	// 指纹在处理时由清洗后的正文计算，上传时不计算
+	upload := func(name, content string) *models.Document {
+		doc, err := service.Upload(createTestFileHeader(name, content))
+		if err != nil {
+			t.Fatalf("Failed to upload file: %v", err)
+		}
+		t.Cleanup(func() { os.Remove(doc.FilePath) })
+		if doc.ContentFingerprint != "" {
+			t.Fatal("Expected upload not to record a content fingerprint")
+		}
+		if _, err := service.ReprocessDocument(doc.ID); err != nil {
+			t.Fatalf("Failed to process document: %v", err)
+		}
+		var processed models.Document
+		db.First(&processed, doc.ID)
+		return &processed
+	}
+
+	text := "The quarterly report covers revenue growth across all regions. Sales in the north increased by twelve percent, " +
+		"while the south remained flat. Operating costs were reduced through vendor consolidation and the new logistics contract."
+	original := upload("report.txt", text)
+	if original.ContentFingerprint == "" || original.NearDuplicateID != nil {
+		t.Fatalf("Expected processing to record a fingerprint and no near duplicate, got %+v", original)
+	}
+
+	// 重新导出的文件只有少量差异，作为建议记录而不是引用原文件
+	reexported := upload("report-v2.txt", strings.Replace(text, "regions.", "regions;", 1)+"\n")
+	if reexported.FilePath == original.FilePath {
+		t.Error("Expected near duplicate to be stored separately")
+	}
+	if reexported.NearDuplicateID == nil || *reexported.NearDuplicateID != original.ID {
+		t.Errorf("Expected original as near duplicate, got %v", reexported.NearDuplicateID)
+	}
+	match, err := service.FindNearDuplicate(reexported)
+	if err != nil {
+		t.Fatalf("FindNearDuplicate failed: %v", err)
+	}
+	if match == nil || match.DocumentID != original.ID || match.Distance > 3 {
+		t.Errorf("Expected original within 3 bits, got %+v", match)
+	}
+
+	unrelated := upload("recipe.txt", "Whisk two eggs with flour and milk, then let the batter rest for thirty minutes before frying thin pancakes.")
+	if unrelated.NearDuplicateID != nil {
+		t.Errorf("Expected no near duplicate for unrelated text, got %v", *unrelated.NearDuplicateID)
+	}
+
+	// 距离为0时不记录指纹
+	service.SetNearDuplicateMaxDistance(0)
+	plain := upload("plain.txt", text+" Appendix.")
+	if plain.ContentFingerprint != "" || plain.NearDuplicateID != nil {
+		t.Errorf("Expected no fingerprint when detection is disabled, got %q", plain.ContentFingerprint)
+	}
+}
+
+func TestFingerprintBands(t *testing.T) {
+	// 相差不超过3位的指纹至少有一段16位相同
+	hash := uint64(0x0123456789abcdef)
+	near := hash ^ (1 << 3) ^ (1 << 20) ^ (1 << 40)
+	a, b := fingerprintBands(hash), fingerprintBands(near)
+	if a[0] != 0xcdef || a[3] != 0x0123 {
+		t.Fatalf("Unexpected bands %x", a)
+	}
+	if a[3] != b[3] || a[0] == b[0] || a[1] == b[1] || a[2] == b[2] {
+		t.Errorf("Expected only the untouched band to match, got %x and %x", a, b)
+	}
+}
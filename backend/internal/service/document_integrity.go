@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+
+	"ai-knowledge-app/internal/models"
+
+	"github.com/minio/minio-go/v7"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+)
+
+// DefaultIntegrityBatchSize is how many documents are loaded per batch when verifying storage integrity
+const DefaultIntegrityBatchSize = 100
+
+// IntegrityCheckOptions controls a storage integrity audit
+type IntegrityCheckOptions struct {
+	BatchSize int // documents loaded per batch, DefaultIntegrityBatchSize when 0
+	// MaxPerSecond limits how many stored files are read per second so the audit
+	// does not saturate storage; 0 means no limit
+	MaxPerSecond float64
+	// MarkCorrupted sets the status of documents with missing or mismatched files to "corrupted"
+	MarkCorrupted bool
+	// Progress, when set, is called after every checked document
+	Progress JobProgress
+}
+
+// IntegrityIssue is a document whose stored file failed verification
+type IntegrityIssue struct {
+	DocumentID uint   `json:"document_id"`
+	Name       string `json:"name"`
+	FilePath   string `json:"file_path"`
+	Error      string `json:"error"`
+}
+
+// IntegrityReport summarizes a storage integrity audit
+type IntegrityReport struct {
+	Checked    int              `json:"checked"`    // documents checked
+	Objects    int              `json:"objects"`    // distinct stored files read; deduplicated documents share one
+	Missing    []IntegrityIssue `json:"missing"`    // file no longer exists
+	Mismatched []IntegrityIssue `json:"mismatched"` // file exists but its hash differs from the recorded one
+	Failed     []IntegrityIssue `json:"failed"`     // could not be verified, e.g. storage unavailable
+	Marked     int              `json:"marked"`     // documents set to "corrupted"
+	Aborted    bool             `json:"aborted,omitempty"`
+}
+
+// VerifyStorageIntegrity checks the stored file of every document against its recorded hash.
+// Documents are loaded in batches and files sharing a path are read once. When the context
+// is cancelled the partial report is returned with Aborted set.
+func (s *DocumentService) VerifyStorageIntegrity(ctx context.Context, opts IntegrityCheckOptions) (*IntegrityReport, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultIntegrityBatchSize
+	}
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if opts.MaxPerSecond > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.MaxPerSecond), 1)
+	}
+
+	report := &IntegrityReport{Missing: []IntegrityIssue{}, Mismatched: []IntegrityIssue{}, Failed: []IntegrityIssue{}}
+	verified := make(map[string]error)
+
+	var total int64
+	if opts.Progress != nil {
+		if err := s.db.Model(&models.Document{}).Where("file_path <> ''").Count(&total).Error; err != nil {
+			return report, err
+		}
+	}
+
+	var batch []models.Document
+	err := s.db.Model(&models.Document{}).
+		Select("id, name, file_path, file_hash").
+		Where("file_path <> ''").
+		FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+			var corrupted []uint
+			for _, doc := range batch {
+				verifyErr, ok := verified[doc.FilePath]
+				if !ok {
+					if err := limiter.Wait(ctx); err != nil {
+						report.Aborted = true
+						return err
+					}
+					verifyErr = s.verifyObjectIntegrity(ctx, doc.FilePath, doc.FileHash)
+					if ctx.Err() != nil {
+						report.Aborted = true
+						return ctx.Err()
+					}
+					verified[doc.FilePath] = verifyErr
+					report.Objects++
+				}
+				report.Checked++
+				if opts.Progress != nil {
+					opts.Progress(report.Checked, int(total))
+				}
+				if verifyErr == nil {
+					continue
+				}
+
+				issue := IntegrityIssue{DocumentID: doc.ID, Name: doc.Name, FilePath: doc.FilePath, Error: verifyErr.Error()}
+				switch {
+				case isMissingObjectError(verifyErr):
+					report.Missing = append(report.Missing, issue)
+				case errors.Is(verifyErr, ErrObjectHashMismatch):
+					report.Mismatched = append(report.Mismatched, issue)
+				default:
+					report.Failed = append(report.Failed, issue)
+					continue
+				}
+				corrupted = append(corrupted, doc.ID)
+			}
+
+			if opts.MarkCorrupted && len(corrupted) > 0 {
+				result := s.db.Model(&models.Document{}).Where("id IN ?", corrupted).
+					Update("status", models.DocumentStatusCorrupted)
+				if result.Error != nil {
+					return result.Error
+				}
+				report.Marked += int(result.RowsAffected)
+			}
+			return nil
+		}).Error
+	if err != nil && !report.Aborted {
+		return report, err
+	}
+	return report, nil
+}
+
+// isMissingObjectError reports whether a verification error means the stored file does not exist
+func isMissingObjectError(err error) bool {
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	var resp minio.ErrorResponse
+	return errors.As(err, &resp) && (resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound)
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ai-knowledge-app/internal/models"
+)
+
+func TestVerifyStorageIntegrity(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+	dir := t.TempDir()
+
+	writeFile := func(name, content string) (string, string) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path, fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	}
+	goodPath, goodHash := writeFile("good.txt", "intact")
+	badPath, _ := writeFile("bad.txt", "tampered")
+	_, badHash := writeFile("original.txt", "original")
+
+	docs := []*models.Document{
+		{Name: "good", FilePath: goodPath, FileHash: goodHash},
+		{Name: "good copy", FilePath: goodPath, FileHash: goodHash}, // 去重引用同一文件
+		{Name: "bad", FilePath: badPath, FileHash: badHash},
+		{Name: "gone", FilePath: filepath.Join(dir, "gone.txt"), FileHash: goodHash},
+		{Name: "no file"},
+	}
+	for _, doc := range docs {
+		db.Create(doc)
+	}
+
+	report, err := service.VerifyStorageIntegrity(context.Background(), IntegrityCheckOptions{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("VerifyStorageIntegrity failed: %v", err)
+	}
+	if report.Checked != 4 || report.Objects != 3 {
+		t.Errorf("Expected 4 documents and 3 distinct files checked, got %+v", report)
+	}
+	if len(report.Missing) != 1 || report.Missing[0].DocumentID != docs[3].ID {
+		t.Errorf("Expected the deleted file to be reported missing, got %+v", report.Missing)
+	}
+	if len(report.Mismatched) != 1 || report.Mismatched[0].DocumentID != docs[2].ID {
+		t.Errorf("Expected the tampered file to be reported mismatched, got %+v", report.Mismatched)
+	}
+	if len(report.Failed) != 0 || report.Marked != 0 {
+		t.Errorf("Expected no failures and no marking, got %+v", report)
+	}
+
+	// 标记受影响的文档
+	report, err = service.VerifyStorageIntegrity(context.Background(), IntegrityCheckOptions{MarkCorrupted: true, MaxPerSecond: 1000})
+	if err != nil {
+		t.Fatalf("VerifyStorageIntegrity failed: %v", err)
+	}
+	if report.Marked != 2 {
+		t.Errorf("Expected 2 documents marked corrupted, got %d", report.Marked)
+	}
+	for i, want := range []string{"completed", "completed", models.DocumentStatusCorrupted, models.DocumentStatusCorrupted} {
+		var doc models.Document
+		db.First(&doc, docs[i].ID)
+		if doc.Status != want {
+			t.Errorf("Document %q status = %q, want %q", doc.Name, doc.Status, want)
+		}
+	}
+
+	// 请求取消时返回已检查的部分
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err = service.VerifyStorageIntegrity(ctx, IntegrityCheckOptions{MaxPerSecond: 1})
+	if err != nil || !report.Aborted {
+		t.Errorf("Expected an aborted report, got %+v (%v)", report, err)
+	}
+}
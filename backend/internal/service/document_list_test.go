@@ -0,0 +1,80 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/pkg/utils"
+)
+
+func TestListPaginated(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+
+	base := time.Now()
+	docs := []models.Document{
+		{OriginalName: "Report.PDF", FileName: "a.pdf", Extension: ".pdf", FileSize: 100, Status: "completed"},
+		{OriginalName: "notes.md", FileName: "b.md", Extension: ".md", FileSize: 2000, Status: "failed"},
+		{OriginalName: "annual-report.md", FileName: "c.md", Extension: ".MD", FileSize: 5000, Status: "completed"},
+	}
+	for i := range docs {
+		docs[i].CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		db.Create(&docs[i])
+	}
+
+	page := func(pagination utils.PaginationRequest, filter DocumentFilter) ([]models.Document, int64) {
+		t.Helper()
+		if pagination.Page == 0 {
+			pagination.Page = 1
+		}
+		if pagination.PageSize == 0 {
+			pagination.PageSize = 10
+		}
+		resp, err := service.ListPaginated(pagination, filter)
+		if err != nil {
+			t.Fatalf("ListPaginated failed: %v", err)
+		}
+		return resp.Items.([]models.Document), resp.Total
+	}
+
+	// 默认按创建时间倒序
+	items, total := page(utils.PaginationRequest{}, DocumentFilter{})
+	if total != 3 || items[0].ID != docs[2].ID || items[2].ID != docs[0].ID {
+		t.Errorf("Expected newest first, got total %d and %+v", total, items)
+	}
+
+	items, total = page(utils.PaginationRequest{PageSize: 2, Page: 2}, DocumentFilter{})
+	if total != 3 || len(items) != 1 || items[0].ID != docs[0].ID {
+		t.Errorf("Expected last document on page 2, got total %d and %+v", total, items)
+	}
+
+	items, _ = page(utils.PaginationRequest{Sort: "file_size", Order: "asc"}, DocumentFilter{})
+	if items[0].ID != docs[0].ID {
+		t.Errorf("Expected smallest file first, got %+v", items[0])
+	}
+
+	cases := []struct {
+		name   string
+		filter DocumentFilter
+		want   int64
+	}{
+		{"status", DocumentFilter{Status: "completed"}, 2},
+		{"extension without dot", DocumentFilter{Extension: "md"}, 2},
+		{"extension with dot", DocumentFilter{Extension: ".PDF"}, 1},
+		{"size range", DocumentFilter{MinSize: 1000, MaxSize: 3000}, 1},
+		{"search", DocumentFilter{Search: "REPORT"}, 2},
+		{"combined", DocumentFilter{Search: "report", Extension: "md"}, 1},
+	}
+	for _, tc := range cases {
+		if _, total := page(utils.PaginationRequest{}, tc.filter); total != tc.want {
+			t.Errorf("%s: expected %d documents, got %d", tc.name, tc.want, total)
+		}
+	}
+
+	_, err := service.ListPaginated(utils.PaginationRequest{Page: 1, PageSize: 10, Sort: "raw_text"}, DocumentFilter{})
+	if !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("Expected ErrInvalidSort for unknown field, got %v", err)
+	}
+}
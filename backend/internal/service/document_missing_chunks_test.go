@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/models"
+
+	"gorm.io/gorm"
+)
+
+func TestGetMissingChunks(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+
+	result, err := service.InitUpload("resume.bin", 4*1048576, "resume-hash")
+	if err != nil {
+		t.Fatalf("InitUpload failed: %v", err)
+	}
+	session := result.Session
+	defer os.RemoveAll(session.TempDir)
+
+	for _, index := range []int{0, 2} {
+		if err := service.UploadChunk(session.ID, index, make([]byte, 1048576)); err != nil {
+			t.Fatalf("UploadChunk %d failed: %v", index, err)
+		}
+	}
+
+	missing, err := service.GetMissingChunks(session.ID)
+	if err != nil {
+		t.Fatalf("GetMissingChunks failed: %v", err)
+	}
+	if missing.TotalChunks != 4 || !reflect.DeepEqual(missing.MissingChunks, []int{1, 3}) {
+		t.Errorf("Expected chunks [1 3] missing of 4, got %+v", missing)
+	}
+
+	for _, index := range []int{1, 3} {
+		service.UploadChunk(session.ID, index, make([]byte, 1048576))
+	}
+	if missing, _ := service.GetMissingChunks(session.ID); missing == nil || len(missing.MissingChunks) != 0 || missing.MissingChunks == nil {
+		t.Errorf("Expected an empty list once all chunks arrived, got %+v", missing)
+	}
+
+	// 过期会话返回错误而不是空列表
+	db.Model(&models.UploadSession{}).Where("id = ?", session.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	if _, err := service.GetMissingChunks(session.ID); !errors.Is(err, ErrUploadSessionExpired) {
+		t.Errorf("Expected ErrUploadSessionExpired, got %v", err)
+	}
+
+	if _, err := service.GetMissingChunks("unknown"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected ErrRecordNotFound for unknown session, got %v", err)
+	}
+}
+
+func TestCleanupExpiredSessions(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+
+	expiredDir, liveDir := t.TempDir(), t.TempDir()
+	db.Create(&models.UploadSession{ID: "expired", TempDir: expiredDir, ExpiresAt: time.Now().Add(-time.Hour)})
+	db.Create(&models.UploadSession{ID: "live", TempDir: liveDir, ExpiresAt: time.Now().Add(time.Hour)})
+	db.Create(&models.UploadChunkHash{SessionID: "expired", ChunkIndex: 0, Hash: "h"})
+	db.Create(&models.UploadChunkHash{SessionID: "live", ChunkIndex: 0, Hash: "h"})
+
+	reaped, err := service.CleanupExpiredSessions()
+	if err != nil || reaped != 1 {
+		t.Fatalf("Expected 1 session cleaned up, got %d (%v)", reaped, err)
+	}
+	if _, err := os.Stat(expiredDir); !os.IsNotExist(err) {
+		t.Error("Expected temp dir of expired session to be removed")
+	}
+	var sessions []models.UploadSession
+	db.Find(&sessions)
+	var hashes []models.UploadChunkHash
+	db.Find(&hashes)
+	if len(sessions) != 1 || sessions[0].ID != "live" || len(hashes) != 1 || hashes[0].SessionID != "live" {
+		t.Errorf("Expected only the live session and its chunk hash to remain, got %+v, %+v", sessions, hashes)
+	}
+
+	if reaped, err := service.CleanupExpiredSessions(); err != nil || reaped != 0 {
+		t.Errorf("Expected nothing left to clean up, got %d (%v)", reaped, err)
+	}
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/models"
+
+	"github.com/minio/minio-go/v7"
+	miniocreds "github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeBucket 只实现ListObjectsV2和DeleteObject的S3服务
+type fakeBucket struct {
+	mu      sync.Mutex
+	objects map[string]bool
+	deleted []string
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/docs/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		prefix := r.URL.Query().Get("prefix")
+		var keys []string
+		for k := range b.objects {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><Name>docs</Name><Prefix>%s</Prefix><KeyCount>%d</KeyCount><MaxKeys>1000</MaxKeys><IsTruncated>false</IsTruncated>`, prefix, len(keys))
+		for _, k := range keys {
+			fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>1</Size><LastModified>2024-01-01T00:00:00.000Z</LastModified><ETag>"x"</ETag></Contents>`, k)
+		}
+		fmt.Fprint(w, `</ListBucketResult>`)
+	case r.Method == http.MethodDelete:
+		delete(b.objects, key)
+		b.deleted = append(b.deleted, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestCleanupOrphanedObjects(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+
+	if _, err := service.CleanupOrphanedObjects(context.Background(), true); !errors.Is(err, ErrObjectStorageNotConfigured) {
+		t.Fatalf("Expected ErrObjectStorageNotConfigured for local storage, got %v", err)
+	}
+
+	bucket := &fakeBucket{objects: map[string]bool{
+		"documents/kept.pdf":    true,
+		"documents/orphan1.pdf": true,
+		"documents/orphan2.md":  true,
+		"documents/deleted.md":  true,
+	}}
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+
+	endpoint, _ := url.Parse(server.URL)
+	cfg := &config.S3Config{Endpoint: endpoint.Host, AccessKeyID: "test", SecretAccessKey: "test-secret", Bucket: "docs", Region: "us-east-1"}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{Creds: miniocreds.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""), Region: cfg.Region})
+	if err != nil {
+		t.Fatalf("Failed to create MinIO client: %v", err)
+	}
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+	service.SetMinIOClient(&MinIOClient{client: client, config: cfg, retryConfig: DefaultRetryConfig(), logger: logger})
+
+	db.Create(&models.Document{Name: "kept", FilePath: "documents/kept.pdf"})
+	// 软删除的文档不再引用对象
+	deleted := models.Document{Name: "deleted", FilePath: "documents/deleted.md"}
+	db.Create(&deleted)
+	db.Delete(&deleted)
+
+	result, err := service.CleanupOrphanedObjects(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	want := []string{"documents/deleted.md", "documents/orphan1.pdf", "documents/orphan2.md"}
+	if !result.DryRun || result.Scanned != 4 || result.Removed != 0 || fmt.Sprint(result.Orphaned) != fmt.Sprint(want) {
+		t.Errorf("Unexpected dry run result: %+v", result)
+	}
+	if len(bucket.deleted) != 0 {
+		t.Fatalf("Expected dry run to keep objects, deleted %v", bucket.deleted)
+	}
+
+	result, err = service.CleanupOrphanedObjects(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if result.DryRun || result.Removed != 3 {
+		t.Errorf("Expected 3 objects removed, got %+v", result)
+	}
+	if len(bucket.objects) != 1 || !bucket.objects["documents/kept.pdf"] {
+		t.Errorf("Expected only the referenced object to remain, got %v", bucket.objects)
+	}
+}
@@ -0,0 +1,425 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrNoExtractableText is returned for documents that parse but contain no
+// text layer, such as scanned PDFs
+var ErrNoExtractableText = errors.New("document contains no extractable text")
+
+// ErrUnsupportedPDFFont is returned for PDFs whose text uses composite
+// (Type0/CID) fonts. Their strings are glyph IDs that only the font's
+// ToUnicode CMap maps back to characters, and CMaps are not interpreted, so
+// extracting them would chunk and embed garbage.
+var ErrUnsupportedPDFFont = errors.New("pdf uses composite (Type0/CID) fonts, which text extraction does not support")
+
+// extractDOCXText returns the paragraph text of a DOCX (Office Open XML) file.
+// The decompressed document body is limited to maxBytes; 0 disables the limit.
+func extractDOCXText(content []byte, maxBytes int64) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", fmt.Errorf("invalid docx file: %w", err)
+	}
+
+	var body *zip.File
+	for _, f := range archive.File {
+		if f.Name == "word/document.xml" {
+			body = f
+			break
+		}
+	}
+	if body == nil {
+		return "", errors.New("invalid docx file: word/document.xml not found")
+	}
+
+	if maxBytes > 0 && body.UncompressedSize64 > uint64(maxBytes) {
+		return "", fmt.Errorf("docx body is %d bytes uncompressed, exceeding the %d byte processing limit", body.UncompressedSize64, maxBytes)
+	}
+	rc, err := body.Open()
+	if err != nil {
+		return "", fmt.Errorf("invalid docx file: %w", err)
+	}
+	defer rc.Close()
+
+	// The recorded size can be forged, so the limit is enforced while inflating too
+	xmlContent, err := readAllLimited(rc, maxBytes)
+	if err != nil {
+		return "", fmt.Errorf("invalid docx file: %w", err)
+	}
+
+	var text strings.Builder
+	inText := false
+	decoder := xml.NewDecoder(bytes.NewReader(xmlContent))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid docx file: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteString("\t")
+			case "br", "cr":
+				text.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				// Blank line between paragraphs keeps paragraph chunking meaningful
+				text.WriteString("\n\n")
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+
+	return requireText(text.String())
+}
+
+var (
+	pdfStreamPattern  = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+	pdfCIDFontPattern = regexp.MustCompile(`/Subtype\s*/(Type0|CIDFontType[02])\b`)
+	pdfEndStream      = []byte("endstream")
+)
+
+// extractPDFText returns the text drawn by the content streams of a PDF.
+// It handles uncompressed and FlateDecode streams with simple (non-CID) font
+// encodings, which covers most text-based PDFs; scanned PDFs have no text layer
+// and yield ErrNoExtractableText, and PDFs with composite fonts yield
+// ErrUnsupportedPDFFont. Each inflated stream is limited to maxBytes; 0
+// disables the limit.
+func extractPDFText(content []byte, maxBytes int64) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(content, "\x00\t\r\n "), []byte("%PDF-")) {
+		return "", errors.New("invalid pdf file: missing %PDF header")
+	}
+	if pdfCIDFontPattern.Match(content) {
+		return "", ErrUnsupportedPDFFont
+	}
+
+	var text strings.Builder
+	for _, loc := range pdfStreamPattern.FindAllSubmatchIndex(content, -1) {
+		dict := content[loc[2]:loc[3]]
+		start := loc[1]
+		end := bytes.Index(content[start:], pdfEndStream)
+		if end < 0 {
+			break
+		}
+		data := content[start : start+end]
+
+		// Fonts, images and other embedded binaries never carry page text
+		if bytes.Contains(dict, []byte("/Subtype")) || bytes.Contains(dict, []byte("/Length1")) {
+			continue
+		}
+		if bytes.Contains(dict, []byte("/Filter")) {
+			if !bytes.Contains(dict, []byte("/FlateDecode")) {
+				continue
+			}
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				continue
+			}
+			// Tolerate truncated streams as long as some content was inflated
+			decoded, err := readAllLimited(zr, maxBytes)
+			zr.Close()
+			if errors.Is(err, errParseLimit) {
+				return "", fmt.Errorf("invalid pdf file: %w", err)
+			}
+			if err != nil && len(decoded) == 0 {
+				continue
+			}
+			data = decoded
+
+			// Font dictionaries can sit in compressed object streams
+			if pdfCIDFontPattern.Match(data) {
+				return "", ErrUnsupportedPDFFont
+			}
+		}
+
+		text.WriteString(pdfContentText(data))
+	}
+
+	return requireText(text.String())
+}
+
+// pdfContentText collects the strings shown by text operators between BT and ET
+func pdfContentText(data []byte) string {
+	var (
+		text     strings.Builder
+		operands []interface{}
+		inText   bool
+	)
+
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case isPDFWhitespace(c):
+			i++
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, next := readPDFLiteral(data, i)
+			operands = append(operands, s)
+			i = next
+		case c == '<' && i+1 < len(data) && data[i+1] == '<', c == '>' && i+1 < len(data) && data[i+1] == '>':
+			i += 2
+		case c == '<':
+			s, next := readPDFHex(data, i)
+			operands = append(operands, s)
+			i = next
+		case c == '[':
+			operands = append(operands, '[')
+			i++
+		case c == ']':
+			// Collapse the array into a single operand
+			start := len(operands) - 1
+			for start >= 0 && operands[start] != '[' {
+				start--
+			}
+			if start < 0 {
+				i++
+				continue
+			}
+			items := append([]interface{}(nil), operands[start+1:]...)
+			operands = append(operands[:start], items)
+			i++
+		case c == '/':
+			j := i + 1
+			for j < len(data) && !isPDFWhitespace(data[j]) && !isPDFDelimiter(data[j]) {
+				j++
+			}
+			operands = append(operands, string(data[i:j]))
+			i = j
+		default:
+			j := i
+			for j < len(data) && !isPDFWhitespace(data[j]) && !isPDFDelimiter(data[j]) {
+				j++
+			}
+			if j == i {
+				i++
+				continue
+			}
+			word := string(data[i:j])
+			i = j
+
+			if n, err := strconv.ParseFloat(word, 64); err == nil {
+				operands = append(operands, n)
+				continue
+			}
+
+			switch word {
+			case "BT":
+				inText = true
+			case "ET":
+				if inText {
+					text.WriteString("\n")
+				}
+				inText = false
+			case "Tj":
+				if inText {
+					text.WriteString(lastPDFString(operands))
+				}
+			case "'", "\"":
+				if inText {
+					text.WriteString("\n")
+					text.WriteString(lastPDFString(operands))
+				}
+			case "TJ":
+				if inText && len(operands) > 0 {
+					if items, ok := operands[len(operands)-1].([]interface{}); ok {
+						for _, item := range items {
+							switch v := item.(type) {
+							case pdfString:
+								text.WriteString(string(v))
+							case float64:
+								// Large negative kerning separates words
+								if v < -200 {
+									text.WriteString(" ")
+								}
+							}
+						}
+					}
+				}
+			case "T*":
+				if inText {
+					text.WriteString("\n")
+				}
+			case "Td", "TD":
+				if inText && len(operands) >= 2 {
+					if ty, ok := operands[len(operands)-1].(float64); ok && ty != 0 {
+						text.WriteString("\n")
+					} else {
+						text.WriteString(" ")
+					}
+				}
+			}
+			operands = operands[:0]
+		}
+	}
+
+	return text.String()
+}
+
+// pdfString is a decoded PDF string operand
+type pdfString string
+
+func lastPDFString(operands []interface{}) string {
+	if len(operands) == 0 {
+		return ""
+	}
+	s, _ := operands[len(operands)-1].(pdfString)
+	return string(s)
+}
+
+// readPDFLiteral decodes a (...) string starting at data[start]
+func readPDFLiteral(data []byte, start int) (pdfString, int) {
+	var out []byte
+	depth := 0
+	i := start
+	for ; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return decodePDFBytes(out), i + 1
+			}
+		case '\\':
+			i++
+			if i >= len(data) {
+				break
+			}
+			switch e := data[i]; e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r', '\n':
+				// Line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					j := i
+					for j < len(data) && j < i+3 && data[j] >= '0' && data[j] <= '7' {
+						j++
+					}
+					n, _ := strconv.ParseUint(string(data[i:j]), 8, 8)
+					out = append(out, byte(n))
+					i = j - 1
+				} else {
+					out = append(out, e)
+				}
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return decodePDFBytes(out), i
+}
+
+// readPDFHex decodes a <...> string starting at data[start]
+func readPDFHex(data []byte, start int) (pdfString, int) {
+	end := bytes.IndexByte(data[start:], '>')
+	if end < 0 {
+		return "", len(data)
+	}
+	var digits []byte
+	for _, c := range data[start+1 : start+end] {
+		if !isPDFWhitespace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, 0, len(digits)/2)
+	for i := 0; i+1 < len(digits); i += 2 {
+		n, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			return "", start + end + 1
+		}
+		out = append(out, byte(n))
+	}
+	return decodePDFBytes(out), start + end + 1
+}
+
+// decodePDFBytes decodes UTF-16BE strings (with BOM) and treats anything else
+// as Latin-1, which matches PDFDocEncoding for printable text
+func decodePDFBytes(b []byte) pdfString {
+	if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+		units := make([]uint16, 0, (len(b)-2)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return pdfString(utf16.Decode(units))
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return pdfString(runes)
+}
+
+func isPDFWhitespace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// errParseLimit is returned by readAllLimited for content above the limit
+var errParseLimit = errors.New("content exceeds the processing limit")
+
+// readAllLimited reads r to the end, failing with errParseLimit once more than
+// limit bytes are read; 0 disables the limit
+func readAllLimited(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	content, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("%w of %d bytes", errParseLimit, limit)
+	}
+	return content, err
+}
+
+func requireText(text string) (string, error) {
+	if strings.TrimSpace(text) == "" {
+		return "", ErrNoExtractableText
+	}
+	return text, nil
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"ai-knowledge-app/internal/models"
+)
+
+// buildDOCX 生成只包含正文的最小DOCX文件
+func buildDOCX(t *testing.T, documentXML string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("word/document.xml")
+	if err != nil {
+		t.Fatalf("Failed to create docx entry: %v", err)
+	}
+	f.Write([]byte(documentXML))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to write docx: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// buildPDF 生成包含给定内容流的最小PDF文件，compress为true时使用FlateDecode
+func buildPDF(t *testing.T, contents string, compress bool) []byte {
+	t.Helper()
+	stream := []byte(contents)
+	filter := ""
+	if compress {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(stream)
+		zw.Close()
+		stream = buf.Bytes()
+		filter = " /Filter /FlateDecode"
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	pdf.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	pdf.WriteString("2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n")
+	pdf.WriteString("3 0 obj\n<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>\nendobj\n")
+	fmt.Fprintf(&pdf, "4 0 obj\n<< /Length %d%s >>\nstream\n", len(stream), filter)
+	pdf.Write(stream)
+	pdf.WriteString("\nendstream\nendobj\n")
+	// 字体等嵌入的二进制流不应被当作文本
+	pdf.WriteString("5 0 obj\n<< /Length 12 /Subtype /Type1C >>\nstream\nBT (font) Tj ET\nendstream\nendobj\n")
+	pdf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+func TestExtractDOCXText(t *testing.T) {
+	content := buildDOCX(t, `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+  <w:body>
+    <w:p><w:r><w:t>Hello</w:t></w:r><w:r><w:t xml:space="preserve"> world</w:t></w:r></w:p>
+    <w:p><w:r><w:t>第二段</w:t><w:tab/><w:t>&amp; more</w:t></w:r></w:p>
+  </w:body>
+</w:document>`)
+
+	text, err := extractDOCXText(content, 0)
+	if err != nil {
+		t.Fatalf("extractDOCXText failed: %v", err)
+	}
+	if text != "Hello world\n\n第二段\t& more\n\n" {
+		t.Errorf("Unexpected docx text: %q", text)
+	}
+}
+
+func TestExtractDOCXTextErrors(t *testing.T) {
+	if _, err := extractDOCXText([]byte("not a zip"), 0); err == nil {
+		t.Error("Expected error for non-zip content")
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	w.Create("other.xml")
+	w.Close()
+	if _, err := extractDOCXText(buf.Bytes(), 0); err == nil || !strings.Contains(err.Error(), "word/document.xml") {
+		t.Errorf("Expected missing document.xml error, got %v", err)
+	}
+
+	empty := buildDOCX(t, `<w:document xmlns:w="x"><w:body><w:p/></w:body></w:document>`)
+	if _, err := extractDOCXText(empty, 0); !errors.Is(err, ErrNoExtractableText) {
+		t.Errorf("Expected ErrNoExtractableText, got %v", err)
+	}
+
+	// 解压后的正文超过解析上限
+	large := buildDOCX(t, `<w:document xmlns:w="x"><w:body><w:p><w:r><w:t>`+strings.Repeat("a", 4096)+`</w:t></w:r></w:p></w:body></w:document>`)
+	if _, err := extractDOCXText(large, 1024); err == nil || !strings.Contains(err.Error(), "processing limit") {
+		t.Errorf("Expected processing limit error, got %v", err)
+	}
+}
+
+func TestExtractPDFText(t *testing.T) {
+	contents := "BT /F1 12 Tf 72 720 Td (Hello \\(PDF\\) world) Tj 0 -14 Td [(Ker) -20 (ned) -300 (words)] TJ T* <FEFF00E9> Tj ET"
+
+	for _, compress := range []bool{false, true} {
+		text, err := extractPDFText(buildPDF(t, contents, compress), 0)
+		if err != nil {
+			t.Fatalf("extractPDFText(compress=%v) failed: %v", compress, err)
+		}
+		if strings.Contains(text, "font") {
+			t.Errorf("Expected embedded font stream to be skipped, got %q", text)
+		}
+		want := "Hello (PDF) world\nKerned words\né"
+		if strings.TrimSpace(text) != want {
+			t.Errorf("compress=%v: expected %q, got %q", compress, want, text)
+		}
+	}
+}
+
+func TestExtractPDFTextErrors(t *testing.T) {
+	if _, err := extractPDFText([]byte("plain text"), 0); err == nil {
+		t.Error("Expected error for content without PDF header")
+	}
+
+	// 扫描件没有文本层
+	scanned := buildPDF(t, "q 612 0 0 792 0 0 cm /Im0 Do Q", false)
+	if _, err := extractPDFText(scanned, 0); !errors.Is(err, ErrNoExtractableText) {
+		t.Errorf("Expected ErrNoExtractableText, got %v", err)
+	}
+
+	// 复合字体（Type0/CID）的字符串是字形ID，无法直接解码
+	font := "<< /Type /Font /Subtype /Type0 /BaseFont /SimSun /Encoding /Identity-H >>"
+	cid := bytes.Replace(buildPDF(t, "BT <0F2A0E11> Tj ET", false), []byte("trailer"), []byte("6 0 obj\n"+font+"\nendobj\ntrailer"), 1)
+	if _, err := extractPDFText(cid, 0); !errors.Is(err, ErrUnsupportedPDFFont) {
+		t.Errorf("Expected ErrUnsupportedPDFFont, got %v", err)
+	}
+	var objStm bytes.Buffer
+	zw := zlib.NewWriter(&objStm)
+	zw.Write([]byte("6 0 " + font))
+	zw.Close()
+	compressed := bytes.Replace(buildPDF(t, "BT <0F2A0E11> Tj ET", false), []byte("trailer"),
+		[]byte(fmt.Sprintf("7 0 obj\n<< /Type /ObjStm /N 1 /First 4 /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream\nendobj\ntrailer", objStm.Len(), objStm.Bytes())), 1)
+	if _, err := extractPDFText(compressed, 0); !errors.Is(err, ErrUnsupportedPDFFont) {
+		t.Errorf("Expected ErrUnsupportedPDFFont for font in object stream, got %v", err)
+	}
+
+	// 解压后的内容流超过解析上限
+	if _, err := extractPDFText(buildPDF(t, "BT ("+strings.Repeat("a", 4096)+") Tj ET", true), 1024); err == nil || !strings.Contains(err.Error(), "processing limit") {
+		t.Errorf("Expected processing limit error, got %v", err)
+	}
+}
+
+func TestProcessDocumentParsesPDFAndDOCX(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&models.DocumentChunk{})
+
+	processor := NewDocumentProcessor(db)
+	processor.SetObjectReader(memoryObjects{
+		"documents/a.pdf":  string(buildPDF(t, "BT (Quarterly report) Tj ET", true)),
+		"documents/b.docx": string(buildDOCX(t, `<w:document xmlns:w="x"><w:body><w:p><w:r><w:t>Meeting notes</w:t></w:r></w:p></w:body></w:document>`)),
+	})
+
+	docs := []models.Document{
+		{Name: "a", Extension: ".pdf", FilePath: "documents/a.pdf"},
+		{Name: "b", Extension: ".docx", FilePath: "documents/b.docx"},
+	}
+	wants := []string{"Quarterly report", "Meeting notes"}
+	for i := range docs {
+		db.Create(&docs[i])
+		if err := processor.ProcessDocument(docs[i].ID); err != nil {
+			t.Fatalf("%s: ProcessDocument failed: %v", docs[i].Name, err)
+		}
+		stored, _ := processor.GetDocument(docs[i].ID)
+		if stored.CleanedText != wants[i] || stored.ChunkCount != 1 {
+			t.Errorf("%s: expected cleaned text %q in one chunk, got %q (%d chunks)", docs[i].Name, wants[i], stored.CleanedText, stored.ChunkCount)
+		}
+	}
+}
+
+func TestProcessDocumentRespectsSizeLimit(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&models.DocumentChunk{})
+
+	processor := NewDocumentProcessor(db)
+	processor.SetMaxParseBytes(10)
+	processor.SetObjectReader(memoryObjects{"documents/big.txt": strings.Repeat("a", 20)})
+
+	// 记录的大小超限时不读取文件
+	recorded := models.Document{Name: "recorded", Extension: ".txt", FilePath: "documents/big.txt", FileSize: 20}
+	// 未记录大小时读取过程中截断
+	unrecorded := models.Document{Name: "unrecorded", Extension: ".txt", FilePath: "documents/big.txt"}
+	for _, doc := range []*models.Document{&recorded, &unrecorded} {
+		db.Create(doc)
+		err := processor.ProcessDocument(doc.ID)
+		if err == nil || !strings.Contains(err.Error(), "processing limit") {
+			t.Errorf("%s: expected size limit error, got %v", doc.Name, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/models"
+
+	"github.com/minio/minio-go/v7"
+	miniocreds "github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/sirupsen/logrus"
+)
+
+func TestPresignDownload(t *testing.T) {
+	service := NewDocumentService(setupTestDB())
+	doc := &models.Document{FilePath: "documents/report.pdf", OriginalName: "季度 报告.pdf", MimeType: "application/pdf"}
+
+	if _, err := service.PresignDownload(doc); !errors.Is(err, ErrPresignNotSupported) {
+		t.Fatalf("Expected ErrPresignNotSupported for local storage, got %v", err)
+	}
+
+	// 指定region时预签名在本地计算，不需要连接MinIO
+	cfg := &config.S3Config{Endpoint: "localhost:9000", AccessKeyID: "test", SecretAccessKey: "test-secret", Bucket: "docs", Region: "us-east-1"}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{Creds: miniocreds.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""), Region: cfg.Region})
+	if err != nil {
+		t.Fatalf("Failed to create MinIO client: %v", err)
+	}
+	service.SetMinIOClient(&MinIOClient{client: client, config: cfg, retryConfig: DefaultRetryConfig(), logger: logrus.New()})
+	service.SetPresignExpiry(5 * time.Minute)
+
+	before := time.Now()
+	presigned, err := service.PresignDownload(doc)
+	if err != nil {
+		t.Fatalf("PresignDownload failed: %v", err)
+	}
+	parsed, err := url.Parse(presigned.URL)
+	if err != nil {
+		t.Fatalf("Invalid presigned URL %q: %v", presigned.URL, err)
+	}
+	query := parsed.Query()
+	if parsed.Path != "/docs/documents/report.pdf" || query.Get("X-Amz-Expires") != "300" || query.Get("X-Amz-Signature") == "" {
+		t.Errorf("Expected signed URL for the object valid for 300s, got %s", presigned.URL)
+	}
+	if disposition := query.Get("response-content-disposition"); !strings.HasPrefix(disposition, "attachment;") || !strings.Contains(disposition, "filename*=utf-8''") {
+		t.Errorf("Expected attachment disposition with encoded file name, got %q", disposition)
+	}
+	if query.Get("response-content-type") != "application/pdf" {
+		t.Errorf("Expected content type override, got %q", query.Get("response-content-type"))
+	}
+	if presigned.ExpiresAt.Before(before.Add(5*time.Minute)) || presigned.ExpiresAt.After(time.Now().Add(5*time.Minute)) {
+		t.Errorf("Expected expires_at about 5 minutes from now, got %v", presigned.ExpiresAt)
+	}
+}
@@ -1,20 +1,140 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
 	"strings"
+	"unicode/utf8"
 	"gorm.io/gorm"
 	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/pkg/logger"
 )
 
+// ObjectReader reads stored document content; DocumentService implements it
+// for both MinIO and local storage
+type ObjectReader interface {
+	GetObject(filePath string) (io.ReadCloser, error)
+}
+
+// DefaultMaxParseBytes caps how much of a file is read for text extraction
+const DefaultMaxParseBytes int64 = 50 * 1024 * 1024
+
+// DefaultChunkSaveBatchSize is how many chunks are inserted per statement;
+// chunking progress is reported after each batch
+const DefaultChunkSaveBatchSize = 100
+
+// maxBindParameters is the most bind parameters a single statement may use per
+// driver. SQLite builds before 3.32 allow only 999, so that is used for sqlite.
+var maxBindParameters = map[string]int{
+	"sqlite":   999,
+	"postgres": 65535,
+	"mysql":    65535,
+}
+
+// maxInsertBatchSize returns the most rows of model one INSERT can carry
+// without exceeding the driver's bind parameter limit; 0 means no known limit
+func maxInsertBatchSize(db *gorm.DB, model interface{}) int {
+	limit, ok := maxBindParameters[db.Dialector.Name()]
+	if !ok {
+		return 0
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil || len(stmt.Schema.DBNames) == 0 {
+		return 0
+	}
+	return max(limit/len(stmt.Schema.DBNames), 1)
+}
+
+// ProgressFunc receives pipeline progress: the stage being run, the percent of
+// that stage done and the number of chunks saved so far
+type ProgressFunc func(status models.ProcessingStatus, stagePercent, chunkCount int)
+
 type DocumentProcessor struct {
-	db *gorm.DB
+	db            *gorm.DB
+	objects       ObjectReader
+	maxParseBytes int64
+	chunking      ChunkingOptions
+	progress      ProgressFunc
+	saveBatchSize int
+	metadata      ChunkMetadataSchema
+	fingerprint   bool
 }
 
 func NewDocumentProcessor(db *gorm.DB) *DocumentProcessor {
-	return &DocumentProcessor{db: db}
+	return &DocumentProcessor{
+		db:            db,
+		maxParseBytes: DefaultMaxParseBytes,
+		chunking:      DefaultChunkingOptions(),
+		saveBatchSize: DefaultChunkSaveBatchSize,
+	}
+}
+
+// SetChunkingOptions sets the options ProcessDocument chunks with; zero values
+// fall back to DefaultChunkingOptions
+func (dp *DocumentProcessor) SetChunkingOptions(opts ChunkingOptions) error {
+	opts = opts.withDefaults()
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	dp.chunking = opts
+	return nil
+}
+
+// SetMaxParseBytes sets the largest file the processor will parse; 0 disables the limit
+func (dp *DocumentProcessor) SetMaxParseBytes(limit int64) {
+	dp.maxParseBytes = limit
+}
+
+// SetChunkSaveBatchSize sets how many chunks are inserted per statement; values
+// below 1 fall back to DefaultChunkSaveBatchSize
+func (dp *DocumentProcessor) SetChunkSaveBatchSize(size int) {
+	if size < 1 {
+		size = DefaultChunkSaveBatchSize
+	}
+	dp.saveBatchSize = size
+}
+
+// chunkSaveBatchSize returns the configured batch size capped to what the
+// database driver accepts in one statement
+func (dp *DocumentProcessor) chunkSaveBatchSize() int {
+	size := dp.saveBatchSize
+	if limit := maxInsertBatchSize(dp.db, &models.DocumentChunk{}); limit > 0 && size > limit {
+		size = limit
+	}
+	return size
+}
+
+// SetChunkMetadataSchema sets the schema chunk metadata is validated against
+// before chunks are saved
+func (dp *DocumentProcessor) SetChunkMetadataSchema(schema ChunkMetadataSchema) {
+	dp.metadata = schema
+}
+
+// SetContentFingerprinting makes the clean stage record the SimHash of the
+// cleaned text used for near-duplicate detection
+func (dp *DocumentProcessor) SetContentFingerprinting(enabled bool) {
+	dp.fingerprint = enabled
+}
+
+// SetProgressFunc sets a callback invoked as the pipeline advances
+func (dp *DocumentProcessor) SetProgressFunc(fn ProgressFunc) {
+	dp.progress = fn
+}
+
+func (dp *DocumentProcessor) reportProgress(status models.ProcessingStatus, stagePercent, chunkCount int) {
+	if dp.progress != nil {
+		dp.progress(status, stagePercent, chunkCount)
+	}
+}
+
+// SetObjectReader makes the processor read uploaded files through storage
+// instead of the local filesystem
+func (dp *DocumentProcessor) SetObjectReader(objects ObjectReader) {
+	dp.objects = objects
 }
 
 func (dp *DocumentProcessor) CreateDocument(doc *models.Document) error {
@@ -34,104 +154,337 @@ func (dp *DocumentProcessor) GetDocumentChunks(docID uint) ([]models.DocumentChu
 }
 
 func (dp *DocumentProcessor) ProcessDocument(docID uint) error {
-	var doc models.Document
-	if err := dp.db.First(&doc, docID).Error; err != nil {
-		return err
-	}
+	return dp.ProcessDocumentWithOptions(docID, dp.chunking)
+}
+
+// ProcessDocumentWithOptions parses, cleans and chunks a document using the given chunking options
+func (dp *DocumentProcessor) ProcessDocumentWithOptions(docID uint, opts ChunkingOptions) error {
+	return dp.ProcessDocumentContext(context.Background(), docID, opts)
+}
 
-	if err := dp.parseDocument(&doc); err != nil {
-		doc.Status = "failed"
-		doc.Error = err.Error()
-		dp.db.Save(&doc)
+// ProcessDocumentContext is ProcessDocumentWithOptions that stops when ctx is
+// done. The context is checked between stages and before old chunks are
+// replaced, so a stopped run keeps the previous chunks. When the cause is
+// errTaskCancelled (CancelTask) the document is marked cancelled and the
+// returned error wraps that cause; a timeout or shutdown marks it failed like
+// any other error, so it can be retried.
+func (dp *DocumentProcessor) ProcessDocumentContext(ctx context.Context, docID uint, opts ChunkingOptions) error {
+	chunker, err := NewTextChunker(opts)
+	if err != nil {
 		return err
 	}
 
-	if err := dp.cleanText(&doc); err != nil {
-		doc.Status = "failed"
-		doc.Error = err.Error()
-		dp.db.Save(&doc)
+	var doc models.Document
+	if err := dp.db.First(&doc, docID).Error; err != nil {
 		return err
 	}
 
-	if err := dp.chunkText(&doc); err != nil {
-		doc.Status = "failed"
-		doc.Error = err.Error()
-		dp.db.Save(&doc)
-		return err
+	stages := []func(*models.Document) error{
+		dp.parseDocument,
+		dp.cleanText,
+		func(doc *models.Document) error { return dp.chunkText(ctx, doc, chunker) },
+	}
+	for _, stage := range stages {
+		err := ctx.Err()
+		if err == nil {
+			err = stage(&doc)
+		}
+		if err != nil {
+			if cause := context.Cause(ctx); errors.Is(cause, errTaskCancelled) {
+				return dp.cancel(&doc, cause)
+			}
+			doc.Status = "failed"
+			doc.Error = err.Error()
+			dp.db.Save(&doc)
+			return err
+		}
 	}
 
 	doc.Status = "completed"
+	doc.Markdown = renderMarkdown(&doc)
 	return dp.db.Save(&doc).Error
 }
 
+// cancel marks a document whose processing was cancelled
+func (dp *DocumentProcessor) cancel(doc *models.Document, cause error) error {
+	doc.Status = string(models.StatusCancelled)
+	doc.Error = ""
+	dp.db.Save(doc)
+	return fmt.Errorf("processing cancelled: %w", cause)
+}
+
 func (dp *DocumentProcessor) parseDocument(doc *models.Document) error {
 	doc.Status = "parsing"
 	dp.db.Save(doc)
+	dp.reportProgress(models.StatusParsing, 0, 0)
 
-	content, err := os.ReadFile(doc.FilePath)
+	text, err := dp.extractText(doc)
 	if err != nil {
 		return err
 	}
+	doc.RawText = text
+	return dp.db.Save(doc).Error
+}
 
-	switch strings.ToLower(doc.FileType) {
-	case "txt", "html":
-		doc.RawText = string(content)
-	default:
-		return fmt.Errorf("unsupported file type: %s", doc.FileType)
+// extractText reads a document's stored file and extracts its text
+func (dp *DocumentProcessor) extractText(doc *models.Document) (string, error) {
+	fileType := documentFileType(doc)
+	extract, ok := textExtractors[fileType]
+	if !ok {
+		return "", fmt.Errorf("unsupported file type %q: only txt, md, markdown, html, pdf and docx documents can be processed", fileType)
+	}
+	if dp.maxParseBytes > 0 && doc.FileSize > dp.maxParseBytes {
+		return "", fmt.Errorf("document is %d bytes, exceeding the %d byte processing limit", doc.FileSize, dp.maxParseBytes)
 	}
 
-	return dp.db.Save(doc).Error
+	content, err := dp.readContent(doc.FilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read document content: %w", err)
+	}
+
+	text, err := extract(content, dp.maxParseBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s document: %w", fileType, err)
+	}
+	return text, nil
+}
+
+// textExtractors maps supported file types to their text extraction; the
+// limit bounds decompressed content, 0 disabling it
+var textExtractors = map[string]func(content []byte, maxBytes int64) (string, error){
+	"txt":      plainText,
+	"html":     plainText,
+	"md":       plainText,
+	"markdown": plainText,
+	"pdf":      extractPDFText,
+	"docx":     extractDOCXText,
+}
+
+func plainText(content []byte, _ int64) (string, error) {
+	return string(content), nil
+}
+
+// readContent reads a stored file, falling back to the local filesystem when
+// no object reader is configured
+func (dp *DocumentProcessor) readContent(filePath string) ([]byte, error) {
+	var reader io.ReadCloser
+	if dp.objects == nil {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return nil, err
+		}
+		reader = file
+	} else {
+		object, err := dp.objects.GetObject(filePath)
+		if err != nil {
+			return nil, err
+		}
+		reader = object
+	}
+	defer reader.Close()
+
+	// FileSize may be stale or unset, so the limit is enforced while reading too
+	content, err := readAllLimited(reader, dp.maxParseBytes)
+	if errors.Is(err, errParseLimit) {
+		return nil, fmt.Errorf("document exceeds the %d byte processing limit", dp.maxParseBytes)
+	}
+	return content, err
+}
+
+// documentFileType returns the lower-cased file type, derived from the
+// extension for uploads that only record Extension
+func documentFileType(doc *models.Document) string {
+	fileType := doc.FileType
+	if fileType == "" {
+		fileType = doc.Extension
+	}
+	return strings.ToLower(strings.TrimPrefix(fileType, "."))
 }
 
 func (dp *DocumentProcessor) cleanText(doc *models.Document) error {
 	doc.Status = "cleaning"
 	dp.db.Save(doc)
+	dp.reportProgress(models.StatusCleaning, 0, 0)
 
-	text := doc.RawText
-	
+	doc.CleanedText = cleanDocumentText(doc.RawText)
+	if dp.fingerprint {
+		setContentFingerprint(doc)
+	}
+	return dp.db.Save(doc).Error
+}
+
+var (
+	htmlTagPattern     = regexp.MustCompile(`<[^>]*>`)
+	pageMarkerPattern  = regexp.MustCompile(`(?i)(第\s*\d+\s*页|page\s*\d+)`)
+	inlineSpacePattern = regexp.MustCompile(`[^\S\n]+`)
+	blankLinesPattern  = regexp.MustCompile(`\s*\n\s*\n\s*`)
+	// Symbols, control and private-use characters are dropped; letters, marks,
+	// numbers and punctuation are kept in every script
+	disallowedCharPattern = regexp.MustCompile(`[^\p{L}\p{M}\p{N}\p{P}\s]`)
+)
+
+// cleanDocumentText strips markup, page markers and stray symbols from extracted text
+func cleanDocumentText(text string) string {
 	// 去除HTML标签
-	text = regexp.MustCompile(`<[^>]*>`).ReplaceAllString(text, "")
+	text = htmlTagPattern.ReplaceAllString(text, "")
 	// 去除页眉页脚
-	text = regexp.MustCompile(`(?i)(第\s*\d+\s*页|page\s*\d+)`).ReplaceAllString(text, "")
-	// 去除多余空白
-	text = regexp.MustCompile(`\s+`).ReplaceAllString(text, " ")
+	text = pageMarkerPattern.ReplaceAllString(text, "")
 	// 去除特殊符号
-	text = regexp.MustCompile(`[^\w\s\u4e00-\u9fff.,!?;:()""''【】（）。，！？；：]`).ReplaceAllString(text, "")
-	
-	doc.CleanedText = strings.TrimSpace(text)
-	return dp.db.Save(doc).Error
+	text = disallowedCharPattern.ReplaceAllString(text, "")
+	// 去除多余空白（保留段落分隔，供按段落分块使用）
+	text = inlineSpacePattern.ReplaceAllString(text, " ")
+	text = blankLinesPattern.ReplaceAllString(text, "\n\n")
+
+	return strings.TrimSpace(text)
 }
 
-func (dp *DocumentProcessor) chunkText(doc *models.Document) error {
+func (dp *DocumentProcessor) chunkText(ctx context.Context, doc *models.Document, chunker TextChunker) error {
 	doc.Status = "chunking"
 	dp.db.Save(doc)
+	dp.reportProgress(models.StatusChunking, 0, 0)
+
+	chunks, err := dp.buildChunks(doc, chunker)
+	if err != nil {
+		return err
+	}
+
+	// Last point to stop before the previous chunks are replaced
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := dp.saveChunks(dp.db, doc.ID, chunks); err != nil {
+		return err
+	}
+
+	doc.ChunkCount = len(chunks)
+	return dp.db.Save(doc).Error
+}
 
+// buildChunks splits a cleaned document into chunks and validates their metadata
+func (dp *DocumentProcessor) buildChunks(doc *models.Document, chunker TextChunker) ([]models.DocumentChunk, error) {
+	// Cleaning strips markdown syntax, so heading-aware chunking works on the raw text
 	text := doc.CleanedText
-	chunkSize := 500
-	overlap := 50
+	if chunker.Strategy() == ChunkingMarkdown {
+		text = doc.RawText
+	}
 
 	var chunks []models.DocumentChunk
-	for i := 0; i < len(text); i += chunkSize - overlap {
-		end := i + chunkSize
-		if end > len(text) {
-			end = len(text)
+	if spanChunker, ok := chunker.(SpanChunker); ok {
+		for _, span := range spanChunker.ChunkSpans(text) {
+			start, end := span.StartOffset, span.EndOffset
+			chunks = append(chunks, models.DocumentChunk{
+				DocumentID:  doc.ID,
+				ChunkIndex:  len(chunks),
+				Content:     span.Text,
+				Strategy:    string(chunker.Strategy()),
+				StartOffset: &start,
+				EndOffset:   &end,
+				Metadata:    chunkMetadata(doc, span.Text),
+			})
 		}
-		
-		chunks = append(chunks, models.DocumentChunk{
-			DocumentID: doc.ID,
-			ChunkIndex: len(chunks),
-			Content:    text[i:end],
-		})
-		
-		if end == len(text) {
-			break
+	} else {
+		for _, content := range chunker.Chunk(text) {
+			chunks = append(chunks, models.DocumentChunk{
+				DocumentID: doc.ID,
+				ChunkIndex: len(chunks),
+				Content:    content,
+				Strategy:   string(chunker.Strategy()),
+				Metadata:   chunkMetadata(doc, content),
+			})
 		}
 	}
+	if err := dp.checkChunkMetadata(doc, chunks); err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
 
-	if err := dp.db.Create(&chunks).Error; err != nil {
+// saveChunks replaces a document's chunks from a previous run with chunks,
+// inserting them in batches through db (the processor's database or a transaction)
+func (dp *DocumentProcessor) saveChunks(db *gorm.DB, docID uint, chunks []models.DocumentChunk) error {
+	if err := db.Where("document_id = ?", docID).Delete(&models.DocumentChunk{}).Error; err != nil {
 		return err
 	}
+	batchSize := dp.chunkSaveBatchSize()
+	for start := 0; start < len(chunks); start += batchSize {
+		batch := chunks[start:min(start+batchSize, len(chunks))]
+		if err := db.Create(&batch).Error; err != nil {
+			return err
+		}
+		saved := start + len(batch)
+		dp.reportProgress(models.StatusChunking, saved*100/len(chunks), saved)
+	}
+	return nil
+}
+
+// prepareChunks runs the parse, clean and chunk stages in memory, filling the
+// document's text fields and returning its new chunks without writing anything
+// to the database; progress is reported as the stages run
+func (dp *DocumentProcessor) prepareChunks(doc *models.Document, opts ChunkingOptions) ([]models.DocumentChunk, error) {
+	chunker, err := NewTextChunker(opts)
+	if err != nil {
+		return nil, err
+	}
 
+	dp.reportProgress(models.StatusParsing, 0, 0)
+	text, err := dp.extractText(doc)
+	if err != nil {
+		return nil, err
+	}
+	doc.RawText = text
+
+	dp.reportProgress(models.StatusCleaning, 0, 0)
+	doc.CleanedText = cleanDocumentText(doc.RawText)
+	if dp.fingerprint {
+		setContentFingerprint(doc)
+	}
+
+	dp.reportProgress(models.StatusChunking, 0, 0)
+	chunks, err := dp.buildChunks(doc, chunker)
+	if err != nil {
+		return nil, err
+	}
 	doc.ChunkCount = len(chunks)
-	return dp.db.Save(doc).Error
+	doc.Markdown = renderMarkdown(doc)
+	return chunks, nil
+}
+
+// chunkMetadata returns the metadata recorded for every processed chunk
+func chunkMetadata(doc *models.Document, content string) map[string]interface{} {
+	return map[string]interface{}{
+		"document_name": doc.Name,
+		"file_type":     documentFileType(doc),
+		"char_count":    utf8.RuneCountInString(content),
+	}
+}
+
+// checkChunkMetadata validates chunk metadata against the schema. A rejecting
+// schema fails on the first non-conforming chunk; otherwise non-conforming
+// chunks are logged once per document and saved.
+func (dp *DocumentProcessor) checkChunkMetadata(doc *models.Document, chunks []models.DocumentChunk) error {
+	if len(dp.metadata.Fields) == 0 {
+		return nil
+	}
+	invalid := 0
+	var firstErr error
+	for _, chunk := range chunks {
+		err := dp.metadata.Check(chunk.Metadata)
+		if err == nil {
+			continue
+		}
+		if dp.metadata.Rejects() {
+			return fmt.Errorf("chunk %d: %w", chunk.ChunkIndex, err)
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		invalid++
+	}
+	if invalid > 0 {
+		logger.GetLogger().WithError(firstErr).WithFields(map[string]interface{}{
+			"document_id":    doc.ID,
+			"invalid_chunks": invalid,
+		}).Warn("Chunk metadata does not conform to schema")
+	}
+	return nil
 }
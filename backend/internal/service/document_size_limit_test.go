@@ -0,0 +1,65 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"ai-knowledge-app/internal/models"
+)
+
+func TestUploadRejectsOversizedFile(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+	service.SetMaxFileSize(16)
+
+	file := createTestFileHeader("large.txt", strings.Repeat("x", 32))
+	doc, err := service.Upload(file)
+	if !errors.Is(err, ErrFileTooLarge) {
+		t.Fatalf("Expected ErrFileTooLarge, got %v", err)
+	}
+	if doc != nil {
+		t.Error("Expected no document to be returned for oversized upload")
+	}
+
+	// Nothing should have been stored
+	var count int64
+	db.Model(&models.Document{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected 0 documents after rejected upload, got %d", count)
+	}
+
+	// Files within the limit are still accepted
+	small := createTestFileHeader("small.txt", "within limit")
+	if _, err := service.Upload(small); err != nil {
+		t.Fatalf("Expected upload within limit to succeed, got %v", err)
+	}
+}
+
+func TestInitUploadRejectsOversizedFile(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+	service.SetMaxFileSize(1024)
+
+	session, err := service.InitUpload("huge.bin", 10*1024*1024*1024, "deadbeef")
+	if !errors.Is(err, ErrFileTooLarge) {
+		t.Fatalf("Expected ErrFileTooLarge, got %v", err)
+	}
+	if session != nil {
+		t.Error("Expected no session to be created for oversized upload")
+	}
+
+	var count int64
+	db.Model(&models.UploadSession{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected 0 upload sessions after rejected init, got %d", count)
+	}
+}
+
+func TestMaxFileSizeDisabledByDefault(t *testing.T) {
+	service := NewDocumentService(setupTestDB())
+
+	if err := service.checkFileSize(10 * 1024 * 1024 * 1024); err != nil {
+		t.Errorf("Expected no size limit by default, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"ai-knowledge-app/internal/models"
+)
+
+// ErrDocumentNotProcessed is returned when reading the text of a document that
+// has not been successfully processed yet
+var ErrDocumentNotProcessed = errors.New("document has not been processed")
+
+// DocumentText is a window of a processed document's cleaned text. Offsets and
+// lengths are counted in characters (runes), not bytes.
+type DocumentText struct {
+	DocumentID uint   `json:"document_id"`
+	Status     string `json:"status"`
+	Text       string `json:"text"`
+	Offset     int    `json:"offset"`
+	Length     int    `json:"length"`
+	TotalChars int    `json:"total_chars"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// GetDocumentText returns up to limit characters of a document's cleaned text
+// starting at offset. Documents that were never processed, or whose processing
+// has not completed, return ErrDocumentNotProcessed.
+func (s *DocumentService) GetDocumentText(id uint, offset, limit int) (*DocumentText, error) {
+	var doc models.Document
+	if err := s.db.Select("id, status, chunk_count, cleaned_text").First(&doc, id).Error; err != nil {
+		return nil, err
+	}
+
+	status := processingStatus(doc.Status, doc.ChunkCount)
+	if status != string(models.StatusCompleted) {
+		return &DocumentText{DocumentID: doc.ID, Status: status}, ErrDocumentNotProcessed
+	}
+
+	text, length := runeWindow(doc.CleanedText, offset, limit)
+	total := utf8.RuneCountInString(doc.CleanedText)
+	return &DocumentText{
+		DocumentID: doc.ID,
+		Status:     status,
+		Text:       text,
+		Offset:     offset,
+		Length:     length,
+		TotalChars: total,
+		HasMore:    offset+length < total,
+	}, nil
+}
+
+// runeWindow returns the substring of at most limit runes starting at rune
+// offset, along with its rune length, without converting the whole text
+func runeWindow(text string, offset, limit int) (string, int) {
+	start, end, n := len(text), len(text), 0
+	for i := range text {
+		if n == offset {
+			start = i
+		}
+		if n == offset+limit {
+			end = i
+			break
+		}
+		n++
+	}
+	if start > end {
+		return "", 0
+	}
+	return text[start:end], utf8.RuneCountInString(text[start:end])
+}
+
+// DocumentMarkdown is a processed document rendered as Markdown
+type DocumentMarkdown struct {
+	DocumentID uint
+	Name       string
+	Status     string
+	Markdown   string
+}
+
+// GetDocumentMarkdown returns the Markdown stored when the document was
+// processed. Documents processed before Markdown was stored are rendered and
+// saved on first request. Unprocessed documents return ErrDocumentNotProcessed.
+func (s *DocumentService) GetDocumentMarkdown(id uint) (*DocumentMarkdown, error) {
+	var doc models.Document
+	if err := s.db.Select("id, name, original_name, file_type, extension, status, chunk_count, markdown").First(&doc, id).Error; err != nil {
+		return nil, err
+	}
+
+	result := &DocumentMarkdown{DocumentID: doc.ID, Name: doc.Name, Status: processingStatus(doc.Status, doc.ChunkCount)}
+	if result.Status != string(models.StatusCompleted) {
+		return result, ErrDocumentNotProcessed
+	}
+
+	if doc.Markdown == "" {
+		if err := s.db.Select("raw_text, cleaned_text").First(&doc, id).Error; err != nil {
+			return nil, err
+		}
+		doc.Markdown = renderMarkdown(&doc)
+		if err := s.db.Model(&doc).UpdateColumn("markdown", doc.Markdown).Error; err != nil {
+			return nil, err
+		}
+	}
+	result.Markdown = doc.Markdown
+	return result, nil
+}
+
+var (
+	htmlImagePattern     = regexp.MustCompile(`(?i)<img\b[^>]*>`)
+	htmlImageAttrPattern = regexp.MustCompile(`(?i)\b(src|alt)\s*=\s*["']([^"']*)["']`)
+)
+
+// renderMarkdown renders a processed document as Markdown. Markdown sources are
+// kept as written, including image references; HTML keeps its images as
+// Markdown image references; other types use the cleaned text under a title.
+func renderMarkdown(doc *models.Document) string {
+	title := doc.Name
+	if title == "" {
+		title = doc.OriginalName
+	}
+
+	var body string
+	switch documentFileType(doc) {
+	case "md", "markdown":
+		return strings.TrimSpace(doc.RawText) + "\n"
+	case "html":
+		text := htmlImagePattern.ReplaceAllStringFunc(doc.RawText, htmlImageToMarkdown)
+		text = htmlTagPattern.ReplaceAllString(text, "")
+		text = inlineSpacePattern.ReplaceAllString(text, " ")
+		body = strings.TrimSpace(blankLinesPattern.ReplaceAllString(text, "\n\n"))
+	default:
+		body = doc.CleanedText
+	}
+	return "# " + title + "\n\n" + body + "\n"
+}
+
+// htmlImageToMarkdown converts an <img> tag to a Markdown image reference, or
+// drops it when it has no src
+func htmlImageToMarkdown(tag string) string {
+	var src, alt string
+	for _, attr := range htmlImageAttrPattern.FindAllStringSubmatch(tag, -1) {
+		if strings.EqualFold(attr[1], "src") {
+			src = attr[2]
+		} else {
+			alt = attr[2]
+		}
+	}
+	if src == "" {
+		return ""
+	}
+	return "![" + alt + "](" + src + ")"
+}
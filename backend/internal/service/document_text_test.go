@@ -0,0 +1,52 @@
+package service
+
+import (
+	"testing"
+
+	"ai-knowledge-app/internal/models"
+)
+
+func TestRuneWindow(t *testing.T) {
+	text := "héllo 世界"
+	cases := []struct {
+		offset, limit int
+		want          string
+	}{
+		{0, 3, "hél"},
+		{6, 10, "世界"},
+		{7, 1, "界"},
+		{8, 5, ""},
+		{20, 5, ""},
+	}
+	for _, tc := range cases {
+		got, n := runeWindow(text, tc.offset, tc.limit)
+		if got != tc.want || n != len([]rune(tc.want)) {
+			t.Errorf("runeWindow(%d, %d) = %q (%d), want %q", tc.offset, tc.limit, got, n, tc.want)
+		}
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	cases := []struct {
+		doc  models.Document
+		want string
+	}{
+		{
+			models.Document{Name: "guide", Extension: ".md", RawText: "# Guide\n\n![diagram](images/flow.png)\n"},
+			"# Guide\n\n![diagram](images/flow.png)\n",
+		},
+		{
+			models.Document{Name: "page", Extension: ".html", RawText: `<p>Intro</p><img alt="logo" src="/static/logo.png"><img class="x">`},
+			"# page\n\nIntro![logo](/static/logo.png)\n",
+		},
+		{
+			models.Document{Name: "report", Extension: ".pdf", CleanedText: "Page one.\n\nPage two."},
+			"# report\n\nPage one.\n\nPage two.\n",
+		},
+	}
+	for _, tc := range cases {
+		if got := renderMarkdown(&tc.doc); got != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.doc.Extension, tc.want, got)
+		}
+	}
+}
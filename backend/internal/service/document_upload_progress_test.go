@@ -0,0 +1,60 @@
+package service
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/models"
+)
+
+func TestNewUploadProgress(t *testing.T) {
+	created := time.Now()
+	session := models.UploadSession{FileSize: 1000, UploadedSize: 250, CreatedAt: created}
+
+	progress := newUploadProgress(session, 2, created.Add(10*time.Second))
+	if progress.Percentage != 25 || progress.UploadedChunks != 2 || progress.UploadedSize != 250 {
+		t.Errorf("Unexpected progress: %+v", progress)
+	}
+	// 25 bytes/s, 750 bytes remaining
+	if progress.EstimatedSecondsRemaining == nil || *progress.EstimatedSecondsRemaining != 30 {
+		t.Errorf("Expected 30 seconds remaining, got %v", progress.EstimatedSecondsRemaining)
+	}
+
+	session.UploadedSize = 0
+	if progress := newUploadProgress(session, 0, created.Add(time.Second)); progress.EstimatedSecondsRemaining != nil || progress.Percentage != 0 {
+		t.Errorf("Expected no estimate before any bytes arrive, got %+v", progress)
+	}
+
+	session.UploadedSize = 1000
+	progress = newUploadProgress(session, 4, created.Add(time.Second))
+	if progress.Percentage != 100 || *progress.EstimatedSecondsRemaining != 0 {
+		t.Errorf("Expected completed upload at 100%% with no time remaining, got %+v", progress)
+	}
+}
+
+func TestGetUploadProgressCountsLocalChunks(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+
+	result, err := service.InitUpload("progress.bin", 3*1048576, "progress-hash")
+	if err != nil {
+		t.Fatalf("InitUpload failed: %v", err)
+	}
+	session := result.Session
+	defer os.RemoveAll(session.TempDir)
+
+	for _, index := range []int{0, 2} {
+		if err := service.UploadChunk(session.ID, index, make([]byte, 1048576)); err != nil {
+			t.Fatalf("UploadChunk %d failed: %v", index, err)
+		}
+	}
+
+	progress, err := service.GetUploadProgress(session.ID)
+	if err != nil {
+		t.Fatalf("GetUploadProgress failed: %v", err)
+	}
+	if progress.UploadedChunks != 2 || progress.UploadedSize != 2*1048576 || progress.Percentage != 66.67 {
+		t.Errorf("Expected 2 of 3 chunks (66.67%%), got %d chunks, %d bytes, %.2f%%", progress.UploadedChunks, progress.UploadedSize, progress.Percentage)
+	}
+}
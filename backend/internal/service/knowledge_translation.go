@@ -0,0 +1,85 @@
+package service
+
+import (
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/pkg/utils"
+
+	"github.com/pgvector/pgvector-go"
+	"gorm.io/gorm"
+)
+
+// KnowledgeVectorHit 向量检索命中的已发布知识
+// Distance为原文与各语言译文向量中最近的距离，知识和译文都没有向量时为空
+type KnowledgeVectorHit struct {
+	KnowledgeID uint
+	Distance    *float64
+}
+
+// KnowledgeVectorSearch 构建同时在知识原文和译文向量中检索的查询，每个已发布知识一行
+// 结果列为knowledge_id和distance，调用方追加Having、Order、Limit后Scan到KnowledgeVectorHit；
+// 原文缺少向量的知识也会返回，便于检索时发现并补生成向量
+func KnowledgeVectorSearch(db *gorm.DB, embedding pgvector.Vector) *gorm.DB {
+	dims := len(embedding.Slice())
+
+	originals := db.Model(&models.Knowledge{}).
+		Select("id AS knowledge_id, (content_vector <-> ?) AS distance", embedding).
+		Where("is_published = ?", true)
+	originals = MatchVectorDimension(originals, models.Knowledge{}.TableName(), "content_vector", dims)
+
+	translations := db.Model(&models.KnowledgeTranslation{}).
+		Select("knowledge_translations.knowledge_id, (knowledge_translations.content_vector <-> ?) AS distance", embedding).
+		Joins("JOIN knowledges ON knowledges.id = knowledge_translations.knowledge_id").
+		Where("knowledges.is_published = ? AND knowledges.deleted_at IS NULL AND knowledge_translations.content_vector IS NOT NULL", true)
+	translations = MatchVectorDimension(translations, models.KnowledgeTranslation{}.TableName(), "content_vector", dims)
+
+	return db.Table("(? UNION ALL ?) AS vector_hits", originals, translations).
+		Select("knowledge_id, MIN(distance) AS distance").
+		Group("knowledge_id")
+}
+
+// LocalizeKnowledges 将知识的标题、内容和摘要替换为指定语言的译文
+// 按主语言匹配（en匹配en-us），优先完全相同的语言标签；原文已是该语言或没有译文的知识保持不变
+func LocalizeKnowledges(db *gorm.DB, knowledges []models.Knowledge, language string) error {
+	language = utils.NormalizeLanguage(language)
+	base := utils.BaseLanguage(language)
+	if base == "" {
+		return nil
+	}
+
+	var ids []uint
+	for _, k := range knowledges {
+		if utils.BaseLanguage(k.Metadata.Language) != base {
+			ids = append(ids, k.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var translations []models.KnowledgeTranslation
+	if err := db.Where("knowledge_id IN ?", ids).Find(&translations).Error; err != nil {
+		return err
+	}
+
+	best := make(map[uint]models.KnowledgeTranslation, len(translations))
+	for _, t := range translations {
+		if utils.BaseLanguage(t.Language) != base {
+			continue
+		}
+		if current, ok := best[t.KnowledgeID]; !ok || (t.Language == language && current.Language != language) {
+			best[t.KnowledgeID] = t
+		}
+	}
+
+	for i := range knowledges {
+		t, ok := best[knowledges[i].ID]
+		if !ok || utils.BaseLanguage(knowledges[i].Metadata.Language) == base {
+			continue
+		}
+		knowledges[i].Title = t.Title
+		knowledges[i].Content = t.Content
+		knowledges[i].Summary = t.Summary
+		knowledges[i].DisplayLanguage = t.Language
+	}
+	return nil
+}
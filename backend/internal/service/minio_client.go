@@ -6,7 +6,9 @@ import (
 	"io"
 	"math"
 	"net"
+	"net/url"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -22,11 +24,60 @@ import (
 
 // RetryConfig defines retry behavior for MinIO operations
 type RetryConfig struct {
-	MaxRetries      int
-	InitialDelay    time.Duration
-	MaxDelay        time.Duration
-	BackoffFactor   float64
-	RetryableErrors []string
+	MaxRetries      int           `json:"max_retries"`
+	InitialDelay    time.Duration `json:"initial_delay"`
+	MaxDelay        time.Duration `json:"max_delay"`
+	BackoffFactor   float64       `json:"backoff_factor"`
+	RetryableErrors []string      `json:"retryable_errors"`
+}
+
+// Bounds for runtime-tunable retry settings
+const (
+	maxRetryAttempts = 10
+	maxRetryDelay    = 5 * time.Minute
+	maxBackoffFactor = 10.0
+)
+
+// Validate checks that the retry configuration is safe to apply
+func (c *RetryConfig) Validate() error {
+	if c.MaxRetries < 0 || c.MaxRetries > maxRetryAttempts {
+		return fmt.Errorf("max_retries must be between 0 and %d", maxRetryAttempts)
+	}
+	if c.InitialDelay <= 0 {
+		return fmt.Errorf("initial_delay must be positive")
+	}
+	if c.MaxDelay < c.InitialDelay {
+		return fmt.Errorf("max_delay must not be less than initial_delay")
+	}
+	if c.MaxDelay > maxRetryDelay {
+		return fmt.Errorf("max_delay must not exceed %s", maxRetryDelay)
+	}
+	if c.BackoffFactor < 1 || c.BackoffFactor > maxBackoffFactor {
+		return fmt.Errorf("backoff_factor must be between 1 and %g", maxBackoffFactor)
+	}
+	for _, pattern := range c.RetryableErrors {
+		if strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("retryable_errors must not contain empty patterns")
+		}
+	}
+	return nil
+}
+
+// clone returns a deep copy so callers cannot mutate shared state
+func (c *RetryConfig) clone() *RetryConfig {
+	copied := *c
+	copied.RetryableErrors = append([]string(nil), c.RetryableErrors...)
+	return &copied
+}
+
+// Delay returns the backoff before the given retry (0 for the first retry),
+// growing by BackoffFactor and capped at MaxDelay when it is set
+func (c *RetryConfig) Delay(attempt int) time.Duration {
+	delay := time.Duration(float64(c.InitialDelay) * math.Pow(c.BackoffFactor, float64(attempt)))
+	if c.MaxDelay > 0 && delay > c.MaxDelay {
+		delay = c.MaxDelay
+	}
+	return delay
 }
 
 // DefaultRetryConfig returns default retry configuration
@@ -57,6 +108,7 @@ type MinIOClient struct {
 	s3Client    *s3.Client
 	config      *config.S3Config
 	retryConfig *RetryConfig
+	retryMu     sync.RWMutex
 	logger      *logrus.Logger
 }
 
@@ -152,7 +204,7 @@ func (m *MinIOClient) isRetryableError(err error) bool {
 	}
 
 	// Check for specific error messages
-	for _, retryableErr := range m.retryConfig.RetryableErrors {
+	for _, retryableErr := range m.GetRetryConfig().RetryableErrors {
 		if strings.Contains(errStr, retryableErr) {
 			return true
 		}
@@ -163,18 +215,16 @@ func (m *MinIOClient) isRetryableError(err error) bool {
 
 // calculateBackoffDelay calculates the delay for the next retry attempt
 func (m *MinIOClient) calculateBackoffDelay(attempt int) time.Duration {
-	delay := time.Duration(float64(m.retryConfig.InitialDelay) * math.Pow(m.retryConfig.BackoffFactor, float64(attempt)))
-	if delay > m.retryConfig.MaxDelay {
-		delay = m.retryConfig.MaxDelay
-	}
-	return delay
+	return m.GetRetryConfig().Delay(attempt)
 }
 
 // retryOperation executes an operation with retry logic
 func (m *MinIOClient) retryOperation(operation func() error, operationName string) error {
 	var lastErr error
+	// Snapshot the attempt limit so a concurrent update doesn't change it mid-operation
+	maxRetries := m.GetRetryConfig().MaxRetries
 	
-	for attempt := 0; attempt <= m.retryConfig.MaxRetries; attempt++ {
+	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
 			delay := m.calculateBackoffDelay(attempt - 1)
 			m.logger.WithFields(logrus.Fields{
@@ -214,11 +264,11 @@ func (m *MinIOClient) retryOperation(operation func() error, operationName strin
 
 	m.logger.WithFields(logrus.Fields{
 		"operation":    operationName,
-		"max_retries":  m.retryConfig.MaxRetries,
+		"max_retries":  maxRetries,
 		"final_error":  lastErr,
 	}).Error("MinIO operation failed after all retry attempts")
 
-	return fmt.Errorf("operation %s failed after %d retries: %w", operationName, m.retryConfig.MaxRetries, lastErr)
+	return fmt.Errorf("operation %s failed after %d retries: %w", operationName, maxRetries, lastErr)
 }
 
 // initializeBucketWithRetry tests connection and creates bucket if it doesn't exist with retry logic
@@ -324,6 +374,19 @@ func (m *MinIOClient) StatObjectWithRetry(ctx context.Context, objectName string
 	return result, err
 }
 
+// PresignedGetObjectWithRetry generates a time-limited download URL with retry logic
+func (m *MinIOClient) PresignedGetObjectWithRetry(ctx context.Context, objectName string, expiry time.Duration, reqParams url.Values) (*url.URL, error) {
+	var result *url.URL
+	var err error
+	
+	err = m.retryOperation(func() error {
+		result, err = m.client.PresignedGetObject(ctx, m.config.Bucket, objectName, expiry, reqParams)
+		return err
+	}, fmt.Sprintf("presign_get_object_%s", objectName))
+	
+	return result, err
+}
+
 // RemoveObjectWithRetry removes an object from MinIO with retry logic
 func (m *MinIOClient) RemoveObjectWithRetry(ctx context.Context, objectName string, opts minio.RemoveObjectOptions) error {
 	return m.retryOperation(func() error {
@@ -434,14 +497,18 @@ func (m *MinIOClient) IsServiceAvailable() bool {
 	return err == nil
 }
 
-// GetRetryConfig returns the current retry configuration
+// GetRetryConfig returns a copy of the current retry configuration
 func (m *MinIOClient) GetRetryConfig() *RetryConfig {
-	return m.retryConfig
+	m.retryMu.RLock()
+	defer m.retryMu.RUnlock()
+	return m.retryConfig.clone()
 }
 
-// SetRetryConfig updates the retry configuration
+// SetRetryConfig updates the retry configuration; operations already retrying keep their attempt limit
 func (m *MinIOClient) SetRetryConfig(config *RetryConfig) {
-	m.retryConfig = config
+	m.retryMu.Lock()
+	m.retryConfig = config.clone()
+	m.retryMu.Unlock()
 	m.logger.WithFields(logrus.Fields{
 		"max_retries":      config.MaxRetries,
 		"initial_delay":    config.InitialDelay,
@@ -2,6 +2,7 @@ package service
 
 import (
 	"testing"
+	"time"
 
 	"ai-knowledge-app/internal/config"
 )
@@ -111,6 +112,18 @@ func TestMinIOClientValidation(t *testing.T) {
 				Region:          "",
 			},
 		},
+		{
+			name: "presign expiry too long",
+			config: &config.S3Config{
+				Endpoint:        "localhost:9000",
+				AccessKeyID:     "test",
+				SecretAccessKey: "test",
+				UseSSL:          false,
+				Bucket:          "test",
+				Region:          "us-east-1",
+				PresignExpiry:   8 * 24 * time.Hour,
+			},
+		},
 	}
 
 	for _, tc := range invalidConfigs {
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/pkg/logger"
+)
+
+// fingerprintShingleSize is the number of runes per shingle hashed into the
+// SimHash; short enough to work for CJK text without word segmentation
+const fingerprintShingleSize = 3
+
+// MaxNearDuplicateDistance is the largest supported Hamming distance between
+// near-duplicate fingerprints. Fingerprints are indexed in four 16-bit bands,
+// and two fingerprints at most three bits apart always share a band.
+const MaxNearDuplicateDistance = 3
+
+// NearDuplicate is an existing document whose text closely matches another.
+// It is only a suggestion: both documents keep their own files.
+type NearDuplicate struct {
+	DocumentID   uint   `json:"document_id"`
+	Name         string `json:"name"`
+	OriginalName string `json:"original_name"`
+	Distance     int    `json:"distance"` // differing fingerprint bits, 0-MaxNearDuplicateDistance
+}
+
+// SetNearDuplicateMaxDistance enables near-duplicate detection during processing
+// for documents whose text fingerprints differ in at most maxDistance bits
+// (1-MaxNearDuplicateDistance). 0 disables it and documents are no longer
+// fingerprinted.
+func (s *DocumentService) SetNearDuplicateMaxDistance(maxDistance int) error {
+	if maxDistance < 0 || maxDistance > MaxNearDuplicateDistance {
+		return fmt.Errorf("near duplicate max distance must be between 0 and %d, got %d", MaxNearDuplicateDistance, maxDistance)
+	}
+	s.nearDupMaxDistance = maxDistance
+	return nil
+}
+
+// setContentFingerprint records the SimHash of a document's cleaned text and
+// its bands, clearing them when the text is too short to fingerprint
+func setContentFingerprint(doc *models.Document) {
+	hash, ok := simHash(doc.CleanedText)
+	if !ok {
+		doc.ContentFingerprint = ""
+		doc.FingerprintBand0, doc.FingerprintBand1, doc.FingerprintBand2, doc.FingerprintBand3 = 0, 0, 0, 0
+		return
+	}
+	doc.ContentFingerprint = fmt.Sprintf("%016x", hash)
+	bands := fingerprintBands(hash)
+	doc.FingerprintBand0, doc.FingerprintBand1, doc.FingerprintBand2, doc.FingerprintBand3 = bands[0], bands[1], bands[2], bands[3]
+}
+
+// fingerprintBands splits a SimHash into the four 16-bit values stored in the
+// fingerprint_band columns
+func fingerprintBands(hash uint64) [4]int {
+	var bands [4]int
+	for i := range bands {
+		bands[i] = int((hash >> (16 * i)) & 0xffff)
+	}
+	return bands
+}
+
+// recordNearDuplicate stores the closest near duplicate of a processed
+// document, clearing a previous suggestion when there is none. Failures are
+// logged; they only leave the suggestion out of date.
+func (s *DocumentService) recordNearDuplicate(documentID uint) {
+	if s.nearDupMaxDistance <= 0 {
+		return
+	}
+	var doc models.Document
+	if err := s.db.Select("id, file_hash, content_fingerprint").First(&doc, documentID).Error; err != nil {
+		logger.GetLogger().WithError(err).WithField("document_id", documentID).Warn("Failed to load document for near-duplicate lookup")
+		return
+	}
+	match, err := s.FindNearDuplicate(&doc)
+	if err != nil {
+		logger.GetLogger().WithError(err).WithField("document_id", documentID).Warn("Failed to look up near-duplicate documents")
+		return
+	}
+	var nearDuplicateID *uint
+	if match != nil {
+		nearDuplicateID = &match.DocumentID
+	}
+	if err := s.db.Model(&models.Document{}).Where("id = ?", documentID).Update("near_duplicate_id", nearDuplicateID).Error; err != nil {
+		logger.GetLogger().WithError(err).WithField("document_id", documentID).Warn("Failed to save near-duplicate document")
+	}
+}
+
+// FindNearDuplicate returns the existing document whose fingerprint is closest
+// to doc's and at most the configured distance away, or nil. Candidates are
+// looked up through the indexed fingerprint bands rather than scanned. Exact
+// copies (same file hash) are left to instant upload.
+func (s *DocumentService) FindNearDuplicate(doc *models.Document) (*NearDuplicate, error) {
+	if s.nearDupMaxDistance <= 0 || doc.ContentFingerprint == "" {
+		return nil, nil
+	}
+	target, err := strconv.ParseUint(doc.ContentFingerprint, 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content fingerprint %q: %w", doc.ContentFingerprint, err)
+	}
+
+	bands := fingerprintBands(target)
+	var candidates []models.Document
+	err = s.db.Select("id, name, original_name, content_fingerprint").
+		Where("content_fingerprint <> '' AND id <> ? AND file_hash <> ?", doc.ID, doc.FileHash).
+		Where(s.db.Where("fingerprint_band0 = ?", bands[0]).
+			Or("fingerprint_band1 = ?", bands[1]).
+			Or("fingerprint_band2 = ?", bands[2]).
+			Or("fingerprint_band3 = ?", bands[3])).
+		Order("id").Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var best *NearDuplicate
+	for _, candidate := range candidates {
+		hash, err := strconv.ParseUint(candidate.ContentFingerprint, 16, 64)
+		if err != nil {
+			continue
+		}
+		distance := bits.OnesCount64(target ^ hash)
+		if distance <= s.nearDupMaxDistance && (best == nil || distance < best.Distance) {
+			best = &NearDuplicate{
+				DocumentID:   candidate.ID,
+				Name:         candidate.Name,
+				OriginalName: candidate.OriginalName,
+				Distance:     distance,
+			}
+		}
+	}
+	return best, nil
+}
+
+// simHash computes a 64-bit SimHash over the text's rune shingles, ignoring case
+// and whitespace. ok is false when the text is shorter than one shingle.
+func simHash(text string) (hash uint64, ok bool) {
+	runes := []rune(strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, text))
+	if len(runes) < fingerprintShingleSize {
+		return 0, false
+	}
+
+	var weights [64]int
+	for i := 0; i+fingerprintShingleSize <= len(runes); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(string(runes[i : i+fingerprintShingleSize])))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	for bit, weight := range weights {
+		if weight > 0 {
+			hash |= 1 << bit
+		}
+	}
+	return hash, true
+}
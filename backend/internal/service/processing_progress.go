@@ -0,0 +1,109 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"ai-knowledge-app/internal/models"
+)
+
+// progressRetention is how long a finished document's progress stays in memory;
+// later lookups fall back to the stored document status
+const progressRetention = time.Minute
+
+// ProcessingProgress is a snapshot of a document's progress through the processing pipeline
+type ProcessingProgress struct {
+	DocumentID   uint   `json:"document_id"`
+	TaskID       uint   `json:"task_id,omitempty"`
+	Status       string `json:"status"`
+	StagePercent int    `json:"stage_percent"` // progress within the current stage, e.g. chunks saved while chunking
+	Percent      int    `json:"percent"`       // overall progress of the pipeline
+	ChunkCount   int    `json:"chunk_count"`
+	Error        string `json:"error,omitempty"`
+	Done         bool   `json:"done"` // completed, failed or cancelled; no further updates follow
+}
+
+// stageRanges maps each pipeline stage to the overall percent range it covers
+var stageRanges = map[models.ProcessingStatus][2]int{
+	models.StatusQueued:   {0, 0},
+	models.StatusParsing:  {0, 30},
+	models.StatusCleaning: {30, 40},
+	models.StatusChunking: {40, 100},
+}
+
+// newProcessingProgress derives the overall percent from the stage and its progress
+func newProcessingProgress(documentID, taskID uint, status string, stagePercent int) ProcessingProgress {
+	p := ProcessingProgress{DocumentID: documentID, TaskID: taskID, Status: status, StagePercent: stagePercent}
+	switch models.ProcessingStatus(status) {
+	case models.StatusCompleted:
+		p.Percent, p.StagePercent, p.Done = 100, 100, true
+	case models.StatusFailed, models.StatusCancelled:
+		p.Done = true
+	default:
+		if r, ok := stageRanges[models.ProcessingStatus(status)]; ok {
+			p.Percent = r[0] + (r[1]-r[0])*stagePercent/100
+		}
+	}
+	return p
+}
+
+// ProgressTracker keeps the live progress of documents being processed by this
+// instance and notifies waiting subscribers on every update
+type ProgressTracker struct {
+	mu      sync.Mutex
+	entries map[uint]*progressEntry
+}
+
+type progressEntry struct {
+	progress ProcessingProgress
+	changed  chan struct{} // closed and replaced on every update
+}
+
+func NewProgressTracker() *ProgressTracker {
+	return &ProgressTracker{entries: make(map[uint]*progressEntry)}
+}
+
+// Update records a document's progress and wakes up subscribers. Finished
+// progress is dropped after progressRetention unless the document is processed again.
+func (t *ProgressTracker) Update(p ProcessingProgress) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[p.DocumentID]
+	if !ok {
+		entry = &progressEntry{changed: make(chan struct{})}
+		t.entries[p.DocumentID] = entry
+	}
+	entry.progress = p
+	close(entry.changed)
+	entry.changed = make(chan struct{})
+
+	if p.Done {
+		time.AfterFunc(progressRetention, func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if current, ok := t.entries[p.DocumentID]; ok && current == entry && current.progress.Done {
+				delete(t.entries, p.DocumentID)
+			}
+		})
+	}
+}
+
+// Get returns a document's latest progress and a channel closed on its next
+// update; ok is false when the document is not tracked by this instance
+func (t *ProgressTracker) Get(documentID uint) (progress ProcessingProgress, changed <-chan struct{}, ok bool) {
+	if t == nil {
+		return ProcessingProgress{}, nil, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[documentID]
+	if !ok {
+		return ProcessingProgress{}, nil, false
+	}
+	return entry.progress, entry.changed, true
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"testing"
+
+	"ai-knowledge-app/internal/models"
+)
+
+func TestNewProcessingProgressPercent(t *testing.T) {
+	tests := []struct {
+		status       models.ProcessingStatus
+		stagePercent int
+		want         int
+		done         bool
+	}{
+		{models.StatusQueued, 0, 0, false},
+		{models.StatusParsing, 0, 0, false},
+		{models.StatusCleaning, 0, 30, false},
+		{models.StatusChunking, 50, 70, false},
+		{models.StatusCompleted, 0, 100, true},
+		{models.StatusFailed, 0, 0, true},
+		{models.StatusCancelled, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		p := newProcessingProgress(1, 2, string(tt.status), tt.stagePercent)
+		if p.Percent != tt.want || p.Done != tt.done {
+			t.Errorf("%s at %d%%: expected percent %d done %v, got %d %v", tt.status, tt.stagePercent, tt.want, tt.done, p.Percent, p.Done)
+		}
+	}
+}
+
+func TestProgressTrackerNotifiesSubscribers(t *testing.T) {
+	tracker := NewProgressTracker()
+	if _, _, ok := tracker.Get(1); ok {
+		t.Fatal("Expected untracked document")
+	}
+
+	tracker.Update(newProcessingProgress(1, 1, string(models.StatusParsing), 0))
+	progress, changed, ok := tracker.Get(1)
+	if !ok || progress.Status != string(models.StatusParsing) {
+		t.Fatalf("Expected parsing progress, got %+v", progress)
+	}
+	select {
+	case <-changed:
+		t.Fatal("Expected no notification before the next update")
+	default:
+	}
+
+	tracker.Update(newProcessingProgress(1, 1, string(models.StatusChunking), 100))
+	select {
+	case <-changed:
+	default:
+		t.Fatal("Expected subscribers to be notified on update")
+	}
+	if progress, _, _ := tracker.Get(1); progress.Percent != 100 {
+		t.Errorf("Expected latest progress, got %+v", progress)
+	}
+
+	// A nil tracker is a no-op
+	var disabled *ProgressTracker
+	disabled.Update(progress)
+	if _, _, ok := disabled.Get(1); ok {
+		t.Error("Expected nil tracker to track nothing")
+	}
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"ai-knowledge-app/internal/background"
+	"ai-knowledge-app/internal/models"
+	"ai-knowledge-app/pkg/logger"
+)
+
+// maxRetryBackoffShift caps the exponential backoff so it cannot overflow
+const maxRetryBackoffShift = 16
+
+// AutoRetryOptions controls which failed documents RetryFailedProcessing re-queues
+type AutoRetryOptions struct {
+	// MaxRetries is how many automatic retries a document gets before it is
+	// left failed for manual intervention
+	MaxRetries int
+	// MaxAge limits retries to failures that finished within this window; 0
+	// retries failures of any age
+	MaxAge time.Duration
+	// Backoff is the wait after a failure before the first retry, doubled for
+	// every retry after that
+	Backoff time.Duration
+}
+
+// AutoRetryResult summarizes one pass of RetryFailedProcessing
+type AutoRetryResult struct {
+	Retried   []uint `json:"retried"`   // documents queued again
+	Waiting   int    `json:"waiting"`   // failures still inside their backoff
+	Exhausted int    `json:"exhausted"` // failures that used up MaxRetries
+}
+
+// RetryFailedProcessing re-queues documents whose latest processing task failed
+// recently, so transient errors such as a storage outage recover on their own.
+// Each retry task records the attempt in RetryCount; once a document's failed
+// task reaches MaxRetries it is no longer retried. A full queue ends the pass
+// early, leaving the rest for the next one.
+func (s *DocumentService) RetryFailedProcessing(opts AutoRetryOptions, submitter TaskSubmitter) (*AutoRetryResult, error) {
+	result := &AutoRetryResult{Retried: []uint{}}
+	if opts.MaxRetries <= 0 {
+		return result, nil
+	}
+
+	// Only the latest task of each document counts, and only while the document
+	// still shows the failure; a manual reprocess in between resets both
+	latest := s.db.Model(&models.ProcessingTask{}).Select("MAX(id)").Group("document_id")
+	failedDocs := s.db.Model(&models.Document{}).Select("id").Where("status = ?", models.StatusFailed)
+	query := s.db.Where("status = ? AND id IN (?) AND document_id IN (?)", models.TaskFailed, latest, failedDocs)
+	now := time.Now()
+	if opts.MaxAge > 0 {
+		query = query.Where("completed_at >= ?", now.Add(-opts.MaxAge))
+	}
+	var failed []models.ProcessingTask
+	if err := query.Order("completed_at").Find(&failed).Error; err != nil {
+		return nil, fmt.Errorf("failed to find failed processing tasks: %w", err)
+	}
+
+	for _, task := range failed {
+		if task.RetryCount >= opts.MaxRetries {
+			result.Exhausted++
+			continue
+		}
+		if task.CompletedAt != nil && now.Before(task.CompletedAt.Add(retryBackoff(opts.Backoff, task.RetryCount))) {
+			result.Waiting++
+			continue
+		}
+
+		retry := models.ProcessingTask{DocumentID: task.DocumentID, Status: models.TaskPending, RetryCount: task.RetryCount + 1}
+		if err := s.queueTask(&retry, string(models.StatusFailed), submitter); err != nil {
+			if errors.Is(err, background.ErrQueueFull) {
+				break
+			}
+			logger.GetLogger().WithError(err).WithField("document_id", task.DocumentID).Warn("Failed to retry document processing")
+			continue
+		}
+		result.Retried = append(result.Retried, task.DocumentID)
+	}
+	return result, nil
+}
+
+// errProcessingInterrupted is recorded on tasks the server stopped running
+// without finishing, e.g. because it crashed
+var errProcessingInterrupted = errors.New("processing interrupted by server restart")
+
+// RequeueInterruptedProcessing is run at startup to recover documents left
+// queued or processing by a server that stopped without finishing them; the
+// in-memory queue they were waiting in is gone, so nothing else would pick them
+// up. Documents last updated within staleAfter are skipped as they may belong
+// to another instance that is still running; 0 requeues every in-flight
+// document. Their unfinished tasks are marked failed and a new task is queued
+// with the same RetryCount. A full queue ends the sweep early, leaving the
+// rest failed for RetryFailedProcessing.
+func (s *DocumentService) RequeueInterruptedProcessing(staleAfter time.Duration, submitter TaskSubmitter) ([]uint, error) {
+	query := s.db.Model(&models.Document{}).Where("status IN ?", inFlightStatuses)
+	if staleAfter > 0 {
+		query = query.Where("updated_at < ?", time.Now().Add(-staleAfter))
+	}
+	var ids []uint
+	if err := query.Order("id").Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to find interrupted documents: %w", err)
+	}
+
+	requeued := []uint{}
+	for _, id := range ids {
+		var retries int
+		if latest, err := s.tasks.GetLatestByDocumentID(id); err == nil {
+			retries = latest.RetryCount
+		}
+		if err := s.db.Model(&models.ProcessingTask{}).
+			Where("document_id = ? AND status IN ?", id, []models.TaskStatus{models.TaskPending, models.TaskProcessing}).
+			Updates(map[string]interface{}{"status": models.TaskFailed, "error": errProcessingInterrupted.Error(), "completed_at": time.Now()}).Error; err != nil {
+			return requeued, fmt.Errorf("failed to fail interrupted tasks of document %d: %w", id, err)
+		}
+		// Conditional so a document that moved on in the meantime is left alone
+		released := s.db.Model(&models.Document{}).
+			Where("id = ? AND status IN ?", id, inFlightStatuses).
+			Updates(map[string]interface{}{"status": models.StatusFailed, "error": errProcessingInterrupted.Error()})
+		if released.Error != nil {
+			return requeued, fmt.Errorf("failed to release interrupted document %d: %w", id, released.Error)
+		}
+		if released.RowsAffected == 0 {
+			continue
+		}
+
+		task := models.ProcessingTask{DocumentID: id, Status: models.TaskPending, RetryCount: retries}
+		if err := s.queueTask(&task, string(models.StatusFailed), submitter); err != nil {
+			if errors.Is(err, background.ErrQueueFull) || errors.Is(err, background.ErrPoolClosed) {
+				break
+			}
+			logger.GetLogger().WithError(err).WithField("document_id", id).Warn("Failed to requeue interrupted document processing")
+			continue
+		}
+		requeued = append(requeued, id)
+	}
+	return requeued, nil
+}
+
+// retryBackoff is the wait before the retry following the given number of
+// earlier retries
+func retryBackoff(base time.Duration, retries int) time.Duration {
+	if retries > maxRetryBackoffShift {
+		retries = maxRetryBackoffShift
+	}
+	return base << retries
+}
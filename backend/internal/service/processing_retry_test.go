@@ -0,0 +1,115 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/models"
+)
+
+func TestRetryFailedProcessing(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+
+	now := time.Now()
+	failedTask := func(status string, retries int, finished time.Time) models.Document {
+		doc := models.Document{Name: "doc", Status: status}
+		db.Create(&doc)
+		db.Create(&models.ProcessingTask{DocumentID: doc.ID, Status: models.TaskFailed, RetryCount: retries, CompletedAt: &finished})
+		return doc
+	}
+	due := failedTask("failed", 0, now.Add(-2*time.Minute))
+	backingOff := failedTask("failed", 1, now.Add(-time.Minute)) // second retry waits 2m
+	exhausted := failedTask("failed", 3, now.Add(-time.Hour))
+	failedTask("failed", 0, now.Add(-48*time.Hour))   // too old
+	failedTask("completed", 0, now.Add(-time.Minute)) // reprocessed by hand since
+
+	queue := &limitedSubmitter{limit: 10}
+	opts := AutoRetryOptions{MaxRetries: 3, MaxAge: 24 * time.Hour, Backoff: time.Minute}
+	result, err := service.RetryFailedProcessing(opts, queue)
+	if err != nil {
+		t.Fatalf("RetryFailedProcessing failed: %v", err)
+	}
+	if len(result.Retried) != 1 || result.Retried[0] != due.ID || result.Waiting != 1 || result.Exhausted != 1 {
+		t.Fatalf("Unexpected retry result %+v", result)
+	}
+	if len(queue.tasks) != 1 {
+		t.Fatalf("Expected one submitted task, got %d", len(queue.tasks))
+	}
+
+	retry, err := service.tasks.GetLatestByDocumentID(due.ID)
+	if err != nil || retry.Status != models.TaskPending || retry.RetryCount != 1 {
+		t.Errorf("Expected pending retry task with retry_count 1, got %+v (%v)", retry, err)
+	}
+	var doc models.Document
+	db.First(&doc, due.ID)
+	if doc.Status != string(models.StatusQueued) {
+		t.Errorf("Expected retried document to be queued, got %s", doc.Status)
+	}
+
+	// 重试次数用完的文档保持failed
+	if latest, _ := service.tasks.GetLatestByDocumentID(exhausted.ID); latest.RetryCount != 3 {
+		t.Errorf("Expected exhausted document not to be retried, got %+v", latest)
+	}
+
+	// 退避时间过后再次重试
+	later, _ := service.RetryFailedProcessing(AutoRetryOptions{MaxRetries: 3, MaxAge: 24 * time.Hour, Backoff: time.Second}, queue)
+	if len(later.Retried) != 1 || later.Retried[0] != backingOff.ID {
+		t.Errorf("Expected backed-off document to be retried, got %+v", later)
+	}
+}
+
+func TestRequeueInterruptedProcessing(t *testing.T) {
+	db := setupTestDB()
+	service := NewDocumentService(db)
+
+	inFlight := func(status string, task models.TaskStatus, updated time.Time) models.Document {
+		doc := models.Document{Name: "doc", Status: status}
+		db.Create(&doc)
+		db.Create(&models.ProcessingTask{DocumentID: doc.ID, Status: task, RetryCount: 1})
+		db.Model(&doc).UpdateColumn("updated_at", updated)
+		return doc
+	}
+	stale := time.Now().Add(-time.Hour)
+	queued := inFlight("queued", models.TaskPending, stale)
+	processing := inFlight("chunking", models.TaskProcessing, stale)
+	recent := inFlight("parsing", models.TaskProcessing, time.Now()) // 可能属于其他实例
+	inFlight("completed", models.TaskCompleted, stale)
+
+	queue := &limitedSubmitter{limit: 10}
+	requeued, err := service.RequeueInterruptedProcessing(10*time.Minute, queue)
+	if err != nil {
+		t.Fatalf("RequeueInterruptedProcessing failed: %v", err)
+	}
+	if len(requeued) != 2 || requeued[0] != queued.ID || requeued[1] != processing.ID || len(queue.tasks) != 2 {
+		t.Fatalf("Expected stale in-flight documents to be requeued, got %v", requeued)
+	}
+
+	var tasks []models.ProcessingTask
+	db.Where("document_id = ?", processing.ID).Order("id").Find(&tasks)
+	if len(tasks) != 2 || tasks[0].Status != models.TaskFailed || tasks[0].Error == "" {
+		t.Fatalf("Expected interrupted task to be failed, got %+v", tasks)
+	}
+	if tasks[1].Status != models.TaskPending || tasks[1].RetryCount != 1 {
+		t.Errorf("Expected new pending task keeping retry_count, got %+v", tasks[1])
+	}
+	var doc models.Document
+	db.First(&doc, processing.ID)
+	if doc.Status != string(models.StatusQueued) {
+		t.Errorf("Expected requeued document to be queued, got %s", doc.Status)
+	}
+	if latest, _ := service.tasks.GetLatestByDocumentID(recent.ID); latest.Status != models.TaskProcessing {
+		t.Errorf("Expected recently updated document to be left alone, got %+v", latest)
+	}
+
+	// 队列已满时文档保持failed，留给自动重试
+	full, err := service.RequeueInterruptedProcessing(0, &limitedSubmitter{})
+	if err != nil || len(full) != 0 {
+		t.Fatalf("Expected nothing requeued into a full queue, got %v (%v)", full, err)
+	}
+	var rejected models.Document
+	db.First(&rejected, queued.ID)
+	if rejected.Status != string(models.StatusFailed) {
+		t.Errorf("Expected rejected document to stay failed, got %s", rejected.Status)
+	}
+}
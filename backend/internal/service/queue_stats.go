@@ -0,0 +1,100 @@
+package service
+
+import (
+	"errors"
+
+	"ai-knowledge-app/internal/background"
+)
+
+// Queue states reported by GetQueueStats
+const (
+	QueueRunning    = "running"
+	QueueNotRunning = "queue not running"
+)
+
+// ErrQueueNotRunning is returned when pausing or resuming without a running queue
+var ErrQueueNotRunning = errors.New("processing queue is not running")
+
+// ProcessingQueue is the queue document processing tasks run on, able to report
+// its live metrics and to be paused; background.Pool implements it
+type ProcessingQueue interface {
+	TaskSubmitter
+	Stats() background.Stats
+	Pause() bool
+	Resume() bool
+}
+
+// QueueStatsResponse describes the processing queue. Metrics is nil when no
+// queue is attached or it has shut down, so clients never mistake an idle
+// queue for a missing one.
+type QueueStatsResponse struct {
+	Status  string        `json:"status"` // QueueRunning or QueueNotRunning
+	Paused  bool          `json:"paused"` // workers hold off on queued tasks until resumed
+	Metrics *QueueMetrics `json:"metrics,omitempty"`
+}
+
+// QueueMetrics are the live counters of a running processing queue. The queue
+// is shared with other background work such as embedding generation, so the
+// counts cover all of its tasks.
+type QueueMetrics struct {
+	Pending             int     `json:"pending"`
+	Processing          int64   `json:"processing"`
+	Completed           int64   `json:"completed"`
+	Failed              int64   `json:"failed"`
+	Rejected            int64   `json:"rejected"`
+	Workers             int     `json:"workers"`
+	AverageProcessingMs float64 `json:"average_processing_ms"`
+	ThroughputPerMinute float64 `json:"throughput_per_minute"`
+}
+
+// SetProcessingQueue attaches the queue whose metrics GetQueueStats reports
+func (s *DocumentService) SetProcessingQueue(queue ProcessingQueue) {
+	s.queue = queue
+}
+
+// GetQueueStats reports the attached processing queue's live metrics
+func (s *DocumentService) GetQueueStats() QueueStatsResponse {
+	if s.queue == nil {
+		return QueueStatsResponse{Status: QueueNotRunning}
+	}
+	stats := s.queue.Stats()
+	if stats.Closed {
+		return QueueStatsResponse{Status: QueueNotRunning}
+	}
+	return QueueStatsResponse{
+		Status: QueueRunning,
+		Paused: stats.Paused,
+		Metrics: &QueueMetrics{
+			Pending:             stats.Queued,
+			Processing:          stats.Active,
+			Completed:           stats.Completed,
+			Failed:              stats.Failed,
+			Rejected:            stats.Rejected,
+			Workers:             stats.Workers,
+			AverageProcessingMs: stats.AvgTaskMillis,
+			ThroughputPerMinute: stats.ThroughputPerMinute,
+		},
+	}
+}
+
+// PauseQueue stops the processing queue's workers from starting queued tasks.
+// Running tasks finish and new tasks are still accepted until the queue fills.
+// Pausing a paused queue is a no-op; without a running queue it returns
+// ErrQueueNotRunning.
+func (s *DocumentService) PauseQueue() (QueueStatsResponse, error) {
+	if s.GetQueueStats().Status != QueueRunning {
+		return QueueStatsResponse{Status: QueueNotRunning}, ErrQueueNotRunning
+	}
+	s.queue.Pause()
+	return s.GetQueueStats(), nil
+}
+
+// ResumeQueue lets a paused processing queue's workers run queued tasks again;
+// resuming a running queue is a no-op
+func (s *DocumentService) ResumeQueue() (QueueStatsResponse, error) {
+	if s.GetQueueStats().Status != QueueRunning {
+		return QueueStatsResponse{Status: QueueNotRunning}, ErrQueueNotRunning
+	}
+	s.queue.Resume()
+	return s.GetQueueStats(), nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// recursiveChunker splits text on the highest-priority separator present,
+// recursing with lower-priority separators for pieces that are still too long,
+// then merges neighbouring pieces up to the chunk size. Each chunk after the
+// first repeats the last overlap runes of the previous one.
+type recursiveChunker struct {
+	size       int
+	overlap    int
+	minSize    int
+	separators []string
+}
+
+// byteRange is a half-open byte range [start, end) of the chunked text
+type byteRange struct {
+	start, end int
+}
+
+func (c *recursiveChunker) Strategy() ChunkingStrategy { return ChunkingRecursive }
+
+func (c *recursiveChunker) Chunk(text string) []string {
+	spans := c.ChunkSpans(text)
+	chunks := make([]string, len(spans))
+	for i, span := range spans {
+		chunks[i] = span.Text
+	}
+	return chunks
+}
+
+// ChunkSpans returns the chunks with their byte offsets in text. Chunks shorter
+// than the minimum size are dropped, except that a text producing a single
+// chunk is always kept so short documents stay searchable.
+func (c *recursiveChunker) ChunkSpans(text string) []ChunkSpan {
+	var spans []ChunkSpan
+	for _, r := range c.merge(text, c.split(text, byteRange{0, len(text)}, c.separators)) {
+		r = trimRange(text, r)
+		if r.start < r.end {
+			spans = append(spans, ChunkSpan{Text: text[r.start:r.end], StartOffset: r.start, EndOffset: r.end})
+		}
+	}
+
+	if c.minSize <= 0 || len(spans) <= 1 {
+		return spans
+	}
+	kept := spans[:0]
+	for _, span := range spans {
+		if utf8.RuneCountInString(span.Text) >= c.minSize {
+			kept = append(kept, span)
+		}
+	}
+	return kept
+}
+
+// split breaks r into contiguous pieces of at most size runes. Separators stay
+// attached to the end of the preceding piece.
+func (c *recursiveChunker) split(text string, r byteRange, separators []string) []byteRange {
+	if utf8.RuneCountInString(text[r.start:r.end]) <= c.size {
+		return []byteRange{r}
+	}
+
+	for i, sep := range separators {
+		if !strings.Contains(text[r.start:r.end], sep) {
+			continue
+		}
+		var pieces []byteRange
+		start := r.start
+		for {
+			idx := strings.Index(text[start:r.end], sep)
+			if idx < 0 {
+				break
+			}
+			end := start + idx + len(sep)
+			pieces = append(pieces, c.split(text, byteRange{start, end}, separators[i+1:])...)
+			start = end
+		}
+		if start < r.end {
+			pieces = append(pieces, c.split(text, byteRange{start, r.end}, separators[i+1:])...)
+		}
+		return pieces
+	}
+
+	// No separator left; cut at rune boundaries
+	var pieces []byteRange
+	start, count := r.start, 0
+	for i := range text[r.start:r.end] {
+		if count == c.size {
+			pieces = append(pieces, byteRange{start, r.start + i})
+			start, count = r.start+i, 0
+		}
+		count++
+	}
+	return append(pieces, byteRange{start, r.end})
+}
+
+// merge packs contiguous pieces into chunks of at most size runes, starting each
+// new chunk with up to overlap runes from the end of the previous one
+func (c *recursiveChunker) merge(text string, pieces []byteRange) []byteRange {
+	var chunks []byteRange
+	var current byteRange
+	currentLen := 0
+	for i, p := range pieces {
+		pieceLen := utf8.RuneCountInString(text[p.start:p.end])
+		switch {
+		case i == 0:
+			current, currentLen = p, pieceLen
+		case currentLen+pieceLen <= c.size:
+			current.end = p.end
+			currentLen += pieceLen
+		default:
+			chunks = append(chunks, current)
+			// Carry less than the configured overlap when the next piece would not fit otherwise
+			carry := min(c.overlap, c.size-pieceLen, currentLen)
+			current = byteRange{runeOffsetFromEnd(text, current, carry), p.end}
+			currentLen = carry + pieceLen
+		}
+	}
+	if len(pieces) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// runeOffsetFromEnd returns the byte offset n runes before the end of r
+func runeOffsetFromEnd(text string, r byteRange, n int) int {
+	end := r.end
+	for ; n > 0 && end > r.start; n-- {
+		_, width := utf8.DecodeLastRuneInString(text[r.start:end])
+		end -= width
+	}
+	return end
+}
+
+// trimRange shrinks r to exclude leading and trailing whitespace
+func trimRange(text string, r byteRange) byteRange {
+	for r.start < r.end {
+		ch, width := utf8.DecodeRuneInString(text[r.start:r.end])
+		if !unicode.IsSpace(ch) {
+			break
+		}
+		r.start += width
+	}
+	for r.end > r.start {
+		ch, width := utf8.DecodeLastRuneInString(text[r.start:r.end])
+		if !unicode.IsSpace(ch) {
+			break
+		}
+		r.end -= width
+	}
+	return r
+}
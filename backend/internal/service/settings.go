@@ -0,0 +1,64 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"ai-knowledge-app/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RetryConfigSettingKey is the system setting holding the persisted MinIO retry override
+const RetryConfigSettingKey = "storage.retry_config"
+
+// LoadSetting decodes the JSON value stored under key into v, reporting whether it exists
+func LoadSetting(db *gorm.DB, key string, v interface{}) (bool, error) {
+	var setting models.SystemSetting
+	if err := db.Where("key = ?", key).First(&setting).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to load setting %s: %w", key, err)
+	}
+	if err := json.Unmarshal([]byte(setting.Value), v); err != nil {
+		return false, fmt.Errorf("failed to decode setting %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// SaveSetting stores v as JSON under key, replacing any previous value
+func SaveSetting(db *gorm.DB, key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode setting %s: %w", key, err)
+	}
+	setting := models.SystemSetting{Key: key, Value: string(value)}
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&setting).Error
+	if err != nil {
+		return fmt.Errorf("failed to save setting %s: %w", key, err)
+	}
+	return nil
+}
+
+// LoadRetryConfigOverride returns the persisted retry configuration, or nil when none was saved
+func LoadRetryConfigOverride(db *gorm.DB) (*RetryConfig, error) {
+	var cfg RetryConfig
+	found, err := LoadSetting(db, RetryConfigSettingKey, &cfg)
+	if err != nil || !found {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("persisted retry config is invalid: %w", err)
+	}
+	return &cfg, nil
+}
+
+// SaveRetryConfigOverride persists the retry configuration so it is reapplied on startup
+func SaveRetryConfigOverride(db *gorm.DB, cfg *RetryConfig) error {
+	return SaveSetting(db, RetryConfigSettingKey, cfg)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRetryConfigValidate(t *testing.T) {
+	if err := DefaultRetryConfig().Validate(); err != nil {
+		t.Fatalf("Default retry config should be valid: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*RetryConfig)
+	}{
+		{"negative retries", func(c *RetryConfig) { c.MaxRetries = -1 }},
+		{"too many retries", func(c *RetryConfig) { c.MaxRetries = maxRetryAttempts + 1 }},
+		{"zero initial delay", func(c *RetryConfig) { c.InitialDelay = 0 }},
+		{"max below initial", func(c *RetryConfig) { c.MaxDelay = c.InitialDelay / 2 }},
+		{"max delay too long", func(c *RetryConfig) { c.MaxDelay = maxRetryDelay + time.Second }},
+		{"backoff below one", func(c *RetryConfig) { c.BackoffFactor = 0.5 }},
+		{"empty pattern", func(c *RetryConfig) { c.RetryableErrors = []string{" "} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultRetryConfig()
+			tt.mutate(cfg)
+			if err := cfg.Validate(); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+}
+
+func TestRetryConfigOverridePersistence(t *testing.T) {
+	db := setupTestDB()
+	if err := db.AutoMigrate(&models.SystemSetting{}); err != nil {
+		t.Fatalf("Failed to migrate settings: %v", err)
+	}
+
+	if cfg, err := LoadRetryConfigOverride(db); err != nil || cfg != nil {
+		t.Fatalf("Expected no override before saving, got %+v, %v", cfg, err)
+	}
+
+	cfg := DefaultRetryConfig()
+	cfg.MaxRetries = 5
+	cfg.InitialDelay = 200 * time.Millisecond
+	if err := SaveRetryConfigOverride(db, cfg); err != nil {
+		t.Fatalf("Failed to save override: %v", err)
+	}
+	// 再次保存应覆盖而不是新增
+	cfg.MaxRetries = 6
+	if err := SaveRetryConfigOverride(db, cfg); err != nil {
+		t.Fatalf("Failed to update override: %v", err)
+	}
+
+	loaded, err := LoadRetryConfigOverride(db)
+	if err != nil {
+		t.Fatalf("Failed to load override: %v", err)
+	}
+	if loaded.MaxRetries != 6 || loaded.InitialDelay != 200*time.Millisecond || len(loaded.RetryableErrors) != len(cfg.RetryableErrors) {
+		t.Errorf("Unexpected loaded config: %+v", loaded)
+	}
+
+	var count int64
+	db.Model(&models.SystemSetting{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected a single setting row, got %d", count)
+	}
+}
+
+func TestMinIOClientRetryConfigIsCopied(t *testing.T) {
+	client := &MinIOClient{retryConfig: DefaultRetryConfig(), logger: logrus.New()}
+
+	cfg := client.GetRetryConfig()
+	cfg.MaxRetries = 9
+	if client.GetRetryConfig().MaxRetries == 9 {
+		t.Error("Mutating the returned config should not affect the client")
+	}
+
+	client.SetRetryConfig(cfg)
+	cfg.RetryableErrors[0] = "changed"
+	if got := client.GetRetryConfig(); got.MaxRetries != 9 || got.RetryableErrors[0] == "changed" {
+		t.Errorf("Expected client to keep its own copy, got %+v", got)
+	}
+}
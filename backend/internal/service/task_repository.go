@@ -0,0 +1,100 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"ai-knowledge-app/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrTaskNotCancellable is returned when cancelling a task that already finished
+// or is running on another instance
+var ErrTaskNotCancellable = errors.New("only pending tasks and tasks running on this instance can be cancelled")
+
+// ErrTaskNotFound is returned for unknown processing task IDs
+var ErrTaskNotFound = errors.New("task not found")
+
+// TaskRepository persists processing task state
+type TaskRepository struct {
+	db *gorm.DB
+}
+
+func NewTaskRepository(db *gorm.DB) *TaskRepository {
+	return &TaskRepository{db: db}
+}
+
+func (r *TaskRepository) Create(task *models.ProcessingTask) error {
+	return r.db.Create(task).Error
+}
+
+func (r *TaskRepository) Update(task *models.ProcessingTask) error {
+	return r.db.Save(task).Error
+}
+
+func (r *TaskRepository) GetByID(id uint) (*models.ProcessingTask, error) {
+	var task models.ProcessingTask
+	if err := r.db.First(&task, id).Error; err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// GetLatestByDocumentID returns the most recently created task for a document
+func (r *TaskRepository) GetLatestByDocumentID(documentID uint) (*models.ProcessingTask, error) {
+	var task models.ProcessingTask
+	if err := r.db.Where("document_id = ?", documentID).Order("id DESC").First(&task).Error; err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// MarkStarted moves a pending task to processing. It reports false without
+// error when the task is no longer pending, e.g. because it was cancelled.
+func (r *TaskRepository) MarkStarted(id uint) (bool, error) {
+	now := time.Now()
+	result := r.db.Model(&models.ProcessingTask{}).
+		Where("id = ? AND status = ?", id, models.TaskPending).
+		Updates(map[string]interface{}{"status": models.TaskProcessing, "started_at": now})
+	return result.RowsAffected == 1, result.Error
+}
+
+// MarkFinished records the outcome of a started task; an error wrapping
+// errTaskCancelled marks it cancelled, any other error (including timeouts and
+// shutdown) marks it failed so it can be retried
+func (r *TaskRepository) MarkFinished(id uint, taskErr error) error {
+	updates := map[string]interface{}{"status": models.TaskCompleted, "completed_at": time.Now()}
+	switch {
+	case errors.Is(taskErr, errTaskCancelled):
+		updates["status"] = models.TaskCancelled
+	case taskErr != nil:
+		updates["status"] = models.TaskFailed
+		updates["error"] = taskErr.Error()
+	}
+	return r.db.Model(&models.ProcessingTask{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// Cancel marks a pending task as cancelled; tasks that already started are left alone
+func (r *TaskRepository) Cancel(id uint) (*models.ProcessingTask, error) {
+	task, err := r.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := r.db.Model(&models.ProcessingTask{}).
+		Where("id = ? AND status = ?", id, models.TaskPending).
+		Updates(map[string]interface{}{"status": models.TaskCancelled, "completed_at": now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	// The worker may have picked the task up between the read and the update
+	if result.RowsAffected == 0 {
+		return nil, ErrTaskNotCancellable
+	}
+
+	task.Status = models.TaskCancelled
+	task.CompletedAt = &now
+	return task, nil
+}
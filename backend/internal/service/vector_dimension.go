@@ -0,0 +1,68 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"ai-knowledge-app/pkg/logger"
+	"ai-knowledge-app/pkg/utils"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// KnowledgeReindexHint 知识向量维度不一致时提示的修复方式
+const KnowledgeReindexHint = "POST /api/v1/admin/knowledge/reindex?force=true"
+
+// dimensionCheckInterval 同一向量列检查维度不一致的最小间隔，避免每次搜索都全表统计
+const dimensionCheckInterval = 10 * time.Minute
+
+// dimensionChecks 最近已检查过的向量列及查询向量维度
+var dimensionChecks = utils.NewCache(utils.CacheOptions[string, struct{}]{
+	MaxEntries: 100,
+	TTL:        dimensionCheckInterval,
+})
+
+// MatchVectorDimension 将向量距离查询限制在与查询向量维度相同的记录
+// 更换向量模型后旧向量维度不同，pgvector的距离运算会直接报错导致整个搜索失败，
+// 过滤后维度不一致的记录被跳过，并按间隔记录一次警告提示重建向量
+// 非PostgreSQL数据库不支持向量距离运算，原样返回
+func MatchVectorDimension(query *gorm.DB, table, column string, dims int) *gorm.DB {
+	if query.Dialector.Name() != "postgres" || dims <= 0 {
+		return query
+	}
+	warnVectorDimensionMismatch(query.Session(&gorm.Session{NewDB: true}), table, column, dims)
+	// 缺少向量的记录保留，由调用方决定是否排除（如检索时补生成向量）
+	return query.Where(fmt.Sprintf("(%[1]s.%[2]s IS NULL OR vector_dims(%[1]s.%[2]s) = ?)", table, column), dims)
+}
+
+// warnVectorDimensionMismatch 统计维度与查询向量不一致的记录数并记录警告
+func warnVectorDimensionMismatch(db *gorm.DB, table, column string, dims int) {
+	key := fmt.Sprintf("%s.%s:%d", table, column, dims)
+	if _, checked := dimensionChecks.Get(key); checked {
+		return
+	}
+	dimensionChecks.Set(key, struct{}{})
+
+	var mismatched int64
+	err := db.Table(table).
+		Where(fmt.Sprintf("%[1]s IS NOT NULL AND vector_dims(%[1]s) <> ?", column), dims).
+		Count(&mismatched).Error
+	if err != nil {
+		logger.GetLogger().WithError(err).WithField("table", table).Warn("Failed to check vector dimensions")
+		return
+	}
+	if mismatched == 0 {
+		return
+	}
+	fields := logrus.Fields{
+		"table":      table,
+		"column":     column,
+		"dimensions": dims,
+		"mismatched": mismatched,
+	}
+	if table == "knowledges" {
+		fields["fix"] = KnowledgeReindexHint
+	}
+	logger.GetLogger().WithFields(fields).Warn("Stored vectors have a different dimension than the current embedding model and are excluded from search")
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"testing"
+
+	"ai-knowledge-app/internal/models"
+
+	"gorm.io/gorm"
+)
+
+func TestMatchVectorDimensionSkippedWithoutPgvector(t *testing.T) {
+	db := setupTestDB()
+
+	// SQLite不支持vector_dims，查询条件保持不变
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		query := MatchVectorDimension(tx.Model(&models.Document{}), "documents", "content_vector", 1536)
+		return query.Find(&[]models.Document{})
+	})
+	expected := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&models.Document{}).Find(&[]models.Document{})
+	})
+	if sql != expected {
+		t.Errorf("Expected query to be unchanged, got %s", sql)
+	}
+	if dimensionChecks.Len() != 0 {
+		t.Errorf("Expected no dimension check on SQLite, got %d", dimensionChecks.Len())
+	}
+}
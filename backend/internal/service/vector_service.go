@@ -2,54 +2,166 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/redact"
+	"ai-knowledge-app/pkg/logger"
+	"ai-knowledge-app/pkg/utils"
 	"github.com/pgvector/pgvector-go"
+	"github.com/sirupsen/logrus"
 	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/openai"
 )
 
 // VectorService 向量服务接口
 type VectorService interface {
 	GenerateEmbedding(ctx context.Context, text string) (pgvector.Vector, error)
+	// GenerateEmbeddings 批量生成向量，按配置的批大小拆分请求
+	// 某一批失败时返回之前批次的结果和*EmbeddingBatchError
+	GenerateEmbeddings(ctx context.Context, texts []string) ([]pgvector.Vector, error)
+}
+
+// ErrEmptyEmbedding 向量服务返回了空结果
+var ErrEmptyEmbedding = errors.New("no embedding data returned")
+
+// EmbeddingError 向量生成失败（已耗尽重试次数）
+type EmbeddingError struct {
+	Attempts int   // 实际尝试次数
+	Err      error // 最后一次失败的原因
+}
+
+func (e *EmbeddingError) Error() string {
+	return fmt.Sprintf("embedding failed after %d attempt(s): %v", e.Attempts, e.Err)
+}
+
+func (e *EmbeddingError) Unwrap() error {
+	return e.Err
+}
+
+// EmbeddingBatchError 批量生成向量时某一批请求失败，之前批次的向量已返回
+type EmbeddingBatchError struct {
+	Start int   // 失败批次第一条文本的下标
+	End   int   // 失败批次最后一条文本的下标+1
+	Total int   // 文本总数
+	Err   error // 失败原因
+}
+
+func (e *EmbeddingBatchError) Error() string {
+	return fmt.Sprintf("embedding batch [%d, %d) of %d texts failed: %v", e.Start, e.End, e.Total, e.Err)
+}
+
+func (e *EmbeddingBatchError) Unwrap() error {
+	return e.Err
 }
 
 // OpenAIVectorService OpenAI向量服务
 type OpenAIVectorService struct {
-	config    *config.AIConfig
-	embedder  embeddings.Embedder
+	config   *config.AIConfig
+	embedder embeddings.Embedder
+	redactor *redact.Redactor                      // 未启用脱敏时为nil
+	cache    *utils.Cache[string, pgvector.Vector] // 单条文本的向量缓存，未启用时为nil
+}
+
+// defaultEmbeddingModel 未配置向量模型时使用的模型
+const defaultEmbeddingModel = "text-embedding-ada-002"
+
+// defaultEmbeddingBatchSize 未配置批大小时单次请求的最大文本数
+const defaultEmbeddingBatchSize = 100
+
+// EmbeddingDimensionError 向量模型返回的维度与配置的维度不一致
+// 维度不一致的向量无法写入数据库向量列，也无法与已有向量比较
+type EmbeddingDimensionError struct {
+	Model    string
+	Expected int
+	Actual   int
+}
+
+func (e *EmbeddingDimensionError) Error() string {
+	return fmt.Sprintf("embedding model %s returned %d-dimensional vectors but ai.embedding.dimensions is %d; "+
+		"set dimensions to match the model and migrate the vector columns", e.Model, e.Actual, e.Expected)
 }
 
 // NewVectorService 创建向量服务
 func NewVectorService(cfg *config.AIConfig) VectorService {
-	// 创建OpenAI LLM客户端用于embeddings
-	llm, err := openai.New(
-		openai.WithModel("text-embedding-ada-002"),
-		openai.WithBaseURL(cfg.OpenAI.BaseURL),
-		openai.WithToken(cfg.OpenAI.APIKey),
-	)
+	// 配置加载时已校验脱敏规则
+	redactor, err := cfg.Redaction.Redactor()
 	if err != nil {
-		// 如果创建失败，返回一个基本的实现
-		return &OpenAIVectorService{
-			config:   cfg,
-			embedder: nil,
-		}
-	}
-
-	// 创建embedder
-	embedder, err := embeddings.NewEmbedder(llm)
-	if err != nil {
-		return &OpenAIVectorService{
-			config:   cfg,
-			embedder: nil,
-		}
+		logger.GetLogger().WithError(err).Error("Invalid redaction configuration, embeddings will not be redacted")
 	}
 
+	// 创建失败时保留基本实现，首次生成向量时再尝试初始化
+	embedder, _ := newEmbedder(cfg)
 	return &OpenAIVectorService{
 		config:   cfg,
 		embedder: embedder,
+		redactor: redactor,
+		cache:    newEmbeddingCache(cfg.Embedding.CacheSize),
+	}
+}
+
+// newEmbeddingCache 创建按LRU淘汰的向量缓存，size为0时不缓存
+func newEmbeddingCache(size int) *utils.Cache[string, pgvector.Vector] {
+	if size <= 0 {
+		return nil
+	}
+	return utils.NewCache(utils.CacheOptions[string, pgvector.Vector]{MaxEntries: size})
+}
+
+// embeddingCacheKey 规范化文本（合并多余空白）后计算的SHA-256
+// 不忽略大小写，大小写不同的文本向量也不同
+func embeddingCacheKey(text string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(text), " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// EmbeddingCacheStats 返回向量缓存的命中统计，用于调整cache_size
+func (s *OpenAIVectorService) EmbeddingCacheStats() utils.CacheStats {
+	if s.cache == nil {
+		return utils.CacheStats{}
+	}
+	return s.cache.Stats()
+}
+
+// embeddingModel 返回配置的向量模型
+func embeddingModel(cfg *config.AIConfig) string {
+	if cfg.Embedding.Model == "" {
+		return defaultEmbeddingModel
+	}
+	return cfg.Embedding.Model
+}
+
+// newEmbedder 按配置的向量模型创建LangChain-Go embedder
+func newEmbedder(cfg *config.AIConfig) (embeddings.Embedder, error) {
+	options := []openai.Option{
+		openai.WithEmbeddingModel(embeddingModel(cfg)),
+		openai.WithBaseURL(cfg.OpenAI.BaseURL),
+		openai.WithToken(cfg.OpenAI.APIKey),
+		openai.WithHTTPClient(cfg.HTTPClient()),
+	}
+	if cfg.Embedding.RequestDimensions && cfg.Embedding.Dimensions > 0 {
+		options = append(options, openai.WithEmbeddingDimensions(cfg.Embedding.Dimensions))
+	}
+
+	llm, err := openai.New(options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize LLM: %w", err)
+	}
+	embedder, err := embeddings.NewEmbedder(llm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize embedder: %w", err)
 	}
+	return embedder, nil
 }
 
 // GenerateEmbedding 生成文本的向量表示
@@ -57,36 +169,242 @@ func (s *OpenAIVectorService) GenerateEmbedding(ctx context.Context, text string
 	if text == "" {
 		return pgvector.NewVector(nil), fmt.Errorf("input text cannot be empty")
 	}
+	var key string
+	if s.cache != nil {
+		key = embeddingCacheKey(text)
+		if cached, ok := s.cache.Get(key); ok {
+			return copyVector(cached), nil
+		}
+	}
+	if err := s.ensureEmbedder(); err != nil {
+		return pgvector.NewVector(nil), err
+	}
 
-	// 检查embedder是否已初始化
-	if s.embedder == nil {
-		// 尝试重新初始化embedder
-		llm, err := openai.New(
-			openai.WithModel("text-embedding-ada-002"),
-			openai.WithBaseURL(s.config.OpenAI.BaseURL),
-			openai.WithToken(s.config.OpenAI.APIKey),
-		)
-		if err != nil {
-			return pgvector.NewVector(nil), fmt.Errorf("failed to initialize LLM: %w", err)
+	vectors, err := s.embed(ctx, []string{text})
+	if err != nil {
+		return pgvector.NewVector(nil), err
+	}
+	if s.cache != nil {
+		s.cache.Set(key, copyVector(vectors[0]))
+	}
+	return vectors[0], nil
+}
+
+// copyVector 复制向量，避免调用方修改缓存中的数据
+func copyVector(v pgvector.Vector) pgvector.Vector {
+	return pgvector.NewVector(append([]float32(nil), v.Slice()...))
+}
+
+// GenerateEmbeddings 批量生成文本的向量表示，结果与输入顺序一致
+// 超过配置的批大小时拆分为多次请求；某一批失败时返回之前批次的向量和*EmbeddingBatchError
+func (s *OpenAIVectorService) GenerateEmbeddings(ctx context.Context, texts []string) ([]pgvector.Vector, error) {
+	for i, text := range texts {
+		if text == "" {
+			return nil, fmt.Errorf("input text %d cannot be empty", i)
 		}
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	if err := s.ensureEmbedder(); err != nil {
+		return nil, err
+	}
+
+	batchSize := s.config.Embedding.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultEmbeddingBatchSize
+	}
 
-		embedder, err := embeddings.NewEmbedder(llm)
+	vectors := make([]pgvector.Vector, 0, len(texts))
+	for start := 0; start < len(texts); start += batchSize {
+		end := min(start+batchSize, len(texts))
+		batch, err := s.embed(ctx, texts[start:end])
 		if err != nil {
-			return pgvector.NewVector(nil), fmt.Errorf("failed to initialize embedder: %w", err)
+			return vectors, &EmbeddingBatchError{Start: start, End: end, Total: len(texts), Err: err}
 		}
-		s.embedder = embedder
+		vectors = append(vectors, batch...)
 	}
+	return vectors, nil
+}
 
-	// 使用LangChain-Go生成embedding
-	vectors, err := s.embedder.EmbedDocuments(ctx, []string{text})
+// ensureEmbedder 确保embedder已初始化，创建失败时下次调用会重试
+func (s *OpenAIVectorService) ensureEmbedder() error {
+	if s.embedder != nil {
+		return nil
+	}
+	embedder, err := newEmbedder(s.config)
 	if err != nil {
-		return pgvector.NewVector(nil), fmt.Errorf("failed to generate embedding: %w", err)
+		return err
+	}
+	s.embedder = embedder
+	return nil
+}
+
+// embed 在一次请求中为texts生成向量，空结果、限流或服务端错误时按指数退避重试
+func (s *OpenAIVectorService) embed(ctx context.Context, texts []string) ([]pgvector.Vector, error) {
+	// 发送给外部服务前脱敏，调用方保存的原文不受影响
+	redacted := make([]string, len(texts))
+	redactedCounts := redact.Counts{}
+	for i, text := range texts {
+		var counts redact.Counts
+		redacted[i], counts = s.redactor.Redact(text)
+		for name, n := range counts {
+			redactedCounts[name] += n
+		}
+	}
+	if redactedCounts.Total() > 0 {
+		logger.GetLogger().WithFields(redactedCounts.Fields()).Info("Redacted sensitive data before embedding")
+	}
+
+	retry := embeddingRetryConfig(s.config.Embedding)
+
+	var lastErr error
+	attempts := 0
+	for attempt := 0; attempt <= retry.MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := retry.Delay(attempt - 1)
+			logger.GetLogger().WithFields(logrus.Fields{
+				"attempt": attempt,
+				"delay":   delay,
+				"texts":   len(texts),
+				"error":   lastErr,
+			}).Warn("Retrying embedding generation after transient failure")
+			select {
+			case <-ctx.Done():
+				return nil, &EmbeddingError{Attempts: attempts, Err: ctx.Err()}
+			case <-time.After(delay):
+			}
+		}
+
+		attempts++
+		vectors, err := s.embedder.EmbedDocuments(ctx, redacted)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to generate embedding: %w", err)
+			if ctx.Err() != nil || !isRetryableEmbeddingError(err, retry) {
+				break
+			}
+			continue
+		}
+
+		if len(vectors) != len(redacted) || hasEmptyVector(vectors) {
+			lastErr = ErrEmptyEmbedding
+			continue
+		}
+
+		results := make([]pgvector.Vector, len(vectors))
+		for i, vector := range vectors {
+			// 维度与配置不一致说明模型与配置不匹配，重试也不会改变结果
+			if expected := s.config.Embedding.Dimensions; expected > 0 && len(vector) != expected {
+				return nil, &EmbeddingDimensionError{Model: embeddingModel(s.config), Expected: expected, Actual: len(vector)}
+			}
+
+			// 知识向量和查询向量都经过这里，归一化对两者一致生效
+			if s.config.Embedding.Normalize {
+				vector = normalizeL2(vector)
+			}
+			results[i] = pgvector.NewVector(vector)
+		}
+		if attempt > 0 {
+			logger.GetLogger().WithField("attempts", attempts).Info("Embedding generation succeeded after retry")
+		}
+		return results, nil
+	}
+
+	logger.GetLogger().WithFields(logrus.Fields{
+		"attempts": attempts,
+		"texts":    len(texts),
+		"error":    lastErr,
+	}).Error("Embedding generation failed")
+	return nil, &EmbeddingError{Attempts: attempts, Err: lastErr}
+}
+
+// embeddingStatusPattern 向量接口返回非200状态码时错误信息中的状态码
+var embeddingStatusPattern = regexp.MustCompile(`status code: (\d{3})`)
+
+// embeddingSizeErrors 批量请求超过服务商的大小限制时的错误信息
+var embeddingSizeErrors = []string{"maximum context length", "too many tokens", "token limit", "too many inputs", "too large"}
+
+// IsEmbeddingBatchRecoverable 批量生成向量失败后逐条重试是否可能成功：
+// 限流、服务端和网络错误，空结果，以及批量请求超过大小限制时可以逐条重试；
+// 维度不一致、认证失败等错误对每条文本都会重现，逐条重试只会放大失败的请求数
+func IsEmbeddingBatchRecoverable(err error) bool {
+	var dimensionErr *EmbeddingDimensionError
+	if errors.As(err, &dimensionErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrEmptyEmbedding) || isRetryableEmbeddingError(err, embeddingRetryConfig(config.EmbeddingConfig{})) {
+		return true
+	}
+	if match := embeddingStatusPattern.FindStringSubmatch(err.Error()); match != nil && match[1] == "413" {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, pattern := range embeddingSizeErrors {
+		if strings.Contains(message, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddingRetryConfig 按向量配置生成重试配置，未设置的退避倍数按2处理
+func embeddingRetryConfig(cfg config.EmbeddingConfig) *RetryConfig {
+	factor := cfg.BackoffFactor
+	if factor < 1 {
+		factor = 2
+	}
+	return &RetryConfig{
+		MaxRetries:    cfg.MaxRetries,
+		InitialDelay:  cfg.RetryBackoff,
+		MaxDelay:      cfg.MaxRetryDelay,
+		BackoffFactor: factor,
+		// LangChain-Go将网络错误转换为以下信息，原始错误类型不保留
+		RetryableErrors: []string{"request timeout", "network error", "rate limit", "too many requests"},
+	}
+}
+
+// isRetryableEmbeddingError 只有限流（429）、服务端错误（5xx）和网络错误可以重试；
+// 认证失败、输入超长等客户端错误重试也不会成功
+func isRetryableEmbeddingError(err error, retry *RetryConfig) bool {
+	if llms.IsRateLimitError(err) {
+		return true
+	}
+	if match := embeddingStatusPattern.FindStringSubmatch(err.Error()); match != nil {
+		code, _ := strconv.Atoi(match[1])
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+	message := strings.ToLower(err.Error())
+	for _, pattern := range retry.RetryableErrors {
+		if strings.Contains(message, pattern) {
+			return true
+		}
 	}
+	return false
+}
 
-	if len(vectors) == 0 || len(vectors[0]) == 0 {
-		return pgvector.NewVector(nil), fmt.Errorf("no embedding data returned")
+// hasEmptyVector 结果中是否有空向量
+func hasEmptyVector(vectors [][]float32) bool {
+	for _, vector := range vectors {
+		if len(vector) == 0 {
+			return true
+		}
 	}
+	return false
+}
 
-	// pgvector.NewVector接受[]float32，所以直接使用
-	return pgvector.NewVector(vectors[0]), nil
+// normalizeL2 返回缩放到单位长度的向量副本，零向量原样返回
+func normalizeL2(vector []float32) []float32 {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return vector
+	}
+	norm := math.Sqrt(sum)
+	normalized := make([]float32, len(vector))
+	for i, v := range vector {
+		normalized[i] = float32(float64(v) / norm)
+	}
+	return normalized
 }
@@ -0,0 +1,407 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/internal/redact"
+	"ai-knowledge-app/pkg/logger"
+	"ai-knowledge-app/pkg/utils"
+)
+
+// stubEmbedder returns the queued results in order, repeating the last one
+type stubEmbedder struct {
+	results  [][][]float32
+	errs     []error
+	calls    int
+	lastText string
+}
+
+func (e *stubEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) > 0 {
+		e.lastText = texts[0]
+	}
+	i := e.calls
+	if i >= len(e.results) {
+		i = len(e.results) - 1
+	}
+	e.calls++
+	return e.results[i], e.errs[i]
+}
+
+func (e *stubEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := e.EmbedDocuments(ctx, []string{text})
+	if err != nil || len(vectors) == 0 {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+func newTestVectorService(embedder *stubEmbedder, maxRetries int) *OpenAIVectorService {
+	logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"})
+	cfg := &config.AIConfig{
+		Embedding: config.EmbeddingConfig{
+			MaxRetries:   maxRetries,
+			RetryBackoff: time.Millisecond,
+		},
+	}
+	return &OpenAIVectorService{config: cfg, embedder: embedder}
+}
+
+func TestGenerateEmbeddingRetriesEmptyResult(t *testing.T) {
+	embedder := &stubEmbedder{
+		results: [][][]float32{{}, {{0.1, 0.2, 0.3}}},
+		errs:    []error{nil, nil},
+	}
+	service := newTestVectorService(embedder, 2)
+
+	vector, err := service.GenerateEmbedding(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("Expected embedding to succeed after retry, got %v", err)
+	}
+	if len(vector.Slice()) != 3 {
+		t.Errorf("Expected 3 dimensions, got %d", len(vector.Slice()))
+	}
+	if embedder.calls != 2 {
+		t.Errorf("Expected 2 embedder calls, got %d", embedder.calls)
+	}
+}
+
+func TestGenerateEmbeddingReturnsTypedErrorWhenExhausted(t *testing.T) {
+	embedder := &stubEmbedder{
+		results: [][][]float32{{{}}},
+		errs:    []error{nil},
+	}
+	service := newTestVectorService(embedder, 2)
+
+	_, err := service.GenerateEmbedding(context.Background(), "hello")
+
+	var embeddingErr *EmbeddingError
+	if !errors.As(err, &embeddingErr) {
+		t.Fatalf("Expected *EmbeddingError, got %v", err)
+	}
+	if embeddingErr.Attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", embeddingErr.Attempts)
+	}
+	if !errors.Is(err, ErrEmptyEmbedding) {
+		t.Errorf("Expected error to wrap ErrEmptyEmbedding, got %v", err)
+	}
+}
+
+func TestGenerateEmbeddingRetriesProviderError(t *testing.T) {
+	embedder := &stubEmbedder{
+		results: [][][]float32{nil, {{1, 2}}},
+		errs:    []error{errors.New("API returned unexpected status code: 503: overloaded"), nil},
+	}
+	service := newTestVectorService(embedder, 1)
+
+	if _, err := service.GenerateEmbedding(context.Background(), "hello"); err != nil {
+		t.Fatalf("Expected embedding to succeed after provider error, got %v", err)
+	}
+
+	// Without retries the first failure is returned immediately
+	embedder = &stubEmbedder{
+		results: [][][]float32{nil, {{1, 2}}},
+		errs:    []error{errors.New("API returned unexpected status code: 503: overloaded"), nil},
+	}
+	service = newTestVectorService(embedder, 0)
+	if _, err := service.GenerateEmbedding(context.Background(), "hello"); err == nil {
+		t.Error("Expected error when retries are disabled")
+	}
+	if embedder.calls != 1 {
+		t.Errorf("Expected 1 embedder call without retries, got %d", embedder.calls)
+	}
+}
+
+func TestGenerateEmbeddingRedactsInput(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	redactor, err := redact.New([]string{"email"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create redactor: %v", err)
+	}
+	embedder := &stubEmbedder{
+		results: [][][]float32{{{0.1, 0.2}}},
+		errs:    []error{nil},
+	}
+	service := newTestVectorService(embedder, 0)
+	service.redactor = redactor
+
+	if _, err := service.GenerateEmbedding(context.Background(), "contact alice@example.com"); err != nil {
+		t.Fatalf("GenerateEmbedding failed: %v", err)
+	}
+	if embedder.lastText != "contact [EMAIL]" {
+		t.Errorf("Expected redacted text to be embedded, got %q", embedder.lastText)
+	}
+}
+
+func TestGenerateEmbeddingNormalize(t *testing.T) {
+	magnitude := func(values []float32) float64 {
+		var sum float64
+		for _, v := range values {
+			sum += float64(v) * float64(v)
+		}
+		return math.Sqrt(sum)
+	}
+	newEmbedder := func() *stubEmbedder {
+		return &stubEmbedder{results: [][][]float32{{{3, 4}}}, errs: []error{nil}}
+	}
+
+	service := newTestVectorService(newEmbedder(), 0)
+	vector, err := service.GenerateEmbedding(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("GenerateEmbedding failed: %v", err)
+	}
+	if magnitude(vector.Slice()) != 5 {
+		t.Errorf("Expected raw vector without normalization, got %v", vector.Slice())
+	}
+
+	service = newTestVectorService(newEmbedder(), 0)
+	service.config.Embedding.Normalize = true
+	vector, err = service.GenerateEmbedding(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("GenerateEmbedding failed: %v", err)
+	}
+	if got := magnitude(vector.Slice()); math.Abs(got-1) > 1e-6 {
+		t.Errorf("Expected unit magnitude, got %f", got)
+	}
+	if values := vector.Slice(); math.Abs(float64(values[0])-0.6) > 1e-6 || math.Abs(float64(values[1])-0.8) > 1e-6 {
+		t.Errorf("Expected direction to be kept, got %v", values)
+	}
+
+	if zero := normalizeL2([]float32{0, 0}); zero[0] != 0 || zero[1] != 0 {
+		t.Errorf("Expected zero vector unchanged, got %v", zero)
+	}
+}
+
+func TestGenerateEmbeddingRejectsDimensionMismatch(t *testing.T) {
+	embedder := &stubEmbedder{
+		results: [][][]float32{{{0.1, 0.2, 0.3}}},
+		errs:    []error{nil},
+	}
+	service := newTestVectorService(embedder, 2)
+	service.config.Embedding.Model = "text-embedding-3-small"
+	service.config.Embedding.Dimensions = 4
+
+	_, err := service.GenerateEmbedding(context.Background(), "hello")
+
+	var dimErr *EmbeddingDimensionError
+	if !errors.As(err, &dimErr) {
+		t.Fatalf("Expected *EmbeddingDimensionError, got %v", err)
+	}
+	if dimErr.Model != "text-embedding-3-small" || dimErr.Expected != 4 || dimErr.Actual != 3 {
+		t.Errorf("Unexpected dimension error: %+v", dimErr)
+	}
+	// Retrying cannot change the dimension, so the mismatch is returned immediately
+	if embedder.calls != 1 {
+		t.Errorf("Expected 1 embedder call, got %d", embedder.calls)
+	}
+
+	service = newTestVectorService(&stubEmbedder{results: [][][]float32{{{0.1, 0.2, 0.3}}}, errs: []error{nil}}, 0)
+	service.config.Embedding.Dimensions = 3
+	if _, err := service.GenerateEmbedding(context.Background(), "hello"); err != nil {
+		t.Errorf("Expected matching dimensions to succeed, got %v", err)
+	}
+}
+
+// batchEmbedder returns one vector per input text and fails the given request
+type batchEmbedder struct {
+	batches [][]string
+	failAt  int // 1-based request number that fails, 0 never fails
+}
+
+func (e *batchEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	e.batches = append(e.batches, texts)
+	if len(e.batches) == e.failAt {
+		return nil, errors.New("context length exceeded")
+	}
+	vectors := make([][]float32, len(texts))
+	for i := range texts {
+		vectors[i] = []float32{float32(len(e.batches)), float32(i)}
+	}
+	return vectors, nil
+}
+
+func (e *batchEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestGenerateEmbeddingsBatches(t *testing.T) {
+	embedder := &batchEmbedder{}
+	service := &OpenAIVectorService{
+		config:   &config.AIConfig{Embedding: config.EmbeddingConfig{BatchSize: 2}},
+		embedder: embedder,
+	}
+
+	vectors, err := service.GenerateEmbeddings(context.Background(), []string{"a", "b", "c", "d", "e"})
+	if err != nil {
+		t.Fatalf("GenerateEmbeddings failed: %v", err)
+	}
+	if len(embedder.batches) != 3 || len(embedder.batches[0]) != 2 || len(embedder.batches[2]) != 1 {
+		t.Errorf("Expected input split into batches of 2, got %v", embedder.batches)
+	}
+	// Results keep the input order across batches
+	if len(vectors) != 5 || vectors[2].Slice()[0] != 2 || vectors[4].Slice()[0] != 3 {
+		t.Errorf("Unexpected vectors: %v", vectors)
+	}
+
+	if _, err := service.GenerateEmbeddings(context.Background(), []string{"a", ""}); err == nil {
+		t.Error("Expected error for empty input text")
+	}
+}
+
+func TestGenerateEmbeddingsReturnsPartialResults(t *testing.T) {
+	embedder := &batchEmbedder{failAt: 2}
+	service := &OpenAIVectorService{
+		config:   &config.AIConfig{Embedding: config.EmbeddingConfig{BatchSize: 2}},
+		embedder: embedder,
+	}
+
+	vectors, err := service.GenerateEmbeddings(context.Background(), []string{"a", "b", "c", "d", "e"})
+
+	var batchErr *EmbeddingBatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Expected *EmbeddingBatchError, got %v", err)
+	}
+	if batchErr.Start != 2 || batchErr.End != 4 || batchErr.Total != 5 {
+		t.Errorf("Expected failed batch [2, 4) of 5, got %+v", batchErr)
+	}
+	var embeddingErr *EmbeddingError
+	if !errors.As(err, &embeddingErr) {
+		t.Errorf("Expected batch error to wrap *EmbeddingError, got %v", err)
+	}
+	// Vectors from the batches before the failure are returned, later batches are not requested
+	if len(vectors) != 2 || len(embedder.batches) != 2 {
+		t.Errorf("Expected 2 vectors from the first batch and no further requests, got %d vectors, %d requests", len(vectors), len(embedder.batches))
+	}
+}
+
+func TestGenerateEmbeddingRetriesOnlyTransientErrors(t *testing.T) {
+	tests := []struct {
+		err   string
+		calls int
+	}{
+		{"failed to create openai embeddings: API returned unexpected status code: 429: Rate limit reached", 3},
+		{"failed to create openai embeddings: API returned unexpected status code: 502", 3},
+		{"failed to create openai embeddings: network error: failed to reach API server", 3},
+		{"failed to create openai embeddings: API returned unexpected status code: 401: Incorrect API key", 1},
+		{"failed to create openai embeddings: API returned unexpected status code: 400: maximum context length exceeded", 1},
+	}
+
+	for _, tt := range tests {
+		embedder := &stubEmbedder{results: [][][]float32{nil}, errs: []error{errors.New(tt.err)}}
+		service := newTestVectorService(embedder, 2)
+
+		_, err := service.GenerateEmbedding(context.Background(), "hello")
+		var embeddingErr *EmbeddingError
+		if !errors.As(err, &embeddingErr) {
+			t.Errorf("%q: expected *EmbeddingError, got %v", tt.err, err)
+			continue
+		}
+		if embedder.calls != tt.calls || embeddingErr.Attempts != tt.calls {
+			t.Errorf("%q: expected %d attempts, got %d calls, %d attempts", tt.err, tt.calls, embedder.calls, embeddingErr.Attempts)
+		}
+	}
+}
+
+func TestIsEmbeddingBatchRecoverable(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&EmbeddingError{Attempts: 3, Err: errors.New("API returned unexpected status code: 503: overloaded")}, true},
+		{&EmbeddingBatchError{Err: &EmbeddingError{Err: ErrEmptyEmbedding}}, true},
+		{errors.New("API returned unexpected status code: 413: payload too large"), true},
+		{errors.New("API returned unexpected status code: 400: This model's maximum context length is 8192 tokens"), true},
+		{errors.New("API returned unexpected status code: 401: invalid api key"), false},
+		{&EmbeddingDimensionError{Model: "m", Expected: 3, Actual: 2}, false},
+		{&EmbeddingError{Err: context.Canceled}, false},
+	}
+	for _, tc := range cases {
+		if got := IsEmbeddingBatchRecoverable(tc.err); got != tc.want {
+			t.Errorf("IsEmbeddingBatchRecoverable(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestEmbeddingRetryConfigDelay(t *testing.T) {
+	retry := embeddingRetryConfig(config.EmbeddingConfig{
+		MaxRetries:    5,
+		RetryBackoff:  100 * time.Millisecond,
+		MaxRetryDelay: 300 * time.Millisecond,
+		BackoffFactor: 2,
+	})
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond}
+	for attempt, expected := range want {
+		if got := retry.Delay(attempt); got != expected {
+			t.Errorf("Delay(%d) = %v, want %v", attempt, got, expected)
+		}
+	}
+
+	// Unset factor and max delay double without a cap
+	retry = embeddingRetryConfig(config.EmbeddingConfig{RetryBackoff: time.Second})
+	if got := retry.Delay(4); got != 16*time.Second {
+		t.Errorf("Expected uncapped doubling, got %v", got)
+	}
+}
+
+func TestGenerateEmbeddingUsesCache(t *testing.T) {
+	embedder := &stubEmbedder{
+		results: [][][]float32{{{0.1, 0.2}}, {{0.3, 0.4}}},
+		errs:    []error{nil, nil},
+	}
+	service := newTestVectorService(embedder, 0)
+	service.cache = newEmbeddingCache(1)
+
+	first, err := service.GenerateEmbedding(context.Background(), "how to  use goroutines")
+	if err != nil {
+		t.Fatalf("GenerateEmbedding failed: %v", err)
+	}
+	// 多余空白规范化后命中缓存，修改返回的向量不影响缓存
+	first.Slice()[0] = 9
+	cached, err := service.GenerateEmbedding(context.Background(), " how to use\tgoroutines ")
+	if err != nil {
+		t.Fatalf("GenerateEmbedding failed: %v", err)
+	}
+	if embedder.calls != 1 || cached.Slice()[0] != 0.1 {
+		t.Errorf("Expected cached vector without a new request, got %v after %d calls", cached.Slice(), embedder.calls)
+	}
+
+	// 容量为1，新文本淘汰旧条目
+	if _, err := service.GenerateEmbedding(context.Background(), "channels"); err != nil {
+		t.Fatalf("GenerateEmbedding failed: %v", err)
+	}
+	if _, err := service.GenerateEmbedding(context.Background(), "how to use goroutines"); err != nil {
+		t.Fatalf("GenerateEmbedding failed: %v", err)
+	}
+	if embedder.calls != 3 {
+		t.Errorf("Expected evicted text to be embedded again, got %d calls", embedder.calls)
+	}
+
+	stats := service.EmbeddingCacheStats()
+	if stats.Hits != 1 || stats.Misses != 3 || stats.Entries != 1 {
+		t.Errorf("Unexpected cache stats: %+v", stats)
+	}
+}
+
+func TestGenerateEmbeddingCacheDisabled(t *testing.T) {
+	embedder := &stubEmbedder{results: [][][]float32{{{0.1, 0.2}}}, errs: []error{nil}}
+	service := newTestVectorService(embedder, 0)
+
+	for i := 0; i < 2; i++ {
+		if _, err := service.GenerateEmbedding(context.Background(), "hello"); err != nil {
+			t.Fatalf("GenerateEmbedding failed: %v", err)
+		}
+	}
+	if embedder.calls != 2 {
+		t.Errorf("Expected every call to reach the embedder without a cache, got %d calls", embedder.calls)
+	}
+	if stats := service.EmbeddingCacheStats(); stats != (utils.CacheStats{}) {
+		t.Errorf("Expected empty stats without a cache, got %+v", stats)
+	}
+}
@@ -0,0 +1,81 @@
+package shutdown
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ai-knowledge-app/pkg/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Step 关闭流程中的一个子系统
+type Step struct {
+	Name    string
+	Timeout time.Duration // 该步骤的时间预算
+	Run     func(ctx context.Context) error
+}
+
+// Result 步骤执行结果
+type Result struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+// Run 在总体时限内按顺序执行关闭步骤并记录每步耗时
+// 每步的预算为其Timeout与总体剩余时间中的较小值；超出预算的步骤不再等待，
+// 某一步失败或超时不会阻止后续步骤执行
+func Run(total time.Duration, steps []Step) []Result {
+	deadline := time.Now().Add(total)
+	results := make([]Result, 0, len(steps))
+
+	for _, step := range steps {
+		budget := step.Timeout
+		if remaining := time.Until(deadline); budget <= 0 || budget > remaining {
+			budget = remaining
+		}
+
+		start := time.Now()
+		err := runStep(step, budget)
+		result := Result{Name: step.Name, Duration: time.Since(start), Err: err}
+		results = append(results, result)
+
+		entry := logger.GetLogger().WithFields(logrus.Fields{
+			"step":        step.Name,
+			"duration_ms": result.Duration.Milliseconds(),
+			"budget_ms":   budget.Milliseconds(),
+		})
+		if err != nil {
+			entry.WithError(err).Error("Shutdown step did not complete cleanly")
+		} else {
+			entry.Info("Shutdown step completed")
+		}
+	}
+
+	return results
+}
+
+// runStep 执行单个步骤，预算耗尽时返回context.DeadlineExceeded而不再等待
+func runStep(step Step, budget time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), budget)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- step.Run(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,89 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ai-knowledge-app/internal/config"
+	"ai-knowledge-app/pkg/logger"
+)
+
+func initTestLogger(t *testing.T) {
+	if err := logger.InitLogger(&config.LogConfig{Level: "error", Format: "text"}); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+}
+
+func TestRunExecutesStepsInOrder(t *testing.T) {
+	initTestLogger(t)
+
+	var order []string
+	step := func(name string) Step {
+		return Step{Name: name, Timeout: time.Second, Run: func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		}}
+	}
+
+	results := Run(5*time.Second, []Step{step("http"), step("background"), step("database")})
+
+	if len(order) != 3 || order[0] != "http" || order[1] != "background" || order[2] != "database" {
+		t.Errorf("Expected steps to run in order, got %v", order)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("Step %s unexpectedly failed: %v", r.Name, r.Err)
+		}
+	}
+}
+
+func TestRunContinuesAfterHungOrFailedStep(t *testing.T) {
+	initTestLogger(t)
+
+	dbClosed := false
+	steps := []Step{
+		{Name: "hung", Timeout: 50 * time.Millisecond, Run: func(ctx context.Context) error {
+			time.Sleep(time.Second) // 忽略ctx的步骤也不能拖住后续步骤
+			return nil
+		}},
+		{Name: "failing", Timeout: time.Second, Run: func(ctx context.Context) error {
+			return errors.New("boom")
+		}},
+		{Name: "database", Timeout: time.Second, Run: func(ctx context.Context) error {
+			dbClosed = true
+			return nil
+		}},
+	}
+
+	start := time.Now()
+	results := Run(5*time.Second, steps)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected hung step to be abandoned after its budget, took %v", elapsed)
+	}
+
+	if !errors.Is(results[0].Err, context.DeadlineExceeded) {
+		t.Errorf("Expected hung step to exceed its budget, got %v", results[0].Err)
+	}
+	if results[1].Err == nil {
+		t.Error("Expected failing step error to be reported")
+	}
+	if !dbClosed || results[2].Err != nil {
+		t.Error("Expected final step to run after earlier failures")
+	}
+}
+
+func TestRunCapsStepBudgetByTotal(t *testing.T) {
+	initTestLogger(t)
+
+	var deadline time.Time
+	Run(100*time.Millisecond, []Step{{Name: "http", Timeout: time.Minute, Run: func(ctx context.Context) error {
+		deadline, _ = ctx.Deadline()
+		return nil
+	}}})
+
+	if time.Until(deadline) > 100*time.Millisecond {
+		t.Errorf("Expected step budget to be capped by total timeout, deadline in %v", time.Until(deadline))
+	}
+}
@@ -128,24 +128,41 @@ func AutoMigrate() error {
 	}
 
 	// 定义需要迁移的模型
-	models := []interface{}{
+	migrations := []interface{}{
 		&models.Category{},
 		&models.Tag{},
 		&models.Knowledge{},
 		&models.KnowledgeTag{},
+		&models.KnowledgeAttachment{},
+		&models.KnowledgeTranslation{},
 		&models.QueryHistory{},
+		&models.QueryFeedback{},
 		&models.Document{},
 		&models.DocumentChunk{},
 		&models.UploadSession{},
+		&models.UploadChunkHash{},
+		&models.StorageStatsSnapshot{},
+		&models.SystemSetting{},
+		&models.ProcessingTask{},
 	}
 
 	// 执行迁移
-	for _, model := range models {
+	for _, model := range migrations {
 		if err := DB.AutoMigrate(model); err != nil {
 			return fmt.Errorf("failed to migrate %T: %w", model, err)
 		}
 	}
 
+	// 为已有知识生成slug
+	if err := models.BackfillKnowledgeSlugs(DB); err != nil {
+		return fmt.Errorf("failed to backfill knowledge slugs: %w", err)
+	}
+
+	// PostgreSQL下创建知识全文检索索引，失败时搜索回退到LIKE匹配
+	if err := models.EnsureKnowledgeSearchIndex(DB); err != nil {
+		log.Printf("Full-text search unavailable: %v", err)
+	}
+
 	log.Println("Database migration completed successfully")
 	return nil
 }
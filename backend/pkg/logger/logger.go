@@ -13,6 +13,9 @@ import (
 // Logger 全局日志实例
 var Logger *logrus.Logger
 
+// fileLogger 日志文件输出，关闭时需要刷新
+var fileLogger *lumberjack.Logger
+
 // InitLogger 初始化日志系统
 func InitLogger(cfg *config.LogConfig) error {
 	Logger = logrus.New()
@@ -59,6 +62,7 @@ func InitLogger(cfg *config.LogConfig) error {
 		Logger: fileHook,
 		Level:  level,
 	})
+	fileLogger = fileHook
 
 	Logger.Info("Logger initialized successfully")
 	return nil
@@ -86,6 +90,14 @@ func (hook *FileHook) Fire(entry *logrus.Entry) error {
 	return err
 }
 
+// Close 关闭日志文件，应在退出前最后调用
+func Close() error {
+	if fileLogger == nil {
+		return nil
+	}
+	return fileLogger.Close()
+}
+
 // GetLogger 获取日志实例
 func GetLogger() *logrus.Logger {
 	return Logger
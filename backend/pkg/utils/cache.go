@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// EvictionReason 缓存条目被移除的原因
+type EvictionReason string
+
+const (
+	EvictionExpired  EvictionReason = "expired"  // 超过TTL
+	EvictionCapacity EvictionReason = "capacity" // 超过容量，淘汰最久未使用的条目
+	EvictionRemoved  EvictionReason = "removed"  // 调用Delete
+	EvictionCleared  EvictionReason = "cleared"  // 调用Clear
+)
+
+// CacheOptions 缓存配置
+type CacheOptions[K comparable, V any] struct {
+	// MaxEntries 最大条目数，超过时淘汰最久未使用的条目；0表示不限制
+	MaxEntries int
+	// TTL 默认过期时间；0表示不过期
+	TTL time.Duration
+	// OnEvict 条目被移除时回调（不包括同键覆盖），在锁外调用，可以安全地访问缓存
+	OnEvict func(key K, value V, reason EvictionReason)
+}
+
+// CacheStats 缓存统计
+type CacheStats struct {
+	Entries   int     `json:"entries"`
+	Hits      int64   `json:"hits"`
+	Misses    int64   `json:"misses"`
+	Evictions int64   `json:"evictions"` // 因过期或容量被移除的条目数
+	HitRate   float64 `json:"hit_rate"`
+}
+
+type cacheEntry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time // 零值表示不过期
+}
+
+type evicted[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictionReason
+}
+
+// Cache 并发安全的TTL+LRU内存缓存
+type Cache[K comparable, V any] struct {
+	opts CacheOptions[K, V]
+
+	mu      sync.Mutex
+	items   map[K]*list.Element
+	order   *list.List // 头部为最近使用
+	hits    int64
+	misses  int64
+	evicted int64
+}
+
+// NewCache 创建缓存
+func NewCache[K comparable, V any](opts CacheOptions[K, V]) *Cache[K, V] {
+	return &Cache[K, V]{
+		opts:  opts,
+		items: make(map[K]*list.Element),
+		order: list.New(),
+	}
+}
+
+// Get 获取未过期的条目并标记为最近使用
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	var removed []evicted[K, V]
+	c.mu.Lock()
+	elem, ok := c.items[key]
+	if ok {
+		entry := elem.Value.(*cacheEntry[K, V])
+		if entry.expired(time.Now()) {
+			removed = append(removed, c.removeLocked(elem, EvictionExpired))
+			ok = false
+		} else {
+			c.order.MoveToFront(elem)
+		}
+	}
+	var value V
+	if ok {
+		c.hits++
+		value = elem.Value.(*cacheEntry[K, V]).value
+	} else {
+		c.misses++
+	}
+	c.mu.Unlock()
+
+	c.notify(removed)
+	return value, ok
+}
+
+// Set 使用默认TTL写入条目
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.opts.TTL)
+}
+
+// SetWithTTL 使用指定TTL写入条目，ttl为0表示不过期
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	now := time.Now()
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = now.Add(ttl)
+	}
+
+	var removed []evicted[K, V]
+	c.mu.Lock()
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*cacheEntry[K, V])
+		entry.value, entry.expiresAt = value, expiresAt
+		c.order.MoveToFront(elem)
+	} else {
+		c.items[key] = c.order.PushFront(&cacheEntry[K, V]{key: key, value: value, expiresAt: expiresAt})
+		if c.opts.MaxEntries > 0 && len(c.items) > c.opts.MaxEntries {
+			removed = c.evictLocked(now)
+		}
+	}
+	c.mu.Unlock()
+
+	c.notify(removed)
+}
+
+// evictLocked 先清理过期条目，仍然超出容量时从最久未使用的一端淘汰
+func (c *Cache[K, V]) evictLocked(now time.Time) []evicted[K, V] {
+	var removed []evicted[K, V]
+	for elem := c.order.Back(); elem != nil; {
+		prev := elem.Prev()
+		if elem.Value.(*cacheEntry[K, V]).expired(now) {
+			removed = append(removed, c.removeLocked(elem, EvictionExpired))
+		}
+		elem = prev
+	}
+	for len(c.items) > c.opts.MaxEntries {
+		removed = append(removed, c.removeLocked(c.order.Back(), EvictionCapacity))
+	}
+	return removed
+}
+
+// Delete 删除条目，返回条目是否存在
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	elem, ok := c.items[key]
+	var removed []evicted[K, V]
+	if ok {
+		removed = append(removed, c.removeLocked(elem, EvictionRemoved))
+	}
+	c.mu.Unlock()
+
+	c.notify(removed)
+	return ok
+}
+
+// DeleteExpired 清理所有过期条目，返回清理的数量
+func (c *Cache[K, V]) DeleteExpired() int {
+	now := time.Now()
+	var removed []evicted[K, V]
+	c.mu.Lock()
+	for elem := c.order.Back(); elem != nil; {
+		prev := elem.Prev()
+		if elem.Value.(*cacheEntry[K, V]).expired(now) {
+			removed = append(removed, c.removeLocked(elem, EvictionExpired))
+		}
+		elem = prev
+	}
+	c.mu.Unlock()
+
+	c.notify(removed)
+	return len(removed)
+}
+
+// Clear 清空缓存，统计数据保留
+func (c *Cache[K, V]) Clear() {
+	var removed []evicted[K, V]
+	c.mu.Lock()
+	if c.opts.OnEvict != nil {
+		for elem := c.order.Back(); elem != nil; elem = elem.Prev() {
+			entry := elem.Value.(*cacheEntry[K, V])
+			removed = append(removed, evicted[K, V]{entry.key, entry.value, EvictionCleared})
+		}
+	}
+	c.items = make(map[K]*list.Element)
+	c.order.Init()
+	c.mu.Unlock()
+
+	c.notify(removed)
+}
+
+// Len 返回当前条目数（可能包含尚未清理的过期条目）
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// Stats 返回缓存统计
+func (c *Cache[K, V]) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := CacheStats{Entries: len(c.items), Hits: c.hits, Misses: c.misses, Evictions: c.evicted}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits) / float64(total)
+	}
+	return stats
+}
+
+func (c *Cache[K, V]) removeLocked(elem *list.Element, reason EvictionReason) evicted[K, V] {
+	entry := c.order.Remove(elem).(*cacheEntry[K, V])
+	delete(c.items, entry.key)
+	if reason == EvictionExpired || reason == EvictionCapacity {
+		c.evicted++
+	}
+	return evicted[K, V]{entry.key, entry.value, reason}
+}
+
+// notify 在锁外调用淘汰回调
+func (c *Cache[K, V]) notify(removed []evicted[K, V]) {
+	if c.opts.OnEvict == nil {
+		return
+	}
+	for _, e := range removed {
+		c.opts.OnEvict(e.key, e.value, e.reason)
+	}
+}
+
+func (e *cacheEntry[K, V]) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheGetSetAndExpiry(t *testing.T) {
+	var reasons []EvictionReason
+	cache := NewCache(CacheOptions[string, int]{
+		TTL:     30 * time.Millisecond,
+		OnEvict: func(key string, value int, reason EvictionReason) { reasons = append(reasons, reason) },
+	})
+
+	if _, ok := cache.Get("a"); ok {
+		t.Fatal("Expected miss on empty cache")
+	}
+	cache.Set("a", 1)
+	cache.SetWithTTL("forever", 2, 0)
+	if v, ok := cache.Get("a"); !ok || v != 1 {
+		t.Fatalf("Expected cached value 1, got %d, %v", v, ok)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := cache.Get("a"); ok {
+		t.Error("Expected entry to expire after TTL")
+	}
+	if _, ok := cache.Get("forever"); !ok {
+		t.Error("Expected entry without TTL to be kept")
+	}
+
+	stats := cache.Stats()
+	if stats.Entries != 1 || stats.Hits != 2 || stats.Misses != 2 || stats.Evictions != 1 || stats.HitRate != 0.5 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if len(reasons) != 1 || reasons[0] != EvictionExpired {
+		t.Errorf("Expected one expired eviction, got %v", reasons)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	evicted := map[string]EvictionReason{}
+	cache := NewCache(CacheOptions[string, int]{
+		MaxEntries: 2,
+		OnEvict:    func(key string, value int, reason EvictionReason) { evicted[key] = reason },
+	})
+
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	cache.Get("a") // b becomes least recently used
+	cache.Set("c", 3)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("Expected %s to be kept", key)
+		}
+	}
+	if evicted["b"] != EvictionCapacity || len(evicted) != 1 {
+		t.Errorf("Expected b evicted for capacity, got %v", evicted)
+	}
+
+	// 覆盖已有键不触发淘汰
+	cache.Set("a", 10)
+	if v, _ := cache.Get("a"); v != 10 || cache.Len() != 2 || len(evicted) != 1 {
+		t.Errorf("Expected overwrite in place, got value %d, len %d, evicted %v", v, cache.Len(), evicted)
+	}
+}
+
+func TestCachePrefersExpiredEntriesWhenFull(t *testing.T) {
+	cache := NewCache(CacheOptions[string, int]{MaxEntries: 2})
+	cache.SetWithTTL("short", 1, 10*time.Millisecond)
+	cache.Set("old", 2)
+	cache.Get("short")
+	time.Sleep(20 * time.Millisecond)
+	cache.Set("new", 3)
+
+	if _, ok := cache.Get("old"); !ok {
+		t.Error("Expected live entry to survive while an expired one can be dropped")
+	}
+}
+
+func TestCacheDeleteAndClear(t *testing.T) {
+	evicted := map[string]EvictionReason{}
+	cache := NewCache(CacheOptions[string, int]{
+		OnEvict: func(key string, value int, reason EvictionReason) { evicted[key] = reason },
+	})
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	cache.SetWithTTL("c", 3, time.Millisecond)
+
+	if !cache.Delete("a") || cache.Delete("a") {
+		t.Error("Expected Delete to report whether the key existed")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if n := cache.DeleteExpired(); n != 1 {
+		t.Errorf("Expected 1 expired entry to be removed, got %d", n)
+	}
+	cache.Clear()
+
+	want := map[string]EvictionReason{"a": EvictionRemoved, "b": EvictionCleared, "c": EvictionExpired}
+	for key, reason := range want {
+		if evicted[key] != reason {
+			t.Errorf("%s: expected reason %s, got %s", key, reason, evicted[key])
+		}
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Expected empty cache after Clear, got %d entries", cache.Len())
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 {
+		t.Errorf("Expected only the expired entry counted as eviction, got %d", stats.Evictions)
+	}
+}
+
+func TestCacheConcurrentAccess(t *testing.T) {
+	cache := NewCache(CacheOptions[int, int]{MaxEntries: 50, TTL: time.Minute})
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				cache.Set(i%100, g)
+				cache.Get(i % 70)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if n := cache.Len(); n > 50 {
+		t.Errorf("Expected at most 50 entries, got %d", n)
+	}
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/modern-go/reflect2"
+)
+
+// DefaultResponseTimeFormat API响应中时间字段的默认格式
+const DefaultResponseTimeFormat = time.RFC3339
+
+// responseTimeFormat API响应中时间字段的格式
+var responseTimeFormat atomic.Value
+
+func init() {
+	responseTimeFormat.Store(DefaultResponseTimeFormat)
+}
+
+// SetResponseTimeFormat 设置API响应中time.Time字段的输出格式（Go时间布局），空值恢复默认的RFC3339
+func SetResponseTimeFormat(layout string) {
+	if layout == "" {
+		layout = DefaultResponseTimeFormat
+	}
+	responseTimeFormat.Store(layout)
+}
+
+// ResponseTimeFormat 返回当前API响应使用的时间格式
+func ResponseTimeFormat() string {
+	return responseTimeFormat.Load().(string)
+}
+
+// responseJSON 与encoding/json行为一致，仅将time.Time按配置的格式输出
+var responseJSON = func() jsoniter.API {
+	api := jsoniter.Config{
+		EscapeHTML:             true,
+		SortMapKeys:            true,
+		ValidateJsonRawMessage: true,
+	}.Froze()
+	api.RegisterExtension(&timeFormatExtension{})
+	return api
+}()
+
+// timeFormatExtension 为time.Time提供按配置格式输出的编码器
+type timeFormatExtension struct {
+	jsoniter.DummyExtension
+}
+
+// *time.Time实现了json.Marshaler，需要单独注册，否则会绕过timeEncoder
+func (e *timeFormatExtension) CreateEncoder(typ reflect2.Type) jsoniter.ValEncoder {
+	switch typ {
+	case reflect2.TypeOf(time.Time{}):
+		return timeEncoder{}
+	case reflect2.TypeOf((*time.Time)(nil)):
+		return timePtrEncoder{}
+	}
+	return nil
+}
+
+type timeEncoder struct{}
+
+// IsEmpty 与encoding/json一致，omitempty不省略结构体类型的时间
+func (timeEncoder) IsEmpty(ptr unsafe.Pointer) bool {
+	return false
+}
+
+func (timeEncoder) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
+	stream.WriteString((*time.Time)(ptr).Format(ResponseTimeFormat()))
+}
+
+type timePtrEncoder struct{}
+
+func (timePtrEncoder) IsEmpty(ptr unsafe.Pointer) bool {
+	return *(**time.Time)(ptr) == nil
+}
+
+func (timePtrEncoder) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
+	t := *(**time.Time)(ptr)
+	if t == nil {
+		stream.WriteNil()
+		return
+	}
+	stream.WriteString(t.Format(ResponseTimeFormat()))
+}
+
+// MarshalResponseJSON 按API响应的格式序列化
+func MarshalResponseJSON(v interface{}) ([]byte, error) {
+	return responseJSON.Marshal(v)
+}
+
+// responseRender 使用responseJSON输出的gin渲染器
+type responseRender struct {
+	data interface{}
+}
+
+func (r responseRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	body, err := MarshalResponseJSON(r.data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+func (r responseRender) WriteContentType(w http.ResponseWriter) {
+	header := w.Header()
+	if val := header["Content-Type"]; len(val) == 0 {
+		header["Content-Type"] = []string{"application/json; charset=utf-8"}
+	}
+}
+
+var _ render.Render = responseRender{}
+
+// JSON 输出JSON响应，时间字段使用统一的格式
+func JSON(c *gin.Context, code int, data interface{}) {
+	c.Render(code, responseRender{data: data})
+}
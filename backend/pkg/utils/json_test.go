@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type jsonTestBase struct {
+	ID        uint      `json:"id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	Secret    string    `json:"-"`
+}
+
+type jsonTestItem struct {
+	jsonTestBase
+	Content   string     `json:"content,omitempty"` // 覆盖嵌入结构体的同名字段
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at"`
+	Tags      []string   `json:"tags"`
+	HTML      string     `json:"html"`
+}
+
+func TestMarshalResponseJSON(t *testing.T) {
+	defer SetResponseTimeFormat("")
+
+	created := time.Date(2024, 1, 2, 15, 4, 5, 123456789, time.FixedZone("CST", 8*3600))
+	item := jsonTestItem{
+		jsonTestBase: jsonTestBase{ID: 1, Content: "full", CreatedAt: created, Secret: "x"},
+		UpdatedAt:    &created,
+		HTML:         "<mark>",
+	}
+
+	got, err := MarshalResponseJSON(item)
+	if err != nil {
+		t.Fatalf("MarshalResponseJSON failed: %v", err)
+	}
+	want := `{"id":1,"created_at":"2024-01-02T15:04:05+08:00","updated_at":"2024-01-02T15:04:05+08:00","tags":null,"html":"\u003cmark\u003e"}`
+	if string(got) != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	// 除时间格式外与encoding/json的输出一致
+	standard, _ := json.Marshal(item)
+	var a, b map[string]interface{}
+	json.Unmarshal(got, &a)
+	json.Unmarshal(standard, &b)
+	if len(a) != len(b) {
+		t.Errorf("Expected same fields as encoding/json, got %v and %v", a, b)
+	}
+
+	SetResponseTimeFormat(TimeFormatYYYYMMDDHHMMSS)
+	got, _ = MarshalResponseJSON(map[string]time.Time{"at": created})
+	if string(got) != `{"at":"2024-01-02 15:04:05"}` {
+		t.Errorf("Expected custom layout, got %s", got)
+	}
+}
+
+func TestSuccessResponseTimeFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) {
+		SuccessResponse(c, gin.H{"at": time.Date(2024, 1, 2, 0, 0, 0, 500, time.UTC)})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if body := w.Body.String(); body != `{"code":200,"message":"success","data":{"at":"2024-01-02T00:00:00Z"}}` {
+		t.Errorf("Unexpected response body: %s", body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("Unexpected content type: %s", ct)
+	}
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// languageTagPattern 规范化后的语言标签，如 zh、en、zh-cn、pt-br
+var languageTagPattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// NormalizeLanguage 规范化语言标签：去除空白、转为小写，下划线替换为连字符（zh_CN -> zh-cn）
+func NormalizeLanguage(tag string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(tag)), "_", "-")
+}
+
+// IsValidLanguage 检查规范化后的语言标签格式
+func IsValidLanguage(tag string) bool {
+	return languageTagPattern.MatchString(tag)
+}
+
+// BaseLanguage 返回语言标签的主语言部分（zh-cn -> zh）
+func BaseLanguage(tag string) string {
+	tag = NormalizeLanguage(tag)
+	if i := strings.IndexByte(tag, '-'); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
+
+// DetectLanguage 按文字所属书写系统粗略判断文本的主语言，无法判断时返回空字符串
+// 只区分书写系统：含假名判断为日语，拉丁字母统一判断为英语
+func DetectLanguage(text string) string {
+	var han, kana, hangul, cyrillic, arabic, latin int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+
+	// 日文中汉字和假名混用，出现假名即视为日语
+	if kana > 0 {
+		return "ja"
+	}
+
+	language, best := "", 0
+	for _, candidate := range []struct {
+		language string
+		count    int
+	}{
+		{"zh", han},
+		{"ko", hangul},
+		{"ru", cyrillic},
+		{"ar", arabic},
+		// 拉丁字母按字符计数远多于表意文字，按单词粗略折算后再比较
+		{"en", (latin + 4) / 5},
+	} {
+		if candidate.count > best {
+			language, best = candidate.language, candidate.count
+		}
+	}
+	return language
+}
@@ -0,0 +1,54 @@
+package utils
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"如何配置Go的并发？", "zh"},
+		{"How do I configure goroutines?", "en"},
+		{"Goroutineの使い方", "ja"},
+		{"고루틴 사용법", "ko"},
+		{"Как настроить горутины?", "ru"},
+		{"Go语言中的goroutine和channel", "zh"},
+		{"12345 ?!", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := DetectLanguage(tt.text); got != tt.want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := []struct {
+		tag   string
+		want  string
+		base  string
+		valid bool
+	}{
+		{" zh_CN ", "zh-cn", "zh", true},
+		{"EN", "en", "en", true},
+		{"pt-BR", "pt-br", "pt", true},
+		{"english", "english", "english", false},
+		{"e", "e", "e", false},
+		{"", "", "", false},
+	}
+
+	for _, tt := range tests {
+		got := NormalizeLanguage(tt.tag)
+		if got != tt.want {
+			t.Errorf("NormalizeLanguage(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+		if base := BaseLanguage(tt.tag); base != tt.base {
+			t.Errorf("BaseLanguage(%q) = %q, want %q", tt.tag, base, tt.base)
+		}
+		if valid := IsValidLanguage(got); valid != tt.valid {
+			t.Errorf("IsValidLanguage(%q) = %v, want %v", got, valid, tt.valid)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
 	"mime/multipart"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"regexp"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/gin-gonic/gin"
 )
@@ -42,7 +44,7 @@ type PaginationResponse struct {
 
 // SuccessResponse 成功响应
 func SuccessResponse(c *gin.Context, data interface{}) {
-	c.JSON(200, Response{
+	JSON(c, 200, Response{
 		Code:    200,
 		Message: "success",
 		Data:    data,
@@ -51,7 +53,7 @@ func SuccessResponse(c *gin.Context, data interface{}) {
 
 // ErrorResponse 错误响应
 func ErrorResponse(c *gin.Context, code int, message string) {
-	c.JSON(code, Response{
+	JSON(c, code, Response{
 		Code:    code,
 		Message: message,
 	})
@@ -59,7 +61,7 @@ func ErrorResponse(c *gin.Context, code int, message string) {
 
 // ValidationError 验证错误响应
 func ValidationError(c *gin.Context, errors interface{}) {
-	c.JSON(422, Response{
+	JSON(c, 422, Response{
 		Code:    422,
 		Message: "validation failed",
 		Data:    errors,
@@ -152,6 +154,118 @@ func SaveUploadedFile(file *multipart.FileHeader, dstDir string) (string, error)
 	return filename, nil
 }
 
+// maxSlugLength slug的最大字符数
+const maxSlugLength = 80
+
+// Slugify 将标题转换为URL友好的slug：转为小写，保留各语言的字母和数字，
+// 其余字符替换为连字符，不产生空slug
+func Slugify(title string) string {
+	var b strings.Builder
+	count := 0
+	pendingDash := false
+	for _, r := range strings.ToLower(title) {
+		if count >= maxSlugLength {
+			break
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			pendingDash = b.Len() > 0
+			continue
+		}
+		if pendingDash {
+			b.WriteByte('-')
+			count++
+			pendingDash = false
+		}
+		b.WriteRune(r)
+		count++
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if slug == "" {
+		return "knowledge"
+	}
+	return slug
+}
+
+// Snippet 截取正文中首个匹配词附近最多length个字符（按rune计）的片段，空白合并为单个空格
+// 结果已做HTML转义，片段内所有匹配（不区分大小写）用<mark>标记，前后有省略时加省略号
+// 正文不包含匹配词时从开头截取；length不大于0时不截断
+func Snippet(text, term string, length int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if length <= 0 || length > len(runes) {
+		length = len(runes)
+	}
+	needle := []rune(strings.ToLower(strings.TrimSpace(term)))
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	match := -1
+	if len(needle) > 0 {
+		match = indexRunes(lower, needle, 0)
+	}
+
+	start := 0
+	if match > 0 && len(runes) > length {
+		// 匹配词尽量居中
+		start = match - (length-len(needle))/2
+		if start > match {
+			start = match
+		}
+		if start > len(runes)-length {
+			start = len(runes) - length
+		}
+		if start < 0 {
+			start = 0
+		}
+	}
+	end := start + length
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for match >= 0 && pos < end {
+		next := indexRunes(lower[:end], needle, pos)
+		if next < 0 {
+			break
+		}
+		b.WriteString(html.EscapeString(string(runes[pos:next])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(runes[next : next+len(needle)])))
+		b.WriteString("</mark>")
+		pos = next + len(needle)
+	}
+	if pos < end {
+		b.WriteString(html.EscapeString(string(runes[pos:end])))
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// indexRunes 返回needle在haystack中从from开始的首次出现位置，不存在时返回-1
+func indexRunes(haystack, needle []rune, from int) int {
+	for i := from; i+len(needle) <= len(haystack); i++ {
+		found := true
+		for j, r := range needle {
+			if haystack[i+j] != r {
+				found = false
+				break
+			}
+		}
+		if found {
+			return i
+		}
+	}
+	return -1
+}
+
 // IsValidURL 验证URL格式
 func IsValidURL(url string) bool {
 	regex := regexp.MustCompile(`^(https?|ftp):\/\/[^\s/$.?#].[^\s]*$`)
@@ -234,17 +348,3 @@ func GetEnv(key, defaultValue string) string {
 func IsDevelopment() bool {
 	return gin.Mode() == gin.DebugMode
 }
-
-// GetClientIP 获取客户端IP
-func GetClientIP(c *gin.Context) string {
-	// 优先从X-Forwarded-For获取
-	if ip := c.GetHeader("X-Forwarded-For"); ip != "" {
-		return ip
-	}
-	// 其次从X-Real-IP获取
-	if ip := c.GetHeader("X-Real-IP"); ip != "" {
-		return ip
-	}
-	// 最后使用RemoteAddr
-	return c.ClientIP()
-}
\ No newline at end of file
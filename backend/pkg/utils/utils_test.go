@@ -0,0 +1,45 @@
+package utils
+
+import "testing"
+
+func TestSlugify(t *testing.T) {
+	cases := map[string]string{
+		"Hello, World!":         "hello-world",
+		"  Go 1.22 -- Release ": "go-1-22-release",
+		"Go 入门指南":               "go-入门指南",
+		"snake_case_title":      "snake-case-title",
+		"!!!":                   "knowledge",
+		"":                      "knowledge",
+	}
+	for title, want := range cases {
+		if got := Slugify(title); got != want {
+			t.Errorf("Slugify(%q) = %q, want %q", title, got, want)
+		}
+	}
+
+	long := Slugify("a very long title with many many words that keeps going on and on until it is far longer than any url should be")
+	if n := len([]rune(long)); n > maxSlugLength || long[len(long)-1] == '-' {
+		t.Errorf("Expected slug truncated to %d runes without a trailing hyphen, got %q", maxSlugLength, long)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	cases := []struct {
+		text, term string
+		length     int
+		want       string
+	}{
+		{"Go makes concurrency easy", "go", 100, "<mark>Go</mark> makes concurrency easy"},
+		{"0123456789 match 0123456789", "MATCH", 11, "…89 <mark>match</mark> 01…"},
+		{"no hit here at all", "xyz", 6, "no hit…"},
+		{"the end match", "match", 7, "…d <mark>match</mark>"},
+		{"a <b> & a", "a", 20, "<mark>a</mark> &lt;b&gt; &amp; <mark>a</mark>"},
+		{"Go语言\n\n入门  指南", "入门", 4, "… <mark>入门</mark> …"},
+		{"short", "", 0, "short"},
+	}
+	for _, tc := range cases {
+		if got := Snippet(tc.text, tc.term, tc.length); got != tc.want {
+			t.Errorf("Snippet(%q, %q, %d) = %q, want %q", tc.text, tc.term, tc.length, got, tc.want)
+		}
+	}
+}
@@ -25,18 +25,21 @@ const DocumentManagement: React.FC = () => {
   const [editModal, setEditModal] = useState<{ visible: boolean; document?: Document }>({ visible: false });
   const [description, setDescription] = useState('');
   const [uploadProgress, setUploadProgress] = useState<{ [key: string]: number }>({});
+  const [pagination, setPagination] = useState({ page: 1, pageSize: 10, total: 0 });
 
   useEffect(() => {
     loadDocuments();
-  }, []);
+  }, [pagination.page, pagination.pageSize]);
 
   const loadDocuments = async () => {
     setLoading(true);
     try {
-      const response = await documentService.getDocuments();
-      // 根据实际API返回结构调整
-      const documentsData = response.data?.items || response.data || [];
-      setDocuments(Array.isArray(documentsData) ? documentsData : []);
+      const response = await documentService.getDocuments({
+        page: pagination.page,
+        page_size: pagination.pageSize,
+      });
+      setDocuments(response.data?.items || []);
+      setPagination(prev => ({ ...prev, total: response.data?.total || 0 }));
     } catch (error) {
       console.error('加载文档失败:', error);
       message.error('加载文档失败');
@@ -226,6 +229,15 @@ const DocumentManagement: React.FC = () => {
         dataSource={documents}
         rowKey="id"
         loading={loading}
+        pagination={{
+          current: pagination.page,
+          pageSize: pagination.pageSize,
+          total: pagination.total,
+          showSizeChanger: true,
+          onChange: (page, pageSize) => {
+            setPagination(prev => ({ ...prev, page, pageSize: pageSize || 10 }));
+          },
+        }}
       />
 
       <Modal
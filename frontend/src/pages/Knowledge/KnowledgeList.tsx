@@ -155,9 +155,17 @@ const KnowledgeList: React.FC = () => {
           >
             {text}
           </a>
-          <div style={{ fontSize: 12, color: '#666', marginTop: 4 }}>
-            {truncateText(record.content, 50)}
-          </div>
+          {record.snippet !== undefined ? (
+            // 摘要由后端转义并用<mark>标出匹配的关键词
+            <div
+              style={{ fontSize: 12, color: '#666', marginTop: 4 }}
+              dangerouslySetInnerHTML={{ __html: record.snippet }}
+            />
+          ) : (
+            <div style={{ fontSize: 12, color: '#666', marginTop: 4 }}>
+              {truncateText(record.content, 50)}
+            </div>
+          )}
         </div>
       ),
     },
@@ -6,7 +6,9 @@ import type {
   QueryStats,
   PaginationResponse,
   PaginationRequest,
-  FeedbackRequest
+  FeedbackRequest,
+  FeedbackStats,
+  EmbeddingInfo
 } from '../types';
 
 export class AIService {
@@ -16,7 +18,7 @@ export class AIService {
   }
 
   // 获取查询历史
-  async getQueryHistory(params?: PaginationRequest & { model?: string }) {
+  async getQueryHistory(params?: PaginationRequest & { model?: string; conversation_id?: string }) {
     return apiService.get<PaginationResponse<QueryHistory>>('/ai/history', { params });
   }
 
@@ -35,11 +37,21 @@ export class AIService {
     return apiService.post('/ai/feedback', data);
   }
 
+  // 获取反馈统计
+  async getFeedbackStats() {
+    return apiService.get<FeedbackStats>('/ai/feedback/stats');
+  }
+
   // 获取支持的模型列表
   async getModels() {
     return apiService.get<{ models: string[] }>('/ai/models');
   }
 
+  // 获取向量模型信息
+  async getEmbeddingInfo() {
+    return apiService.get<EmbeddingInfo>('/ai/embedding-info');
+  }
+
   // 流式查询（如果后端支持的话）
   async streamQuery(data: AIQueryRequest, onChunk: (chunk: string) => void) {
     // 这里可以实现流式响应处理
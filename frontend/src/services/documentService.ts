@@ -1,19 +1,24 @@
 import { apiService } from './api';
 import type {
   Document,
-  UploadSession,
+  UploadProgress,
+  InitUploadResult,
   PaginationRequest,
   PaginationResponse
 } from '../types';
 
-// 计算文件SHA256哈希
-async function calculateFileHash(file: File): Promise<string> {
-  const buffer = await file.arrayBuffer();
+// 计算数据的SHA256哈希（十六进制）
+async function sha256Hex(buffer: ArrayBuffer): Promise<string> {
   const hashBuffer = await crypto.subtle.digest('SHA-256', buffer);
   const hashArray = Array.from(new Uint8Array(hashBuffer));
   return hashArray.map(b => b.toString(16).padStart(2, '0')).join('');
 }
 
+// 计算文件SHA256哈希
+async function calculateFileHash(file: File): Promise<string> {
+  return sha256Hex(await file.arrayBuffer());
+}
+
 export class DocumentService {
   // 检查文件是否存在（秒传）
   async checkFile(hash: string, size: number) {
@@ -22,19 +27,27 @@ export class DocumentService {
     });
   }
 
+  // 批量检查文件是否存在（秒传预检），结果顺序与请求一致
+  async checkFiles(files: { hash: string; size: number }[]) {
+    return apiService.post<{
+      results: { hash: string; size: number; exists: boolean; document_id?: number }[];
+    }>('/documents/check-batch', { files });
+  }
+
   // 初始化分片上传
   async initUpload(fileName: string, fileSize: number, fileHash: string) {
-    return apiService.post<UploadSession>('/documents/init', {
+    return apiService.post<InitUploadResult>('/documents/init', {
       file_name: fileName,
       file_size: fileSize,
       file_hash: fileHash
     });
   }
 
-  // 上传分片
+  // 上传分片（附带分片哈希，服务端校验不一致时返回422）
   async uploadChunk(sessionId: string, chunkIndex: number, chunkData: ArrayBuffer) {
+    const chunkHash = await sha256Hex(chunkData);
     return apiService.getInstance().post(`/documents/chunk/${sessionId}/${chunkIndex}`, chunkData, {
-      headers: { 'Content-Type': 'application/octet-stream' }
+      headers: { 'Content-Type': 'application/octet-stream', 'X-Chunk-Hash': chunkHash }
     });
   }
 
@@ -45,7 +58,14 @@ export class DocumentService {
 
   // 获取上传进度
   async getUploadProgress(sessionId: string) {
-    return apiService.get<UploadSession>(`/documents/progress/${sessionId}`);
+    return apiService.get<UploadProgress>(`/documents/progress/${sessionId}`);
+  }
+
+  // 获取尚未上传的分片序号（会话过期返回410）
+  async getMissingChunks(sessionId: string) {
+    return apiService.get<{ session_id: string; total_chunks: number; missing_chunks: number[] }>(
+      `/documents/upload/${sessionId}/missing-chunks`
+    );
   }
 
   // 分片上传文件
@@ -63,8 +83,12 @@ export class DocumentService {
     }
 
     // 初始化上传会话
-    const sessionResult = await this.initUpload(file.name, file.size, fileHash);
-    const session = sessionResult.data;
+    const initResult = await this.initUpload(file.name, file.size, fileHash);
+    if (initResult.data?.status === 'duplicate' && initResult.data.document) {
+      onProgress?.(100);
+      return initResult.data.document;
+    }
+    const session = initResult.data?.session;
     if (!session) {
       throw new Error('Failed to initialize upload session');
     }
@@ -103,10 +127,12 @@ export class DocumentService {
     return apiService.upload<Document>('/documents/upload', formData);
   }
 
-  // 获取文档列表
+  // 获取文档列表（分页），search按文件名匹配
   async getDocuments(params?: PaginationRequest & {
     status?: string;
-    mime_type?: string;
+    extension?: string;
+    min_size?: number;
+    max_size?: number;
   }) {
     return apiService.get<PaginationResponse<Document>>('/documents', { params });
   }
@@ -136,6 +162,35 @@ export class DocumentService {
     return apiService.download(`/documents/${id}/download`, filename);
   }
 
+  // 获取对象存储的预签名下载链接（本地存储返回501，应改用 downloadDocument）
+  async getPresignedUrl(id: number) {
+    return apiService.get<{ url: string; expires_at: string }>(`/documents/${id}/presigned-url`);
+  }
+
+  // 获取去重统计
+  async getDedupStats() {
+    return apiService.get<{
+      total_documents: number;
+      unique_files: number;
+      total_size_bytes: number;
+      unique_size_bytes: number;
+      space_saved_bytes: number;
+      deduplication_ratio: number;
+    }>('/admin/documents/dedup-stats');
+  }
+
+  // 清理对象存储中没有文档引用的对象，dryRun为true时只列出不删除
+  async cleanupOrphans(dryRun = true) {
+    return apiService.post<{ dry_run: boolean; scanned: number; orphaned: string[]; removed: number }>(
+      '/admin/documents/cleanup-orphans', undefined, { params: { dry_run: dryRun } },
+    );
+  }
+
+  // 检查存储健康状态
+  async getStorageHealth() {
+    return apiService.get<{ backend: 'local' | 's3'; healthy: boolean; error?: string }>('/admin/documents/storage-health');
+  }
+
   // 批量删除文档
   async batchDelete(ids: number[]) {
     return apiService.post('/documents/batch-delete', { ids });
@@ -44,6 +44,11 @@ export class CategoryService {
     return apiService.get<PaginationResponse<any>>(`/categories/${id}/knowledges`, { params });
   }
 
+  // 获取未被使用的分类（没有知识且没有子分类）
+  async getUnusedCategories(params?: PaginationRequest) {
+    return apiService.get<PaginationResponse<Category>>('/categories/unused', { params });
+  }
+
   // 获取分类树结构
   async getCategoryTree() {
     return apiService.get<Category[]>('/categories/tree');
@@ -67,6 +72,14 @@ export class TagService {
     return apiService.post<any>('/tags', data);
   }
 
+  // 批量创建标签，已存在或重复的名称会被跳过
+  async batchCreateTags(tags: { name: string; color?: string }[]) {
+    return apiService.post<{
+      created: any[];
+      skipped: { name: string; reason: 'exists' | 'duplicate'; tag_id?: number }[];
+    }>('/tags/batch', { tags });
+  }
+
   // 更新标签
   async updateTag(id: number, data: { name: string; color?: string }) {
     return apiService.put<any>(`/tags/${id}`, data);
@@ -87,6 +100,11 @@ export class TagService {
     const params = limit ? { limit } : {};
     return apiService.get<any[]>('/tags/popular', { params });
   }
+
+  // 获取未被使用的标签（使用次数为0且没有知识关联）
+  async getUnusedTags(params?: PaginationRequest) {
+    return apiService.get<PaginationResponse<any>>('/tags/unused', { params });
+  }
 }
 
 // 统计服务
@@ -1,6 +1,8 @@
 import { apiService } from './api';
 import type {
   Knowledge,
+  KnowledgeAttachment,
+  KnowledgeTranslation,
   CreateKnowledgeRequest,
   UpdateKnowledgeRequest,
   PaginationRequest,
@@ -37,8 +39,8 @@ export class KnowledgeService {
     return apiService.delete(`/knowledge/${id}`);
   }
 
-  // 搜索知识
-  async searchKnowledges(params: PaginationRequest & { q: string }) {
+  // 搜索知识，mode为fulltext时按相关度排序（仅PostgreSQL支持，否则回退到like）
+  async searchKnowledges(params: PaginationRequest & { q: string; mode?: 'like' | 'fulltext' }) {
     return apiService.get<PaginationResponse<Knowledge>>('/knowledge/search', { params });
   }
 
@@ -53,6 +55,41 @@ export class KnowledgeService {
     return apiService.post<{ view_count: number }>(`/knowledge/${id}/view`);
   }
 
+  // 获取附件
+  async getAttachments(id: number) {
+    return apiService.get<KnowledgeAttachment[]>(`/knowledge/${id}/attachments`);
+  }
+
+  // 关联源文档
+  async attachDocument(id: number, documentId: number) {
+    return apiService.post<KnowledgeAttachment>(`/knowledge/${id}/attachments`, { document_id: documentId });
+  }
+
+  // 取消关联（文档本身保留）
+  async detachDocument(id: number, documentId: number) {
+    return apiService.delete(`/knowledge/${id}/attachments/${documentId}`);
+  }
+
+  // 获取译文列表
+  async getTranslations(id: number) {
+    return apiService.get<KnowledgeTranslation[]>(`/knowledge/${id}/translations`);
+  }
+
+  // 获取指定语言的译文
+  async getTranslation(id: number, language: string) {
+    return apiService.get<KnowledgeTranslation>(`/knowledge/${id}/translations/${language}`);
+  }
+
+  // 添加或更新指定语言的译文
+  async saveTranslation(id: number, language: string, data: { title: string; content: string; summary?: string }) {
+    return apiService.put<KnowledgeTranslation>(`/knowledge/${id}/translations/${language}`, data);
+  }
+
+  // 删除指定语言的译文
+  async deleteTranslation(id: number, language: string) {
+    return apiService.delete(`/knowledge/${id}/translations/${language}`);
+  }
+
   // 批量操作
   async batchDelete(ids: number[]) {
     return apiService.post('/knowledge/batch-delete', { ids });
@@ -27,16 +27,33 @@ export interface PaginationResponse<T> {
 export interface Knowledge {
   id: number;
   title: string;
+  slug: string;
   content: string;
+  snippet?: string; // 列表和搜索结果返回的高亮摘要，此时content为空
   summary: string;
   category_id: number;
   tags: Tag[];
   metadata: Metadata;
   is_published: boolean;
   view_count: number;
+  created_by?: number;
   created_at: string;
   updated_at: string;
   category?: Category;
+  display_language?: string; // 检索结果替换为译文时的语言
+  embedding_skip_reason?: string; // 未生成向量的原因，如content_too_short
+}
+
+// 知识的其他语言版本
+export interface KnowledgeTranslation {
+  id: number;
+  knowledge_id: number;
+  language: string;
+  title: string;
+  content: string;
+  summary: string;
+  created_at: string;
+  updated_at: string;
 }
 
 export interface CreateKnowledgeRequest {
@@ -47,6 +64,7 @@ export interface CreateKnowledgeRequest {
   tags: string[];
   metadata: Metadata;
   is_published: boolean;
+  sync_embedding?: boolean; // 返回前生成向量，默认异步生成
 }
 
 export interface UpdateKnowledgeRequest {
@@ -118,7 +136,9 @@ export interface AIQueryRequest {
   model?: string;
   temperature?: number;
   max_tokens?: number;
-  context?: string[];
+  context?: string[]; // 之前的对话，按用户问题、AI回答交替排列
+  conversation_id?: string; // 会话ID，指定时加载该会话最近的问答作为上下文
+  timeout_seconds?: number; // 本次查询的超时秒数，不超过服务端上限
 }
 
 export interface AIQueryResponse {
@@ -129,6 +149,27 @@ export interface AIQueryResponse {
   knowledge_ids?: number[];
   relevant_docs?: string[];
   related_knowledges?: Knowledge[];
+  truncated?: boolean; // 回答超过服务端长度上限被截断
+  prompt_tokens?: number;
+  completion_tokens?: number;
+  tokens_estimated?: boolean; // 服务商未返回用量，按分词器计算
+}
+
+// 向量模型信息
+export interface VectorColumnInfo {
+  table: string;
+  column: string;
+  dimensions: number;
+  vectors: number;
+}
+
+export interface EmbeddingInfo {
+  model: string;
+  dimensions: number;
+  request_dimensions: boolean;
+  normalize: boolean;
+  columns?: VectorColumnInfo[];
+  columns_match?: boolean;
 }
 
 // 查询历史类型
@@ -139,9 +180,15 @@ export interface QueryHistory {
   knowledge_id?: number;
   model: string;
   tokens: number;
+  prompt_tokens: number;
+  completion_tokens: number;
+  tokens_estimated: boolean;
   duration: number;
   is_success: boolean;
   error_message?: string;
+  query_language?: string;
+  answer_language?: string;
+  conversation_id?: string;
   created_at: string;
   updated_at: string;
   knowledge?: Knowledge;
@@ -155,9 +202,16 @@ export interface QueryStats {
   success_count: number;
   success_rate: number;
   avg_duration: number;
+  token_usage: {
+    prompt_tokens: number;
+    completion_tokens: number;
+    estimated_count: number;
+  };
   by_models: Array<{
     model: string;
     count: number;
+    prompt_tokens: number;
+    completion_tokens: number;
   }>;
   popular_queries: Array<{
     query: string;
@@ -234,11 +288,18 @@ export interface Document {
   mime_type: string;
   extension: string;
   description: string;
-  status: 'uploading' | 'processing' | 'completed' | 'failed';
+  status: 'uploading' | 'processing' | 'completed' | 'failed' | 'corrupted'; // corrupted：存储文件缺失或哈希不一致
+  near_duplicate_id?: number; // 开启upload.near_duplicate_max_distance时，处理后记录的近似重复文档
   created_at: string;
   updated_at: string;
 }
 
+// 知识附件：作为附件关联的源文档
+export interface KnowledgeAttachment extends Document {
+  attached_at: string;
+  download_url: string;
+}
+
 // 上传会话类型
 export interface UploadSession {
   id: string;
@@ -255,6 +316,20 @@ export interface UploadSession {
   updated_at: string;
 }
 
+// 上传进度：在会话基础上附加已上传分片数、百分比和预计剩余秒数（尚无数据时为 null）
+export interface UploadProgress extends UploadSession {
+  uploaded_chunks: number;
+  percentage: number;
+  estimated_seconds_remaining: number | null;
+}
+
+// 初始化上传结果：duplicate 表示内容已存在并已创建文档（秒传），无需上传分片
+export interface InitUploadResult {
+  status: 'upload_required' | 'duplicate';
+  session?: UploadSession;
+  document?: Document;
+}
+
 // 反馈类型
 export interface FeedbackRequest {
   query_id: number;
@@ -263,6 +338,19 @@ export interface FeedbackRequest {
   is_helpful: boolean;
 }
 
+// 反馈统计
+export interface FeedbackStats {
+  total: number;
+  average_rating: number;
+  helpful_count: number;
+  helpful_percentage: number;
+  by_models: Array<{
+    model: string;
+    count: number;
+    average_rating: number;
+  }>;
+}
+
 // 导出的常量
 export const API_BASE_URL = '/api/v1';
 